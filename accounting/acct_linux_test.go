@@ -0,0 +1,98 @@
+package accounting
+
+import (
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+)
+
+// sampleRecord builds a struct acct_v3 record, in the byte order of the
+// host (little endian on the supported architectures).
+func sampleRecord(comm string, pid, exitcode uint32) []byte {
+	buf := make([]byte, Ssize)
+	buf[0] = byte(Fork)
+	buf[1] = 3
+	binary.LittleEndian.PutUint32(buf[4:], exitcode)
+	binary.LittleEndian.PutUint32(buf[8:], 0)  // uid
+	binary.LittleEndian.PutUint32(buf[12:], 0) // gid
+	binary.LittleEndian.PutUint32(buf[16:], pid)
+	binary.LittleEndian.PutUint32(buf[20:], 1)
+	binary.LittleEndian.PutUint32(buf[24:], 1520000000)
+	binary.LittleEndian.PutUint32(buf[28:], math.Float32bits(250)) // etime, in ticks
+	binary.LittleEndian.PutUint16(buf[32:], 100)                   // utime
+	binary.LittleEndian.PutUint16(buf[34:], 50)                    // stime
+	binary.LittleEndian.PutUint16(buf[36:], 2048)                  // mem
+	binary.LittleEndian.PutUint16(buf[38:], 512)                   // io
+	copy(buf[48:48+COMMLEN], comm)
+	return buf
+}
+
+func TestAccountingFieldMapping(t *testing.T) {
+	if Ssize != 64 {
+		t.Fatalf("unexpected size of struct acct_v3: %d", Ssize)
+	}
+	acct := MakeAcct(sampleRecord("sleep", 1234, 2), 100)
+	if acct.Comm != "sleep" || acct.Pid != 1234 || acct.Etime != 2500*time.Millisecond || acct.Utime != time.Second {
+		t.Fatalf("unexpected record: %+v", acct)
+	}
+	props := acct.Properties()
+
+	// without a mapping, the messages keep their defaults
+	c := conf.AccountingSourceConfig{}
+	mapping, err := c.FieldMapping()
+	if err != nil || len(mapping) != 0 {
+		t.Fatalf("the default mapping should be empty: %v, %v", mapping, err)
+	}
+	msg := model.Factory()
+	msg.AppName = "accounting"
+	msg.Message = "{}"
+	acct.MapFields(msg, props, mapping)
+	if msg.AppName != "accounting" || msg.ProcId != "" || msg.Message != "{}" {
+		t.Errorf("the message fields should not be mapped: %+v", msg)
+	}
+
+	c.Fields = "appname=comm, procid=pid, message=summary, msgid=exitcode"
+	mapping, err = c.FieldMapping()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg = model.Factory()
+	msg.HostName = "host"
+	msg.AppName = "accounting"
+	acct.MapFields(msg, props, mapping)
+	if msg.AppName != "sleep" || msg.ProcId != "1234" || msg.MsgId != "2" || msg.HostName != "host" {
+		t.Errorf("unexpected message fields: %+v", msg)
+	}
+	expected := "sleep[1234] uid=" + acct.Uid + " gid=" + acct.Gid + " exitcode=2 elapsed=2.5s user=1s system=500ms memory=2048 io=512 flags=forked"
+	if msg.Message != expected {
+		t.Errorf("unexpected summary:\n%s\n%s", msg.Message, expected)
+	}
+
+	// the empty attributes don't override the defaults
+	acct = MakeAcct(sampleRecord("", 1, 0), 100)
+	msg = model.Factory()
+	msg.AppName = "accounting"
+	acct.MapFields(msg, acct.Properties(), mapping)
+	if msg.AppName != "accounting" {
+		t.Errorf("the empty command should not override the appname: '%s'", msg.AppName)
+	}
+	c.Fields = "message=json"
+	mapping, _ = c.FieldMapping()
+	acct.MapFields(msg, acct.Properties(), mapping)
+	if !strings.HasPrefix(msg.Message, "{") {
+		t.Errorf("the message should be the JSON record: %s", msg.Message)
+	}
+
+	for _, invalid := range []string{"appname", "nowhere=comm", "appname=nothing"} {
+		c.Fields = invalid
+		_, err = c.FieldMapping()
+		if err == nil {
+			t.Errorf("the mapping '%s' should be rejected", invalid)
+		}
+	}
+}
@@ -1,8 +1,75 @@
 package accounting
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/stephane-martin/skewer/model"
+)
 
 func (a *Acct) Marshal() string {
 	b, _ := json.Marshal(a)
 	return string(b)
 }
+
+// Summary describes the process and its resource usage on one line, such
+// as "sleep[1234] uid=root gid=root exitcode=0 elapsed=1s user=0s
+// system=1ms memory=1024 io=0". props are the properties of the record.
+func (a *Acct) Summary(props map[string]string) string {
+	var b strings.Builder
+	b.WriteString(a.Comm)
+	if pid := props["pid_pid"]; len(pid) > 0 {
+		b.WriteString("[" + pid + "]")
+	}
+	b.WriteString(" uid=" + a.Uid + " gid=" + a.Gid)
+	if code := props["exitcode"]; len(code) > 0 {
+		b.WriteString(" exitcode=" + code)
+	}
+	b.WriteString(" elapsed=" + a.Etime.String())
+	b.WriteString(" user=" + a.Utime.String())
+	b.WriteString(" system=" + a.Stime.String())
+	b.WriteString(" memory=" + props["memory_bytes"])
+	b.WriteString(" io=" + props["io_bytes"])
+	if flags := props["flags"]; len(flags) > 0 {
+		b.WriteString(" flags=" + flags)
+	}
+	return b.String()
+}
+
+// Attribute returns the value of an attribute of the record for the field
+// mapping of the accounting source. props are the properties of the record.
+func (a *Acct) Attribute(props map[string]string, name string) string {
+	switch name {
+	case "summary":
+		return a.Summary(props)
+	case "json":
+		return a.Marshal()
+	case "pid", "ppid":
+		return props[name+"_pid"]
+	default:
+		return props[name]
+	}
+}
+
+// MapFields fills the fields of msg with the attributes of the record, as
+// mapping says. The fields mapped to an empty attribute keep their value.
+func (a *Acct) MapFields(msg *model.SyslogMessage, props map[string]string, mapping map[string]string) {
+	for field, attr := range mapping {
+		value := a.Attribute(props, attr)
+		if len(value) == 0 {
+			continue
+		}
+		switch field {
+		case "hostname":
+			msg.HostName = value
+		case "appname":
+			msg.AppName = value
+		case "procid":
+			msg.ProcId = value
+		case "msgid":
+			msg.MsgId = value
+		case "message":
+			msg.Message = value
+		}
+	}
+}
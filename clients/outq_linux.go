@@ -0,0 +1,25 @@
+// +build linux
+
+package clients
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// unsentBytes returns the number of bytes written to the socket that the peer
+// has not acknowledged yet.
+func unsentBytes(conn syscall.Conn) (n int, err error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	cerr := raw.Control(func(fd uintptr) {
+		n, err = unix.IoctlGetInt(int(fd), unix.SIOCOUTQ)
+	})
+	if cerr != nil {
+		return 0, cerr
+	}
+	return n, err
+}
@@ -136,6 +136,7 @@ type RELPClient struct {
 	handleWg sync.WaitGroup
 
 	closed atomic.Bool
+	onSent func(size int)
 }
 
 func NewRELPClient(logger log15.Logger) *RELPClient {
@@ -198,6 +199,13 @@ func (c *RELPClient) TLS(config *tls.Config) *RELPClient {
 	return c
 }
 
+// OnSent registers a function that is called with the size of each encoded
+// syslog frame, after it was written.
+func (c *RELPClient) OnSent(f func(size int)) *RELPClient {
+	c.onSent = f
+	return c
+}
+
 func (c *RELPClient) Connect() (err error) {
 	if c.closed.Load() {
 		return ErrRELPClosed
@@ -372,7 +380,8 @@ func (c *RELPClient) scan() (txnr int32, retcode int, data []byte, err error) {
 	if !ret {
 		return 0, 0, nil, c.scanner.Err()
 	}
-	splits := bytes.SplitN(c.scanner.Bytes(), sp, 4)
+	// TXNR COMMAND[ DATA]
+	splits := bytes.SplitN(c.scanner.Bytes(), sp, 3)
 	txnr64, _ := strconv.ParseInt(string(splits[0]), 10, 64)
 	if txnr64 > int64(math.MaxInt32) {
 		return 0, 0, nil, RELPClientError(eerrors.Errorf("RELPClient: received txnr is not an int32: %d", txnr64))
@@ -381,12 +390,11 @@ func (c *RELPClient) scan() (txnr int32, retcode int, data []byte, err error) {
 		return 0, 0, nil, RELPClientError(eerrors.Errorf("RELP server answered with invalid command: '%s'", string(splits[1])))
 	}
 	txnr = int32(txnr64)
-	datalen, _ := strconv.Atoi(string(splits[2]))
-	if datalen == 0 {
+	if len(splits) < 3 {
 		data = []byte{}
 		return
 	}
-	data = bytes.Trim(splits[3], " \r\n")
+	data = splits[2]
 	if len(data) >= 3 {
 		code := string(data[:3])
 		if code == "200" {
@@ -478,6 +486,9 @@ func (c *RELPClient) doSendOne(msg *model.FullMessage) (err error) {
 	if err != nil {
 		return err
 	}
+	if c.onSent != nil {
+		c.onSent(len(buf))
+	}
 	// everything alright, we register the Uid to wait for the server response
 	return c.txnr2msgid.Put(txnr, msg.Uid)
 }
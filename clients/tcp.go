@@ -6,6 +6,7 @@ import (
 	"io"
 	"net"
 	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/free/concurrent-writer/concurrent"
@@ -44,6 +45,8 @@ type SyslogTCPClient struct {
 
 	errorFlag atomic.Bool
 	errorPrev error
+
+	onSent func(size int)
 }
 
 func NewSyslogTCPClient(logger log15.Logger) *SyslogTCPClient {
@@ -106,6 +109,13 @@ func (c *SyslogTCPClient) TLS(config *tls.Config) *SyslogTCPClient {
 	return c
 }
 
+// OnSent registers a function that is called with the size of each encoded
+// message, after it was written.
+func (c *SyslogTCPClient) OnSent(f func(size int)) *SyslogTCPClient {
+	c.onSent = f
+	return c
+}
+
 func (c *SyslogTCPClient) Close() (err error) {
 	if c.closed.CAS(false, true) {
 		if c.ticker != nil {
@@ -246,6 +256,9 @@ func (c *SyslogTCPClient) Send(ctx context.Context, msg *model.FullMessage) (err
 	} else {
 		_, err = io.WriteString(c.conn, buf)
 	}
+	if err == nil && c.onSent != nil {
+		c.onSent(len(buf))
+	}
 	return err
 }
 
@@ -256,6 +269,37 @@ func (c *SyslogTCPClient) Flush() error {
 	return nil
 }
 
+// WaitSent flushes the buffers, and then waits until the peer has
+// acknowledged all the written bytes at the TCP level, or until ctx is done.
+// Over TLS, or outside Linux, it only flushes the buffers.
+func (c *SyslogTCPClient) WaitSent(ctx context.Context) error {
+	if c.conn == nil {
+		return ErrTCPNotConnected
+	}
+	err := c.Flush()
+	if err != nil {
+		return err
+	}
+	conn, ok := c.conn.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	for {
+		n, err := unsentBytes(conn)
+		if err != nil {
+			return eerrors.Wrap(err, "TCPClient: error reading the socket output queue")
+		}
+		if n == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return eerrors.Wrap(ctx.Err(), "TCPClient: the peer did not acknowledge the sent messages")
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
 func (c *SyslogTCPClient) Ack() *queue.AckQueue {
 	return nil
 }
@@ -25,6 +25,7 @@ type SyslogUDPClient struct {
 	logger  log15.Logger
 
 	closed atomic.Bool
+	onSent func(size int)
 }
 
 func NewSyslogUDPClient(logger log15.Logger) *SyslogUDPClient {
@@ -51,6 +52,13 @@ func (c *SyslogUDPClient) Format(format baseenc.Format) *SyslogUDPClient {
 	return c
 }
 
+// OnSent registers a function that is called with the size of each encoded
+// message, after it was written.
+func (c *SyslogUDPClient) OnSent(f func(size int)) *SyslogUDPClient {
+	c.onSent = f
+	return c
+}
+
 func (c *SyslogUDPClient) Close() (err error) {
 	if c.closed.CAS(false, true) {
 		if c.conn != nil {
@@ -137,5 +145,8 @@ func (c *SyslogUDPClient) Send(msg *model.FullMessage) (err error) {
 		return nil
 	}
 	_, err = io.WriteString(c.conn, buf)
+	if err == nil && c.onSent != nil {
+		c.onSent(len(buf))
+	}
 	return err
 }
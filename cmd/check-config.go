@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	neturl "net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/spf13/cobra"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/consul"
+	"github.com/stephane-martin/skewer/javascript"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+var checkConnectivity bool
+var connectivityTimeout time.Duration
+
+var checkConfigCmd = &cobra.Command{
+	Use:   "check-config",
+	Short: "Validate skewer configuration",
+	Long: `check-config loads the skewer configuration, compiles the
+Javascript parsers and filtering functions, and optionally checks that the
+configured destinations can be reached. All the errors are reported at once,
+and the command exits with a non-zero code if any error was found.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		params := consul.ConnParams{
+			Address:    consulAddr,
+			Datacenter: consulDC,
+			Token:      consulToken,
+			CAFile:     consulCAFile,
+			CAPath:     consulCAPath,
+			CertFile:   consulCertFile,
+			KeyFile:    consulKeyFile,
+			Insecure:   consulInsecure,
+			Key:        consulPrefix,
+		}
+
+		logger := log15.New()
+		logger.SetHandler(log15.DiscardHandler())
+		c, _, err := conf.InitLoad(context.Background(), configDirName, params, nil, logger)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid configuration: %s\n", err)
+			os.Exit(1)
+		}
+
+		errs := checkJavascript(&c)
+		if checkConnectivity {
+			errs = append(errs, checkDestinations(&c, connectivityTimeout))
+		}
+		err = eerrors.Combine(errs...)
+		if err != nil {
+			errs = err.(eerrors.ErrorSlice)
+			for _, err := range errs {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			fmt.Fprintf(os.Stderr, "%d error(s) found\n", len(errs))
+			os.Exit(1)
+		}
+		fmt.Println("Configuration is valid")
+	},
+}
+
+func checkJavascript(c *conf.BaseConfig) (errs []error) {
+	env := javascript.NewParsersEnvironment(log15.New())
+	for _, parserConf := range c.Parsers {
+		if len(parserConf.Regex) > 0 {
+			// the regex parsers have no JS function
+			re, err := parserConf.CompileRegex()
+			if err == nil {
+				_, err = parserConf.RegexFields(re)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("parser '%s': %s", parserConf.Name, err))
+			}
+			continue
+		}
+		err := env.AddParser(parserConf.Name, parserConf.Func)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("parser '%s': %s", parserConf.Name, err))
+		}
+	}
+
+	filters := map[string]*conf.FilterSubConfig{
+		"journald":   &c.Journald.FilterSubConfig,
+		"accounting": &c.Accounting.FilterSubConfig,
+		"macos":      &c.MacOS.FilterSubConfig,
+		"synthetic":  &c.Synthetic.FilterSubConfig,
+		"heartbeat":  &c.Heartbeat.FilterSubConfig,
+	}
+	for i := range c.FSSource {
+		filters["file_source "+strconv.Itoa(i)] = c.FSSource[i].FilterConf()
+	}
+	for i := range c.FIFOSource {
+		filters["fifo_source "+strconv.Itoa(i)] = c.FIFOSource[i].FilterConf()
+	}
+	for i := range c.IngestSource {
+		filters["ingest_source "+strconv.Itoa(i)] = c.IngestSource[i].FilterConf()
+	}
+	for i := range c.TCPSource {
+		filters["tcp_source "+strconv.Itoa(i)] = c.TCPSource[i].FilterConf()
+	}
+	for i := range c.UDPSource {
+		filters["udp_source "+strconv.Itoa(i)] = c.UDPSource[i].FilterConf()
+	}
+	for i := range c.RELPSource {
+		filters["relp_source "+strconv.Itoa(i)] = c.RELPSource[i].FilterConf()
+	}
+	for i := range c.DirectRELPSource {
+		filters["directrelp_source "+strconv.Itoa(i)] = c.DirectRELPSource[i].FilterConf()
+	}
+	for i := range c.GraylogSource {
+		filters["graylog_source "+strconv.Itoa(i)] = c.GraylogSource[i].FilterConf()
+	}
+	for i := range c.KafkaSource {
+		filters["kafka_source "+strconv.Itoa(i)] = c.KafkaSource[i].FilterConf()
+	}
+	for i := range c.HTTPServerSource {
+		filters["httpserver_source "+strconv.Itoa(i)] = c.HTTPServerSource[i].FilterConf()
+	}
+
+	names := make([]string, 0, len(filters))
+	for name := range filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := filters[name]
+		for _, err := range javascript.CheckFilterFuncs(f.FilterFunc, f.TopicFunc, f.PartitionFunc, f.PartitionNumberFunc) {
+			errs = append(errs, fmt.Errorf("%s: %s", name, err))
+		}
+		for _, err := range javascript.CheckTemplates(f.TopicTmpl, f.PartitionTmpl) {
+			errs = append(errs, fmt.Errorf("%s: %s", name, err))
+		}
+	}
+	return errs
+}
+
+func checkDestinations(c *conf.BaseConfig, timeout time.Duration) error {
+	dests, err := c.Main.GetDestinations()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	dial := func(dest string, network string, addr string) {
+		conn, err := net.DialTimeout(network, addr, timeout)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("destination %s: can't connect to %s: %s", dest, addr, err))
+			return
+		}
+		_ = conn.Close()
+	}
+	dialHostPort := func(dest string, c conf.TcpUdpRelpDestBaseConfig) {
+		if len(c.UnixSocketPath) > 0 {
+			dial(dest, "unix", c.UnixSocketPath)
+			return
+		}
+		dial(dest, "tcp", net.JoinHostPort(c.Host, strconv.Itoa(c.Port)))
+	}
+	dialURL := func(dest string, u string) {
+		addr, err := urlAddr(u)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("destination %s: invalid URL '%s': %s", dest, u, err))
+			return
+		}
+		dial(dest, "tcp", addr)
+	}
+
+	for _, dest := range dests.Iterate() {
+		name := conf.DestinationNames[dest]
+		switch dest {
+		case conf.Kafka:
+			if c.KafkaDest != nil {
+				for _, broker := range c.KafkaDest.Brokers {
+					dial(name, "tcp", broker)
+				}
+			}
+		case conf.TCP:
+			dialHostPort(name, c.TCPDest.TcpUdpRelpDestBaseConfig)
+		case conf.RELP:
+			dialHostPort(name, c.RELPDest.TcpUdpRelpDestBaseConfig)
+		case conf.Graylog:
+			if strings.ToLower(c.GraylogDest.Mode) == "tcp" {
+				dial(name, "tcp", net.JoinHostPort(c.GraylogDest.Host, strconv.Itoa(c.GraylogDest.Port)))
+			}
+		case conf.HTTP:
+			dialURL(name, c.HTTPDest.URL)
+		case conf.Elasticsearch:
+			for _, u := range c.ElasticDest.URLs {
+				dialURL(name, u)
+			}
+		case conf.NATS:
+			if c.NATSDest != nil {
+				for _, u := range c.NATSDest.NServers {
+					dialURL(name, u)
+				}
+			}
+		case conf.Redis:
+			dial(name, "tcp", net.JoinHostPort(c.RedisDest.Host, strconv.Itoa(c.RedisDest.Port)))
+		case conf.Journal:
+			dial(name, "unixgram", c.JournalDest.SocketPath)
+		default:
+			// UDP, files, stderr and the embedded servers do not need connectivity
+		}
+	}
+	return eerrors.Combine(errs...)
+}
+
+// urlAddr returns the host:port part of the given URL.
+func urlAddr(u string) (string, error) {
+	parsed, err := neturl.Parse(u)
+	if err != nil {
+		return "", err
+	}
+	if len(parsed.Host) == 0 {
+		return "", fmt.Errorf("no host")
+	}
+	if len(parsed.Port()) > 0 {
+		return parsed.Host, nil
+	}
+	switch parsed.Scheme {
+	case "https", "tls":
+		return net.JoinHostPort(parsed.Hostname(), "443"), nil
+	case "nats":
+		return net.JoinHostPort(parsed.Hostname(), "4222"), nil
+	default:
+		return net.JoinHostPort(parsed.Hostname(), "80"), nil
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(checkConfigCmd)
+	checkConfigCmd.Flags().BoolVar(&checkConnectivity, "check-connectivity", false, "try to connect to the configured destinations")
+	checkConfigCmd.Flags().DurationVar(&connectivityTimeout, "timeout", 5*time.Second, "connection timeout when checking connectivity")
+}
@@ -6,6 +6,7 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
 	"time"
@@ -18,6 +19,7 @@ import (
 	"github.com/stephane-martin/skewer/consul"
 	"github.com/stephane-martin/skewer/journald"
 	"github.com/stephane-martin/skewer/metrics"
+	"github.com/stephane-martin/skewer/model"
 	"github.com/stephane-martin/skewer/services"
 	"github.com/stephane-martin/skewer/services/base"
 	"github.com/stephane-martin/skewer/services/macos"
@@ -26,6 +28,7 @@ import (
 	"github.com/stephane-martin/skewer/utils"
 	"github.com/stephane-martin/skewer/utils/eerrors"
 	"github.com/stephane-martin/skewer/utils/logging"
+	"github.com/stephane-martin/skewer/utils/recenterrors"
 )
 
 var serveCobraCmd = &cobra.Command{
@@ -41,12 +44,19 @@ var SyslogFlag bool
 var LoglevelFlag string
 var LogfilenameFlag string
 var LogjsonFlag bool
+var LogformatFlag string
 var pidFilenameFlag string
 var consulRegisterFlag bool
 var consulServiceName string
+var consulTags []string
+var consulMeta []string
+var consulCheck string
+var consulCheckTTL time.Duration
 var UidFlag string
 var GidFlag string
 var DumpableFlag bool
+var VerifyPrivDropFlag bool
+var TestingSyntheticFlag bool
 var profile bool
 
 func init() {
@@ -54,14 +64,30 @@ func init() {
 	serveCobraCmd.Flags().BoolVar(&SyslogFlag, "syslog", false, "Send logs to the local syslog (are you sure you wan't to do that ?)")
 	serveCobraCmd.Flags().StringVar(&LoglevelFlag, "loglevel", "info", "Set logging level")
 	serveCobraCmd.Flags().StringVar(&LogfilenameFlag, "logfilename", "", "Write logs to a file instead of stderr")
-	serveCobraCmd.Flags().BoolVar(&LogjsonFlag, "logjson", false, "Write logs in JSON format")
+	serveCobraCmd.Flags().BoolVar(&LogjsonFlag, "logjson", false, "Write logs in JSON format (same as --logformat=json)")
+	serveCobraCmd.Flags().StringVar(&LogformatFlag, "logformat", "logfmt", "Format of the logs: logfmt or json")
 	serveCobraCmd.Flags().StringVar(&pidFilenameFlag, "pidfile", "", "If given, write PID to file")
 	serveCobraCmd.Flags().BoolVar(&consulRegisterFlag, "register", false, "Register services in consul")
 	serveCobraCmd.Flags().StringVar(&consulServiceName, "servicename", "skewer", "Service name to register in consul")
+	serveCobraCmd.Flags().StringSliceVar(&consulTags, "consul-tags", nil, "Additional tags for the services registered in consul (ex: env=prod,dc1)")
+	serveCobraCmd.Flags().StringSliceVar(&consulMeta, "consul-meta", nil, "Metadata for the services registered in consul, as key=value pairs")
+	serveCobraCmd.Flags().StringVar(&consulCheck, "consul-check", "tcp", "Health check of the services registered in consul: tcp, ttl or none")
+	serveCobraCmd.Flags().DurationVar(&consulCheckTTL, "consul-check-ttl", 30*time.Second, "TTL of the consul health check, when --consul-check=ttl")
 	serveCobraCmd.Flags().StringVar(&UidFlag, "uid", "", "Switch to this user ID (when launched as root)")
 	serveCobraCmd.Flags().StringVar(&GidFlag, "gid", "", "Switch to this group ID (when launched as root)")
-	serveCobraCmd.Flags().BoolVar(&DumpableFlag, "dumpable", false, "if set, the skewer process will be traceable/dumpable")
+	serveCobraCmd.Flags().BoolVar(&DumpableFlag, "dumpable", false, "if set, the skewer process will be traceable/dumpable (the plugins are configured by main.dumpable_plugins)")
 	serveCobraCmd.Flags().BoolVar(&profile, "prof", false, "if set, profile memory")
+	serveCobraCmd.Flags().BoolVar(&VerifyPrivDropFlag, "verify-privdrop", true, "if set, refuse to serve when the privilege drop could not be verified")
+	serveCobraCmd.Flags().BoolVar(&TestingSyntheticFlag, "testing-synthetic-source", false, "FOR LOAD TESTING ONLY: enable the synthetic message generator source")
+}
+
+// LogFormat returns the format of the internal logs, as chosen by --logformat
+// or --logjson.
+func LogFormat() string {
+	if LogjsonFlag {
+		return "json"
+	}
+	return LogformatFlag
 }
 
 // ExecuteChild sets up the environment for the serve command and starts it.
@@ -263,7 +289,20 @@ func (ch *serveChild) setupConsulRegistry() error {
 	}
 	var err error
 	if consulRegisterFlag {
-		ch.consulRegistry, err = consul.NewRegistry(ch.globalCtx, ch.consulParams, consulServiceName, ch.logger)
+		regParams := consul.RegistrationParams{
+			Tags:  consulTags,
+			Meta:  make(map[string]string, len(consulMeta)),
+			Check: consulCheck,
+			TTL:   consulCheckTTL,
+		}
+		for _, kv := range consulMeta {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) != 2 || len(strings.TrimSpace(parts[0])) == 0 {
+				return eerrors.Errorf("Invalid consul metadata, expected key=value: '%s'", kv)
+			}
+			regParams.Meta[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+		ch.consulRegistry, err = consul.NewRegistry(ch.globalCtx, ch.consulParams, consulServiceName, regParams, ch.logger)
 		if err != nil {
 			return eerrors.Wrap(err, "Error building consul registry")
 		}
@@ -281,14 +320,20 @@ func (ch *serveChild) setupStore() (st *services.StoreController, err error) {
 	if (dests & conf.File) != 0 {
 		tmpl = ch.conf.FileDest.Filename
 	}
+	journalSocket := ""
+	if (dests & conf.Journal) != 0 {
+		journalSocket = ch.conf.JournalDest.SocketPath
+	}
 
 	certfiles := ch.conf.GetCertificateFiles()["dests"]
 	certpaths := ch.conf.GetCertificatePaths()["dests"]
 
 	err = st.Create(
 		services.DumpableOpt(DumpableFlag),
+		services.DumpablePluginsOpt(ch.conf.Main.DumpablePlugins),
 		services.StorePathOpt(storeDirname),
 		services.FileDestTmplOpt(tmpl),
+		services.JournalSocketOpt(journalSocket),
 		services.CertFilesOpt(certfiles),
 		services.CertPathsOpt(certpaths),
 		services.ProfileOpt(profile),
@@ -371,10 +416,18 @@ func (ch *serveChild) StartController(typ base.Types) error {
 		return ch.StartAccounting()
 	case base.MacOS:
 		return ch.StartMacOS()
+	case base.Synthetic:
+		return ch.StartSynthetic()
 	case base.KafkaSource:
 		return ch.StartKafkaSource()
 	case base.Filesystem:
 		return ch.StartFSPoll()
+	case base.FIFO:
+		return ch.StartFIFO()
+	case base.Heartbeat:
+		return ch.StartHeartbeat()
+	case base.Ingest:
+		return ch.StartIngest()
 	case base.HTTPServer:
 		return ch.StartHTTPServer()
 	default:
@@ -392,6 +445,7 @@ func (ch *serveChild) StartHTTPServer() error {
 	ctl := ch.controllers[base.HTTPServer]
 	err := ctl.Create(
 		services.DumpableOpt(DumpableFlag),
+		services.DumpablePluginsOpt(ch.conf.Main.DumpablePlugins),
 		services.CertFilesOpt(certfiles),
 		services.CertPathsOpt(certpaths),
 	)
@@ -422,6 +476,7 @@ func (ch *serveChild) StartFSPoll() error {
 		ch.logger.Info("FS polling is enabled")
 		err := ch.controllers[base.Filesystem].Create(
 			services.DumpableOpt(DumpableFlag),
+			services.DumpablePluginsOpt(ch.conf.Main.DumpablePlugins),
 			services.PollDirectories(dirs),
 		)
 		if err != nil {
@@ -445,6 +500,7 @@ func (ch *serveChild) StartKafkaSource() error {
 
 		err := ch.controllers[base.KafkaSource].Create(
 			services.DumpableOpt(DumpableFlag),
+			services.DumpablePluginsOpt(ch.conf.Main.DumpablePlugins),
 			services.CertFilesOpt(certfiles),
 			services.CertPathsOpt(certpaths),
 		)
@@ -467,6 +523,7 @@ func (ch *serveChild) StartAccounting() error {
 		ch.logger.Info("Process accounting is enabled")
 		err := ch.controllers[base.Accounting].Create(
 			services.DumpableOpt(DumpableFlag),
+			services.DumpablePluginsOpt(ch.conf.Main.DumpablePlugins),
 			services.AccountingPathOpt(ch.conf.Accounting.Path),
 		)
 		if err != nil {
@@ -488,6 +545,7 @@ func (ch *serveChild) StartMacOS() error {
 		ch.logger.Info("macos logs source is enabled")
 		err := ch.controllers[base.MacOS].Create(
 			services.DumpableOpt(DumpableFlag),
+			services.DumpablePluginsOpt(ch.conf.Main.DumpablePlugins),
 		)
 		if err != nil {
 			return eerrors.Wrap(err, "Error creating macos controller")
@@ -502,6 +560,117 @@ func (ch *serveChild) StartMacOS() error {
 	return nil
 }
 
+// StartFIFO starts the named pipes reader process.
+func (ch *serveChild) StartFIFO() error {
+	if len(ch.conf.FIFOSource) == 0 {
+		return nil
+	}
+	// in confined mode, the directories that contain the FIFOs are bind mounted
+	dirs := make([]string, 0, len(ch.conf.FIFOSource))
+	for _, source := range ch.conf.FIFOSource {
+		dirs = append(dirs, filepath.Dir(source.Path))
+	}
+	err := ch.controllers[base.FIFO].Create(
+		services.DumpableOpt(DumpableFlag),
+		services.DumpablePluginsOpt(ch.conf.Main.DumpablePlugins),
+		services.PollDirectories(dirs),
+	)
+	if err != nil {
+		return eerrors.Wrap(err, "Error creating FIFO controller")
+	}
+	ch.controllers[base.FIFO].SetConf(*ch.conf)
+	_, err = ch.controllers[base.FIFO].Start()
+	if err != nil {
+		return eerrors.Wrap(err, "Error starting FIFO controller")
+	}
+	ch.logger.Debug("FIFO plugin has been started")
+	return nil
+}
+
+// StartIngest starts the archived files ingestion process.
+func (ch *serveChild) StartIngest() error {
+	if len(ch.conf.IngestSource) == 0 {
+		return nil
+	}
+	// in confined mode, the directories to ingest are bind mounted read-only,
+	// and the state directories read-write
+	dirs := make([]string, 0, len(ch.conf.IngestSource))
+	stateDirs := make([]string, 0, len(ch.conf.IngestSource))
+	for _, source := range ch.conf.IngestSource {
+		dirs = append(dirs, source.Directory)
+		stateDirs = append(stateDirs, source.StateDirectory)
+	}
+	ch.logger.Info("Files ingestion is enabled")
+	err := ch.controllers[base.Ingest].Create(
+		services.DumpableOpt(DumpableFlag),
+		services.DumpablePluginsOpt(ch.conf.Main.DumpablePlugins),
+		services.PollDirectories(dirs),
+		services.StateDirectories(stateDirs),
+	)
+	if err != nil {
+		return eerrors.Wrap(err, "Error creating ingest controller")
+	}
+	ch.controllers[base.Ingest].SetConf(*ch.conf)
+	_, err = ch.controllers[base.Ingest].Start()
+	if err != nil {
+		return eerrors.Wrap(err, "Error starting ingest controller")
+	}
+	ch.logger.Debug("Ingest plugin has been started")
+	return nil
+}
+
+// StartHeartbeat starts the heartbeat source.
+func (ch *serveChild) StartHeartbeat() error {
+	if !ch.conf.Heartbeat.Enabled {
+		return nil
+	}
+	if len(ch.conf.Heartbeat.Hostname) == 0 {
+		// the plugin runs in its own UTS namespace, so it can't know the
+		// real hostname by itself
+		ch.conf.Heartbeat.Hostname, _ = os.Hostname()
+	}
+	err := ch.controllers[base.Heartbeat].Create(
+		services.DumpableOpt(DumpableFlag),
+		services.DumpablePluginsOpt(ch.conf.Main.DumpablePlugins),
+	)
+	if err != nil {
+		return eerrors.Wrap(err, "Error creating heartbeat controller")
+	}
+	ch.controllers[base.Heartbeat].SetConf(*ch.conf)
+	_, err = ch.controllers[base.Heartbeat].Start()
+	if err != nil {
+		return eerrors.Wrap(err, "Error starting heartbeat controller")
+	}
+	ch.logger.Debug("Heartbeat plugin has been started")
+	return nil
+}
+
+// StartSynthetic starts the synthetic messages generator (load testing only).
+func (ch *serveChild) StartSynthetic() error {
+	if !ch.conf.Synthetic.Enabled {
+		return nil
+	}
+	if !TestingSyntheticFlag {
+		ch.logger.Warn("The synthetic source is configured but --testing-synthetic-source was not set: ignoring it")
+		return nil
+	}
+	ch.logger.Warn("The synthetic source is enabled: generated messages will be sent to the destinations")
+	err := ch.controllers[base.Synthetic].Create(
+		services.DumpableOpt(DumpableFlag),
+		services.DumpablePluginsOpt(ch.conf.Main.DumpablePlugins),
+	)
+	if err != nil {
+		return eerrors.Wrap(err, "Error creating synthetic controller")
+	}
+	ch.controllers[base.Synthetic].SetConf(*ch.conf)
+	_, err = ch.controllers[base.Synthetic].Start()
+	if err != nil {
+		return eerrors.Wrap(err, "Error starting synthetic controller")
+	}
+	ch.logger.Debug("Synthetic plugin has been started")
+	return nil
+}
+
 // StartJournal starts the journald process.
 func (ch *serveChild) StartJournal() error {
 	if journald.Supported {
@@ -512,6 +681,7 @@ func (ch *serveChild) StartJournal() error {
 			// in fact Create() will only do something the first time startJournal() is called
 			err := ctl.Create(
 				services.DumpableOpt(DumpableFlag),
+				services.DumpablePluginsOpt(ch.conf.Main.DumpablePlugins),
 			)
 			if err != nil {
 				return eerrors.Wrap(err, "Error creating journald controller")
@@ -542,6 +712,7 @@ func (ch *serveChild) StartRelp() error {
 	ctl := ch.controllers[base.RELP]
 	err := ctl.Create(
 		services.DumpableOpt(DumpableFlag),
+		services.DumpablePluginsOpt(ch.conf.Main.DumpablePlugins),
 		services.CertFilesOpt(certfiles),
 		services.CertPathsOpt(certpaths),
 	)
@@ -569,6 +740,7 @@ func (ch *serveChild) StartDirectRelp() error {
 	ctl := ch.controllers[base.DirectRELP]
 	err := ctl.Create(
 		services.DumpableOpt(DumpableFlag),
+		services.DumpablePluginsOpt(ch.conf.Main.DumpablePlugins),
 		services.CertFilesOpt(certfiles),
 		services.CertPathsOpt(certpaths),
 	)
@@ -596,6 +768,7 @@ func (ch *serveChild) StartTcp() error {
 	ctl := ch.controllers[base.TCP]
 	err := ctl.Create(
 		services.DumpableOpt(DumpableFlag),
+		services.DumpablePluginsOpt(ch.conf.Main.DumpablePlugins),
 		services.CertFilesOpt(certfiles),
 		services.CertPathsOpt(certpaths),
 	)
@@ -625,6 +798,7 @@ func (ch *serveChild) StartUdp() error {
 	ctl := ch.controllers[base.UDP]
 	err := ctl.Create(
 		services.DumpableOpt(DumpableFlag),
+		services.DumpablePluginsOpt(ch.conf.Main.DumpablePlugins),
 	)
 
 	if err != nil {
@@ -652,6 +826,7 @@ func (ch *serveChild) StartGraylog() error {
 	ctl := ch.controllers[base.Graylog]
 	err := ctl.Create(
 		services.DumpableOpt(DumpableFlag),
+		services.DumpablePluginsOpt(ch.conf.Main.DumpablePlugins),
 	)
 
 	if err != nil {
@@ -737,7 +912,8 @@ func (ch *serveChild) Reload() (err error) {
 
 func (ch *serveChild) setupMetrics(logger log15.Logger) {
 	ch.metricsServer = &metrics.MetricsServer{}
-	controllers := make([]prometheus.Gatherer, 0, len(base.Types2Names))
+	controllers := make([]prometheus.Gatherer, 0, len(base.Types2Names)+1)
+	controllers = append(controllers, services.ControllerRegistry)
 	for t := range base.Types2Names {
 		typ := t
 		switch typ {
@@ -748,7 +924,138 @@ func (ch *serveChild) setupMetrics(logger log15.Logger) {
 			controllers = append(controllers, ch.controllers[typ])
 		}
 	}
-	ch.metricsServer.NewConf(ch.conf.Metrics, logger, controllers...)
+	ch.metricsServer.NewConf(ch.conf.Metrics, logger, ch.Listeners, ch.RecentErrors, ch.Profile, ch.Transactions, ch.Pause, ch.Seek, ch.Drain, controllers...)
+}
+
+// Profile collects a profile from the named plugin, through its controller.
+func (ch *serveChild) Profile(plugin, kind string, seconds int) ([]byte, error) {
+	if !strings.HasPrefix(plugin, "skewer-") {
+		plugin = "skewer-" + plugin
+	}
+	typ, _, err := base.Type(plugin)
+	if err != nil {
+		return nil, eerrors.Errorf("Unknown plugin: '%s'", plugin)
+	}
+	req := base.ProfileRequest{Kind: kind, Seconds: seconds}
+	if typ == base.Store && ch.store != nil {
+		return ch.store.Profile(req)
+	}
+	ctl := ch.controllers[typ]
+	if ctl == nil {
+		return nil, eerrors.Errorf("Plugin '%s' is not running", plugin)
+	}
+	return ctl.Profile(req)
+}
+
+// Pause pauses, or resumes, a listener of the named plugin.
+func (ch *serveChild) Pause(plugin, listener string, pause bool) error {
+	ctl, err := ch.pluginController(plugin)
+	if err != nil {
+		return err
+	}
+	if pause {
+		return ctl.Pause(listener)
+	}
+	return ctl.Resume(listener)
+}
+
+// Drain makes the RELP clients of a listener of the named plugin reconnect.
+func (ch *serveChild) Drain(plugin, listener string) error {
+	ctl, err := ch.pluginController(plugin)
+	if err != nil {
+		return err
+	}
+	return ctl.Drain(listener)
+}
+
+// Seek moves the consumers of the Kafka source.
+func (ch *serveChild) Seek(req base.SeekRequest) error {
+	ctl := ch.controllers[base.KafkaSource]
+	if ctl == nil {
+		return eerrors.New("The Kafka source is not running")
+	}
+	return ctl.Seek(req)
+}
+
+// pluginController returns the controller of a running plugin, given by its
+// name, with or without the "skewer-" prefix.
+func (ch *serveChild) pluginController(plugin string) (*services.Controller, error) {
+	if !strings.HasPrefix(plugin, "skewer-") {
+		plugin = "skewer-" + plugin
+	}
+	typ, _, err := base.Type(plugin)
+	if err != nil {
+		return nil, eerrors.Errorf("Unknown plugin: '%s'", plugin)
+	}
+	ctl := ch.controllers[typ]
+	if ctl == nil {
+		return nil, eerrors.Errorf("Plugin '%s' is not running", plugin)
+	}
+	return ctl, nil
+}
+
+// RecentErrors returns the recent errors of the parent process and of the
+// plugins.
+func (ch *serveChild) RecentErrors() recenterrors.Snapshot {
+	snapshots := make([]recenterrors.Snapshot, 0, len(ch.controllers)+2)
+	snapshots = append(snapshots, recenterrors.Default.Snapshot())
+	if ch.store != nil {
+		snapshots = append(snapshots, ch.store.RecentErrors())
+	}
+	for _, ctl := range ch.controllers {
+		if ctl != nil {
+			snapshots = append(snapshots, ctl.RecentErrors())
+		}
+	}
+	return recenterrors.Merge(recenterrors.DefaultSize, snapshots...)
+}
+
+// Transactions returns the transactions in progress of the RELP connections,
+// by service name.
+func (ch *serveChild) Transactions() map[string][]base.RelpTransactions {
+	res := make(map[string][]base.RelpTransactions, 2)
+	for _, typ := range []base.Types{base.RELP, base.DirectRELP} {
+		ctl := ch.controllers[typ]
+		if ctl == nil {
+			continue
+		}
+		res[base.Types2Names[typ]] = ctl.Transactions()
+	}
+	return res
+}
+
+// Listeners returns the listeners currently reported by the plugins.
+func (ch *serveChild) Listeners() map[string][]model.ListenerInfo {
+	res := make(map[string][]model.ListenerInfo, len(ch.controllers))
+	for typ, ctl := range ch.controllers {
+		if ctl == nil {
+			continue
+		}
+		infos := ctl.Infos()
+		if len(infos) > 0 {
+			res[base.Types2Names[typ]] = infos
+		}
+	}
+	return res
+}
+
+// logChanges logs a summary of what a new configuration changes.
+func (ch *serveChild) logChanges(changes conf.Changes) {
+	if changes.Empty() {
+		ch.logger.Info("New configuration: no change of listeners, parsers or destinations")
+		return
+	}
+	ch.logger.Info(
+		"New configuration",
+		"added_listeners", changes.AddedListeners,
+		"removed_listeners", changes.RemovedListeners,
+		"added_parsers", changes.AddedParsers,
+		"removed_parsers", changes.RemovedParsers,
+		"changed_parsers", changes.ChangedParsers,
+		"added_destinations", changes.AddedDestinations,
+		"removed_destinations", changes.RemovedDestinations,
+		"changed_destinations", changes.ChangedDestinations,
+	)
 }
 
 // Serve starts the controllers and reacts to signals and events.
@@ -759,7 +1066,7 @@ func (ch *serveChild) Serve() error {
 	}
 
 	sigChan := make(chan os.Signal, 10)
-	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP, syscall.SIGUSR2)
 
 	errs := ch.StartControllers()
 	if !errs.Empty() {
@@ -779,9 +1086,25 @@ func (ch *serveChild) Serve() error {
 	}()
 
 	go func() {
-		<-ch.store.ShutdownChan
-		c.Append(errors.New("Store has shutdown: aborting all operations"))
-		ch.shutdown()
+		for {
+			<-ch.store.ShutdownChan
+			select {
+			case <-ch.shutdownCtx.Done():
+				return
+			default:
+			}
+			if ch.conf.Store.OnChildExit == conf.StoreExitShutdown {
+				c.Append(errors.New("Store has shutdown: aborting all operations"))
+				ch.shutdown()
+				return
+			}
+			ch.logger.Error("Store has shutdown: restarting it", "code", ch.store.ExitCode, "on_child_exit", ch.conf.Store.OnChildExit)
+			recenterrors.Add("store", recenterrors.Fatal, errors.New("Store has shutdown"))
+			if ch.store.Restart(ch.shutdownCtx) != nil {
+				return
+			}
+			ch.logger.Info("Store has been restarted")
+		}
 	}()
 
 	for {
@@ -804,6 +1127,7 @@ func (ch *serveChild) Serve() error {
 				// some parameters can't be modified online
 				newConf.Store = ch.conf.Store
 				newConf.Main.EncryptIPC = ch.conf.Main.EncryptIPC
+				ch.logChanges(newConf.Changes(ch.conf))
 				ch.conf = newConf
 				err := ch.Reload()
 				if err != nil {
@@ -819,22 +1143,25 @@ func (ch *serveChild) Serve() error {
 			switch sig {
 			case syscall.SIGHUP:
 				signal.Stop(sigChan)
-				signal.Ignore(syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT)
+				signal.Ignore(syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT, syscall.SIGUSR2)
 				select {
 				case <-ch.shutdownCtx.Done():
 				default:
 					ch.logger.Info("SIGHUP received: reloading configuration")
 					err := ch.confService.Reload()
 					sigChan = make(chan os.Signal, 10)
-					signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+					signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP, syscall.SIGUSR2)
 					if err != nil {
 						c.Append(eerrors.Wrap(err, "Error reloading configuration service"))
 						ch.shutdown()
 					}
 				}
+			case syscall.SIGUSR2:
+				ch.logger.Info("SIGUSR2 received: reloading GeoIP databases")
+				ch.store.ReloadGeoIP()
 			case syscall.SIGTERM, syscall.SIGINT:
 				signal.Stop(sigChan)
-				signal.Ignore(syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT)
+				signal.Ignore(syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT, syscall.SIGUSR2)
 				sigChan = nil
 				ch.logger.Info("Termination signal received", "signal", sig)
 				ch.shutdown()
@@ -56,7 +56,7 @@ var testjsCmd = &cobra.Command{
 		fmt.Println(errs)
 		fmt.Println(topic)
 
-		pnumber, errs := env.PartitionNumber(m)
+		pnumber, errs := env.PartitionNumber(m, 0)
 		fmt.Println(errs)
 		fmt.Println(pnumber)
 
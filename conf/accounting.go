@@ -0,0 +1,67 @@
+package conf
+
+import (
+	"strings"
+
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// AccountingFields are the message fields that the accounting records can
+// fill.
+var AccountingFields = []string{
+	"hostname",
+	"appname",
+	"procid",
+	"msgid",
+	"message",
+}
+
+// AccountingAttributes are the attributes of the accounting records that
+// can be mapped to the message fields. summary is a one line description of
+// the process and its resource usage, json is the whole record.
+var AccountingAttributes = []string{
+	"comm",
+	"uid",
+	"gid",
+	"pid",
+	"ppid",
+	"exitcode",
+	"flags",
+	"summary",
+	"json",
+}
+
+func isOneOf(s string, list []string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// FieldMapping returns the record attribute that fills each mapped message
+// field. The mapping is configured as "field=attribute" pairs separated by
+// commas, such as "appname=comm, message=summary".
+func (c *AccountingSourceConfig) FieldMapping() (map[string]string, error) {
+	mapping := make(map[string]string)
+	for _, pair := range strings.Split(c.Fields, ",") {
+		pair = strings.TrimSpace(pair)
+		if len(pair) == 0 {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, confCheckError(eerrors.Errorf("Invalid accounting field mapping: '%s'", pair))
+		}
+		field, attr := strings.ToLower(strings.TrimSpace(kv[0])), strings.ToLower(strings.TrimSpace(kv[1]))
+		if !isOneOf(field, AccountingFields) {
+			return nil, confCheckError(eerrors.Errorf("Unknown message field in the accounting mapping: '%s'", field))
+		}
+		if !isOneOf(attr, AccountingAttributes) {
+			return nil, confCheckError(eerrors.Errorf("Unknown accounting attribute: '%s'", attr))
+		}
+		mapping[field] = attr
+	}
+	return mapping, nil
+}
@@ -0,0 +1,166 @@
+package conf
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// Changes summarizes the differences between two configurations, so that a
+// reload can tell what it changes.
+type Changes struct {
+	AddedListeners      []string
+	RemovedListeners    []string
+	AddedParsers        []string
+	RemovedParsers      []string
+	ChangedParsers      []string
+	AddedDestinations   []string
+	RemovedDestinations []string
+	ChangedDestinations []string
+}
+
+// Empty returns true when the summarized parts of the configuration have not
+// changed.
+func (c Changes) Empty() bool {
+	return len(c.AddedListeners) == 0 && len(c.RemovedListeners) == 0 &&
+		len(c.AddedParsers) == 0 && len(c.RemovedParsers) == 0 && len(c.ChangedParsers) == 0 &&
+		len(c.AddedDestinations) == 0 && len(c.RemovedDestinations) == 0 && len(c.ChangedDestinations) == 0
+}
+
+// Changes compares the configuration with the previous one.
+func (c *BaseConfig) Changes(previous *BaseConfig) (changes Changes) {
+	changes.AddedListeners, changes.RemovedListeners = diffSets(c.listeners(), previous.listeners())
+
+	parsers := make(map[string]string, len(c.Parsers))
+	for _, p := range c.Parsers {
+		parsers[p.Name] = p.Func
+	}
+	previousParsers := make(map[string]string, len(previous.Parsers))
+	for _, p := range previous.Parsers {
+		previousParsers[p.Name] = p.Func
+	}
+	changes.AddedParsers, changes.RemovedParsers = diffSets(keys(parsers), keys(previousParsers))
+	for name, f := range parsers {
+		if pf, ok := previousParsers[name]; ok && pf != f {
+			changes.ChangedParsers = append(changes.ChangedParsers, name)
+		}
+	}
+	sort.Strings(changes.ChangedParsers)
+
+	dests, _ := c.Main.GetDestinations()
+	previousDests, _ := previous.Main.GetDestinations()
+	for t, name := range DestinationNames {
+		switch {
+		case dests&t != 0 && previousDests&t == 0:
+			changes.AddedDestinations = append(changes.AddedDestinations, name)
+		case dests&t == 0 && previousDests&t != 0:
+			changes.RemovedDestinations = append(changes.RemovedDestinations, name)
+		case dests&t != 0 && !reflect.DeepEqual(c.destinationConf(t), previous.destinationConf(t)):
+			changes.ChangedDestinations = append(changes.ChangedDestinations, name)
+		}
+	}
+	sort.Strings(changes.AddedDestinations)
+	sort.Strings(changes.RemovedDestinations)
+	sort.Strings(changes.ChangedDestinations)
+	return changes
+}
+
+// listeners returns the listeners of the network sources, as "kind address".
+func (c *BaseConfig) listeners() map[string]bool {
+	res := make(map[string]bool)
+	add := func(kind string, l *ListenersConfig) {
+		if len(l.UnixSocketPath) > 0 {
+			res[fmt.Sprintf("%s unix:%s", kind, l.UnixSocketPath)] = true
+			return
+		}
+		host := l.BindAddr
+		if len(l.BindInterface) > 0 {
+			host = l.BindInterface
+		}
+		for _, port := range l.Ports {
+			res[fmt.Sprintf("%s %s", kind, net.JoinHostPort(host, strconv.Itoa(port)))] = true
+		}
+	}
+	for i := range c.TCPSource {
+		add("tcp", &c.TCPSource[i].ListenersConfig)
+	}
+	for i := range c.UDPSource {
+		add("udp", &c.UDPSource[i].ListenersConfig)
+	}
+	for i := range c.RELPSource {
+		add("relp", &c.RELPSource[i].ListenersConfig)
+	}
+	for i := range c.DirectRELPSource {
+		add("directrelp", &c.DirectRELPSource[i].ListenersConfig)
+	}
+	for i := range c.GraylogSource {
+		add("graylog", &c.GraylogSource[i].ListenersConfig)
+	}
+	for _, s := range c.HTTPServerSource {
+		res[fmt.Sprintf("httpserver %s", net.JoinHostPort(s.BindAddr, strconv.Itoa(s.Port)))] = true
+	}
+	return res
+}
+
+func (c *BaseConfig) destinationConf(t DestinationType) interface{} {
+	switch t {
+	case Kafka:
+		return c.KafkaDest
+	case UDP:
+		return c.UDPDest
+	case TCP:
+		return c.TCPDest
+	case RELP:
+		return c.RELPDest
+	case File:
+		return c.FileDest
+	case Stderr:
+		return c.StderrDest
+	case Graylog:
+		return c.GraylogDest
+	case HTTP:
+		return c.HTTPDest
+	case HTTPServer:
+		return c.HTTPServerDest
+	case NATS:
+		return c.NATSDest
+	case WebsocketServer:
+		return c.WebsocketServerDest
+	case Elasticsearch:
+		return c.ElasticDest
+	case Redis:
+		return c.RedisDest
+	case Journal:
+		return c.JournalDest
+	default:
+		return nil
+	}
+}
+
+func keys(m map[string]string) map[string]bool {
+	res := make(map[string]bool, len(m))
+	for k := range m {
+		res[k] = true
+	}
+	return res
+}
+
+// diffSets returns the sorted elements that are only in current, and the
+// ones that are only in previous.
+func diffSets(current, previous map[string]bool) (added, removed []string) {
+	for k := range current {
+		if !previous[k] {
+			added = append(added, k)
+		}
+	}
+	for k := range previous {
+		if !current[k] {
+			removed = append(removed, k)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
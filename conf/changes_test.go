@@ -0,0 +1,118 @@
+package conf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChanges(t *testing.T) {
+	tcp := func(addr string, ports ...int) TCPSourceConfig {
+		var c TCPSourceConfig
+		c.BindAddr = addr
+		c.Ports = ports
+		return c
+	}
+	parser := func(name, f string) ParserConfig {
+		return ParserConfig{Name: name, Func: f}
+	}
+	tests := []struct {
+		name     string
+		previous BaseConfig
+		current  BaseConfig
+		expected Changes
+	}{
+		{
+			name: "nothing",
+		},
+		{
+			name:     "ports",
+			previous: BaseConfig{TCPSource: []TCPSourceConfig{tcp("127.0.0.1", 514, 1514)}},
+			current:  BaseConfig{TCPSource: []TCPSourceConfig{tcp("127.0.0.1", 1514, 2514)}},
+			expected: Changes{
+				AddedListeners:   []string{"tcp 127.0.0.1:2514"},
+				RemovedListeners: []string{"tcp 127.0.0.1:514"},
+			},
+		},
+		{
+			name:     "kinds",
+			previous: BaseConfig{TCPSource: []TCPSourceConfig{tcp("", 514)}},
+			current: BaseConfig{
+				UDPSource:        []UDPSourceConfig{{ListenersConfig: ListenersConfig{Ports: []int{514}}}},
+				RELPSource:       []RELPSourceConfig{{ListenersConfig: ListenersConfig{UnixSocketPath: "/run/relp.sock", Ports: []int{2514}}}},
+				HTTPServerSource: []HTTPServerSourceConfig{{HTTPServerBaseConfig: HTTPServerBaseConfig{BindAddr: "::1"}, Port: 8080}},
+			},
+			expected: Changes{
+				AddedListeners:   []string{"httpserver [::1]:8080", "relp unix:/run/relp.sock", "udp :514"},
+				RemovedListeners: []string{"tcp :514"},
+			},
+		},
+		{
+			name:     "interface",
+			previous: BaseConfig{TCPSource: []TCPSourceConfig{tcp("127.0.0.1", 514)}},
+			current: BaseConfig{TCPSource: []TCPSourceConfig{func() TCPSourceConfig {
+				c := tcp("127.0.0.1", 514)
+				c.BindInterface = "eth0"
+				return c
+			}()}},
+			expected: Changes{
+				AddedListeners:   []string{"tcp eth0:514"},
+				RemovedListeners: []string{"tcp 127.0.0.1:514"},
+			},
+		},
+		{
+			name:     "other listener settings",
+			previous: BaseConfig{TCPSource: []TCPSourceConfig{tcp("127.0.0.1", 514)}},
+			current: BaseConfig{TCPSource: []TCPSourceConfig{func() TCPSourceConfig {
+				c := tcp("127.0.0.1", 514)
+				c.KeepAlive = true
+				return c
+			}()}},
+		},
+		{
+			name:     "parsers",
+			previous: BaseConfig{Parsers: []ParserConfig{parser("a", "f1"), parser("b", "f2"), parser("c", "f3")}},
+			current:  BaseConfig{Parsers: []ParserConfig{parser("a", "f1"), parser("c", "f4"), parser("d", "f5")}},
+			expected: Changes{
+				AddedParsers:   []string{"d"},
+				RemovedParsers: []string{"b"},
+				ChangedParsers: []string{"c"},
+			},
+		},
+		{
+			name:     "added and removed destinations",
+			previous: BaseConfig{Main: MainConfig{Destination: "kafka,file"}},
+			current:  BaseConfig{Main: MainConfig{Destination: "file, tcp"}},
+			expected: Changes{
+				AddedDestinations:   []string{"tcp"},
+				RemovedDestinations: []string{"kafka"},
+			},
+		},
+		{
+			name:     "reordered destinations",
+			previous: BaseConfig{Main: MainConfig{Destination: "kafka,file"}},
+			current:  BaseConfig{Main: MainConfig{Destination: "File, Kafka"}},
+		},
+		{
+			name:     "changed destination",
+			previous: BaseConfig{Main: MainConfig{Destination: "file,tcp"}, FileDest: FileDestConfig{Filename: "a.log"}},
+			current:  BaseConfig{Main: MainConfig{Destination: "file,tcp"}, FileDest: FileDestConfig{Filename: "b.log"}},
+			expected: Changes{
+				ChangedDestinations: []string{"file"},
+			},
+		},
+		{
+			name:     "unused destination",
+			previous: BaseConfig{Main: MainConfig{Destination: "tcp"}, FileDest: FileDestConfig{Filename: "a.log"}},
+			current:  BaseConfig{Main: MainConfig{Destination: "tcp"}, FileDest: FileDestConfig{Filename: "b.log"}},
+		},
+	}
+	for _, test := range tests {
+		changes := test.current.Changes(&test.previous)
+		if !reflect.DeepEqual(changes, test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, changes)
+		}
+		if changes.Empty() != reflect.DeepEqual(test.expected, Changes{}) {
+			t.Errorf("%s: unexpected Empty: %v", test.name, changes.Empty())
+		}
+	}
+}
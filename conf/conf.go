@@ -11,6 +11,9 @@ import (
 	"hash/fnv"
 	"net"
 	"net/http"
+	"path/filepath"
+	"regexp"
+	"runtime"
 	"strconv"
 	"strings"
 	"text/template"
@@ -27,6 +30,7 @@ import (
 	"github.com/spf13/viper"
 	"github.com/stephane-martin/skewer/consul"
 	"github.com/stephane-martin/skewer/decoders/base"
+	"github.com/stephane-martin/skewer/sys/binder"
 	"github.com/stephane-martin/skewer/sys/kring"
 	"github.com/stephane-martin/skewer/utils"
 	"github.com/stephane-martin/skewer/utils/eerrors"
@@ -237,6 +241,14 @@ func (c *MacOSSourceConfig) SetConfID() {
 	c.ConfID = c.FilterSubConfig.CalculateID()
 }
 
+func (c *SyntheticSourceConfig) SetConfID() {
+	c.ConfID = c.FilterSubConfig.CalculateID()
+}
+
+func (c *HeartbeatConfig) SetConfID() {
+	c.ConfID = c.FilterSubConfig.CalculateID()
+}
+
 func (c *KafkaSourceConfig) SetConfID() {
 	c.ConfID = c.FilterSubConfig.CalculateID()
 }
@@ -245,6 +257,14 @@ func (c *FilesystemSourceConfig) SetConfID() {
 	c.ConfID = c.FilterSubConfig.CalculateID()
 }
 
+func (c *FIFOSourceConfig) SetConfID() {
+	c.ConfID = c.FilterSubConfig.CalculateID()
+}
+
+func (c *IngestSourceConfig) SetConfID() {
+	c.ConfID = c.FilterSubConfig.CalculateID()
+}
+
 func (c *HTTPServerSourceConfig) GetClientAuthType() tls.ClientAuthType {
 	return convertClientAuthType(c.ClientAuthType)
 }
@@ -302,6 +322,12 @@ func cleanList(list set.Interface) (res []string) {
 	return res
 }
 
+func addStrings(s set.Interface, list []string) {
+	for _, item := range list {
+		s.Add(item)
+	}
+}
+
 func (c *BaseConfig) GetCertificateFiles() (res map[string][]string) {
 	res = make(map[string][]string)
 	s := set.New(set.ThreadSafe)
@@ -313,19 +339,22 @@ func (c *BaseConfig) GetCertificateFiles() (res map[string][]string) {
 
 	s = set.New(set.ThreadSafe)
 	for _, src := range c.TCPSource {
-		s.Add(src.CAFile, src.CertFile, src.KeyFile)
+		s.Add(src.CAFile, src.CertFile, src.KeyFile, src.CRLFile)
+		addStrings(s, src.ClientCAFiles)
 	}
 	res["tcpsource"] = cleanList(s)
 
 	s = set.New(set.ThreadSafe)
 	for _, src := range c.RELPSource {
-		s.Add(src.CAFile, src.CertFile, src.KeyFile)
+		s.Add(src.CAFile, src.CertFile, src.KeyFile, src.CRLFile)
+		addStrings(s, src.ClientCAFiles)
 	}
 	res["relpsource"] = cleanList(s)
 
 	s = set.New(set.ThreadSafe)
 	for _, src := range c.DirectRELPSource {
-		s.Add(src.CAFile, src.CertFile, src.KeyFile)
+		s.Add(src.CAFile, src.CertFile, src.KeyFile, src.CRLFile)
+		addStrings(s, src.ClientCAFiles)
 	}
 	res["directrelpsource"] = cleanList(s)
 
@@ -379,11 +408,68 @@ func (c *BaseConfig) GetCertificatePaths() (res map[string][]string) {
 	return res
 }
 
+// InterfaceAddr returns the current address of BindInterface. When the
+// interface has several addresses, the first IPv4 address is preferred.
+func (c *ListenersConfig) InterfaceAddr() (net.IP, error) {
+	iface, err := net.InterfaceByName(c.BindInterface)
+	if err != nil {
+		return nil, fmt.Errorf("bind_interface is not a network interface: %s", c.BindInterface)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	var first net.IP
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ipnet.IP.To4() != nil {
+			return ipnet.IP, nil
+		}
+		if first == nil {
+			first = ipnet.IP
+		}
+	}
+	if first == nil {
+		return nil, fmt.Errorf("bind_interface has no address: %s", c.BindInterface)
+	}
+	return first, nil
+}
+
+// ResolvedBindAddr returns the address that the listeners are bound to.
+func (c *ListenersConfig) ResolvedBindAddr() string {
+	if len(c.BindInterface) == 0 {
+		return c.BindAddr
+	}
+	ip, err := c.InterfaceAddr()
+	if err != nil {
+		return ""
+	}
+	return ip.String()
+}
+
 func (c *ListenersConfig) GetListenAddrs() (addrs map[int]string, err error) {
 	addrs = map[int]string{}
 	if len(c.UnixSocketPath) > 0 {
 		return
 	}
+	if len(c.BindInterface) > 0 {
+		ip, err := c.InterfaceAddr()
+		if err != nil {
+			return nil, err
+		}
+		for _, port := range c.Ports {
+			if runtime.GOOS == "linux" {
+				// the socket is bound to the device, whatever its addresses
+				addrs[port] = binder.WithDevice(fmt.Sprintf(":%d", port), c.BindInterface)
+			} else {
+				addrs[port] = net.JoinHostPort(ip.String(), strconv.Itoa(port))
+			}
+		}
+		return addrs, nil
+	}
 	bindIP := net.ParseIP(c.BindAddr)
 	if bindIP == nil {
 		return nil, fmt.Errorf("bind_addr is not an IP address: %s", c.BindAddr)
@@ -544,13 +630,17 @@ func (c *KafkaDestConfig) GetSaramaProducerConfig(confined bool) (*sarama.Config
 
 	switch c.Partitioner {
 	case "manual":
-		s.Producer.Partitioner = sarama.NewManualPartitioner
+		s.Producer.Partitioner = utils.NewValidatingPartitioner(c.PartitionOverflow)
 	case "random":
 		s.Producer.Partitioner = sarama.NewRandomPartitioner
 	case "roundrobin":
 		s.Producer.Partitioner = sarama.NewRoundRobinPartitioner
 	default:
-		s.Producer.Partitioner = sarama.NewHashPartitioner
+		if c.PartitionKeyHash {
+			s.Producer.Partitioner = utils.NewUniformHashPartitioner(c.PartitionKeySalt)
+		} else {
+			s.Producer.Partitioner = sarama.NewHashPartitioner
+		}
 	}
 	return s, nil
 }
@@ -567,6 +657,26 @@ func (c *KafkaDestConfig) GetAsyncProducer(confined bool) (sarama.AsyncProducer,
 	return p, conf.MetricRegistry, nil
 }
 
+// GetAsyncProducerClient returns a producer and its client, so that the
+// metadata of the client can be refreshed. The client must be closed after
+// the producer.
+func (c *KafkaDestConfig) GetAsyncProducerClient(confined bool) (sarama.AsyncProducer, sarama.Client, metrics.Registry, error) {
+	conf, err := c.GetSaramaProducerConfig(confined)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cl, err := sarama.NewClient(c.Brokers, conf)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	p, err := sarama.NewAsyncProducerFromClient(cl)
+	if err != nil {
+		_ = cl.Close()
+		return nil, nil, nil, err
+	}
+	return p, cl, conf.MetricRegistry, nil
+}
+
 func (c *KafkaDestConfig) GetClient(confined bool) (sarama.Client, error) {
 	conf, err := c.GetSaramaProducerConfig(confined)
 	if err != nil {
@@ -762,7 +872,8 @@ func (c *BaseConfig) Export() (string, error) {
 
 func (c *BaseConfig) Complete(r kring.Ring) (err error) {
 	parsersNames := map[string]bool{}
-	for _, parserConf := range c.Parsers {
+	for i := range c.Parsers {
+		parserConf := &c.Parsers[i]
 		name := strings.TrimSpace(parserConf.Name)
 		if base.ParseFormat(parserConf.Name) != -1 {
 			return confCheckError(eerrors.New("Parser configuration must not use a reserved name"))
@@ -774,7 +885,15 @@ func (c *BaseConfig) Complete(r kring.Ring) (err error) {
 			return confCheckError(eerrors.New("The same parser name is used multiple times"))
 		}
 		f := strings.TrimSpace(parserConf.Func)
-		if len(f) == 0 {
+		switch {
+		case len(parserConf.Regex) > 0 && len(f) > 0:
+			return confCheckError(eerrors.Errorf("Parser '%s' must have either a func or a regex", name))
+		case len(parserConf.Regex) > 0:
+			err = parserConf.checkRegex()
+			if err != nil {
+				return err
+			}
+		case len(f) == 0:
 			return confCheckError(eerrors.New("Empty parser func"))
 		}
 		parsersNames[name] = true
@@ -785,11 +904,88 @@ func (c *BaseConfig) Complete(r kring.Ring) (err error) {
 		return err
 	}
 
+	if c.Main.MaxPipeMessageSize <= 0 {
+		c.Main.MaxPipeMessageSize = 4194304
+	}
+	if c.Main.MaxPipeMessageSize < c.Main.MaxInputMessageSize {
+		return confCheckError(eerrors.New("max_pipe_message_size must not be smaller than max_input_message_size"))
+	}
+	if c.Main.MaxMessageAge < 0 {
+		return confCheckError(eerrors.New("max_message_age must not be negative"))
+	}
+	if c.Main.LogRateLimitBurst < 0 {
+		return confCheckError(eerrors.New("log_ratelimit_burst must not be negative"))
+	}
+	if c.Main.LogRateLimitBurst > 0 && c.Main.LogRateLimitWindow <= 0 {
+		return confCheckError(eerrors.New("log_ratelimit_window must be positive"))
+	}
+	if c.Main.ParseWorkers <= 0 {
+		c.Main.ParseWorkers = runtime.NumCPU()
+	}
+	if c.Main.RELPBatchSize < 0 {
+		return confCheckError(eerrors.New("relp_batch_size must not be negative"))
+	}
+	if c.Main.RELPBatchSize == 0 {
+		c.Main.RELPBatchSize = 1
+	}
+	c.Store.OnChildExit, err = checkStoreExit(c.Store.OnChildExit)
+	if err != nil {
+		return err
+	}
+	if c.Main.PluginStartTimeout <= 0 {
+		c.Main.PluginStartTimeout = 60 * time.Second
+	}
+	c.Main.BindRetryPeriod, err = completeBindRetryPeriod(c.Main.BindRetryPeriod, c.Main.PluginStartTimeout)
+	if err != nil {
+		return err
+	}
+	if c.Main.PluginGatherTimeout <= 0 {
+		c.Main.PluginGatherTimeout = 2 * time.Second
+	}
+	c.Main.ParsedQueuePolicy = strings.ToLower(strings.TrimSpace(c.Main.ParsedQueuePolicy))
+	switch c.Main.ParsedQueuePolicy {
+	case "":
+		c.Main.ParsedQueuePolicy = "block"
+	case "block", "nack":
+	default:
+		return confCheckError(eerrors.Errorf("Unknown parsed_queue_policy: '%s'", c.Main.ParsedQueuePolicy))
+	}
+	if c.Main.JSMaxStackDepth < 0 {
+		return confCheckError(eerrors.New("js_max_stack_depth must not be negative"))
+	}
+	if c.Main.JSMaxDuration < 0 {
+		return confCheckError(eerrors.New("js_max_duration must not be negative"))
+	}
+	if c.Main.ParsedQueueTimeout < 0 {
+		return confCheckError(eerrors.New("parsed_queue_timeout must not be negative"))
+	}
+	if c.Main.MetricsExpiry < 0 {
+		return confCheckError(eerrors.New("metrics_expiry must not be negative"))
+	}
+	if c.Main.AcceptMaxGoroutines < 0 {
+		return confCheckError(eerrors.New("accept_max_goroutines must not be negative"))
+	}
+	if c.Main.AcceptCheckInterval <= 0 {
+		c.Main.AcceptCheckInterval = time.Second
+	}
+	if c.Main.FieldSizeWindow <= 0 {
+		c.Main.FieldSizeWindow = time.Minute
+	}
+	err = c.Main.completeDumpable()
+	if err != nil {
+		return err
+	}
+
 	err = c.CheckDestinations()
 	if err != nil {
 		return err
 	}
 
+	err = c.CheckTransforms()
+	if err != nil {
+		return err
+	}
+
 	_, err = ParseVersion(c.KafkaDest.Version)
 	if err != nil {
 		return confCheckError(
@@ -823,6 +1019,12 @@ func (c *BaseConfig) Complete(r kring.Ring) (err error) {
 	for i := range c.FSSource {
 		sources = append(sources, &c.FSSource[i])
 	}
+	for i := range c.FIFOSource {
+		sources = append(sources, &c.FIFOSource[i])
+	}
+	for i := range c.IngestSource {
+		sources = append(sources, &c.IngestSource[i])
+	}
 	for i := range c.TCPSource {
 		sources = append(sources, &c.TCPSource[i])
 	}
@@ -844,11 +1046,142 @@ func (c *BaseConfig) Complete(r kring.Ring) (err error) {
 	for i := range c.HTTPServerSource {
 		sources = append(sources, &c.HTTPServerSource[i])
 	}
-	sources = append(sources, &c.Journald, &c.Accounting, &c.MacOS)
+	sources = append(sources, &c.Journald, &c.Accounting, &c.MacOS, &c.Synthetic, &c.Heartbeat)
 
 	for i := range c.TCPSource {
-		if len(c.TCPSource[i].FrameDelimiter) == 0 {
-			c.TCPSource[i].FrameDelimiter = "\n"
+		c.TCPSource[i].FrameDelimiter, err = completeRecordSeparator(c.TCPSource[i].FrameDelimiter)
+		if err != nil {
+			return err
+		}
+		if c.TCPSource[i].OctetCounting && c.TCPSource[i].LineFraming {
+			return confCheckError(eerrors.New("TCP source: octet_counting and line_framing are mutually exclusive"))
+		}
+		c.TCPSource[i].Decompress, err = completeDecompress(c.TCPSource[i].Decompress)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = c.Accounting.FieldMapping()
+	if err != nil {
+		return err
+	}
+
+	for i := range c.FIFOSource {
+		fc := &c.FIFOSource[i]
+		if len(fc.Path) == 0 {
+			return confCheckError(eerrors.New("FIFO source path is empty"))
+		}
+		if !filepath.IsAbs(fc.Path) {
+			return confCheckError(eerrors.Errorf("FIFO source path must be absolute: %s", fc.Path))
+		}
+		if len(fc.FrameDelimiter) == 0 {
+			fc.FrameDelimiter = "\n"
+		}
+		if len(fc.FrameDelimiter) != 1 {
+			return confCheckError(eerrors.Errorf("FIFO source delimiter must be a single byte: %s", fc.Path))
+		}
+	}
+
+	for i := range c.IngestSource {
+		err = completeIngest(&c.IngestSource[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := range c.TCPSource {
+		completeCertReload(&c.TCPSource[i].CertReloadInterval)
+		c.TCPSource[i].RevocationPolicy, err = completeRevocationPolicy(c.TCPSource[i].RevocationPolicy)
+		if err != nil {
+			return err
+		}
+		completeTLSHandshakes(&c.TCPSource[i].MaxTLSHandshakes, &c.TCPSource[i].TLSHandshakeTimeout, &c.TCPSource[i].TLSHandshakeWait)
+		err = completeMaxConnections(c.TCPSource[i].MaxConnections, c.TCPSource[i].EvictIdle)
+		if err != nil {
+			return err
+		}
+		c.TCPSource[i].NoDelay, err = completeNoDelay(c.TCPSource[i].NoDelay)
+		if err != nil {
+			return err
+		}
+		err = completeBackpressure(&c.TCPSource[i].BackpressureHigh, &c.TCPSource[i].BackpressureLow, c.Main.InputQueueSize)
+		if err != nil {
+			return err
+		}
+	}
+	for i := range c.RELPSource {
+		err = completeOpenOffers(c.RELPSource[i].OpenOffers)
+		if err != nil {
+			return err
+		}
+		completeCertReload(&c.RELPSource[i].CertReloadInterval)
+		c.RELPSource[i].RevocationPolicy, err = completeRevocationPolicy(c.RELPSource[i].RevocationPolicy)
+		if err != nil {
+			return err
+		}
+		completeTLSHandshakes(&c.RELPSource[i].MaxTLSHandshakes, &c.RELPSource[i].TLSHandshakeTimeout, &c.RELPSource[i].TLSHandshakeWait)
+		err = completeMaxConnections(c.RELPSource[i].MaxConnections, c.RELPSource[i].EvictIdle)
+		if err != nil {
+			return err
+		}
+		c.RELPSource[i].NoDelay, err = completeNoDelay(c.RELPSource[i].NoDelay)
+		if err != nil {
+			return err
+		}
+		err = completeReplay(c.RELPSource[i].ReplayGracePeriod, c.RELPSource[i].ClientIDOffer)
+		if err != nil {
+			return err
+		}
+		if c.RELPSource[i].MaxPendingAnswers < 0 {
+			return confCheckError(eerrors.New("max_pending_answers must not be negative"))
+		}
+		c.RELPSource[i].EmptyFrames, err = completeEmptyFrames(c.RELPSource[i].EmptyFrames)
+		if err != nil {
+			return err
+		}
+		c.RELPSource[i].OfferMismatch, err = completeOfferMismatch(c.RELPSource[i].OfferMismatch)
+		if err != nil {
+			return err
+		}
+		err = completeEndToEndAck(c.RELPSource[i].EndToEndAck, &c.RELPSource[i].EndToEndAckTimeout)
+		if err != nil {
+			return err
+		}
+	}
+	for i := range c.DirectRELPSource {
+		err = completeOpenOffers(c.DirectRELPSource[i].OpenOffers)
+		if err != nil {
+			return err
+		}
+		completeCertReload(&c.DirectRELPSource[i].CertReloadInterval)
+		c.DirectRELPSource[i].RevocationPolicy, err = completeRevocationPolicy(c.DirectRELPSource[i].RevocationPolicy)
+		if err != nil {
+			return err
+		}
+		completeTLSHandshakes(&c.DirectRELPSource[i].MaxTLSHandshakes, &c.DirectRELPSource[i].TLSHandshakeTimeout, &c.DirectRELPSource[i].TLSHandshakeWait)
+		err = completeMaxConnections(c.DirectRELPSource[i].MaxConnections, c.DirectRELPSource[i].EvictIdle)
+		if err != nil {
+			return err
+		}
+		c.DirectRELPSource[i].NoDelay, err = completeNoDelay(c.DirectRELPSource[i].NoDelay)
+		if err != nil {
+			return err
+		}
+		err = completeReplay(c.DirectRELPSource[i].ReplayGracePeriod, c.DirectRELPSource[i].ClientIDOffer)
+		if err != nil {
+			return err
+		}
+		if c.DirectRELPSource[i].MaxPendingAnswers < 0 {
+			return confCheckError(eerrors.New("max_pending_answers must not be negative"))
+		}
+		c.DirectRELPSource[i].EmptyFrames, err = completeEmptyFrames(c.DirectRELPSource[i].EmptyFrames)
+		if err != nil {
+			return err
+		}
+		c.DirectRELPSource[i].OfferMismatch, err = completeOfferMismatch(c.DirectRELPSource[i].OfferMismatch)
+		if err != nil {
+			return err
 		}
 	}
 
@@ -882,6 +1215,34 @@ func (c *BaseConfig) Complete(r kring.Ring) (err error) {
 		if len(hc.DecoderBaseConfig.Format) == 0 {
 			hc.DecoderBaseConfig.Format = "json"
 		}
+		err = completeClockSkew(&hc.DecoderBaseConfig)
+		if err != nil {
+			return err
+		}
+		err = completeSDFilter(&hc.DecoderBaseConfig)
+		if err != nil {
+			return err
+		}
+		err = completeHostname(&hc.DecoderBaseConfig)
+		if err != nil {
+			return err
+		}
+		err = completeStrict(&hc.DecoderBaseConfig)
+		if err != nil {
+			return err
+		}
+		err = completeFallbackFormats(&hc.DecoderBaseConfig)
+		if err != nil {
+			return err
+		}
+		err = completeChecksum(&hc.DecoderBaseConfig)
+		if err != nil {
+			return err
+		}
+		err = completeQuarantine(&hc.DecoderBaseConfig)
+		if err != nil {
+			return err
+		}
 		if hc.MaxMessages == 0 {
 			hc.MaxMessages = 10000
 		}
@@ -899,6 +1260,34 @@ func (c *BaseConfig) Complete(r kring.Ring) (err error) {
 			if decodr.Charset == "" {
 				decodr.Charset = "utf8"
 			}
+			err = completeClockSkew(decodr)
+			if err != nil {
+				return err
+			}
+			err = completeSDFilter(decodr)
+			if err != nil {
+				return err
+			}
+			err = completeHostname(decodr)
+			if err != nil {
+				return err
+			}
+			err = completeStrict(decodr)
+			if err != nil {
+				return err
+			}
+			err = completeFallbackFormats(decodr)
+			if err != nil {
+				return err
+			}
+			err = completeChecksum(decodr)
+			if err != nil {
+				return err
+			}
+			err = completeQuarantine(decodr)
+			if err != nil {
+				return err
+			}
 		}
 		if listeners != nil {
 			if listeners.UnixSocketPath == "" {
@@ -917,6 +1306,17 @@ func (c *BaseConfig) Complete(r kring.Ring) (err error) {
 			if listeners.KeepAlivePeriod <= 0 {
 				listeners.KeepAlivePeriod = 75 * time.Second
 			}
+
+			switch listeners.ConnectionLog {
+			case "":
+				listeners.ConnectionLog = "info"
+			case "info", "debug", "none":
+			default:
+				return confCheckError(eerrors.Errorf("Unknown connection_log level: '%s'", listeners.ConnectionLog))
+			}
+			if listeners.ConnectionLogSampling <= 0 {
+				listeners.ConnectionLogSampling = 1
+			}
 			_, err = listeners.GetListenAddrs()
 			if err != nil {
 				return confCheckError(err)
@@ -930,6 +1330,7 @@ func (c *BaseConfig) Complete(r kring.Ring) (err error) {
 			if filtering.PartitionTmpl == "" {
 				filtering.PartitionTmpl = "partition-{{.HostName}}"
 			}
+			filtering.QuarantineTopic = strings.TrimSpace(filtering.QuarantineTopic)
 
 			if len(filtering.TopicTmpl) > 0 {
 				_, err = template.New("topic").Parse(filtering.TopicTmpl)
@@ -952,6 +1353,34 @@ func (c *BaseConfig) Complete(r kring.Ring) (err error) {
 
 	}
 
+	// check the synthetic source parameters
+	if c.Synthetic.Enabled {
+		switch c.Synthetic.Format {
+		case "rfc5424", "rfc3164":
+		default:
+			return confCheckError(eerrors.Errorf("The synthetic source can not generate messages in format '%s'", c.Synthetic.Format))
+		}
+		if c.Synthetic.Rate <= 0 {
+			c.Synthetic.Rate = 1000
+		}
+		if c.Synthetic.Clients <= 0 {
+			c.Synthetic.Clients = 1
+		}
+		if c.Synthetic.MinSize <= 0 {
+			c.Synthetic.MinSize = 1
+		}
+		if c.Synthetic.MaxSize < c.Synthetic.MinSize {
+			return confCheckError(eerrors.New("The synthetic source max_size must be greater than min_size"))
+		}
+	}
+
+	if c.Heartbeat.Enabled {
+		err = completeHeartbeat(&c.Heartbeat)
+		if err != nil {
+			return err
+		}
+	}
+
 	// set default paramaters for kafka sources
 	for i := range c.KafkaSource {
 		conf := &(c.KafkaSource[i])
@@ -1045,6 +1474,453 @@ func (c *BaseConfig) Complete(r kring.Ring) (err error) {
 	c.KafkaDest.Partitioner = strings.TrimSpace(strings.ToLower(c.KafkaDest.Partitioner))
 	c.KafkaDest.Partitioner = strings.Replace(c.KafkaDest.Partitioner, "-", "", -1)
 	c.KafkaDest.Partitioner = strings.Replace(c.KafkaDest.Partitioner, "_", "", -1)
+	c.KafkaDest.PartitionOverflow = strings.TrimSpace(strings.ToLower(c.KafkaDest.PartitionOverflow))
+	switch c.KafkaDest.PartitionOverflow {
+	case "":
+		c.KafkaDest.PartitionOverflow = "hash"
+	case "hash", "clamp", "mod", "error":
+	default:
+		return confCheckError(eerrors.Errorf("Unknown partition_overflow policy: '%s'", c.KafkaDest.PartitionOverflow))
+	}
+	if c.KafkaDest.PartitionRefreshInterval < 0 {
+		return confCheckError(eerrors.New("partition_refresh_interval can not be negative"))
+	}
+	c.KafkaDest.KeySDID = strings.TrimSpace(c.KafkaDest.KeySDID)
+	c.KafkaDest.KeySDParam = strings.TrimSpace(c.KafkaDest.KeySDParam)
+	if (len(c.KafkaDest.KeySDID) == 0) != (len(c.KafkaDest.KeySDParam) == 0) {
+		return confCheckError(eerrors.New("key_sd_id and key_sd_param must be specified together"))
+	}
+	for i := range c.KafkaDest.SDHeaders {
+		h := &c.KafkaDest.SDHeaders[i]
+		h.SDID = strings.TrimSpace(h.SDID)
+		h.SDParam = strings.TrimSpace(h.SDParam)
+		h.Header = strings.TrimSpace(h.Header)
+		if len(h.SDID) == 0 || len(h.SDParam) == 0 {
+			return confCheckError(eerrors.New("A Kafka SD header needs a sd_id and a sd_param"))
+		}
+		if len(h.Header) == 0 {
+			h.Header = h.SDParam
+		}
+	}
+	if len(c.KafkaDest.SDHeaders) > 0 {
+		v, err := ParseVersion(c.KafkaDest.Version)
+		if err == nil && !v.IsAtLeast(sarama.V0_11_0_0) {
+			return confCheckError(eerrors.Errorf("The Kafka SD headers need Kafka 0.11 or later (version is '%s')", c.KafkaDest.Version))
+		}
+	}
+	c.KafkaDest.ChecksumHeader = strings.TrimSpace(c.KafkaDest.ChecksumHeader)
+	if len(c.KafkaDest.ChecksumHeader) > 0 {
+		v, err := ParseVersion(c.KafkaDest.Version)
+		if err == nil && !v.IsAtLeast(sarama.V0_11_0_0) {
+			return confCheckError(eerrors.Errorf("The Kafka checksum header needs Kafka 0.11 or later (version is '%s')", c.KafkaDest.Version))
+		}
+	}
+	c.KafkaDest.RetriesHeader = strings.TrimSpace(c.KafkaDest.RetriesHeader)
+	if len(c.KafkaDest.RetriesHeader) > 0 {
+		v, err := ParseVersion(c.KafkaDest.Version)
+		if err == nil && !v.IsAtLeast(sarama.V0_11_0_0) {
+			return confCheckError(eerrors.Errorf("The Kafka retries header needs Kafka 0.11 or later (version is '%s')", c.KafkaDest.Version))
+		}
+	}
+	if c.KafkaDest.SerializationBufferMax < 0 {
+		return confCheckError(eerrors.New("serialization_buffer_max must not be negative"))
+	}
+	c.KafkaDest.TimestampSource = strings.TrimSpace(strings.ToLower(c.KafkaDest.TimestampSource))
+	switch c.KafkaDest.TimestampSource {
+	case "":
+		c.KafkaDest.TimestampSource = "reported"
+	case "reported", "received", "generated":
+	default:
+		return confCheckError(eerrors.Errorf("Unknown timestamp_source: '%s'", c.KafkaDest.TimestampSource))
+	}
+	if c.KafkaDest.Producers <= 0 {
+		c.KafkaDest.Producers = 1
+	}
+	err = c.KafkaDest.CheckClusters()
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
+
+func completeCertReload(interval *time.Duration) {
+	if *interval == 0 {
+		*interval = time.Minute
+	} else if *interval < 0 {
+		*interval = 0
+	}
+}
+
+func completeTLSHandshakes(max *int, timeout, wait *time.Duration) {
+	if *max <= 0 {
+		*max = 64
+	}
+	if *timeout <= 0 {
+		*timeout = 10 * time.Second
+	}
+	if *wait <= 0 {
+		*wait = 100 * time.Millisecond
+	}
+}
+
+func completeMaxConnections(max int, evictIdle time.Duration) error {
+	if max < 0 {
+		return confCheckError(eerrors.New("max_connections must not be negative"))
+	}
+	if evictIdle < 0 {
+		return confCheckError(eerrors.New("evict_idle must not be negative"))
+	}
+	return nil
+}
+
+func completeBackpressure(high, low *int, queueSize uint64) error {
+	if *high < 0 || *low < 0 {
+		return confCheckError(eerrors.New("backpressure_high and backpressure_low must not be negative"))
+	}
+	if *high == 0 {
+		*low = 0
+		return nil
+	}
+	if queueSize > 0 && uint64(*high) > queueSize {
+		return confCheckError(eerrors.Errorf("backpressure_high must not exceed input_queue_size (%d)", queueSize))
+	}
+	if *low == 0 {
+		*low = *high / 2
+	}
+	if *low >= *high {
+		return confCheckError(eerrors.New("backpressure_low must be lower than backpressure_high"))
+	}
+	return nil
+}
+
+func completeReplay(grace time.Duration, clientIDOffer string) error {
+	if grace < 0 {
+		return confCheckError(eerrors.New("replay_grace_period must not be negative"))
+	}
+	if grace > 0 && len(clientIDOffer) == 0 {
+		return confCheckError(eerrors.New("replay_grace_period requires client_id_offer"))
+	}
+	return nil
+}
+
+func completeEndToEndAck(enabled bool, timeout *time.Duration) error {
+	if *timeout < 0 {
+		return confCheckError(eerrors.New("end_to_end_ack_timeout must not be negative"))
+	}
+	if enabled && *timeout == 0 {
+		*timeout = 30 * time.Second
+	}
+	return nil
+}
+
+func completeEmptyFrames(policy string) (string, error) {
+	policy = strings.ToLower(strings.TrimSpace(policy))
+	switch policy {
+	case "":
+		return "ack", nil
+	case "ack", "reject", "keepalive":
+		return policy, nil
+	default:
+		return "", confCheckError(eerrors.Errorf("Unknown empty_frames policy: '%s'", policy))
+	}
+}
+
+func completeOfferMismatch(policy string) (string, error) {
+	policy = strings.ToLower(strings.TrimSpace(policy))
+	switch policy {
+	case "":
+		return "reject", nil
+	case "reject", "accept":
+		return policy, nil
+	default:
+		return "", confCheckError(eerrors.Errorf("Unknown offer_mismatch policy: '%s'", policy))
+	}
+}
+
+// completeBindRetryPeriod checks the bind retry period against the plugin
+// start timeout: the listens are retried while the plugins start, so that a
+// plugin that retries for longer would be killed for not having started.
+func completeBindRetryPeriod(period, startTimeout time.Duration) (time.Duration, error) {
+	switch {
+	case period < 0:
+		return period, nil
+	case period == 0:
+		period = 10 * time.Second
+		if period > startTimeout/2 {
+			period = startTimeout / 2
+		}
+		return period, nil
+	case period >= startTimeout:
+		return 0, confCheckError(eerrors.Errorf(
+			"bind_retry_period (%s) must be shorter than plugin_start_timeout (%s)", period, startTimeout,
+		))
+	default:
+		return period, nil
+	}
+}
+
+func completeDecompress(codec string) (string, error) {
+	codec = strings.ToLower(strings.TrimSpace(codec))
+	switch codec {
+	case "":
+		return "none", nil
+	case "none", "auto", "gzip", "zlib":
+		return codec, nil
+	case "zstd":
+		return "", confCheckError(eerrors.New("zstd decompression is not supported, only gzip and zlib are"))
+	default:
+		return "", confCheckError(eerrors.Errorf("Unknown decompress codec: '%s'", codec))
+	}
+}
+
+func completeNoDelay(nodelay string) (string, error) {
+	nodelay = strings.ToLower(strings.TrimSpace(nodelay))
+	switch nodelay {
+	case "":
+		return "on", nil
+	case "on", "off":
+		return nodelay, nil
+	default:
+		return "", confCheckError(eerrors.Errorf("Unknown nodelay setting: '%s'", nodelay))
+	}
+}
+
+func completeRevocationPolicy(policy string) (string, error) {
+	policy = strings.ToLower(strings.TrimSpace(policy))
+	switch policy {
+	case "":
+		return "soft", nil
+	case "soft", "hard":
+		return policy, nil
+	default:
+		return "", confCheckError(eerrors.Errorf("Unknown revocation_policy: '%s'", policy))
+	}
+}
+
+func completeOpenOffers(offers []string) error {
+	for i, offer := range offers {
+		offer = strings.TrimSpace(offer)
+		kv := strings.SplitN(offer, "=", 2)
+		if len(kv) != 2 || len(strings.TrimSpace(kv[0])) == 0 || strings.ContainsAny(offer, "\r\n") {
+			return confCheckError(eerrors.Errorf("Invalid RELP open offer: '%s'", offer))
+		}
+		switch strings.TrimSpace(kv[0]) {
+		case "relp_version", "relp_software", "commands":
+			return confCheckError(eerrors.Errorf("RELP open offer '%s' can not be overridden", kv[0]))
+		}
+		offers[i] = offer
+	}
+	return nil
+}
+
+func completeSDFilter(c *DecoderBaseConfig) error {
+	c.SkipSDIDs = strings.TrimSpace(c.SkipSDIDs)
+	c.KeepSDIDs = strings.TrimSpace(c.KeepSDIDs)
+	if len(c.SkipSDIDs) > 0 && len(c.KeepSDIDs) > 0 {
+		return confCheckError(eerrors.New("skip_sd_ids and keep_sd_ids can not be both specified"))
+	}
+	c.SDDuplicatePolicy = strings.ToLower(strings.TrimSpace(c.SDDuplicatePolicy))
+	switch c.SDDuplicatePolicy {
+	case "":
+		c.SDDuplicatePolicy = "last"
+	case "last", "first", "array":
+	default:
+		return confCheckError(eerrors.Errorf("Unknown sd_duplicate_policy: '%s'", c.SDDuplicatePolicy))
+	}
+	return nil
+}
+
+func completeStrict(c *DecoderBaseConfig) error {
+	c.RFC5424RejectAction = strings.ToLower(strings.TrimSpace(c.RFC5424RejectAction))
+	switch c.RFC5424RejectAction {
+	case "":
+		c.RFC5424RejectAction = "drop"
+	case "drop", "forward":
+	default:
+		return confCheckError(eerrors.Errorf("Unknown rfc5424_reject_action: '%s'", c.RFC5424RejectAction))
+	}
+	if c.RFC5424Strict && strings.ToLower(strings.TrimSpace(c.Format)) != "rfc5424" {
+		return confCheckError(eerrors.Errorf("rfc5424_strict requires the rfc5424 format, not '%s'", c.Format))
+	}
+	c.UnknownParserAction = strings.ToLower(strings.TrimSpace(c.UnknownParserAction))
+	switch c.UnknownParserAction {
+	case "":
+		c.UnknownParserAction = "skip"
+	case "skip", "fail":
+	default:
+		return confCheckError(eerrors.Errorf("Unknown unknown_parser_action: '%s'", c.UnknownParserAction))
+	}
+	return nil
+}
+
+func completeQuarantine(c *DecoderBaseConfig) error {
+	c.ParseErrorAction = strings.ToLower(strings.TrimSpace(c.ParseErrorAction))
+	switch c.ParseErrorAction {
+	case "":
+		c.ParseErrorAction = "drop"
+	case "drop", "quarantine":
+	default:
+		return confCheckError(eerrors.Errorf("Unknown parse_error_action: '%s'", c.ParseErrorAction))
+	}
+	c.QuarantineAnswer = strings.ToLower(strings.TrimSpace(c.QuarantineAnswer))
+	switch c.QuarantineAnswer {
+	case "":
+		c.QuarantineAnswer = "ack"
+	case "ack", "nack":
+	default:
+		return confCheckError(eerrors.Errorf("Unknown quarantine_answer: '%s'", c.QuarantineAnswer))
+	}
+	return nil
+}
+
+// completeRecordSeparator translates the names of the record separators of
+// the line framing.
+func completeRecordSeparator(delimiter string) (string, error) {
+	switch strings.ToLower(delimiter) {
+	case "", "lf":
+		return "\n", nil
+	case "crlf":
+		return "\r\n", nil
+	case "cr":
+		return "\r", nil
+	case "nul":
+		return "\x00", nil
+	}
+	if len(delimiter) != 1 && delimiter != "\r\n" {
+		return "", confCheckError(eerrors.Errorf("Unknown delimiter: '%s'", delimiter))
+	}
+	return delimiter, nil
+}
+
+func completeFallbackFormats(c *DecoderBaseConfig) error {
+	formats := make([]string, 0)
+	for _, format := range strings.Split(c.FallbackFormats, ",") {
+		format = strings.TrimSpace(format)
+		if len(format) == 0 {
+			continue
+		}
+		if base.ParseFormat(format) != -1 || strings.ToLower(format) == "raw" {
+			format = strings.ToLower(format)
+		}
+		if len(formats) > 0 && formats[len(formats)-1] == "raw" {
+			return confCheckError(eerrors.New("raw must be the last of fallback_formats"))
+		}
+		if strings.EqualFold(format, strings.TrimSpace(c.Format)) {
+			return confCheckError(eerrors.Errorf("fallback_formats should not contain the format itself: '%s'", format))
+		}
+		formats = append(formats, format)
+	}
+	c.FallbackFormats = strings.Join(formats, ",")
+	return nil
+}
+
+func completeHostname(c *DecoderBaseConfig) error {
+	suffixes := make([]string, 0)
+	for _, suffix := range strings.Split(c.HostnameStripSuffixes, ",") {
+		suffix = strings.Trim(strings.TrimSpace(suffix), ".")
+		if len(suffix) > 0 {
+			suffixes = append(suffixes, "."+suffix)
+		}
+	}
+	c.HostnameStripSuffixes = strings.Join(suffixes, ",")
+	if len(c.HostnameRegex) == 0 {
+		if len(c.HostnameReplace) > 0 {
+			return confCheckError(eerrors.New("hostname_replace requires hostname_regex"))
+		}
+		return nil
+	}
+	_, err := regexp.Compile(c.HostnameRegex)
+	if err != nil {
+		return confCheckError(eerrors.Wrapf(err, "Invalid hostname_regex: '%s'", c.HostnameRegex))
+	}
+	return nil
+}
+
+func completeChecksum(c *DecoderBaseConfig) error {
+	c.Checksum = strings.ToLower(strings.TrimSpace(c.Checksum))
+	switch c.Checksum {
+	case "":
+		c.Checksum = "none"
+	case "none", "sha256", "sha384", "sha512":
+	default:
+		return confCheckError(eerrors.Errorf("Unknown checksum algorithm: '%s'", c.Checksum))
+	}
+	return nil
+}
+
+func completeClockSkew(c *DecoderBaseConfig) error {
+	c.ClockSkewPolicy = strings.ToLower(strings.TrimSpace(c.ClockSkewPolicy))
+	switch c.ClockSkewPolicy {
+	case "":
+		c.ClockSkewPolicy = "none"
+	case "none", "tag", "clamp", "drop":
+	default:
+		return confCheckError(eerrors.Errorf("Unknown clock_skew_policy: '%s'", c.ClockSkewPolicy))
+	}
+	if c.ClockSkewThreshold <= 0 {
+		c.ClockSkewThreshold = 5 * time.Minute
+	}
+	return nil
+}
+
+func completeHeartbeat(c *HeartbeatConfig) error {
+	if c.Interval <= 0 {
+		c.Interval = 30 * time.Second
+	}
+	if c.Interval < time.Second {
+		return confCheckError(eerrors.New("The heartbeat interval must be at least 1s"))
+	}
+	c.AppName = strings.TrimSpace(c.AppName)
+	if len(c.AppName) == 0 {
+		c.AppName = "skewer-heartbeat"
+	}
+	c.MsgID = strings.TrimSpace(c.MsgID)
+	if len(c.MsgID) == 0 {
+		c.MsgID = "HEARTBEAT"
+	}
+	c.Hostname = strings.TrimSpace(c.Hostname)
+	// the fields are written in the RFC5424 header of the heartbeat messages
+	fields := []struct {
+		name   string
+		value  string
+		maxLen int
+	}{
+		{"app_name", c.AppName, 48},
+		{"msgid", c.MsgID, 32},
+		{"hostname", c.Hostname, 255},
+	}
+	for _, f := range fields {
+		if len(f.value) > f.maxLen {
+			return confCheckError(eerrors.Errorf("The heartbeat %s is longer than %d characters", f.name, f.maxLen))
+		}
+		for _, r := range f.value {
+			if r < 33 || r > 126 {
+				return confCheckError(eerrors.Errorf("The heartbeat %s must only contain printable ASCII characters", f.name))
+			}
+		}
+	}
+	return nil
+}
+
+func completeIngest(c *IngestSourceConfig) error {
+	if len(c.Directory) == 0 {
+		return confCheckError(eerrors.New("Ingest source directory is empty"))
+	}
+	if !filepath.IsAbs(c.Directory) {
+		return confCheckError(eerrors.Errorf("Ingest source directory must be absolute: %s", c.Directory))
+	}
+	if len(c.StateDirectory) == 0 {
+		return confCheckError(eerrors.Errorf("Ingest source state_directory is empty: %s", c.Directory))
+	}
+	if !filepath.IsAbs(c.StateDirectory) {
+		return confCheckError(eerrors.Errorf("Ingest source state_directory must be absolute: %s", c.StateDirectory))
+	}
+	if len(c.Glob) == 0 {
+		c.Glob = "*"
+	}
+	if c.CheckpointLines <= 0 {
+		c.CheckpointLines = 10000
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package conf
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCompleteBindRetryPeriod(t *testing.T) {
+	tests := []struct {
+		period       time.Duration
+		startTimeout time.Duration
+		expected     time.Duration
+		fails        bool
+	}{
+		{0, time.Minute, 10 * time.Second, false},
+		// the default fits in a short start timeout
+		{0, 8 * time.Second, 4 * time.Second, false},
+		{-1, time.Minute, -1, false},
+		{30 * time.Second, time.Minute, 30 * time.Second, false},
+		{time.Minute, time.Minute, 0, true},
+		{2 * time.Minute, time.Minute, 0, true},
+	}
+	for _, test := range tests {
+		period, err := completeBindRetryPeriod(test.period, test.startTimeout)
+		if (err != nil) != test.fails {
+			t.Errorf("%s/%s: unexpected error: %v", test.period, test.startTimeout, err)
+			continue
+		}
+		if err == nil && period != test.expected {
+			t.Errorf("%s/%s: expected %s, got %s", test.period, test.startTimeout, test.expected, period)
+		}
+	}
+}
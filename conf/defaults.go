@@ -22,6 +22,8 @@ func SetDefaults(v *viper.Viper) {
 		SetMetricsDefaults,
 		SetAccountingDefaults,
 		SetMacOSDefaults,
+		SetSyntheticDefaults,
+		SetHeartbeatDefaults,
 		SetMetricsDefaults,
 		SetUdpDestDefaults,
 		SetTcpDestDefaults,
@@ -35,6 +37,7 @@ func SetDefaults(v *viper.Viper) {
 		SetNatsDestDefaults,
 		SetElasticDestDefaults,
 		SetRedisDestDefaults,
+		SetJournalDestDefaults,
 		SetMainDefaults,
 	}
 	for _, f := range funcs {
@@ -55,6 +58,14 @@ func SetRedisDestDefaults(v *viper.Viper, prefixed bool) {
 	v.SetDefault(prefix+"write_timeout", "3s")
 }
 
+func SetJournalDestDefaults(v *viper.Viper, prefixed bool) {
+	prefix := ""
+	if prefixed {
+		prefix = "journal_destination."
+	}
+	v.SetDefault(prefix+"socket_path", "/run/systemd/journal/socket")
+}
+
 func SetElasticDestDefaults(v *viper.Viper, prefixed bool) {
 	prefix := ""
 	if prefixed {
@@ -76,6 +87,8 @@ func SetElasticDestDefaults(v *viper.Viper, prefixed bool) {
 	v.SetDefault(prefix+"format", "json")
 	v.SetDefault(prefix+"create_indices", true)
 	v.SetDefault(prefix+"refresh_interval", "1s")
+	v.SetDefault(prefix+"workers", 1)
+	v.SetDefault(prefix+"worker_queue_size", 64)
 	v.SetDefault(prefix+"check_startup", false)
 	v.SetDefault(prefix+"shards", 1)
 	v.SetDefault(prefix+"replicas", 0)
@@ -144,6 +157,9 @@ func SetHTTPDestDefaults(v *viper.Viper, prefixed bool) {
 	v.SetDefault(prefix+"user_agent", "skewer/"+Version)
 	v.SetDefault(prefix+"method", "POST")
 	v.SetDefault(prefix+"content_type", "auto")
+	v.SetDefault(prefix+"workers", 1)
+	v.SetDefault(prefix+"worker_queue_size", 64)
+	v.SetDefault(prefix+"idempotency_header", "Idempotency-Key")
 }
 
 func SetGraylogDestDefaults(v *viper.Viper, prefixed bool) {
@@ -191,6 +207,9 @@ func SetFileDestDefaults(v *viper.Viper, prefixed bool) {
 	v.SetDefault(prefix+"gzip", false)
 	v.SetDefault(prefix+"gzip_level", 5)
 	v.SetDefault(prefix+"format", "file")
+	v.SetDefault(prefix+"durability", DurabilityNone)
+	v.SetDefault(prefix+"workers", 1)
+	v.SetDefault(prefix+"worker_queue_size", 64)
 }
 
 func SetStderrDestDefaults(v *viper.Viper, prefixed bool) {
@@ -224,6 +243,7 @@ func SetTcpDestDefaults(v *viper.Viper, prefixed bool) {
 	v.SetDefault(prefix+"keepalive_period", "75s")
 	v.SetDefault(prefix+"connection_timeout", "10s")
 	v.SetDefault(prefix+"flush_period", "1s")
+	v.SetDefault(prefix+"durability", DurabilityNone)
 }
 
 func SetMainDefaults(v *viper.Viper, prefixed bool) {
@@ -236,6 +256,30 @@ func SetMainDefaults(v *viper.Viper, prefixed bool) {
 	v.SetDefault(prefix+"input_queue_size", 1024)
 	v.SetDefault(prefix+"destination", "stderr")
 	v.SetDefault(prefix+"encrypt_ipc", true)
+	v.SetDefault(prefix+"max_pipe_message_size", 4194304)
+	v.SetDefault(prefix+"parse_workers", 0)
+	v.SetDefault(prefix+"relp_batch_size", 1)
+	v.SetDefault(prefix+"max_message_age", 0)
+	v.SetDefault(prefix+"log_ratelimit_burst", 10)
+	v.SetDefault(prefix+"log_ratelimit_window", "30s")
+	v.SetDefault(prefix+"dumpable_plugins", []string{})
+	v.SetDefault(prefix+"js_max_stack_depth", 1024)
+	v.SetDefault(prefix+"js_max_duration", "1s")
+	v.SetDefault(prefix+"js_max_memory", 134217728)
+	v.SetDefault(prefix+"plugin_start_timeout", "60s")
+	v.SetDefault(prefix+"plugin_gather_timeout", "2s")
+	v.SetDefault(prefix+"parsed_queue_policy", "block")
+	v.SetDefault(prefix+"parsed_queue_timeout", "1s")
+	v.SetDefault(prefix+"metrics_expiry", 0)
+	v.SetDefault(prefix+"metrics_reset", []string{})
+	v.SetDefault(prefix+"metrics_max_clients", 1000)
+	v.SetDefault(prefix+"metrics_max_topics", 1000)
+	v.SetDefault(prefix+"ordering_check", false)
+	v.SetDefault(prefix+"accept_max_goroutines", 0)
+	v.SetDefault(prefix+"accept_max_memory", 0)
+	v.SetDefault(prefix+"accept_check_interval", "1s")
+	v.SetDefault(prefix+"field_size_metrics", false)
+	v.SetDefault(prefix+"field_size_window", "1m")
 }
 
 func SetAccountingDefaults(v *viper.Viper, prefixed bool) {
@@ -244,6 +288,7 @@ func SetAccountingDefaults(v *viper.Viper, prefixed bool) {
 		prefix = "accounting."
 	}
 	v.SetDefault(prefix+"path", AccountingPath)
+	v.SetDefault(prefix+"fields", "")
 	v.SetDefault(prefix+"period", "1s")
 }
 
@@ -256,13 +301,47 @@ func SetMacOSDefaults(v *viper.Viper, prefixed bool) {
 	v.SetDefault(prefix+"command", "/usr/bin/log")
 }
 
+func SetSyntheticDefaults(v *viper.Viper, prefixed bool) {
+	prefix := ""
+	if prefixed {
+		prefix = "synthetic."
+	}
+	v.SetDefault(prefix+"format", "rfc5424")
+	v.SetDefault(prefix+"rate", 1000)
+	v.SetDefault(prefix+"min_size", 64)
+	v.SetDefault(prefix+"max_size", 512)
+	v.SetDefault(prefix+"clients", 100)
+}
+
+func SetHeartbeatDefaults(v *viper.Viper, prefixed bool) {
+	prefix := ""
+	if prefixed {
+		prefix = "heartbeat."
+	}
+	v.SetDefault(prefix+"enabled", false)
+	v.SetDefault(prefix+"interval", "30s")
+	v.SetDefault(prefix+"app_name", "skewer-heartbeat")
+	v.SetDefault(prefix+"msgid", "HEARTBEAT")
+	v.SetDefault(prefix+"hostname", "")
+}
+
 func SetMetricsDefaults(v *viper.Viper, prefixed bool) {
 	prefix := ""
 	if prefixed {
 		prefix = "metrics."
 	}
 	v.SetDefault(prefix+"path", "/metrics")
+	v.SetDefault(prefix+"listeners_path", "/listeners")
+	v.SetDefault(prefix+"errors_path", "/errors")
 	v.SetDefault(prefix+"port", 8080)
+	v.SetDefault(prefix+"pprof", false)
+	v.SetDefault(prefix+"profile_path", "/profile")
+	v.SetDefault(prefix+"transactions_path", "/relp/transactions")
+	v.SetDefault(prefix+"control", false)
+	v.SetDefault(prefix+"pause_path", "/listeners/pause")
+	v.SetDefault(prefix+"resume_path", "/listeners/resume")
+	v.SetDefault(prefix+"seek_path", "/kafka/seek")
+	v.SetDefault(prefix+"drain_path", "/relp/drain")
 }
 
 func SetJournaldDefaults(v *viper.Viper, prefixed bool) {
@@ -305,6 +384,17 @@ func SetKafkaDefaults(v *viper.Viper, prefixed bool) {
 	v.SetDefault(prefix+"producer_timeout", "10s")
 	v.SetDefault(prefix+"compression", "snappy")
 	v.SetDefault(prefix+"partitioner", "hash")
+	v.SetDefault(prefix+"partition_overflow", "hash")
+	v.SetDefault(prefix+"partition_refresh_interval", "1m")
+	v.SetDefault(prefix+"producers", 1)
+	v.SetDefault(prefix+"cluster_id", "primary")
+	v.SetDefault(prefix+"routing", "all")
+	v.SetDefault(prefix+"partition_key_hash", false)
+	v.SetDefault(prefix+"partition_key_salt", "")
+	v.SetDefault(prefix+"key_sd_id", "")
+	v.SetDefault(prefix+"key_sd_param", "")
+	v.SetDefault(prefix+"timestamp_source", "reported")
+	v.SetDefault(prefix+"serialization_buffer_max", 1<<20)
 
 	v.SetDefault(prefix+"format", "json")
 }
@@ -319,4 +409,5 @@ func SetStoreDefaults(v *viper.Viper, prefixed bool) {
 	v.SetDefault(prefix+"value_log_file_size", 64<<20)
 	v.SetDefault(prefix+"batch_size", 5000)
 	v.SetDefault(prefix+"add_missing_msgid", true)
+	v.SetDefault(prefix+"on_child_exit", StoreExitShutdown)
 }
@@ -29,6 +29,42 @@ func deriveDeepCopy(dst, src *BaseConfig) {
 		}
 		copy(dst.FSSource, src.FSSource)
 	}
+	if src.FIFOSource == nil {
+		dst.FIFOSource = nil
+	} else {
+		if dst.FIFOSource != nil {
+			if len(src.FIFOSource) > len(dst.FIFOSource) {
+				if cap(dst.FIFOSource) >= len(src.FIFOSource) {
+					dst.FIFOSource = (dst.FIFOSource)[:len(src.FIFOSource)]
+				} else {
+					dst.FIFOSource = make([]FIFOSourceConfig, len(src.FIFOSource))
+				}
+			} else if len(src.FIFOSource) < len(dst.FIFOSource) {
+				dst.FIFOSource = (dst.FIFOSource)[:len(src.FIFOSource)]
+			}
+		} else {
+			dst.FIFOSource = make([]FIFOSourceConfig, len(src.FIFOSource))
+		}
+		copy(dst.FIFOSource, src.FIFOSource)
+	}
+	if src.IngestSource == nil {
+		dst.IngestSource = nil
+	} else {
+		if dst.IngestSource != nil {
+			if len(src.IngestSource) > len(dst.IngestSource) {
+				if cap(dst.IngestSource) >= len(src.IngestSource) {
+					dst.IngestSource = (dst.IngestSource)[:len(src.IngestSource)]
+				} else {
+					dst.IngestSource = make([]IngestSourceConfig, len(src.IngestSource))
+				}
+			} else if len(src.IngestSource) < len(dst.IngestSource) {
+				dst.IngestSource = (dst.IngestSource)[:len(src.IngestSource)]
+			}
+		} else {
+			dst.IngestSource = make([]IngestSourceConfig, len(src.IngestSource))
+		}
+		copy(dst.IngestSource, src.IngestSource)
+	}
 	if src.TCPSource == nil {
 		dst.TCPSource = nil
 	} else {
@@ -178,7 +214,32 @@ func deriveDeepCopy(dst, src *BaseConfig) {
 	dst.Metrics = src.Metrics
 	dst.Accounting = src.Accounting
 	dst.MacOS = src.MacOS
-	dst.Main = src.Main
+	dst.Synthetic = src.Synthetic
+	dst.Heartbeat = src.Heartbeat
+	dst.GeoIP = src.GeoIP
+	if src.Transforms == nil {
+		dst.Transforms = nil
+	} else {
+		if dst.Transforms != nil {
+			if len(src.Transforms) > len(dst.Transforms) {
+				if cap(dst.Transforms) >= len(src.Transforms) {
+					dst.Transforms = (dst.Transforms)[:len(src.Transforms)]
+				} else {
+					dst.Transforms = make([]TransformConfig, len(src.Transforms))
+				}
+			} else if len(src.Transforms) < len(dst.Transforms) {
+				dst.Transforms = (dst.Transforms)[:len(src.Transforms)]
+			}
+		} else {
+			dst.Transforms = make([]TransformConfig, len(src.Transforms))
+		}
+		copy(dst.Transforms, src.Transforms)
+	}
+	{
+		field := new(MainConfig)
+		deriveDeepCopy_17(field, &src.Main)
+		dst.Main = *field
+	}
 	if src.KafkaDest == nil {
 		dst.KafkaDest = nil
 	} else {
@@ -204,6 +265,7 @@ func deriveDeepCopy(dst, src *BaseConfig) {
 	deriveDeepCopy_8(field, &src.ElasticDest)
 	dst.ElasticDest = *field
 	dst.RedisDest = src.RedisDest
+	dst.JournalDest = src.JournalDest
 }
 
 // deriveDeepCopy_ recursively copies the contents of src into dst.
@@ -266,14 +328,35 @@ func deriveDeepCopy_6(dst, src *KafkaDestConfig) {
 	deriveDeepCopy_15(field, &src.KafkaBaseConfig)
 	dst.KafkaBaseConfig = *field
 	dst.KafkaProducerBaseConfig = src.KafkaProducerBaseConfig
+	if src.SDHeaders == nil {
+		dst.SDHeaders = nil
+	} else {
+		dst.SDHeaders = make([]KafkaSDHeaderConfig, len(src.SDHeaders))
+		copy(dst.SDHeaders, src.SDHeaders)
+	}
 	dst.TlsBaseConfig = src.TlsBaseConfig
+	dst.JSONOutputConfig = src.JSONOutputConfig
 	dst.Insecure = src.Insecure
 	dst.Format = src.Format
+	dst.Producers = src.Producers
+	dst.ClusterID = src.ClusterID
+	if src.Clusters == nil {
+		dst.Clusters = nil
+	} else {
+		dst.Clusters = make([]KafkaClusterConfig, len(src.Clusters))
+		for i := range src.Clusters {
+			deriveDeepCopy_18(&dst.Clusters[i], &src.Clusters[i])
+		}
+	}
+	dst.Routing = src.Routing
+	dst.RouteField = src.RouteField
+	dst.Quorum = src.Quorum
 }
 
 // deriveDeepCopy_7 recursively copies the contents of src into dst.
 func deriveDeepCopy_7(dst, src *NATSDestConfig) {
 	dst.TlsBaseConfig = src.TlsBaseConfig
+	dst.JSONOutputConfig = src.JSONOutputConfig
 	dst.Insecure = src.Insecure
 	if src.NServers == nil {
 		dst.NServers = nil
@@ -311,6 +394,7 @@ func deriveDeepCopy_7(dst, src *NATSDestConfig) {
 // deriveDeepCopy_8 recursively copies the contents of src into dst.
 func deriveDeepCopy_8(dst, src *ElasticDestConfig) {
 	dst.TlsBaseConfig = src.TlsBaseConfig
+	dst.JSONOutputConfig = src.JSONOutputConfig
 	dst.Insecure = src.Insecure
 	dst.ProxyURL = src.ProxyURL
 	dst.ConnTimeout = src.ConnTimeout
@@ -352,6 +436,8 @@ func deriveDeepCopy_8(dst, src *ElasticDestConfig) {
 	dst.CheckStartup = src.CheckStartup
 	dst.NShards = src.NShards
 	dst.NReplicas = src.NReplicas
+	dst.Workers = src.Workers
+	dst.WorkerQueueSize = src.WorkerQueueSize
 }
 
 // deriveDeepCopy_9 recursively copies the contents of src into dst.
@@ -365,6 +451,39 @@ func deriveDeepCopy_9(dst, src *TCPSourceConfig) {
 	dst.ClientAuthType = src.ClientAuthType
 	dst.LineFraming = src.LineFraming
 	dst.FrameDelimiter = src.FrameDelimiter
+	dst.OctetCounting = src.OctetCounting
+	dst.OrderedParsing = src.OrderedParsing
+	dst.ClientIDOffer = src.ClientIDOffer
+	if src.OpenOffers == nil {
+		dst.OpenOffers = nil
+	} else {
+		dst.OpenOffers = make([]string, len(src.OpenOffers))
+		copy(dst.OpenOffers, src.OpenOffers)
+	}
+	dst.ReplayGracePeriod = src.ReplayGracePeriod
+	dst.MaxPendingAnswers = src.MaxPendingAnswers
+	dst.EmptyFrames = src.EmptyFrames
+	dst.OfferMismatch = src.OfferMismatch
+	if src.ClientCAFiles == nil {
+		dst.ClientCAFiles = nil
+	} else {
+		dst.ClientCAFiles = make([]string, len(src.ClientCAFiles))
+		copy(dst.ClientCAFiles, src.ClientCAFiles)
+	}
+	dst.CertReloadInterval = src.CertReloadInterval
+	dst.CRLFile = src.CRLFile
+	dst.RevocationPolicy = src.RevocationPolicy
+	dst.MaxTLSHandshakes = src.MaxTLSHandshakes
+	dst.TLSHandshakeTimeout = src.TLSHandshakeTimeout
+	dst.TLSHandshakeWait = src.TLSHandshakeWait
+	dst.MaxConnections = src.MaxConnections
+	dst.EvictIdle = src.EvictIdle
+	dst.NoDelay = src.NoDelay
+	dst.Decompress = src.Decompress
+	dst.BackpressureHigh = src.BackpressureHigh
+	dst.BackpressureLow = src.BackpressureLow
+	dst.EndToEndAck = src.EndToEndAck
+	dst.EndToEndAckTimeout = src.EndToEndAckTimeout
 	dst.ConfID = src.ConfID
 }
 
@@ -389,6 +508,39 @@ func deriveDeepCopy_11(dst, src *RELPSourceConfig) {
 	dst.ClientAuthType = src.ClientAuthType
 	dst.LineFraming = src.LineFraming
 	dst.FrameDelimiter = src.FrameDelimiter
+	dst.OctetCounting = src.OctetCounting
+	dst.OrderedParsing = src.OrderedParsing
+	dst.ClientIDOffer = src.ClientIDOffer
+	if src.OpenOffers == nil {
+		dst.OpenOffers = nil
+	} else {
+		dst.OpenOffers = make([]string, len(src.OpenOffers))
+		copy(dst.OpenOffers, src.OpenOffers)
+	}
+	dst.ReplayGracePeriod = src.ReplayGracePeriod
+	dst.MaxPendingAnswers = src.MaxPendingAnswers
+	dst.EmptyFrames = src.EmptyFrames
+	dst.OfferMismatch = src.OfferMismatch
+	if src.ClientCAFiles == nil {
+		dst.ClientCAFiles = nil
+	} else {
+		dst.ClientCAFiles = make([]string, len(src.ClientCAFiles))
+		copy(dst.ClientCAFiles, src.ClientCAFiles)
+	}
+	dst.CertReloadInterval = src.CertReloadInterval
+	dst.CRLFile = src.CRLFile
+	dst.RevocationPolicy = src.RevocationPolicy
+	dst.MaxTLSHandshakes = src.MaxTLSHandshakes
+	dst.TLSHandshakeTimeout = src.TLSHandshakeTimeout
+	dst.TLSHandshakeWait = src.TLSHandshakeWait
+	dst.MaxConnections = src.MaxConnections
+	dst.EvictIdle = src.EvictIdle
+	dst.NoDelay = src.NoDelay
+	dst.Decompress = src.Decompress
+	dst.BackpressureHigh = src.BackpressureHigh
+	dst.BackpressureLow = src.BackpressureLow
+	dst.EndToEndAck = src.EndToEndAck
+	dst.EndToEndAckTimeout = src.EndToEndAckTimeout
 	dst.ConfID = src.ConfID
 }
 
@@ -403,6 +555,39 @@ func deriveDeepCopy_12(dst, src *DirectRELPSourceConfig) {
 	dst.ClientAuthType = src.ClientAuthType
 	dst.LineFraming = src.LineFraming
 	dst.FrameDelimiter = src.FrameDelimiter
+	dst.OctetCounting = src.OctetCounting
+	dst.OrderedParsing = src.OrderedParsing
+	dst.ClientIDOffer = src.ClientIDOffer
+	if src.OpenOffers == nil {
+		dst.OpenOffers = nil
+	} else {
+		dst.OpenOffers = make([]string, len(src.OpenOffers))
+		copy(dst.OpenOffers, src.OpenOffers)
+	}
+	dst.ReplayGracePeriod = src.ReplayGracePeriod
+	dst.MaxPendingAnswers = src.MaxPendingAnswers
+	dst.EmptyFrames = src.EmptyFrames
+	dst.OfferMismatch = src.OfferMismatch
+	if src.ClientCAFiles == nil {
+		dst.ClientCAFiles = nil
+	} else {
+		dst.ClientCAFiles = make([]string, len(src.ClientCAFiles))
+		copy(dst.ClientCAFiles, src.ClientCAFiles)
+	}
+	dst.CertReloadInterval = src.CertReloadInterval
+	dst.CRLFile = src.CRLFile
+	dst.RevocationPolicy = src.RevocationPolicy
+	dst.MaxTLSHandshakes = src.MaxTLSHandshakes
+	dst.TLSHandshakeTimeout = src.TLSHandshakeTimeout
+	dst.TLSHandshakeWait = src.TLSHandshakeWait
+	dst.MaxConnections = src.MaxConnections
+	dst.EvictIdle = src.EvictIdle
+	dst.NoDelay = src.NoDelay
+	dst.Decompress = src.Decompress
+	dst.BackpressureHigh = src.BackpressureHigh
+	dst.BackpressureLow = src.BackpressureLow
+	dst.EndToEndAck = src.EndToEndAck
+	dst.EndToEndAckTimeout = src.EndToEndAckTimeout
 	dst.ConfID = src.ConfID
 }
 
@@ -509,4 +694,85 @@ func deriveDeepCopy_16(dst, src *ListenersConfig) {
 	dst.KeepAlive = src.KeepAlive
 	dst.KeepAlivePeriod = src.KeepAlivePeriod
 	dst.Timeout = src.Timeout
+	dst.ConnectionLog = src.ConnectionLog
+	dst.ConnectionLogSampling = src.ConnectionLogSampling
+	dst.BindInterface = src.BindInterface
+}
+
+// deriveDeepCopy_17 recursively copies the contents of src into dst.
+func deriveDeepCopy_17(dst, src *MainConfig) {
+	dst.InputQueueSize = src.InputQueueSize
+	dst.MaxInputMessageSize = src.MaxInputMessageSize
+	dst.Destination = src.Destination
+	dst.EncryptIPC = src.EncryptIPC
+	dst.MaxPipeMessageSize = src.MaxPipeMessageSize
+	dst.ParseWorkers = src.ParseWorkers
+	dst.RELPBatchSize = src.RELPBatchSize
+	dst.MaxMessageAge = src.MaxMessageAge
+	dst.LogRateLimitBurst = src.LogRateLimitBurst
+	dst.LogRateLimitWindow = src.LogRateLimitWindow
+	if src.DumpablePlugins == nil {
+		dst.DumpablePlugins = nil
+	} else {
+		if dst.DumpablePlugins != nil {
+			if len(src.DumpablePlugins) > len(dst.DumpablePlugins) {
+				if cap(dst.DumpablePlugins) >= len(src.DumpablePlugins) {
+					dst.DumpablePlugins = (dst.DumpablePlugins)[:len(src.DumpablePlugins)]
+				} else {
+					dst.DumpablePlugins = make([]string, len(src.DumpablePlugins))
+				}
+			} else if len(src.DumpablePlugins) < len(dst.DumpablePlugins) {
+				dst.DumpablePlugins = (dst.DumpablePlugins)[:len(src.DumpablePlugins)]
+			}
+		} else {
+			dst.DumpablePlugins = make([]string, len(src.DumpablePlugins))
+		}
+		copy(dst.DumpablePlugins, src.DumpablePlugins)
+	}
+	dst.JSMaxStackDepth = src.JSMaxStackDepth
+	dst.JSMaxDuration = src.JSMaxDuration
+	dst.JSMaxMemory = src.JSMaxMemory
+	dst.PluginStartTimeout = src.PluginStartTimeout
+	dst.PluginGatherTimeout = src.PluginGatherTimeout
+	dst.ParsedQueuePolicy = src.ParsedQueuePolicy
+	dst.ParsedQueueTimeout = src.ParsedQueueTimeout
+	dst.MetricsExpiry = src.MetricsExpiry
+	if src.MetricsReset == nil {
+		dst.MetricsReset = nil
+	} else {
+		dst.MetricsReset = make([]string, len(src.MetricsReset))
+		copy(dst.MetricsReset, src.MetricsReset)
+	}
+	dst.MetricsMaxClients = src.MetricsMaxClients
+	dst.MetricsMaxTopics = src.MetricsMaxTopics
+	dst.OrderingCheck = src.OrderingCheck
+	dst.AcceptMaxGoroutines = src.AcceptMaxGoroutines
+	dst.AcceptMaxMemory = src.AcceptMaxMemory
+	dst.AcceptCheckInterval = src.AcceptCheckInterval
+	dst.FieldSizeMetrics = src.FieldSizeMetrics
+	dst.FieldSizeWindow = src.FieldSizeWindow
+	dst.BindRetryPeriod = src.BindRetryPeriod
+}
+
+// deriveDeepCopy_18 recursively copies the contents of src into dst.
+func deriveDeepCopy_18(dst, src *KafkaClusterConfig) {
+	dst.ID = src.ID
+	if src.Brokers == nil {
+		dst.Brokers = nil
+	} else {
+		dst.Brokers = make([]string, len(src.Brokers))
+		copy(dst.Brokers, src.Brokers)
+	}
+	if src.Topics == nil {
+		dst.Topics = nil
+	} else {
+		dst.Topics = make([]string, len(src.Topics))
+		copy(dst.Topics, src.Topics)
+	}
+	if src.Values == nil {
+		dst.Values = nil
+	} else {
+		dst.Values = make([]string, len(src.Values))
+		copy(dst.Values, src.Values)
+	}
 }
@@ -41,6 +41,10 @@ const (
 	WebsocketServer DestinationType = 1024
 	Elasticsearch   DestinationType = 2048
 	Redis           DestinationType = 4096
+	// Null ACKs the messages without sending them anywhere.
+	Null DestinationType = 8192
+	// Journal writes the messages to the local systemd journal.
+	Journal DestinationType = 16384
 )
 
 var Destinations = map[string]DestinationType{
@@ -57,6 +61,8 @@ var Destinations = map[string]DestinationType{
 	"websocketserver": WebsocketServer,
 	"elasticsearch":   Elasticsearch,
 	"redis":           Redis,
+	"null":            Null,
+	"journal":         Journal,
 }
 
 var DestinationNames = map[DestinationType]string{
@@ -73,6 +79,8 @@ var DestinationNames = map[DestinationType]string{
 	WebsocketServer: "websocketserver",
 	Elasticsearch:   "elasticsearch",
 	Redis:           "redis",
+	Null:            "null",
+	Journal:         "journal",
 }
 
 var RDestinations = map[DestinationType]string{
@@ -89,6 +97,8 @@ var RDestinations = map[DestinationType]string{
 	WebsocketServer: "w",
 	Elasticsearch:   "l",
 	Redis:           "d",
+	Null:            "v",
+	Journal:         "j",
 }
 
 func (m *MainConfig) GetDestinations() (dests DestinationType, err error) {
@@ -111,6 +121,40 @@ func (m *MainConfig) GetDestinations() (dests DestinationType, err error) {
 	return
 }
 
+// Durability levels of the file and TCP destinations.
+const (
+	DurabilityNone  = "none"
+	DurabilityFlush = "flush"
+	DurabilitySync  = "sync"
+)
+
+func checkDurability(durability string) (string, error) {
+	durability = strings.ToLower(strings.TrimSpace(durability))
+	switch durability {
+	case "":
+		return DurabilityNone, nil
+	case DurabilityNone, DurabilityFlush, DurabilitySync:
+		return durability, nil
+	default:
+		return "", confCheckError(eerrors.Errorf("Unknown durability: '%s'", durability))
+	}
+}
+
+func (c *JSONOutputConfig) check() error {
+	c.SD = strings.ToLower(strings.TrimSpace(c.SD))
+	if baseenc.ParseSDLayout(c.SD) == -1 {
+		return confCheckError(eerrors.Errorf("Unknown JSON structured data layout: '%s'", c.SD))
+	}
+	if len(c.SD) == 0 {
+		c.SD = "nested"
+	}
+	c.SDPrefix = strings.TrimSpace(c.SDPrefix)
+	if len(c.SDPrefix) == 0 {
+		c.SDPrefix = "sd"
+	}
+	return nil
+}
+
 func (c *BaseConfig) CheckDestinations() error {
 	// note that Graylog destination does not have a Format option
 	c.UDPDest.Format = strings.TrimSpace(strings.ToLower(c.UDPDest.Format))
@@ -125,6 +169,36 @@ func (c *BaseConfig) CheckDestinations() error {
 	c.ElasticDest.Format = strings.TrimSpace(strings.ToLower(c.ElasticDest.Format))
 	c.RedisDest.Format = strings.TrimSpace(strings.ToLower(c.RedisDest.Format))
 
+	var err error
+	c.FileDest.Durability, err = checkDurability(c.FileDest.Durability)
+	if err != nil {
+		return err
+	}
+	c.TCPDest.Durability, err = checkDurability(c.TCPDest.Durability)
+	if err != nil {
+		return err
+	}
+
+	for _, jsonConf := range []*JSONOutputConfig{
+		&c.UDPDest.JSONOutputConfig,
+		&c.TCPDest.JSONOutputConfig,
+		&c.HTTPDest.JSONOutputConfig,
+		&c.HTTPServerDest.JSONOutputConfig,
+		&c.WebsocketServerDest.JSONOutputConfig,
+		&c.RELPDest.JSONOutputConfig,
+		&c.KafkaDest.JSONOutputConfig,
+		&c.FileDest.JSONOutputConfig,
+		&c.StderrDest.JSONOutputConfig,
+		&c.ElasticDest.JSONOutputConfig,
+		&c.RedisDest.JSONOutputConfig,
+		&c.NATSDest.JSONOutputConfig,
+	} {
+		err = jsonConf.check()
+		if err != nil {
+			return err
+		}
+	}
+
 	for _, frmt := range []string{
 		c.UDPDest.Format,
 		c.TCPDest.Format,
@@ -0,0 +1,51 @@
+package conf
+
+import (
+	"strings"
+
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// pluginNames are the names of the plugins that can be listed in
+// dumpable_plugins: the process names without the "skewer-" prefix.
+var pluginNames = map[string]bool{
+	"tcp":         true,
+	"udp":         true,
+	"relp":        true,
+	"directrelp":  true,
+	"journal":     true,
+	"store":       true,
+	"accounting":  true,
+	"kafkasource": true,
+	"graylog":     true,
+	"files":       true,
+	"httpserver":  true,
+	"macos":       true,
+	"synthetic":   true,
+	"fifo":        true,
+	"heartbeat":   true,
+	"ingest":      true,
+}
+
+// PluginIsDumpable tells if the plugin process named name ("skewer-tcp" or
+// just "tcp") is allowed to produce core dumps.
+func (m *MainConfig) PluginIsDumpable(name string) bool {
+	name = strings.TrimPrefix(name, "skewer-")
+	for _, n := range m.DumpablePlugins {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MainConfig) completeDumpable() error {
+	for i, name := range m.DumpablePlugins {
+		name = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), "skewer-")
+		if !pluginNames[name] {
+			return confCheckError(eerrors.Errorf("Unknown plugin in dumpable_plugins: '%s'", m.DumpablePlugins[i]))
+		}
+		m.DumpablePlugins[i] = name
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package conf
+
+import (
+	"strings"
+
+	sarama "github.com/Shopify/sarama"
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// The routings of the messages among the Kafka clusters.
+const (
+	KafkaRouteAll   = "all"
+	KafkaRouteTopic = "topic"
+	KafkaRouteField = "field"
+)
+
+// CheckClusters normalizes and validates the Kafka clusters and their
+// routing.
+func (c *KafkaDestConfig) CheckClusters() error {
+	c.ClusterID = strings.TrimSpace(c.ClusterID)
+	if c.ClusterID == "" {
+		c.ClusterID = "primary"
+	}
+	c.Routing = strings.ToLower(strings.TrimSpace(c.Routing))
+	c.RouteField = strings.TrimSpace(c.RouteField)
+	switch c.Routing {
+	case "":
+		c.Routing = KafkaRouteAll
+	case KafkaRouteAll, KafkaRouteTopic:
+	case KafkaRouteField:
+		if c.RouteField == "" {
+			return confCheckError(eerrors.New("The field routing needs a route_field"))
+		}
+	default:
+		return confCheckError(eerrors.Errorf("Unknown Kafka routing: '%s'", c.Routing))
+	}
+	ids := map[string]bool{c.ClusterID: true}
+	for i := range c.Clusters {
+		cl := &c.Clusters[i]
+		cl.ID = strings.TrimSpace(cl.ID)
+		if cl.ID == "" {
+			return confCheckError(eerrors.New("A Kafka cluster needs an id"))
+		}
+		if ids[cl.ID] {
+			return confCheckError(eerrors.Errorf("Duplicate Kafka cluster id: '%s'", cl.ID))
+		}
+		ids[cl.ID] = true
+		if len(cl.Brokers) == 0 {
+			return confCheckError(eerrors.Errorf("The Kafka cluster '%s' has no brokers", cl.ID))
+		}
+	}
+	if c.Quorum < 0 || c.Quorum > len(c.Clusters)+1 {
+		return confCheckError(eerrors.Errorf("The Kafka quorum must be between 0 and the number of clusters (%d)", len(c.Clusters)+1))
+	}
+	return nil
+}
+
+// GetAsyncProducers returns a producer for each Kafka cluster, keyed by
+// cluster ID. The additional clusters share the settings of the destination.
+// client is the client of the producer of the main cluster, whose metadata
+// can be refreshed. It must be closed after the producers.
+func (c *KafkaDestConfig) GetAsyncProducers(confined bool) (producers map[string]sarama.AsyncProducer, client sarama.Client, registries map[string]metrics.Registry, err error) {
+	producers = make(map[string]sarama.AsyncProducer, len(c.Clusters)+1)
+	registries = make(map[string]metrics.Registry, len(c.Clusters)+1)
+	closeAll := func() {
+		for _, p := range producers {
+			_ = p.Close()
+		}
+		_ = client.Close()
+	}
+	p, client, registry, err := c.GetAsyncProducerClient(confined)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	producers[c.ClusterID] = p
+	registries[c.ClusterID] = registry
+	for _, cl := range c.Clusters {
+		clusterConf := *c
+		clusterConf.Brokers = cl.Brokers
+		p, registry, err := clusterConf.GetAsyncProducer(confined)
+		if err != nil {
+			closeAll()
+			return nil, nil, nil, eerrors.Wrapf(err, "Failed to connect to the Kafka cluster '%s'", cl.ID)
+		}
+		producers[cl.ID] = p
+		registries[cl.ID] = registry
+	}
+	return producers, client, registries, nil
+}
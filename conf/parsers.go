@@ -0,0 +1,109 @@
+package conf
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// MaxRegexParserGroups is the maximum number of capture groups of a regex
+// parser.
+const MaxRegexParserGroups = 32
+
+// RegexParserFields are the message fields that the groups of a regex parser
+// can fill. facility and severity accept the names and the numbers, priority
+// is the number of the syslog PRI.
+var RegexParserFields = []string{
+	"hostname",
+	"appname",
+	"procid",
+	"msgid",
+	"message",
+	"timereported",
+	"facility",
+	"severity",
+	"priority",
+}
+
+func isRegexParserField(field string) bool {
+	for _, f := range RegexParserFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// CompileRegex compiles the regular expression of a regex parser.
+func (c *ParserConfig) CompileRegex() (*regexp.Regexp, error) {
+	re, err := regexp.Compile(c.Regex)
+	if err != nil {
+		return nil, confCheckError(eerrors.Wrapf(err, "Invalid regex of parser '%s'", c.Name))
+	}
+	if re.NumSubexp() > MaxRegexParserGroups {
+		return nil, confCheckError(eerrors.Errorf(
+			"The regex of parser '%s' has too many groups: %d > %d", c.Name, re.NumSubexp(), MaxRegexParserGroups,
+		))
+	}
+	return re, nil
+}
+
+// RegexFields returns the message field filled by each named group of re. The
+// groups that fill no field are mapped to an empty string: they are set as
+// properties.
+func (c *ParserConfig) RegexFields(re *regexp.Regexp) (map[string]string, error) {
+	groups := make(map[string]string)
+	for _, group := range re.SubexpNames() {
+		if len(group) == 0 {
+			continue
+		}
+		if isRegexParserField(group) {
+			groups[group] = group
+		} else {
+			groups[group] = ""
+		}
+	}
+	if len(groups) == 0 {
+		return nil, confCheckError(eerrors.Errorf("The regex of parser '%s' has no named group", c.Name))
+	}
+	for _, pair := range strings.Split(c.Fields, ",") {
+		pair = strings.TrimSpace(pair)
+		if len(pair) == 0 {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, confCheckError(eerrors.Errorf("Invalid field mapping of parser '%s': '%s'", c.Name, pair))
+		}
+		group, field := strings.TrimSpace(kv[0]), strings.ToLower(strings.TrimSpace(kv[1]))
+		if _, ok := groups[group]; !ok {
+			return nil, confCheckError(eerrors.Errorf("The regex of parser '%s' has no group '%s'", c.Name, group))
+		}
+		if !isRegexParserField(field) {
+			return nil, confCheckError(eerrors.Errorf("Unknown message field for parser '%s': '%s'", c.Name, field))
+		}
+		groups[group] = field
+	}
+	return groups, nil
+}
+
+func (c *ParserConfig) checkRegex() error {
+	re, err := c.CompileRegex()
+	if err != nil {
+		return err
+	}
+	_, err = c.RegexFields(re)
+	if err != nil {
+		return err
+	}
+	c.TimeFormat = strings.TrimSpace(c.TimeFormat)
+	if len(c.TimeFormat) == 0 {
+		c.TimeFormat = time.RFC3339
+	}
+	if c.MaxLength == 0 {
+		c.MaxLength = 65536
+	}
+	return nil
+}
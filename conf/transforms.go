@@ -0,0 +1,54 @@
+package conf
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// The operations of the transformation pipeline.
+const (
+	TransformRename    = "rename"
+	TransformDrop      = "drop"
+	TransformRedact    = "redact"
+	TransformMaskCards = "mask_cards"
+)
+
+// CheckTransforms normalizes and validates the transformation pipeline.
+func (c *BaseConfig) CheckTransforms() error {
+	for i := range c.Transforms {
+		t := &c.Transforms[i]
+		t.Op = strings.ToLower(strings.TrimSpace(t.Op))
+		t.Field = strings.TrimSpace(t.Field)
+		t.To = strings.TrimSpace(t.To)
+		switch t.Op {
+		case TransformRename:
+			if t.Field == "" || t.To == "" {
+				return confCheckError(eerrors.New("The rename transform needs a field and a new name"))
+			}
+		case TransformDrop:
+			if t.Field == "" {
+				return confCheckError(eerrors.New("The drop transform needs a field"))
+			}
+		case TransformRedact:
+			if t.Pattern == "" {
+				return confCheckError(eerrors.New("The redact transform needs a pattern"))
+			}
+			_, err := regexp.Compile(t.Pattern)
+			if err != nil {
+				return confCheckError(eerrors.Wrapf(err, "Invalid redact pattern: '%s'", t.Pattern))
+			}
+		case TransformMaskCards:
+		default:
+			return confCheckError(eerrors.Errorf("Unknown transform: '%s'", t.Op))
+		}
+		if t.Field == "" {
+			t.Field = "message"
+		}
+		if t.Replacement == "" {
+			t.Replacement = "[REDACTED]"
+		}
+	}
+	return nil
+}
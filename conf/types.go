@@ -16,6 +16,8 @@ import (
 // BaseConfig is the root of all configuration parameters.
 type BaseConfig struct {
 	FSSource            []FilesystemSourceConfig  `mapstructure:"fs_source" toml:"fs_source" json:"fs_source"`
+	FIFOSource          []FIFOSourceConfig        `mapstructure:"fifo_source" toml:"fifo_source" json:"fifo_source"`
+	IngestSource        []IngestSourceConfig      `mapstructure:"ingest_source" toml:"ingest_source" json:"ingest_source"`
 	TCPSource           []TCPSourceConfig         `mapstructure:"tcp_source" toml:"tcp_source" json:"tcp_source"`
 	UDPSource           []UDPSourceConfig         `mapstructure:"udp_source" toml:"udp_source" json:"udp_source"`
 	RELPSource          []RELPSourceConfig        `mapstructure:"relp_source" toml:"relp_source" json:"relp_source"`
@@ -29,6 +31,10 @@ type BaseConfig struct {
 	Metrics             MetricsConfig             `mapstructure:"metrics" toml:"metrics" json:"metrics"`
 	Accounting          AccountingSourceConfig    `mapstructure:"accounting" toml:"accounting" json:"accounting"`
 	MacOS               MacOSSourceConfig         `mapstructure:"macos" toml:"macos" json:"macos"`
+	Synthetic           SyntheticSourceConfig     `mapstructure:"synthetic" toml:"synthetic" json:"synthetic"`
+	Heartbeat           HeartbeatConfig           `mapstructure:"heartbeat" toml:"heartbeat" json:"heartbeat"`
+	GeoIP               GeoIPConfig               `mapstructure:"geoip" toml:"geoip" json:"geoip"`
+	Transforms          []TransformConfig         `mapstructure:"transform" toml:"transform" json:"transform"`
 	Main                MainConfig                `mapstructure:"main" toml:"main" json:"main"`
 	KafkaDest           *KafkaDestConfig          `mapstructure:"kafka_destination" toml:"kafka_destination" json:"kafka_destination"`
 	UDPDest             UDPDestConfig             `mapstructure:"udp_destination" toml:"udp_destination" json:"udp_destination"`
@@ -43,6 +49,7 @@ type BaseConfig struct {
 	GraylogDest         GraylogDestConfig         `mapstructure:"graylog_destination" toml:"graylog_destination" json:"graylog_destination"`
 	ElasticDest         ElasticDestConfig         `mapstructure:"elasticsearch_destination" toml:"elasticsearch_destination" json:"elasticsearch_destination"`
 	RedisDest           RedisDestConfig           `mapstructure:"redis_destination" toml:"redis_destination" json:"redis_destination"`
+	JournalDest         JournalDestConfig         `mapstructure:"journal_destination" toml:"journal_destination" json:"journal_destination"`
 }
 
 // MainConfig lists general/global parameters.
@@ -51,11 +58,154 @@ type MainConfig struct {
 	MaxInputMessageSize int    `mapstructure:"max_input_message_size" toml:"max_input_message_size" json:"max_input_message_size"`
 	Destination         string `mapstructure:"destination" toml:"destination" json:"destination"`
 	EncryptIPC          bool   `mapstructure:"encrypt_ipc" toml:"encrypt_ipc" json:"encrypt_ipc"`
+	MaxPipeMessageSize  int    `mapstructure:"max_pipe_message_size" toml:"max_pipe_message_size" json:"max_pipe_message_size"`
+	// ParseWorkers is the number of parse workers of each network source.
+	// The workers share the raw messages queue of the source, whose size is
+	// InputQueueSize. Defaults to the number of CPUs.
+	ParseWorkers int `mapstructure:"parse_workers" toml:"parse_workers" json:"parse_workers"`
+	// RELPBatchSize is the number of raw messages that a RELP connection
+	// pushes to the raw messages queue at once, and that a parse worker pulls
+	// from it at once, so that the queue synchronizations are amortized at
+	// high frame rates. The messages of a connection keep their order. A
+	// batch is pushed as soon as the connection has no more buffered frames.
+	// 1 (default) disables the batching.
+	RELPBatchSize int `mapstructure:"relp_batch_size" toml:"relp_batch_size" json:"relp_batch_size"`
+	// MaxMessageAge is the maximum time between the reception of a message
+	// and its delivery to a destination. Older messages are dropped. 0
+	// disables the expiration.
+	MaxMessageAge time.Duration `mapstructure:"max_message_age" toml:"max_message_age" json:"max_message_age"`
+	// LogRateLimitBurst is the number of identical error logs that the hot
+	// paths emit during LogRateLimitWindow. The next ones are suppressed and
+	// summarized at the end of the window. 0 disables the rate limiting.
+	LogRateLimitBurst  int           `mapstructure:"log_ratelimit_burst" toml:"log_ratelimit_burst" json:"log_ratelimit_burst"`
+	LogRateLimitWindow time.Duration `mapstructure:"log_ratelimit_window" toml:"log_ratelimit_window" json:"log_ratelimit_window"`
+	// DumpablePlugins lists the plugins (e.g. "tcp", "store") whose process
+	// may write core dumps and may be traced. The plugins are non-dumpable by
+	// default, because a core dump exposes the process memory: the messages,
+	// the IPC secrets, and for the store its encryption secret. Only list a
+	// plugin to debug it. This has no effect outside of Linux.
+	DumpablePlugins []string `mapstructure:"dumpable_plugins" toml:"dumpable_plugins" json:"dumpable_plugins"`
+	// JSMaxStackDepth is the maximum call depth of a JS filtering function
+	// (FilterMessages, Topic, PartitionKey, PartitionNumber). JSMaxDuration
+	// is the time that such a function may spend to process one message.
+	// JSMaxMemory is the maximum heap growth, in bytes, while it processes
+	// one message: the heap is shared with the rest of the process, so it
+	// should be well above what a normal call allocates. A function that
+	// exceeds a limit is interrupted, and the message is rejected like on a
+	// processing error. 0 disables a limit.
+	JSMaxStackDepth int           `mapstructure:"js_max_stack_depth" toml:"js_max_stack_depth" json:"js_max_stack_depth"`
+	JSMaxDuration   time.Duration `mapstructure:"js_max_duration" toml:"js_max_duration" json:"js_max_duration"`
+	JSMaxMemory     uint64        `mapstructure:"js_max_memory" toml:"js_max_memory" json:"js_max_memory"`
+	// PluginStartTimeout is the time given to a plugin to report that it has
+	// started. On a loaded host, the plugins may need more.
+	PluginStartTimeout time.Duration `mapstructure:"plugin_start_timeout" toml:"plugin_start_timeout" json:"plugin_start_timeout"`
+	// PluginGatherTimeout is the time given to a plugin to report its metrics.
+	PluginGatherTimeout time.Duration `mapstructure:"plugin_gather_timeout" toml:"plugin_gather_timeout" json:"plugin_gather_timeout"`
+	// ParsedQueuePolicy applies in the DirectRELP source when the queue of
+	// the parsed messages is full because Kafka lags: "block" (default) waits
+	// for room, "nack" waits at most ParsedQueueTimeout and then NACKs the
+	// message, so that the client sends it again later.
+	ParsedQueuePolicy  string        `mapstructure:"parsed_queue_policy" toml:"parsed_queue_policy" json:"parsed_queue_policy"`
+	ParsedQueueTimeout time.Duration `mapstructure:"parsed_queue_timeout" toml:"parsed_queue_timeout" json:"parsed_queue_timeout"`
+	// MetricsExpiry deletes the per client metric series of the plugins
+	// that were not updated for that long, so that the series of the clients
+	// that went away don't accumulate. 0 disables the expiration.
+	MetricsExpiry time.Duration `mapstructure:"metrics_expiry" toml:"metrics_expiry" json:"metrics_expiry"`
+	// MetricsReset lists the per client metric families (e.g.
+	// "skw_relp_answers_total") that are reset each time the configuration
+	// is applied, at start and at reload.
+	MetricsReset []string `mapstructure:"metrics_reset" toml:"metrics_reset" json:"metrics_reset"`
+	// MetricsMaxClients bounds the number of distinct clients of each per
+	// client metric family, and MetricsMaxTopics the number of distinct
+	// topics of the destination metrics: the client identifiers of the RELP
+	// open offers and the topics of the templates are chosen by the clients.
+	// The series beyond the limit are counted with the "_other" label value.
+	// Both default to 1000, and a negative value disables the limit.
+	MetricsMaxClients int `mapstructure:"metrics_max_clients" toml:"metrics_max_clients" json:"metrics_max_clients"`
+	MetricsMaxTopics  int `mapstructure:"metrics_max_topics" toml:"metrics_max_topics" json:"metrics_max_topics"`
+	// OrderingCheck is a debug mode: the stream sources stamp the messages
+	// with a per connection sequence number, and the destinations count the
+	// messages delivered out of order in skw_reordered_messages_total.
+	OrderingCheck bool `mapstructure:"ordering_check" toml:"ordering_check" json:"ordering_check"`
+	// AcceptMaxGoroutines and AcceptMaxMemory throttle the accepts of all
+	// the stream listeners while the process has more goroutines, or more
+	// heap memory (in bytes), than that. The accepts resume when both fall
+	// below 90% of their threshold. The readings are sampled every
+	// AcceptCheckInterval. 0 disables a threshold.
+	AcceptMaxGoroutines int           `mapstructure:"accept_max_goroutines" toml:"accept_max_goroutines" json:"accept_max_goroutines"`
+	AcceptMaxMemory     uint64        `mapstructure:"accept_max_memory" toml:"accept_max_memory" json:"accept_max_memory"`
+	AcceptCheckInterval time.Duration `mapstructure:"accept_check_interval" toml:"accept_check_interval" json:"accept_check_interval"`
+	// FieldSizeMetrics enables the histograms of the sizes of the message,
+	// structured data and hostname of the parsed messages, by listener, and
+	// the gauge of the largest message in the last FieldSizeWindow.
+	FieldSizeMetrics bool          `mapstructure:"field_size_metrics" toml:"field_size_metrics" json:"field_size_metrics"`
+	FieldSizeWindow  time.Duration `mapstructure:"field_size_window" toml:"field_size_window" json:"field_size_window"`
+	// BindRetryPeriod is how long the network sources retry the listen
+	// addresses that are transiently unavailable (still in use after a fast
+	// restart, or not assigned yet) before giving up on them. The retries
+	// happen while the plugins start, so it must be shorter than
+	// PluginStartTimeout. Defaults to 10 seconds, or half of
+	// PluginStartTimeout when that is shorter. A negative value disables the
+	// retries.
+	BindRetryPeriod time.Duration `mapstructure:"bind_retry_period" toml:"bind_retry_period" json:"bind_retry_period"`
 }
 
 type MetricsConfig struct {
-	Path string `mapstructure:"path" toml:"path" json:"path"`
-	Port int    `mapstructure:"port" toml:"port" json:"port"`
+	Path          string `mapstructure:"path" toml:"path" json:"path"`
+	ListenersPath string `mapstructure:"listeners_path" toml:"listeners_path" json:"listeners_path"`
+	// ErrorsPath serves the recent errors of skewer, as JSON.
+	ErrorsPath string `mapstructure:"errors_path" toml:"errors_path" json:"errors_path"`
+	Port       int    `mapstructure:"port" toml:"port" json:"port"`
+	// Pprof enables the net/http/pprof endpoints of the plugin processes,
+	// bound to an ephemeral localhost port, and the ProfilePath endpoint that
+	// collects a profile from a plugin through its control channel. It is
+	// disabled by default, as the profiles disclose the process internals.
+	Pprof       bool   `mapstructure:"pprof" toml:"pprof" json:"pprof"`
+	ProfilePath string `mapstructure:"profile_path" toml:"profile_path" json:"profile_path"`
+	// TransactionsPath serves the transactions in progress of the RELP
+	// connections, as JSON, to debug the clients that do not get their ACKs.
+	TransactionsPath string `mapstructure:"transactions_path" toml:"transactions_path" json:"transactions_path"`
+	// Control enables the endpoints that act on the plugins: PausePath,
+	// ResumePath, SeekPath and DrainPath. They only accept POST requests, and they are
+	// disabled by default.
+	Control bool `mapstructure:"control" toml:"control" json:"control"`
+	// PausePath stops reading new messages on the "listener" of the "plugin"
+	// given as query parameters, and ResumePath restarts reading.
+	PausePath  string `mapstructure:"pause_path" toml:"pause_path" json:"pause_path"`
+	ResumePath string `mapstructure:"resume_path" toml:"resume_path" json:"resume_path"`
+	// SeekPath moves the consumers of the Kafka source, as described by the
+	// JSON seek request in the body.
+	SeekPath string `mapstructure:"seek_path" toml:"seek_path" json:"seek_path"`
+	// DrainPath sends a serverclose to the RELP clients of the "listener" of
+	// the "plugin" given as query parameters, so that they reconnect
+	// elsewhere, e.g. before a restart.
+	DrainPath string `mapstructure:"drain_path" toml:"drain_path" json:"drain_path"`
+}
+
+// GeoIPConfig locates the MaxMind databases used to enrich the messages with
+// the country and the ASN of the client IP. Enrichment is disabled when no
+// database is configured.
+type GeoIPConfig struct {
+	CountryDB string `mapstructure:"country_db" toml:"country_db" json:"country_db"`
+	ASNDB     string `mapstructure:"asn_db" toml:"asn_db" json:"asn_db"`
+}
+
+// TransformConfig is an operation of the transformation pipeline. The
+// operations are applied in order to the messages, before they are stored
+// or sent to Kafka by the Direct RELP source.
+//
+// Field is "message", "appname", "hostname", "procid", "msgid",
+// "structured", or "domain.key" for a property.
+type TransformConfig struct {
+	// Op is "rename", "drop", "redact" or "mask_cards".
+	Op    string `mapstructure:"op" toml:"op" json:"op"`
+	Field string `mapstructure:"field" toml:"field" json:"field"`
+	// To is the new name of the field, for "rename".
+	To string `mapstructure:"to" toml:"to" json:"to"`
+	// Pattern is the regular expression to redact, for "redact".
+	Pattern string `mapstructure:"pattern" toml:"pattern" json:"pattern"`
+	// Replacement replaces the redacted text. Defaults to "[REDACTED]".
+	Replacement string `mapstructure:"replacement" toml:"replacement" json:"replacement"`
 }
 
 type WatcherConfig struct {
@@ -66,6 +216,23 @@ type WatcherConfig struct {
 type ParserConfig struct {
 	Name string `mapstructure:"name" toml:"name" json:"name"`
 	Func string `mapstructure:"func" toml:"func" json:"func"`
+	// Regex defines the parser with a regular expression (RE2 syntax)
+	// instead of a JS Func. The named groups that match a message field
+	// (see RegexParserFields) fill it, the other named groups are set as
+	// properties in the domain of the parser name. Without a message group,
+	// the whole line is the message.
+	Regex string `mapstructure:"regex" toml:"regex" json:"regex"`
+	// Fields maps the groups of Regex to the message fields, as
+	// "group=field" pairs separated by commas, e.g. "host=hostname,prog=appname".
+	Fields string `mapstructure:"fields" toml:"fields" json:"fields"`
+	// TimeFormat is the Go layout of the timereported group. Defaults to
+	// RFC3339.
+	TimeFormat string `mapstructure:"time_format" toml:"time_format" json:"time_format"`
+	// MaxLength bounds the size of the messages matched with Regex. The Go
+	// regular expressions run in linear time, so that the time spent
+	// matching a message is bounded by its size. The longer messages are
+	// rejected. Defaults to 65536 bytes. A negative value disables the limit.
+	MaxLength int `mapstructure:"max_length" toml:"max_length" json:"max_length"`
 }
 
 type StoreConfig struct {
@@ -76,6 +243,31 @@ type StoreConfig struct {
 	Secret           string `mapstructure:"secret" toml:"-" json:"secret"`
 	BatchSize        uint32 `mapstructure:"batch_size" toml:"batch_size" json:"batch_size"`
 	AddMissingMsgID  bool   `mapstructure:"add_missing_msgid" toml:"add_missing_msgid" json:"add_missing_msgid"`
+	OnChildExit      string `mapstructure:"on_child_exit" toml:"on_child_exit" json:"on_child_exit"`
+}
+
+// What to do when the Store process exits unexpectedly. With StoreExitBlock
+// and StoreExitFail, the Store is restarted. With StoreExitBlock, the
+// messages received meanwhile wait for the restart. With StoreExitFail, the
+// plugins refuse them, and the RELP sources NACK them. In both cases, the
+// messages that were already acknowledged to the clients wait for the
+// restart.
+const (
+	StoreExitShutdown = "shutdown"
+	StoreExitBlock    = "block"
+	StoreExitFail     = "fail"
+)
+
+func checkStoreExit(onExit string) (string, error) {
+	onExit = strings.ToLower(strings.TrimSpace(onExit))
+	switch onExit {
+	case "":
+		return StoreExitShutdown, nil
+	case StoreExitShutdown, StoreExitBlock, StoreExitFail:
+		return onExit, nil
+	default:
+		return "", confCheckError(eerrors.Errorf("Unknown on_child_exit behaviour for the Store: '%s'", onExit))
+	}
 }
 
 // the Secret in StoreConfig will be encrypted with the session secret in Complete()
@@ -145,12 +337,66 @@ func (s *StoreConfig) DecryptSecret(m *memguard.LockedBuffer) (locked *memguard.
 	return locked, nil
 }
 
+// JSONOutputConfig tells how the JSON formats of a destination write the
+// structured data: "nested" as the properties object, "flat" as top-level
+// "prefix.domain.param" keys, or "namespace" as "domain.param" keys of a
+// single "prefix" object. The prefix defaults to "sd".
+type JSONOutputConfig struct {
+	SD       string `mapstructure:"json_sd" toml:"json_sd" json:"json_sd"`
+	SDPrefix string `mapstructure:"json_sd_prefix" toml:"json_sd_prefix" json:"json_sd_prefix"`
+}
+
 type KafkaDestConfig struct {
 	KafkaBaseConfig         `mapstructure:",squash"`
 	KafkaProducerBaseConfig `mapstructure:",squash"`
 	TlsBaseConfig           `mapstructure:",squash"`
+	JSONOutputConfig        `mapstructure:",squash"`
 	Insecure                bool   `mapstructure:"insecure" toml:"insecure" json:"insecure"`
 	Format                  string `mapstructure:"format" toml:"format" json:"format"`
+	// Producers is the number of Kafka producers of the Kafka destination,
+	// each with its own connections. The messages are spread among them by
+	// partition key, so that the messages of a key keep their order.
+	Producers int `mapstructure:"producers" toml:"producers" json:"producers"`
+	// ClusterID names the Kafka cluster of Brokers in the metrics and in
+	// the routing. Defaults to "primary" (direct RELP only).
+	ClusterID string `mapstructure:"cluster_id" toml:"cluster_id" json:"cluster_id"`
+	// Clusters are additional Kafka clusters, e.g. a disaster recovery
+	// cluster. Each cluster has its own producer, with the settings of the
+	// destination (direct RELP only).
+	Clusters []KafkaClusterConfig `mapstructure:"clusters" toml:"clusters" json:"clusters"`
+	// Routing selects the clusters of a message: "all" (default) sends the
+	// message to every cluster, "topic" and "field" send it to the clusters
+	// whose Topics or Values match the topic of the message or the value of
+	// RouteField, or to the primary cluster when no cluster matches (direct
+	// RELP only).
+	Routing string `mapstructure:"routing" toml:"routing" json:"routing"`
+	// RouteField is the field of the "field" routing: a syslog field
+	// (appname, hostname...) or a "domain.key" property.
+	RouteField string `mapstructure:"route_field" toml:"route_field" json:"route_field"`
+	// Quorum is the number of clusters that must acknowledge a message
+	// sent to all the clusters, before the client gets a success. Defaults
+	// to 0: all the clusters.
+	Quorum int `mapstructure:"quorum" toml:"quorum" json:"quorum"`
+}
+
+// KafkaSDHeaderConfig promotes the structured data field SDParam of SDID to
+// the Kafka record header Header. Header defaults to SDParam. The header is
+// absent when the message does not have the field.
+type KafkaSDHeaderConfig struct {
+	SDID    string `mapstructure:"sd_id" toml:"sd_id" json:"sd_id"`
+	SDParam string `mapstructure:"sd_param" toml:"sd_param" json:"sd_param"`
+	Header  string `mapstructure:"header" toml:"header" json:"header"`
+}
+
+// KafkaClusterConfig is an additional Kafka cluster of the Kafka destination.
+type KafkaClusterConfig struct {
+	ID      string   `mapstructure:"id" toml:"id" json:"id"`
+	Brokers []string `mapstructure:"brokers" toml:"brokers" json:"brokers"`
+	// Topics are the topics routed to the cluster by the "topic" routing.
+	Topics []string `mapstructure:"topics" toml:"topics" json:"topics"`
+	// Values are the values of the route field routed to the cluster by the
+	// "field" routing.
+	Values []string `mapstructure:"values" toml:"values" json:"values"`
 }
 
 type KafkaBaseConfig struct {
@@ -181,17 +427,58 @@ type KafkaConsumerBaseConfig struct {
 }
 
 type KafkaProducerBaseConfig struct {
-	MessageBytesMax  int           `mapstructure:"message_bytes_max" toml:"message_bytes_max" json:"message_bytes_max"`
-	RequiredAcks     int16         `mapstructure:"required_acks" toml:"required_acks" json:"required_acks"`
-	ProducerTimeout  time.Duration `mapstructure:"producer_timeout" toml:"producer_timeout" json:"producer_timeout"`
-	Compression      string        `mapstructure:"compression" toml:"compression" json:"compression"`
-	Partitioner      string        `mapstructure:"partitioner" toml:"partitioner" json:"partitioner"`
-	FlushBytes       int           `mapstructure:"flush_bytes" toml:"flush_bytes" json:"flush_bytes"`
-	FlushMessages    int           `mapstructure:"flush_messages" toml:"flush_messages" json:"flush_messages"`
-	FlushFrequency   time.Duration `mapstructure:"flush_frequency" toml:"flush_frequency" json:"flush_frequency"`
-	FlushMessagesMax int           `mapstructure:"flush_messages_max" toml:"flush_messages_max" json:"flush_messages_max"`
-	RetrySendMax     int           `mapstructure:"retry_send_max" toml:"retry_send_max" json:"retry_send_max"`
-	RetrySendBackoff time.Duration `mapstructure:"retry_send_backoff" toml:"retry_send_backoff" json:"retry_send_backoff"`
+	MessageBytesMax int           `mapstructure:"message_bytes_max" toml:"message_bytes_max" json:"message_bytes_max"`
+	RequiredAcks    int16         `mapstructure:"required_acks" toml:"required_acks" json:"required_acks"`
+	ProducerTimeout time.Duration `mapstructure:"producer_timeout" toml:"producer_timeout" json:"producer_timeout"`
+	Compression     string        `mapstructure:"compression" toml:"compression" json:"compression"`
+	Partitioner     string        `mapstructure:"partitioner" toml:"partitioner" json:"partitioner"`
+	// PartitionOverflow is applied by the manual partitioner when the computed
+	// partition number does not exist: "hash", "clamp", "mod" or "error".
+	PartitionOverflow string        `mapstructure:"partition_overflow" toml:"partition_overflow" json:"partition_overflow"`
+	FlushBytes        int           `mapstructure:"flush_bytes" toml:"flush_bytes" json:"flush_bytes"`
+	FlushMessages     int           `mapstructure:"flush_messages" toml:"flush_messages" json:"flush_messages"`
+	FlushFrequency    time.Duration `mapstructure:"flush_frequency" toml:"flush_frequency" json:"flush_frequency"`
+	FlushMessagesMax  int           `mapstructure:"flush_messages_max" toml:"flush_messages_max" json:"flush_messages_max"`
+	RetrySendMax      int           `mapstructure:"retry_send_max" toml:"retry_send_max" json:"retry_send_max"`
+	RetrySendBackoff  time.Duration `mapstructure:"retry_send_backoff" toml:"retry_send_backoff" json:"retry_send_backoff"`
+
+	// PartitionRefreshInterval is the period of the refresh of the partition
+	// counts of the topics of the Kafka destination from the cluster
+	// metadata, so that the added partitions are used without a restart.
+	// The counts are given to the partition number functions, and are only
+	// fetched when such a function is configured. The Direct RELP sources
+	// use the counts of the main cluster. 0 disables the refresh.
+	PartitionRefreshInterval time.Duration `mapstructure:"partition_refresh_interval" toml:"partition_refresh_interval" json:"partition_refresh_interval"`
+
+	// PartitionKeyHash makes the hash partitioner spread the keys with a
+	// well mixed hash of PartitionKeySalt and the key, instead of FNV-1a.
+	PartitionKeyHash bool   `mapstructure:"partition_key_hash" toml:"partition_key_hash" json:"partition_key_hash"`
+	PartitionKeySalt string `mapstructure:"partition_key_salt" toml:"partition_key_salt" json:"partition_key_salt"`
+	// KeySDID and KeySDParam name a structured data field. When the field is
+	// present in a message, its value is the Kafka key, instead of the result
+	// of the partition key function or template.
+	KeySDID    string `mapstructure:"key_sd_id" toml:"key_sd_id" json:"key_sd_id"`
+	KeySDParam string `mapstructure:"key_sd_param" toml:"key_sd_param" json:"key_sd_param"`
+	// SDHeaders promote structured data fields to Kafka record headers, so
+	// that the consumers can filter the records without decoding them. They
+	// need Kafka 0.11 or later.
+	SDHeaders []KafkaSDHeaderConfig `mapstructure:"sd_headers" toml:"sd_headers" json:"sd_headers"`
+	// TimestampSource selects the time of the message that becomes the
+	// timestamp of the Kafka record: "reported" (default) by the client,
+	// "received" by skewer, or "generated" when the message was parsed.
+	TimestampSource string `mapstructure:"timestamp_source" toml:"timestamp_source" json:"timestamp_source"`
+	// RetriesHeader names the Kafka record header that carries the number
+	// of times the message was sent again after a NACK. The header is only
+	// set on the retried messages. Empty (default) disables it.
+	RetriesHeader string `mapstructure:"retries_header" toml:"retries_header" json:"retries_header"`
+	// ChecksumHeader names the Kafka record header that carries the checksum
+	// of the raw message (see DecoderBaseConfig.Checksum). Empty (default)
+	// disables it.
+	ChecksumHeader string `mapstructure:"checksum_header" toml:"checksum_header" json:"checksum_header"`
+	// SerializationBufferMax is the largest JSON serialization buffer, in
+	// bytes, that is kept to serialize the next messages. Larger messages
+	// are serialized in a buffer of their own. 0 disables the reuse.
+	SerializationBufferMax int `mapstructure:"serialization_buffer_max" toml:"serialization_buffer_max" json:"serialization_buffer_max"`
 }
 
 type GraylogDestConfig struct {
@@ -210,6 +497,8 @@ type TcpUdpRelpDestBaseConfig struct {
 	UnixSocketPath string        `mapstructure:"unix_socket_path" toml:"unix_socket_path" json:"unix_socket_path"`
 	Rebind         time.Duration `mapstructure:"rebind" toml:"rebind" json:"rebind"`
 	Format         string        `mapstructure:"format" toml:"format" json:"format"`
+
+	JSONOutputConfig `mapstructure:",squash"`
 }
 
 type UDPDestConfig struct {
@@ -237,6 +526,12 @@ type TCPDestConfig struct {
 	KeepAlivePeriod          time.Duration `mapstructure:"keepalive_period" toml:"keepalive_period" json:"keepalive_period"`
 	ConnTimeout              time.Duration `mapstructure:"connection_timeout" toml:"connection_timeout" json:"connection_timeout"`
 	FlushPeriod              time.Duration `mapstructure:"flush_period" toml:"flush_period" json:"flush_period"`
+	// Durability tells when the messages are acknowledged: "none" when they
+	// are written to the buffer, "flush" when the buffer has been written to
+	// the socket at the end of each batch, "sync" when the peer has
+	// acknowledged the batch at the TCP level. The stronger levels lower the
+	// throughput, as each batch waits for the network.
+	Durability string `mapstructure:"durability" toml:"durability" json:"durability"`
 
 	LineFraming    bool  `mapstructure:"line_framing" toml:"line_framing" json:"line_framing"`
 	FrameDelimiter uint8 `mapstructure:"delimiter" toml:"delimiter" json:"delimiter"`
@@ -248,6 +543,8 @@ type HTTPServerDestConfig struct {
 	TlsBaseConfig  `mapstructure:",squash"`
 	ClientAuthType string `mapstructure:"client_auth_type" toml:"client_auth_type" json:"client_auth_type"`
 
+	JSONOutputConfig `mapstructure:",squash"`
+
 	Port int `mapstructure:"port" toml:"port" json:"port"`
 
 	// format can be empty if the format should be inferred by the accepted mimetypes sent by the client
@@ -263,10 +560,13 @@ type WebsocketServerDestConfig struct {
 	Format      string `mapstructure:"format" toml:"format" json:"format"`
 	LogEndPoint string `mapstructure:"log_endpoint" toml:"log_endpoint" json:"log_endpoint"`
 	WebEndPoint string `mapstructure:"web_endpoint" toml:"web_endpoint" json:"web_endpoint"`
+
+	JSONOutputConfig `mapstructure:",squash"`
 }
 
 type ElasticDestConfig struct {
 	TlsBaseConfig       `mapstructure:",squash"`
+	JSONOutputConfig    `mapstructure:",squash"`
 	Insecure            bool          `mapstructure:"insecure" toml:"insecure" json:"insecure"`
 	ProxyURL            string        `mapstructure:"proxy_url" toml:"proxy_url" json:"proxy_url"`
 	ConnTimeout         time.Duration `mapstructure:"connection_timeout" toml:"connection_timeout" json:"connection_timeout"`
@@ -293,6 +593,11 @@ type ElasticDestConfig struct {
 	CheckStartup    bool          `mapstructure:"check_startup" toml:"check_startup" json:"check_startup"`
 	NShards         uint          `mapstructure:"shards" toml:"shards" json:"shards"`
 	NReplicas       uint          `mapstructure:"replicas" toml:"replicas" json:"replicas"`
+	// Workers is the number of goroutines that hand the messages to the bulk
+	// processor. The messages with the same partition key, or else the same
+	// hostname, are handled by the same worker, in order.
+	Workers         int    `mapstructure:"workers" toml:"workers" json:"workers"`
+	WorkerQueueSize uint64 `mapstructure:"worker_queue_size" toml:"worker_queue_size" json:"worker_queue_size"`
 }
 
 type RedisDestConfig struct {
@@ -307,10 +612,18 @@ type RedisDestConfig struct {
 	DialTimeout   time.Duration `mapstructure:"dial_timeout" toml:"dial_timeout" json:"dial_timeout"`
 	ReadTimeout   time.Duration `mapstructure:"read_timeout" toml:"read_timeout" json:"read_timeout"`
 	WriteTimeout  time.Duration `mapstructure:"write_timeout" toml:"write_timeout" json:"write_timeout"`
+
+	JSONOutputConfig `mapstructure:",squash"`
+}
+
+type JournalDestConfig struct {
+	// SocketPath is the native protocol socket of systemd-journald.
+	SocketPath string `mapstructure:"socket_path" toml:"socket_path" json:"socket_path"`
 }
 
 type HTTPDestConfig struct {
 	TlsBaseConfig       `mapstructure:",squash"`
+	JSONOutputConfig    `mapstructure:",squash"`
 	Insecure            bool          `mapstructure:"insecure" toml:"insecure" json:"insecure"`
 	URL                 string        `mapstructure:"url" toml:"url" json:"url"`
 	Method              string        `mapstructure:"method" toml:"method" json:"method"`
@@ -328,10 +641,18 @@ type HTTPDestConfig struct {
 	Password            string        `mapstructure:"password" toml:"password" json:"password"`
 	UserAgent           string        `mapstructure:"user_agent" toml:"user_agent" json:"user_agent"`
 	ContentType         string        `mapstructure:"content_type" toml:"content_type" json:"content_type"`
+	Workers             int           `mapstructure:"workers" toml:"workers" json:"workers"`
+	WorkerQueueSize     uint64        `mapstructure:"worker_queue_size" toml:"worker_queue_size" json:"worker_queue_size"`
+	// IdempotencyHeader is the request header that carries the UID of the
+	// message, so that the server can discard the messages that are sent
+	// again after a failure. Defaults to "Idempotency-Key", and an empty
+	// value disables the header.
+	IdempotencyHeader string `mapstructure:"idempotency_header" toml:"idempotency_header" json:"idempotency_header"`
 }
 
 type NATSDestConfig struct {
 	TlsBaseConfig    `mapstructure:",squash"`
+	JSONOutputConfig `mapstructure:",squash"`
 	Insecure         bool          `mapstructure:"insecure" toml:"insecure" json:"insecure"`
 	NServers         []string      `mapstructure:"servers" toml:"servers" json:"servers"`
 	Format           string        `mapstructure:"format" toml:"format" json:"format"`
@@ -359,10 +680,24 @@ type FileDestConfig struct {
 	Gzip            bool          `mapstructure:"gzip" toml:"gzip" json:"gzip"`
 	GzipLevel       int           `mapstructure:"gzip_level" toml:"gzip_level" json:"gzip_level"`
 	Format          string        `mapstructure:"format" toml:"format" json:"format"`
+	// Durability tells when the messages are acknowledged: "none" when they
+	// are written to the buffer, "flush" when the buffers have been written
+	// to the files at the end of each batch, "sync" when the files have been
+	// fsynced. "sync" costs an fsync per file per batch, and lowers the
+	// throughput a lot on slow disks.
+	Durability string `mapstructure:"durability" toml:"durability" json:"durability"`
+	// Workers is the number of goroutines that write the messages, with
+	// Durability "none". The messages with the same partition key, or else
+	// the same hostname, are written by the same worker, in order.
+	Workers         int    `mapstructure:"workers" toml:"workers" json:"workers"`
+	WorkerQueueSize uint64 `mapstructure:"worker_queue_size" toml:"worker_queue_size" json:"worker_queue_size"`
+
+	JSONOutputConfig `mapstructure:",squash"`
 }
 
 type StderrDestConfig struct {
-	Format string `mapstructure:"format" toml:"format" json:"format"`
+	Format           string `mapstructure:"format" toml:"format" json:"format"`
+	JSONOutputConfig `mapstructure:",squash"`
 }
 
 type FilterSubConfig struct {
@@ -372,6 +707,10 @@ type FilterSubConfig struct {
 	PartitionFunc       string `mapstructure:"partition_key_func" toml:"partition_key_func" json:"partition_key_func"`
 	PartitionNumberFunc string `mapstructure:"partition_number_func" toml:"partition_number_func" json:"partition_number_func"`
 	FilterFunc          string `mapstructure:"filter_func" toml:"filter_func" json:"filter_func"`
+	// QuarantineTopic is the topic of the quarantined messages, instead of
+	// the topic of the templates. It is omitted from the JSON export when
+	// empty, so that the configuration IDs do not change.
+	QuarantineTopic string `mapstructure:"quarantine_topic" toml:"quarantine_topic" json:"quarantine_topic,omitempty"`
 }
 
 type JournaldConfig struct {
@@ -402,6 +741,13 @@ type AccountingSourceConfig struct {
 	Period          time.Duration `mapstructure:"period" toml:"period" json:"period"`
 	Path            string        `mapstructure:"path" toml:"path" json:"path"`
 	Enabled         bool          `mapstructure:"enabled" toml:"enabled" json:"enabled"`
+	// Fields maps the attributes of the accounting records to the message
+	// fields, as "field=attribute" pairs, such as "appname=comm, procid=pid,
+	// message=summary". The mapping is empty by default. The fields that are
+	// not mapped keep their defaults: the local hostname, "accounting" as
+	// appname, and the JSON record as message. The resource usage is always
+	// in the "accounting" structured data.
+	Fields string `mapstructure:"fields" toml:"fields" json:"fields"`
 }
 
 func (c *AccountingSourceConfig) FilterConf() *FilterSubConfig {
@@ -420,6 +766,68 @@ func (c *AccountingSourceConfig) DefaultPort() int {
 	return 0
 }
 
+// SyntheticSourceConfig configures the synthetic message generator. It is
+// only meant for load testing.
+type SyntheticSourceConfig struct {
+	FilterSubConfig   `mapstructure:",squash"`
+	DecoderBaseConfig `mapstructure:",squash"`
+	ConfID            utils.MyULID `mapstructure:"-" toml:"-" json:"conf_id"`
+	Enabled           bool         `mapstructure:"enabled" toml:"enabled" json:"enabled"`
+	Rate              int          `mapstructure:"rate" toml:"rate" json:"rate"`
+	MinSize           int          `mapstructure:"min_size" toml:"min_size" json:"min_size"`
+	MaxSize           int          `mapstructure:"max_size" toml:"max_size" json:"max_size"`
+	Clients           int          `mapstructure:"clients" toml:"clients" json:"clients"`
+}
+
+// HeartbeatConfig configures the heartbeat source. It periodically injects
+// a recognizable RFC5424 message, that is parsed, filtered and routed like
+// any other message, so that an external check can verify that the whole
+// pipeline is alive. The messages carry a sequence number in the standard
+// [meta sequenceId] structured data element, and their TIMESTAMP is the
+// generation time.
+type HeartbeatConfig struct {
+	FilterSubConfig `mapstructure:",squash"`
+	ConfID          utils.MyULID  `mapstructure:"-" toml:"-" json:"conf_id"`
+	Enabled         bool          `mapstructure:"enabled" toml:"enabled" json:"enabled"`
+	Interval        time.Duration `mapstructure:"interval" toml:"interval" json:"interval"`
+	AppName         string        `mapstructure:"app_name" toml:"app_name" json:"app_name"`
+	MsgID           string        `mapstructure:"msgid" toml:"msgid" json:"msgid"`
+	// Hostname defaults to the hostname of the machine.
+	Hostname string `mapstructure:"hostname" toml:"hostname" json:"hostname"`
+}
+
+func (c *HeartbeatConfig) FilterConf() *FilterSubConfig {
+	return &c.FilterSubConfig
+}
+
+func (c *HeartbeatConfig) ListenersConf() *ListenersConfig {
+	return nil
+}
+
+func (c *HeartbeatConfig) DecoderConf() *DecoderBaseConfig {
+	return nil
+}
+
+func (c *HeartbeatConfig) DefaultPort() int {
+	return 0
+}
+
+func (c *SyntheticSourceConfig) FilterConf() *FilterSubConfig {
+	return &c.FilterSubConfig
+}
+
+func (c *SyntheticSourceConfig) ListenersConf() *ListenersConfig {
+	return nil
+}
+
+func (c *SyntheticSourceConfig) DecoderConf() *DecoderBaseConfig {
+	return &c.DecoderBaseConfig
+}
+
+func (c *SyntheticSourceConfig) DefaultPort() int {
+	return 0
+}
+
 type MacOSSourceConfig struct {
 	FilterSubConfig `mapstructure:",squash"`
 	ConfID          utils.MyULID `mapstructure:"-" toml:"-" json:"conf_id"`
@@ -450,6 +858,58 @@ type DecoderBaseConfig struct {
 	Format    string `mapstructure:"format" toml:"format" json:"format"`
 	Charset   string `mapstructure:"charset" toml:"charset" json:"charset"`
 	W3CFields string `mapstructure:"w3c_fields" toml:"w3c_fields" json:"fields"`
+	// ClockSkewPolicy is applied when TimeReported deviates from the
+	// receive time by more than ClockSkewThreshold: "none", "tag", "clamp"
+	// or "drop".
+	ClockSkewPolicy    string        `mapstructure:"clock_skew_policy" toml:"clock_skew_policy" json:"clock_skew_policy"`
+	ClockSkewThreshold time.Duration `mapstructure:"clock_skew_threshold" toml:"clock_skew_threshold" json:"clock_skew_threshold"`
+	// SkipSDIDs is a comma separated list of the structured data elements
+	// that the RFC5424 decoder should skip. KeepSDIDs conversely lists the
+	// only elements that should be parsed.
+	SkipSDIDs string `mapstructure:"skip_sd_ids" toml:"skip_sd_ids" json:"skip_sd_ids"`
+	KeepSDIDs string `mapstructure:"keep_sd_ids" toml:"keep_sd_ids" json:"keep_sd_ids"`
+	// SDDuplicatePolicy decides the value of a SD param that appears several
+	// times in the same element: "last" (default) keeps the last value,
+	// "first" the first one, and "array" keeps all of them as a JSON array of
+	// strings. The params that appear once are not affected.
+	SDDuplicatePolicy string `mapstructure:"sd_duplicate_policy" toml:"sd_duplicate_policy" json:"sd_duplicate_policy"`
+	// The hostname of the parsed messages is normalized by the following
+	// options, applied in this order. HostnameStripSuffixes is a comma
+	// separated list of domain suffixes, HostnameShort only keeps the first
+	// label, and HostnameRegex is replaced by HostnameReplace. When
+	// HostnameKeepOriginal is set, the original hostname is kept in the
+	// skewer.original_hostname property.
+	HostnameStripTrailingDot bool   `mapstructure:"hostname_strip_trailing_dot" toml:"hostname_strip_trailing_dot" json:"hostname_strip_trailing_dot"`
+	HostnameLowercase        bool   `mapstructure:"hostname_lowercase" toml:"hostname_lowercase" json:"hostname_lowercase"`
+	HostnameStripSuffixes    string `mapstructure:"hostname_strip_suffixes" toml:"hostname_strip_suffixes" json:"hostname_strip_suffixes"`
+	HostnameShort            bool   `mapstructure:"hostname_short" toml:"hostname_short" json:"hostname_short"`
+	HostnameRegex            string `mapstructure:"hostname_regex" toml:"hostname_regex" json:"hostname_regex"`
+	HostnameReplace          string `mapstructure:"hostname_replace" toml:"hostname_replace" json:"hostname_replace"`
+	HostnameKeepOriginal     bool   `mapstructure:"hostname_keep_original" toml:"hostname_keep_original" json:"hostname_keep_original"`
+	// RFC5424Strict rejects the RFC5424 messages that do not strictly conform
+	// to the RFC, instead of parsing them on a best-effort basis. The
+	// rejected messages are dropped, or with RFC5424RejectAction "forward",
+	// delivered unparsed with the skewer.rfc5424_violation property.
+	RFC5424Strict       bool   `mapstructure:"rfc5424_strict" toml:"rfc5424_strict" json:"rfc5424_strict"`
+	RFC5424RejectAction string `mapstructure:"rfc5424_reject_action" toml:"rfc5424_reject_action" json:"rfc5424_reject_action"`
+	// UnknownParserAction applies when Format does not match any parser:
+	// "skip" (default) rejects the message, "fail" stops the source.
+	UnknownParserAction string `mapstructure:"unknown_parser_action" toml:"unknown_parser_action" json:"unknown_parser_action"`
+	// FallbackFormats is a comma separated list of the formats that are tried
+	// in order when a message can not be parsed with Format. The "raw" format
+	// delivers the message unparsed, so it can only be the last one.
+	FallbackFormats string `mapstructure:"fallback_formats" toml:"fallback_formats" json:"fallback_formats"`
+	// Checksum is the algorithm of the checksum of the raw bytes of each
+	// message, computed before parsing: "none" (default), "sha256", "sha384"
+	// or "sha512". The checksum is carried with the message and delivered in
+	// the skewer.checksum property, as "<algorithm>:<hex digest>".
+	Checksum string `mapstructure:"checksum" toml:"checksum" json:"checksum"`
+	// ParseErrorAction applies to the messages that can not be parsed:
+	// "drop" (default) discards them, "quarantine" delivers the raw bytes
+	// unparsed with the skewer.quarantine property. QuarantineAnswer is the
+	// RELP answer of the quarantined messages: "ack" (default) or "nack".
+	ParseErrorAction string `mapstructure:"parse_error_action" toml:"parse_error_action" json:"parse_error_action"`
+	QuarantineAnswer string `mapstructure:"quarantine_answer" toml:"quarantine_answer" json:"quarantine_answer"`
 }
 
 func (c *DecoderBaseConfig) Equals(other gotomic.Thing) bool {
@@ -464,6 +924,10 @@ func (c *DecoderBaseConfig) HashCode() uint32 {
 	h.Write([]byte(c.Format))
 	h.Write([]byte(c.Charset))
 	h.Write([]byte(c.W3CFields))
+	h.Write([]byte(c.SkipSDIDs))
+	h.Write([]byte(c.KeepSDIDs))
+	h.Write([]byte(c.SDDuplicatePolicy))
+	h.Write([]byte(c.FallbackFormats))
 	return h.Sum32()
 }
 
@@ -491,6 +955,65 @@ func (c *FilesystemSourceConfig) DefaultPort() int {
 	return 0
 }
 
+// FIFOSourceConfig configures a source that reads messages from a named pipe.
+type FIFOSourceConfig struct {
+	FilterSubConfig   `mapstructure:",squash"`
+	DecoderBaseConfig `mapstructure:",squash"`
+	Path              string       `mapstructure:"path" toml:"path" json:"path"`
+	FrameDelimiter    string       `mapstructure:"delimiter" toml:"delimiter" json:"delimiter"`
+	ConfID            utils.MyULID `mapstructure:"-" toml:"-" json:"conf_id"`
+}
+
+func (c *FIFOSourceConfig) FilterConf() *FilterSubConfig {
+	return &c.FilterSubConfig
+}
+
+func (c *FIFOSourceConfig) ListenersConf() *ListenersConfig {
+	return nil
+}
+
+func (c *FIFOSourceConfig) DecoderConf() *DecoderBaseConfig {
+	return &c.DecoderBaseConfig
+}
+
+func (c *FIFOSourceConfig) DefaultPort() int {
+	return 0
+}
+
+// IngestSourceConfig configures a one-shot ingestion of archived log files.
+// The files under Directory that match Glob are read once, line by line.
+// Files compressed with gzip or bzip2 are detected by their magic bytes or
+// their extension, and decompressed on the fly. The zstd compressed files
+// are not supported: they are reported and left for a later run. The
+// progress is written in StateDirectory every CheckpointLines lines, so that
+// an interrupted backfill resumes where it stopped, and a file that has been
+// fully ingested is not read again.
+type IngestSourceConfig struct {
+	FilterSubConfig   `mapstructure:",squash"`
+	DecoderBaseConfig `mapstructure:",squash"`
+	Directory         string       `mapstructure:"directory" toml:"directory" json:"directory"`
+	Glob              string       `mapstructure:"glob" toml:"glob" json:"glob"`
+	StateDirectory    string       `mapstructure:"state_directory" toml:"state_directory" json:"state_directory"`
+	CheckpointLines   int          `mapstructure:"checkpoint_lines" toml:"checkpoint_lines" json:"checkpoint_lines"`
+	ConfID            utils.MyULID `mapstructure:"-" toml:"-" json:"conf_id"`
+}
+
+func (c *IngestSourceConfig) FilterConf() *FilterSubConfig {
+	return &c.FilterSubConfig
+}
+
+func (c *IngestSourceConfig) ListenersConf() *ListenersConfig {
+	return nil
+}
+
+func (c *IngestSourceConfig) DecoderConf() *DecoderBaseConfig {
+	return &c.DecoderBaseConfig
+}
+
+func (c *IngestSourceConfig) DefaultPort() int {
+	return 0
+}
+
 type HTTPServerSourceConfig struct {
 	HTTPServerBaseConfig `mapstructure:",squash"`
 	DecoderBaseConfig    `mapstructure:",squash"`
@@ -530,10 +1053,114 @@ type TCPSourceConfig struct {
 	ListenersConfig   `mapstructure:",squash"`
 	FilterSubConfig   `mapstructure:",squash"`
 	TlsBaseConfig     `mapstructure:",squash"`
-	ClientAuthType    string       `mapstructure:"client_auth_type" toml:"client_auth_type" json:"client_auth_type"`
-	LineFraming       bool         `mapstructure:"line_framing" toml:"line_framing" json:"line_framing"`
-	FrameDelimiter    string       `mapstructure:"delimiter" toml:"delimiter" json:"delimiter"`
-	ConfID            utils.MyULID `mapstructure:"-" toml:"-" json:"conf_id"`
+	ClientAuthType    string `mapstructure:"client_auth_type" toml:"client_auth_type" json:"client_auth_type"`
+	LineFraming       bool   `mapstructure:"line_framing" toml:"line_framing" json:"line_framing"`
+	// FrameDelimiter separates the records with LineFraming. Besides a
+	// single character, it can be "lf" (default), "crlf", "cr" that also
+	// accepts LF and CRLF, or "nul" for the logs that contain newlines.
+	// Without LineFraming and OctetCounting, it is the trailer of the
+	// non-transparent frames, next to the detected octet-counting frames.
+	FrameDelimiter string `mapstructure:"delimiter" toml:"delimiter" json:"delimiter"`
+	// OctetCounting enforces the RFC5425 octet-counting framing
+	// (MSG-LEN SP SYSLOG-MSG) for every message, whatever its content.
+	// It can not be combined with LineFraming.
+	OctetCounting bool `mapstructure:"octet_counting" toml:"octet_counting" json:"octet_counting"`
+	// OrderedParsing makes the messages of a connection be parsed and
+	// forwarded in receive order (RELP sources only).
+	OrderedParsing bool `mapstructure:"ordered_parsing" toml:"ordered_parsing" json:"ordered_parsing"`
+	// ClientIDOffer is the key of the RELP open offer whose value is used
+	// as a stable client identifier in logs and metrics (RELP sources only).
+	ClientIDOffer string `mapstructure:"client_id_offer" toml:"client_id_offer" json:"client_id_offer"`
+	// OpenOffers are additional "key=value" offers advertised in the
+	// response to the RELP open command (RELP sources only).
+	OpenOffers []string `mapstructure:"open_offers" toml:"open_offers" json:"open_offers"`
+	// ReplayGracePeriod is how long the messages of a disconnected client
+	// that were stashed but not answered are remembered. When the client
+	// reconnects and sends them again, they are recognized by their content
+	// and answered with success without being stashed twice. It requires ClientIDOffer, and
+	// applies only to the clients that offer an id. 0 disables the
+	// replay buffer (RELP sources only).
+	ReplayGracePeriod time.Duration `mapstructure:"replay_grace_period" toml:"replay_grace_period" json:"replay_grace_period"`
+	// MaxPendingAnswers caps the number of transactions of a connection
+	// that were received but not answered yet, and so the answers that wait
+	// for the answer of a slow transaction. Over the cap, the connection
+	// stops reading until the answers are sent. 0 (default) disables the cap
+	// (RELP sources only).
+	MaxPendingAnswers int `mapstructure:"max_pending_answers" toml:"max_pending_answers" json:"max_pending_answers"`
+	// EmptyFrames is the handling of the syslog commands without data:
+	// "ack" (default) answers with success, "reject" answers with an error,
+	// and "keepalive" answers with success and counts a keepalive (RELP
+	// sources only).
+	EmptyFrames string `mapstructure:"empty_frames" toml:"empty_frames" json:"empty_frames"`
+	// OfferMismatch is the handling of the RELP open offers that require a
+	// capability that skewer does not support: "reject" (default) answers
+	// with an error offer and closes the session, "accept" answers with the
+	// supported capabilities and keeps the session (RELP sources only).
+	OfferMismatch string `mapstructure:"offer_mismatch" toml:"offer_mismatch" json:"offer_mismatch"`
+	// ClientCAFiles are CA bundles that are trusted to verify the client
+	// certificates, in addition to CAFile and CAPath (e.g. during a CA
+	// migration).
+	ClientCAFiles []string `mapstructure:"client_ca_files" toml:"client_ca_files" json:"client_ca_files"`
+	// CertReloadInterval is how often the certificate and key files are
+	// checked for changes, so that renewed certificates are used without a
+	// restart. Defaults to 1 minute. A negative value disables the reloading.
+	CertReloadInterval time.Duration `mapstructure:"cert_reload_interval" toml:"cert_reload_interval" json:"cert_reload_interval"`
+	// CRLFile is a file of certificate revocation lists (PEM or DER) that
+	// are checked after the verification of the client certificates. A
+	// revoked certificate is rejected. The file is reloaded when it changes,
+	// like the certificate. Empty (default) disables the revocation check.
+	CRLFile string `mapstructure:"crl_file" toml:"crl_file" json:"crl_file"`
+	// RevocationPolicy applies when the revocation status of a client
+	// certificate can't be determined (no CRL from its issuer, or an
+	// expired CRL): "soft" (default) accepts the client, "hard" rejects it.
+	RevocationPolicy string `mapstructure:"revocation_policy" toml:"revocation_policy" json:"revocation_policy"`
+	// MaxTLSHandshakes bounds the number of TLS handshakes in progress on
+	// each listener, so that the connections that never finish their
+	// handshake can't exhaust the resources. Defaults to 64.
+	MaxTLSHandshakes int `mapstructure:"max_tls_handshakes" toml:"max_tls_handshakes" json:"max_tls_handshakes"`
+	// TLSHandshakeTimeout is the maximum duration of a TLS handshake.
+	// Defaults to 10 seconds.
+	TLSHandshakeTimeout time.Duration `mapstructure:"tls_handshake_timeout" toml:"tls_handshake_timeout" json:"tls_handshake_timeout"`
+	// TLSHandshakeWait is how long a new connection waits for a handshake
+	// slot before it is closed. Defaults to 100 milliseconds.
+	TLSHandshakeWait time.Duration `mapstructure:"tls_handshake_wait" toml:"tls_handshake_wait" json:"tls_handshake_wait"`
+	// MaxConnections caps the number of connections of each listener. 0
+	// (default) means no cap.
+	MaxConnections int `mapstructure:"max_connections" toml:"max_connections" json:"max_connections"`
+	// EvictIdle makes a new connection over MaxConnections evict the least
+	// recently active connection, when that connection has not received
+	// anything for at least EvictIdle. Otherwise, or when EvictIdle is 0
+	// (default), the new connection is refused.
+	EvictIdle time.Duration `mapstructure:"evict_idle" toml:"evict_idle" json:"evict_idle"`
+	// NoDelay sets TCP_NODELAY on the accepted connections: "on" (default)
+	// disables Nagle's algorithm, so that the small RELP answers are not
+	// delayed by the delayed-ack of the clients, and "off" enables it.
+	NoDelay string `mapstructure:"nodelay" toml:"nodelay" json:"nodelay"`
+	// Decompress is the decompression of the whole input stream of the
+	// connections: "none" (default), "auto" that detects a gzip or zlib
+	// header and otherwise reads the stream as is, or "gzip" and "zlib" that
+	// require the stream to be compressed (TCP sources only). zstd is not
+	// supported: "zstd" is refused by the configuration check, and with
+	// "auto" the zstd streams are detected and their connection is closed.
+	Decompress string `mapstructure:"decompress" toml:"decompress" json:"decompress"`
+	// BackpressureHigh and BackpressureLow are the watermarks of the queue
+	// of the raw messages waiting to be parsed (TCP sources only). The
+	// listener stops reading from its connections when the queue reaches
+	// BackpressureHigh messages, so that TCP flow control slows the senders
+	// down, and reads again when the queue is down to BackpressureLow. 0
+	// (default) disables the backpressure, and BackpressureLow defaults to
+	// half of BackpressureHigh.
+	BackpressureHigh int `mapstructure:"backpressure_high" toml:"backpressure_high" json:"backpressure_high"`
+	BackpressureLow  int `mapstructure:"backpressure_low" toml:"backpressure_low" json:"backpressure_low"`
+	// EndToEndAck makes the answer of each transaction wait until the
+	// messages have been acknowledged by all the destinations of the Store,
+	// instead of only accepted by the Store. A message that a destination
+	// rejects, or that is not acknowledged within EndToEndAckTimeout
+	// (default 30 seconds), is answered with an error, so that the client
+	// sends it again (RELP sources only).
+	EndToEndAck        bool          `mapstructure:"end_to_end_ack" toml:"end_to_end_ack" json:"end_to_end_ack"`
+	EndToEndAckTimeout time.Duration `mapstructure:"end_to_end_ack_timeout" toml:"end_to_end_ack_timeout" json:"end_to_end_ack_timeout"`
+	ConfID             utils.MyULID  `mapstructure:"-" toml:"-" json:"conf_id"`
 }
 
 func (c *TCPSourceConfig) FilterConf() *FilterSubConfig {
@@ -552,6 +1179,14 @@ func (c *TCPSourceConfig) DefaultPort() int {
 	return 1514
 }
 
+// UDPSourceConfig is the configuration of a UDP source. On Linux, the
+// messages received on a unix datagram socket (unix_socket_path) carry the
+// pid, uid and gid of the sending process in their skewer properties, and
+// the command name of the process is used as the client. The credentials
+// are left out when skewer can't see the sender: a process in another pid
+// namespace is reported with pid 0, and a uid without a mapping in the user
+// namespace of skewer is reported as the overflow uid 65534. The messages of
+// those processes keep the localhost client.
 type UDPSourceConfig struct {
 	DecoderBaseConfig `mapstructure:",squash"`
 	ListenersConfig   `mapstructure:",squash"`
@@ -603,10 +1238,107 @@ type RELPSourceConfig struct {
 	ListenersConfig   `mapstructure:",squash"`
 	FilterSubConfig   `mapstructure:",squash"`
 	TlsBaseConfig     `mapstructure:",squash"`
-	ClientAuthType    string       `mapstructure:"client_auth_type" toml:"client_auth_type" json:"client_auth_type"`
-	LineFraming       bool         `mapstructure:"line_framing" toml:"line_framing" json:"line_framing"`
-	FrameDelimiter    string       `mapstructure:"delimiter" toml:"delimiter" json:"delimiter"`
-	ConfID            utils.MyULID `mapstructure:"-" toml:"-" json:"conf_id"`
+	ClientAuthType    string `mapstructure:"client_auth_type" toml:"client_auth_type" json:"client_auth_type"`
+	LineFraming       bool   `mapstructure:"line_framing" toml:"line_framing" json:"line_framing"`
+	FrameDelimiter    string `mapstructure:"delimiter" toml:"delimiter" json:"delimiter"`
+	// OctetCounting is unused by RELP sources.
+	OctetCounting bool `mapstructure:"octet_counting" toml:"octet_counting" json:"octet_counting"`
+	// OrderedParsing makes the messages of a connection be parsed and
+	// forwarded in receive order (RELP sources only).
+	OrderedParsing bool `mapstructure:"ordered_parsing" toml:"ordered_parsing" json:"ordered_parsing"`
+	// ClientIDOffer is the key of the RELP open offer whose value is used
+	// as a stable client identifier in logs and metrics (RELP sources only).
+	ClientIDOffer string `mapstructure:"client_id_offer" toml:"client_id_offer" json:"client_id_offer"`
+	// OpenOffers are additional "key=value" offers advertised in the
+	// response to the RELP open command (RELP sources only).
+	OpenOffers []string `mapstructure:"open_offers" toml:"open_offers" json:"open_offers"`
+	// ReplayGracePeriod is how long the messages of a disconnected client
+	// that were stashed but not answered are remembered. When the client
+	// reconnects and sends them again, they are recognized by their content
+	// and answered with success without being stashed twice. It requires ClientIDOffer, and
+	// applies only to the clients that offer an id. 0 disables the
+	// replay buffer (RELP sources only).
+	ReplayGracePeriod time.Duration `mapstructure:"replay_grace_period" toml:"replay_grace_period" json:"replay_grace_period"`
+	// MaxPendingAnswers caps the number of transactions of a connection
+	// that were received but not answered yet, and so the answers that wait
+	// for the answer of a slow transaction. Over the cap, the connection
+	// stops reading until the answers are sent. 0 (default) disables the cap
+	// (RELP sources only).
+	MaxPendingAnswers int `mapstructure:"max_pending_answers" toml:"max_pending_answers" json:"max_pending_answers"`
+	// EmptyFrames is the handling of the syslog commands without data:
+	// "ack" (default) answers with success, "reject" answers with an error,
+	// and "keepalive" answers with success and counts a keepalive (RELP
+	// sources only).
+	EmptyFrames string `mapstructure:"empty_frames" toml:"empty_frames" json:"empty_frames"`
+	// OfferMismatch is the handling of the RELP open offers that require a
+	// capability that skewer does not support: "reject" (default) answers
+	// with an error offer and closes the session, "accept" answers with the
+	// supported capabilities and keeps the session (RELP sources only).
+	OfferMismatch string `mapstructure:"offer_mismatch" toml:"offer_mismatch" json:"offer_mismatch"`
+	// ClientCAFiles are CA bundles that are trusted to verify the client
+	// certificates, in addition to CAFile and CAPath (e.g. during a CA
+	// migration).
+	ClientCAFiles []string `mapstructure:"client_ca_files" toml:"client_ca_files" json:"client_ca_files"`
+	// CertReloadInterval is how often the certificate and key files are
+	// checked for changes, so that renewed certificates are used without a
+	// restart. Defaults to 1 minute. A negative value disables the reloading.
+	CertReloadInterval time.Duration `mapstructure:"cert_reload_interval" toml:"cert_reload_interval" json:"cert_reload_interval"`
+	// CRLFile is a file of certificate revocation lists (PEM or DER) that
+	// are checked after the verification of the client certificates. A
+	// revoked certificate is rejected. The file is reloaded when it changes,
+	// like the certificate. Empty (default) disables the revocation check.
+	CRLFile string `mapstructure:"crl_file" toml:"crl_file" json:"crl_file"`
+	// RevocationPolicy applies when the revocation status of a client
+	// certificate can't be determined (no CRL from its issuer, or an
+	// expired CRL): "soft" (default) accepts the client, "hard" rejects it.
+	RevocationPolicy string `mapstructure:"revocation_policy" toml:"revocation_policy" json:"revocation_policy"`
+	// MaxTLSHandshakes bounds the number of TLS handshakes in progress on
+	// each listener, so that the connections that never finish their
+	// handshake can't exhaust the resources. Defaults to 64.
+	MaxTLSHandshakes int `mapstructure:"max_tls_handshakes" toml:"max_tls_handshakes" json:"max_tls_handshakes"`
+	// TLSHandshakeTimeout is the maximum duration of a TLS handshake.
+	// Defaults to 10 seconds.
+	TLSHandshakeTimeout time.Duration `mapstructure:"tls_handshake_timeout" toml:"tls_handshake_timeout" json:"tls_handshake_timeout"`
+	// TLSHandshakeWait is how long a new connection waits for a handshake
+	// slot before it is closed. Defaults to 100 milliseconds.
+	TLSHandshakeWait time.Duration `mapstructure:"tls_handshake_wait" toml:"tls_handshake_wait" json:"tls_handshake_wait"`
+	// MaxConnections caps the number of connections of each listener. 0
+	// (default) means no cap.
+	MaxConnections int `mapstructure:"max_connections" toml:"max_connections" json:"max_connections"`
+	// EvictIdle makes a new connection over MaxConnections evict the least
+	// recently active connection, when that connection has not received
+	// anything for at least EvictIdle. Otherwise, or when EvictIdle is 0
+	// (default), the new connection is refused.
+	EvictIdle time.Duration `mapstructure:"evict_idle" toml:"evict_idle" json:"evict_idle"`
+	// NoDelay sets TCP_NODELAY on the accepted connections: "on" (default)
+	// disables Nagle's algorithm, so that the small RELP answers are not
+	// delayed by the delayed-ack of the clients, and "off" enables it.
+	NoDelay string `mapstructure:"nodelay" toml:"nodelay" json:"nodelay"`
+	// Decompress is the decompression of the whole input stream of the
+	// connections: "none" (default), "auto" that detects a gzip or zlib
+	// header and otherwise reads the stream as is, or "gzip" and "zlib" that
+	// require the stream to be compressed (TCP sources only). zstd is not
+	// supported: "zstd" is refused by the configuration check, and with
+	// "auto" the zstd streams are detected and their connection is closed.
+	Decompress string `mapstructure:"decompress" toml:"decompress" json:"decompress"`
+	// BackpressureHigh and BackpressureLow are the watermarks of the queue
+	// of the raw messages waiting to be parsed (TCP sources only). The
+	// listener stops reading from its connections when the queue reaches
+	// BackpressureHigh messages, so that TCP flow control slows the senders
+	// down, and reads again when the queue is down to BackpressureLow. 0
+	// (default) disables the backpressure, and BackpressureLow defaults to
+	// half of BackpressureHigh.
+	BackpressureHigh int `mapstructure:"backpressure_high" toml:"backpressure_high" json:"backpressure_high"`
+	BackpressureLow  int `mapstructure:"backpressure_low" toml:"backpressure_low" json:"backpressure_low"`
+	// EndToEndAck makes the answer of each transaction wait until the
+	// messages have been acknowledged by all the destinations of the Store,
+	// instead of only accepted by the Store. A message that a destination
+	// rejects, or that is not acknowledged within EndToEndAckTimeout
+	// (default 30 seconds), is answered with an error, so that the client
+	// sends it again (RELP sources only).
+	EndToEndAck        bool          `mapstructure:"end_to_end_ack" toml:"end_to_end_ack" json:"end_to_end_ack"`
+	EndToEndAckTimeout time.Duration `mapstructure:"end_to_end_ack_timeout" toml:"end_to_end_ack_timeout" json:"end_to_end_ack_timeout"`
+	ConfID             utils.MyULID  `mapstructure:"-" toml:"-" json:"conf_id"`
 }
 
 func (c *RELPSourceConfig) FilterConf() *FilterSubConfig {
@@ -630,10 +1362,107 @@ type DirectRELPSourceConfig struct {
 	ListenersConfig   `mapstructure:",squash"`
 	FilterSubConfig   `mapstructure:",squash"`
 	TlsBaseConfig     `mapstructure:",squash"`
-	ClientAuthType    string       `mapstructure:"client_auth_type" toml:"client_auth_type" json:"client_auth_type"`
-	LineFraming       bool         `mapstructure:"line_framing" toml:"line_framing" json:"line_framing"`
-	FrameDelimiter    string       `mapstructure:"delimiter" toml:"delimiter" json:"delimiter"`
-	ConfID            utils.MyULID `mapstructure:"-" toml:"-" json:"conf_id"`
+	ClientAuthType    string `mapstructure:"client_auth_type" toml:"client_auth_type" json:"client_auth_type"`
+	LineFraming       bool   `mapstructure:"line_framing" toml:"line_framing" json:"line_framing"`
+	FrameDelimiter    string `mapstructure:"delimiter" toml:"delimiter" json:"delimiter"`
+	// OctetCounting is unused by RELP sources.
+	OctetCounting bool `mapstructure:"octet_counting" toml:"octet_counting" json:"octet_counting"`
+	// OrderedParsing makes the messages of a connection be parsed and
+	// forwarded in receive order (RELP sources only).
+	OrderedParsing bool `mapstructure:"ordered_parsing" toml:"ordered_parsing" json:"ordered_parsing"`
+	// ClientIDOffer is the key of the RELP open offer whose value is used
+	// as a stable client identifier in logs and metrics (RELP sources only).
+	ClientIDOffer string `mapstructure:"client_id_offer" toml:"client_id_offer" json:"client_id_offer"`
+	// OpenOffers are additional "key=value" offers advertised in the
+	// response to the RELP open command (RELP sources only).
+	OpenOffers []string `mapstructure:"open_offers" toml:"open_offers" json:"open_offers"`
+	// ReplayGracePeriod is how long the messages of a disconnected client
+	// that were stashed but not answered are remembered. When the client
+	// reconnects and sends them again, they are recognized by their content
+	// and answered with success without being stashed twice. It requires ClientIDOffer, and
+	// applies only to the clients that offer an id. 0 disables the
+	// replay buffer (RELP sources only).
+	ReplayGracePeriod time.Duration `mapstructure:"replay_grace_period" toml:"replay_grace_period" json:"replay_grace_period"`
+	// MaxPendingAnswers caps the number of transactions of a connection
+	// that were received but not answered yet, and so the answers that wait
+	// for the answer of a slow transaction. Over the cap, the connection
+	// stops reading until the answers are sent. 0 (default) disables the cap
+	// (RELP sources only).
+	MaxPendingAnswers int `mapstructure:"max_pending_answers" toml:"max_pending_answers" json:"max_pending_answers"`
+	// EmptyFrames is the handling of the syslog commands without data:
+	// "ack" (default) answers with success, "reject" answers with an error,
+	// and "keepalive" answers with success and counts a keepalive (RELP
+	// sources only).
+	EmptyFrames string `mapstructure:"empty_frames" toml:"empty_frames" json:"empty_frames"`
+	// OfferMismatch is the handling of the RELP open offers that require a
+	// capability that skewer does not support: "reject" (default) answers
+	// with an error offer and closes the session, "accept" answers with the
+	// supported capabilities and keeps the session (RELP sources only).
+	OfferMismatch string `mapstructure:"offer_mismatch" toml:"offer_mismatch" json:"offer_mismatch"`
+	// ClientCAFiles are CA bundles that are trusted to verify the client
+	// certificates, in addition to CAFile and CAPath (e.g. during a CA
+	// migration).
+	ClientCAFiles []string `mapstructure:"client_ca_files" toml:"client_ca_files" json:"client_ca_files"`
+	// CertReloadInterval is how often the certificate and key files are
+	// checked for changes, so that renewed certificates are used without a
+	// restart. Defaults to 1 minute. A negative value disables the reloading.
+	CertReloadInterval time.Duration `mapstructure:"cert_reload_interval" toml:"cert_reload_interval" json:"cert_reload_interval"`
+	// CRLFile is a file of certificate revocation lists (PEM or DER) that
+	// are checked after the verification of the client certificates. A
+	// revoked certificate is rejected. The file is reloaded when it changes,
+	// like the certificate. Empty (default) disables the revocation check.
+	CRLFile string `mapstructure:"crl_file" toml:"crl_file" json:"crl_file"`
+	// RevocationPolicy applies when the revocation status of a client
+	// certificate can't be determined (no CRL from its issuer, or an
+	// expired CRL): "soft" (default) accepts the client, "hard" rejects it.
+	RevocationPolicy string `mapstructure:"revocation_policy" toml:"revocation_policy" json:"revocation_policy"`
+	// MaxTLSHandshakes bounds the number of TLS handshakes in progress on
+	// each listener, so that the connections that never finish their
+	// handshake can't exhaust the resources. Defaults to 64.
+	MaxTLSHandshakes int `mapstructure:"max_tls_handshakes" toml:"max_tls_handshakes" json:"max_tls_handshakes"`
+	// TLSHandshakeTimeout is the maximum duration of a TLS handshake.
+	// Defaults to 10 seconds.
+	TLSHandshakeTimeout time.Duration `mapstructure:"tls_handshake_timeout" toml:"tls_handshake_timeout" json:"tls_handshake_timeout"`
+	// TLSHandshakeWait is how long a new connection waits for a handshake
+	// slot before it is closed. Defaults to 100 milliseconds.
+	TLSHandshakeWait time.Duration `mapstructure:"tls_handshake_wait" toml:"tls_handshake_wait" json:"tls_handshake_wait"`
+	// MaxConnections caps the number of connections of each listener. 0
+	// (default) means no cap.
+	MaxConnections int `mapstructure:"max_connections" toml:"max_connections" json:"max_connections"`
+	// EvictIdle makes a new connection over MaxConnections evict the least
+	// recently active connection, when that connection has not received
+	// anything for at least EvictIdle. Otherwise, or when EvictIdle is 0
+	// (default), the new connection is refused.
+	EvictIdle time.Duration `mapstructure:"evict_idle" toml:"evict_idle" json:"evict_idle"`
+	// NoDelay sets TCP_NODELAY on the accepted connections: "on" (default)
+	// disables Nagle's algorithm, so that the small RELP answers are not
+	// delayed by the delayed-ack of the clients, and "off" enables it.
+	NoDelay string `mapstructure:"nodelay" toml:"nodelay" json:"nodelay"`
+	// Decompress is the decompression of the whole input stream of the
+	// connections: "none" (default), "auto" that detects a gzip or zlib
+	// header and otherwise reads the stream as is, or "gzip" and "zlib" that
+	// require the stream to be compressed (TCP sources only). zstd is not
+	// supported: "zstd" is refused by the configuration check, and with
+	// "auto" the zstd streams are detected and their connection is closed.
+	Decompress string `mapstructure:"decompress" toml:"decompress" json:"decompress"`
+	// BackpressureHigh and BackpressureLow are the watermarks of the queue
+	// of the raw messages waiting to be parsed (TCP sources only). The
+	// listener stops reading from its connections when the queue reaches
+	// BackpressureHigh messages, so that TCP flow control slows the senders
+	// down, and reads again when the queue is down to BackpressureLow. 0
+	// (default) disables the backpressure, and BackpressureLow defaults to
+	// half of BackpressureHigh.
+	BackpressureHigh int `mapstructure:"backpressure_high" toml:"backpressure_high" json:"backpressure_high"`
+	BackpressureLow  int `mapstructure:"backpressure_low" toml:"backpressure_low" json:"backpressure_low"`
+	// EndToEndAck makes the answer of each transaction wait until the
+	// messages have been acknowledged by all the destinations of the Store,
+	// instead of only accepted by the Store. A message that a destination
+	// rejects, or that is not acknowledged within EndToEndAckTimeout
+	// (default 30 seconds), is answered with an error, so that the client
+	// sends it again (RELP sources only).
+	EndToEndAck        bool          `mapstructure:"end_to_end_ack" toml:"end_to_end_ack" json:"end_to_end_ack"`
+	EndToEndAckTimeout time.Duration `mapstructure:"end_to_end_ack_timeout" toml:"end_to_end_ack_timeout" json:"end_to_end_ack_timeout"`
+	ConfID             utils.MyULID  `mapstructure:"-" toml:"-" json:"conf_id"`
 }
 
 func (c *DirectRELPSourceConfig) FilterConf() *FilterSubConfig {
@@ -667,6 +1496,19 @@ type ListenersConfig struct {
 	KeepAlive       bool          `mapstructure:"keepalive" toml:"keepalive" json:"keepalive"`
 	KeepAlivePeriod time.Duration `mapstructure:"keepalive_period" toml:"keepalive_period" json:"keepalive_period"`
 	Timeout         time.Duration `mapstructure:"timeout" toml:"timeout" json:"timeout"`
+	// ConnectionLog is the level of the new connection and end of
+	// connection logs: "info" (default), "debug" or "none".
+	ConnectionLog string `mapstructure:"connection_log" toml:"connection_log" json:"connection_log"`
+	// ConnectionLogSampling logs only 1 connection in N. The connection
+	// metrics still count every connection.
+	ConnectionLogSampling int `mapstructure:"connection_log_sampling" toml:"connection_log_sampling" json:"connection_log_sampling"`
+	// BindInterface binds the listeners to the named network interface
+	// instead of BindAddr. The addresses of the interface are resolved each
+	// time the listeners start. On Linux, the sockets are bound to the device
+	// with SO_BINDTODEVICE, so that they accept the connections on all the
+	// addresses of the interface, even when they change. Elsewhere, the
+	// listeners bind to the first address of the interface.
+	BindInterface string `mapstructure:"bind_interface" toml:"bind_interface" json:"bind_interface"`
 }
 
 type KafkaSourceConfig struct {
@@ -7,6 +7,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/consul/api"
 	"github.com/inconshreveable/log15"
@@ -32,6 +33,7 @@ type Service struct {
 	Port     int
 	Check    string
 	Tags     []string
+	Meta     map[string]string
 }
 
 func NewService(ip string, port int, check string, tags []string) (*Service, error) {
@@ -77,6 +79,27 @@ func NewService(ip string, port int, check string, tags []string) (*Service, err
 	return &s, nil
 }
 
+// Health check types for the registered services.
+const (
+	CheckTCP  = "tcp"
+	CheckTTL  = "ttl"
+	CheckNone = "none"
+)
+
+// RegistrationParams describes what is attached to the services registered
+// in Consul, in addition to the protocol tag.
+type RegistrationParams struct {
+	Tags []string
+	Meta map[string]string
+	// Check is the health check type: CheckTCP (Consul connects to the
+	// listener), CheckTTL (skewer reports the health of the listener) or
+	// CheckNone.
+	Check string
+	// TTL is the time to live of the TTL check. The check is refreshed every
+	// TTL/3.
+	TTL time.Duration
+}
+
 type Registry struct {
 	client                *api.Client
 	logger                log15.Logger
@@ -84,17 +107,33 @@ type Registry struct {
 	RegisterChan          chan ServiceAction
 	wgroup                *sync.WaitGroup
 	svcName               string
+	params                RegistrationParams
+	healthMu              sync.Mutex
+	// unhealthy maps the IDs of the degraded services to the reason
+	unhealthy map[string]string
 }
 
 func (r *Registry) WaitFinished() {
 	r.wgroup.Wait()
 }
 
+func (r *Registry) newTcpService(bindAddr, protocol string, port int) (*Service, error) {
+	tags := make([]string, 0, len(r.params.Tags)+1)
+	tags = append(tags, protocol)
+	tags = append(tags, r.params.Tags...)
+	svc, err := NewService(bindAddr, port, fmt.Sprintf("%s:%d", bindAddr, port), tags)
+	if err != nil {
+		return nil, err
+	}
+	svc.Meta = r.params.Meta
+	return svc, nil
+}
+
 func (r *Registry) RegisterTcpListener(bindAddr, protocol string, port int) {
 	if bindAddr == "" || port == 0 || protocol == "" {
 		return
 	}
-	svc, err := NewService(bindAddr, port, fmt.Sprintf("%s:%d", bindAddr, port), []string{protocol})
+	svc, err := r.newTcpService(bindAddr, protocol, port)
 	if err == nil {
 		action := ServiceAction{Action: REGISTER, Service: svc}
 		r.RegisterChan <- action
@@ -105,32 +144,97 @@ func (r *Registry) UnregisterTcpListener(bindAddr, protocol string, port int) {
 	if bindAddr == "" || port == 0 || protocol == "" {
 		return
 	}
-	svc, err := NewService(bindAddr, port, fmt.Sprintf("%s:%d", bindAddr, port), []string{protocol})
+	svc, err := r.newTcpService(bindAddr, protocol, port)
 	if err == nil {
 		action := ServiceAction{Action: UNREGISTER, Service: svc}
 		r.RegisterChan <- action
 	}
 }
 
-func NewRegistry(ctx context.Context, params ConnParams, svcName string, logger log15.Logger) (*Registry, error) {
+// SetListenerHealth reports the health of a listener. With a TTL check,
+// Consul marks the service of an unhealthy listener as critical. The listener
+// becomes healthy again when it is registered again.
+func (r *Registry) SetListenerHealth(bindAddr string, port int, healthy bool, reason string) {
+	if bindAddr == "" || port == 0 {
+		return
+	}
+	svc, err := NewService(bindAddr, port, "", nil)
+	if err != nil {
+		return
+	}
+	r.healthMu.Lock()
+	if healthy {
+		delete(r.unhealthy, svc.ID)
+	} else {
+		r.unhealthy[svc.ID] = reason
+	}
+	r.healthMu.Unlock()
+}
+
+// updateTTL refreshes the TTL check of a registered service.
+func (r *Registry) updateTTL(svcID string) {
+	r.healthMu.Lock()
+	reason, degraded := r.unhealthy[svcID]
+	r.healthMu.Unlock()
+	var err error
+	if degraded {
+		err = r.client.Agent().UpdateTTL("service:"+svcID, reason, api.HealthCritical)
+	} else {
+		err = r.client.Agent().UpdateTTL("service:"+svcID, "", api.HealthPassing)
+	}
+	if err != nil {
+		r.logger.Warn("Failed to update the TTL check in Consul", "ID", svcID, "error", err)
+	}
+}
+
+func NewRegistry(ctx context.Context, params ConnParams, svcName string, regParams RegistrationParams, logger log15.Logger) (*Registry, error) {
 	addr := strings.TrimSpace(params.Address)
 	if len(addr) == 0 {
 		return nil, nil
 	}
+	regParams.Check = strings.ToLower(strings.TrimSpace(regParams.Check))
+	switch regParams.Check {
+	case "":
+		regParams.Check = CheckTCP
+	case CheckTCP, CheckNone:
+	case CheckTTL:
+		if regParams.TTL <= 0 {
+			return nil, eerrors.New("The TTL of the Consul check must be positive")
+		}
+	default:
+		return nil, eerrors.Errorf("Unknown Consul check type: '%s'", regParams.Check)
+	}
 	c, err := NewClient(params)
 	if err != nil {
 		return nil, err
 	}
-	r := Registry{client: c, logger: logger, svcName: strings.TrimSpace(svcName)}
+	r := Registry{client: c, logger: logger, svcName: strings.TrimSpace(svcName), params: regParams}
 	r.wgroup = &sync.WaitGroup{}
 	r.registeredServicesIds = map[string]bool{}
+	r.unhealthy = map[string]string{}
 	r.RegisterChan = make(chan ServiceAction)
 
+	var ttlChan <-chan time.Time
+	var ticker *time.Ticker
+	if regParams.Check == CheckTTL {
+		ticker = time.NewTicker(regParams.TTL / 3)
+		ttlChan = ticker.C
+	}
+
 	r.wgroup.Add(1)
 	go func() {
 		defer r.wgroup.Done()
+		if ticker != nil {
+			defer ticker.Stop()
+		}
 		for {
 			select {
+			case <-ttlChan:
+				for svcID, registered := range r.registeredServicesIds {
+					if registered {
+						r.updateTTL(svcID)
+					}
+				}
 			case <-ctx.Done():
 				for svcID, registered := range r.registeredServicesIds {
 					if registered {
@@ -144,13 +248,19 @@ func NewRegistry(ctx context.Context, params ConnParams, svcName string, logger
 				svc := serviceAction.Service
 				if !svc.parsedIP.IsLoopback() {
 					if serviceAction.Action == REGISTER {
+						r.healthMu.Lock()
+						delete(r.unhealthy, svc.ID)
+						r.healthMu.Unlock()
 						if r.registeredServicesIds[svc.ID] {
 							logger.Info("Service already registed in Consul", "ID", svc.ID)
 						} else {
-							err := doRegister(r.client, svc, r.svcName)
+							err := doRegister(r.client, svc, r.svcName, r.params)
 							if err == nil {
 								logger.Debug("Registered in consul", "ID", svc.ID, "IP", svc.IP, "port", svc.Port)
 								r.registeredServicesIds[svc.ID] = true
+								if r.params.Check == CheckTTL {
+									r.updateTTL(svc.ID)
+								}
 							} else {
 								logger.Warn("Failed to register service in Consul", "ID", svc.ID, "IP", svc.IP, "port", svc.Port, "error", err)
 							}
@@ -176,7 +286,7 @@ func NewRegistry(ctx context.Context, params ConnParams, svcName string, logger
 	return &r, nil
 }
 
-func doRegister(client *api.Client, svc *Service, svcName string) error {
+func doRegister(client *api.Client, svc *Service, svcName string, params RegistrationParams) error {
 
 	service := &api.AgentServiceRegistration{
 		ID:      svc.ID,
@@ -184,9 +294,20 @@ func doRegister(client *api.Client, svc *Service, svcName string) error {
 		Address: svc.parsedIP.String(),
 		Port:    svc.Port,
 		Tags:    svc.Tags,
+		Meta:    svc.Meta,
 	}
 
 	check := strings.TrimSpace(svc.Check)
+	switch params.Check {
+	case CheckNone:
+		return client.Agent().ServiceRegister(service)
+	case CheckTTL:
+		service.Check = &api.AgentServiceCheck{
+			TTL:    params.TTL.String(),
+			Status: "critical",
+		}
+		return client.Agent().ServiceRegister(service)
+	}
 	if strings.HasPrefix(check, "http://") || strings.HasPrefix(check, "https://") {
 		service.Check = &api.AgentServiceCheck{
 			HTTP:          svc.Check,
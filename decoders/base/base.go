@@ -17,6 +17,7 @@ const (
 	Collectd
 	W3C
 	LTSV
+	CRI
 )
 
 var Formats = map[string]Format{
@@ -30,6 +31,7 @@ var Formats = map[string]Format{
 	"collectd":    Collectd,
 	"w3c":         W3C,
 	"ltsv":        LTSV,
+	"cri":         CRI,
 }
 
 func ParseFormat(format string) Format {
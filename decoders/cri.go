@@ -0,0 +1,264 @@
+package decoders
+
+import (
+	"bytes"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// The CRI log format is written by the container runtimes of Kubernetes:
+//
+//   2019-01-01T00:00:00.123456789Z stdout F the log message
+//
+// The flags field starts with P when the runtime had to split a long line,
+// and with F for the last (or only) part of a line.
+
+const (
+	criPartial = "P"
+	criFull    = "F"
+)
+
+type criLine struct {
+	timestamp []byte
+	stream    []byte
+	partial   bool
+	message   []byte
+}
+
+func splitCRI(m []byte) (l criLine, err error) {
+	fields := bytes.SplitN(m, []byte{' '}, 4)
+	if len(fields) < 3 {
+		return l, eerrors.New("Expected timestamp, stream and flags fields")
+	}
+	l.timestamp = fields[0]
+	l.stream = fields[1]
+	if len(l.stream) == 0 {
+		return l, eerrors.New("Empty stream field")
+	}
+	// the flags are separated by ':', the first one tells if the line is partial
+	flags := fields[2]
+	if i := bytes.IndexByte(flags, ':'); i >= 0 {
+		flags = flags[:i]
+	}
+	switch string(flags) {
+	case criPartial:
+		l.partial = true
+	case criFull:
+	default:
+		return l, eerrors.Errorf("Unknown flags: '%s'", string(fields[2]))
+	}
+	if len(fields) == 4 {
+		l.message = fields[3]
+	}
+	return l, nil
+}
+
+func pCRI(m []byte) ([]*model.SyslogMessage, error) {
+	m = bytes.TrimRight(m, "\r\n")
+	if len(m) == 0 {
+		return nil, EmptyMessageError
+	}
+	l, err := splitCRI(m)
+	if err != nil {
+		return nil, CRIDecodingError(err)
+	}
+	t, err := time.Parse(time.RFC3339Nano, string(l.timestamp))
+	if err != nil {
+		return nil, CRIDecodingError(err)
+	}
+	msg := model.Factory()
+	msg.TimeReportedNum = t.UnixNano()
+	msg.TimeGeneratedNum = time.Now().UnixNano()
+	msg.Message = string(l.message)
+	msg.Version = 1
+	msg.Facility = model.Fuser
+	msg.Severity = model.Sinfo
+	if string(l.stream) == "stderr" {
+		msg.Severity = model.Serr
+	}
+	msg.SetPriority()
+	msg.ClearDomain("cri")
+	msg.SetProperty("cri", "stream", string(l.stream))
+	if l.partial {
+		msg.SetProperty("cri", "partial", "true")
+	}
+	return []*model.SyslogMessage{msg}, nil
+}
+
+// criMaxPartials bounds the number of lines that a CRIJoiner joins at the
+// same time.
+const criMaxPartials = 4096
+
+// CRIJoiner reassembles the lines that the container runtime has split into
+// partial lines. The partial lines of a file are joined per stream, as the
+// stdout and stderr lines can be interleaved.
+//
+// The end of a line may never come, when the file is rotated or removed:
+// Expire returns the partial lines that have waited for too long.
+type CRIJoiner struct {
+	maxSize  int
+	maxAge   time.Duration
+	partials map[criKey]*criPending
+}
+
+type criKey struct {
+	filename string
+	stream   string
+}
+
+type criPending struct {
+	timestamp []byte
+	message   []byte
+	source    interface{}
+	updated   time.Time
+}
+
+// CRIPartial is a partial line whose end did not come in time.
+type CRIPartial struct {
+	Filename string
+	// Source is the source given to Join with the last part of the line
+	Source interface{}
+	// Line is the CRI line, with the P flag
+	Line []byte
+}
+
+// NewCRIJoiner creates a CRIJoiner. When the joined message of a line gets
+// larger than maxSize, it is emitted as is, and the rest of the line starts a
+// new message. A maxSize of 0 means no limit. The partial lines that have
+// not been continued for maxAge are returned by Expire.
+func NewCRIJoiner(maxSize int, maxAge time.Duration) *CRIJoiner {
+	return &CRIJoiner{
+		maxSize:  maxSize,
+		maxAge:   maxAge,
+		partials: make(map[criKey]*criPending),
+	}
+}
+
+// Join takes a line read from filename. It returns false when the line is
+// partial, and true with the full CRI line to parse otherwise. The full line
+// has the timestamp of its first part. The lines that are not valid CRI lines
+// are returned unchanged, for the parser to report. source is given back by
+// Expire.
+func (j *CRIJoiner) Join(filename string, source interface{}, line []byte) ([]byte, bool) {
+	l, err := splitCRI(bytes.TrimRight(line, "\r\n"))
+	if err != nil {
+		return line, true
+	}
+	key := criKey{filename: filename, stream: string(l.stream)}
+	pending := j.partials[key]
+	if !l.partial {
+		if pending == nil {
+			return line, true
+		}
+		delete(j.partials, key)
+		pending.message = append(pending.message, l.message...)
+		return pending.line(key.stream), true
+	}
+	if pending == nil {
+		pending = &criPending{timestamp: append([]byte(nil), l.timestamp...)}
+		j.partials[key] = pending
+	}
+	pending.message = append(pending.message, l.message...)
+	pending.source = source
+	pending.updated = time.Now()
+	if j.maxSize > 0 && len(pending.message) >= j.maxSize {
+		delete(j.partials, key)
+		return pending.line(key.stream), true
+	}
+	return nil, false
+}
+
+// Expire removes the partial lines that have not been continued since
+// maxAge before now, and the oldest ones when too many lines are joined at
+// the same time. They are returned, so that what was received is not lost.
+func (j *CRIJoiner) Expire(now time.Time) (expired []CRIPartial) {
+	var keys, kept []criKey
+	for key, pending := range j.partials {
+		if j.maxAge > 0 && now.Sub(pending.updated) >= j.maxAge {
+			keys = append(keys, key)
+		} else {
+			kept = append(kept, key)
+		}
+	}
+	if extra := len(kept) - criMaxPartials; extra > 0 {
+		// the least recently continued lines go first
+		sort.Slice(kept, func(a, b int) bool {
+			return j.partials[kept[a]].updated.Before(j.partials[kept[b]].updated)
+		})
+		keys = append(keys, kept[:extra]...)
+	}
+	for _, key := range keys {
+		pending := j.partials[key]
+		delete(j.partials, key)
+		expired = append(expired, CRIPartial{
+			Filename: key.filename,
+			Source:   pending.source,
+			Line:     pending.lineWithFlag(key.stream, criPartial),
+		})
+	}
+	return expired
+}
+
+func (p *criPending) line(stream string) []byte {
+	return p.lineWithFlag(stream, criFull)
+}
+
+func (p *criPending) lineWithFlag(stream string, flag string) []byte {
+	l := make([]byte, 0, len(p.timestamp)+len(stream)+len(p.message)+4)
+	l = append(l, p.timestamp...)
+	l = append(l, ' ')
+	l = append(l, stream...)
+	l = append(l, ' ')
+	l = append(l, flag...)
+	l = append(l, ' ')
+	return append(l, p.message...)
+}
+
+// KubernetesMetadata extracts the pod, namespace and container from the path
+// of a container log file written by the kubelet. It returns nil when the path
+// does not look like one. The kubelet writes the logs under
+// /var/log/pods/<namespace>_<pod>_<pod uid>/<container>/<restart>.log, and
+// links them as /var/log/containers/<pod>_<namespace>_<container>-<id>.log.
+func KubernetesMetadata(filename string) map[string]string {
+	dir, name := filepath.Split(filepath.Clean(filename))
+	dir = filepath.Clean(dir)
+	if filepath.Base(dir) == "containers" && strings.HasSuffix(name, ".log") {
+		parts := strings.SplitN(strings.TrimSuffix(name, ".log"), "_", 3)
+		if len(parts) != 3 {
+			return nil
+		}
+		i := strings.LastIndexByte(parts[2], '-')
+		if i <= 0 || i == len(parts[2])-1 {
+			return nil
+		}
+		return map[string]string{
+			"pod":          parts[0],
+			"namespace":    parts[1],
+			"container":    parts[2][:i],
+			"container_id": parts[2][i+1:],
+		}
+	}
+	if !strings.Contains(name, ".log") {
+		return nil
+	}
+	container := filepath.Base(dir)
+	podDir := filepath.Dir(dir)
+	if filepath.Base(filepath.Dir(podDir)) != "pods" {
+		return nil
+	}
+	parts := strings.SplitN(filepath.Base(podDir), "_", 3)
+	if len(parts) != 3 {
+		return nil
+	}
+	return map[string]string{
+		"namespace": parts[0],
+		"pod":       parts[1],
+		"pod_uid":   parts[2],
+		"container": container,
+	}
+}
@@ -0,0 +1,159 @@
+package decoders
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCRIJoin(t *testing.T) {
+	j := NewCRIJoiner(0, time.Minute)
+	lines := []string{
+		"2019-01-01T00:00:00.1Z stdout P hello ",
+		"2019-01-01T00:00:00.2Z stderr F oops",
+		"2019-01-01T00:00:00.3Z stdout P big ",
+		"2019-01-01T00:00:00.4Z stdout F world",
+		"2019-01-01T00:00:00.5Z stdout F single\n",
+	}
+	expected := []string{
+		"2019-01-01T00:00:00.2Z stderr F oops",
+		"2019-01-01T00:00:00.1Z stdout F hello big world",
+		"2019-01-01T00:00:00.5Z stdout F single\n",
+	}
+	var joined []string
+	for _, line := range lines {
+		if full, ok := j.Join("/var/log/containers/a.log", nil, []byte(line)); ok {
+			joined = append(joined, string(full))
+		}
+	}
+	if len(joined) != len(expected) {
+		t.Fatalf("expected %d lines, got %d: %q", len(expected), len(joined), joined)
+	}
+	for i := range expected {
+		if joined[i] != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], joined[i])
+		}
+	}
+
+	// the partial lines of different files are not mixed
+	if _, ok := j.Join("a.log", nil, []byte("2019-01-01T00:00:00Z stdout P a")); ok {
+		t.Fatal("partial line should be kept")
+	}
+	full, ok := j.Join("b.log", nil, []byte("2019-01-01T00:00:00Z stdout F b"))
+	if !ok || string(full) != "2019-01-01T00:00:00Z stdout F b" {
+		t.Fatalf("unexpected line: %q", full)
+	}
+}
+
+func TestCRIJoinMaxSize(t *testing.T) {
+	j := NewCRIJoiner(8, time.Minute)
+	if _, ok := j.Join("a.log", nil, []byte("2019-01-01T00:00:00Z stdout P abcd")); ok {
+		t.Fatal("partial line should be kept")
+	}
+	full, ok := j.Join("a.log", nil, []byte("2019-01-01T00:00:00Z stdout P efgh"))
+	if !ok || string(full) != "2019-01-01T00:00:00Z stdout F abcdefgh" {
+		t.Fatalf("the line should be emitted at the max size: %q", full)
+	}
+	full, ok = j.Join("a.log", nil, []byte("2019-01-01T00:00:01Z stdout F ij"))
+	if !ok || string(full) != "2019-01-01T00:00:01Z stdout F ij" {
+		t.Fatalf("unexpected line: %q", full)
+	}
+}
+
+func TestCRIJoinExpire(t *testing.T) {
+	j := NewCRIJoiner(0, time.Minute)
+	if _, ok := j.Join("rotated.log", "source", []byte("2019-01-01T00:00:00Z stdout P never ")); ok {
+		t.Fatal("partial line should be kept")
+	}
+	if _, ok := j.Join("rotated.log", "source", []byte("2019-01-01T00:00:01Z stdout P ends")); ok {
+		t.Fatal("partial line should be kept")
+	}
+	if expired := j.Expire(time.Now()); len(expired) != 0 {
+		t.Fatalf("the partial line should wait for its end: %v", expired)
+	}
+
+	// the file was rotated: the end of the line never comes
+	expired := j.Expire(time.Now().Add(time.Minute))
+	if len(expired) != 1 {
+		t.Fatalf("expected one expired line, got %d", len(expired))
+	}
+	p := expired[0]
+	if p.Filename != "rotated.log" || p.Source != "source" || string(p.Line) != "2019-01-01T00:00:00Z stdout P never ends" {
+		t.Fatalf("unexpected expired line: %+v", p)
+	}
+	msgs, err := pCRI(p.Line)
+	if err != nil || len(msgs) != 1 || msgs[0].Message != "never ends" {
+		t.Fatalf("the expired line should be parsed as a partial line: %v", err)
+	}
+	if expired := j.Expire(time.Now().Add(time.Hour)); len(expired) != 0 {
+		t.Fatalf("the line should be expired once: %v", expired)
+	}
+}
+
+func TestCRIJoinMaxPartials(t *testing.T) {
+	j := NewCRIJoiner(0, time.Hour)
+	for i := 0; i < criMaxPartials+10; i++ {
+		filename := fmt.Sprintf("%d.log", i)
+		if _, ok := j.Join(filename, nil, []byte("2019-01-01T00:00:00Z stdout P partial")); ok {
+			t.Fatal("partial line should be kept")
+		}
+	}
+	if expired := j.Expire(time.Now()); len(expired) != 10 {
+		t.Fatalf("the lines beyond the limit should be expired, got %d", len(expired))
+	}
+	if len(j.partials) != criMaxPartials {
+		t.Fatalf("expected %d partial lines, got %d", criMaxPartials, len(j.partials))
+	}
+}
+
+func TestCRIParse(t *testing.T) {
+	msgs, err := pCRI([]byte("2019-01-01T00:00:00.123456789Z stderr F hello world\n"))
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("message was not parsed: %v", err)
+	}
+	msg := msgs[0]
+	if msg.Message != "hello world" {
+		t.Errorf("unexpected message: %q", msg.Message)
+	}
+	if msg.TimeReportedNum != 1546300800123456789 {
+		t.Errorf("unexpected timestamp: %d", msg.TimeReportedNum)
+	}
+	if msg.GetProperty("cri", "stream") != "stderr" {
+		t.Errorf("unexpected stream: %q", msg.GetProperty("cri", "stream"))
+	}
+	for _, bad := range []string{"", "2019-01-01T00:00:00Z stdout", "2019-01-01T00:00:00Z stdout X msg", "yesterday stdout F msg"} {
+		if _, err := pCRI([]byte(bad)); err == nil {
+			t.Errorf("%q should not be parsed", bad)
+		}
+	}
+}
+
+func TestKubernetesMetadata(t *testing.T) {
+	tests := []struct {
+		filename string
+		expected map[string]string
+	}{
+		{
+			"/var/log/containers/web-5d8f_prod_nginx-0123abcd.log",
+			map[string]string{"pod": "web-5d8f", "namespace": "prod", "container": "nginx", "container_id": "0123abcd"},
+		},
+		{
+			"/var/log/pods/prod_web-5d8f_6f1c-22aa/nginx/0.log",
+			map[string]string{"pod": "web-5d8f", "namespace": "prod", "container": "nginx", "pod_uid": "6f1c-22aa"},
+		},
+		{"/var/log/syslog", nil},
+		{"/var/log/containers/nounderscore.log", nil},
+	}
+	for _, test := range tests {
+		meta := KubernetesMetadata(test.filename)
+		if len(meta) != len(test.expected) {
+			t.Errorf("%s: unexpected metadata: %v", test.filename, meta)
+			continue
+		}
+		for k, v := range test.expected {
+			if meta[k] != v {
+				t.Errorf("%s: expected %s=%s, got %s", test.filename, k, v, meta[k])
+			}
+		}
+	}
+}
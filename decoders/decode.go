@@ -1,9 +1,12 @@
 package decoders
 
 import (
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/inconshreveable/log15"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stephane-martin/skewer/conf"
 	"github.com/stephane-martin/skewer/decoders/base"
 	"github.com/stephane-martin/skewer/javascript"
@@ -26,6 +29,7 @@ var parsers = map[base.Format](func([]byte) ([]*model.SyslogMessage, error)){
 	base.Protobuf:    pProtobuf,
 	base.Collectd:    pCollectd,
 	base.LTSV:        pLTSV,
+	base.CRI:         pCRI,
 	base.W3C:         nil,
 }
 
@@ -60,23 +64,54 @@ func (p *jsParser) Parse(m []byte) ([]*model.SyslogMessage, error) {
 	return p.baseParser(m)
 }
 
+// UnknownParserCounter counts the messages whose format does not match any
+// parser.
+var UnknownParserCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "skw_unknown_parser_total",
+		Help: "number of messages whose format does not match any parser",
+	},
+	[]string{"format"},
+)
+
+// ParserFallbackCounter counts the messages of the sources with fallback
+// formats, by the parser that finally succeeded.
+var ParserFallbackCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "skw_parser_fallback_total",
+		Help: "number of messages parsed by a source with fallback formats, by the parser that succeeded",
+	},
+	[]string{"format", "parser"},
+)
+
 // ParsersEnv encapsulates JS and Golang parsers.
 type ParsersEnv struct {
 	sync.Mutex
-	parserCache *gotomic.Hash
-	jsFuncs     map[string]string
-	jsEnvsPool  *sync.Pool
-	logger      log15.Logger
+	parserCache  *gotomic.Hash
+	jsFuncs      map[string]string
+	jsEnvsPool   *sync.Pool
+	regexParsers map[string]*regexParser
+	logger       log15.Logger
 }
 
 func NewParsersEnv(config []conf.ParserConfig, logger log15.Logger) *ParsersEnv {
 	env := ParsersEnv{
-		jsFuncs:     make(map[string]string, len(config)),
-		logger:      logger,
-		parserCache: gotomic.NewHash(),
+		jsFuncs:      make(map[string]string, len(config)),
+		regexParsers: make(map[string]*regexParser),
+		logger:       logger,
+		parserCache:  gotomic.NewHash(),
 	}
 	for _, c := range config {
-		env.jsFuncs[c.Name] = c.Func
+		if len(c.Regex) == 0 {
+			env.jsFuncs[c.Name] = c.Func
+			continue
+		}
+		p, err := newRegexParser(c)
+		if err != nil {
+			logger.Warn("Error initializing parser", "name", c.Name, "error", err)
+			continue
+		}
+		env.regexParsers[c.Name] = p
 	}
 	env.jsEnvsPool = &sync.Pool{New: env.newJSEnv}
 	return &env
@@ -106,13 +141,71 @@ func (e *ParsersEnv) Parse(c *conf.DecoderBaseConfig, m []byte) ([]*model.Syslog
 	if c == nil {
 		return nil, eerrors.Fatal(eerrors.New("Decoder config is NIL"))
 	}
+	syslogMsgs, err := e.parseFallbacks(c, m)
+	if err != nil && c.ParseErrorAction == "quarantine" && !eerrors.IsFatal(err) {
+		return []*model.SyslogMessage{quarantinedMessage(c, m, err)}, nil
+	}
+	return syslogMsgs, err
+}
+
+// parseFallbacks parses m with the format of c, then with the fallback
+// formats.
+func (e *ParsersEnv) parseFallbacks(c *conf.DecoderBaseConfig, m []byte) ([]*model.SyslogMessage, error) {
+	syslogMsgs, err := e.parse(c, m)
+	if len(c.FallbackFormats) == 0 {
+		return syslogMsgs, err
+	}
+	if err == nil {
+		ParserFallbackCounter.WithLabelValues(c.Format, c.Format).Inc()
+		return syslogMsgs, nil
+	}
+	if eerrors.IsFatal(err) {
+		return nil, err
+	}
+	// try the fallback formats in order. the error of the first format is
+	// returned when they all fail.
+	for _, format := range strings.Split(c.FallbackFormats, ",") {
+		if format == "raw" {
+			ParserFallbackCounter.WithLabelValues(c.Format, format).Inc()
+			return []*model.SyslogMessage{rawMessage(m)}, nil
+		}
+		fallback := *c
+		fallback.Format = format
+		fallback.FallbackFormats = ""
+		msgs, ferr := e.parse(&fallback, m)
+		if ferr == nil {
+			ParserFallbackCounter.WithLabelValues(c.Format, format).Inc()
+			return msgs, nil
+		}
+		if eerrors.IsFatal(ferr) {
+			return nil, ferr
+		}
+	}
+	return nil, err
+}
+
+func (e *ParsersEnv) parse(c *conf.DecoderBaseConfig, m []byte) ([]*model.SyslogMessage, error) {
 	parser, err := e.getParser(c)
-	if parser == nil || err != nil {
+	if err == nil && parser == nil {
+		err = ErrorUnknownFormat(c.Format)
+	}
+	if eerrors.Is("UnknownParser", err) {
+		UnknownParserCounter.WithLabelValues(c.Format).Inc()
+		if c.UnknownParserAction == "fail" {
+			return nil, eerrors.Fatal(err)
+		}
+		return nil, err
+	}
+	if err != nil {
 		return nil, DecodingError(eerrors.Wrapf(err, "Unknown decoder: %s", c.Format))
 	}
 	syslogMsgs, err := parser.Parse(m)
 	parser.Release()
 	if err != nil {
+		if c.RFC5424RejectAction == "forward" && eerrors.Is("RFC5424Conformance", err) {
+			// dead letter: deliver the non conforming message unparsed
+			return []*model.SyslogMessage{rejectedMessage(m, err)}, nil
+		}
 		return nil, DecodingError(eerrors.Wrap(err, "Parsing error"))
 	}
 	return syslogMsgs, nil
@@ -121,6 +214,10 @@ func (e *ParsersEnv) Parse(c *conf.DecoderBaseConfig, m []byte) ([]*model.Syslog
 func (e *ParsersEnv) getParser(c *conf.DecoderBaseConfig) (p Parser, err error) {
 	frmt := base.ParseFormat(c.Format)
 	if frmt == -1 {
+		if p, ok := e.regexParsers[c.Format]; ok {
+			// the lines are decoded with the charset, like the syslog formats
+			return &nativeParser{baseParser: parserWithEncoding(base.RFC3164, c.Charset, p.parse)}, nil
+		}
 		// look for a JS function
 		return e.getJSParser(c.Format)
 	}
@@ -130,7 +227,7 @@ func (e *ParsersEnv) getParser(c *conf.DecoderBaseConfig) (p Parser, err error)
 
 func (e *ParsersEnv) getJSParser(funcName string) (*jsParser, error) {
 	if _, ok := e.jsFuncs[funcName]; !ok {
-		return nil, DecodingError(eerrors.Errorf("Unknown decoder: '%s'", funcName))
+		return nil, ErrorUnknownFormat(funcName)
 	}
 	jsEnv := e.getJSEnv()
 	baseParser, err := jsEnv.GetParser(funcName)
@@ -160,14 +257,26 @@ func (e *ParsersEnv) getNonJSParser(frmt base.Format, c *conf.DecoderBaseConfig)
 			return nil, DecodingError(eerrors.New("No fields specified for W3C Extended Log Format decoder"))
 		}
 		p = W3CDecoder(c.W3CFields)
+	} else if frmt == base.RFC5424 && (len(c.SkipSDIDs) > 0 || len(c.KeepSDIDs) > 0) {
+		// RFC5424 parser may be parametrized to skip some structured data
+		p = p5424SDFilter(c.SkipSDIDs, c.KeepSDIDs, c.SDDuplicatePolicy)
+	} else if frmt == base.RFC5424 && c.SDDuplicatePolicy != "" && c.SDDuplicatePolicy != "last" {
+		p = p5424SDDuplicates(c.SDDuplicatePolicy)
 	} else {
 		p = parsers[frmt]
 	}
+	if frmt == base.RFC5424 && c.RFC5424Strict {
+		// the strict validation is done before, and apart from, the lenient parser
+		p = p5424Strict(p)
+	}
 	// add a decoding step to deal with charsets
 	p = parserWithEncoding(frmt, c.Charset, p)
 	// now the parser has been built. cache it so that we don't have to build it again later.
 	// we assume that the parser func is "pure" and "thread-safe".
-	e.parserCache.Put(c, p)
+	// the cache is keyed by a copy of the config: c may belong to a pooled
+	// raw message, that is modified when it is reused.
+	key := *c
+	e.parserCache.Put(&key, p)
 	return &nativeParser{baseParser: p}, nil
 }
 
@@ -182,7 +291,7 @@ func parserWithEncoding(frmt base.Format, charset string, p func([]byte) ([]*mod
 			}
 			return p(m)
 		}
-	case base.JSON, base.RsyslogJSON, base.GELF, base.InfluxDB, -1:
+	case base.JSON, base.RsyslogJSON, base.GELF, base.InfluxDB, base.CRI, -1:
 		return func(m []byte) ([]*model.SyslogMessage, error) {
 			var err error
 			m, err = unicode.UTF8.NewDecoder().Bytes(m)
@@ -197,3 +306,12 @@ func parserWithEncoding(frmt base.Format, charset string, p func([]byte) ([]*mod
 		return p
 	}
 }
+
+// rawMessage builds a message that delivers m unparsed.
+func rawMessage(m []byte) *model.SyslogMessage {
+	msg := model.Factory()
+	msg.TimeGeneratedNum = time.Now().UnixNano()
+	msg.TimeReportedNum = msg.TimeGeneratedNum
+	msg.Message = string(m)
+	return msg
+}
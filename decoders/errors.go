@@ -3,7 +3,10 @@ package decoders
 import "github.com/stephane-martin/skewer/utils/eerrors"
 
 func ErrorUnknownFormat(format string) error {
-	return DecodingError(eerrors.Errorf("Unknown decoder: '%s'", format))
+	return eerrors.WithTypes(
+		DecodingError(eerrors.Errorf("Unknown decoder: '%s'", format)),
+		"UnknownParser",
+	)
 }
 
 func InvalidTopicError(topic string) error {
@@ -62,3 +65,15 @@ func NotEnoughPartsError(nb int) error {
 		eerrors.Errorf("The message does not have enough parts: %d, but minimum is 7", nb),
 	)
 }
+
+func CRIDecodingError(err error) error {
+	return DecodingError(
+		eerrors.Wrap(err, "Error decoding CRI log line"),
+	)
+}
+
+func RegexDecodingError(err error) error {
+	return DecodingError(
+		eerrors.Wrap(err, "Error decoding message with regex parser"),
+	)
+}
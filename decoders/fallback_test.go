@@ -0,0 +1,66 @@
+package decoders
+
+import (
+	"testing"
+
+	"github.com/inconshreveable/log15"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+func counterValue(c prometheus.Counter) float64 {
+	m := &dto.Metric{}
+	_ = c.Write(m)
+	return m.GetCounter().GetValue()
+}
+
+func TestParseFallbackChain(t *testing.T) {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	env := NewParsersEnv(nil, logger)
+	c := conf.DecoderBaseConfig{Format: "rfc5424", Charset: "utf8", FallbackFormats: "json,raw"}
+
+	tests := []struct {
+		parser  string
+		message string
+	}{
+		{"rfc5424", rfc5424Examples[2]},
+		{"json", `{"message": "hello", "host": "example"}`},
+		{"raw", "neither syslog nor json"},
+	}
+	for _, test := range tests {
+		counter := ParserFallbackCounter.WithLabelValues("rfc5424", test.parser)
+		before := counterValue(counter)
+		msgs, err := env.Parse(&c, []byte(test.message))
+		if err != nil || len(msgs) != 1 {
+			t.Fatalf("%s: message was not parsed: %v", test.parser, err)
+		}
+		if counterValue(counter) != before+1 {
+			t.Errorf("%s: the successful parser was not counted", test.parser)
+		}
+		if test.parser == "raw" && msgs[0].Message != test.message {
+			t.Errorf("unexpected raw message: %q", msgs[0].Message)
+		}
+	}
+}
+
+func TestParseFallbackAllFail(t *testing.T) {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	env := NewParsersEnv(nil, logger)
+	c := conf.DecoderBaseConfig{Format: "rfc5424", Charset: "utf8", FallbackFormats: "json"}
+
+	_, err := env.Parse(&c, []byte("neither syslog nor json"))
+	if err == nil || !eerrors.Is("Decoding", err) {
+		t.Fatalf("expected a decoding error when all the parsers fail, got: %v", err)
+	}
+
+	// an unknown fallback format is skipped
+	c.FallbackFormats = "nosuchparser,json"
+	msgs, err := env.Parse(&c, []byte(`{"message": "hello"}`))
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("the next fallback format should have been tried: %v", err)
+	}
+}
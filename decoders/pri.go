@@ -0,0 +1,53 @@
+package decoders
+
+import (
+	"github.com/stephane-martin/skewer/model"
+)
+
+// DefaultPriority is the priority of the messages that do not start with a
+// valid PRI: user.notice, as RFC3164 section 4.3.3 says.
+const DefaultPriority = model.Priority(int(model.Fuser)*8 + int(model.Snotice))
+
+// ParsePRI extracts the PRI ("<N>") at the start of a raw syslog message,
+// without parsing the rest of it, so that the message can be filtered or
+// routed by severity before the full parse. It returns the priority and the
+// length of the PRI part. When m does not start with a valid PRI, ParsePRI
+// returns DefaultPriority and 0. A valid PRIVAL has 1 to 3 digits and is at
+// most 191.
+//
+// ParsePRI does not allocate.
+func ParsePRI(m []byte) (pri model.Priority, n int) {
+	if len(m) < 3 || m[0] != '<' {
+		return DefaultPriority, 0
+	}
+	val := 0
+	i := 1
+	for ; i < len(m) && i <= 4; i++ {
+		c := m[i]
+		if c == '>' {
+			break
+		}
+		if c < '0' || c > '9' {
+			return DefaultPriority, 0
+		}
+		val = val*10 + int(c-'0')
+	}
+	if i == 1 || i > 4 || i == len(m) || m[i] != '>' || val > 191 {
+		return DefaultPriority, 0
+	}
+	return model.Priority(val), i + 1
+}
+
+// PRISeverity returns the severity of the PRI at the start of m, or the
+// severity of DefaultPriority.
+func PRISeverity(m []byte) model.Severity {
+	pri, _ := ParsePRI(m)
+	return model.Severity(pri % 8)
+}
+
+// PRIFacility returns the facility of the PRI at the start of m, or the
+// facility of DefaultPriority.
+func PRIFacility(m []byte) model.Facility {
+	pri, _ := ParsePRI(m)
+	return model.Facility(pri / 8)
+}
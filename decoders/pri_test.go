@@ -0,0 +1,85 @@
+package decoders
+
+import (
+	"testing"
+
+	"github.com/stephane-martin/skewer/model"
+)
+
+func TestParsePRI(t *testing.T) {
+	tests := []struct {
+		in  string
+		pri model.Priority
+		n   int
+	}{
+		{"<34>1 2003-10-11T22:14:15.003Z mymachine su - ID47 - msg", 34, 4},
+		{"<0>Oct 11 22:14:15 host app: msg", 0, 3},
+		{"<191>", 191, 5},
+		{"<013>msg", 13, 5},
+		// no PRI
+		{"", DefaultPriority, 0},
+		{"just a message", DefaultPriority, 0},
+		{" <34>leading space", DefaultPriority, 0},
+		// malformed PRI
+		{"<", DefaultPriority, 0},
+		{"<>", DefaultPriority, 0},
+		{"<>msg", DefaultPriority, 0},
+		{"<34", DefaultPriority, 0},
+		{"<34 msg", DefaultPriority, 0},
+		{"<192>msg", DefaultPriority, 0},
+		{"<1234>msg", DefaultPriority, 0},
+		{"<-1>msg", DefaultPriority, 0},
+		{"<+5>msg", DefaultPriority, 0},
+		{"<3a>msg", DefaultPriority, 0},
+		{"<0034>msg", DefaultPriority, 0},
+	}
+	for _, test := range tests {
+		pri, n := ParsePRI([]byte(test.in))
+		if pri != test.pri || n != test.n {
+			t.Errorf("%q: expected (%d, %d), got (%d, %d)", test.in, test.pri, test.n, pri, n)
+		}
+	}
+	if PRISeverity([]byte("<34>msg")) != model.Scrit || PRIFacility([]byte("<34>msg")) != model.Fauth {
+		t.Error("wrong severity or facility for <34>")
+	}
+	if PRISeverity([]byte("msg")) != model.Snotice || PRIFacility([]byte("msg")) != model.Fuser {
+		t.Error("a message without PRI should be user.notice")
+	}
+}
+
+func TestParsePRIAllocs(t *testing.T) {
+	m := []byte("<165>1 2003-08-24T05:14:15.000003-07:00 192.0.2.1 myproc 8710 - - msg")
+	allocs := testing.AllocsPerRun(100, func() {
+		ParsePRI(m)
+		PRISeverity(m)
+	})
+	if allocs != 0 {
+		t.Errorf("ParsePRI should not allocate, got %v allocations", allocs)
+	}
+}
+
+func FuzzParsePRI(f *testing.F) {
+	for _, seed := range []string{"<34>1 msg", "<191>", "<192>", "<>", "<", "<9999999999999999999>", "msg", "<0>"} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, m []byte) {
+		pri, n := ParsePRI(m)
+		// the strict RFC5424 validation agrees on the PRI part
+		pos, v := validatePri(m)
+		if (v == nil) != (n > 0) || (v == nil && pos != n) {
+			t.Fatalf("%q: ParsePRI and validatePri disagree", m)
+		}
+		if n == 0 {
+			if pri != DefaultPriority {
+				t.Fatalf("%q: expected the default priority, got %d", m, pri)
+			}
+			return
+		}
+		if n < 3 || n > 5 || n > len(m) || m[0] != '<' || m[n-1] != '>' {
+			t.Fatalf("%q: invalid PRI length %d", m, n)
+		}
+		if pri < 0 || pri > 191 {
+			t.Fatalf("%q: PRI out of range: %d", m, pri)
+		}
+	})
+}
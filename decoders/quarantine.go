@@ -0,0 +1,49 @@
+package decoders
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// QuarantinedCounter counts the messages that could not be parsed and were
+// delivered unparsed to the quarantine, by the kind of parsing error.
+var QuarantinedCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "skw_quarantined_messages_total",
+		Help: "number of messages that could not be parsed and were delivered to the quarantine",
+	},
+	[]string{"format", "reason"},
+)
+
+// quarantineReason classifies the error of a message that could not be
+// parsed.
+func quarantineReason(err error) string {
+	if eerrors.Is("UnknownParser", err) {
+		return "unknown_parser"
+	}
+	if eerrors.Is("RFC5424Conformance", err) {
+		return "rfc5424_violation"
+	}
+	return "decoding"
+}
+
+// quarantinedMessage builds the message that delivers the raw bytes of a
+// message that could not be parsed. The source metadata are added by the
+// services, as for the parsed messages.
+func quarantinedMessage(c *conf.DecoderBaseConfig, m []byte, err error) *model.SyslogMessage {
+	reason := quarantineReason(err)
+	QuarantinedCounter.WithLabelValues(c.Format, reason).Inc()
+	msg := rawMessage(m)
+	msg.SetProperty("skewer", "quarantine", reason)
+	msg.SetProperty("skewer", "parse_error", err.Error())
+	msg.SetProperty("skewer", "format", c.Format)
+	return msg
+}
+
+// Quarantined returns true when msg is the raw content of a message that
+// could not be parsed.
+func Quarantined(msg *model.SyslogMessage) bool {
+	return msg.GetProperty("skewer", "quarantine") != ""
+}
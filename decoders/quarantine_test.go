@@ -0,0 +1,58 @@
+package decoders
+
+import (
+	"testing"
+
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+func TestParseErrorQuarantine(t *testing.T) {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	env := NewParsersEnv(nil, logger)
+	invalid := []byte("{not json")
+
+	drop := conf.DecoderBaseConfig{Format: "json", Charset: "utf8", ParseErrorAction: "drop"}
+	quarantine := conf.DecoderBaseConfig{Format: "json", Charset: "utf8", ParseErrorAction: "quarantine"}
+
+	_, err := env.Parse(&drop, invalid)
+	if !eerrors.Is("Decoding", err) {
+		t.Fatalf("expected a decoding error, got: %v", err)
+	}
+
+	msgs, err := env.Parse(&quarantine, invalid)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("the message was not quarantined: %v", err)
+	}
+	if msgs[0].Message != string(invalid) || !Quarantined(msgs[0]) {
+		t.Fatalf("unexpected quarantined message: %q %v", msgs[0].Message, msgs[0].GetAllProperties())
+	}
+	if msgs[0].GetProperty("skewer", "quarantine") != "decoding" || msgs[0].GetProperty("skewer", "format") != "json" {
+		t.Fatalf("unexpected quarantine properties: %v", msgs[0].GetAllProperties())
+	}
+	if msgs[0].GetProperty("skewer", "parse_error") == "" {
+		t.Fatal("the parse error should be delivered with the message")
+	}
+
+	// the messages are quarantined when all the fallback formats failed
+	quarantine.FallbackFormats = "rfc5424"
+	msgs, err = env.Parse(&quarantine, invalid)
+	if err != nil || len(msgs) != 1 || !Quarantined(msgs[0]) {
+		t.Fatalf("the message was not quarantined: %v", err)
+	}
+
+	unknown := conf.DecoderBaseConfig{Format: "nosuchparser", ParseErrorAction: "quarantine", UnknownParserAction: "skip"}
+	msgs, err = env.Parse(&unknown, invalid)
+	if err != nil || len(msgs) != 1 || msgs[0].GetProperty("skewer", "quarantine") != "unknown_parser" {
+		t.Fatalf("the message with an unknown format was not quarantined: %v", err)
+	}
+
+	// the fatal errors still stop the source
+	unknown.UnknownParserAction = "fail"
+	_, err = env.Parse(&unknown, invalid)
+	if !eerrors.IsFatal(err) {
+		t.Fatalf("expected a fatal error, got: %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package decoders
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// regexParser is a decoder defined in the configuration by a regular
+// expression with named groups.
+type regexParser struct {
+	name       string
+	re         *regexp.Regexp
+	fields     []string
+	timeFormat string
+	maxLength  int
+}
+
+func newRegexParser(c conf.ParserConfig) (*regexParser, error) {
+	re, err := c.CompileRegex()
+	if err != nil {
+		return nil, err
+	}
+	groups, err := c.RegexFields(re)
+	if err != nil {
+		return nil, err
+	}
+	p := &regexParser{
+		name:       c.Name,
+		re:         re,
+		fields:     make([]string, len(re.SubexpNames())),
+		timeFormat: c.TimeFormat,
+		maxLength:  c.MaxLength,
+	}
+	for i, group := range re.SubexpNames() {
+		p.fields[i] = groups[group]
+	}
+	if len(p.timeFormat) == 0 {
+		p.timeFormat = time.RFC3339
+	}
+	return p, nil
+}
+
+// match returns the indexes of the groups of the regex in s. The match runs
+// in linear time, so that bounding the size of s bounds its duration.
+func (p *regexParser) match(s string) ([]int, error) {
+	if p.maxLength > 0 && len(s) > p.maxLength {
+		return nil, eerrors.Errorf("The message exceeds the maximum length of %d bytes", p.maxLength)
+	}
+	return p.re.FindStringSubmatchIndex(s), nil
+}
+
+func (p *regexParser) parse(m []byte) ([]*model.SyslogMessage, error) {
+	s := strings.TrimRight(string(m), "\r\n")
+	if len(s) == 0 {
+		return nil, EmptyMessageError
+	}
+	loc, err := p.match(s)
+	if err != nil {
+		return nil, RegexDecodingError(err)
+	}
+	if loc == nil {
+		return nil, RegexDecodingError(eerrors.Errorf("The message does not match the regex of parser '%s'", p.name))
+	}
+	msg := model.Factory()
+	msg.TimeGeneratedNum = time.Now().UnixNano()
+	msg.TimeReportedNum = msg.TimeGeneratedNum
+	msg.Message = s
+	msg.Version = 1
+	msg.Facility = model.Fuser
+	msg.Severity = model.Sinfo
+	priority := false
+	names := p.re.SubexpNames()
+	for i := 1; i < len(names); i++ {
+		if len(names[i]) == 0 || loc[2*i] < 0 {
+			continue
+		}
+		value := s[loc[2*i]:loc[2*i+1]]
+		switch p.fields[i] {
+		case "":
+			msg.SetProperty(p.name, names[i], value)
+		case "hostname":
+			msg.HostName = value
+		case "appname":
+			msg.AppName = value
+		case "procid":
+			msg.ProcId = value
+		case "msgid":
+			msg.MsgId = value
+		case "message":
+			msg.Message = value
+		case "timereported":
+			t, err := time.Parse(p.timeFormat, value)
+			if err != nil {
+				model.Free(msg)
+				return nil, RegexDecodingError(eerrors.Wrap(err, "Invalid timestamp"))
+			}
+			msg.TimeReportedNum = t.UnixNano()
+		case "facility":
+			if n, err := strconv.Atoi(value); err == nil {
+				if _, ok := model.Facilities[model.Facility(n)]; ok {
+					msg.Facility = model.Facility(n)
+				}
+			} else if f, ok := model.RFacilities[strings.ToLower(value)]; ok {
+				msg.Facility = f
+			}
+		case "severity":
+			if n, err := strconv.Atoi(value); err == nil {
+				if _, ok := model.Severities[model.Severity(n)]; ok {
+					msg.Severity = model.Severity(n)
+				}
+			} else if sev, ok := model.RSeverities[strings.ToLower(value)]; ok {
+				msg.Severity = sev
+			}
+		case "priority":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 || n > 191 {
+				model.Free(msg)
+				return nil, ErrInvalidPriority
+			}
+			msg.Priority = model.Priority(n)
+			msg.Facility = model.Facility(n / 8)
+			msg.Severity = model.Severity(n % 8)
+			priority = true
+		}
+	}
+	if !priority {
+		msg.SetPriority()
+	}
+	return []*model.SyslogMessage{msg}, nil
+}
@@ -0,0 +1,79 @@
+package decoders
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+)
+
+func TestRegexParser(t *testing.T) {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	parser := conf.ParserConfig{
+		Name:       "firewall",
+		Regex:      `^(?P<ts>\S+ \S+) (?P<host>\S+) \[(?P<severity>\w+)\] action=(?P<action>\w+) (?P<message>.*)$`,
+		Fields:     "ts=timereported, host=hostname",
+		TimeFormat: "2006-01-02 15:04:05",
+		MaxLength:  1024,
+	}
+	env := NewParsersEnv([]conf.ParserConfig{parser}, logger)
+	c := conf.DecoderBaseConfig{Format: "firewall", Charset: "utf8"}
+
+	msgs, err := env.Parse(&c, []byte("2018-03-04 05:06:07 fw1 [warning] action=drop src=10.0.0.1 dst=10.0.0.2\n"))
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("the message was not parsed: %v", err)
+	}
+	msg := msgs[0]
+	if msg.HostName != "fw1" || msg.Message != "src=10.0.0.1 dst=10.0.0.2" {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+	if msg.Severity != model.SWarning || msg.Facility != model.Fuser {
+		t.Errorf("unexpected severity or facility: %s %s", msg.Severity, msg.Facility)
+	}
+	if msg.GetTimeReported() != time.Date(2018, 3, 4, 5, 6, 7, 0, time.UTC) {
+		t.Errorf("unexpected timestamp: %s", msg.GetTimeReported())
+	}
+	if action := msg.GetProperty("firewall", "action"); action != "drop" {
+		t.Errorf("the unmapped group should be a property: '%s'", action)
+	}
+
+	// the messages that do not match are decoding errors
+	_, err = env.Parse(&c, []byte("something else"))
+	if err == nil {
+		t.Fatal("the message should not match")
+	}
+	_, err = env.Parse(&c, []byte("2018-03-04T05:06:07 fw1 [warning] action=drop x"))
+	if err == nil {
+		t.Fatal("the invalid timestamp should be rejected")
+	}
+
+	// the messages longer than the limit are not matched
+	_, err = env.Parse(&c, []byte("2018-03-04 05:06:07 fw1 [warning] action=drop "+strings.Repeat("a", 1024)))
+	if err == nil || !strings.Contains(err.Error(), "maximum length") {
+		t.Fatalf("the long message should be rejected: %v", err)
+	}
+}
+
+func TestRegexParserConfig(t *testing.T) {
+	invalid := []conf.ParserConfig{
+		{Name: "syntax", Regex: `(?P<message>[a-`},
+		{Name: "backref", Regex: `(?P<word>\w+) \1`},
+		{Name: "unnamed", Regex: `(\w+) (\w+)`},
+		{Name: "groups", Regex: `(?P<message>` + strings.Repeat(`(a)`, conf.MaxRegexParserGroups) + `)`},
+		{Name: "mapping", Regex: `(?P<host>\S+)`, Fields: "host=nowhere"},
+		{Name: "missing", Regex: `(?P<host>\S+)`, Fields: "hostname=hostname"},
+	}
+	for _, c := range invalid {
+		re, err := c.CompileRegex()
+		if err == nil {
+			_, err = c.RegexFields(re)
+		}
+		if err == nil {
+			t.Errorf("%s: the parser configuration should be rejected", c.Name)
+		}
+	}
+}
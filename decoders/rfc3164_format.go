@@ -2,7 +2,6 @@ package decoders
 
 import (
 	"bytes"
-	"strconv"
 	"time"
 	uni "unicode"
 
@@ -37,30 +36,20 @@ func p3164(m []byte) ([]*model.SyslogMessage, error) {
 	defaultMsg[0].TimeReportedNum = n
 	smsg.TimeGeneratedNum = n
 
-	if !bytes.HasPrefix(m, []byte("<")) {
+	pri, priLen := ParsePRI(m)
+	if priLen == 0 {
 		model.Free(smsg)
 		return defaultMsg, nil
 	}
-	priEnd := bytes.Index(m, []byte(">"))
-	if priEnd <= 1 {
-		model.Free(smsg)
-		return defaultMsg, nil
-	}
-	priStr := m[1:priEnd]
-	priNum, err := strconv.Atoi(string(priStr))
-	if err != nil {
-		model.Free(smsg)
-		return defaultMsg, nil
-	}
-	smsg.Priority = model.Priority(priNum)
-	smsg.Facility = model.Facility(priNum / 8)
-	smsg.Severity = model.Severity(priNum % 8)
+	smsg.Priority = pri
+	smsg.Facility = model.Facility(pri / 8)
+	smsg.Severity = model.Severity(pri % 8)
 
-	if len(m) <= (priEnd + 1) {
+	if len(m) <= priLen {
 		model.Free(defaultMsg[0])
 		return []*model.SyslogMessage{smsg}, nil
 	}
-	m = bytes.TrimSpace(m[priEnd+1:])
+	m = bytes.TrimSpace(m[priLen:])
 	if len(m) == 0 {
 		model.Free(defaultMsg[0])
 		return []*model.SyslogMessage{smsg}, nil
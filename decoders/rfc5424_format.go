@@ -1,8 +1,11 @@
 package decoders
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -23,6 +26,18 @@ func init() {
 }
 
 func p5424(m []byte) ([]*model.SyslogMessage, error) {
+	return parse5424(m, "last")
+}
+
+// p5424SDDuplicates returns a RFC5424 decoder that applies the policy to the
+// SD params that appear several times in the same element.
+func p5424SDDuplicates(policy string) func([]byte) ([]*model.SyslogMessage, error) {
+	return func(m []byte) ([]*model.SyslogMessage, error) {
+		return parse5424(m, policy)
+	}
+}
+
+func parse5424(m []byte, sdDuplicates string) ([]*model.SyslogMessage, error) {
 	// TODO: multiple messages ?
 	parser := parser5424Pool.Get().(*rfc5424.RFC5424Parser)
 	defer parser5424Pool.Put(parser)
@@ -37,7 +52,7 @@ func p5424(m []byte) ([]*model.SyslogMessage, error) {
 	parser.SetErrorHandler(newErrorStrategy())
 	parser.BuildParseTrees = true
 	parser.GetInterpreter().SetPredictionMode(antlr.PredictionModeSLL)
-	listnr := newListener()
+	listnr := newListener(sdDuplicates)
 	antlr.ParseTreeWalkerDefault.Walk(listnr, parser.Full())
 
 	err := errListner.Err()
@@ -50,6 +65,114 @@ func p5424(m []byte) ([]*model.SyslogMessage, error) {
 	return []*model.SyslogMessage{listnr.GetMessage()}, nil
 }
 
+// p5424SDFilter returns a RFC5424 decoder that skips the structured data
+// elements listed in skip, or all the elements not listed in keep. The
+// elements are removed before the message is handed to the parser, so that
+// they are never materialized.
+func p5424SDFilter(skip, keep, sdDuplicates string) func([]byte) ([]*model.SyslogMessage, error) {
+	f := newSDFilter(skip, keep)
+	return func(m []byte) ([]*model.SyslogMessage, error) {
+		return parse5424(f.filter(m), sdDuplicates)
+	}
+}
+
+type sdFilter struct {
+	skip map[string]bool
+	keep map[string]bool
+}
+
+func sdIDSet(ids string) map[string]bool {
+	set := make(map[string]bool)
+	for _, id := range strings.Split(ids, ",") {
+		id = strings.TrimSpace(id)
+		if len(id) > 0 {
+			set[id] = true
+		}
+	}
+	return set
+}
+
+func newSDFilter(skip, keep string) *sdFilter {
+	f := sdFilter{skip: sdIDSet(skip)}
+	if len(strings.TrimSpace(keep)) > 0 {
+		f.keep = sdIDSet(keep)
+	}
+	return &f
+}
+
+func (f *sdFilter) wanted(sdid []byte) bool {
+	if f.keep != nil {
+		return f.keep[string(sdid)]
+	}
+	return !f.skip[string(sdid)]
+}
+
+// filter removes the unwanted structured data elements from m. When the
+// message can not be scanned, it is returned unmodified and the parser will
+// report the error.
+func (f *sdFilter) filter(m []byte) []byte {
+	// the structured data follows the 6 first header fields
+	pos := 0
+	for i := 0; i < 6; i++ {
+		idx := bytes.IndexByte(m[pos:], ' ')
+		if idx == -1 {
+			return m
+		}
+		pos += idx + 1
+	}
+	var out []byte
+	kept := 0
+	for pos < len(m) && m[pos] == '[' {
+		end := sdElementEnd(m, pos)
+		if end == -1 {
+			return m
+		}
+		idEnd := pos + 1
+		for idEnd < end && m[idEnd] != ' ' && m[idEnd] != ']' {
+			idEnd++
+		}
+		if f.wanted(m[pos+1 : idEnd]) {
+			kept++
+			if out != nil {
+				out = append(out, m[pos:end]...)
+			}
+		} else if out == nil {
+			// first skipped element: from now on we need a copy
+			out = make([]byte, 0, len(m))
+			out = append(out, m[:pos]...)
+		}
+		pos = end
+	}
+	if out == nil {
+		return m
+	}
+	if kept == 0 {
+		out = append(out, '-')
+	}
+	return append(out, m[pos:]...)
+}
+
+// sdElementEnd returns the position right after the structured data element
+// that starts at pos, or -1 if the element is not terminated.
+func sdElementEnd(m []byte, pos int) int {
+	quoted := false
+	for i := pos + 1; i < len(m); i++ {
+		switch m[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case ']':
+			if !quoted {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
+
 type errorStrategy struct {
 	*antlr.DefaultErrorStrategy
 }
@@ -94,12 +217,18 @@ type listener struct {
 	msg        *model.SyslogMessage
 	err        error
 	currentSID string
+	// sdDuplicates is the policy for the SD params that appear several times
+	// in the current element. With the "array" policy, sdValues collects the
+	// values of the params of the current element.
+	sdDuplicates string
+	sdValues     map[string][]string
 }
 
-func newListener() *listener {
+func newListener(sdDuplicates string) *listener {
 	return &listener{
 		BaseRFC5424Listener: &rfc5424.BaseRFC5424Listener{},
 		msg:                 model.Factory(),
+		sdDuplicates:        sdDuplicates,
 	}
 }
 
@@ -201,6 +330,9 @@ func (l *listener) ExitSid(ctx *rfc5424.SidContext) {
 		return
 	}
 	l.msg.ClearDomain(l.currentSID)
+	for name := range l.sdValues {
+		delete(l.sdValues, name)
+	}
 }
 
 func (l *listener) ExitParam(ctx *rfc5424.ParamContext) {
@@ -212,14 +344,38 @@ func (l *listener) ExitParam(ctx *rfc5424.ParamContext) {
 		return
 	}
 	name := ctx.Name()
-	value := ctx.Value()
-	if name != nil {
-		if value != nil {
-			l.msg.SetProperty(l.currentSID, name.GetText(), value.GetText())
-		} else {
-			l.msg.SetProperty(l.currentSID, name.GetText(), "")
+	if name == nil {
+		return
+	}
+	var value string
+	if ctx.Value() != nil {
+		value = ctx.Value().GetText()
+	}
+	l.setParam(name.GetText(), value)
+}
+
+// setParam sets the SD param of the current element, according to the
+// duplicates policy.
+func (l *listener) setParam(name, value string) {
+	switch l.sdDuplicates {
+	case "first":
+		if kv := l.msg.Properties.Map[l.currentSID]; kv != nil {
+			if _, ok := kv.Map[name]; ok {
+				return
+			}
+		}
+	case "array":
+		if l.sdValues == nil {
+			l.sdValues = make(map[string][]string)
+		}
+		values := append(l.sdValues[name], value)
+		l.sdValues[name] = values
+		if len(values) > 1 {
+			encoded, _ := json.Marshal(values)
+			value = string(encoded)
 		}
 	}
+	l.msg.SetProperty(l.currentSID, name, value)
 }
 
 func (l *listener) ExitMsg(ctx *rfc5424.MsgContext) {
@@ -0,0 +1,88 @@
+package decoders
+
+import (
+	"testing"
+
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/conf"
+)
+
+const sdMessage = `<13>1 2018-01-01T00:00:00Z host app - - [origin ip="10.0.0.1"][debug@32473 dump="a \"quoted\" ]"][meta@32473 seq="1"] hello`
+
+func parseSD(t *testing.T, c conf.DecoderBaseConfig) map[string]map[string]string {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	env := NewParsersEnv(nil, logger)
+	msgs, err := env.Parse(&c, []byte(sdMessage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("expected one message, got %d", len(msgs))
+	}
+	if msgs[0].Message != "hello" {
+		t.Fatalf("unexpected message body: %q", msgs[0].Message)
+	}
+	return msgs[0].GetAllProperties()
+}
+
+func TestRFC5424SkipSDIDs(t *testing.T) {
+	props := parseSD(t, conf.DecoderBaseConfig{Format: "rfc5424", Charset: "utf8", SkipSDIDs: "debug@32473"})
+	if _, ok := props["debug@32473"]; ok {
+		t.Fatal("skipped SD-ID has been parsed")
+	}
+	if props["origin"]["ip"] != "10.0.0.1" || props["meta@32473"]["seq"] != "1" {
+		t.Fatalf("kept SD-IDs are missing: %v", props)
+	}
+}
+
+func TestRFC5424KeepSDIDs(t *testing.T) {
+	props := parseSD(t, conf.DecoderBaseConfig{Format: "rfc5424", Charset: "utf8", KeepSDIDs: "origin"})
+	if props["origin"]["ip"] != "10.0.0.1" {
+		t.Fatalf("kept SD-ID is missing: %v", props)
+	}
+	if _, ok := props["debug@32473"]; ok {
+		t.Fatal("SD-ID not in the keep list has been parsed")
+	}
+	if _, ok := props["meta@32473"]; ok {
+		t.Fatal("SD-ID not in the keep list has been parsed")
+	}
+}
+
+func TestRFC5424SkipAllSDIDs(t *testing.T) {
+	props := parseSD(t, conf.DecoderBaseConfig{Format: "rfc5424", Charset: "utf8", SkipSDIDs: "origin, debug@32473,meta@32473"})
+	for domain := range props {
+		if domain == "origin" || domain == "debug@32473" || domain == "meta@32473" {
+			t.Fatalf("skipped SD-ID has been parsed: %s", domain)
+		}
+	}
+}
+
+func TestRFC5424SDDuplicates(t *testing.T) {
+	const dupMessage = `<13>1 2018-01-01T00:00:00Z host app - - [origin ip="10.0.0.1" ip="10.0.0.2" ip="10.0.0.3" software="app"][meta@32473 ip="10.0.0.4"] hello`
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	env := NewParsersEnv(nil, logger)
+	for policy, expected := range map[string]string{
+		"":      "10.0.0.3",
+		"last":  "10.0.0.3",
+		"first": "10.0.0.1",
+		"array": `["10.0.0.1","10.0.0.2","10.0.0.3"]`,
+	} {
+		for _, skip := range []string{"", "debug@32473"} {
+			c := conf.DecoderBaseConfig{Format: "rfc5424", Charset: "utf8", SDDuplicatePolicy: policy, SkipSDIDs: skip}
+			msgs, err := env.Parse(&c, []byte(dupMessage))
+			if err != nil {
+				t.Fatal(err)
+			}
+			props := msgs[0].GetAllProperties()
+			if props["origin"]["ip"] != expected {
+				t.Errorf("policy '%s': expected %s, got %s", policy, expected, props["origin"]["ip"])
+			}
+			// the params that appear once are not affected
+			if props["origin"]["software"] != "app" || props["meta@32473"]["ip"] != "10.0.0.4" {
+				t.Errorf("policy '%s': unexpected properties: %v", policy, props)
+			}
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package decoders
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// RFC5424RejectedCounter counts the messages rejected by the strict RFC5424
+// validation, by violated part of the message.
+var RFC5424RejectedCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "skw_rfc5424_rejected_total",
+		Help: "number of messages rejected by the strict RFC5424 validation",
+	},
+	[]string{"reason"},
+)
+
+// RFC5424Violation describes why a message does not conform to RFC5424.
+// Reason is the violated part of the message: pri, version, timestamp,
+// hostname, appname, procid, msgid, sd or msg.
+type RFC5424Violation struct {
+	Reason string
+	Detail string
+}
+
+func (v *RFC5424Violation) Error() string {
+	return fmt.Sprintf("RFC5424 violation (%s): %s", v.Reason, v.Detail)
+}
+
+func violation(reason, detail string, args ...interface{}) *RFC5424Violation {
+	return &RFC5424Violation{Reason: reason, Detail: fmt.Sprintf(detail, args...)}
+}
+
+// p5424Strict returns a RFC5424 decoder that validates the messages against
+// the RFC before handing them to the lenient parser p.
+func p5424Strict(p func([]byte) ([]*model.SyslogMessage, error)) func([]byte) ([]*model.SyslogMessage, error) {
+	return func(m []byte) ([]*model.SyslogMessage, error) {
+		if v := validate5424(m); v != nil {
+			RFC5424RejectedCounter.WithLabelValues(v.Reason).Inc()
+			return nil, eerrors.WithTypes(DecodingError(v), "RFC5424Conformance")
+		}
+		return p(m)
+	}
+}
+
+// rejectedMessage builds the message that is forwarded in place of a
+// message that failed the strict validation.
+func rejectedMessage(m []byte, err error) *model.SyslogMessage {
+	msg := rawMessage(m)
+	reason := "unknown"
+	if v, ok := eerrors.RootCause(err).(*RFC5424Violation); ok {
+		reason = v.Reason
+	}
+	msg.SetProperty("skewer", "rfc5424_violation", reason)
+	return msg
+}
+
+// validate5424 checks that m conforms to the RFC5424 ABNF:
+//   SYSLOG-MSG = HEADER SP STRUCTURED-DATA [SP MSG]
+//   HEADER     = PRI VERSION SP TIMESTAMP SP HOSTNAME SP APP-NAME SP PROCID SP MSGID
+func validate5424(m []byte) *RFC5424Violation {
+	pos, v := validatePri(m)
+	if v != nil {
+		return v
+	}
+	end := bytes.IndexByte(m[pos:], ' ')
+	if end == -1 {
+		return violation("version", "missing SP after VERSION")
+	}
+	if string(m[pos:pos+end]) != "1" {
+		return violation("version", "unsupported VERSION '%s'", m[pos:pos+end])
+	}
+	pos += end + 1
+
+	fields := []struct {
+		reason string
+		maxLen int
+	}{
+		{"timestamp", 0},
+		{"hostname", 255},
+		{"appname", 48},
+		{"procid", 128},
+		{"msgid", 32},
+	}
+	for _, field := range fields {
+		end = bytes.IndexByte(m[pos:], ' ')
+		if end == -1 {
+			return violation(field.reason, "truncated header")
+		}
+		value := m[pos : pos+end]
+		if field.reason == "timestamp" {
+			v = validateTimestamp(value)
+		} else {
+			v = validateHeaderField(field.reason, value, field.maxLen)
+		}
+		if v != nil {
+			return v
+		}
+		pos += end + 1
+	}
+
+	pos, v = validateSD(m, pos)
+	if v != nil {
+		return v
+	}
+	if pos == len(m) {
+		return nil
+	}
+	if m[pos] != ' ' {
+		return violation("sd", "missing SP after STRUCTURED-DATA")
+	}
+	msg := m[pos+1:]
+	if bytes.HasPrefix(msg, []byte("\xEF\xBB\xBF")) && !utf8.Valid(msg[3:]) {
+		return violation("msg", "MSG starts with a BOM but is not valid UTF-8")
+	}
+	return nil
+}
+
+func validatePri(m []byte) (int, *RFC5424Violation) {
+	if len(m) == 0 || m[0] != '<' {
+		return 0, violation("pri", "the message does not start with '<'")
+	}
+	end := bytes.IndexByte(m, '>')
+	if end < 2 || end > 4 {
+		return 0, violation("pri", "PRIVAL must have 1 to 3 digits")
+	}
+	if !allDigits(m[1:end]) {
+		return 0, violation("pri", "PRIVAL is not a number")
+	}
+	pri, _ := strconv.Atoi(string(m[1:end]))
+	if pri > 191 {
+		return 0, violation("pri", "PRIVAL out of range: %d", pri)
+	}
+	return end + 1, nil
+}
+
+func validateHeaderField(reason string, value []byte, maxLen int) *RFC5424Violation {
+	if len(value) == 0 {
+		return violation(reason, "empty field")
+	}
+	if len(value) > maxLen {
+		return violation(reason, "longer than %d characters", maxLen)
+	}
+	for _, c := range value {
+		if c < 33 || c > 126 {
+			return violation(reason, "non printable US-ASCII character")
+		}
+	}
+	return nil
+}
+
+// validateTimestamp checks FULL-DATE "T" FULL-TIME, with at most 6 digits of
+// fractional seconds, and upper case T and Z.
+func validateTimestamp(t []byte) *RFC5424Violation {
+	if len(t) == 1 && t[0] == '-' {
+		return nil
+	}
+	// YYYY-MM-DDThh:mm:ss
+	if len(t) < 20 || t[4] != '-' || t[7] != '-' || t[10] != 'T' || t[13] != ':' || t[16] != ':' {
+		return violation("timestamp", "invalid TIMESTAMP '%s'", t)
+	}
+	for _, part := range [][]byte{t[0:4], t[5:7], t[8:10], t[11:13], t[14:16], t[17:19]} {
+		if !allDigits(part) {
+			return violation("timestamp", "invalid TIMESTAMP '%s'", t)
+		}
+	}
+	year, _ := strconv.Atoi(string(t[0:4]))
+	month, _ := strconv.Atoi(string(t[5:7]))
+	day, _ := strconv.Atoi(string(t[8:10]))
+	hour, _ := strconv.Atoi(string(t[11:13]))
+	minute, _ := strconv.Atoi(string(t[14:16]))
+	second, _ := strconv.Atoi(string(t[17:19]))
+	if month < 1 || month > 12 || day < 1 || time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC).Day() != day {
+		return violation("timestamp", "invalid date in TIMESTAMP '%s'", t)
+	}
+	// the RFC allows leap seconds
+	if hour > 23 || minute > 59 || second > 60 {
+		return violation("timestamp", "invalid time in TIMESTAMP '%s'", t)
+	}
+	rest := t[19:]
+	if rest[0] == '.' {
+		frac := 1
+		for frac < len(rest) && rest[frac] >= '0' && rest[frac] <= '9' {
+			frac++
+		}
+		if frac == 1 || frac > 7 {
+			return violation("timestamp", "TIME-SECFRAC must have 1 to 6 digits in '%s'", t)
+		}
+		rest = rest[frac:]
+	}
+	if len(rest) == 1 && rest[0] == 'Z' {
+		return nil
+	}
+	if len(rest) == 6 && (rest[0] == '+' || rest[0] == '-') && rest[3] == ':' && allDigits(rest[1:3]) && allDigits(rest[4:6]) {
+		h, _ := strconv.Atoi(string(rest[1:3]))
+		mn, _ := strconv.Atoi(string(rest[4:6]))
+		if h <= 23 && mn <= 59 {
+			return nil
+		}
+	}
+	return violation("timestamp", "invalid TIME-OFFSET in '%s'", t)
+}
+
+// validateSD checks the STRUCTURED-DATA that starts at pos, and returns the
+// position right after it.
+func validateSD(m []byte, pos int) (int, *RFC5424Violation) {
+	if pos >= len(m) {
+		return pos, violation("sd", "missing STRUCTURED-DATA")
+	}
+	if m[pos] == '-' {
+		return pos + 1, nil
+	}
+	if m[pos] != '[' {
+		return pos, violation("sd", "STRUCTURED-DATA must be '-' or start with '['")
+	}
+	seen := make(map[string]bool)
+	for pos < len(m) && m[pos] == '[' {
+		pos++
+		// SD-ID
+		start := pos
+		for pos < len(m) && isSDNameChar(m[pos]) {
+			pos++
+		}
+		sdid := string(m[start:pos])
+		if v := validateSDID(sdid); v != nil {
+			return pos, v
+		}
+		if seen[sdid] {
+			return pos, violation("sd", "duplicate SD-ID '%s'", sdid)
+		}
+		seen[sdid] = true
+		// *(SP SD-PARAM)
+		for pos < len(m) && m[pos] == ' ' {
+			pos++
+			start = pos
+			for pos < len(m) && isSDNameChar(m[pos]) {
+				pos++
+			}
+			if pos == start || pos-start > 32 {
+				return pos, violation("sd", "PARAM-NAME must have 1 to 32 characters in '%s'", sdid)
+			}
+			if pos+1 >= len(m) || m[pos] != '=' || m[pos+1] != '"' {
+				return pos, violation("sd", "PARAM-NAME must be followed by '=\"' in '%s'", sdid)
+			}
+			pos += 2
+			start = pos
+			closed := false
+			for pos < len(m) {
+				c := m[pos]
+				if c == '\\' {
+					pos += 2
+					continue
+				}
+				if c == ']' {
+					return pos, violation("sd", "unescaped ']' in a PARAM-VALUE of '%s'", sdid)
+				}
+				if c == '"' {
+					closed = true
+					break
+				}
+				pos++
+			}
+			if !closed {
+				return pos, violation("sd", "unterminated PARAM-VALUE in '%s'", sdid)
+			}
+			if !utf8.Valid(m[start:pos]) {
+				return pos, violation("sd", "PARAM-VALUE is not valid UTF-8 in '%s'", sdid)
+			}
+			pos++
+		}
+		if pos >= len(m) || m[pos] != ']' {
+			return pos, violation("sd", "unterminated SD-ELEMENT '%s'", sdid)
+		}
+		pos++
+	}
+	return pos, nil
+}
+
+// validateSDID checks the length of an SD-ID, and that the SD-IDs with an
+// '@' are of the form name@<private enterprise number>.
+func validateSDID(sdid string) *RFC5424Violation {
+	if len(sdid) == 0 || len(sdid) > 32 {
+		return violation("sd", "SD-ID must have 1 to 32 characters")
+	}
+	at := strings.IndexByte(sdid, '@')
+	if at == -1 {
+		return nil
+	}
+	name, pen := sdid[:at], sdid[at+1:]
+	if len(name) == 0 || len(pen) == 0 {
+		return violation("sd", "invalid SD-ID '%s'", sdid)
+	}
+	for i := 0; i < len(pen); i++ {
+		if (pen[i] < '0' || pen[i] > '9') && pen[i] != '.' {
+			return violation("sd", "invalid enterprise number in SD-ID '%s'", sdid)
+		}
+	}
+	return nil
+}
+
+// isSDNameChar tells if c is allowed in SD-NAME: PRINTUSASCII except '=',
+// SP, ']' and '"'.
+func isSDNameChar(c byte) bool {
+	return c >= 33 && c <= 126 && c != '=' && c != ']' && c != '"'
+}
+
+func allDigits(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
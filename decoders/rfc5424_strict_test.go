@@ -0,0 +1,121 @@
+package decoders
+
+import (
+	"testing"
+
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+const bom = "\xEF\xBB\xBF"
+
+// the examples of RFC5424 section 6.5
+var rfc5424Examples = []string{
+	"<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - " + bom + "'su root' failed for lonvick on /dev/pts/8",
+	"<165>1 2003-08-24T05:14:15.000003-07:00 192.0.2.1 myproc 8710 - - %% It's time to make the do-nothing.",
+	`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"] ` + bom + "An application event log entry...",
+	`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"][examplePriority@32473 class="high"]`,
+}
+
+func TestStrictRFC5424Examples(t *testing.T) {
+	for _, m := range rfc5424Examples {
+		if v := validate5424([]byte(m)); v != nil {
+			t.Errorf("RFC example was rejected: %s: %q", v, m)
+		}
+	}
+	// the valid timestamps of section 6.2.3.1
+	for _, ts := range []string{
+		"1985-04-12T23:20:50.52Z",
+		"1985-04-12T19:20:50.52-04:00",
+		"2003-10-11T22:14:15.003Z",
+		"2003-08-24T05:14:15.000003-07:00",
+		"1990-12-31T23:59:60Z",
+		"-",
+	} {
+		if v := validateTimestamp([]byte(ts)); v != nil {
+			t.Errorf("valid timestamp was rejected: %s", v)
+		}
+	}
+}
+
+func TestStrictRFC5424Violations(t *testing.T) {
+	tests := []struct {
+		reason  string
+		message string
+	}{
+		{"pri", "34>1 2003-10-11T22:14:15.003Z host app - - - msg"},
+		{"pri", "<192>1 2003-10-11T22:14:15.003Z host app - - - msg"},
+		{"pri", "<3a>1 2003-10-11T22:14:15.003Z host app - - - msg"},
+		{"version", "<34>2 2003-10-11T22:14:15.003Z host app - - - msg"},
+		{"version", "<34> 2003-10-11T22:14:15.003Z host app - - - msg"},
+		// the invalid timestamps of section 6.2.3.2
+		{"timestamp", "<34>1 2003-08-24T05:14:15.000000003-07:00 host app - - - msg"},
+		{"timestamp", "<34>1 2003-10-11t22:14:15.003z host app - - - msg"},
+		{"timestamp", "<34>1 2003-10-11T22:14:15 host app - - - msg"},
+		{"timestamp", "<34>1 2003-02-30T22:14:15Z host app - - - msg"},
+		{"timestamp", "<34>1 Oct 11 22:14:15 host app - - - msg"},
+		{"appname", "<34>1 2003-10-11T22:14:15.003Z host  - - - msg"},
+		{"msgid", "<34>1 2003-10-11T22:14:15.003Z host app - ID4712345678901234567890123456789 - msg"},
+		{"procid", "<34>1 2003-10-11T22:14:15.003Z host app -"},
+		{"sd", "<34>1 2003-10-11T22:14:15.003Z host app - - msg"},
+		{"sd", "<34>1 2003-10-11T22:14:15.003Z host app - - -msg"},
+		{"sd", `<34>1 2003-10-11T22:14:15.003Z host app - - [id@32473 a="1"`},
+		{"sd", `<34>1 2003-10-11T22:14:15.003Z host app - - [id@32473 a=1] msg`},
+		{"sd", `<34>1 2003-10-11T22:14:15.003Z host app - - [id@32473 a="]"] msg`},
+		{"sd", `<34>1 2003-10-11T22:14:15.003Z host app - - [id@abc a="1"] msg`},
+		{"sd", `<34>1 2003-10-11T22:14:15.003Z host app - - [id@32473 a="1"][id@32473 b="2"] msg`},
+		{"msg", "<34>1 2003-10-11T22:14:15.003Z host app - - - " + bom + "\xff\xfe"},
+	}
+	for _, test := range tests {
+		v := validate5424([]byte(test.message))
+		if v == nil {
+			t.Errorf("non conforming message was accepted: %q", test.message)
+			continue
+		}
+		if v.Reason != test.reason {
+			t.Errorf("expected a '%s' violation, got %s: %q", test.reason, v, test.message)
+		}
+	}
+
+	// escaped characters are allowed in PARAM-VALUE
+	m := `<34>1 2003-10-11T22:14:15.003Z host app - - [id@32473 a="x\]y\"z\\"] msg`
+	if v := validate5424([]byte(m)); v != nil {
+		t.Errorf("escaped PARAM-VALUE was rejected: %s", v)
+	}
+}
+
+func TestStrictRFC5424RejectPath(t *testing.T) {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	env := NewParsersEnv(nil, logger)
+	invalid := []byte("<34>2 2003-10-11T22:14:15Z host app - - - msg")
+
+	// the lenient parser accepts what the strict mode rejects
+	lenient := conf.DecoderBaseConfig{Format: "rfc5424", Charset: "utf8"}
+	strict := conf.DecoderBaseConfig{Format: "rfc5424", Charset: "utf8", RFC5424Strict: true, RFC5424RejectAction: "drop"}
+	forward := conf.DecoderBaseConfig{Format: "rfc5424", Charset: "utf8", RFC5424Strict: true, RFC5424RejectAction: "forward"}
+
+	msgs, err := env.Parse(&strict, []byte(rfc5424Examples[2]))
+	if err != nil || len(msgs) != 1 || msgs[0].AppName != "evntslog" {
+		t.Fatalf("conforming message was not parsed: %v", err)
+	}
+
+	_, err = env.Parse(&strict, invalid)
+	if err == nil || !eerrors.Is("RFC5424Conformance", err) {
+		t.Fatalf("expected a conformance error, got: %v", err)
+	}
+
+	msgs, err = env.Parse(&forward, invalid)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("the rejected message was not forwarded: %v", err)
+	}
+	if msgs[0].Message != string(invalid) || msgs[0].GetProperty("skewer", "rfc5424_violation") != "version" {
+		t.Fatalf("unexpected forwarded message: %q %v", msgs[0].Message, msgs[0].GetAllProperties())
+	}
+
+	msgs, err = env.Parse(&lenient, invalid)
+	if err != nil || len(msgs) != 1 || msgs[0].Version != 2 {
+		t.Fatalf("the lenient parser should accept the message: %v", err)
+	}
+}
@@ -40,3 +40,34 @@ var Formats = map[string]Format{
 	"protobuf":     Protobuf,
 	"":             JSON,
 }
+
+// SDLayout tells how the JSON encoders write the structured data of the
+// messages.
+type SDLayout int
+
+const (
+	// SDNested writes the structured data as the "properties" object, with
+	// an object per SD domain.
+	SDNested SDLayout = 1 + iota
+	// SDFlat writes each SD parameter as a top-level "prefix.domain.param"
+	// key.
+	SDFlat
+	// SDNamespace writes all the SD parameters as "domain.param" keys of a
+	// single "prefix" object.
+	SDNamespace
+)
+
+var SDLayouts = map[string]SDLayout{
+	"nested":    SDNested,
+	"flat":      SDFlat,
+	"namespace": SDNamespace,
+	"":          SDNested,
+}
+
+func ParseSDLayout(layout string) SDLayout {
+	layout = strings.ToLower(strings.TrimSpace(layout))
+	if l, ok := SDLayouts[layout]; ok {
+		return l
+	}
+	return -1
+}
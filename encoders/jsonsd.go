@@ -0,0 +1,224 @@
+package encoders
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/pquerna/ffjson/ffjson"
+	"github.com/stephane-martin/skewer/encoders/baseenc"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// regularKeys are the keys of the regular JSON messages. The structured data
+// keys never take them, even when the field is omitted from a message, so
+// that a SD key has the same name in all the messages.
+var regularKeys = map[string]bool{
+	"facility":      true,
+	"severity":      true,
+	"timereported":  true,
+	"timegenerated": true,
+	"hostname":      true,
+	"appname":       true,
+	"procid":        true,
+	"msgid":         true,
+	"message":       true,
+	"properties":    true,
+}
+
+// GetJSONEncoder returns the encoder for frmt, that writes the structured
+// data with the given layout when frmt is a JSON format. The SD values are
+// always JSON strings, so the SD keys map to a single type.
+func GetJSONEncoder(frmt baseenc.Format, layout baseenc.SDLayout, prefix string) (Encoder, error) {
+	if layout == baseenc.SDNested || (frmt != baseenc.JSON && frmt != baseenc.FullJSON) {
+		return GetEncoder(frmt)
+	}
+	e := sdEncoder{layout: layout, prefix: prefix}
+	if frmt == baseenc.FullJSON {
+		return e.encodeFullJSON, nil
+	}
+	return e.encodeJSON, nil
+}
+
+type sdEncoder struct {
+	layout baseenc.SDLayout
+	prefix string
+}
+
+func (e sdEncoder) encodeJSON(v interface{}, w io.Writer) error {
+	if v == nil {
+		return nil
+	}
+	var reg *model.RegularSyslog
+	switch val := v.(type) {
+	case *model.FullMessage:
+		reg = val.Fields.Regular()
+	case *model.SyslogMessage:
+		reg = val.Regular()
+	default:
+		return defaultEncode(v, w)
+	}
+	buf, err := e.marshal(reg)
+	if err != nil {
+		return EncodingError(err)
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+// nullFields ends the JSON encoding of a model.RegularFullMessage without
+// fields.
+var nullFields = []byte(`"fields":null}`)
+
+func (e sdEncoder) encodeFullJSON(v interface{}, w io.Writer) error {
+	if v == nil {
+		return nil
+	}
+	var reg *model.RegularFullMessage
+	switch val := v.(type) {
+	case *model.FullMessage:
+		if val.Fields == nil {
+			return defaultEncode(v, w)
+		}
+		reg = val.Regular()
+	case *model.SyslogMessage:
+		return e.encodeJSON(val, w)
+	default:
+		return defaultEncode(v, w)
+	}
+	fields, err := e.marshal(reg.Fields)
+	if err != nil {
+		return EncodingError(err)
+	}
+	reg.Fields = nil
+	buf, err := ffjson.Marshal(reg)
+	if err != nil {
+		return EncodingError(err)
+	}
+	// the fields are the last key: the null is replaced by the fields with
+	// the SD layout
+	if !bytes.HasSuffix(buf, nullFields) {
+		return EncodingError(eerrors.New("Unexpected JSON encoding of the full message"))
+	}
+	buf = append(buf[:len(buf)-len(nullFields)], `"fields":`...)
+	buf = append(buf, fields...)
+	buf = append(buf, '}')
+	_, err = w.Write(buf)
+	return err
+}
+
+// marshal encodes reg as a JSON object where the structured data are laid
+// out as e.layout says. The SD keys are appended to the regular JSON object.
+func (e sdEncoder) marshal(reg *model.RegularSyslog) ([]byte, error) {
+	if reg == nil {
+		return []byte("null"), nil
+	}
+	props := reg.Properties
+	reg.Properties = nil
+	buf, err := ffjson.Marshal(reg)
+	if err != nil {
+		return nil, err
+	}
+	var sd bytes.Buffer
+	switch e.layout {
+	case baseenc.SDFlat:
+		err = flattenSD(props, e.prefix, make(map[string]bool), &sd)
+	case baseenc.SDNamespace:
+		var ns bytes.Buffer
+		err = flattenSD(props, "", make(map[string]bool), &ns)
+		if err == nil && ns.Len() > 0 {
+			err = writeKey(&sd, freeKey(e.prefix, make(map[string]bool)))
+			sd.WriteByte('{')
+			sd.Write(ns.Bytes())
+			sd.WriteByte('}')
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if sd.Len() == 0 {
+		return buf, nil
+	}
+	buf = bytes.TrimRight(buf, " \n")
+	if len(buf) < 2 || buf[len(buf)-1] != '}' {
+		return nil, eerrors.New("Unexpected JSON encoding of the message")
+	}
+	buf = buf[:len(buf)-1]
+	if len(buf) > 1 {
+		buf = append(buf, ',')
+	}
+	buf = append(buf, sd.Bytes()...)
+	return append(buf, '}'), nil
+}
+
+// flattenSD writes the SD parameters to w as "prefix.domain.param" keys of a
+// JSON object. taken are the keys that were already written. The domains and
+// the parameters are processed in order, so when two keys collide (say
+// domain "a" with param "b.c", and domain "a.b" with param "c"), the first
+// one keeps the key and the next ones get a "_2", "_3"... suffix, always the
+// same way.
+func flattenSD(props map[string]map[string]string, prefix string, taken map[string]bool, w *bytes.Buffer) error {
+	domains := make([]string, 0, len(props))
+	for domain := range props {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	for _, domain := range domains {
+		params := make([]string, 0, len(props[domain]))
+		for param := range props[domain] {
+			params = append(params, param)
+		}
+		sort.Strings(params)
+		for _, param := range params {
+			key := domain + "." + param
+			if len(prefix) > 0 {
+				key = prefix + "." + key
+			}
+			if w.Len() > 0 {
+				w.WriteByte(',')
+			}
+			err := writeKey(w, freeKey(key, taken))
+			if err != nil {
+				return err
+			}
+			value, err := json.Marshal(props[domain][param])
+			if err != nil {
+				return err
+			}
+			w.Write(value)
+		}
+	}
+	return nil
+}
+
+func writeKey(w *bytes.Buffer, key string) error {
+	k, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	w.Write(k)
+	w.WriteByte(':')
+	return nil
+}
+
+// freeKey returns key, or key with the first free suffix, and marks it as
+// taken.
+func freeKey(key string, taken map[string]bool) string {
+	free := func(k string) bool {
+		return !taken[k] && !regularKeys[k]
+	}
+	if !free(key) {
+		for i := 2; ; i++ {
+			k := key + "_" + strconv.Itoa(i)
+			if free(k) {
+				key = k
+				break
+			}
+		}
+	}
+	taken[key] = true
+	return key
+}
@@ -0,0 +1,120 @@
+package encoders
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stephane-martin/skewer/encoders/baseenc"
+	"github.com/stephane-martin/skewer/model"
+)
+
+func encodeSD(t *testing.T, frmt baseenc.Format, layout baseenc.SDLayout, v interface{}) map[string]interface{} {
+	t.Helper()
+	encoder, err := GetJSONEncoder(frmt, layout, "sd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = encoder(v, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var obj map[string]interface{}
+	err = json.Unmarshal(buf.Bytes(), &obj)
+	if err != nil {
+		t.Fatalf("invalid JSON '%s': %v", buf.String(), err)
+	}
+	return obj
+}
+
+func TestJSONFlatSD(t *testing.T) {
+	msg := model.Factory()
+	msg.HostName = "host"
+	msg.Message = "hello"
+	msg.SetProperty("origin", "ip", "10.0.0.1")
+	msg.SetProperty("origin", "software", "skewer")
+	msg.SetProperty("meta", "sequence", "42")
+
+	obj := encodeSD(t, baseenc.JSON, baseenc.SDFlat, msg)
+	expected := map[string]string{
+		"sd.origin.ip":       "10.0.0.1",
+		"sd.origin.software": "skewer",
+		"sd.meta.sequence":   "42",
+		"hostname":           "host",
+		"message":            "hello",
+	}
+	for k, v := range expected {
+		if obj[k] != v {
+			t.Errorf("key '%s': expected '%s', got '%v'", k, v, obj[k])
+		}
+	}
+	if _, ok := obj["properties"]; ok {
+		t.Error("the properties object should not be written")
+	}
+
+	obj = encodeSD(t, baseenc.JSON, baseenc.SDNamespace, msg)
+	sd, ok := obj["sd"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("the structured data should be in the 'sd' object: %v", obj)
+	}
+	if len(sd) != 3 || sd["origin.ip"] != "10.0.0.1" || sd["meta.sequence"] != "42" {
+		t.Errorf("unexpected namespaced structured data: %v", sd)
+	}
+
+	// the full messages have the structured data in the fields object
+	full := &model.FullMessage{Fields: msg, SourceType: "tcp"}
+	obj = encodeSD(t, baseenc.FullJSON, baseenc.SDFlat, full)
+	fields, ok := obj["fields"].(map[string]interface{})
+	if !ok || obj["source_type"] != "tcp" {
+		t.Fatalf("unexpected full message: %v", obj)
+	}
+	if fields["sd.origin.ip"] != "10.0.0.1" {
+		t.Errorf("unexpected fields: %v", fields)
+	}
+
+	// the nested layout is the plain JSON encoder
+	obj = encodeSD(t, baseenc.JSON, baseenc.SDNested, msg)
+	props, ok := obj["properties"].(map[string]interface{})
+	if !ok || len(props) != 2 {
+		t.Errorf("unexpected properties: %v", obj["properties"])
+	}
+}
+
+func TestJSONFlatSDCollisions(t *testing.T) {
+	msg := model.Factory()
+	msg.SetProperty("a", "b.c", "first")
+	msg.SetProperty("a.b", "c", "second")
+	msg.SetProperty("a.b.c", "", "third")
+
+	for i := 0; i < 10; i++ {
+		obj := encodeSD(t, baseenc.JSON, baseenc.SDFlat, msg)
+		if obj["sd.a.b.c"] != "first" || obj["sd.a.b.c_2"] != "second" {
+			t.Fatalf("the collisions should be resolved in order: %v", obj)
+		}
+		if obj["sd.a.b.c."] != "third" {
+			t.Fatalf("unexpected key for the empty param: %v", obj)
+		}
+	}
+
+	// the SD keys never take a regular field name, even when absent
+	msg = model.Factory()
+	msg.SetProperty("x", "y", "z")
+	encoder, err := GetJSONEncoder(baseenc.JSON, baseenc.SDNamespace, "hostname")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = encoder(msg, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var obj map[string]interface{}
+	err = json.Unmarshal(buf.Bytes(), &obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := obj["hostname_2"].(map[string]interface{}); !ok {
+		t.Errorf("the namespace should not take the hostname key: %v", obj)
+	}
+}
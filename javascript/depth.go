@@ -0,0 +1,110 @@
+package javascript
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/parser"
+)
+
+// The VM has no call depth limit, so the depth of the JS calls is counted by
+// the functions themselves: the body of each function of the filtering
+// scripts is instrumented to call depthEnterFunc when it starts and
+// depthLeaveFunc when it returns.
+const (
+	depthEnterFunc = "__skewerEnter"
+	depthLeaveFunc = "__skewerLeave"
+)
+
+var astPkgPath = reflect.TypeOf(ast.Program{}).PkgPath()
+
+// instrumentDepth returns the source with the depth accounting added to the
+// body of every function. A source that can't be parsed is returned as is,
+// so that the VM reports the syntax error.
+func instrumentDepth(src string) string {
+	program, err := parser.ParseFile(nil, "", src, 0)
+	if err != nil {
+		return src
+	}
+	funcs := map[*ast.FunctionLiteral]bool{}
+	collectFunctions(reflect.ValueOf(program), funcs)
+
+	type insertion struct {
+		offset int
+		text   string
+	}
+	insertions := make([]insertion, 0, 2*len(funcs))
+	for f := range funcs {
+		body, ok := f.Body.(*ast.BlockStatement)
+		if !ok {
+			continue
+		}
+		// file.Idx is 1-based
+		insertions = append(insertions,
+			insertion{int(body.LeftBrace), depthEnterFunc + "();try{"},
+			insertion{int(body.RightBrace) - 1, "}finally{" + depthLeaveFunc + "();}"},
+		)
+	}
+	sort.Slice(insertions, func(i, j int) bool { return insertions[i].offset > insertions[j].offset })
+	for _, ins := range insertions {
+		if ins.offset < 0 || ins.offset > len(src) {
+			return src
+		}
+		src = src[:ins.offset] + ins.text + src[ins.offset:]
+	}
+	return src
+}
+
+// collectFunctions walks the AST and collects the function literals.
+func collectFunctions(v reflect.Value, funcs map[*ast.FunctionLiteral]bool) {
+	switch v.Kind() {
+	case reflect.Interface:
+		if !v.IsNil() {
+			collectFunctions(v.Elem(), funcs)
+		}
+	case reflect.Ptr:
+		if v.IsNil() || v.Elem().Kind() != reflect.Struct || v.Elem().Type().PkgPath() != astPkgPath {
+			return
+		}
+		if f, ok := v.Interface().(*ast.FunctionLiteral); ok {
+			if funcs[f] {
+				return
+			}
+			funcs[f] = true
+		}
+		collectFunctions(v.Elem(), funcs)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			collectFunctions(v.Field(i), funcs)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			collectFunctions(v.Index(i), funcs)
+		}
+	}
+}
+
+// setDepthFuncs registers the depth accounting functions in the runtime.
+func (e *Environment) setDepthFuncs() {
+	e.runtime.Set(depthEnterFunc, func(goja.FunctionCall) goja.Value {
+		e.depth++
+		if e.limits.MaxStackDepth > 0 && e.depth == e.limits.MaxStackDepth+1 {
+			// the interruption can't be caught by the script
+			e.runtime.Interrupt(stackLimitError(e.limits.MaxStackDepth))
+		}
+		return goja.Undefined()
+	})
+	e.runtime.Set(depthLeaveFunc, func(goja.FunctionCall) goja.Value {
+		e.depth--
+		return goja.Undefined()
+	})
+}
+
+// runFilterScript runs a script that defines filtering functions, with
+// the call depth accounting.
+func (e *Environment) runFilterScript(src string) error {
+	_, err := e.vm().RunString(instrumentDepth(src))
+	return err
+}
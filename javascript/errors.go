@@ -1,6 +1,8 @@
 package javascript
 
 import (
+	"time"
+
 	"github.com/dop251/goja"
 	"github.com/stephane-martin/skewer/utils/eerrors"
 )
@@ -26,6 +28,49 @@ func jsvmError(err error) error {
 	return eerrors.WithTypes(err, "Javascript")
 }
 
+func stackLimitError(maxDepth int) error {
+	return eerrors.WithTypes(
+		eerrors.Errorf("The JS function was interrupted: it exceeded the call depth of %d", maxDepth),
+		"Javascript", "ResourceLimit", "StackLimit",
+	)
+}
+
+func durationLimitError(maxDuration time.Duration) error {
+	return eerrors.WithTypes(
+		eerrors.Errorf("The JS function was interrupted: it ran for more than %s", maxDuration),
+		"Javascript", "ResourceLimit", "DurationLimit",
+	)
+}
+
+func memoryLimitError(maxMemory uint64) error {
+	return eerrors.WithTypes(
+		eerrors.Errorf("The JS function was interrupted: it allocated more than %d bytes", maxMemory),
+		"Javascript", "ResourceLimit", "MemoryLimit",
+	)
+}
+
+// IsResourceLimitError returns true when a JS function was interrupted
+// because it exceeded the resource limits of the environment.
+func IsResourceLimitError(err error) bool {
+	return eerrors.Is("ResourceLimit", err)
+}
+
+// LimitReason returns the resource limit that a JS function exceeded:
+// "stack", "duration" or "memory". It returns an empty string if err is
+// not a resource limit error.
+func LimitReason(err error) string {
+	switch {
+	case eerrors.Is("StackLimit", err):
+		return "stack"
+	case eerrors.Is("DurationLimit", err):
+		return "duration"
+	case eerrors.Is("MemoryLimit", err):
+		return "memory"
+	default:
+		return ""
+	}
+}
+
 func objectNotFoundError(obj string) error {
 	return jsvmError(eerrors.Errorf("Object was not found in the JS VM: '%s'", obj))
 }
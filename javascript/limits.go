@@ -0,0 +1,156 @@
+package javascript
+
+import (
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// Limits bounds the resources that a JS function may use to process one
+// message. When a limit is exceeded, the function is interrupted and the
+// call returns an error for which IsResourceLimitError is true.
+type Limits struct {
+	// MaxStackDepth is the maximum depth of the JS calls. 0 disables the
+	// limit.
+	MaxStackDepth int
+	// MaxDuration is the time budget of a call. 0 disables the limit.
+	MaxDuration time.Duration
+	// MaxMemory is the maximum growth of the heap during a call, in bytes.
+	// The heap is shared with the rest of the process, so the limit should
+	// be well above what a normal call allocates. 0 disables the limit.
+	MaxMemory uint64
+}
+
+// limitsCheckInterval is the period of the memory checks during a call.
+// Calls that are shorter than that are never checked.
+var limitsCheckInterval = 10 * time.Millisecond
+
+// SetLimits sets the resource limits of the JS function calls.
+func (e *Environment) SetLimits(limits Limits) {
+	e.limits = limits
+	if e.runtime != nil {
+		e.applyLimits()
+	}
+}
+
+// applyLimits configures the runtime with the limits. The call depth is
+// checked by the instrumented functions.
+func (e *Environment) applyLimits() {
+	if (e.limits.MaxDuration > 0 || e.limits.MaxMemory > 0) && e.watchdog == nil {
+		e.watchdog = newWatchdog(e.runtime)
+	}
+}
+
+// watchdog interrupts the VM when a JS call exceeds its time budget or its
+// memory limit. There is one watchdog per VM, and its timer is reused by
+// the calls.
+type watchdog struct {
+	runtime     *goja.Runtime
+	timer       *time.Timer
+	mu          sync.Mutex
+	running     bool
+	limits      Limits
+	started     time.Time
+	heap        uint64
+	interrupted bool
+}
+
+func newWatchdog(runtime *goja.Runtime) *watchdog {
+	w := &watchdog{runtime: runtime}
+	w.timer = time.AfterFunc(time.Hour, w.check)
+	w.timer.Stop()
+	return w
+}
+
+// next returns the delay until the next check.
+func (w *watchdog) next(elapsed time.Duration) time.Duration {
+	if w.limits.MaxMemory == 0 {
+		return w.limits.MaxDuration - elapsed
+	}
+	if w.limits.MaxDuration > 0 && w.limits.MaxDuration-elapsed < limitsCheckInterval {
+		return w.limits.MaxDuration - elapsed
+	}
+	return limitsCheckInterval
+}
+
+// check interrupts the VM if the running call exceeded a limit, and else
+// schedules the next check. The heap growth is measured from the first
+// check, so that the short calls don't pay for reading the memory
+// statistics.
+func (w *watchdog) check() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.running || w.interrupted {
+		return
+	}
+	elapsed := time.Since(w.started)
+	if w.limits.MaxDuration > 0 && elapsed >= w.limits.MaxDuration {
+		w.runtime.Interrupt(durationLimitError(w.limits.MaxDuration))
+		w.interrupted = true
+		return
+	}
+	if w.limits.MaxMemory > 0 {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		if w.heap == 0 {
+			w.heap = stats.HeapAlloc
+		} else if stats.HeapAlloc > w.heap && stats.HeapAlloc-w.heap > w.limits.MaxMemory {
+			w.runtime.Interrupt(memoryLimitError(w.limits.MaxMemory))
+			w.interrupted = true
+			return
+		}
+	}
+	w.timer.Reset(w.next(elapsed))
+}
+
+func (w *watchdog) start(limits Limits) {
+	w.mu.Lock()
+	w.running = true
+	w.limits = limits
+	w.started = time.Now()
+	w.heap = 0
+	w.interrupted = false
+	w.timer.Reset(w.next(0))
+	w.mu.Unlock()
+}
+
+// stop tells if the VM was interrupted.
+func (w *watchdog) stop() bool {
+	w.mu.Lock()
+	w.timer.Stop()
+	w.running = false
+	interrupted := w.interrupted
+	w.mu.Unlock()
+	return interrupted
+}
+
+// call executes the JS function under the resource limits.
+func (e *Environment) call(f goja.Callable, args ...goja.Value) (goja.Value, error) {
+	e.depth = 0
+	if e.watchdog == nil || (e.limits.MaxDuration <= 0 && e.limits.MaxMemory == 0) {
+		return e.result(f(nil, args...))
+	}
+	e.watchdog.start(e.limits)
+	res, err := f(nil, args...)
+	interrupted := e.watchdog.stop()
+	if _, ok := err.(*goja.InterruptedError); !ok && interrupted {
+		// the function returned before the VM noticed the interruption:
+		// consume it, so that the next call is not interrupted
+		_, _ = e.runtime.RunString("undefined")
+	}
+	return e.result(res, err)
+}
+
+// result converts the interruptions of the VM into resource limit errors.
+func (e *Environment) result(res goja.Value, err error) (goja.Value, error) {
+	intr, ok := err.(*goja.InterruptedError)
+	if !ok {
+		return res, err
+	}
+	if v, ok := intr.Value().(error); ok {
+		return nil, v
+	}
+	return nil, err
+}
@@ -0,0 +1,95 @@
+package javascript
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/model"
+)
+
+func TestResourceLimits(t *testing.T) {
+	filter := `function FilterMessages(m) {
+	if (m.Appname === "greedy") {
+		var a = [];
+		while (true) { a.push("some string " + a.length); }
+	}
+	if (m.Appname === "recursive") {
+		var f = function(n) { return f(n + 1) + 1; };
+		f(0);
+	}
+	if (m.Appname === "catcher") {
+		var g = function(n) { return g(n + 1) + 1; };
+		try { g(0); } catch (e) { return FILTER.PASS; }
+	}
+	if (m.Appname === "deep") {
+		var h = function(n) { return n === 0 ? 0 : h(n - 1) + 1; };
+		h(100);
+	}
+	return FILTER.PASS;
+}`
+	env := NewFilterEnvironment(filter, "", "", "", "", "", log15.New())
+	env.SetLimits(Limits{MaxStackDepth: 256, MaxDuration: 200 * time.Millisecond})
+
+	tests := []struct {
+		appname string
+		limits  Limits
+		reason  string
+	}{
+		{"greedy", Limits{MaxStackDepth: 256, MaxDuration: 200 * time.Millisecond}, "duration"},
+		{"greedy", Limits{MaxStackDepth: 256, MaxMemory: 16 << 20}, "memory"},
+		{"recursive", Limits{MaxStackDepth: 256, MaxDuration: time.Second}, "stack"},
+		{"catcher", Limits{MaxStackDepth: 256, MaxDuration: time.Second}, "stack"},
+	}
+	for _, test := range tests {
+		env.SetLimits(test.limits)
+		m := model.Factory()
+		m.AppName = test.appname
+		result, err := env.FilterMessage(m)
+		if !IsResourceLimitError(err) || LimitReason(err) != test.reason {
+			t.Fatalf("%s: expected a %s limit error, got: %v", test.appname, test.reason, err)
+		}
+		if result != FILTER_ERROR {
+			t.Fatalf("%s: unexpected filter result: %d", test.appname, result)
+		}
+	}
+	env.SetLimits(Limits{MaxStackDepth: 256, MaxDuration: time.Second})
+
+	// the environment is still usable, and the calls below the limits
+	// succeed
+	for _, appname := range []string{"sober", "deep"} {
+		m := model.Factory()
+		m.AppName = appname
+		result, err := env.FilterMessage(m)
+		if err != nil {
+			t.Fatalf("%s: %s", appname, err)
+		}
+		if result != PASS {
+			t.Fatalf("%s: unexpected filter result: %d", appname, result)
+		}
+	}
+}
+
+func TestInstrumentDepth(t *testing.T) {
+	src := `function Topic(m) { var f = function(x) { return x; }; return f("t"); }`
+	instrumented := instrumentDepth(src)
+	if strings.Count(instrumented, depthEnterFunc) != 2 || strings.Count(instrumented, depthLeaveFunc) != 2 {
+		t.Fatalf("unexpected instrumented source: %s", instrumented)
+	}
+	// the syntax errors are left to the VM
+	if instrumentDepth("function (") != "function (" {
+		t.Fatal("a source that can't be parsed should be returned as is")
+	}
+	env := NewFilterEnvironment("", src, "", "", "", "", log15.New())
+	env.SetLimits(Limits{MaxStackDepth: 2})
+	topic, err := env.Topic(model.Factory())
+	if err != nil || topic != "t" {
+		t.Fatalf("unexpected topic: '%s' %v", topic, err)
+	}
+	env.SetLimits(Limits{MaxStackDepth: 1})
+	_, err = env.Topic(model.Factory())
+	if LimitReason(err) != "stack" {
+		t.Fatalf("expected a stack limit error, got: %v", err)
+	}
+}
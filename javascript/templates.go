@@ -0,0 +1,97 @@
+package javascript
+
+import (
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// maxTopicLength is the maximum length of a Kafka topic name.
+const maxTopicLength = 249
+
+// compileTemplate parses a topic or partition key template, and renders it
+// once with an empty message so that references to unknown fields are
+// detected at load time instead of for each message.
+func compileTemplate(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	m := model.Factory()
+	defer model.Free(m)
+	_, err = renderTemplate(t, m)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// templateMayRender returns false when t can not render s whatever the
+// message: the text that t starts with is not a prefix of s. It is true
+// otherwise, so it may be true for a template that never renders s.
+func templateMayRender(t *template.Template, s string) bool {
+	if t.Tree == nil || t.Tree.Root == nil || len(t.Tree.Root.Nodes) == 0 {
+		return s == ""
+	}
+	lead, ok := t.Tree.Root.Nodes[0].(*parse.TextNode)
+	if !ok {
+		return true
+	}
+	if len(t.Tree.Root.Nodes) == 1 {
+		return string(lead.Text) == s
+	}
+	return strings.HasPrefix(s, string(lead.Text))
+}
+
+func renderTemplate(t *template.Template, m *model.SyslogMessage) (string, error) {
+	var b strings.Builder
+	err := t.Execute(&b, m)
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// CheckTemplates compiles the given topic and partition key templates and
+// returns the errors.
+func CheckTemplates(topicTmpl, partitionKeyTmpl string) (errs []error) {
+	if len(topicTmpl) > 0 {
+		_, err := compileTemplate("topic", topicTmpl)
+		if err != nil {
+			errs = append(errs, eerrors.Wrap(err, "Error compiling the topic template"))
+		}
+	}
+	if len(partitionKeyTmpl) > 0 {
+		_, err := compileTemplate("pkey", partitionKeyTmpl)
+		if err != nil {
+			errs = append(errs, eerrors.Wrap(err, "Error compiling the partition key template"))
+		}
+	}
+	return errs
+}
+
+// SanitizeTopicName makes name a valid Kafka topic name: the forbidden
+// characters are replaced by '_' and the name is truncated to 249 bytes.
+// It returns an empty string if nothing valid remains.
+func SanitizeTopicName(name string) string {
+	if TopicNameIsValid(name) && name != "." && name != ".." {
+		return name
+	}
+	name = strings.Map(func(r rune) rune {
+		if validRune(r) {
+			return r
+		}
+		return '_'
+	}, name)
+	if len(name) > maxTopicLength {
+		// only ASCII runes remain, so the name can be cut anywhere
+		name = name[:maxTopicLength]
+	}
+	if name == "." || name == ".." {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,135 @@
+package javascript
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/model"
+)
+
+func TestTemplatesWithoutJS(t *testing.T) {
+	env := NewFilterEnvironment("", "", "logs-{{.AppName}}", "", "{{.HostName}}", "", log15.New())
+	if env.runtime != nil {
+		t.Fatal("the JS runtime should not be created when only templates are configured")
+	}
+	m := model.Factory()
+	m.AppName = "my app/1"
+	m.HostName = "host1"
+	topic, err := env.Topic(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if topic != "logs-my_app_1" {
+		t.Fatalf("unexpected topic: '%s'", topic)
+	}
+	pkey, err := env.PartitionKey(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkey != "host1" {
+		t.Fatalf("unexpected partition key: '%s'", pkey)
+	}
+	if env.runtime != nil {
+		t.Fatal("the JS runtime should not be created when rendering templates")
+	}
+}
+
+func TestCheckTemplates(t *testing.T) {
+	if len(CheckTemplates("topic-{{.AppName}}", "pk-{{.HostName}}")) != 0 {
+		t.Fatal("valid templates were refused")
+	}
+	if len(CheckTemplates("topic-{{.Appname}}", "pk-{{.HostName")) != 2 {
+		t.Fatal("invalid templates were accepted")
+	}
+}
+
+func TestSanitizeTopicName(t *testing.T) {
+	tests := map[string]string{
+		"logs-app":               "logs-app",
+		"logs app/é":             "logs_app__",
+		".":                      "",
+		"..":                     "",
+		"":                       "",
+		"a.b_c-D":                "a.b_c-D",
+		"\xfftopic":              "_topic",
+		strings.Repeat("a", 300): strings.Repeat("a", maxTopicLength),
+	}
+	for name, expected := range tests {
+		if s := SanitizeTopicName(name); s != expected {
+			t.Errorf("'%s': expected '%s', got '%s'", name, expected, s)
+		}
+	}
+}
+
+func TestNullTopic(t *testing.T) {
+	m := model.Factory()
+	m.AppName = "debug"
+
+	env := NewFilterEnvironment("", "", "{{if eq .AppName \"debug\"}}@null{{else}}logs{{end}}", "", "", "", log15.New())
+	topic, err := env.Topic(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if topic != NullTopic {
+		t.Fatalf("the template should route to the null destination, got: '%s'", topic)
+	}
+
+	topicFunc := `function Topic(m) { return m.Appname === "debug" ? "@" + "null" : "logs"; }`
+	env = NewFilterEnvironment("", topicFunc, "", "", "", "", log15.New())
+	if !env.HasTopic() {
+		t.Fatal("the environment should have a topic function")
+	}
+	topic, err = env.Topic(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if topic != NullTopic {
+		t.Fatalf("the JS function should route to the null destination, got: '%s'", topic)
+	}
+	if !env.RoutesToNull() {
+		t.Fatal("the JS function should be detected as a null routing")
+	}
+
+	env = NewFilterEnvironment("", "", "logs-{{.AppName}}", "", "", "", log15.New())
+	if env.RoutesToNull() {
+		t.Fatal("the template never routes to the null destination")
+	}
+	env.SetQuarantineTopic("quarantine")
+	if env.RoutesToNull() {
+		t.Fatal("the quarantine topic does not route to the null destination")
+	}
+	env.SetQuarantineTopic(NullTopic)
+	if !env.RoutesToNull() {
+		t.Fatal("the quarantine topic routes to the null destination")
+	}
+}
+
+func TestTemplateRoutesToNull(t *testing.T) {
+	tests := map[string]bool{
+		"@null":                            true,
+		"{{.AppName}}":                     true,
+		"@{{.AppName}}":                    true,
+		"@nu{{.AppName}}":                  true,
+		" {{- .AppName}}":                  true,
+		"{{if .AppName}}@null{{end}}":      true,
+		"topic-{{.AppName}}":               false,
+		"@nulls-{{.AppName}}":              false,
+		"@nul":                             false,
+		"logs":                             false,
+		"logs-{{if .AppName}}@null{{end}}": false,
+	}
+	m := model.Factory()
+	m.AppName = "null"
+	for tmpl, expected := range tests {
+		env := NewFilterEnvironment("", "", tmpl, "", "", "", log15.New())
+		if env.RoutesToNull() != expected {
+			t.Errorf("'%s': expected %v", tmpl, expected)
+		}
+		// a template that is not detected never routes to the null
+		// destination
+		if topic, _ := env.Topic(m); topic == NullTopic && !expected {
+			t.Errorf("'%s' routes to the null destination", tmpl)
+		}
+	}
+}
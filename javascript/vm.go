@@ -59,6 +59,11 @@ const (
 	FILTER_ERROR FilterResult = 3
 )
 
+// NullTopic is the topic that routes a message to the null destination:
+// when the Topic() function or the topic template returns it, the message is
+// ACKed but not sent, whatever the destination.
+const NullTopic = "@null"
+
 type iSyslogMessage struct {
 	Priority      int
 	Facility      int
@@ -96,6 +101,33 @@ func NewFilterEnvironment(filterFunc, topicFunc, topicTmpl, partitionKeyFunc, pa
 	return newEnv(filterFunc, topicFunc, topicTmpl, partitionKeyFunc, partitionKeyTmpl, partitionNumberFunc, logger)
 }
 
+// CheckFilterFuncs compiles the given filtering functions and returns the
+// errors, whereas NewFilterEnvironment only logs them.
+func CheckFilterFuncs(filterFunc, topicFunc, partitionKeyFunc, partitionNumberFunc string) (errs []error) {
+	e := newEnv("", "", "", "", "", "", log15.New())
+	checks := []struct {
+		name string
+		f    string
+		set  func(string) error
+	}{
+		{"FilterMessages", filterFunc, e.setFilterMessagesFunc},
+		{"Topic", topicFunc, e.setTopicFunc},
+		{"PartitionKey", partitionKeyFunc, e.setPartitionKeyFunc},
+		{"PartitionNumber", partitionNumberFunc, e.setPartitionNumberFunc},
+	}
+	for _, check := range checks {
+		f := strings.TrimSpace(check.f)
+		if len(f) == 0 {
+			continue
+		}
+		err := check.set(f)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Error compiling the JS %s() func: %s", check.name, err))
+		}
+	}
+	return errs
+}
+
 type Environment struct {
 	runtime             *goja.Runtime
 	logger              log15.Logger
@@ -108,6 +140,11 @@ type Environment struct {
 	jsParsers           map[string]goja.Callable
 	topicTmpl           *template.Template
 	partitionKeyTmpl    *template.Template
+	quarantineTopic     string
+	nullRouting         bool
+	limits              Limits
+	watchdog            *watchdog
+	depth               int
 }
 
 type ConcreteParser struct {
@@ -129,7 +166,7 @@ func (p *ConcreteParser) Parse(rawMessage []byte) ([]*model.SyslogMessage, error
 		return nil, nil
 	}
 	jsRawMessage := p.env.runtime.ToValue(string(rawMessage))
-	jsParsedMessage, err := jsParser(nil, jsRawMessage)
+	jsParsedMessage, err := p.env.call(jsParser, jsRawMessage)
 	if err != nil {
 		if jserr, ok := err.(*goja.Exception); ok {
 			message, ok := jserr.Value().Export().(string)
@@ -153,26 +190,27 @@ func newEnv(filterFunc, topicFunc, topicTmpl, partitionKeyFunc, partitionKeyTmpl
 	e.logger = logger.New("class", "Environment")
 
 	if len(topicTmpl) > 0 {
-		t, err := template.New("topic").Parse(topicTmpl)
+		t, err := compileTemplate("topic", topicTmpl)
 		if err == nil {
 			e.topicTmpl = t
+			e.nullRouting = templateMayRender(t, NullTopic)
+		} else {
+			e.logger.Warn("Error compiling the topic template", "error", err)
 		}
 	}
 	if len(partitionKeyTmpl) > 0 {
-		t, err := template.New("pkey").Parse(partitionKeyTmpl)
+		t, err := compileTemplate("pkey", partitionKeyTmpl)
 		if err == nil {
 			e.partitionKeyTmpl = t
+		} else {
+			e.logger.Warn("Error compiling the partition key template", "error", err)
 		}
 	}
 
 	e.jsParsers = map[string]goja.Callable{}
 
-	e.runtime = goja.New()
-	_, _ = e.runtime.RunString(jsSyslogMessage)
-	v := e.runtime.Get("NewSyslogMessage")
-	e.jsNewSyslogMessage, _ = goja.AssertFunction(v)
-	v = e.runtime.Get("SyslogMessageToGo")
-	e.jsSyslogMessageToGo, _ = goja.AssertFunction(v)
+	// the JS runtime is only created when some JS function is actually
+	// configured: the topic and partition key templates don't need it
 
 	topicFunc = strings.TrimSpace(topicFunc)
 	partitionKeyFunc = strings.TrimSpace(partitionKeyFunc)
@@ -181,7 +219,10 @@ func newEnv(filterFunc, topicFunc, topicTmpl, partitionKeyFunc, partitionKeyTmpl
 
 	if len(topicFunc) > 0 {
 		err := e.setTopicFunc(topicFunc)
-		if err != nil {
+		if err == nil {
+			// what a JS function returns can't be known without calling it
+			e.nullRouting = true
+		} else {
 			e.logger.Warn("Error setting the JS Topic() func", "error", err)
 		}
 	}
@@ -207,6 +248,21 @@ func newEnv(filterFunc, topicFunc, topicTmpl, partitionKeyFunc, partitionKeyTmpl
 	return &e
 }
 
+// vm returns the JS runtime, creating it on first use.
+func (e *Environment) vm() *goja.Runtime {
+	if e.runtime == nil {
+		e.runtime = goja.New()
+		_, _ = e.runtime.RunString(jsSyslogMessage)
+		v := e.runtime.Get("NewSyslogMessage")
+		e.jsNewSyslogMessage, _ = goja.AssertFunction(v)
+		v = e.runtime.Get("SyslogMessageToGo")
+		e.jsSyslogMessageToGo, _ = goja.AssertFunction(v)
+		e.setDepthFuncs()
+		e.applyLimits()
+	}
+	return e.runtime
+}
+
 func (e *Environment) GetParser(name string) (func(m []byte) ([]*model.SyslogMessage, error), error) {
 	_, ok := e.jsParsers[name]
 	if !ok {
@@ -225,7 +281,7 @@ func (e *Environment) AddParser(name string, parserFunc string) error {
 	if len(parserFunc) == 0 {
 		return fmt.Errorf("Empty parser function")
 	}
-	_, err := e.runtime.RunString(parserFunc)
+	_, err := e.vm().RunString(parserFunc)
 	if err != nil {
 		return err
 	}
@@ -242,7 +298,7 @@ func (e *Environment) AddParser(name string, parserFunc string) error {
 }
 
 func (e *Environment) setTopicFunc(f string) error {
-	_, err := e.runtime.RunString(f)
+	err := e.runFilterScript(f)
 	if err != nil {
 		return err
 	}
@@ -259,7 +315,7 @@ func (e *Environment) setTopicFunc(f string) error {
 }
 
 func (e *Environment) setPartitionKeyFunc(f string) error {
-	_, err := e.runtime.RunString(f)
+	err := e.runFilterScript(f)
 	if err != nil {
 		return err
 	}
@@ -276,7 +332,7 @@ func (e *Environment) setPartitionKeyFunc(f string) error {
 }
 
 func (e *Environment) setPartitionNumberFunc(f string) error {
-	_, err := e.runtime.RunString(f)
+	err := e.runFilterScript(f)
 	if err != nil {
 		return err
 	}
@@ -293,7 +349,7 @@ func (e *Environment) setPartitionNumberFunc(f string) error {
 }
 
 func (e *Environment) setFilterMessagesFunc(f string) error {
-	_, err := e.runtime.RunString(f)
+	err := e.runFilterScript(f)
 	if err != nil {
 		return err
 	}
@@ -310,6 +366,9 @@ func (e *Environment) setFilterMessagesFunc(f string) error {
 }
 
 func (e *Environment) Topic(m *model.SyslogMessage) (topic string, err error) {
+	if len(e.quarantineTopic) > 0 && m.GetProperty("skewer", "quarantine") != "" {
+		return e.quarantineTopic, nil
+	}
 	errs := make([]error, 0)
 
 	if e.jsTopic != nil {
@@ -317,7 +376,7 @@ func (e *Environment) Topic(m *model.SyslogMessage) (topic string, err error) {
 		var jsTopic goja.Value
 		jsMessage, err = e.toJsMessage(m)
 		if err == nil {
-			jsTopic, err = e.jsTopic(nil, jsMessage)
+			jsTopic, err = e.call(e.jsTopic, jsMessage)
 			if err == nil {
 				topic = jsTopic.String()
 			} else {
@@ -327,11 +386,17 @@ func (e *Environment) Topic(m *model.SyslogMessage) (topic string, err error) {
 			errs = append(errs, go2jsError(executingJSErrorFactory(err, "NewSyslogMessage")))
 		}
 	}
+	if topic == NullTopic {
+		return topic, eerrors.Combine(errs...)
+	}
 	if len(topic) == 0 && e.topicTmpl != nil {
-		topicBuf := bytes.Buffer{}
-		err = e.topicTmpl.Execute(&topicBuf, m)
+		topic, err = renderTemplate(e.topicTmpl, m)
+		if err == nil && topic == NullTopic {
+			return topic, eerrors.Combine(errs...)
+		}
 		if err == nil {
-			topic = topicBuf.String()
+			// the template result is made valid, instead of being rejected
+			topic = SanitizeTopicName(topic)
 		} else {
 			errs = append(errs, err)
 		}
@@ -345,6 +410,33 @@ func (e *Environment) Topic(m *model.SyslogMessage) (topic string, err error) {
 	return topic, eerrors.Combine(errs...)
 }
 
+// HasTopic returns true when a topic function, a topic template or a
+// quarantine topic is configured.
+func (e *Environment) HasTopic() bool {
+	return e.jsTopic != nil || e.topicTmpl != nil || len(e.quarantineTopic) > 0
+}
+
+// HasPartitionNumber returns true when a partition number function is
+// configured.
+func (e *Environment) HasPartitionNumber() bool {
+	return e.jsPartitionNumber != nil
+}
+
+// RoutesToNull returns true when the topic function, the topic template or
+// the quarantine topic may route a message to the null destination. The
+// destinations that don't use the topic only need to evaluate it then. A
+// topic function may always return NullTopic, and a topic template may when
+// its leading text is a prefix of NullTopic.
+func (e *Environment) RoutesToNull() bool {
+	return e.nullRouting || e.quarantineTopic == NullTopic
+}
+
+// SetQuarantineTopic sets the topic of the messages that could not be
+// parsed, instead of the topic function and template.
+func (e *Environment) SetQuarantineTopic(topic string) {
+	e.quarantineTopic = topic
+}
+
 func (e *Environment) PartitionKey(m *model.SyslogMessage) (partitionKey string, err error) {
 	errs := make([]error, 0)
 	var jsMessage goja.Value
@@ -353,7 +445,7 @@ func (e *Environment) PartitionKey(m *model.SyslogMessage) (partitionKey string,
 	if e.jsPartitionKey != nil {
 		jsMessage, err = e.toJsMessage(m)
 		if err == nil {
-			jsPartitionKey, err = e.jsPartitionKey(nil, jsMessage)
+			jsPartitionKey, err = e.call(e.jsPartitionKey, jsMessage)
 			if err == nil {
 				partitionKey = jsPartitionKey.String()
 			} else {
@@ -364,18 +456,18 @@ func (e *Environment) PartitionKey(m *model.SyslogMessage) (partitionKey string,
 		}
 	}
 	if len(partitionKey) == 0 && e.partitionKeyTmpl != nil {
-		partitionKeyBuf := bytes.Buffer{}
-		err = e.partitionKeyTmpl.Execute(&partitionKeyBuf, m)
-		if err == nil {
-			partitionKey = partitionKeyBuf.String()
-		} else {
+		partitionKey, err = renderTemplate(e.partitionKeyTmpl, m)
+		if err != nil {
 			errs = append(errs, err)
 		}
 	}
 	return partitionKey, eerrors.Combine(errs...)
 }
 
-func (e *Environment) PartitionNumber(m *model.SyslogMessage) (partitionNumber int32, err error) {
+// PartitionNumber calls the PartitionNumber JS function. The function gets
+// the current number of partitions of the topic as a second argument, or 0
+// when it is not known.
+func (e *Environment) PartitionNumber(m *model.SyslogMessage, partitions int32) (partitionNumber int32, err error) {
 	errs := make([]error, 0)
 	var jsMessage goja.Value
 	var jsPartitionNumber goja.Value
@@ -383,7 +475,7 @@ func (e *Environment) PartitionNumber(m *model.SyslogMessage) (partitionNumber i
 	if e.jsPartitionNumber != nil {
 		jsMessage, err = e.toJsMessage(m)
 		if err == nil {
-			jsPartitionNumber, err = e.jsPartitionNumber(nil, jsMessage)
+			jsPartitionNumber, err = e.call(e.jsPartitionNumber, jsMessage, e.runtime.ToValue(partitions))
 			if err == nil {
 				partitionNumber = int32(jsPartitionNumber.ToInteger())
 			} else {
@@ -411,7 +503,7 @@ func (e *Environment) FilterMessage(m *model.SyslogMessage) (filterResult Filter
 	if err != nil {
 		return FILTER_ERROR, go2jsError(executingJSErrorFactory(err, "NewSyslogMessage"))
 	}
-	resJsMessage, err = e.jsFilterMessages(nil, jsMessage)
+	resJsMessage, err = e.call(e.jsFilterMessages, jsMessage)
 	if err != nil {
 		return FILTER_ERROR, executingJSErrorFactory(err, "FilterMessages")
 	}
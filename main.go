@@ -181,6 +181,12 @@ func execChild() error {
 	if err != nil && err != pflag.ErrHelp {
 		return fatalError("Error parsing flags", err)
 	}
+	if cmd.VerifyPrivDropFlag {
+		err = capabilities.VerifyDropped(false)
+		if err != nil {
+			return fatalError("Privilege drop verification failed, refusing to serve", err)
+		}
+	}
 	return cmd.ExecuteChild()
 }
 
@@ -194,10 +200,12 @@ func execServeParent() error {
 		}
 	*/
 
-	rootlogger, err := logging.SetupLogging(nil, cmd.LoglevelFlag, cmd.LogjsonFlag, cmd.SyslogFlag, cmd.LogfilenameFlag)
+	rootlogger, err := logging.SetupLogging(nil, cmd.LoglevelFlag, cmd.LogFormat(), cmd.SyslogFlag, cmd.LogfilenameFlag)
 	if err != nil {
 		return fatalError("Error when setting up main logger", err)
 	}
+	// the children write their fatal errors to stderr in the same format
+	_ = os.Setenv(logging.FormatEnv, cmd.LogFormat())
 	logger := rootlogger.New("proc", "parent")
 
 	ring, err := kring.NewRing()
@@ -304,7 +312,17 @@ func execServeParent() error {
 		Stdout:     os.Stdout,
 		Stderr:     os.Stderr,
 		ExtraFiles: extraFiles,
-		Env:        []string{"PATH=/bin:/usr/bin", fmt.Sprintf("SKEWER_SESSION=%s", ring.GetSessionID().String())},
+		Env: []string{
+			"PATH=/bin:/usr/bin",
+			fmt.Sprintf("SKEWER_SESSION=%s", ring.GetSessionID().String()),
+			fmt.Sprintf("%s=%s", logging.FormatEnv, cmd.LogFormat()),
+		},
+	}
+	if cmd.VerifyPrivDropFlag {
+		childProcess.Env = append(childProcess.Env, "SKEWER_VERIFY_PRIVDROP=TRUE")
+	}
+	if cmd.TestingSyntheticFlag {
+		childProcess.Env = append(childProcess.Env, "SKEWER_TESTING=TRUE")
 	}
 	if os.Getuid() != numuid {
 		// execute the child with the given uid, gid
@@ -344,10 +362,13 @@ func execServeParent() error {
 			case syscall.SIGHUP:
 				// reload configuration
 				_ = childProcess.Process.Signal(sig)
+			case syscall.SIGUSR2:
+				// reload GeoIP databases
+				_ = childProcess.Process.Signal(sig)
 			case syscall.SIGUSR1:
 				// log rotation
-				logging.SetupLogging(rootlogger, cmd.LoglevelFlag, cmd.LogjsonFlag, cmd.SyslogFlag, cmd.LogfilenameFlag)
-				logging.SetupLogging(logger, cmd.LoglevelFlag, cmd.LogjsonFlag, cmd.SyslogFlag, cmd.LogfilenameFlag)
+				logging.SetupLogging(rootlogger, cmd.LoglevelFlag, cmd.LogFormat(), cmd.SyslogFlag, cmd.LogfilenameFlag)
+				logging.SetupLogging(logger, cmd.LoglevelFlag, cmd.LogFormat(), cmd.SyslogFlag, cmd.LogfilenameFlag)
 				logger.Info("log rotation")
 			case syscall.SIGINT:
 			default:
@@ -355,7 +376,7 @@ func execServeParent() error {
 			}
 		}
 	}()
-	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGINT, syscall.SIGUSR1)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGINT, syscall.SIGUSR1, syscall.SIGUSR2)
 	logger.Debug("PIDs", "parent", os.Getpid(), "child", childProcess.Process.Pid)
 
 	state, _ := childProcess.Process.Wait()
@@ -419,7 +440,7 @@ func main() {
 		}
 		if err, ok := e.(error); ok {
 			if eerrors.Is("Fatal", err) {
-				fmt.Fprintln(os.Stderr, err.Error())
+				logging.PrintFatal(err)
 				exit(1)
 			}
 		}
@@ -428,7 +449,7 @@ func main() {
 
 	err := doMain()
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
+		logging.PrintFatal(err)
 		exit(1)
 	}
 	exit(0)
@@ -514,16 +535,23 @@ func runUnconfined(t base.Types) error {
 		base.MacOS,
 		base.KafkaSource,
 		base.Filesystem,
-		base.HTTPServer:
+		base.HTTPServer,
+		base.Synthetic,
+		base.FIFO,
+		base.Heartbeat,
+		base.Ingest:
 
 		if t == base.Store {
 			runtime.GOMAXPROCS(128)
 		}
-		dumpable.SetNonDumpable()
+		// plugins are non-dumpable, unless dumpable_plugins says otherwise
+		if os.Getenv("SKEWER_DUMPABLE") != "TRUE" {
+			dumpable.SetNonDumpable()
+		}
 		capabilities.NoNewPriv()
 
 		var binderClient binder.Client
-		logger := log15.New()
+		logger := logging.StderrLogger()
 		var pipe *os.File
 		var err error
 		var handle uintptr = 3
@@ -584,6 +612,16 @@ func runUnconfined(t base.Types) error {
 			pipe = os.NewFile(pipeHdl, "pipe")
 		}
 
+		if os.Getenv("SKEWER_VERIFY_PRIVDROP") == "TRUE" {
+			// the binder gives us the privileged sockets, so the plugin
+			// itself must not be able to do anything privileged
+			err = capabilities.VerifyDropped(os.Getenv("SKEWER_CONFINED") == "TRUE")
+			if err != nil {
+				logger.Crit("Privilege drop verification failed, refusing to serve", "error", err)
+				return fatalError("Privilege drop verification failed, refusing to serve", err)
+			}
+		}
+
 		err = scomp.SetupSeccomp(t)
 		if err != nil {
 			return fatalError("Seccomp setup error", err)
@@ -597,6 +635,7 @@ func runUnconfined(t base.Types) error {
 			t,
 			services.SetConfined(os.Getenv("SKEWER_CONFINED") == "TRUE"),
 			services.SetProfile(os.Getenv("SKEWER_PROFILE") == "TRUE"),
+			services.SetTesting(os.Getenv("SKEWER_TESTING") == "TRUE"),
 			services.SetRing(ring),
 			services.SetBinder(binderClient),
 			services.SetLogger(logger),
@@ -638,7 +677,8 @@ func runConfined(t base.Types) error {
 		if err != nil {
 			return fatalError("Error dropping caps", err)
 		}
-		err = syscall.Exec(path, []string{os.Args[0][9:]}, os.Environ())
+		// the plugin is still uid 0 in its user namespace
+		err = syscall.Exec(path, []string{os.Args[0][9:]}, namespaces.ConfinedEnviron(os.Environ()))
 		if err != nil {
 			return fatalError("execve error", err)
 		}
@@ -655,7 +695,11 @@ func runConfined(t base.Types) error {
 		base.Configuration,
 		base.KafkaSource,
 		base.Filesystem,
-		base.HTTPServer:
+		base.HTTPServer,
+		base.Synthetic,
+		base.FIFO,
+		base.Heartbeat,
+		base.Ingest:
 
 		path, err := osext.Executable()
 		if err != nil {
@@ -681,8 +725,7 @@ func runConfined(t base.Types) error {
 		if err != nil {
 			return fatalError("Error dropping caps", err)
 		}
-		environ := append(os.Environ(), "SKEWER_CONFINED=TRUE")
-		err = syscall.Exec(path, []string{os.Args[0][9:]}, environ)
+		err = syscall.Exec(path, []string{os.Args[0][9:]}, namespaces.ConfinedEnviron(os.Environ()))
 		if err != nil {
 			return fatalError("execve error", err)
 		}
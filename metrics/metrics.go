@@ -4,16 +4,48 @@ package metrics
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/inconshreveable/log15"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/services/base"
+	"github.com/stephane-martin/skewer/utils/recenterrors"
 )
 
+// ListenersFunc returns a snapshot of the active listeners, by service name.
+type ListenersFunc func() map[string][]model.ListenerInfo
+
+// ErrorsFunc returns the recent errors of the services.
+type ErrorsFunc func() recenterrors.Snapshot
+
+// ProfileFunc collects a profile from the named plugin.
+type ProfileFunc func(plugin, kind string, seconds int) ([]byte, error)
+
+// TransactionsFunc returns the transactions in progress of the RELP
+// connections, by service name.
+type TransactionsFunc func() map[string][]base.RelpTransactions
+
+// PauseFunc pauses, or resumes, a listener of the named plugin.
+type PauseFunc func(plugin, listener string, pause bool) error
+
+// DrainFunc makes the RELP clients of a listener of the named plugin
+// reconnect.
+type DrainFunc func(plugin, listener string) error
+
+// SeekFunc moves the consumers of the Kafka source.
+type SeekFunc func(req base.SeekRequest) error
+
+// maxSeekRequestSize bounds the body of the seek requests.
+const maxSeekRequestSize = 65536
+
 type MetricsServer struct {
 	server *http.Server
 }
@@ -35,7 +67,7 @@ func (l Logger) Println(v ...interface{}) {
 	l.Debug(buf.String())
 }
 
-func (m *MetricsServer) NewConf(c conf.MetricsConfig, logger log15.Logger, gatherers ...prometheus.Gatherer) {
+func (m *MetricsServer) NewConf(c conf.MetricsConfig, logger log15.Logger, listeners ListenersFunc, errors ErrorsFunc, profile ProfileFunc, txns TransactionsFunc, pause PauseFunc, seek SeekFunc, drain DrainFunc, gatherers ...prometheus.Gatherer) {
 	m.Stop()
 	var nonNilGatherers prometheus.Gatherers = filterGatherers(func(g prometheus.Gatherer) bool { return g != nil }, gatherers)
 	logger.Debug("Number of metric gatherers", "nb", len(nonNilGatherers))
@@ -43,6 +75,30 @@ func (m *MetricsServer) NewConf(c conf.MetricsConfig, logger log15.Logger, gathe
 	if strings.TrimSpace(c.Path) == "" {
 		c.Path = "/metrics"
 	}
+	if strings.TrimSpace(c.ListenersPath) == "" {
+		c.ListenersPath = "/listeners"
+	}
+	if strings.TrimSpace(c.ErrorsPath) == "" {
+		c.ErrorsPath = "/errors"
+	}
+	if strings.TrimSpace(c.ProfilePath) == "" {
+		c.ProfilePath = "/profile"
+	}
+	if strings.TrimSpace(c.TransactionsPath) == "" {
+		c.TransactionsPath = "/relp/transactions"
+	}
+	if strings.TrimSpace(c.PausePath) == "" {
+		c.PausePath = "/listeners/pause"
+	}
+	if strings.TrimSpace(c.ResumePath) == "" {
+		c.ResumePath = "/listeners/resume"
+	}
+	if strings.TrimSpace(c.SeekPath) == "" {
+		c.SeekPath = "/kafka/seek"
+	}
+	if strings.TrimSpace(c.DrainPath) == "" {
+		c.DrainPath = "/relp/drain"
+	}
 	if c.Port > 0 {
 		mux := http.NewServeMux()
 		mux.Handle(
@@ -55,6 +111,50 @@ func (m *MetricsServer) NewConf(c conf.MetricsConfig, logger log15.Logger, gathe
 				},
 			),
 		)
+		if listeners != nil {
+			mux.HandleFunc(c.ListenersPath, listenersHandler(logger, listeners))
+		}
+		if errors != nil {
+			mux.HandleFunc(c.ErrorsPath, func(w http.ResponseWriter, r *http.Request) {
+				b, err := json.Marshal(errors())
+				if err != nil {
+					logger.Warn("Error marshalling recent errors", "error", err)
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write(b)
+			})
+		}
+		if txns != nil {
+			mux.HandleFunc(c.TransactionsPath, func(w http.ResponseWriter, r *http.Request) {
+				b, err := json.Marshal(txns())
+				if err != nil {
+					logger.Warn("Error marshalling RELP transactions", "error", err)
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write(b)
+			})
+		}
+		if c.Pprof && profile != nil {
+			mux.HandleFunc(c.ProfilePath, profileHandler(logger, profile))
+		}
+		if c.Control && pause != nil {
+			mux.HandleFunc(c.PausePath, listenerHandler(logger, "pause", func(plugin, listener string) error {
+				return pause(plugin, listener, true)
+			}))
+			mux.HandleFunc(c.ResumePath, listenerHandler(logger, "resume", func(plugin, listener string) error {
+				return pause(plugin, listener, false)
+			}))
+		}
+		if c.Control && drain != nil {
+			mux.HandleFunc(c.DrainPath, listenerHandler(logger, "drain", drain))
+		}
+		if c.Control && seek != nil {
+			mux.HandleFunc(c.SeekPath, seekHandler(logger, seek))
+		}
 		m.server = &http.Server{
 			Addr:    fmt.Sprintf("127.0.0.1:%d", c.Port),
 			Handler: mux,
@@ -74,6 +174,118 @@ func (m *MetricsServer) NewConf(c conf.MetricsConfig, logger log15.Logger, gathe
 	}
 }
 
+// profileHandler serves a profile of the plugin given by the "plugin" query
+// parameter. The "kind" parameter defaults to a CPU profile, whose duration
+// is given by the "seconds" parameter.
+// listenersHandler serves the snapshot of the active listeners as JSON.
+func listenersHandler(logger log15.Logger, listeners ListenersFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		b, err := json.Marshal(listeners())
+		if err != nil {
+			logger.Warn("Error marshalling listeners infos", "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(b)
+	}
+}
+
+func profileHandler(logger log15.Logger, profile ProfileFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		plugin := strings.TrimSpace(q.Get("plugin"))
+		if plugin == "" {
+			http.Error(w, "plugin parameter is missing", http.StatusBadRequest)
+			return
+		}
+		kind := strings.TrimSpace(q.Get("kind"))
+		if kind == "" {
+			kind = "cpu"
+		}
+		seconds := 30
+		if s := q.Get("seconds"); s != "" {
+			var err error
+			seconds, err = strconv.Atoi(s)
+			if err != nil {
+				http.Error(w, "invalid seconds parameter", http.StatusBadRequest)
+				return
+			}
+		}
+		b, err := profile(plugin, kind, seconds)
+		if err != nil {
+			logger.Warn("Error collecting a profile", "plugin", plugin, "kind", kind, "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.pprof"`, plugin, kind))
+		_, _ = w.Write(b)
+	}
+}
+
+// listenerHandler applies the command to the listener given by the
+// "listener" query parameter, of the plugin given by the "plugin" parameter.
+// The command is only sent to the plugin: the outcome is reported by its logs
+// and by its metrics.
+func listenerHandler(logger log15.Logger, command string, do func(plugin, listener string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		plugin := strings.TrimSpace(q.Get("plugin"))
+		if plugin == "" {
+			http.Error(w, "plugin parameter is missing", http.StatusBadRequest)
+			return
+		}
+		listener := strings.TrimSpace(q.Get("listener"))
+		if listener == "" {
+			http.Error(w, "listener parameter is missing", http.StatusBadRequest)
+			return
+		}
+		err := do(plugin, listener)
+		if err != nil {
+			logger.Warn("Error sending a command for a listener", "command", command, "plugin", plugin, "listener", listener, "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// seekHandler moves the consumers of the Kafka source, as described by the
+// JSON base.SeekRequest in the request body.
+func seekHandler(logger log15.Logger, seek SeekFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req base.SeekRequest
+		err := json.NewDecoder(io.LimitReader(r.Body, maxSeekRequestSize)).Decode(&req)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid seek request: %s", err), http.StatusBadRequest)
+			return
+		}
+		err = req.Validate()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = seek(req)
+		if err != nil {
+			logger.Warn("Error seeking the Kafka consumers", "topic", req.Topic, "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
 func filterGatherers(predicate func(prometheus.Gatherer) bool, list []prometheus.Gatherer) []prometheus.Gatherer {
 	j := 0
 	for i, elem := range list {
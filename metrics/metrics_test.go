@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/services/base"
+)
+
+func TestListenersHandler(t *testing.T) {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	active := map[string][]model.ListenerInfo{
+		"relp": {
+			{BindAddr: "127.0.0.1", Port: 2514, Protocol: "tcp_or_relp", TLS: true},
+			{UnixSocketPath: "/run/relp.sock", Protocol: "tcp_or_relp"},
+		},
+		"udp": {{BindAddr: "0.0.0.0", Port: 514, Protocol: "udp"}},
+	}
+	calls := 0
+	listeners := func() map[string][]model.ListenerInfo {
+		calls++
+		return active
+	}
+
+	w := httptest.NewRecorder()
+	listenersHandler(logger, listeners)(w, httptest.NewRequest(http.MethodGet, "/listeners", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+	if ctype := w.Header().Get("Content-Type"); ctype != "application/json" {
+		t.Fatalf("unexpected content type: %s", ctype)
+	}
+	var snapshot map[string][]map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &snapshot)
+	if err != nil {
+		t.Fatalf("invalid JSON '%s': %v", w.Body.String(), err)
+	}
+	if len(snapshot) != 2 || len(snapshot["relp"]) != 2 || len(snapshot["udp"]) != 1 {
+		t.Fatalf("unexpected snapshot: %s", w.Body.String())
+	}
+	tcp := snapshot["relp"][0]
+	if tcp["bind_addr"] != "127.0.0.1" || tcp["port"] != float64(2514) || tcp["tls"] != true {
+		t.Errorf("unexpected listener: %v", tcp)
+	}
+	if unix := snapshot["relp"][1]; unix["unix_socket_path"] != "/run/relp.sock" || unix["tls"] != false {
+		t.Errorf("unexpected listener: %v", unix)
+	}
+
+	// the snapshot is taken for each request
+	active = map[string][]model.ListenerInfo{}
+	w = httptest.NewRecorder()
+	listenersHandler(logger, listeners)(w, httptest.NewRequest(http.MethodGet, "/listeners", nil))
+	if strings.TrimSpace(w.Body.String()) != "{}" || calls != 2 {
+		t.Errorf("the listeners were not queried again: %s", w.Body.String())
+	}
+}
+
+func TestListenerHandler(t *testing.T) {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	type call struct {
+		command, plugin, listener string
+	}
+	var calls []call
+	do := func(command string) func(plugin, listener string) error {
+		return func(plugin, listener string) error {
+			if plugin == "missing" {
+				return errors.New("Plugin 'skewer-missing' is not running")
+			}
+			calls = append(calls, call{command: command, plugin: plugin, listener: listener})
+			return nil
+		}
+	}
+
+	tests := []struct {
+		method  string
+		url     string
+		command string
+		status  int
+	}{
+		{http.MethodPost, "/listeners/pause?plugin=relp&listener=:2514", "pause", http.StatusAccepted},
+		{http.MethodPost, "/listeners/resume?plugin=relp&listener=:2514", "resume", http.StatusAccepted},
+		{http.MethodPost, "/relp/drain?plugin=directrelp&listener=/run/relp.sock", "drain", http.StatusAccepted},
+		{http.MethodGet, "/listeners/pause?plugin=relp&listener=:2514", "pause", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/listeners/pause?listener=:2514", "pause", http.StatusBadRequest},
+		{http.MethodPost, "/relp/drain?plugin=relp", "drain", http.StatusBadRequest},
+		{http.MethodPost, "/listeners/pause?plugin=missing&listener=:2514", "pause", http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		listenerHandler(logger, tt.command, do(tt.command))(w, httptest.NewRequest(tt.method, tt.url, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.url, tt.status, w.Code)
+		}
+	}
+	expected := []call{{"pause", "relp", ":2514"}, {"resume", "relp", ":2514"}, {"drain", "directrelp", "/run/relp.sock"}}
+	if len(calls) != len(expected) {
+		t.Fatalf("unexpected calls: %v", calls)
+	}
+	for i := range expected {
+		if calls[i] != expected[i] {
+			t.Fatalf("unexpected calls: %v", calls)
+		}
+	}
+}
+
+func TestSeekHandler(t *testing.T) {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	var requests []base.SeekRequest
+	seek := func(req base.SeekRequest) error {
+		if req.Topic == "unconsumed" {
+			return errors.New("No running Kafka consumer for topic 'unconsumed'")
+		}
+		requests = append(requests, req)
+		return nil
+	}
+
+	tests := []struct {
+		method string
+		body   string
+		status int
+	}{
+		{http.MethodPost, `{"topic":"logs","partitions":[0,2],"position":"offset","offset":42}`, http.StatusAccepted},
+		{http.MethodGet, "", http.StatusMethodNotAllowed},
+		{http.MethodPost, `{"topic":`, http.StatusBadRequest},
+		{http.MethodPost, `{"position":"beginning"}`, http.StatusBadRequest},
+		{http.MethodPost, `{"topic":"logs","position":"offset","offset":-1}`, http.StatusBadRequest},
+		{http.MethodPost, `{"topic":"unconsumed","position":"end"}`, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		seekHandler(logger, seek)(w, httptest.NewRequest(tt.method, "/kafka/seek", strings.NewReader(tt.body)))
+		if w.Code != tt.status {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.body, tt.status, w.Code)
+		}
+	}
+	if len(requests) != 1 {
+		t.Fatalf("unexpected seek requests: %v", requests)
+	}
+	req := requests[0]
+	if req.Topic != "logs" || len(req.Partitions) != 2 || req.Partitions[1] != 2 || req.Position != base.SeekOffset || req.Offset != 42 {
+		t.Fatalf("unexpected seek request: %+v", req)
+	}
+}
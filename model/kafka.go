@@ -1,6 +1,31 @@
 package model
 
-import sarama "github.com/Shopify/sarama"
+import (
+	sarama "github.com/Shopify/sarama"
+	"github.com/stephane-martin/skewer/conf"
+)
+
+// KafkaHeaders returns the Kafka record headers promoted from the structured
+// data of the message. The fields that the message does not have are
+// skipped. It returns nil when no header was promoted.
+func (m *FullMessage) KafkaHeaders(promoted []conf.KafkaSDHeaderConfig) []sarama.RecordHeader {
+	var headers []sarama.RecordHeader
+	for _, h := range promoted {
+		kv := m.Fields.Properties.Map[h.SDID]
+		if kv == nil {
+			continue
+		}
+		value, ok := kv.Map[h.SDParam]
+		if !ok {
+			continue
+		}
+		if headers == nil {
+			headers = make([]sarama.RecordHeader, 0, len(promoted))
+		}
+		headers = append(headers, sarama.RecordHeader{Key: []byte(h.Header), Value: []byte(value)})
+	}
+	return headers
+}
 
 func IsFatalKafkaError(e error) bool {
 	switch e {
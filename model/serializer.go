@@ -0,0 +1,70 @@
+package model
+
+import (
+	fflib "github.com/pquerna/ffjson/fflib/v1"
+)
+
+// JSONSerializer serializes syslog messages to the regular JSON format with
+// a reusable buffer. It is not safe for concurrent use.
+//
+// The buffer is kept between messages only while it is at most maxBuffer
+// bytes large, so that a few huge messages do not inflate the memory of a
+// long-running process for good. The messages that are expected to be larger
+// than maxBuffer are encoded in a buffer allocated at their size, that is
+// handed over to the caller.
+type JSONSerializer struct {
+	buf       fflib.Buffer
+	maxBuffer int
+}
+
+// NewJSONSerializer returns a serializer that keeps a buffer of at most
+// maxBuffer bytes. With maxBuffer 0, no buffer is kept.
+func NewJSONSerializer(maxBuffer int) *JSONSerializer {
+	return &JSONSerializer{maxBuffer: maxBuffer}
+}
+
+// estimatedJSONSize is a cheap upper estimate of the size of the regular JSON
+// serialization of the message, before escaping.
+func (m *SyslogMessage) estimatedJSONSize() int {
+	size := 256 + len(m.HostName) + len(m.AppName) + len(m.ProcId) + len(m.MsgId) + len(m.Message)
+	for domain, props := range m.Properties.Map {
+		size += len(domain) + 8
+		if props == nil {
+			continue
+		}
+		for k, v := range props.Map {
+			size += len(k) + len(v) + 6
+		}
+	}
+	return size
+}
+
+// Serialize returns the regular JSON serialization of the message. The
+// returned slice belongs to the caller.
+func (s *JSONSerializer) Serialize(m *SyslogMessage) ([]byte, error) {
+	if m == nil {
+		return nil, nil
+	}
+	estimated := m.estimatedJSONSize()
+	if estimated > s.maxBuffer {
+		// oversized message: encode straight into a buffer of the expected
+		// size, with some room for the escaping
+		buf := fflib.NewBuffer(make([]byte, 0, estimated+estimated/8))
+		err := m.Regular().MarshalJSONBuf(buf)
+		if err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	s.buf.Reset()
+	err := m.Regular().MarshalJSONBuf(&s.buf)
+	var serialized []byte
+	if err == nil {
+		serialized = append(make([]byte, 0, s.buf.Len()), s.buf.Bytes()...)
+	}
+	if cap(s.buf.Bytes()) > s.maxBuffer {
+		// the buffer grew beyond the limit: do not keep it
+		s.buf = fflib.Buffer{}
+	}
+	return serialized, err
+}
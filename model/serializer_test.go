@@ -0,0 +1,58 @@
+package model
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestJSONSerializer(t *testing.T) {
+	const maxBuffer = 64 << 10
+	s := NewJSONSerializer(maxBuffer)
+
+	var previous [][]byte
+	for i := 0; i < 50; i++ {
+		m := &SyslogMessage{HostName: "host", AppName: "app", Message: "small message"}
+		m.SetProperty("skewer", "client", "127.0.0.1")
+		switch {
+		case i%10 == 3:
+			// larger than the kept buffer
+			m.Message = strings.Repeat("huge ", 200<<10)
+		case i%10 == 7:
+			// just below the limit, but the escaping makes it grow beyond
+			m.Message = strings.Repeat("\"", maxBuffer-512)
+		}
+		expected, err := m.RegularJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		serialized, err := s.Serialize(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(serialized, expected) {
+			t.Fatalf("message %d: unexpected serialization", i)
+		}
+		if c := cap(s.buf.Bytes()); c > maxBuffer {
+			t.Fatalf("message %d: a buffer of %d bytes was kept", i, c)
+		}
+		previous = append(previous, serialized)
+	}
+	// the serialized messages belong to the caller: they were not overwritten
+	for i, serialized := range previous {
+		if i%10 != 3 && i%10 != 7 && !bytes.Contains(serialized, []byte("small message")) {
+			t.Fatalf("message %d was overwritten", i)
+		}
+	}
+
+	// without reuse, every message has a buffer of its own
+	s = NewJSONSerializer(0)
+	m := &SyslogMessage{Message: "hello"}
+	serialized, err := s.Serialize(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(serialized, []byte("hello")) || s.buf.Bytes() != nil {
+		t.Fatalf("unexpected serialization with no reuse: %s", serialized)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"net"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/stephane-martin/skewer/conf"
 	"github.com/stephane-martin/skewer/utils"
@@ -13,6 +14,17 @@ type Stasher interface {
 	Stash(m *FullMessage) (error, error)
 }
 
+// AckFunc is called once the fate of a stashed message is known: ok is true
+// when all the destinations have acknowledged the message, false when one of
+// them has rejected it or when the message was lost.
+type AckFunc func(uid utils.MyULID, ok bool)
+
+// Ack is the outcome of a stashed message, as the Store reports it.
+type Ack struct {
+	Uid utils.MyULID `json:"uid"`
+	OK  bool         `json:"ok"`
+}
+
 type Reporter interface {
 	Stasher
 	Report(infos []ListenerInfo) error
@@ -23,6 +35,10 @@ type ListenerInfo struct {
 	BindAddr       string `json:"bind_addr" mdg:"bind_addr"`
 	UnixSocketPath string `json:"unix_socket_path" msg:"unix_socket_path"`
 	Protocol       string `json:"protocol" msg:"protocol"`
+	TLS            bool   `json:"tls" msg:"tls"`
+	// Interface is the network interface that the listener is bound to.
+	// BindAddr is then its resolved address.
+	Interface string `json:"interface,omitempty" msg:"interface"`
 }
 
 type RawFileMessage struct {
@@ -41,6 +57,7 @@ type RawMessage struct {
 	LocalPort      int
 	UnixSocketPath string
 	ConfID         utils.MyULID
+	Received       time.Time
 }
 
 type RawKafkaMessage struct {
@@ -58,12 +75,26 @@ type RawTCPMessage struct {
 	Message []byte
 	Txnr    int32
 	ConnID  utils.MyULID
+	// Seq is the sequence number of the message in its connection, when
+	// the ordering check is enabled, 0 otherwise
+	Seq uint64
 }
 
 type RawUDPMessage struct {
 	RawMessage
 	Message [65536]byte
 	Size    int
+	// Creds are the credentials of the process that sent the message on a
+	// unix socket, when HasCreds is set.
+	Creds    Credentials
+	HasCreds bool
+}
+
+// Credentials identify a local process.
+type Credentials struct {
+	Pid int32
+	Uid uint32
+	Gid uint32
 }
 
 type DeferedRequest struct {
@@ -113,6 +144,7 @@ func (raw *RawUDPMessage) GetMessage() []byte {
 
 func RawUDPFromConn(conn net.PacketConn) (raw *RawUDPMessage, remote net.Addr, err error) {
 	raw = RawUDPFactory()
+	raw.HasCreds = false
 	raw.Size, remote, err = conn.ReadFrom(raw.Message[:])
 	return raw, remote, err
 }
@@ -152,6 +152,30 @@ func FullFactoryFrom(smsg *SyslogMessage) (msg *FullMessage) {
 	return msg
 }
 
+// Expired returns true if the message was received more than maxAge ago.
+// Messages without a reception time never expire.
+func (m *FullMessage) Expired(maxAge time.Duration, now time.Time) bool {
+	if maxAge <= 0 || m.TimeReceivedNum == 0 {
+		return false
+	}
+	return now.Sub(time.Unix(0, m.TimeReceivedNum)) > maxAge
+}
+
+// Timestamp returns the time of the message selected by source: "received",
+// "generated", or by default "reported". The reported time is returned when
+// the message has no reception time.
+func (m *FullMessage) Timestamp(source string) time.Time {
+	switch source {
+	case "received":
+		if m.TimeReceivedNum != 0 {
+			return time.Unix(0, m.TimeReceivedNum).UTC()
+		}
+	case "generated":
+		return m.Fields.GetTimeGenerated()
+	}
+	return m.Fields.GetTimeReported()
+}
+
 type OutputMsg struct {
 	Message         *FullMessage
 	PartitionKey    string
@@ -313,6 +337,8 @@ type RegularFullMessage struct {
 	SourcePath string         `json:"source_path,omitempty"`
 	SourcePort int32          `json:"source_port"`
 	Uid        string         `json:"uid,omitempty"`
+	Retries    int32          `json:"retries,omitempty"`
+	Checksum   string         `json:"checksum,omitempty"`
 	Fields     *RegularSyslog `json:"fields"`
 }
 
@@ -331,6 +357,8 @@ func (m *RegularFullMessage) Internal() (res *FullMessage, err error) {
 	res.SourcePath = m.SourcePath
 	res.SourcePort = m.SourcePort
 	res.Uid = uid
+	res.Retries = m.Retries
+	res.Checksum = m.Checksum
 	return res, nil
 }
 
@@ -344,6 +372,8 @@ func (m *FullMessage) Regular() *RegularFullMessage {
 		SourcePath: m.SourcePath,
 		SourcePort: m.SourcePort,
 		Uid:        m.Uid.String(),
+		Retries:    m.Retries,
+		Checksum:   m.Checksum,
 		Fields:     m.Fields.Regular(),
 	}
 }
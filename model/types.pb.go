@@ -181,15 +181,18 @@ func (m *SyslogMessage) GetProperties() Properties {
 }
 
 type FullMessage struct {
-	Txnr       int32                                          `protobuf:"varint,1,opt,name=txnr,proto3" json:"txnr,omitempty"`
-	ClientAddr string                                         `protobuf:"bytes,2,opt,name=client_addr,json=clientAddr,proto3" json:"client_addr,omitempty"`
-	SourceType string                                         `protobuf:"bytes,3,opt,name=source_type,json=sourceType,proto3" json:"source_type,omitempty"`
-	SourcePath string                                         `protobuf:"bytes,4,opt,name=source_path,json=sourcePath,proto3" json:"source_path,omitempty"`
-	SourcePort int32                                          `protobuf:"varint,5,opt,name=source_port,json=sourcePort,proto3" json:"source_port,omitempty"`
-	ConnId     github_com_stephane_martin_skewer_utils.MyULID `protobuf:"bytes,6,opt,name=conn_id,json=connId,proto3,customtype=github.com/stephane-martin/skewer/utils.MyULID" json:"conn_id"`
-	ConfId     github_com_stephane_martin_skewer_utils.MyULID `protobuf:"bytes,7,opt,name=conf_id,json=confId,proto3,customtype=github.com/stephane-martin/skewer/utils.MyULID" json:"conf_id"`
-	Uid        github_com_stephane_martin_skewer_utils.MyULID `protobuf:"bytes,8,opt,name=uid,proto3,customtype=github.com/stephane-martin/skewer/utils.MyULID" json:"uid"`
-	Fields     *SyslogMessage                                 `protobuf:"bytes,9,opt,name=fields" json:"fields,omitempty"`
+	Txnr            int32                                          `protobuf:"varint,1,opt,name=txnr,proto3" json:"txnr,omitempty"`
+	ClientAddr      string                                         `protobuf:"bytes,2,opt,name=client_addr,json=clientAddr,proto3" json:"client_addr,omitempty"`
+	SourceType      string                                         `protobuf:"bytes,3,opt,name=source_type,json=sourceType,proto3" json:"source_type,omitempty"`
+	SourcePath      string                                         `protobuf:"bytes,4,opt,name=source_path,json=sourcePath,proto3" json:"source_path,omitempty"`
+	SourcePort      int32                                          `protobuf:"varint,5,opt,name=source_port,json=sourcePort,proto3" json:"source_port,omitempty"`
+	ConnId          github_com_stephane_martin_skewer_utils.MyULID `protobuf:"bytes,6,opt,name=conn_id,json=connId,proto3,customtype=github.com/stephane-martin/skewer/utils.MyULID" json:"conn_id"`
+	ConfId          github_com_stephane_martin_skewer_utils.MyULID `protobuf:"bytes,7,opt,name=conf_id,json=confId,proto3,customtype=github.com/stephane-martin/skewer/utils.MyULID" json:"conf_id"`
+	Uid             github_com_stephane_martin_skewer_utils.MyULID `protobuf:"bytes,8,opt,name=uid,proto3,customtype=github.com/stephane-martin/skewer/utils.MyULID" json:"uid"`
+	Fields          *SyslogMessage                                 `protobuf:"bytes,9,opt,name=fields" json:"fields,omitempty"`
+	TimeReceivedNum int64                                          `protobuf:"varint,10,opt,name=time_received_num,json=timeReceivedNum,proto3" json:"time_received_num,omitempty"`
+	Retries         int32                                          `protobuf:"varint,11,opt,name=retries,proto3" json:"retries,omitempty"`
+	Checksum        string                                         `protobuf:"bytes,12,opt,name=checksum,proto3" json:"checksum,omitempty"`
 }
 
 func (m *FullMessage) Reset()                    { *m = FullMessage{} }
@@ -238,6 +241,27 @@ func (m *FullMessage) GetFields() *SyslogMessage {
 	return nil
 }
 
+func (m *FullMessage) GetTimeReceivedNum() int64 {
+	if m != nil {
+		return m.TimeReceivedNum
+	}
+	return 0
+}
+
+func (m *FullMessage) GetRetries() int32 {
+	if m != nil {
+		return m.Retries
+	}
+	return 0
+}
+
+func (m *FullMessage) GetChecksum() string {
+	if m != nil {
+		return m.Checksum
+	}
+	return ""
+}
+
 func init() {
 	proto.RegisterType((*InnerProperties)(nil), "model.InnerProperties")
 	proto.RegisterType((*Properties)(nil), "model.Properties")
@@ -408,6 +432,15 @@ func (this *FullMessage) Equal(that interface{}) bool {
 	if !this.Fields.Equal(that1.Fields) {
 		return false
 	}
+	if this.TimeReceivedNum != that1.TimeReceivedNum {
+		return false
+	}
+	if this.Retries != that1.Retries {
+		return false
+	}
+	if this.Checksum != that1.Checksum {
+		return false
+	}
 	return true
 }
 func (this *InnerProperties) GoString() string {
@@ -480,7 +513,7 @@ func (this *FullMessage) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := make([]string, 0, 13)
+	s := make([]string, 0, 16)
 	s = append(s, "&model.FullMessage{")
 	s = append(s, "Txnr: "+fmt.Sprintf("%#v", this.Txnr)+",\n")
 	s = append(s, "ClientAddr: "+fmt.Sprintf("%#v", this.ClientAddr)+",\n")
@@ -493,6 +526,9 @@ func (this *FullMessage) GoString() string {
 	if this.Fields != nil {
 		s = append(s, "Fields: "+fmt.Sprintf("%#v", this.Fields)+",\n")
 	}
+	s = append(s, "TimeReceivedNum: "+fmt.Sprintf("%#v", this.TimeReceivedNum)+",\n")
+	s = append(s, "Retries: "+fmt.Sprintf("%#v", this.Retries)+",\n")
+	s = append(s, "Checksum: "+fmt.Sprintf("%#v", this.Checksum)+",\n")
 	s = append(s, "}")
 	return strings.Join(s, "")
 }
@@ -754,6 +790,22 @@ func (m *FullMessage) MarshalTo(dAtA []byte) (int, error) {
 		}
 		i += n6
 	}
+	if m.TimeReceivedNum != 0 {
+		dAtA[i] = 0x50
+		i++
+		i = encodeVarintTypes(dAtA, i, uint64(m.TimeReceivedNum))
+	}
+	if m.Retries != 0 {
+		dAtA[i] = 0x58
+		i++
+		i = encodeVarintTypes(dAtA, i, uint64(m.Retries))
+	}
+	if len(m.Checksum) > 0 {
+		dAtA[i] = 0x62
+		i++
+		i = encodeVarintTypes(dAtA, i, uint64(len(m.Checksum)))
+		i += copy(dAtA[i:], m.Checksum)
+	}
 	return i, nil
 }
 
@@ -880,6 +932,16 @@ func (m *FullMessage) Size() (n int) {
 		l = m.Fields.Size()
 		n += 1 + l + sovTypes(uint64(l))
 	}
+	if m.TimeReceivedNum != 0 {
+		n += 1 + sovTypes(uint64(m.TimeReceivedNum))
+	}
+	if m.Retries != 0 {
+		n += 1 + sovTypes(uint64(m.Retries))
+	}
+	l = len(m.Checksum)
+	if l > 0 {
+		n += 1 + l + sovTypes(uint64(l))
+	}
 	return n
 }
 
@@ -972,6 +1034,9 @@ func (this *FullMessage) String() string {
 		`ConfId:` + fmt.Sprintf("%v", this.ConfId) + `,`,
 		`Uid:` + fmt.Sprintf("%v", this.Uid) + `,`,
 		`Fields:` + strings.Replace(fmt.Sprintf("%v", this.Fields), "SyslogMessage", "SyslogMessage", 1) + `,`,
+		`TimeReceivedNum:` + fmt.Sprintf("%v", this.TimeReceivedNum) + `,`,
+		`Retries:` + fmt.Sprintf("%v", this.Retries) + `,`,
+		`Checksum:` + fmt.Sprintf("%v", this.Checksum) + `,`,
 		`}`,
 	}, "")
 	return s
@@ -1970,6 +2035,73 @@ func (m *FullMessage) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 10:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field TimeReceivedNum", wireType)
+			}
+			m.TimeReceivedNum = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTypes
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.TimeReceivedNum |= (int64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 11:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Retries", wireType)
+			}
+			m.Retries = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTypes
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Retries |= (int32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 12:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Checksum", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTypes
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthTypes
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Checksum = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipTypes(dAtA[iNdEx:])
@@ -2099,50 +2231,52 @@ var (
 func init() { proto.RegisterFile("model/types.proto", fileDescriptorTypes) }
 
 var fileDescriptorTypes = []byte{
-	// 707 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x94, 0xcf, 0x6f, 0xd3, 0x48,
-	0x14, 0xc7, 0xe3, 0xba, 0x89, 0xd3, 0x97, 0x56, 0x6d, 0x47, 0xdd, 0x5d, 0x6f, 0x57, 0x72, 0xaa,
-	0x4a, 0x2b, 0x45, 0xab, 0x6c, 0xa2, 0xed, 0xa2, 0x82, 0xb8, 0x11, 0x41, 0x21, 0x12, 0x2d, 0x95,
-	0x0b, 0x5c, 0xa3, 0x69, 0x66, 0xe2, 0x58, 0xb5, 0x3d, 0xa3, 0x99, 0x71, 0x20, 0x12, 0x07, 0xce,
-	0x9c, 0xf8, 0x33, 0xf8, 0x2f, 0xb8, 0xf6, 0xd8, 0x23, 0xe2, 0x10, 0xd1, 0x70, 0x81, 0x5b, 0xcf,
-	0x3d, 0xa1, 0x19, 0x3b, 0xa9, 0xf9, 0x79, 0x80, 0xdb, 0xbc, 0xef, 0xf7, 0x93, 0xf7, 0x6c, 0x7f,
-	0xdf, 0x04, 0xd6, 0x63, 0x46, 0x68, 0xd4, 0x56, 0x63, 0x4e, 0x65, 0x8b, 0x0b, 0xa6, 0x18, 0x2a,
-	0x1b, 0x69, 0xf3, 0xda, 0x88, 0x26, 0x84, 0x89, 0x76, 0x10, 0xaa, 0x61, 0x7a, 0xdc, 0xea, 0xb3,
-	0xb8, 0x1d, 0xb0, 0x80, 0xb5, 0x0d, 0x74, 0x9c, 0x0e, 0x4c, 0x65, 0x0a, 0x73, 0xca, 0x7e, 0xbc,
-	0xfd, 0x0c, 0x56, 0xbb, 0x49, 0x42, 0xc5, 0xa1, 0x60, 0x9c, 0x0a, 0x15, 0x52, 0x89, 0xfe, 0x03,
-	0x3b, 0xc6, 0xdc, 0xb5, 0xb6, 0xec, 0x46, 0x6d, 0xa7, 0xde, 0x32, 0xdd, 0x5b, 0x5f, 0x40, 0xad,
-	0x7d, 0xcc, 0xef, 0x24, 0x4a, 0x8c, 0x7d, 0xcd, 0x6e, 0xee, 0x42, 0x75, 0x26, 0xa0, 0x35, 0xb0,
-	0x4f, 0xe8, 0xd8, 0xb5, 0xb6, 0xac, 0xc6, 0x92, 0xaf, 0x8f, 0x68, 0x03, 0xca, 0x23, 0x1c, 0xa5,
-	0xd4, 0x5d, 0x30, 0x5a, 0x56, 0xdc, 0x5c, 0xb8, 0x61, 0x6d, 0xbf, 0xb0, 0x00, 0x0a, 0x93, 0x9b,
-	0xc5, 0xc9, 0x9b, 0xf9, 0xe4, 0xef, 0x0e, 0x3d, 0xf8, 0xe1, 0xd0, 0x66, 0x71, 0x68, 0x6d, 0xe7,
-	0xf7, 0x6f, 0xbf, 0x47, 0xf1, 0x61, 0x3e, 0xda, 0xb0, 0x72, 0x34, 0x96, 0x11, 0x0b, 0xf6, 0xa9,
-	0x94, 0x38, 0xa0, 0xa8, 0x01, 0x55, 0x2e, 0x42, 0x26, 0x42, 0x95, 0xb5, 0x2e, 0x77, 0x96, 0x2f,
-	0x27, 0xf5, 0xea, 0x61, 0xae, 0xf9, 0x73, 0x57, 0x93, 0x03, 0xdc, 0x0f, 0x23, 0x4d, 0x2e, 0x5c,
-	0x91, 0x7b, 0xb9, 0xe6, 0xcf, 0x5d, 0x4d, 0x4a, 0x3a, 0xa2, 0xa6, 0xa7, 0x7d, 0x45, 0x1e, 0xe5,
-	0x9a, 0x3f, 0x77, 0xd1, 0xdf, 0xe0, 0x8c, 0xa8, 0x90, 0x21, 0x4b, 0xdc, 0x45, 0x03, 0xd6, 0x2e,
-	0x27, 0x75, 0xe7, 0x71, 0x26, 0xf9, 0x33, 0x0f, 0xfd, 0x03, 0xeb, 0x2a, 0x8c, 0x69, 0x4f, 0x50,
-	0xce, 0x84, 0xa2, 0xa4, 0x97, 0xa4, 0xb1, 0x5b, 0xde, 0xb2, 0x1a, 0xb6, 0xbf, 0xaa, 0x0d, 0x3f,
-	0xd7, 0x0f, 0xd2, 0x18, 0x35, 0x01, 0x19, 0x36, 0xa0, 0x09, 0x15, 0x78, 0x06, 0x57, 0x0c, 0xbc,
-	0xa6, 0x9d, 0xbb, 0x33, 0x43, 0xd3, 0x7f, 0xc1, 0xd2, 0x90, 0x49, 0xd5, 0x4b, 0x70, 0x4c, 0x5d,
-	0xc7, 0x7c, 0xda, 0xaa, 0x16, 0x0e, 0x70, 0x4c, 0xd1, 0x9f, 0x50, 0xc5, 0x9c, 0x67, 0x5e, 0xd5,
-	0x78, 0x0e, 0xe6, 0xdc, 0x58, 0x7f, 0x80, 0xc3, 0x05, 0xeb, 0xf7, 0x42, 0xe2, 0x2e, 0x19, 0xa7,
-	0xa2, 0xcb, 0x2e, 0x41, 0xbf, 0x41, 0x25, 0x96, 0x81, 0xd6, 0x21, 0xdb, 0x84, 0x58, 0x06, 0x5d,
-	0x82, 0x3c, 0x00, 0xa9, 0x44, 0xda, 0x57, 0xa9, 0xa0, 0xc4, 0xad, 0x19, 0xab, 0xa0, 0x20, 0x17,
-	0x9c, 0x38, 0x4b, 0xc4, 0x5d, 0xce, 0x26, 0xe5, 0x25, 0xba, 0x0e, 0xc0, 0xe7, 0x59, 0xba, 0x2b,
-	0x26, 0xe9, 0xf5, 0xaf, 0xf6, 0xa6, 0xb3, 0x78, 0x3a, 0xa9, 0x97, 0xfc, 0x02, 0xba, 0xfd, 0xda,
-	0x86, 0xda, 0x5e, 0x1a, 0x45, 0xb3, 0xa4, 0x11, 0x2c, 0xaa, 0xa7, 0x89, 0xc8, 0x52, 0xf6, 0xcd,
-	0x19, 0xd5, 0xa1, 0xd6, 0x8f, 0x42, 0x9a, 0xa8, 0x1e, 0x26, 0x44, 0xe4, 0xcb, 0x0b, 0x99, 0x74,
-	0x8b, 0x10, 0x03, 0x48, 0x96, 0x8a, 0x3e, 0xed, 0xe9, 0xeb, 0x68, 0xd2, 0xd4, 0x0f, 0x6e, 0xa4,
-	0x87, 0x63, 0x4e, 0x0b, 0x00, 0xc7, 0x6a, 0x68, 0x52, 0x9c, 0x03, 0x87, 0x58, 0x0d, 0x8b, 0x00,
-	0x13, 0xca, 0xa4, 0x56, 0x9e, 0x03, 0x4c, 0x28, 0xf4, 0x00, 0x9c, 0x3e, 0x4b, 0x12, 0xfd, 0xc9,
-	0x74, 0x4a, 0xcb, 0x9d, 0x5d, 0xfd, 0x2a, 0x6f, 0x27, 0xf5, 0x56, 0xe1, 0x9a, 0x4b, 0x45, 0xf9,
-	0x10, 0x27, 0xf4, 0xdf, 0x18, 0x0b, 0x15, 0x26, 0x6d, 0x79, 0x42, 0x9f, 0x50, 0xd1, 0x4e, 0x55,
-	0x18, 0xc9, 0xd6, 0xfe, 0xf8, 0xd1, 0xfd, 0xee, 0x6d, 0xbf, 0xa2, 0xdb, 0x74, 0x49, 0xde, 0x70,
-	0xa0, 0x1b, 0x3a, 0xbf, 0xdc, 0x70, 0xd0, 0x25, 0xe8, 0x1e, 0xd8, 0x69, 0x48, 0xcc, 0x0a, 0xfc,
-	0x7c, 0x33, 0xdd, 0x02, 0x35, 0xa1, 0x32, 0x08, 0x69, 0x44, 0xa4, 0xd9, 0x9a, 0xda, 0xce, 0x46,
-	0x1e, 0xe4, 0x67, 0x77, 0xd2, 0xcf, 0x99, 0x4e, 0xf3, 0xec, 0xdc, 0x2b, 0xbd, 0x39, 0xf7, 0x4a,
-	0x17, 0xe7, 0x9e, 0xf5, 0x7c, 0xea, 0x59, 0xaf, 0xa6, 0x9e, 0x75, 0x3a, 0xf5, 0xac, 0xb3, 0xa9,
-	0x67, 0xbd, 0x9b, 0x7a, 0xd6, 0x87, 0xa9, 0x57, 0xba, 0x98, 0x7a, 0xd6, 0xcb, 0xf7, 0x5e, 0xe9,
-	0xb8, 0x62, 0xfe, 0xed, 0xfe, 0xff, 0x14, 0x00, 0x00, 0xff, 0xff, 0xba, 0x12, 0x7e, 0xf2, 0x3f,
+	// 739 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x94, 0xb1, 0x6f, 0xfb, 0x44,
+	0x14, 0xc7, 0xe3, 0x3a, 0x89, 0xdd, 0xe7, 0x56, 0x6d, 0x4f, 0x05, 0x4c, 0x90, 0x9c, 0xaa, 0x12,
+	0x52, 0x84, 0x42, 0x22, 0x0a, 0x2a, 0x88, 0x8d, 0x08, 0x0a, 0x91, 0x68, 0xa9, 0x5c, 0x60, 0x8d,
+	0x5c, 0xfb, 0xc5, 0xb1, 0x6a, 0xfb, 0x4e, 0x77, 0xe7, 0x40, 0x24, 0x06, 0x66, 0x26, 0xfe, 0x05,
+	0x36, 0xfe, 0x94, 0x8e, 0x1d, 0x11, 0x43, 0x44, 0xc3, 0x02, 0x5b, 0xe7, 0x4e, 0xe8, 0xce, 0x4e,
+	0x6a, 0xe0, 0xf7, 0xfb, 0x2d, 0xdd, 0xfc, 0xbe, 0xdf, 0x4f, 0xde, 0xb3, 0xef, 0x7d, 0x2f, 0x70,
+	0x90, 0xd1, 0x08, 0xd3, 0xa1, 0x5c, 0x30, 0x14, 0x03, 0xc6, 0xa9, 0xa4, 0xa4, 0xa5, 0xa5, 0xce,
+	0x07, 0x73, 0xcc, 0x23, 0xca, 0x87, 0x71, 0x22, 0x67, 0xc5, 0xf5, 0x20, 0xa4, 0xd9, 0x30, 0xa6,
+	0x31, 0x1d, 0x6a, 0xe8, 0xba, 0x98, 0xea, 0x4a, 0x17, 0xfa, 0xa9, 0xfc, 0xf1, 0xf1, 0x0f, 0xb0,
+	0x37, 0xce, 0x73, 0xe4, 0x97, 0x9c, 0x32, 0xe4, 0x32, 0x41, 0x41, 0xde, 0x03, 0x33, 0x0b, 0x98,
+	0x6b, 0x1c, 0x99, 0x3d, 0xe7, 0xa4, 0x3b, 0xd0, 0xdd, 0x07, 0xff, 0x81, 0x06, 0xe7, 0x01, 0xfb,
+	0x2c, 0x97, 0x7c, 0xe1, 0x2b, 0xb6, 0x73, 0x0a, 0xf6, 0x5a, 0x20, 0xfb, 0x60, 0xde, 0xe0, 0xc2,
+	0x35, 0x8e, 0x8c, 0xde, 0xb6, 0xaf, 0x1e, 0xc9, 0x21, 0xb4, 0xe6, 0x41, 0x5a, 0xa0, 0xbb, 0xa5,
+	0xb5, 0xb2, 0xf8, 0x78, 0xeb, 0x23, 0xe3, 0xf8, 0x27, 0x03, 0xa0, 0x36, 0xb9, 0x5f, 0x9f, 0xdc,
+	0xa9, 0x26, 0xbf, 0x74, 0xe8, 0xc5, 0x2b, 0x87, 0xf6, 0xeb, 0x43, 0x9d, 0x93, 0xd7, 0x5f, 0xfc,
+	0x1d, 0xf5, 0x97, 0xf9, 0xdb, 0x84, 0xdd, 0xab, 0x85, 0x48, 0x69, 0x7c, 0x8e, 0x42, 0x04, 0x31,
+	0x92, 0x1e, 0xd8, 0x8c, 0x27, 0x94, 0x27, 0xb2, 0x6c, 0xdd, 0x1a, 0xed, 0x3c, 0x2e, 0xbb, 0xf6,
+	0x65, 0xa5, 0xf9, 0x1b, 0x57, 0x91, 0xd3, 0x20, 0x4c, 0x52, 0x45, 0x6e, 0x3d, 0x91, 0x67, 0x95,
+	0xe6, 0x6f, 0x5c, 0x45, 0x0a, 0x9c, 0xa3, 0xee, 0x69, 0x3e, 0x91, 0x57, 0x95, 0xe6, 0x6f, 0x5c,
+	0xf2, 0x36, 0x58, 0x73, 0xe4, 0x22, 0xa1, 0xb9, 0xdb, 0xd4, 0xa0, 0xf3, 0xb8, 0xec, 0x5a, 0xdf,
+	0x96, 0x92, 0xbf, 0xf6, 0xc8, 0x3b, 0x70, 0x20, 0x93, 0x0c, 0x27, 0x1c, 0x19, 0xe5, 0x12, 0xa3,
+	0x49, 0x5e, 0x64, 0x6e, 0xeb, 0xc8, 0xe8, 0x99, 0xfe, 0x9e, 0x32, 0xfc, 0x4a, 0xbf, 0x28, 0x32,
+	0xd2, 0x07, 0xa2, 0xd9, 0x18, 0x73, 0xe4, 0xc1, 0x1a, 0x6e, 0x6b, 0x78, 0x5f, 0x39, 0x9f, 0xaf,
+	0x0d, 0x45, 0xbf, 0x05, 0xdb, 0x33, 0x2a, 0xe4, 0x24, 0x0f, 0x32, 0x74, 0x2d, 0x7d, 0xb4, 0xb6,
+	0x12, 0x2e, 0x82, 0x0c, 0xc9, 0x9b, 0x60, 0x07, 0x8c, 0x95, 0x9e, 0xad, 0x3d, 0x2b, 0x60, 0x4c,
+	0x5b, 0x6f, 0x80, 0xc5, 0x38, 0x0d, 0x27, 0x49, 0xe4, 0x6e, 0x6b, 0xa7, 0xad, 0xca, 0x71, 0x44,
+	0x5e, 0x83, 0x76, 0x26, 0x62, 0xa5, 0x43, 0x99, 0x84, 0x4c, 0xc4, 0xe3, 0x88, 0x78, 0x00, 0x42,
+	0xf2, 0x22, 0x94, 0x05, 0xc7, 0xc8, 0x75, 0xb4, 0x55, 0x53, 0x88, 0x0b, 0x56, 0x56, 0x6e, 0xc4,
+	0xdd, 0x29, 0x27, 0x55, 0x25, 0xf9, 0x10, 0x80, 0x6d, 0x76, 0xe9, 0xee, 0xea, 0x4d, 0x1f, 0xfc,
+	0x2f, 0x37, 0xa3, 0xe6, 0xed, 0xb2, 0xdb, 0xf0, 0x6b, 0xe8, 0xf1, 0x2f, 0x4d, 0x70, 0xce, 0x8a,
+	0x34, 0x5d, 0x6f, 0x9a, 0x40, 0x53, 0x7e, 0x9f, 0xf3, 0x72, 0xcb, 0xbe, 0x7e, 0x26, 0x5d, 0x70,
+	0xc2, 0x34, 0xc1, 0x5c, 0x4e, 0x82, 0x28, 0xe2, 0x55, 0x78, 0xa1, 0x94, 0x3e, 0x89, 0x22, 0x0d,
+	0x08, 0x5a, 0xf0, 0x10, 0x27, 0xea, 0x3a, 0xba, 0x66, 0xf5, 0xe2, 0x5a, 0xfa, 0x7a, 0xc1, 0xb0,
+	0x06, 0xb0, 0x40, 0xce, 0xdc, 0x66, 0x1d, 0xb8, 0x0c, 0xe4, 0xac, 0x0e, 0x50, 0x2e, 0xf5, 0xd6,
+	0x5a, 0x1b, 0x80, 0x72, 0x49, 0xbe, 0x02, 0x2b, 0xa4, 0x79, 0xae, 0x8e, 0x4c, 0x6d, 0x69, 0x67,
+	0x74, 0xaa, 0x3e, 0xe5, 0xf7, 0x65, 0x77, 0x50, 0xbb, 0xe6, 0x42, 0x22, 0x9b, 0x05, 0x39, 0xbe,
+	0x9b, 0x05, 0x5c, 0x26, 0xf9, 0x50, 0xdc, 0xe0, 0x77, 0xc8, 0x87, 0x85, 0x4c, 0x52, 0x31, 0x38,
+	0x5f, 0x7c, 0xf3, 0xe5, 0xf8, 0x53, 0xbf, 0xad, 0xda, 0x8c, 0xa3, 0xaa, 0xe1, 0x54, 0x35, 0xb4,
+	0x9e, 0xdd, 0x70, 0x3a, 0x8e, 0xc8, 0x17, 0x60, 0x16, 0x49, 0xe4, 0xda, 0xcf, 0x6a, 0xa6, 0x5a,
+	0x90, 0x3e, 0xb4, 0xa7, 0x09, 0xa6, 0x91, 0xd0, 0xa9, 0x71, 0x4e, 0x0e, 0xab, 0x45, 0xfe, 0xeb,
+	0x4e, 0xfa, 0x15, 0x53, 0x8b, 0x7d, 0x88, 0xc9, 0xbc, 0x4a, 0x32, 0xd4, 0x63, 0x5f, 0xea, 0x2a,
+	0xc8, 0x2e, 0x58, 0x1c, 0x25, 0x57, 0x19, 0x71, 0xf4, 0x11, 0xaf, 0x4b, 0xd2, 0x01, 0x3b, 0x9c,
+	0x61, 0x78, 0x23, 0x8a, 0xac, 0xca, 0xd6, 0xa6, 0x1e, 0xf5, 0xef, 0xee, 0xbd, 0xc6, 0x6f, 0xf7,
+	0x5e, 0xe3, 0xe1, 0xde, 0x33, 0x7e, 0x5c, 0x79, 0xc6, 0xaf, 0x2b, 0xcf, 0xb8, 0x5d, 0x79, 0xc6,
+	0xdd, 0xca, 0x33, 0xfe, 0x58, 0x79, 0xc6, 0x5f, 0x2b, 0xaf, 0xf1, 0xb0, 0xf2, 0x8c, 0x9f, 0xff,
+	0xf4, 0x1a, 0xd7, 0x6d, 0xfd, 0x7f, 0xfa, 0xfe, 0x3f, 0x03, 0x00, 0x53, 0x70, 0xdc, 0x7e, 0xa1,
 	0x05, 0x00, 0x00,
 }
@@ -2014,6 +2014,16 @@ func (j *RegularFullMessage) MarshalJSONBuf(buf fflib.EncodingBuffer) error {
 		fflib.WriteJsonString(buf, string(j.Uid))
 		buf.WriteByte(',')
 	}
+	if j.Retries != 0 {
+		buf.WriteString(`"retries":`)
+		fflib.FormatBits2(buf, uint64(j.Retries), 10, j.Retries < 0)
+		buf.WriteByte(',')
+	}
+	if len(j.Checksum) != 0 {
+		buf.WriteString(`"checksum":`)
+		fflib.WriteJsonString(buf, string(j.Checksum))
+		buf.WriteByte(',')
+	}
 	if j.Fields != nil {
 		buf.WriteString(`"fields":`)
 
@@ -2046,6 +2056,10 @@ const (
 
 	ffjtRegularFullMessageUid
 
+	ffjtRegularFullMessageRetries
+
+	ffjtRegularFullMessageChecksum
+
 	ffjtRegularFullMessageFields
 )
 
@@ -2059,6 +2073,10 @@ var ffjKeyRegularFullMessageSourcePort = []byte("source_port")
 
 var ffjKeyRegularFullMessageUid = []byte("uid")
 
+var ffjKeyRegularFullMessageRetries = []byte("retries")
+
+var ffjKeyRegularFullMessageChecksum = []byte("checksum")
+
 var ffjKeyRegularFullMessageFields = []byte("fields")
 
 // UnmarshalJSON umarshall json - template of ffjson
@@ -2128,6 +2146,11 @@ mainparse:
 						currentKey = ffjtRegularFullMessageClientAddr
 						state = fflib.FFParse_want_colon
 						goto mainparse
+
+					} else if bytes.Equal(ffjKeyRegularFullMessageChecksum, kn) {
+						currentKey = ffjtRegularFullMessageChecksum
+						state = fflib.FFParse_want_colon
+						goto mainparse
 					}
 
 				case 'f':
@@ -2138,6 +2161,14 @@ mainparse:
 						goto mainparse
 					}
 
+				case 'r':
+
+					if bytes.Equal(ffjKeyRegularFullMessageRetries, kn) {
+						currentKey = ffjtRegularFullMessageRetries
+						state = fflib.FFParse_want_colon
+						goto mainparse
+					}
+
 				case 's':
 
 					if bytes.Equal(ffjKeyRegularFullMessageSourceType, kn) {
@@ -2172,6 +2203,18 @@ mainparse:
 					goto mainparse
 				}
 
+				if fflib.EqualFoldRight(ffjKeyRegularFullMessageChecksum, kn) {
+					currentKey = ffjtRegularFullMessageChecksum
+					state = fflib.FFParse_want_colon
+					goto mainparse
+				}
+
+				if fflib.SimpleLetterEqualFold(ffjKeyRegularFullMessageRetries, kn) {
+					currentKey = ffjtRegularFullMessageRetries
+					state = fflib.FFParse_want_colon
+					goto mainparse
+				}
+
 				if fflib.SimpleLetterEqualFold(ffjKeyRegularFullMessageUid, kn) {
 					currentKey = ffjtRegularFullMessageUid
 					state = fflib.FFParse_want_colon
@@ -2234,6 +2277,12 @@ mainparse:
 				case ffjtRegularFullMessageUid:
 					goto handle_Uid
 
+				case ffjtRegularFullMessageRetries:
+					goto handle_Retries
+
+				case ffjtRegularFullMessageChecksum:
+					goto handle_Checksum
+
 				case ffjtRegularFullMessageFields:
 					goto handle_Fields
 
@@ -2385,6 +2434,62 @@ handle_Uid:
 	state = fflib.FFParse_after_value
 	goto mainparse
 
+handle_Retries:
+
+	/* handler: j.Retries type=int32 kind=int32 quoted=false*/
+
+	{
+		if tok != fflib.FFTok_integer && tok != fflib.FFTok_null {
+			return fs.WrapErr(fmt.Errorf("cannot unmarshal %s into Go value for int32", tok))
+		}
+	}
+
+	{
+
+		if tok == fflib.FFTok_null {
+
+		} else {
+
+			tval, err := fflib.ParseInt(fs.Output.Bytes(), 10, 32)
+
+			if err != nil {
+				return fs.WrapErr(err)
+			}
+
+			j.Retries = int32(tval)
+
+		}
+	}
+
+	state = fflib.FFParse_after_value
+	goto mainparse
+
+handle_Checksum:
+
+	/* handler: j.Checksum type=string kind=string quoted=false*/
+
+	{
+
+		{
+			if tok != fflib.FFTok_string && tok != fflib.FFTok_null {
+				return fs.WrapErr(fmt.Errorf("cannot unmarshal %s into Go value for string", tok))
+			}
+		}
+
+		if tok == fflib.FFTok_null {
+
+		} else {
+
+			outBuf := fs.Output.Bytes()
+
+			j.Checksum = string(string(outBuf))
+
+		}
+	}
+
+	state = fflib.FFParse_after_value
+	goto mainparse
+
 handle_Fields:
 
 	/* handler: j.Fields type=model.RegularSyslog kind=struct quoted=false*/
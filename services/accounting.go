@@ -35,6 +35,8 @@ type AccountingService struct {
 	fatalErrorChan chan struct{}
 	fatalOnce      *sync.Once
 	confined       bool
+	// fields maps the message fields to the attributes of the records
+	fields map[string]string
 }
 
 func NewAccountingService(env *base.ProviderEnv) (base.Provider, error) {
@@ -86,8 +88,9 @@ func (s *AccountingService) makeMessage(buf []byte, tick int64, hostname string,
 	fields.TimeGeneratedNum = time.Now().UnixNano()
 	fields.Version = 1
 	fields.Message = acct.Marshal()
+	acct.MapFields(fields, props, s.fields)
 	fields.ClearDomain("accounting")
-	fields.Properties.Map["accounting"].Map = acct.Properties()
+	fields.Properties.Map["accounting"].Map = props
 	fields.SetProperty("skewer", "client", hostname)
 
 	full := model.FullFactoryFrom(fields)
@@ -280,4 +283,10 @@ func (s *AccountingService) Shutdown() {
 
 func (s *AccountingService) SetConf(c conf.BaseConfig) {
 	s.Conf = c.Accounting
+	fields, err := c.Accounting.FieldMapping()
+	if err != nil {
+		// the mapping was checked with the configuration
+		s.logger.Warn("Invalid accounting field mapping", "error", err)
+	}
+	s.fields = fields
 }
@@ -5,6 +5,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/inconshreveable/log15"
 	"github.com/stephane-martin/skewer/conf"
@@ -18,6 +19,11 @@ type BaseService struct {
 	UnixSocketPaths []string
 	Connections     map[io.Closer]bool
 	QueueSize       uint64
+	// ParseWorkers is the number of goroutines that parse the raw messages
+	ParseWorkers int
+	// BindRetryPeriod is how long the listen addresses that are transiently
+	// unavailable are retried
+	BindRetryPeriod time.Duration
 
 	connMutex   sync.Mutex
 	statusMutex sync.Mutex
@@ -0,0 +1,41 @@
+package base
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+)
+
+// Checksum returns the checksum of the raw bytes of a message as
+// "<algorithm>:<hex digest>", or an empty string when the checksums are
+// disabled for the source.
+func Checksum(c *conf.DecoderBaseConfig, raw []byte) string {
+	var h hash.Hash
+	switch c.Checksum {
+	case "sha256":
+		h = sha256.New()
+	case "sha384":
+		h = sha512.New384()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return ""
+	}
+	_, _ = h.Write(raw)
+	return c.Checksum + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+// SetChecksum stamps the checksum of the raw message on the parsed message,
+// and in its skewer.checksum property, so that every destination format
+// delivers it.
+func SetChecksum(full *model.FullMessage, checksum string) {
+	if len(checksum) == 0 {
+		return
+	}
+	full.Checksum = checksum
+	full.Fields.SetProperty("skewer", "checksum", checksum)
+}
@@ -0,0 +1,80 @@
+package base
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+)
+
+func TestChecksum(t *testing.T) {
+	raw := []byte("<13>1 2018-01-01T00:00:00Z host app - - - hello")
+	sum256 := sha256.Sum256(raw)
+	sum384 := sha512.Sum384(raw)
+	sum512 := sha512.Sum512(raw)
+	tests := []struct {
+		algorithm string
+		expected  string
+	}{
+		{"", ""},
+		{"none", ""},
+		{"sha256", "sha256:" + hex.EncodeToString(sum256[:])},
+		{"sha384", "sha384:" + hex.EncodeToString(sum384[:])},
+		{"sha512", "sha512:" + hex.EncodeToString(sum512[:])},
+	}
+	for _, test := range tests {
+		c := conf.DecoderBaseConfig{Checksum: test.algorithm}
+		if checksum := Checksum(&c, raw); checksum != test.expected {
+			t.Errorf("%s: expected '%s', got '%s'", test.algorithm, test.expected, checksum)
+		}
+	}
+}
+
+func TestSetChecksum(t *testing.T) {
+	c := conf.DecoderBaseConfig{Checksum: "sha256"}
+	raw := []byte("hello")
+	checksum := Checksum(&c, raw)
+
+	full := model.FullFactoryFrom(model.Factory())
+	SetChecksum(full, checksum)
+	if full.Checksum != checksum || full.Fields.GetProperty("skewer", "checksum") != checksum {
+		t.Fatalf("the checksum was not set: '%s'", full.Checksum)
+	}
+
+	// the checksum survives the stores and the plugins
+	b, err := full.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := model.FullFactory()
+	err = decoded.Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Checksum != checksum {
+		t.Errorf("checksum lost by the protobuf encoding: '%s'", decoded.Checksum)
+	}
+	b, err = json.Marshal(full.Regular())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var regular model.RegularFullMessage
+	err = json.Unmarshal(b, &regular)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if regular.Checksum != checksum {
+		t.Errorf("checksum lost by the JSON encoding: '%s'", regular.Checksum)
+	}
+
+	// no checksum configured: nothing is set
+	full = model.FullFactoryFrom(model.Factory())
+	SetChecksum(full, Checksum(&conf.DecoderBaseConfig{Checksum: "none"}, raw))
+	if len(full.Checksum) > 0 || len(full.Fields.GetProperty("skewer", "checksum")) > 0 {
+		t.Errorf("unexpected checksum: '%s'", full.Checksum)
+	}
+}
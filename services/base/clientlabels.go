@@ -0,0 +1,84 @@
+package base
+
+import (
+	"sync"
+
+	"github.com/stephane-martin/skewer/utils/topk"
+)
+
+// OtherClients is the client label shared by the clients that are not among
+// the top clients by volume.
+const OtherClients = "other"
+
+// MaxClientLabels is the number of clients of a protocol that get their own
+// label in the per client metrics.
+const MaxClientLabels = 50
+
+// clientLabels bounds the cardinality of the client label of the per client
+// metrics, so that spoofed UDP sources can't make it explode. The clients
+// are ranked by received bytes with a space-saving sketch. At most max of
+// them own a label at a given time: a client takes the label of the smallest
+// labeled client when its guaranteed volume becomes larger. The metrics of the
+// evicted client are then deleted by evict.
+type clientLabels struct {
+	mu      sync.Mutex
+	max     int
+	sketch  *topk.SpaceSaving
+	labeled map[string]struct{}
+	evict   func(client string)
+}
+
+func newClientLabels(max int, evict func(string)) *clientLabels {
+	return &clientLabels{
+		max:     max,
+		sketch:  topk.New(4 * max),
+		labeled: make(map[string]struct{}, max),
+		evict:   evict,
+	}
+}
+
+// observe counts size received bytes for client, and calls f with the label
+// of the client. f is called under the lock, so that it does not race with the
+// eviction of the label.
+func (c *clientLabels) observe(client string, size int, f func(label string)) {
+	c.mu.Lock()
+	f(c.label(client, size))
+	c.mu.Unlock()
+}
+
+func (c *clientLabels) label(client string, size int) string {
+	if size <= 0 {
+		size = 1
+	}
+	count, err := c.sketch.Add(client, uint64(size))
+	if _, ok := c.labeled[client]; ok {
+		return client
+	}
+	if len(c.labeled) < c.max {
+		c.labeled[client] = struct{}{}
+		return client
+	}
+	// look for the labeled client with the smallest volume
+	var smallest string
+	var smallestCount uint64
+	first := true
+	for labeled := range c.labeled {
+		labeledCount, _, ok := c.sketch.Get(labeled)
+		if !ok {
+			// no longer tracked: its volume is at most the sketch minimum
+			labeledCount = c.sketch.Min()
+		}
+		if first || labeledCount < smallestCount {
+			smallest, smallestCount, first = labeled, labeledCount, false
+		}
+	}
+	if count-err <= smallestCount {
+		return OtherClients
+	}
+	delete(c.labeled, smallest)
+	if c.evict != nil {
+		c.evict(smallest)
+	}
+	c.labeled[client] = struct{}{}
+	return client
+}
@@ -0,0 +1,37 @@
+package base
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestClientLabelsBounded(t *testing.T) {
+	evicted := map[string]bool{}
+	c := newClientLabels(5, func(client string) { evicted[client] = true })
+	labels := map[string]bool{}
+	for i := 0; i < 10000; i++ {
+		// a flood of spoofed sources, and two legitimate heavy clients
+		labels[c.label(fmt.Sprintf("10.0.%d.%d", i/256, i%256), 100)] = true
+		labels[c.label("heavy-1", 1000)] = true
+		if i%2 == 0 {
+			labels[c.label("heavy-2", 1000)] = true
+		}
+	}
+	live := 0
+	for label := range labels {
+		if !evicted[label] {
+			live++
+		}
+	}
+	if live > 5+1 {
+		t.Fatalf("too many live client labels: %d", live)
+	}
+	if !labels[OtherClients] {
+		t.Fatal("the small clients should be aggregated")
+	}
+	for _, heavy := range []string{"heavy-1", "heavy-2"} {
+		if evicted[heavy] || c.label(heavy, 1) != heavy {
+			t.Fatalf("%s should keep its label", heavy)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package base
+
+import (
+	"time"
+
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+)
+
+// NormalizeTime compares the TimeReported field of a freshly parsed message
+// with the receive time, and applies the listener clock skew policy when the
+// difference exceeds the configured threshold. The skew is observed whatever
+// the policy. It returns false if the message should be dropped, in which case
+// the caller must free it.
+func NormalizeTime(t Types, m *model.SyslogMessage, c *conf.DecoderBaseConfig) bool {
+	if m == nil || c == nil || m.TimeReportedNum == 0 {
+		return true
+	}
+	now := time.Now()
+	skew := time.Duration(m.TimeReportedNum - now.UnixNano())
+	if ClockSkewHistogram != nil {
+		ClockSkewHistogram.WithLabelValues(Types2Names[t]).Observe(skew.Seconds())
+	}
+	if c.ClockSkewPolicy == "" || c.ClockSkewPolicy == "none" {
+		return true
+	}
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew <= c.ClockSkewThreshold {
+		return true
+	}
+	switch c.ClockSkewPolicy {
+	case "drop":
+		return false
+	case "clamp":
+		m.SetProperty("skewer", "original_timereported", m.GetTimeReported().Format(time.RFC3339Nano))
+		m.TimeReportedNum = now.UnixNano()
+	case "tag":
+		m.SetProperty("skewer", "clock_skewed", "true")
+	}
+	return true
+}
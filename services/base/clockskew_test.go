@@ -0,0 +1,62 @@
+package base
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+)
+
+func TestNormalizeTime(t *testing.T) {
+	skewed := time.Now().Add(-time.Hour)
+	tests := []struct {
+		policy   string
+		reported time.Time
+		keep     bool
+		clamped  bool
+		tagged   bool
+	}{
+		{"", skewed, true, false, false},
+		{"none", skewed, true, false, false},
+		{"drop", skewed, false, false, false},
+		{"drop", time.Now(), true, false, false},
+		{"clamp", skewed, true, true, false},
+		{"clamp", time.Now(), true, false, false},
+		{"tag", skewed, true, false, true},
+		{"tag", time.Now(), true, false, false},
+	}
+	saved := ClockSkewHistogram
+	defer func() { ClockSkewHistogram = saved }()
+	for _, test := range tests {
+		ClockSkewHistogram = prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{Name: "test_clock_skew_seconds", Help: "test"},
+			[]string{"protocol"},
+		)
+		c := conf.DecoderBaseConfig{ClockSkewPolicy: test.policy, ClockSkewThreshold: time.Minute}
+		m := model.Factory()
+		m.TimeReportedNum = test.reported.UnixNano()
+		keep := NormalizeTime(TCP, m, &c)
+		if keep != test.keep {
+			t.Errorf("policy '%s': expected keep=%t, got %t", test.policy, test.keep, keep)
+		}
+		clamped := m.TimeReportedNum != test.reported.UnixNano()
+		if clamped != test.clamped {
+			t.Errorf("policy '%s': expected clamped=%t, got %t", test.policy, test.clamped, clamped)
+		}
+		if test.clamped && m.GetProperty("skewer", "original_timereported") == "" {
+			t.Errorf("policy '%s': original time not recorded", test.policy)
+		}
+		tagged := m.GetProperty("skewer", "clock_skewed") == "true"
+		if tagged != test.tagged {
+			t.Errorf("policy '%s': expected tagged=%t, got %t", test.policy, test.tagged, tagged)
+		}
+		metric := &dto.Metric{}
+		ClockSkewHistogram.WithLabelValues(Types2Names[TCP]).(prometheus.Histogram).Write(metric)
+		if metric.GetHistogram().GetSampleCount() != 1 {
+			t.Errorf("policy '%s': expected one skew observation, got %d", test.policy, metric.GetHistogram().GetSampleCount())
+		}
+	}
+}
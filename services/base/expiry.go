@@ -0,0 +1,194 @@
+package base
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stephane-martin/skewer/utils"
+	"go.uber.org/atomic"
+)
+
+// ExpiringCounterVec is a CounterVec whose label series are deleted when they
+// have not been updated for a while, so that the series of the clients that
+// went away do not accumulate over long uptimes. The number of distinct
+// values of its "client" label is bounded too: the clients beyond the limit
+// are counted as utils.OtherLabel.
+type ExpiringCounterVec struct {
+	*prometheus.CounterVec
+	name   string
+	series sync.Map
+	// client is the index of the "client" label, or -1
+	client  int
+	clients *utils.LabelLimiter
+}
+
+type expiringSeries struct {
+	labels  []string
+	touched atomic.Int64
+	// acquired is true when the client of the series counts in the limit
+	acquired bool
+}
+
+var expiringMu sync.Mutex
+var expiringVecs []*ExpiringCounterVec
+
+// DefaultMaxClients is the default number of distinct clients of the
+// ExpiringCounterVecs.
+const DefaultMaxClients = 1000
+
+var clientsLimit = atomic.NewInt64(DefaultMaxClients)
+
+// NewExpiringCounterVec creates an ExpiringCounterVec. It is swept by
+// ExpireMetrics.
+func NewExpiringCounterVec(opts prometheus.CounterOpts, labelNames []string) *ExpiringCounterVec {
+	v := &ExpiringCounterVec{
+		CounterVec: prometheus.NewCounterVec(opts, labelNames),
+		name:       prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+		client:     -1,
+	}
+	for i, name := range labelNames {
+		if name == "client" {
+			v.client = i
+			v.clients = utils.NewLabelLimiter(int(clientsLimit.Load()))
+		}
+	}
+	expiringMu.Lock()
+	expiringVecs = append(expiringVecs, v)
+	expiringMu.Unlock()
+	return v
+}
+
+// WithLabelValues returns the counter of the series, and marks the series as
+// updated.
+func (v *ExpiringCounterVec) WithLabelValues(lvs ...string) prometheus.Counter {
+	key := strings.Join(lvs, "\xff")
+	now := time.Now().UnixNano()
+	if s, ok := v.series.Load(key); ok {
+		s.(*expiringSeries).touched.Store(now)
+		return v.CounterVec.WithLabelValues(lvs...)
+	}
+	s := &expiringSeries{labels: append([]string(nil), lvs...)}
+	if v.client >= 0 {
+		s.labels[v.client] = v.clients.Acquire(lvs[v.client])
+		s.acquired = s.labels[v.client] != utils.OtherLabel
+		if !s.acquired {
+			key = strings.Join(s.labels, "\xff")
+		}
+	}
+	s.touched.Store(now)
+	if previous, loaded := v.series.LoadOrStore(key, s); loaded {
+		// created concurrently, or an other client
+		previous.(*expiringSeries).touched.Store(now)
+		if s.acquired {
+			v.clients.Release(s.labels[v.client])
+		}
+	}
+	return v.CounterVec.WithLabelValues(s.labels...)
+}
+
+// expire deletes the series that were not updated since before.
+func (v *ExpiringCounterVec) expire(before time.Time) (n int) {
+	limit := before.UnixNano()
+	v.series.Range(func(key, value interface{}) bool {
+		s := value.(*expiringSeries)
+		if s.touched.Load() < limit {
+			v.series.Delete(key)
+			v.CounterVec.DeleteLabelValues(s.labels...)
+			if s.acquired {
+				v.clients.Release(s.labels[v.client])
+			}
+			n++
+		}
+		return true
+	})
+	return n
+}
+
+// Reset deletes all the series.
+func (v *ExpiringCounterVec) Reset() {
+	v.series.Range(func(key, _ interface{}) bool {
+		v.series.Delete(key)
+		return true
+	})
+	v.CounterVec.Reset()
+	if v.clients != nil {
+		v.clients.Reset()
+	}
+}
+
+// ExpireMetrics deletes the series of the expiring vecs that were not updated
+// since before, and returns the number of deleted series.
+func ExpireMetrics(before time.Time) (n int) {
+	expiringMu.Lock()
+	vecs := expiringVecs
+	expiringMu.Unlock()
+	for _, v := range vecs {
+		n += v.expire(before)
+	}
+	return n
+}
+
+// ResetMetrics resets the expiring vecs of the given metric families.
+func ResetMetrics(families []string) {
+	if len(families) == 0 {
+		return
+	}
+	expiringMu.Lock()
+	vecs := expiringVecs
+	expiringMu.Unlock()
+	for _, v := range vecs {
+		for _, family := range families {
+			if v.name == family {
+				v.Reset()
+			}
+		}
+	}
+}
+
+func setMaxClients(max int) {
+	if max == 0 {
+		max = DefaultMaxClients
+	}
+	clientsLimit.Store(int64(max))
+	expiringMu.Lock()
+	vecs := expiringVecs
+	expiringMu.Unlock()
+	for _, v := range vecs {
+		if v.clients != nil {
+			v.clients.SetMax(max)
+		}
+	}
+}
+
+var metricsExpiry atomic.Duration
+var sweeperOnce sync.Once
+
+// ConfigureMetrics resets the given metric families, sets the maximum number
+// of distinct clients of each family, and starts to expire the series that
+// were not updated during expiry. An expiry of 0 disables the expiration, and
+// a negative maxClients disables the limit.
+func ConfigureMetrics(expiry time.Duration, reset []string, maxClients int) {
+	ResetMetrics(reset)
+	setMaxClients(maxClients)
+	metricsExpiry.Store(expiry)
+	if expiry <= 0 {
+		return
+	}
+	sweeperOnce.Do(func() {
+		go func() {
+			for {
+				expiry := metricsExpiry.Load()
+				if expiry <= 0 {
+					time.Sleep(time.Minute)
+					continue
+				}
+				// sweep several times per expiry window, so that the series
+				// don't outlive it by much
+				time.Sleep(expiry / 4)
+				ExpireMetrics(time.Now().Add(-metricsExpiry.Load()))
+			}
+		}()
+	})
+}
@@ -0,0 +1,85 @@
+package base
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stephane-martin/skewer/utils"
+)
+
+func countSeries(c prometheus.Collector) int {
+	ch := make(chan prometheus.Metric, 16)
+	c.Collect(ch)
+	close(ch)
+	return len(ch)
+}
+
+func TestExpiringCounterVec(t *testing.T) {
+	v := NewExpiringCounterVec(prometheus.CounterOpts{Name: "skw_test_expiring_total"}, []string{"client"})
+	v.WithLabelValues("gone").Inc()
+	time.Sleep(10 * time.Millisecond)
+	before := time.Now()
+	v.WithLabelValues("active").Inc()
+	if countSeries(v) != 2 {
+		t.Fatalf("expected 2 series, got %d", countSeries(v))
+	}
+
+	if n := ExpireMetrics(before); n != 1 {
+		t.Fatalf("expected 1 expired series, got %d", n)
+	}
+	if countSeries(v) != 1 {
+		t.Fatalf("the stale series was not deleted: %d series", countSeries(v))
+	}
+	// an expired series is created again when it is updated
+	v.WithLabelValues("gone").Inc()
+	if countSeries(v) != 2 {
+		t.Fatalf("expected 2 series, got %d", countSeries(v))
+	}
+
+	ResetMetrics([]string{"skw_other_total"})
+	if countSeries(v) != 2 {
+		t.Fatal("another family should not be reset")
+	}
+	ResetMetrics([]string{"skw_test_expiring_total"})
+	if countSeries(v) != 0 || ExpireMetrics(time.Now()) != 0 {
+		t.Fatal("the family was not reset")
+	}
+}
+
+func seriesValue(t *testing.T, v *ExpiringCounterVec, lvs ...string) float64 {
+	var m dto.Metric
+	if err := v.CounterVec.WithLabelValues(lvs...).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestExpiringCounterVecMaxClients(t *testing.T) {
+	setMaxClients(2)
+	defer setMaxClients(DefaultMaxClients)
+	v := NewExpiringCounterVec(prometheus.CounterOpts{Name: "skw_test_clients_total"}, []string{"status", "client"})
+	v.WithLabelValues("200", "a").Inc()
+	v.WithLabelValues("500", "a").Inc()
+	v.WithLabelValues("200", "b").Inc()
+	// the clients beyond the limit share a series
+	v.WithLabelValues("200", "c").Inc()
+	v.WithLabelValues("200", "d").Inc()
+	if countSeries(v) != 4 {
+		t.Fatalf("expected 4 series, got %d", countSeries(v))
+	}
+	if n := seriesValue(t, v, "200", utils.OtherLabel); n != 2 {
+		t.Fatalf("expected 2 messages of the other clients, got %v", n)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	before := time.Now()
+	v.WithLabelValues("200", "b").Inc()
+	ExpireMetrics(before)
+	// the series of a have expired: c takes its place
+	v.WithLabelValues("200", "c").Inc()
+	if n := seriesValue(t, v, "200", "c"); n != 1 {
+		t.Fatalf("c should have its own series after a expired, got %v", n)
+	}
+}
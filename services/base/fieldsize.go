@@ -0,0 +1,204 @@
+package base
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stephane-martin/skewer/model"
+)
+
+// FieldSizeHistogram observes the sizes of the fields of the parsed messages,
+// by listener. The per client sizes of the raw messages are observed by
+// MessageSizeHistogram.
+var FieldSizeHistogram = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name: "skw_field_size_bytes",
+		Help: "size of the message, structured data and hostname of the parsed messages",
+		// 4B to 256KiB
+		Buckets: prometheus.ExponentialBuckets(4, 4, 9),
+	},
+	[]string{"protocol", "listener", "field"},
+)
+
+// MaxMessageSize reports the length of the largest message of each listener
+// in the sliding window, so that the alerts can fire on spikes.
+var MaxMessageSize = newMaxSizeCollector()
+
+var fieldSizesEnabled int32
+
+// ConfigureFieldSizes enables the field size metrics, with the given sliding
+// window for the largest message.
+func ConfigureFieldSizes(enabled bool, window time.Duration) {
+	if enabled {
+		atomic.StoreInt32(&fieldSizesEnabled, 1)
+	} else {
+		atomic.StoreInt32(&fieldSizesEnabled, 0)
+	}
+	MaxMessageSize.setWindow(window)
+}
+
+// ObserveFieldSizes observes the sizes of the fields of a parsed message,
+// when the field size metrics are enabled.
+func ObserveFieldSizes(t Types, raw *model.RawMessage, m *model.SyslogMessage) {
+	if atomic.LoadInt32(&fieldSizesEnabled) == 0 {
+		return
+	}
+	protocol := Types2Names[t]
+	listener := raw.UnixSocketPath
+	if len(listener) == 0 {
+		listener = strconv.FormatInt(int64(raw.LocalPort), 10)
+	}
+	FieldSizeHistogram.WithLabelValues(protocol, listener, "message").Observe(float64(len(m.Message)))
+	FieldSizeHistogram.WithLabelValues(protocol, listener, "structured_data").Observe(float64(sdSize(m)))
+	FieldSizeHistogram.WithLabelValues(protocol, listener, "hostname").Observe(float64(len(m.HostName)))
+	MaxMessageSize.observe(protocol, listener, uint64(len(m.Message)), time.Now())
+}
+
+// sdSize is the total size of the SD-IDs, and of the names and values of the
+// SD params.
+func sdSize(m *model.SyslogMessage) (size int) {
+	for domain, kv := range m.Properties.Map {
+		size += len(domain)
+		if kv == nil {
+			continue
+		}
+		for k, v := range kv.Map {
+			size += len(k) + len(v)
+		}
+	}
+	return size
+}
+
+type maxSizeKey struct {
+	protocol string
+	listener string
+}
+
+// maxSizeWindows are the sliding windows of the listeners, for a window
+// duration.
+type maxSizeWindows struct {
+	window  time.Duration
+	windows sync.Map // maxSizeKey -> *slidingMax
+}
+
+// maxSizeCollector collects the largest message sizes. The parse workers
+// observe the sizes without any lock.
+type maxSizeCollector struct {
+	desc  *prometheus.Desc
+	state atomic.Value // *maxSizeWindows
+}
+
+func newMaxSizeCollector() *maxSizeCollector {
+	c := &maxSizeCollector{
+		desc: prometheus.NewDesc(
+			"skw_max_message_size_bytes",
+			"length of the largest parsed message in the sliding window",
+			[]string{"protocol", "listener"},
+			nil,
+		),
+	}
+	c.state.Store(&maxSizeWindows{})
+	return c
+}
+
+func (c *maxSizeCollector) windows() *maxSizeWindows {
+	return c.state.Load().(*maxSizeWindows)
+}
+
+func (c *maxSizeCollector) setWindow(window time.Duration) {
+	if window != c.windows().window {
+		c.state.Store(&maxSizeWindows{window: window})
+	}
+}
+
+func (c *maxSizeCollector) window(protocol, listener string) *slidingMax {
+	state := c.windows()
+	key := maxSizeKey{protocol: protocol, listener: listener}
+	w, ok := state.windows.Load(key)
+	if !ok {
+		w, _ = state.windows.LoadOrStore(key, newSlidingMax(state.window))
+	}
+	return w.(*slidingMax)
+}
+
+func (c *maxSizeCollector) observe(protocol, listener string, size uint64, now time.Time) {
+	c.window(protocol, listener).observe(size, now)
+}
+
+func (c *maxSizeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *maxSizeCollector) Collect(ch chan<- prometheus.Metric) {
+	now := time.Now()
+	c.windows().windows.Range(func(k, w interface{}) bool {
+		key := k.(maxSizeKey)
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(w.(*slidingMax).max(now)), key.protocol, key.listener)
+		return true
+	})
+}
+
+const (
+	slidingMaxSlots = 6
+	// a slot holds the number of its period in the low bits, and the
+	// maximum in the high bits, so that both are updated at once
+	slotPeriodBits = 24
+	slotPeriodMask = 1<<slotPeriodBits - 1
+	slotMaxValue   = 1<<(64-slotPeriodBits) - 1
+)
+
+// slidingMax is the maximum of the values observed in a sliding window. The
+// window is divided in slots, each one being the maximum of a period of the
+// clock: the slots of the periods that left the window are ignored, and
+// reused by the new periods.
+type slidingMax struct {
+	slot  int64
+	slots [slidingMaxSlots]uint64
+}
+
+func newSlidingMax(window time.Duration) *slidingMax {
+	slot := window / slidingMaxSlots
+	if slot <= 0 {
+		slot = time.Second
+	}
+	return &slidingMax{slot: int64(slot)}
+}
+
+func (w *slidingMax) period(now time.Time) uint64 {
+	return uint64(now.UnixNano()/w.slot) & slotPeriodMask
+}
+
+func (w *slidingMax) observe(v uint64, now time.Time) {
+	if v > slotMaxValue {
+		v = slotMaxValue
+	}
+	p := w.period(now)
+	slot := &w.slots[p%slidingMaxSlots]
+	for {
+		cur := atomic.LoadUint64(slot)
+		if cur&slotPeriodMask == p && cur>>slotPeriodBits >= v {
+			return
+		}
+		if atomic.CompareAndSwapUint64(slot, cur, v<<slotPeriodBits|p) {
+			return
+		}
+	}
+}
+
+func (w *slidingMax) max(now time.Time) (m uint64) {
+	p := w.period(now)
+	for i := range w.slots {
+		cur := atomic.LoadUint64(&w.slots[i])
+		// the age of the slot, in periods
+		if age := (p - cur&slotPeriodMask) & slotPeriodMask; age >= slidingMaxSlots {
+			continue
+		}
+		if v := cur >> slotPeriodBits; v > m {
+			m = v
+		}
+	}
+	return m
+}
@@ -0,0 +1,85 @@
+package base
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stephane-martin/skewer/model"
+)
+
+func TestSlidingMax(t *testing.T) {
+	now := time.Now()
+	w := newSlidingMax(time.Minute)
+	w.observe(100, now)
+	w.observe(50, now.Add(15*time.Second))
+	if m := w.max(now.Add(30 * time.Second)); m != 100 {
+		t.Fatalf("expected 100 in the window, got %d", m)
+	}
+	// the spike leaves the window after a minute
+	if m := w.max(now.Add(65 * time.Second)); m != 50 {
+		t.Fatalf("expected 50 once the spike left the window, got %d", m)
+	}
+	if m := w.max(now.Add(10 * time.Minute)); m != 0 {
+		t.Fatalf("expected an empty window, got %d", m)
+	}
+	w.observe(10, now.Add(10*time.Minute))
+	if m := w.max(now.Add(10 * time.Minute)); m != 10 {
+		t.Fatalf("expected 10 after a long pause, got %d", m)
+	}
+}
+
+func TestObserveFieldSizes(t *testing.T) {
+	m := model.Factory()
+	m.Message = "hello world"
+	m.HostName = "host"
+	m.SetProperty("origin", "ip", "10.0.0.1")
+	raw := &model.RawMessage{LocalPort: 6514}
+
+	ConfigureFieldSizes(false, time.Minute)
+	ObserveFieldSizes(TCP, raw, m)
+	sampleCount := func(field string) uint64 {
+		metric := &dto.Metric{}
+		_ = FieldSizeHistogram.WithLabelValues("skewer-tcp", "6514", field).(prometheus.Histogram).Write(metric)
+		return metric.GetHistogram().GetSampleCount()
+	}
+	if sampleCount("message") != 0 {
+		t.Fatal("the field sizes should not be observed when disabled")
+	}
+
+	ConfigureFieldSizes(true, time.Minute)
+	defer ConfigureFieldSizes(false, 0)
+	ObserveFieldSizes(TCP, raw, m)
+	for _, field := range []string{"message", "structured_data", "hostname"} {
+		if sampleCount(field) != 1 {
+			t.Errorf("the %s size should have been observed", field)
+		}
+	}
+	if s := sdSize(m); s != len("origin")+len("ip")+len("10.0.0.1") {
+		t.Errorf("unexpected SD size: %d", s)
+	}
+	if max := MaxMessageSize.window("skewer-tcp", "6514").max(time.Now()); max != uint64(len(m.Message)) {
+		t.Errorf("unexpected largest message: %d", max)
+	}
+}
+
+func TestSlidingMaxConcurrent(t *testing.T) {
+	w := newSlidingMax(time.Minute)
+	now := time.Now()
+	var wg sync.WaitGroup
+	for i := 1; i <= 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				w.observe(uint64(i*1000+j), now)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if m := w.max(now); m != 8999 {
+		t.Fatalf("expected 8999, got %d", m)
+	}
+}
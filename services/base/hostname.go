@@ -0,0 +1,69 @@
+package base
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+)
+
+// the hostname regexps are validated when the configuration is loaded, so
+// they are compiled once and shared by all the listeners
+var hostnameRegexps sync.Map
+
+func hostnameRegexp(expr string) *regexp.Regexp {
+	if r, ok := hostnameRegexps.Load(expr); ok {
+		return r.(*regexp.Regexp)
+	}
+	r, err := regexp.Compile(expr)
+	if err != nil {
+		return nil
+	}
+	hostnameRegexps.Store(expr, r)
+	return r
+}
+
+// NormalizeHostname applies the hostname normalization options of the
+// listener to a freshly parsed message, so that the normalized hostname is
+// used for the filtering and routing. Messages without a hostname are left
+// untouched.
+func NormalizeHostname(m *model.SyslogMessage, c *conf.DecoderBaseConfig) {
+	if m == nil || c == nil || len(m.HostName) == 0 || m.HostName == "-" {
+		return
+	}
+	original := m.HostName
+	hostname := original
+	if c.HostnameStripTrailingDot {
+		hostname = strings.TrimRight(hostname, ".")
+	}
+	if c.HostnameLowercase {
+		hostname = strings.ToLower(hostname)
+	}
+	if len(c.HostnameStripSuffixes) > 0 {
+		for _, suffix := range strings.Split(c.HostnameStripSuffixes, ",") {
+			if len(hostname) > len(suffix) && strings.EqualFold(hostname[len(hostname)-len(suffix):], suffix) {
+				hostname = hostname[:len(hostname)-len(suffix)]
+				break
+			}
+		}
+	}
+	if c.HostnameShort {
+		if i := strings.IndexByte(hostname, '.'); i > 0 {
+			hostname = hostname[:i]
+		}
+	}
+	if len(c.HostnameRegex) > 0 {
+		if r := hostnameRegexp(c.HostnameRegex); r != nil {
+			hostname = r.ReplaceAllString(hostname, c.HostnameReplace)
+		}
+	}
+	if hostname == original {
+		return
+	}
+	if c.HostnameKeepOriginal {
+		m.SetProperty("skewer", "original_hostname", original)
+	}
+	m.HostName = hostname
+}
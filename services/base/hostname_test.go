@@ -0,0 +1,69 @@
+package base
+
+import (
+	"testing"
+
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+)
+
+func TestNormalizeHostname(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   conf.DecoderBaseConfig
+		hostname string
+		expected string
+	}{
+		{"none", conf.DecoderBaseConfig{}, "Host.Example.COM.", "Host.Example.COM."},
+		{"trailing dot", conf.DecoderBaseConfig{HostnameStripTrailingDot: true}, "host.example.com.", "host.example.com"},
+		{"lowercase", conf.DecoderBaseConfig{HostnameLowercase: true}, "Host.Example.COM", "host.example.com"},
+		{"suffix", conf.DecoderBaseConfig{HostnameStripSuffixes: ".corp,.example.com"}, "host.Example.com", "host"},
+		{"suffix mismatch", conf.DecoderBaseConfig{HostnameStripSuffixes: ".example.com"}, "host.example.org", "host.example.org"},
+		{"suffix only", conf.DecoderBaseConfig{HostnameStripSuffixes: ".example.com"}, ".example.com", ".example.com"},
+		{"short", conf.DecoderBaseConfig{HostnameShort: true}, "host.example.com", "host"},
+		{"short without domain", conf.DecoderBaseConfig{HostnameShort: true}, "host", "host"},
+		{"regex", conf.DecoderBaseConfig{HostnameRegex: `^web-(\d+)$`, HostnameReplace: "web$1"}, "web-01", "web01"},
+		{
+			"combined",
+			conf.DecoderBaseConfig{HostnameStripTrailingDot: true, HostnameLowercase: true, HostnameShort: true},
+			"DB1.Example.COM.",
+			"db1",
+		},
+		{"empty", conf.DecoderBaseConfig{HostnameLowercase: true, HostnameRegex: "^$", HostnameReplace: "unknown"}, "", ""},
+		{"nil value", conf.DecoderBaseConfig{HostnameLowercase: true, HostnameShort: true}, "-", "-"},
+	}
+	for _, test := range tests {
+		m := model.Factory()
+		m.HostName = test.hostname
+		NormalizeHostname(m, &test.config)
+		if m.HostName != test.expected {
+			t.Errorf("%s: expected '%s', got '%s'", test.name, test.expected, m.HostName)
+		}
+		if len(m.GetProperty("skewer", "original_hostname")) > 0 {
+			t.Errorf("%s: the original hostname should not be kept", test.name)
+		}
+	}
+}
+
+func TestNormalizeHostnameKeepOriginal(t *testing.T) {
+	c := conf.DecoderBaseConfig{HostnameLowercase: true, HostnameKeepOriginal: true}
+	m := model.Factory()
+	m.HostName = "HOST"
+	NormalizeHostname(m, &c)
+	if m.HostName != "host" {
+		t.Fatalf("expected 'host', got '%s'", m.HostName)
+	}
+	if m.GetProperty("skewer", "original_hostname") != "HOST" {
+		t.Fatalf("the original hostname was not kept: '%s'", m.GetProperty("skewer", "original_hostname"))
+	}
+
+	// nothing is kept when the hostname is already normalized
+	m = model.Factory()
+	m.HostName = "host"
+	NormalizeHostname(m, &c)
+	if len(m.GetProperty("skewer", "original_hostname")) > 0 {
+		t.Fatal("the original hostname should only be kept when it was modified")
+	}
+
+	NormalizeHostname(nil, &c)
+}
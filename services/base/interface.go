@@ -2,10 +2,14 @@ package base
 
 import (
 	"strconv"
+	"sync"
+	"time"
 
 	dto "github.com/prometheus/client_model/go"
 	"github.com/stephane-martin/skewer/conf"
 	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+	"github.com/stephane-martin/skewer/utils/recenterrors"
 )
 
 type Provider interface {
@@ -18,14 +22,171 @@ type Provider interface {
 	SetConf(c conf.BaseConfig)
 }
 
+// Pausable is implemented by the providers whose listeners can stop reading
+// new messages while keeping their sockets open.
+type Pausable interface {
+	Pause(listener string) error
+	Resume(listener string) error
+}
+
+// Drainable is implemented by the providers that can ask the clients of a
+// listener to reconnect, e.g. before a restart.
+type Drainable interface {
+	Drain(listener string) error
+}
+
+// Seekable is implemented by the providers whose consumers can be moved to
+// another position of their input stream at runtime.
+type Seekable interface {
+	Seek(req SeekRequest) error
+}
+
+// TxnInspectable is implemented by the RELP providers, whose transactions
+// in progress can be inspected.
+type TxnInspectable interface {
+	Transactions() []RelpTransactions
+}
+
+// Seek positions.
+const (
+	SeekBeginning = "beginning"
+	SeekEnd       = "end"
+	SeekOffset    = "offset"
+	SeekTimestamp = "timestamp"
+)
+
+// SeekRequest describes where a Kafka source consumer should resume.
+type SeekRequest struct {
+	// GroupID selects the consumer group. Empty means every group that
+	// consumes Topic.
+	GroupID string `json:"group_id,omitempty"`
+	Topic   string `json:"topic"`
+	// Partitions are the partitions to seek. Empty means all the partitions
+	// of Topic that are assigned to the local consumer.
+	Partitions []int32 `json:"partitions,omitempty"`
+	// Position is one of SeekBeginning, SeekEnd, SeekOffset or SeekTimestamp.
+	Position  string    `json:"position"`
+	Offset    int64     `json:"offset,omitempty"`
+	Timestamp time.Time `json:"timestamp,omitempty"`
+}
+
+// Validate checks that the request is complete.
+func (r SeekRequest) Validate() error {
+	if len(r.Topic) == 0 {
+		return eerrors.New("Seek request without a topic")
+	}
+	switch r.Position {
+	case SeekBeginning, SeekEnd:
+	case SeekOffset:
+		if r.Offset < 0 {
+			return eerrors.Errorf("Seek request with a negative offset: %d", r.Offset)
+		}
+	case SeekTimestamp:
+		if r.Timestamp.IsZero() {
+			return eerrors.New("Seek request without a timestamp")
+		}
+	default:
+		return eerrors.Errorf("Unknown seek position: '%s'", r.Position)
+	}
+	return nil
+}
+
+// ProfileCPU is the kind of the CPU profiles. The other kinds are the names
+// of the runtime/pprof profiles.
+const ProfileCPU = "cpu"
+
+// MaxProfileSeconds bounds the duration of a CPU profile.
+const MaxProfileSeconds = 300
+
+// ProfileRequest asks a plugin for a profile of its process.
+type ProfileRequest struct {
+	Kind string `json:"kind"`
+	// Seconds is the duration of a CPU profile.
+	Seconds int `json:"seconds,omitempty"`
+}
+
+// Validate checks that the request is complete.
+func (r ProfileRequest) Validate() error {
+	if len(r.Kind) == 0 {
+		return eerrors.New("Profile request without a kind")
+	}
+	if r.Kind == ProfileCPU && (r.Seconds <= 0 || r.Seconds > MaxProfileSeconds) {
+		return eerrors.Errorf("The CPU profile duration must be between 1 and %d seconds", MaxProfileSeconds)
+	}
+	return nil
+}
+
+// ProfileResponse is the answer of a plugin to a ProfileRequest.
+type ProfileResponse struct {
+	Profile []byte `json:"profile,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// RelpTransactions is a snapshot of the transactions of a RELP connection
+// that have not been answered yet, to debug the clients that do not get
+// their ACKs.
+type RelpTransactions struct {
+	ConnID string `json:"conn_id"`
+	Client string `json:"client"`
+	// NextToCommit is the transaction whose answer must be sent first, or -1.
+	NextToCommit int32 `json:"next_to_commit"`
+	// Received are the transactions that wait for their turn after
+	// NextToCommit, in order.
+	Received []int32 `json:"received"`
+	// Succeeded and Failed are the transactions whose answer is known, but
+	// not sent until the previous transactions are answered.
+	Succeeded []int32       `json:"succeeded"`
+	Failed    []RelpFailure `json:"failed"`
+	// Unanswered is the number of received transactions without an answer
+	// sent to the client.
+	Unanswered int32 `json:"unanswered"`
+}
+
+// RelpFailure is a failed RELP transaction.
+type RelpFailure struct {
+	Txnr   int32  `json:"txnr"`
+	Reason string `json:"reason"`
+}
+
 func CountIncomingMessage(t Types, client string, port int, path string) {
 	IncomingMsgsCounter.WithLabelValues(Types2Names[t], client, strconv.FormatInt(int64(port), 10), path).Inc()
 }
 
+var clientLabelsMu sync.Mutex
+var clientLabelsByType = map[Types]*clientLabels{}
+
+// ObserveMessageSize records the size of a raw received message. Only the
+// top clients by volume get their own client label, the others are
+// aggregated under OtherClients.
+func ObserveMessageSize(t Types, client string, size int) {
+	protocol := Types2Names[t]
+	clientLabelsMu.Lock()
+	labels, ok := clientLabelsByType[t]
+	if !ok {
+		labels = newClientLabels(MaxClientLabels, func(evicted string) {
+			MessageSizeHistogram.DeleteLabelValues(protocol, evicted)
+			ClientMessagesCounter.DeleteLabelValues(protocol, evicted)
+		})
+		clientLabelsByType[t] = labels
+	}
+	clientLabelsMu.Unlock()
+	labels.observe(client, size, func(label string) {
+		MessageSizeHistogram.WithLabelValues(protocol, label).Observe(float64(size))
+		ClientMessagesCounter.WithLabelValues(protocol, label).Inc()
+	})
+}
+
 func CountClientConnection(t Types, client string, port int, path string) {
 	ClientConnectionCounter.WithLabelValues(Types2Names[t], client, strconv.FormatInt(int64(port), 10), path).Inc()
 }
 
-func CountParsingError(t Types, client string, parserName string) {
+// CountParsingError counts a parsing error, and records it in the recent
+// errors.
+func CountParsingError(t Types, client string, parserName string, err error) {
 	ParsingErrorCounter.WithLabelValues(Types2Names[t], client, parserName).Inc()
+	recenterrors.Add(Types2Names[t], recenterrors.Parse, err)
+}
+
+func ObserveParseDuration(t Types, format string, start time.Time) {
+	ParseDurationHistogram.WithLabelValues(Types2Names[t], format).Observe(time.Since(start).Seconds())
 }
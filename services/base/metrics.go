@@ -4,17 +4,37 @@ import (
 	"sync"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stephane-martin/skewer/decoders"
+	"github.com/stephane-martin/skewer/utils/ordering"
 )
 
 var Registry *prometheus.Registry
 var Once sync.Once
 
-var IncomingMsgsCounter *prometheus.CounterVec
-var ClientConnectionCounter *prometheus.CounterVec
-var ParsingErrorCounter *prometheus.CounterVec
+var IncomingMsgsCounter *ExpiringCounterVec
+var ClientConnectionCounter *ExpiringCounterVec
+var ParsingErrorCounter *ExpiringCounterVec
+var ClockSkewHistogram *prometheus.HistogramVec
+var ParseDurationHistogram *prometheus.HistogramVec
+var ParseQueueDepthGauge *prometheus.GaugeVec
+var ParseWorkersGauge *prometheus.GaugeVec
+var ParseWorkersBusyGauge *prometheus.GaugeVec
+var TLSCertReloadCounter *prometheus.CounterVec
+var TLSCertExpiryGauge *prometheus.GaugeVec
+var TLSHandshakeFailureCounter *prometheus.CounterVec
+var TLSRevocationCheckCounter *prometheus.CounterVec
+var ListenerPausedGauge *prometheus.GaugeVec
+var ListenerBindStateGauge *prometheus.GaugeVec
+var ConnectionLimitCounter *prometheus.CounterVec
+var AcceptThrottledGauge prometheus.Gauge
+var BackpressureActiveGauge *prometheus.GaugeVec
+var GoroutinesGauge prometheus.Gauge
+var HeapMemoryGauge prometheus.Gauge
+var MessageSizeHistogram *prometheus.HistogramVec
+var ClientMessagesCounter *prometheus.CounterVec
 
 func InitRegistry() {
-	IncomingMsgsCounter = prometheus.NewCounterVec(
+	IncomingMsgsCounter = NewExpiringCounterVec(
 		prometheus.CounterOpts{
 			Name: "skw_incoming_messages_total",
 			Help: "total number of messages that were received",
@@ -22,7 +42,7 @@ func InitRegistry() {
 		[]string{"provider", "client", "port", "path"},
 	)
 
-	ClientConnectionCounter = prometheus.NewCounterVec(
+	ClientConnectionCounter = NewExpiringCounterVec(
 		prometheus.CounterOpts{
 			Name: "skw_client_connections_total",
 			Help: "total number of client connections",
@@ -30,7 +50,7 @@ func InitRegistry() {
 		[]string{"provider", "client", "port", "path"},
 	)
 
-	ParsingErrorCounter = prometheus.NewCounterVec(
+	ParsingErrorCounter = NewExpiringCounterVec(
 		prometheus.CounterOpts{
 			Name: "skw_parsing_errors_total",
 			Help: "total number of times there was a parsing error",
@@ -38,10 +58,182 @@ func InitRegistry() {
 		[]string{"provider", "client", "parsername"},
 	)
 
+	ClockSkewHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "skw_clock_skew_seconds",
+			Help:    "difference between the reported timestamp and the receive time of messages",
+			Buckets: []float64{-86400, -3600, -300, -60, -10, -1, 0, 1, 10, 60, 300, 3600, 86400},
+		},
+		[]string{"provider"},
+	)
+
+	ParseDurationHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "skw_parse_duration_seconds",
+			Help: "time spent parsing one raw message",
+			// 1µs to ~65ms
+			Buckets: prometheus.ExponentialBuckets(0.000001, 4, 9),
+		},
+		[]string{"protocol", "format"},
+	)
+
+	ParseQueueDepthGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "skw_parse_queue_depth",
+			Help: "number of raw messages waiting to be parsed",
+		},
+		[]string{"provider"},
+	)
+
+	ParseWorkersGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "skw_parse_workers",
+			Help: "number of parse workers",
+		},
+		[]string{"provider"},
+	)
+
+	ParseWorkersBusyGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "skw_parse_workers_busy",
+			Help: "number of parse workers that are currently parsing a message",
+		},
+		[]string{"provider"},
+	)
+
+	TLSCertReloadCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "skw_tls_cert_reloads_total",
+			Help: "number of times the certificate of a TLS listener was reloaded from disk",
+		},
+		[]string{"provider", "cert_file", "status"},
+	)
+
+	TLSCertExpiryGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "skw_tls_cert_expiry_timestamp_seconds",
+			Help: "expiry time of the certificate currently served by a TLS listener",
+		},
+		[]string{"provider", "cert_file"},
+	)
+
+	TLSHandshakeFailureCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "skw_tls_handshake_failures_total",
+			Help: "number of TLS connections closed before the end of the handshake (busy: no handshake slot, timeout, or error)",
+		},
+		[]string{"provider", "reason"},
+	)
+
+	TLSRevocationCheckCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "skw_tls_revocation_checks_total",
+			Help: "number of client certificates checked against the CRLs of a TLS listener (good, revoked, or unknown, and whether the client was rejected)",
+		},
+		[]string{"provider", "status", "rejected"},
+	)
+
+	ListenerPausedGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "skw_listener_paused",
+			Help: "1 if the listener is paused and does not read new messages, 0 otherwise",
+		},
+		[]string{"provider", "listener"},
+	)
+
+	ListenerBindStateGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "skw_listener_bind_state",
+			Help: "1 for the current bind state of a listener (bound, retrying or failed), 0 for the other states",
+		},
+		[]string{"provider", "listener", "state"},
+	)
+
+	ConnectionLimitCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "skw_connection_limit_total",
+			Help: "number of new connections over the max_connections cap of a listener (evict: the least recently active connection was closed to admit it, refuse: it was closed)",
+		},
+		[]string{"provider", "listener", "action"},
+	)
+
+	AcceptThrottledGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "skw_accept_throttled",
+			Help: "1 if the stream listeners don't accept new connections because of the memory pressure, 0 otherwise",
+		},
+	)
+
+	BackpressureActiveGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "skw_backpressure_active",
+			Help: "1 if the listener does not read its connections because the queue of the messages to parse is above its high watermark, 0 otherwise",
+		},
+		[]string{"provider", "listener"},
+	)
+
+	GoroutinesGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "skw_goroutines",
+			Help: "number of goroutines, as sampled by the accept throttle",
+		},
+	)
+
+	HeapMemoryGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "skw_heap_memory_bytes",
+			Help: "heap memory in use, as sampled by the accept throttle",
+		},
+	)
+
+	MessageSizeHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "skw_message_size_bytes",
+			Help: "size of the raw received messages, for the top clients by volume",
+			// 16B to 256KiB
+			Buckets: prometheus.ExponentialBuckets(16, 4, 8),
+		},
+		[]string{"protocol", "client"},
+	)
+
+	ClientMessagesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "skw_client_messages_total",
+			Help: "number of received messages, for the top clients by volume",
+		},
+		[]string{"protocol", "client"},
+	)
+
 	Registry = prometheus.NewRegistry()
 	Registry.MustRegister(
 		ClientConnectionCounter,
 		IncomingMsgsCounter,
 		ParsingErrorCounter,
+		ClockSkewHistogram,
+		ParseDurationHistogram,
+		ParseQueueDepthGauge,
+		ParseWorkersGauge,
+		ParseWorkersBusyGauge,
+		TLSCertReloadCounter,
+		TLSCertExpiryGauge,
+		TLSHandshakeFailureCounter,
+		TLSRevocationCheckCounter,
+		ListenerPausedGauge,
+		ListenerBindStateGauge,
+		ConnectionLimitCounter,
+		AcceptThrottledGauge,
+		BackpressureActiveGauge,
+		GoroutinesGauge,
+		HeapMemoryGauge,
+		MessageSizeHistogram,
+		ClientMessagesCounter,
+		FieldSizeHistogram,
+		MaxMessageSize,
+		StoreRejectedCounter,
+		decoders.RFC5424RejectedCounter,
+		decoders.UnknownParserCounter,
+		decoders.ParserFallbackCounter,
+		decoders.QuarantinedCounter,
+		ordering.ReorderedCounter,
 	)
 }
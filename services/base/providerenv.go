@@ -11,6 +11,7 @@ import (
 type ProviderEnv struct {
 	Confined bool
 	Profile  bool
+	Testing  bool
 	Ring     kring.Ring
 	Reporter *Reporter
 	Binder   binder.Client
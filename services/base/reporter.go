@@ -6,12 +6,16 @@ import (
 	"io"
 	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/awnumar/memguard"
 	"github.com/inconshreveable/log15"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stephane-martin/skewer/model"
 	"github.com/stephane-martin/skewer/utils"
 	"github.com/stephane-martin/skewer/utils/eerrors"
+	"github.com/stephane-martin/skewer/utils/recenterrors"
 	"github.com/stephane-martin/skewer/utils/reservoir"
 	"github.com/stephane-martin/skewer/utils/waiter"
 )
@@ -23,6 +27,18 @@ var SYSLOG = []byte("syslog")
 var INFOS = []byte("infos")
 var SP = []byte(" ")
 
+// ErrStoreDown is returned when a message is stashed while the Store process
+// is restarted, and the Store is configured to refuse the messages meanwhile.
+var ErrStoreDown = eerrors.WithTypes(eerrors.New("the Store process is down"), "StoreDown")
+
+var StoreRejectedCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "skw_store_rejected_total",
+		Help: "number of messages refused because the Store process was down",
+	},
+	[]string{"provider"},
+)
+
 // Reporter is used by plugins to report new syslog messages to the controller.
 type Reporter struct {
 	name         string
@@ -31,7 +47,14 @@ type Reporter struct {
 	bufferedPipe *bufio.Writer
 	reserv       *reservoir.Reservoir
 	secret       *memguard.LockedBuffer
-	pipeWriter   *utils.EncryptWriter
+	pipeWriter   *utils.FrameWriter
+	// acks are the callbacks of the messages that wait for the outcome
+	// reported by the Store
+	acksMu sync.Mutex
+	acks   map[utils.MyULID]model.AckFunc
+	// storeDown is 1 when the controller reports that the Store process is
+	// down, and that the messages should be refused
+	storeDown int32
 }
 
 // NewReporter creates a reporter.
@@ -41,6 +64,7 @@ func NewReporter(name string, l log15.Logger, pipe *os.File) *Reporter {
 		logger: l,
 		pipe:   pipe,
 		reserv: reservoir.NewReservoir(5000),
+		acks:   make(map[utils.MyULID]model.AckFunc),
 	}
 	rep.bufferedPipe = bufio.NewWriterSize(pipe, 32768)
 	return &rep
@@ -52,7 +76,7 @@ func (s *Reporter) Start() {
 
 func (s *Reporter) SetSecret(secret *memguard.LockedBuffer) {
 	s.secret = secret
-	s.pipeWriter = utils.NewEncryptWriter(s.bufferedPipe, s.secret)
+	s.pipeWriter = utils.NewFrameWriter(s.bufferedPipe, s.secret)
 }
 
 func (s *Reporter) pushqueue() {
@@ -80,6 +104,7 @@ func (s *Reporter) pushqueue() {
 			_, err := io.WriteString(s.pipeWriter, v)
 			if err != nil {
 				s.logger.Crit("Unexpected error when writing messages to the plugin pipe", "error", err)
+				recenterrors.Add(s.name, recenterrors.Fatal, err)
 				return
 			}
 		}
@@ -91,18 +116,46 @@ func (s *Reporter) pushqueue() {
 
 		if err != nil {
 			s.logger.Crit("Unexpected error when flushing the plugin pipe", "error", err)
+			recenterrors.Add(s.name, recenterrors.Fatal, err)
 			return
 		}
 	}
 }
 
-// Stop stops the reporter.
+// Stop stops the reporter. The messages that wait for their outcome are
+// reported as lost.
 func (s *Reporter) Stop() {
 	s.reserv.Dispose()
+	s.acksMu.Lock()
+	acks := s.acks
+	s.acks = make(map[utils.MyULID]model.AckFunc)
+	s.acksMu.Unlock()
+	for uid, ack := range acks {
+		ack(uid, false)
+	}
+}
+
+// SetStoreDown tells the reporter whether the Store process is down. While
+// it is down, Stash refuses the messages with ErrStoreDown, so that the
+// sources that can tell their clients report the failure.
+func (s *Reporter) SetStoreDown(down bool) {
+	if down {
+		atomic.StoreInt32(&s.storeDown, 1)
+	} else {
+		atomic.StoreInt32(&s.storeDown, 0)
+	}
 }
 
 // Stash reports one syslog message to the controller.
 func (s *Reporter) Stash(m *model.FullMessage) error {
+	if atomic.LoadInt32(&s.storeDown) == 1 {
+		StoreRejectedCounter.WithLabelValues(s.name).Inc()
+		return ErrStoreDown
+	}
+	if m.TimeReceivedNum == 0 {
+		// the network services stamp the reception time themselves
+		m.TimeReceivedNum = time.Now().UnixNano()
+	}
 	err := s.reserv.AddMessage(m)
 	if err != nil {
 		return eerrors.Wrapf(err, "Failed to marshal a message to be sent by plugin: %s", s.name)
@@ -110,6 +163,45 @@ func (s *Reporter) Stash(m *model.FullMessage) error {
 	return nil
 }
 
+// StashWithAck reports one syslog message to the controller, like Stash.
+// ack is called when the Store reports the outcome of the message (see Ack),
+// or when the reporter is stopped.
+func (s *Reporter) StashWithAck(m *model.FullMessage, ack model.AckFunc) error {
+	uid := m.Uid
+	s.acksMu.Lock()
+	s.acks[uid] = ack
+	s.acksMu.Unlock()
+	err := s.Stash(m)
+	if err != nil {
+		s.Forget(uid)
+	}
+	return err
+}
+
+// Ack calls the callbacks of the messages whose outcome has been reported by
+// the Store.
+func (s *Reporter) Ack(acks []model.Ack) {
+	for _, a := range acks {
+		s.acksMu.Lock()
+		ack, ok := s.acks[a.Uid]
+		delete(s.acks, a.Uid)
+		s.acksMu.Unlock()
+		if ok {
+			ack(a.Uid, a.OK)
+		}
+	}
+}
+
+// Forget drops the callbacks of messages whose outcome is not awaited
+// anymore.
+func (s *Reporter) Forget(uids ...utils.MyULID) {
+	s.acksMu.Lock()
+	for _, uid := range uids {
+		delete(s.acks, uid)
+	}
+	s.acksMu.Unlock()
+}
+
 // Report reports information about the actual listening ports to the controller.
 func (s *Reporter) Report(infos []model.ListenerInfo) error {
 	b, err := json.Marshal(infos)
@@ -0,0 +1,93 @@
+package base
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils"
+)
+
+func TestReporterAcks(t *testing.T) {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _, _ = io.Copy(ioutil.Discard, r) }()
+	reporter := NewReporter("relp", logger, w)
+	reporter.SetSecret(nil)
+	reporter.Start()
+
+	outcomes := make(map[utils.MyULID][]bool)
+	stash := func() utils.MyULID {
+		m := model.FullFactory()
+		m.Uid = utils.NewUid()
+		m.Fields.Message = "hello"
+		uid := m.Uid
+		err := reporter.StashWithAck(m, func(uid utils.MyULID, ok bool) {
+			outcomes[uid] = append(outcomes[uid], ok)
+		})
+		model.FullFree(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return uid
+	}
+
+	delivered, rejected, forgotten, lost := stash(), stash(), stash(), stash()
+	reporter.Ack([]model.Ack{{Uid: delivered, OK: true}, {Uid: rejected, OK: false}})
+	reporter.Forget(forgotten)
+	// the acknowledgments of unknown messages are ignored
+	reporter.Ack([]model.Ack{{Uid: delivered, OK: false}, {Uid: forgotten, OK: true}, {Uid: utils.NewUid(), OK: true}})
+	reporter.Stop()
+
+	expected := map[utils.MyULID][]bool{
+		delivered: {true},
+		rejected:  {false},
+		lost:      {false},
+	}
+	if len(outcomes) != len(expected) {
+		t.Fatalf("unexpected outcomes: %v", outcomes)
+	}
+	for uid, e := range expected {
+		if len(outcomes[uid]) != 1 || outcomes[uid][0] != e[0] {
+			t.Fatalf("unexpected outcome of %s: %v", uid, outcomes[uid])
+		}
+	}
+}
+
+func TestReporterStoreDown(t *testing.T) {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _, _ = io.Copy(ioutil.Discard, r) }()
+	reporter := NewReporter("tcp", logger, w)
+	reporter.SetSecret(nil)
+	reporter.Start()
+	defer reporter.Stop()
+
+	stash := func() error {
+		m := model.FullFactory()
+		defer model.FullFree(m)
+		m.Uid = utils.NewUid()
+		m.Fields.Message = "hello"
+		return reporter.Stash(m)
+	}
+
+	reporter.SetStoreDown(true)
+	if err := stash(); err != ErrStoreDown {
+		t.Fatalf("the message should be refused while the Store is down: %v", err)
+	}
+	reporter.SetStoreDown(false)
+	if err := stash(); err != nil {
+		t.Fatalf("the message should be accepted after the restart: %v", err)
+	}
+}
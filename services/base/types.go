@@ -22,6 +22,10 @@ const (
 	Filesystem
 	HTTPServer
 	MacOS
+	Synthetic
+	FIFO
+	Heartbeat
+	Ingest
 )
 
 var Names2Types = map[string]Types{
@@ -38,6 +42,10 @@ var Names2Types = map[string]Types{
 	"skewer-files":       Filesystem,
 	"skewer-httpserver":  HTTPServer,
 	"skewer-macos":       MacOS,
+	"skewer-synthetic":   Synthetic,
+	"skewer-fifo":        FIFO,
+	"skewer-heartbeat":   Heartbeat,
+	"skewer-ingest":      Ingest,
 }
 
 var ErrNotFound = eerrors.New("not found")
@@ -116,6 +124,10 @@ func init() {
 		{Types2Names[Filesystem], Logger},
 		{Types2Names[HTTPServer], Logger},
 		{Types2Names[MacOS], Logger},
+		{Types2Names[Synthetic], Logger},
+		{Types2Names[FIFO], Logger},
+		{Types2Names[Heartbeat], Logger},
+		{Types2Names[Ingest], Logger},
 	}
 
 	HandlesMap = map[ServiceHandle]uintptr{}
@@ -24,6 +24,7 @@ import (
 	"github.com/stephane-martin/skewer/sys/namespaces"
 	"github.com/stephane-martin/skewer/utils"
 	"github.com/stephane-martin/skewer/utils/eerrors"
+	"github.com/stephane-martin/skewer/utils/recenterrors"
 )
 
 var confStdoutMu sync.Mutex
@@ -236,6 +237,14 @@ func (c *ConfigurationService) Start(r kring.Ring) error {
 				return
 			case "reloaded":
 				c.logger.Debug("Configuration child has been reloaded")
+			case "reloaderror":
+				// the new configuration is invalid: the current one stays in use
+				err := eerrors.New("unknown error")
+				if len(parts) == 2 {
+					err = eerrors.New(parts[1])
+				}
+				c.logger.Error("Invalid configuration, keeping the current one", "error", err)
+				recenterrors.Add("configuration", recenterrors.NonFatal, err)
 			default:
 				err := eerrors.Errorf("Unknown command received from configuration child: %s", command)
 				c.logger.Warn(err.Error())
@@ -381,6 +390,10 @@ func LaunchConfProvider(ctx context.Context, r kring.Ring, confined bool, logger
 				}
 			} else {
 				logger.Warn("Error reloading configuration", "error", err)
+				err = WConf([]byte("reloaderror"), []byte(err.Error()))
+				if err != nil {
+					return err
+				}
 			}
 
 		case "confdir":
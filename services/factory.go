@@ -18,25 +18,68 @@ import (
 func Configure(t base.Types, c conf.BaseConfig) (res conf.BaseConfig) {
 	res = conf.NewBaseConf()
 	res.Main.EncryptIPC = c.Main.EncryptIPC
+	res.Main.MaxPipeMessageSize = c.Main.MaxPipeMessageSize
+	res.Main.MetricsExpiry = c.Main.MetricsExpiry
+	res.Main.MetricsReset = c.Main.MetricsReset
+	res.Main.MetricsMaxClients = c.Main.MetricsMaxClients
+	res.Main.BindRetryPeriod = c.Main.BindRetryPeriod
+	res.Metrics.Pprof = c.Metrics.Pprof
 	switch t {
 	case base.TCP:
 		res.TCPSource = c.TCPSource
+		res.Main.FieldSizeMetrics = c.Main.FieldSizeMetrics
+		res.Main.FieldSizeWindow = c.Main.FieldSizeWindow
+		res.Main.ParseWorkers = c.Main.ParseWorkers
+		res.Main.OrderingCheck = c.Main.OrderingCheck
+		res.Main.AcceptMaxGoroutines = c.Main.AcceptMaxGoroutines
+		res.Main.AcceptMaxMemory = c.Main.AcceptMaxMemory
+		res.Main.AcceptCheckInterval = c.Main.AcceptCheckInterval
 		res.Parsers = c.Parsers
 		res.Main.InputQueueSize = c.Main.InputQueueSize
 		res.Main.MaxInputMessageSize = c.Main.MaxInputMessageSize
 	case base.UDP:
 		res.UDPSource = c.UDPSource
+		res.Main.FieldSizeMetrics = c.Main.FieldSizeMetrics
+		res.Main.FieldSizeWindow = c.Main.FieldSizeWindow
+		res.Main.ParseWorkers = c.Main.ParseWorkers
 		res.Parsers = c.Parsers
 		res.Main.InputQueueSize = c.Main.InputQueueSize
 	case base.RELP:
 		res.RELPSource = c.RELPSource
+		res.Main.RELPBatchSize = c.Main.RELPBatchSize
+		res.Main.FieldSizeMetrics = c.Main.FieldSizeMetrics
+		res.Main.FieldSizeWindow = c.Main.FieldSizeWindow
+		res.Main.ParseWorkers = c.Main.ParseWorkers
+		res.Main.OrderingCheck = c.Main.OrderingCheck
+		res.Main.AcceptMaxGoroutines = c.Main.AcceptMaxGoroutines
+		res.Main.AcceptMaxMemory = c.Main.AcceptMaxMemory
+		res.Main.AcceptCheckInterval = c.Main.AcceptCheckInterval
+		res.Main.LogRateLimitBurst = c.Main.LogRateLimitBurst
+		res.Main.LogRateLimitWindow = c.Main.LogRateLimitWindow
 		res.Parsers = c.Parsers
 		res.Main.InputQueueSize = c.Main.InputQueueSize
 	case base.DirectRELP:
 		res.DirectRELPSource = c.DirectRELPSource
+		res.Main.RELPBatchSize = c.Main.RELPBatchSize
+		res.Main.FieldSizeMetrics = c.Main.FieldSizeMetrics
+		res.Main.FieldSizeWindow = c.Main.FieldSizeWindow
+		res.Main.ParseWorkers = c.Main.ParseWorkers
+		res.Main.OrderingCheck = c.Main.OrderingCheck
+		res.Main.AcceptMaxGoroutines = c.Main.AcceptMaxGoroutines
+		res.Main.AcceptMaxMemory = c.Main.AcceptMaxMemory
+		res.Main.AcceptCheckInterval = c.Main.AcceptCheckInterval
+		res.Main.MaxMessageAge = c.Main.MaxMessageAge
+		res.Main.LogRateLimitBurst = c.Main.LogRateLimitBurst
+		res.Main.LogRateLimitWindow = c.Main.LogRateLimitWindow
+		res.Main.JSMaxStackDepth = c.Main.JSMaxStackDepth
+		res.Main.JSMaxDuration = c.Main.JSMaxDuration
+		res.Main.JSMaxMemory = c.Main.JSMaxMemory
+		res.Main.ParsedQueuePolicy = c.Main.ParsedQueuePolicy
+		res.Main.ParsedQueueTimeout = c.Main.ParsedQueueTimeout
 		res.Parsers = c.Parsers
 		res.Main.InputQueueSize = c.Main.InputQueueSize
 		res.KafkaDest = c.KafkaDest
+		res.Transforms = c.Transforms
 	case base.KafkaSource:
 		res.KafkaSource = c.KafkaSource
 		res.Parsers = c.Parsers
@@ -52,6 +95,7 @@ func Configure(t base.Types, c conf.BaseConfig) (res conf.BaseConfig) {
 	case base.Filesystem:
 		res.FSSource = c.FSSource
 		res.Parsers = c.Parsers
+		res.Main.MaxInputMessageSize = c.Main.MaxInputMessageSize
 	case base.HTTPServer:
 		res.HTTPServerSource = c.HTTPServerSource
 		res.Parsers = c.Parsers
@@ -59,12 +103,26 @@ func Configure(t base.Types, c conf.BaseConfig) (res conf.BaseConfig) {
 		res.Main.MaxInputMessageSize = c.Main.MaxInputMessageSize
 	case base.MacOS:
 		res.MacOS = c.MacOS
+	case base.Synthetic:
+		res.Synthetic = c.Synthetic
+		res.Parsers = c.Parsers
+	case base.Heartbeat:
+		res.Heartbeat = c.Heartbeat
+	case base.FIFO:
+		res.FIFOSource = c.FIFOSource
+		res.Parsers = c.Parsers
+		res.Main.MaxInputMessageSize = c.Main.MaxInputMessageSize
+	case base.Ingest:
+		res.IngestSource = c.IngestSource
+		res.Parsers = c.Parsers
+		res.Main.MaxInputMessageSize = c.Main.MaxInputMessageSize
 	}
 	return res
 }
 
 func ConfigureAndStartService(s base.Provider, c conf.BaseConfig) ([]model.ListenerInfo, error) {
 	t := s.Type()
+	base.ConfigureMetrics(c.Main.MetricsExpiry, c.Main.MetricsReset, c.Main.MetricsMaxClients)
 
 	if t == base.Store {
 		infos, err := s.(*storeServiceImpl).SetConfAndRestart(c)
@@ -94,6 +152,12 @@ func SetProfile(profile bool) func(e *base.ProviderEnv) {
 	}
 }
 
+func SetTesting(testing bool) func(e *base.ProviderEnv) {
+	return func(e *base.ProviderEnv) {
+		e.Testing = testing
+	}
+}
+
 func SetRing(ring kring.Ring) func(e *base.ProviderEnv) {
 	return func(e *base.ProviderEnv) {
 		e.Ring = ring
@@ -154,6 +218,18 @@ func ProviderFactory(t base.Types, env *base.ProviderEnv) (base.Provider, error)
 		provider, err = network.NewHTTPService(env)
 	case base.MacOS:
 		provider, err = macos.NewMacOSLogsService(env)
+	case base.Synthetic:
+		// load testing only
+		if !env.Testing {
+			return nil, eerrors.New("The synthetic source is only available in testing mode")
+		}
+		provider, err = NewSyntheticService(env)
+	case base.FIFO:
+		provider, err = NewFIFOService(env)
+	case base.Heartbeat:
+		provider, err = NewHeartbeatService(env)
+	case base.Ingest:
+		provider, err = NewIngestService(env)
 	default:
 		return nil, eerrors.Errorf("Unknown provider type: %d", t)
 	}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/services/base"
+)
+
+// TestConfigureMain checks that the plugins get the main options that they
+// read.
+func TestConfigureMain(t *testing.T) {
+	c := conf.NewBaseConf()
+	c.Main.OrderingCheck = true
+	c.Main.AcceptMaxGoroutines = 1000
+	c.Main.AcceptMaxMemory = 1 << 30
+	c.Main.AcceptCheckInterval = 5 * time.Second
+
+	for _, typ := range []base.Types{base.TCP, base.RELP, base.DirectRELP, base.Store} {
+		name := base.Types2Names[typ]
+		res := Configure(typ, c)
+		if !res.Main.OrderingCheck {
+			t.Errorf("%s: ordering_check was not propagated", name)
+		}
+		if res.Main.AcceptMaxGoroutines != c.Main.AcceptMaxGoroutines || res.Main.AcceptMaxMemory != c.Main.AcceptMaxMemory || res.Main.AcceptCheckInterval != c.Main.AcceptCheckInterval {
+			t.Errorf("%s: the accept throttling options were not propagated", name)
+		}
+	}
+
+	c.Main.FieldSizeMetrics = true
+	c.Main.FieldSizeWindow = 10 * time.Minute
+	for _, typ := range []base.Types{base.TCP, base.UDP, base.RELP, base.DirectRELP} {
+		res := Configure(typ, c)
+		if !res.Main.FieldSizeMetrics || res.Main.FieldSizeWindow != c.Main.FieldSizeWindow {
+			t.Errorf("%s: the field size options were not propagated", base.Types2Names[typ])
+		}
+	}
+
+	c.Metrics.Pprof = true
+	for typ, name := range base.Types2Names {
+		if res := Configure(typ, c); !res.Metrics.Pprof {
+			t.Errorf("%s: pprof was not propagated", name)
+		}
+	}
+
+	c.Main.RELPBatchSize = 64
+	for _, typ := range []base.Types{base.RELP, base.DirectRELP} {
+		if res := Configure(typ, c); res.Main.RELPBatchSize != 64 {
+			t.Errorf("%s: relp_batch_size was not propagated", base.Types2Names[typ])
+		}
+	}
+
+	c.Main.MaxInputMessageSize = 12345
+	for _, typ := range []base.Types{base.Filesystem, base.HTTPServer, base.FIFO, base.Ingest} {
+		if res := Configure(typ, c); res.Main.MaxInputMessageSize != 12345 {
+			t.Errorf("%s: max_input_message_size was not propagated", base.Types2Names[typ])
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/inconshreveable/log15"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/decoders"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/services/base"
+	"github.com/stephane-martin/skewer/utils"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+var fifoReadBytesCounter *prometheus.CounterVec
+var fifoReopenCounter *prometheus.CounterVec
+
+func initFIFORegistry() {
+	base.Once.Do(func() {
+		base.InitRegistry()
+		fifoReadBytesCounter = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "skw_fifo_read_bytes_total",
+				Help: "total number of bytes read from the named pipes",
+			},
+			[]string{"path"},
+		)
+		fifoReopenCounter = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "skw_fifo_reopens_total",
+				Help: "number of times a named pipe was reopened after its writer closed it",
+			},
+			[]string{"path"},
+		)
+		base.Registry.MustRegister(fifoReadBytesCounter, fifoReopenCounter)
+	})
+}
+
+// FIFOService reads syslog messages from named pipes.
+type FIFOService struct {
+	stasher        *base.Reporter
+	logger         log15.Logger
+	wgroup         sync.WaitGroup
+	confs          []conf.FIFOSourceConfig
+	parserEnv      *decoders.ParsersEnv
+	maxMessageSize int
+	confined       bool
+	stop           context.CancelFunc
+	fatalErrorChan chan struct{}
+	fatalOnce      *sync.Once
+}
+
+func NewFIFOService(env *base.ProviderEnv) (base.Provider, error) {
+	initFIFORegistry()
+	s := FIFOService{
+		stasher:  env.Reporter,
+		logger:   env.Logger.New("class", "fifo"),
+		confined: env.Confined,
+	}
+	return &s, nil
+}
+
+func (s *FIFOService) Type() base.Types {
+	return base.FIFO
+}
+
+func (s *FIFOService) Gather() ([]*dto.MetricFamily, error) {
+	return base.Registry.Gather()
+}
+
+func (s *FIFOService) FatalError() chan struct{} {
+	return s.fatalErrorChan
+}
+
+func (s *FIFOService) dofatal() {
+	s.fatalOnce.Do(func() { close(s.fatalErrorChan) })
+}
+
+func (s *FIFOService) SetConf(c conf.BaseConfig) {
+	s.confs = c.FIFOSource
+	s.parserEnv = decoders.NewParsersEnv(c.Parsers, s.logger)
+	s.maxMessageSize = c.Main.MaxInputMessageSize
+}
+
+func (s *FIFOService) Start() (infos []model.ListenerInfo, err error) {
+	var ctx context.Context
+	infos = []model.ListenerInfo{}
+	ctx, s.stop = context.WithCancel(context.Background())
+	s.fatalErrorChan = make(chan struct{})
+	s.fatalOnce = &sync.Once{}
+
+	var nbFIFOs int
+	for i := range s.confs {
+		config := s.confs[i]
+		path := config.Path
+		if s.confined {
+			path = filepath.Join("/tmp", "polldirs", path)
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			s.logger.Warn("Can't access the named pipe", "path", config.Path, "error", err)
+			continue
+		}
+		if fi.Mode()&os.ModeNamedPipe == 0 {
+			s.logger.Warn("Not a named pipe", "path", config.Path)
+			continue
+		}
+		nbFIFOs++
+		s.wgroup.Add(1)
+		go func() {
+			defer s.wgroup.Done()
+			err := s.readFIFO(ctx, &config, path)
+			if err != nil {
+				s.logger.Error("Stopped reading the named pipe", "path", config.Path, "error", err)
+				s.dofatal()
+			}
+		}()
+	}
+
+	if nbFIFOs == 0 {
+		s.stop()
+		return infos, fmt.Errorf("fifo does not read any named pipe")
+	}
+	return infos, nil
+}
+
+func (s *FIFOService) Stop() {
+	if s.stop != nil {
+		s.stop()
+	}
+	s.wgroup.Wait()
+}
+
+func (s *FIFOService) Shutdown() {
+	s.Stop()
+}
+
+// openFIFO opens the named pipe for reading. Opening a FIFO blocks until a
+// writer opens it too, so the open happens in a goroutine, that is released
+// by opening the FIFO for writing when ctx is canceled.
+func openFIFO(ctx context.Context, path string) (*os.File, error) {
+	type result struct {
+		f   *os.File
+		err error
+	}
+	opened := make(chan result, 1)
+	go func() {
+		f, err := os.OpenFile(path, os.O_RDONLY, 0)
+		opened <- result{f: f, err: err}
+	}()
+	select {
+	case r := <-opened:
+		return r.f, r.err
+	case <-ctx.Done():
+		w, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+		if err == nil {
+			_ = w.Close()
+		}
+		go func() {
+			r := <-opened
+			if r.f != nil {
+				_ = r.f.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// readFIFO reads the named pipe until ctx is canceled. When the writer closes
+// the FIFO, it is reopened to wait for the next writer.
+func (s *FIFOService) readFIFO(ctx context.Context, config *conf.FIFOSourceConfig, path string) error {
+	gen := utils.NewGenerator()
+	logger := s.logger.New("path", config.Path)
+	for {
+		f, err := openFIFO(ctx, path)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return eerrors.Wrap(err, "Error opening the named pipe")
+		}
+		logger.Debug("Named pipe has been opened by a writer")
+		err = s.readFrom(ctx, f, config, gen, logger)
+		_ = f.Close()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if eerrors.IsFatal(err) {
+			return err
+		}
+		if err != nil {
+			logger.Warn("Error reading the named pipe", "error", err)
+		}
+		fifoReopenCounter.WithLabelValues(config.Path).Inc()
+	}
+}
+
+type countingReader struct {
+	r       io.Reader
+	counter prometheus.Counter
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.counter.Add(float64(n))
+	return n, err
+}
+
+func (s *FIFOService) readFrom(ctx context.Context, f *os.File, config *conf.FIFOSourceConfig, gen *utils.Generator, logger log15.Logger) error {
+	// closing the file unblocks the pending read when ctx is canceled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = f.Close()
+		case <-done:
+		}
+	}()
+
+	scanner := bufio.NewScanner(&countingReader{r: f, counter: fifoReadBytesCounter.WithLabelValues(config.Path)})
+	scanner.Buffer(make([]byte, 0, 4096), s.maxMessageSize)
+	scanner.Split(fifoSplit(config.FrameDelimiter[0]))
+
+	for scanner.Scan() {
+		buf := scanner.Bytes()
+		if len(buf) == 0 {
+			continue
+		}
+		err := s.parseAndStash(buf, config, gen, logger)
+		if err != nil {
+			return err
+		}
+	}
+	err := scanner.Err()
+	if eerrors.HasFileClosed(err) {
+		return nil
+	}
+	return err
+}
+
+// fifoSplit splits the stream on the given delimiter. The last message is
+// kept when the writer closes the FIFO without a trailing delimiter.
+func fifoSplit(delim byte) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if i := bytes.IndexByte(data, delim); i >= 0 {
+			return i + 1, bytes.Trim(data[:i], " \r\n"), nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), bytes.Trim(data, " \r\n"), nil
+		}
+		return 0, nil, nil
+	}
+}
+
+func (s *FIFOService) parseAndStash(buf []byte, config *conf.FIFOSourceConfig, gen *utils.Generator, logger log15.Logger) error {
+	checksum := base.Checksum(&config.DecoderBaseConfig, buf)
+	syslogMsgs, err := s.parserEnv.Parse(&config.DecoderBaseConfig, buf)
+	if err != nil {
+		base.CountParsingError(base.FIFO, config.Path, config.Format, err)
+		logger.Warn("Error parsing FIFO message", "error", err)
+		return nil
+	}
+	for _, syslogMsg := range syslogMsgs {
+		if syslogMsg == nil {
+			continue
+		}
+		if !base.NormalizeTime(base.FIFO, syslogMsg, &config.DecoderBaseConfig) {
+			model.Free(syslogMsg)
+			continue
+		}
+		base.NormalizeHostname(syslogMsg, &config.DecoderBaseConfig)
+		full := model.FullFactoryFrom(syslogMsg)
+		full.Uid = gen.Uid()
+		full.ConfId = config.ConfID
+		full.SourceType = "fifo"
+		full.SourcePath = config.Path
+		base.SetChecksum(full, checksum)
+		err = s.stasher.Stash(full)
+		model.FullFree(full)
+		if err != nil {
+			if eerrors.IsFatal(err) {
+				return eerrors.Wrap(err, "Fatal error stashing FIFO message")
+			}
+			logger.Warn("Error stashing FIFO message", "error", err)
+			continue
+		}
+		base.CountIncomingMessage(base.FIFO, "", 0, config.Path)
+	}
+	return nil
+}
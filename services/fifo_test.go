@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/decoders"
+	"github.com/stephane-martin/skewer/services/base"
+)
+
+func TestFIFOSplit(t *testing.T) {
+	split := fifoSplit('\n')
+	tests := []struct {
+		data    string
+		atEOF   bool
+		advance int
+		token   string
+	}{
+		{"a\nb\n", false, 2, "a"},
+		{" a \r\nb", false, 5, "a"},
+		{"partial", false, 0, ""},
+		// the writer closed the FIFO without a trailing delimiter
+		{"last", true, 4, "last"},
+		{"", true, 0, ""},
+	}
+	for _, tt := range tests {
+		advance, token, err := split([]byte(tt.data), tt.atEOF)
+		if err != nil || advance != tt.advance || string(token) != tt.token {
+			t.Errorf("split(%q, %v) = %d, %q, %v", tt.data, tt.atEOF, advance, token, err)
+		}
+	}
+}
+
+func makeFIFO(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "skewer-fifo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "fifo")
+	if err := syscall.Mkfifo(path, 0600); err != nil {
+		_ = os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return path, func() { _ = os.RemoveAll(dir) }
+}
+
+func TestOpenFIFOCancel(t *testing.T) {
+	path, clean := makeFIFO(t)
+	defer clean()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		f, err := openFIFO(ctx, path)
+		if f != nil {
+			_ = f.Close()
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("the open should wait for a writer: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the open was not released by the cancellation")
+	}
+}
+
+func counterValue(t *testing.T, path string) float64 {
+	var m dto.Metric
+	if err := fifoReopenCounter.WithLabelValues(path).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestFIFOReopen(t *testing.T) {
+	path, clean := makeFIFO(t)
+	defer clean()
+	initFIFORegistry()
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _, _ = io.Copy(ioutil.Discard, r) }()
+	reporter := base.NewReporter("fifo", logger, w)
+	reporter.SetSecret(nil)
+	reporter.Start()
+	defer reporter.Stop()
+
+	s := &FIFOService{
+		stasher:        reporter,
+		logger:         logger,
+		parserEnv:      decoders.NewParsersEnv(nil, logger),
+		maxMessageSize: 65536,
+	}
+	config := conf.FIFOSourceConfig{Path: path, FrameDelimiter: "\n"}
+	config.Format = "rfc5424"
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.readFIFO(ctx, &config, path) }()
+
+	write := func(msg string) {
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = f.WriteString(msg)
+		_ = f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitReopens := func(expected float64) {
+		deadline := time.Now().Add(5 * time.Second)
+		for counterValue(t, path) < expected {
+			if time.Now().After(deadline) {
+				t.Fatalf("the named pipe was not reopened %v times", expected)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// each writer closes the FIFO: the next writer is waited for
+	write("<13>1 2019-01-01T00:00:00Z host app - - - first\n")
+	waitReopens(1)
+	write("<13>1 2019-01-01T00:00:00Z host app - - - second")
+	waitReopens(2)
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("the canceled read should not fail: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the read was not stopped by the cancellation")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"sync"
+	"time"
 
 	"github.com/gobwas/glob"
 	"github.com/inconshreveable/log15"
@@ -15,6 +16,7 @@ import (
 	"github.com/stephane-martin/gotail/tail"
 	"github.com/stephane-martin/skewer/conf"
 	"github.com/stephane-martin/skewer/decoders"
+	dbase "github.com/stephane-martin/skewer/decoders/base"
 	"github.com/stephane-martin/skewer/model"
 	"github.com/stephane-martin/skewer/services/base"
 	"github.com/stephane-martin/skewer/utils"
@@ -42,6 +44,7 @@ type FilePollingService struct {
 	registryOnce   sync.Once
 	nWatchedFiles  prometheus.GaugeFunc
 	nWatchedDirs   prometheus.GaugeFunc
+	maxMessageSize int
 }
 
 var fpool = &sync.Pool{
@@ -194,6 +197,7 @@ func flogg(logger log15.Logger, raw *model.RawFileMessage) log15.Logger {
 }
 
 func (s *FilePollingService) parseOne(raw *model.RawFileMessage, gen *utils.Generator) error {
+	checksum := base.Checksum(&raw.Decoder, raw.Line)
 	syslogMsgs, err := s.parserEnv.Parse(&raw.Decoder, raw.Line)
 	if err != nil {
 		return err
@@ -203,13 +207,27 @@ func (s *FilePollingService) parseOne(raw *model.RawFileMessage, gen *utils.Gene
 		if syslogMsg == nil {
 			continue
 		}
+		if !base.NormalizeTime(base.Filesystem, syslogMsg, &raw.Decoder) {
+			model.Free(syslogMsg)
+			continue
+		}
+		base.NormalizeHostname(syslogMsg, &raw.Decoder)
 		syslogMsg.SetProperty("skewer", "filename", raw.Filename)
+		if k8s := decoders.KubernetesMetadata(raw.Filename); k8s != nil {
+			for k, v := range k8s {
+				syslogMsg.SetProperty("kubernetes", k, v)
+			}
+			if syslogMsg.AppName == "" {
+				syslogMsg.AppName = k8s["container"]
+			}
+		}
 		full := model.FullFactoryFrom(syslogMsg)
 		full.SourceType = "filepoll"
 		full.SourcePath = raw.Directory
 		full.ClientAddr = raw.Hostname
 		full.Uid = gen.Uid()
 		full.ConfId = raw.ConfID
+		base.SetChecksum(full, checksum)
 		err := s.stasher.Stash(full)
 
 		model.FullFree(full)
@@ -233,7 +251,7 @@ func (s *FilePollingService) parse(rawq chan *model.RawFileMessage) error {
 		}
 		err := s.parseOne(raw, gen)
 		if err != nil {
-			base.CountParsingError(base.Filesystem, raw.Hostname, raw.Decoder.Format)
+			base.CountParsingError(base.Filesystem, raw.Hostname, raw.Decoder.Format, err)
 			flogg(s.logger, raw).Warn(err.Error())
 		}
 		freeFRaw(raw)
@@ -258,29 +276,61 @@ func fetchErrors(logger log15.Logger, errors chan error) {
 	}
 }
 
+// criPartialMaxAge is how long the partial CRI lines wait for their end. The
+// end of a line never comes when its file is rotated or removed.
+const criPartialMaxAge = 30 * time.Second
+
 func (s *FilePollingService) fetchLines(lines chan tail.FileLineID, rawq chan *model.RawFileMessage) {
 	defer close(rawq)
 	hostname, err := os.Hostname()
 	if err != nil {
 		hostname = "unknown"
 	}
+	joiner := decoders.NewCRIJoiner(s.maxMessageSize, criPartialMaxAge)
+	ticker := time.NewTicker(criPartialMaxAge / 2)
+	defer ticker.Stop()
 
-	for l := range lines {
-		config := s.confs[s.confsMap[l.Uid]]
+	push := func(uid ulid.ULID, filename string, line []byte) {
+		config := s.confs[s.confsMap[uid]]
 		raw := getFRaw()
 		raw.Hostname = hostname
 		raw.Decoder = config.DecoderBaseConfig
 		raw.Directory = config.BaseDirectory
 		raw.Glob = config.Glob
-		raw.Filename = l.Filename
+		raw.Filename = filename
 		if s.confined && len(raw.Filename) >= 13 {
 			raw.Filename = raw.Filename[13:] // /tmp/polldirs/...
 		}
-		raw.Line = l.Line
+		raw.Line = line
 		raw.ConfID = config.ConfID
 		base.CountIncomingMessage(base.Filesystem, hostname, 0, config.BaseDirectory)
 		rawq <- raw
 	}
+
+	for {
+		select {
+		case l, ok := <-lines:
+			if !ok {
+				return
+			}
+			config := s.confs[s.confsMap[l.Uid]]
+			line := l.Line
+			if dbase.ParseFormat(config.Format) == dbase.CRI {
+				// the partial lines must be joined in order, before the
+				// parsers run concurrently
+				var full bool
+				line, full = joiner.Join(l.Filename, l.Uid, line)
+				if !full {
+					continue
+				}
+			}
+			push(l.Uid, l.Filename, line)
+		case now := <-ticker.C:
+			for _, p := range joiner.Expire(now) {
+				push(p.Source.(ulid.ULID), p.Filename, p.Line)
+			}
+		}
+	}
 }
 
 func (s *FilePollingService) Stop() {
@@ -302,6 +352,7 @@ func (s *FilePollingService) SetConf(c conf.BaseConfig) {
 	}
 	s.confsMap = make(map[ulid.ULID]utils.MyULID)
 	s.parserEnv = decoders.NewParsersEnv(c.Parsers, s.logger)
+	s.maxMessageSize = c.Main.MaxInputMessageSize
 }
 
 func MakeFilter(globstring string) (tail.FilterFunc, error) {
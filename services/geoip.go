@@ -0,0 +1,164 @@
+package services
+
+import (
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/inconshreveable/log15"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils/mmdb"
+)
+
+// GeoIPEnricher annotates the messages with the country and the ASN of the
+// client IP, using local MaxMind databases.
+type GeoIPEnricher struct {
+	mu       sync.RWMutex
+	conf     conf.GeoIPConfig
+	country  *mmdb.Reader
+	asn      *mmdb.Reader
+	logger   log15.Logger
+	lookups  *prometheus.CounterVec
+	registry *prometheus.Registry
+}
+
+func NewGeoIPEnricher(logger log15.Logger) *GeoIPEnricher {
+	e := GeoIPEnricher{
+		logger:   logger.New("class", "geoip"),
+		registry: prometheus.NewRegistry(),
+		lookups: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "skw_geoip_lookups_total",
+				Help: "number of GeoIP lookups, by database and status",
+			},
+			[]string{"db", "status"},
+		),
+	}
+	e.registry.MustRegister(e.lookups)
+	return &e
+}
+
+func (e *GeoIPEnricher) open(name, filename string) *mmdb.Reader {
+	if len(filename) == 0 {
+		return nil
+	}
+	r, err := mmdb.Open(filename)
+	if err != nil {
+		e.logger.Warn("Can't open GeoIP database, enrichment is skipped", "db", name, "filename", filename, "error", err)
+		return nil
+	}
+	e.logger.Info("GeoIP database loaded", "db", name, "filename", filename)
+	return r
+}
+
+// SetConf sets the databases locations and (re)loads them.
+func (e *GeoIPEnricher) SetConf(c conf.GeoIPConfig) {
+	e.mu.Lock()
+	e.conf = c
+	e.mu.Unlock()
+	e.Reload()
+}
+
+// Reload reopens the databases files, so that they can be updated without
+// restarting skewer.
+func (e *GeoIPEnricher) Reload() {
+	e.mu.RLock()
+	c := e.conf
+	e.mu.RUnlock()
+	country := e.open("country", c.CountryDB)
+	asn := e.open("asn", c.ASNDB)
+
+	e.mu.Lock()
+	oldCountry, oldASN := e.country, e.asn
+	e.country, e.asn = country, asn
+	e.mu.Unlock()
+
+	// no lookup can use the old readers anymore
+	if oldCountry != nil {
+		_ = oldCountry.Close()
+	}
+	if oldASN != nil {
+		_ = oldASN.Close()
+	}
+}
+
+// Close releases the databases.
+func (e *GeoIPEnricher) Close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.country != nil {
+		_ = e.country.Close()
+		e.country = nil
+	}
+	if e.asn != nil {
+		_ = e.asn.Close()
+		e.asn = nil
+	}
+}
+
+func (e *GeoIPEnricher) lookup(db string, r *mmdb.Reader, ip net.IP, path ...string) interface{} {
+	if r == nil {
+		e.lookups.WithLabelValues(db, "nodb").Inc()
+		return nil
+	}
+	v, err := r.Lookup(ip, path...)
+	if err != nil {
+		e.lookups.WithLabelValues(db, "error").Inc()
+		return nil
+	}
+	if v == nil {
+		e.lookups.WithLabelValues(db, "notfound").Inc()
+		return nil
+	}
+	e.lookups.WithLabelValues(db, "found").Inc()
+	return v
+}
+
+// Enrich sets the "geoip" properties of the message from its client address.
+func (e *GeoIPEnricher) Enrich(m *model.FullMessage) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if len(e.conf.CountryDB) == 0 && len(e.conf.ASNDB) == 0 {
+		// enrichment is disabled
+		return
+	}
+	if m == nil || m.Fields == nil || len(m.ClientAddr) == 0 {
+		return
+	}
+	ip := net.ParseIP(m.ClientAddr)
+	if ip == nil {
+		host, _, err := net.SplitHostPort(m.ClientAddr)
+		if err == nil {
+			ip = net.ParseIP(host)
+		}
+	}
+	if ip == nil {
+		e.lookups.WithLabelValues("all", "noip").Inc()
+		return
+	}
+	if len(e.conf.CountryDB) > 0 {
+		if iso, ok := e.lookup("country", e.country, ip, "country", "iso_code").(string); ok {
+			m.Fields.SetProperty("geoip", "country", iso)
+		}
+	}
+	if len(e.conf.ASNDB) > 0 {
+		if number, ok := e.lookup("asn", e.asn, ip, "autonomous_system_number").(uint64); ok {
+			m.Fields.SetProperty("geoip", "asn", strconv.FormatUint(number, 10))
+			if e.asn != nil {
+				if org, err := e.asn.Lookup(ip, "autonomous_system_organization"); err == nil {
+					if org, ok := org.(string); ok {
+						m.Fields.SetProperty("geoip", "as_org", org)
+					}
+				}
+			}
+		}
+	}
+}
+
+// Gather returns the GeoIP metrics.
+func (e *GeoIPEnricher) Gather() ([]*dto.MetricFamily, error) {
+	return e.registry.Gather()
+}
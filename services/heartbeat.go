@@ -0,0 +1,212 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/decoders"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/services/base"
+	"github.com/stephane-martin/skewer/utils"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// heartbeatPri is the PRI of the heartbeat messages: facility syslog,
+// severity info.
+const heartbeatPri = 46
+
+// heartbeatTimeFormat is the RFC5424 TIMESTAMP format, with the maximum
+// allowed precision.
+const heartbeatTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+var heartbeatSentCounter prometheus.Counter
+var heartbeatSequenceGauge prometheus.Gauge
+
+func initHeartbeatRegistry() {
+	base.Once.Do(func() {
+		base.InitRegistry()
+		heartbeatSentCounter = prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "skw_heartbeat_sent_total",
+				Help: "total number of heartbeat messages that were injected in the pipeline",
+			},
+		)
+		heartbeatSequenceGauge = prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "skw_heartbeat_sequence",
+				Help: "sequence number of the last heartbeat message",
+			},
+		)
+		base.Registry.MustRegister(heartbeatSentCounter, heartbeatSequenceGauge)
+	})
+}
+
+// heartbeatDecoder parses the heartbeat messages, so that they go through
+// the same parsing path as the received messages.
+var heartbeatDecoder = conf.DecoderBaseConfig{Format: "rfc5424", Charset: "utf8"}
+
+// HeartbeatService periodically injects a heartbeat message in the
+// pipeline. The heartbeats are not counted in the incoming messages metrics.
+type HeartbeatService struct {
+	stasher        *base.Reporter
+	logger         log15.Logger
+	wgroup         sync.WaitGroup
+	Conf           conf.HeartbeatConfig
+	parserEnv      *decoders.ParsersEnv
+	stop           context.CancelFunc
+	fatalErrorChan chan struct{}
+	fatalOnce      *sync.Once
+	// seq is the last sequence number. It is kept across restarts, so that
+	// a configuration reload does not look like a gap downstream.
+	seq int64
+}
+
+func NewHeartbeatService(env *base.ProviderEnv) (base.Provider, error) {
+	initHeartbeatRegistry()
+	s := HeartbeatService{
+		stasher: env.Reporter,
+		logger:  env.Logger.New("class", "heartbeat"),
+	}
+	return &s, nil
+}
+
+func (s *HeartbeatService) Type() base.Types {
+	return base.Heartbeat
+}
+
+func (s *HeartbeatService) Gather() ([]*dto.MetricFamily, error) {
+	return base.Registry.Gather()
+}
+
+func (s *HeartbeatService) FatalError() chan struct{} {
+	return s.fatalErrorChan
+}
+
+func (s *HeartbeatService) dofatal() {
+	s.fatalOnce.Do(func() { close(s.fatalErrorChan) })
+}
+
+func (s *HeartbeatService) SetConf(c conf.BaseConfig) {
+	s.Conf = c.Heartbeat
+	s.parserEnv = decoders.NewParsersEnv(nil, s.logger)
+}
+
+func (s *HeartbeatService) Start() (infos []model.ListenerInfo, err error) {
+	var ctx context.Context
+	infos = []model.ListenerInfo{}
+	ctx, s.stop = context.WithCancel(context.Background())
+	s.fatalErrorChan = make(chan struct{})
+	s.fatalOnce = &sync.Once{}
+
+	s.logger.Info(
+		"Starting the heartbeat source",
+		"interval", s.Conf.Interval,
+		"appname", s.Conf.AppName,
+		"msgid", s.Conf.MsgID,
+	)
+
+	s.wgroup.Add(1)
+	go func() {
+		defer s.wgroup.Done()
+		err := s.beat(ctx)
+		if err != nil {
+			s.logger.Error("Heartbeat source has stopped", "error", err)
+			s.dofatal()
+		}
+	}()
+	return infos, nil
+}
+
+func (s *HeartbeatService) Stop() {
+	if s.stop != nil {
+		s.stop()
+	}
+	s.wgroup.Wait()
+}
+
+func (s *HeartbeatService) Shutdown() {
+	s.Stop()
+}
+
+func (s *HeartbeatService) beat(ctx context.Context) error {
+	gen := utils.NewGenerator()
+	hostname := s.Conf.Hostname
+	if len(hostname) == 0 {
+		hostname, _ = os.Hostname()
+	}
+	ticker := time.NewTicker(s.Conf.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.seq = nextHeartbeatSeq(s.seq)
+		err := s.stash(makeHeartbeat(s.Conf, hostname, s.seq, time.Now()), gen)
+		if err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// nextHeartbeatSeq returns the sequence number that follows seq. As
+// specified for the sequenceId parameter by RFC5424, it wraps to 1 after
+// 2147483647.
+func nextHeartbeatSeq(seq int64) int64 {
+	if seq >= math.MaxInt32 {
+		return 1
+	}
+	return seq + 1
+}
+
+// makeHeartbeat builds the raw RFC5424 heartbeat message. The generation
+// time is given by the TIMESTAMP, and with nanoseconds in the message.
+func makeHeartbeat(c conf.HeartbeatConfig, hostname string, seq int64, now time.Time) []byte {
+	if len(hostname) == 0 {
+		hostname = "-"
+	}
+	return []byte(fmt.Sprintf(
+		`<%d>1 %s %s %s - %s [meta sequenceId="%d"] heartbeat seq=%d generated=%d`,
+		heartbeatPri, now.UTC().Format(heartbeatTimeFormat), hostname, c.AppName, c.MsgID, seq, seq, now.UnixNano(),
+	))
+}
+
+func (s *HeartbeatService) stash(raw []byte, gen *utils.Generator) error {
+	syslogMsgs, err := s.parserEnv.Parse(&heartbeatDecoder, raw)
+	if err != nil {
+		// should not happen, as the heartbeat format is fixed
+		s.logger.Warn("Error parsing heartbeat message", "error", err)
+		return nil
+	}
+	for _, syslogMsg := range syslogMsgs {
+		if syslogMsg == nil {
+			continue
+		}
+		full := model.FullFactoryFrom(syslogMsg)
+		full.Uid = gen.Uid()
+		full.ConfId = s.Conf.ConfID
+		full.SourceType = "heartbeat"
+		err = s.stasher.Stash(full)
+		model.FullFree(full)
+		if err != nil {
+			if eerrors.IsFatal(err) {
+				return eerrors.Wrap(err, "Fatal error stashing heartbeat message")
+			}
+			s.logger.Warn("Error stashing heartbeat message", "error", err)
+			continue
+		}
+		heartbeatSentCounter.Inc()
+		heartbeatSequenceGauge.Set(float64(s.seq))
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/decoders"
+)
+
+func TestHeartbeatMessage(t *testing.T) {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	c := conf.HeartbeatConfig{AppName: "skewer-heartbeat", MsgID: "HEARTBEAT"}
+	now := time.Date(2026, 10, 15, 12, 30, 0, 123456789, time.UTC)
+	raw := makeHeartbeat(c, "host1", 42, now)
+
+	// the heartbeats must pass the strict RFC5424 validation
+	strict := heartbeatDecoder
+	strict.RFC5424Strict = true
+	strict.RFC5424RejectAction = "drop"
+	msgs, err := decoders.NewParsersEnv(nil, logger).Parse(&strict, raw)
+	if err != nil {
+		t.Fatalf("heartbeat is not valid RFC5424: %s: %q", err, raw)
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(msgs))
+	}
+	m := msgs[0]
+	if m.AppName != "skewer-heartbeat" || m.MsgId != "HEARTBEAT" || m.HostName != "host1" {
+		t.Fatalf("unexpected heartbeat header: %s %s %s", m.AppName, m.MsgId, m.HostName)
+	}
+	if m.GetProperty("meta", "sequenceId") != "42" {
+		t.Fatalf("unexpected sequence: %v", m.GetAllProperties())
+	}
+	if m.GetTimeReported().UnixNano() != now.Truncate(time.Microsecond).UnixNano() {
+		t.Fatalf("unexpected generation time: %s", m.GetTimeReported())
+	}
+}
+
+func TestHeartbeatSequenceWraps(t *testing.T) {
+	if nextHeartbeatSeq(0) != 1 || nextHeartbeatSeq(1) != 2 {
+		t.Fatal("the sequence should start at 1 and increase")
+	}
+	if nextHeartbeatSeq(math.MaxInt32) != 1 {
+		t.Fatal("the sequence should wrap to 1")
+	}
+}
@@ -0,0 +1,481 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/inconshreveable/log15"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/decoders"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/services/base"
+	"github.com/stephane-martin/skewer/utils"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+var ingestProgressGauge *prometheus.GaugeVec
+var ingestLinesCounter *prometheus.CounterVec
+var ingestOversizedCounter *prometheus.CounterVec
+
+func initIngestRegistry() {
+	base.Once.Do(func() {
+		base.InitRegistry()
+		ingestProgressGauge = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "skw_ingest_progress_ratio",
+				Help: "part of the (compressed) file that has been ingested, from 0 to 1",
+			},
+			[]string{"filename"},
+		)
+		ingestLinesCounter = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "skw_ingest_lines_total",
+				Help: "number of lines read from the ingested files",
+			},
+			[]string{"filename"},
+		)
+		ingestOversizedCounter = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "skw_ingest_oversized_lines_total",
+				Help: "number of lines skipped because they were longer than the maximum message size",
+			},
+			[]string{"filename"},
+		)
+		base.Registry.MustRegister(ingestProgressGauge, ingestLinesCounter, ingestOversizedCounter)
+	})
+}
+
+// IngestService reads archived log files once, from the beginning to the
+// end, and then marks them as done. Compressed files are decompressed on the
+// fly. The progress is checkpointed, so that an interrupted backfill resumes
+// where it stopped.
+type IngestService struct {
+	stasher        *base.Reporter
+	logger         log15.Logger
+	wgroup         sync.WaitGroup
+	confs          []conf.IngestSourceConfig
+	parserEnv      *decoders.ParsersEnv
+	maxMessageSize int
+	confined       bool
+	stop           context.CancelFunc
+	fatalErrorChan chan struct{}
+	fatalOnce      *sync.Once
+}
+
+func NewIngestService(env *base.ProviderEnv) (base.Provider, error) {
+	initIngestRegistry()
+	s := IngestService{
+		stasher:  env.Reporter,
+		logger:   env.Logger.New("class", "ingest"),
+		confined: env.Confined,
+	}
+	return &s, nil
+}
+
+func (s *IngestService) Type() base.Types {
+	return base.Ingest
+}
+
+func (s *IngestService) Gather() ([]*dto.MetricFamily, error) {
+	return base.Registry.Gather()
+}
+
+func (s *IngestService) FatalError() chan struct{} {
+	return s.fatalErrorChan
+}
+
+func (s *IngestService) dofatal() {
+	s.fatalOnce.Do(func() { close(s.fatalErrorChan) })
+}
+
+func (s *IngestService) SetConf(c conf.BaseConfig) {
+	s.confs = c.IngestSource
+	s.parserEnv = decoders.NewParsersEnv(c.Parsers, s.logger)
+	s.maxMessageSize = c.Main.MaxInputMessageSize
+}
+
+func (s *IngestService) Start() (infos []model.ListenerInfo, err error) {
+	var ctx context.Context
+	infos = []model.ListenerInfo{}
+	ctx, s.stop = context.WithCancel(context.Background())
+	s.fatalErrorChan = make(chan struct{})
+	s.fatalOnce = &sync.Once{}
+
+	var nbDirs int
+	for i := range s.confs {
+		config := s.confs[i]
+		dir := config.Directory
+		stateDir := config.StateDirectory
+		if s.confined {
+			dir = filepath.Join("/tmp", "polldirs", dir)
+			stateDir = filepath.Join("/tmp", "statedirs", stateDir)
+		}
+		files, err := listIngestFiles(dir, config.Glob)
+		if err != nil {
+			s.logger.Warn("Error listing the files to ingest", "directory", config.Directory, "error", err)
+			continue
+		}
+		nbDirs++
+		s.wgroup.Add(1)
+		go func() {
+			defer s.wgroup.Done()
+			err := s.ingestFiles(ctx, &config, dir, stateDir, files)
+			if err != nil {
+				s.logger.Error("Stopped ingesting files", "directory", config.Directory, "error", err)
+				s.dofatal()
+			}
+		}()
+	}
+
+	if nbDirs == 0 {
+		s.stop()
+		return infos, fmt.Errorf("ingest does not read any directory")
+	}
+	return infos, nil
+}
+
+func (s *IngestService) Stop() {
+	if s.stop != nil {
+		s.stop()
+	}
+	s.wgroup.Wait()
+}
+
+func (s *IngestService) Shutdown() {
+	s.Stop()
+}
+
+// listIngestFiles returns the regular files under dir whose path relative to
+// dir matches the glob, sorted by name.
+func listIngestFiles(dir string, globstring string) ([]string, error) {
+	filter, err := MakeFilter(globstring)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0)
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if filter(rel) {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func (s *IngestService) ingestFiles(ctx context.Context, config *conf.IngestSourceConfig, dir string, stateDir string, files []string) error {
+	gen := utils.NewGenerator()
+	for _, rel := range files {
+		if ctx.Err() != nil {
+			return nil
+		}
+		filename := filepath.Join(config.Directory, rel)
+		logger := s.logger.New("filename", filename)
+		err := s.ingestFile(ctx, config, filepath.Join(dir, rel), filename, stateDir, gen, logger)
+		if eerrors.IsFatal(err) {
+			return err
+		}
+		if err != nil {
+			// the file is not marked as done, so it will be retried at the
+			// next start
+			logger.Warn("Error ingesting file", "error", err)
+		}
+	}
+	s.logger.Info("All files have been ingested", "directory", config.Directory)
+	return nil
+}
+
+// ingestCheckpoint records how far a file has been ingested. Offset is the
+// number of decompressed bytes that have been processed: compressed streams
+// can't be seeked, so a resumed ingestion decompresses the file again and
+// skips the first Offset bytes.
+type ingestCheckpoint struct {
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+	ModTime  int64  `json:"mtime"`
+	Offset   int64  `json:"offset"`
+	Done     bool   `json:"done"`
+}
+
+func checkpointPath(stateDir string, filename string) string {
+	h := sha256.Sum256([]byte(filename))
+	return filepath.Join(stateDir, "ingest-"+hex.EncodeToString(h[:16])+".json")
+}
+
+// loadCheckpoint returns the checkpoint for the file. A new checkpoint is
+// returned when there is none yet, or when the file has changed since.
+func loadCheckpoint(stateDir string, filename string, info os.FileInfo) (ingestCheckpoint, error) {
+	fresh := ingestCheckpoint{
+		Filename: filename,
+		Size:     info.Size(),
+		ModTime:  info.ModTime().UnixNano(),
+	}
+	content, err := ioutil.ReadFile(checkpointPath(stateDir, filename))
+	if os.IsNotExist(err) {
+		return fresh, nil
+	}
+	if err != nil {
+		return fresh, err
+	}
+	var cp ingestCheckpoint
+	err = json.Unmarshal(content, &cp)
+	if err != nil {
+		return fresh, nil
+	}
+	if cp.Filename != fresh.Filename || cp.Size != fresh.Size || cp.ModTime != fresh.ModTime {
+		return fresh, nil
+	}
+	return cp, nil
+}
+
+// saveCheckpoint atomically writes the checkpoint in the state directory.
+func saveCheckpoint(stateDir string, cp ingestCheckpoint) error {
+	content, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	path := checkpointPath(stateDir, cp.Filename)
+	tmp := path + ".tmp"
+	err = ioutil.WriteFile(tmp, content, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// zstdMagic starts the zstd frames.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// ErrIngestZstd is returned for the zstd compressed files, that can't be
+// decompressed. They are not marked as done.
+var ErrIngestZstd = eerrors.New("zstd compressed files are not supported")
+
+// decompress detects the compression of the stream by its magic bytes, or
+// else by the file extension, and returns the decompressed stream.
+func decompress(r *bufio.Reader, filename string) (io.Reader, error) {
+	magic, _ := r.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return gzip.NewReader(r)
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		return bzip2.NewReader(r), nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		return nil, ErrIngestZstd
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".gz":
+		return gzip.NewReader(r)
+	case ".bz2":
+		return bzip2.NewReader(r), nil
+	case ".zst", ".zstd":
+		return nil, ErrIngestZstd
+	}
+	return r, nil
+}
+
+type ingestCountingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *ingestCountingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// scanLines calls f for each line of r, after skipping the first offset
+// bytes. f receives the offset just after the line. The lines longer than
+// maxSize are skipped, and reported to oversized.
+func scanLines(r io.Reader, offset int64, maxSize int, f func(line []byte, offset int64) error, oversized func()) error {
+	if offset > 0 {
+		_, err := io.CopyN(ioutil.Discard, r, offset)
+		if err != nil {
+			return eerrors.Wrap(err, "Error skipping the already ingested lines")
+		}
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), maxSize)
+	skipping := false
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if skipping {
+			// discard the rest of an oversized line, up to its end
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				offset += int64(len(data))
+				return len(data), nil, nil
+			}
+			skipping = false
+			offset += int64(i + 1)
+			return i + 1, nil, nil
+		}
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		if advance == 0 && token == nil && err == nil && len(data) >= maxSize {
+			// the line does not fit in the buffer
+			skipping = true
+			if oversized != nil {
+				oversized()
+			}
+			offset += int64(len(data))
+			return len(data), nil, nil
+		}
+		offset += int64(advance)
+		return advance, token, err
+	})
+	for scanner.Scan() {
+		err := f(scanner.Bytes(), offset)
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (s *IngestService) ingestFile(ctx context.Context, config *conf.IngestSourceConfig, path string, filename string, stateDir string, gen *utils.Generator, logger log15.Logger) error {
+	progress := ingestProgressGauge.WithLabelValues(filename)
+	lines := ingestLinesCounter.WithLabelValues(filename)
+	oversized := ingestOversizedCounter.WithLabelValues(filename)
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	cp, err := loadCheckpoint(stateDir, filename, info)
+	if err != nil {
+		return eerrors.Wrap(err, "Error reading the checkpoint")
+	}
+	if cp.Done {
+		progress.Set(1)
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	counting := &ingestCountingReader{r: f}
+	r, err := decompress(bufio.NewReader(counting), path)
+	if err != nil {
+		return err
+	}
+	if cp.Offset > 0 {
+		logger.Info("Resuming the ingestion of the file", "offset", cp.Offset)
+	} else {
+		logger.Info("Starting the ingestion of the file")
+	}
+
+	var n int
+	setProgress := func() {
+		if info.Size() > 0 {
+			progress.Set(float64(counting.n) / float64(info.Size()))
+		}
+	}
+	err = scanLines(r, cp.Offset, s.maxMessageSize, func(line []byte, offset int64) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		lines.Inc()
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			err := s.parseAndStash(line, config, filename, gen, logger)
+			if err != nil {
+				return err
+			}
+		}
+		cp.Offset = offset
+		n++
+		if n%config.CheckpointLines == 0 {
+			setProgress()
+			err := saveCheckpoint(stateDir, cp)
+			if err != nil {
+				logger.Warn("Error writing the checkpoint", "error", err)
+			}
+		}
+		return nil
+	}, func() {
+		oversized.Inc()
+		logger.Warn("Skipping a line longer than the maximum message size", "max_size", s.maxMessageSize)
+	})
+	if err == nil {
+		cp.Done = true
+		progress.Set(1)
+		logger.Info("File has been ingested")
+	} else {
+		setProgress()
+	}
+	cerr := saveCheckpoint(stateDir, cp)
+	if cerr != nil {
+		logger.Warn("Error writing the checkpoint", "error", cerr)
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+func (s *IngestService) parseAndStash(buf []byte, config *conf.IngestSourceConfig, filename string, gen *utils.Generator, logger log15.Logger) error {
+	checksum := base.Checksum(&config.DecoderBaseConfig, buf)
+	syslogMsgs, err := s.parserEnv.Parse(&config.DecoderBaseConfig, buf)
+	if err != nil {
+		base.CountParsingError(base.Ingest, filename, config.Format, err)
+		logger.Warn("Error parsing ingested message", "error", err)
+		return nil
+	}
+	for _, syslogMsg := range syslogMsgs {
+		if syslogMsg == nil {
+			continue
+		}
+		if !base.NormalizeTime(base.Ingest, syslogMsg, &config.DecoderBaseConfig) {
+			model.Free(syslogMsg)
+			continue
+		}
+		base.NormalizeHostname(syslogMsg, &config.DecoderBaseConfig)
+		syslogMsg.SetProperty("skewer", "filename", filename)
+		full := model.FullFactoryFrom(syslogMsg)
+		full.Uid = gen.Uid()
+		full.ConfId = config.ConfID
+		full.SourceType = "ingest"
+		full.SourcePath = config.Directory
+		base.SetChecksum(full, checksum)
+		err = s.stasher.Stash(full)
+		model.FullFree(full)
+		if err != nil {
+			if eerrors.IsFatal(err) {
+				return eerrors.Wrap(err, "Fatal error stashing ingested message")
+			}
+			logger.Warn("Error stashing ingested message", "error", err)
+			continue
+		}
+		base.CountIncomingMessage(base.Ingest, "", 0, config.Directory)
+	}
+	return nil
+}
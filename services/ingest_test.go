@@ -0,0 +1,184 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/utils"
+)
+
+func TestIngestDecompress(t *testing.T) {
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	_, _ = w.Write([]byte("line1\nline2\n"))
+	_ = w.Close()
+
+	// detected by the magic bytes, whatever the extension
+	r, err := decompress(bufio.NewReader(bytes.NewReader(compressed.Bytes())), "archive.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "line1\nline2\n" {
+		t.Fatalf("unexpected decompressed content: %q", content)
+	}
+
+	r, err = decompress(bufio.NewReader(bytes.NewReader([]byte("plain\n"))), "archive.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ = ioutil.ReadAll(r)
+	if string(content) != "plain\n" {
+		t.Fatalf("unexpected plain content: %q", content)
+	}
+}
+
+func TestIngestZstd(t *testing.T) {
+	initIngestRegistry()
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	fixture, err := ioutil.ReadFile(filepath.Join("testdata", "archive.log.zst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// detected by the magic bytes, whatever the extension
+	_, err = decompress(bufio.NewReader(bytes.NewReader(fixture)), "archive.log")
+	if err != ErrIngestZstd {
+		t.Fatalf("the zstd stream should be refused: %v", err)
+	}
+
+	// and the file is not marked as done
+	dir, err := ioutil.TempDir("", "skewer-ingest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "archive.log.zst")
+	err = ioutil.WriteFile(path, fixture, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &IngestService{logger: logger}
+	err = s.ingestFile(context.Background(), &conf.IngestSourceConfig{}, path, path, dir, utils.NewGenerator(), logger)
+	if err != ErrIngestZstd {
+		t.Fatalf("the zstd file should not be ingested: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp, err := loadCheckpoint(dir, path, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.Done || cp.Offset != 0 {
+		t.Fatalf("the zstd file should be left for a later run: %+v", cp)
+	}
+}
+
+func TestIngestResume(t *testing.T) {
+	content := []byte("one\ntwo\nthree\nfour")
+	var seen []string
+	var offsets []int64
+	err := scanLines(bytes.NewReader(content), 0, 1024, func(line []byte, offset int64) error {
+		seen = append(seen, string(line))
+		offsets = append(offsets, offset)
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 4 || offsets[3] != int64(len(content)) {
+		t.Fatalf("unexpected lines: %v %v", seen, offsets)
+	}
+
+	// resuming after the second line
+	seen = nil
+	err = scanLines(bytes.NewReader(content), offsets[1], 1024, func(line []byte, offset int64) error {
+		seen = append(seen, string(line))
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 2 || seen[0] != "three" || seen[1] != "four" {
+		t.Fatalf("unexpected resumed lines: %v", seen)
+	}
+}
+
+func TestIngestOversizedLines(t *testing.T) {
+	long := bytes.Repeat([]byte("x"), 10000)
+	content := append(append([]byte("one\n"), long...), []byte("\ntwo\n")...)
+	content = append(content, long...)
+	var seen []string
+	var last int64
+	var skipped int
+	err := scanLines(bytes.NewReader(content), 0, 4096, func(line []byte, offset int64) error {
+		seen = append(seen, string(line))
+		last = offset
+		return nil
+	}, func() { skipped++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 2 || seen[0] != "one" || seen[1] != "two" {
+		t.Fatalf("unexpected lines: %v", seen)
+	}
+	if skipped != 2 {
+		t.Fatalf("expected 2 oversized lines, got %d", skipped)
+	}
+	if last != int64(len(content)-len(long)) {
+		t.Fatalf("unexpected offset after the last line: %d", last)
+	}
+}
+
+func TestIngestCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "skewer-ingest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	filename := filepath.Join(dir, "archive.log.gz")
+	err = ioutil.WriteFile(filename, []byte("content"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(filename)
+
+	cp, err := loadCheckpoint(dir, filename, info)
+	if err != nil || cp.Offset != 0 || cp.Done {
+		t.Fatalf("unexpected initial checkpoint: %+v %v", cp, err)
+	}
+	cp.Offset = 42
+	err = saveCheckpoint(dir, cp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp, err = loadCheckpoint(dir, filename, info)
+	if err != nil || cp.Offset != 42 {
+		t.Fatalf("checkpoint was not restored: %+v %v", cp, err)
+	}
+
+	// the checkpoint is discarded when the file changes
+	err = ioutil.WriteFile(filename, []byte("other content"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, _ = os.Stat(filename)
+	cp, err = loadCheckpoint(dir, filename, info)
+	if err != nil || cp.Offset != 0 {
+		t.Fatalf("checkpoint of a modified file should be discarded: %+v %v", cp, err)
+	}
+}
@@ -0,0 +1,115 @@
+package network
+
+import (
+	"net"
+	"time"
+
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/services/base"
+)
+
+// backpressureInterval is the sampling period of the queue depth.
+const backpressureInterval = 10 * time.Millisecond
+
+// backpressure stops the reads of a listener while the queue of the raw
+// messages is above its high watermark, until it is down to its low
+// watermark. The unread data fills the socket buffers, so that TCP flow
+// control slows the senders down.
+type backpressure struct {
+	high int
+	low  int
+	gate *listenerPause
+}
+
+func newBackpressure(c *conf.TCPSourceConfig, provider, listener string) *backpressure {
+	return &backpressure{
+		high: c.BackpressureHigh,
+		low:  c.BackpressureLow,
+		gate: newListenerPause(base.BackpressureActiveGauge.WithLabelValues(provider, listener)),
+	}
+}
+
+// update applies the queue depth to the gate. It returns true when the
+// backpressure state has changed.
+func (b *backpressure) update(depth int) bool {
+	if depth >= b.high {
+		return b.gate.pause()
+	}
+	if depth <= b.low {
+		return b.gate.resume()
+	}
+	return false
+}
+
+// initBackpressures creates the backpressure gates of the listeners that
+// have watermarks, when the service provides its queue depth. The gates of
+// the previous listeners are released.
+func (s *StreamingService) initBackpressures() {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+	for _, b := range s.backpressures {
+		b.gate.resume()
+	}
+	s.backpressures = map[string]*backpressure{}
+	if s.queueDepth == nil {
+		return
+	}
+	provider := base.Types2Names[s.typ]
+	for _, l := range s.TCPListeners {
+		if l.Conf.BackpressureHigh > 0 {
+			s.backpressures[l.Name] = newBackpressure(&l.Conf, provider, l.Name)
+		}
+	}
+	for _, l := range s.UnixListeners {
+		if l.Conf.BackpressureHigh > 0 {
+			s.backpressures[l.Name] = newBackpressure(&l.Conf, provider, l.Name)
+		}
+	}
+}
+
+// withBackpressure makes the reads of conn wait while the named listener is
+// under backpressure.
+func (s *StreamingService) withBackpressure(conn net.Conn, name string, timeout time.Duration) net.Conn {
+	s.pauseMu.Lock()
+	b := s.backpressures[name]
+	s.pauseMu.Unlock()
+	if b == nil {
+		return conn
+	}
+	return newPausableConn(conn, b.gate, timeout)
+}
+
+// watchBackpressure samples the queue depth and updates the backpressure
+// gates, until the listeners are closed.
+func (s *StreamingService) watchBackpressure() {
+	s.pauseMu.Lock()
+	gates := make(map[string]*backpressure, len(s.backpressures))
+	for name, b := range s.backpressures {
+		gates[name] = b
+	}
+	s.pauseMu.Unlock()
+	if len(gates) == 0 {
+		return
+	}
+	done := s.done()
+	ticker := time.NewTicker(backpressureInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		depth := s.queueDepth()
+		for name, b := range gates {
+			if !b.update(depth) {
+				continue
+			}
+			if depth >= b.high {
+				s.Logger.Info("Backpressure: the listener stops reading", "listener", name, "depth", depth)
+			} else {
+				s.Logger.Info("Backpressure: the listener reads again", "listener", name, "depth", depth)
+			}
+		}
+	}
+}
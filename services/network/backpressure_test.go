@@ -0,0 +1,101 @@
+package network
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/services/base"
+	"go.uber.org/atomic"
+)
+
+func TestBackpressureWatermarks(t *testing.T) {
+	initDirectRelpRegistry()
+	var depth atomic.Int64
+	s := &StreamingService{}
+	s.init()
+	s.Logger = log15.New()
+	s.Logger.SetHandler(log15.DiscardHandler())
+	s.typ = base.TCP
+	s.queueDepth = func() int { return int(depth.Load()) }
+	s.TCPListeners = []TCPListenerConf{
+		{Name: "127.0.0.1:1", Conf: conf.TCPSourceConfig{BackpressureHigh: 10, BackpressureLow: 4}},
+		{Name: "127.0.0.1:2"},
+	}
+	s.listenersDone = make(chan struct{})
+	s.initBackpressures()
+	go s.watchBackpressure()
+	defer func() {
+		s.pauseMu.Lock()
+		close(s.listenersDone)
+		s.pauseMu.Unlock()
+	}()
+
+	active := func() float64 {
+		return gaugeValue(base.BackpressureActiveGauge.WithLabelValues(base.Types2Names[base.TCP], "127.0.0.1:1"))
+	}
+	client, server := net.Pipe()
+	defer func() { _ = client.Close() }()
+	conn := s.withBackpressure(server, "127.0.0.1:1", 0)
+	if s.withBackpressure(server, "127.0.0.1:2", 0) != server {
+		t.Fatal("a listener without watermarks should not be wrapped")
+	}
+
+	read := make(chan string, 1)
+	readOne := func() {
+		go func() {
+			buf := make([]byte, 16)
+			n, _ := conn.Read(buf)
+			read <- string(buf[:n])
+		}()
+		go func() { _, _ = client.Write([]byte("hello")) }()
+	}
+	expectRead := func(expected bool, step string) {
+		t.Helper()
+		select {
+		case <-read:
+			if !expected {
+				t.Fatalf("%s: the listener should not read", step)
+			}
+		case <-time.After(100 * time.Millisecond):
+			if expected {
+				t.Fatalf("%s: the listener should read", step)
+			}
+		}
+	}
+
+	// below the high watermark, the reads go on
+	depth.Store(9)
+	time.Sleep(5 * backpressureInterval)
+	readOne()
+	expectRead(true, "below high")
+	if active() != 0 {
+		t.Fatal("the backpressure should not be active")
+	}
+
+	// at the high watermark, the reads stop
+	depth.Store(10)
+	time.Sleep(5 * backpressureInterval)
+	if active() != 1 {
+		t.Fatal("the backpressure should be active")
+	}
+	readOne()
+	expectRead(false, "high")
+
+	// between the watermarks, the reads stay stopped
+	depth.Store(5)
+	time.Sleep(5 * backpressureInterval)
+	expectRead(false, "between")
+	if active() != 1 {
+		t.Fatal("the backpressure should still be active")
+	}
+
+	// at the low watermark, the reads resume
+	depth.Store(4)
+	expectRead(true, "low")
+	if active() != 0 {
+		t.Fatal("the backpressure should not be active anymore")
+	}
+}
@@ -0,0 +1,75 @@
+package network
+
+import (
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/services/base"
+	"github.com/stephane-martin/skewer/sys/binder"
+)
+
+var bindStates = []string{"bound", "retrying", "failed"}
+
+const (
+	bindBackoffMin = 100 * time.Millisecond
+	bindBackoffMax = 2 * time.Second
+)
+
+// bindRetrier retries the listens that fail because the address is
+// transiently unavailable, with an exponential backoff, until a deadline
+// shared by the listeners of a service. So a service does not wait more than
+// the retry period for all its listeners.
+type bindRetrier struct {
+	provider string
+	deadline time.Time
+	logger   log15.Logger
+}
+
+func newBindRetrier(provider string, period time.Duration, logger log15.Logger) *bindRetrier {
+	return &bindRetrier{
+		provider: provider,
+		deadline: time.Now().Add(period),
+		logger:   logger,
+	}
+}
+
+// bind calls listen until it succeeds, the error is not transient, or the
+// deadline is over. The listens through the binder are retried the same way.
+func (r *bindRetrier) bind(listener string, listen func() error) (err error) {
+	backoff := bindBackoffMin
+	for {
+		err = listen()
+		if err == nil {
+			r.setState(listener, "bound")
+			return nil
+		}
+		wait := time.Until(r.deadline)
+		if wait <= 0 || !binder.IsTransient(err) {
+			r.setState(listener, "failed")
+			return err
+		}
+		if backoff < wait {
+			wait = backoff
+		}
+		r.setState(listener, "retrying")
+		r.logger.Info("Listen address unavailable, retrying", "listener", listener, "error", err, "retry_in", wait)
+		time.Sleep(wait)
+		backoff *= 2
+		if backoff > bindBackoffMax {
+			backoff = bindBackoffMax
+		}
+	}
+}
+
+func (r *bindRetrier) setState(listener, state string) {
+	if base.ListenerBindStateGauge == nil {
+		return
+	}
+	for _, s := range bindStates {
+		if s == state {
+			base.ListenerBindStateGauge.WithLabelValues(r.provider, listener, s).Set(1)
+		} else {
+			base.ListenerBindStateGauge.WithLabelValues(r.provider, listener, s).Set(0)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package network
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stephane-martin/skewer/services/base"
+)
+
+func TestBindRetrier(t *testing.T) {
+	initDirectRelpRegistry()
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	state := func(listener, s string) float64 {
+		m := &dto.Metric{}
+		_ = base.ListenerBindStateGauge.WithLabelValues("test", listener, s).Write(m)
+		return m.GetGauge().GetValue()
+	}
+
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := busy.Addr().String()
+	listen := func() (l net.Listener, err error) {
+		return net.Listen("tcp", addr)
+	}
+
+	// the port is released while the listen is retried
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		_ = busy.Close()
+	}()
+	retrier := newBindRetrier("test", 5*time.Second, logger)
+	var l net.Listener
+	err = retrier.bind(addr, func() (err error) {
+		l, err = listen()
+		return err
+	})
+	if err != nil {
+		t.Fatalf("the listen should have been retried: %v", err)
+	}
+	if state(addr, "bound") != 1 || state(addr, "retrying") != 0 || state(addr, "failed") != 0 {
+		t.Fatal("the listener should be reported as bound")
+	}
+
+	// the port stays in use: give up at the deadline
+	retrier = newBindRetrier("test", 300*time.Millisecond, logger)
+	start := time.Now()
+	err = retrier.bind(addr, func() error {
+		_, err := listen()
+		return err
+	})
+	_ = l.Close()
+	if err == nil {
+		t.Fatal("the listen should have failed")
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond || elapsed > 2*time.Second {
+		t.Fatalf("unexpected retry duration: %s", elapsed)
+	}
+	if state(addr, "failed") != 1 || state(addr, "bound") != 0 {
+		t.Fatal("the listener should be reported as failed")
+	}
+
+	// the other errors are not retried
+	calls := 0
+	retrier = newBindRetrier("test", 5*time.Second, logger)
+	err = retrier.bind("other", func() error {
+		calls++
+		return errors.New("permission denied")
+	})
+	if err == nil || calls != 1 {
+		t.Fatalf("a permanent error should not be retried (%d calls)", calls)
+	}
+}
@@ -0,0 +1,116 @@
+package network
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/services/base"
+	"go.uber.org/atomic"
+)
+
+// connLimiter caps the number of connections of a listener. When the cap is
+// reached, a new connection evicts the least recently active connection if
+// that connection has been idle for at least evictIdle. Otherwise the new
+// connection is refused.
+type connLimiter struct {
+	mu        sync.Mutex
+	conns     map[*limitedConn]struct{}
+	max       int
+	evictIdle time.Duration
+	provider  string
+	listener  string
+}
+
+func newConnLimiter(max int, evictIdle time.Duration, provider, listener string) *connLimiter {
+	return &connLimiter{
+		conns:     make(map[*limitedConn]struct{}, max),
+		max:       max,
+		evictIdle: evictIdle,
+		provider:  provider,
+		listener:  listener,
+	}
+}
+
+// limitedConn records the time of its last successful read, and leaves its
+// limiter when it is closed.
+type limitedConn struct {
+	net.Conn
+	limiter  *connLimiter
+	lastRead atomic.Int64
+}
+
+func (c *limitedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.lastRead.Store(time.Now().UnixNano())
+	}
+	return n, err
+}
+
+func (c *limitedConn) Close() error {
+	c.limiter.remove(c)
+	return c.Conn.Close()
+}
+
+func (l *connLimiter) remove(c *limitedConn) {
+	l.mu.Lock()
+	delete(l.conns, c)
+	l.mu.Unlock()
+}
+
+// admit returns the connection to hand to the stream handler, or false when
+// the connection was refused and closed. When an idle connection is evicted
+// to make room, it is closed, so that its handler returns. A nil limiter
+// admits every connection.
+func (l *connLimiter) admit(conn net.Conn) (net.Conn, bool) {
+	if l == nil {
+		return conn, true
+	}
+	now := time.Now().UnixNano()
+	c := &limitedConn{Conn: conn, limiter: l}
+	c.lastRead.Store(now)
+
+	l.mu.Lock()
+	var victim *limitedConn
+	if len(l.conns) >= l.max {
+		if l.evictIdle > 0 {
+			// the connections are few (at most max), so the least
+			// recently active one is searched only when needed, instead
+			// of keeping them ordered on every read
+			for candidate := range l.conns {
+				if victim == nil || candidate.lastRead.Load() < victim.lastRead.Load() {
+					victim = candidate
+				}
+			}
+			if victim != nil && time.Duration(now-victim.lastRead.Load()) < l.evictIdle {
+				victim = nil
+			}
+		}
+		if victim == nil {
+			l.mu.Unlock()
+			base.ConnectionLimitCounter.WithLabelValues(l.provider, l.listener, "refuse").Inc()
+			_ = conn.Close()
+			return nil, false
+		}
+		delete(l.conns, victim)
+	}
+	l.conns[c] = struct{}{}
+	l.mu.Unlock()
+
+	if victim != nil {
+		base.ConnectionLimitCounter.WithLabelValues(l.provider, l.listener, "evict").Inc()
+		_ = victim.Close()
+	}
+	return c, true
+}
+
+// connLimiter returns the connection limiter of a listener, or nil when the
+// listener has no max_connections cap.
+func (s *StreamingService) connLimiter(name string, c *conf.TCPSourceConfig) *connLimiter {
+	if c.MaxConnections <= 0 {
+		return nil
+	}
+	return newConnLimiter(c.MaxConnections, c.EvictIdle, base.Types2Names[s.typ], name)
+}
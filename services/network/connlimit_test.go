@@ -0,0 +1,105 @@
+package network
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/services/base"
+)
+
+func TestConnLimiterEviction(t *testing.T) {
+	initDirectRelpRegistry()
+	l := newConnLimiter(2, 20*time.Millisecond, base.Types2Names[base.TCP], "test-evict")
+	evict := base.ConnectionLimitCounter.WithLabelValues(l.provider, l.listener, "evict")
+	refuse := base.ConnectionLimitCounter.WithLabelValues(l.provider, l.listener, "refuse")
+	evicted, refusedBefore := tlsCounterValue(evict), tlsCounterValue(refuse)
+
+	// admit connections like the accept loop, with a handler that reads
+	// the lines until the connection is closed
+	handlerDone := map[net.Conn]chan struct{}{}
+	connect := func() (client net.Conn, admitted bool) {
+		client, server := net.Pipe()
+		conn, ok := l.admit(server)
+		if !ok {
+			return client, false
+		}
+		done := make(chan struct{})
+		handlerDone[client] = done
+		go func() {
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+			}
+			_ = conn.Close()
+			close(done)
+		}()
+		return client, true
+	}
+
+	idle, _ := connect()
+	time.Sleep(10 * time.Millisecond)
+	active, _ := connect()
+	defer func() { _ = active.Close() }()
+
+	// both connections are too recent to be evicted
+	refused, ok := connect()
+	if ok {
+		t.Fatal("the connection over the cap should have been refused")
+	}
+	if _, err := refused.Read(make([]byte, 1)); err == nil {
+		t.Fatal("the refused connection should be closed")
+	}
+	if tlsCounterValue(refuse) != refusedBefore+1 {
+		t.Fatal("the refused connection was not counted")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	// the active connection receives data: the other one is the least
+	// recently active
+	if _, err := active.Write([]byte("message\n")); err != nil {
+		t.Fatal(err)
+	}
+	fresh, ok := connect()
+	if !ok {
+		t.Fatal("the new connection should have evicted an idle connection")
+	}
+	defer func() { _ = fresh.Close() }()
+	if tlsCounterValue(evict) != evicted+1 {
+		t.Fatal("the eviction was not counted")
+	}
+	select {
+	case <-handlerDone[idle]:
+	case <-time.After(time.Second):
+		t.Fatal("the handler of the evicted connection did not return")
+	}
+	select {
+	case <-handlerDone[active]:
+		t.Fatal("the active connection should not have been evicted")
+	default:
+	}
+
+	// the connections that are closed leave room for new ones
+	_ = active.Close()
+	<-handlerDone[active]
+	other, ok := connect()
+	if !ok {
+		t.Fatal("the connection should have been admitted after a close")
+	}
+	_ = other.Close()
+}
+
+func TestConnLimiterNil(t *testing.T) {
+	var l *connLimiter
+	client, server := net.Pipe()
+	defer func() { _ = client.Close() }()
+	conn, ok := l.admit(server)
+	if !ok || conn != server {
+		t.Fatal("a nil limiter should admit the connection as is")
+	}
+	s := &StreamingService{}
+	if s.connLimiter("test", &conf.TCPSourceConfig{}) != nil {
+		t.Fatal("no limiter is needed without max_connections")
+	}
+}
@@ -0,0 +1,50 @@
+package network
+
+import (
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/conf"
+	"go.uber.org/atomic"
+)
+
+// connLog logs the new connection and end of connection events of a
+// client, according to the connection_log settings of its source.
+type connLog struct {
+	logger  log15.Logger
+	level   string
+	enabled bool
+}
+
+// connLog returns the connection logger of a new client connection. The
+// sampling counters are kept per source configuration.
+func (s *StreamingService) connLog(logger log15.Logger, config conf.TCPSourceConfig) connLog {
+	l := connLog{logger: logger, level: config.ConnectionLog}
+	if l.level == "none" {
+		return l
+	}
+	every := uint64(config.ConnectionLogSampling)
+	if every <= 1 {
+		l.enabled = true
+		return l
+	}
+	v, _ := s.connLogs.LoadOrStore(config.ConfID, atomic.NewUint64(0))
+	// the first connection is always logged
+	l.enabled = (v.(*atomic.Uint64).Inc()-1)%every == 0
+	return l
+}
+
+func (l connLog) opened() {
+	if !l.enabled {
+		return
+	}
+	if l.level == "debug" {
+		l.logger.Debug("New client")
+	} else {
+		l.logger.Info("New client")
+	}
+}
+
+func (l connLog) closed() {
+	if l.enabled {
+		l.logger.Debug("Client gone away")
+	}
+}
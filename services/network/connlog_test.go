@@ -0,0 +1,40 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/conf"
+)
+
+func TestConnLogSampling(t *testing.T) {
+	var s StreamingService
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+
+	config := conf.TCPSourceConfig{ConfID: "source1"}
+	config.ConnectionLog = "info"
+	config.ConnectionLogSampling = 3
+	other := config
+	other.ConfID = "source2"
+
+	var logged []int
+	for i := 0; i < 7; i++ {
+		if s.connLog(logger, config).enabled {
+			logged = append(logged, i)
+		}
+	}
+	if len(logged) != 3 || logged[0] != 0 || logged[1] != 3 || logged[2] != 6 {
+		t.Fatalf("unexpected sampled connections: %v", logged)
+	}
+	// the sources are sampled independently
+	if !s.connLog(logger, other).enabled {
+		t.Fatal("the first connection of a source should be logged")
+	}
+
+	config.ConnectionLog = "none"
+	config.ConnectionLogSampling = 1
+	if s.connLog(logger, config).enabled {
+		t.Fatal("connection logs should be disabled")
+	}
+}
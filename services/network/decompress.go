@@ -0,0 +1,67 @@
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+var errZstdNotSupported = eerrors.New("zstd decompression is not supported, only gzip and zlib are")
+
+// isZlibHeader reports whether the stream starts with a zlib header: deflate
+// compression method, no preset dictionary, and a valid header checksum. The
+// dictionary flag is what tells apart an octet-counted frame of length 80.
+func isZlibHeader(magic []byte) bool {
+	if len(magic) < 2 || magic[0]&0x0f != 8 || magic[0]>>4 > 7 || magic[1]&0x20 != 0 {
+		return false
+	}
+	return (uint16(magic[0])<<8|uint16(magic[1]))%31 == 0
+}
+
+// detectCompression returns the codec of the stream according to its magic
+// bytes, or "none".
+func detectCompression(r *bufio.Reader) string {
+	magic, _ := r.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return "gzip"
+	case bytes.HasPrefix(magic, zstdMagic):
+		return "zstd"
+	case isZlibHeader(magic):
+		return "zlib"
+	}
+	return "none"
+}
+
+// decompressStream wraps the input stream of a connection according to the
+// decompress setting. With "auto", the codec is detected and an uncompressed
+// stream is read as is. With an explicit codec, a stream that is not
+// compressed with that codec is an error.
+func decompressStream(r io.Reader, codec string) (io.Reader, error) {
+	if codec == "" || codec == "none" {
+		return r, nil
+	}
+	buffered := bufio.NewReader(r)
+	detected := detectCompression(buffered)
+	if codec != "auto" && detected != codec {
+		return nil, eerrors.Errorf("The input stream is not %s compressed (detected: %s)", codec, detected)
+	}
+	switch detected {
+	case "gzip":
+		return gzip.NewReader(buffered)
+	case "zlib":
+		return zlib.NewReader(buffered)
+	case "zstd":
+		return nil, errZstdNotSupported
+	}
+	return buffered, nil
+}
@@ -0,0 +1,88 @@
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDecompressStream(t *testing.T) {
+	messages := []string{
+		"<13>1 2018-01-01T00:00:00Z host app - - - first",
+		"<13>1 2018-01-01T00:00:00Z host app - - - second",
+	}
+	octets := "<13>1 2018-01-01T00:00:00Z host app - - - octet counted and eighty bytes long..."
+	// an uncompressed stream that starts with "80" is not mistaken for zlib
+	var plain bytes.Buffer
+	plain.WriteString(fmt.Sprintf("%d %s", len(octets), octets))
+	for _, m := range messages {
+		plain.WriteString(m + "\n")
+	}
+	expected := append([]string{octets}, messages...)
+
+	compress := func(codec string) []byte {
+		var buf bytes.Buffer
+		var w io.WriteCloser
+		switch codec {
+		case "gzip":
+			w = gzip.NewWriter(&buf)
+		case "zlib":
+			w = zlib.NewWriter(&buf)
+		default:
+			return plain.Bytes()
+		}
+		_, _ = w.Write(plain.Bytes())
+		_ = w.Close()
+		return buf.Bytes()
+	}
+
+	for _, test := range []struct {
+		codec  string
+		stream string
+	}{
+		{"gzip", "gzip"},
+		{"zlib", "zlib"},
+		{"auto", "gzip"},
+		{"auto", "zlib"},
+		{"auto", "none"},
+		{"none", "none"},
+	} {
+		input, err := decompressStream(bytes.NewReader(compress(test.stream)), test.codec)
+		if err != nil {
+			t.Fatalf("%s/%s: %v", test.codec, test.stream, err)
+		}
+		scanner := bufio.NewScanner(input)
+		scanner.Split(TcpSplit)
+		var got []string
+		for scanner.Scan() {
+			got = append(got, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			t.Fatalf("%s/%s: %v", test.codec, test.stream, err)
+		}
+		if strings.Join(got, "|") != strings.Join(expected, "|") {
+			t.Errorf("%s/%s: expected %q, got %q", test.codec, test.stream, expected, got)
+		}
+	}
+
+	// the stream is not compressed as the configuration says
+	for _, codec := range []string{"gzip", "zlib"} {
+		_, err := decompressStream(bytes.NewReader(plain.Bytes()), codec)
+		if err == nil || !strings.Contains(err.Error(), "not "+codec+" compressed") {
+			t.Errorf("%s: expected an error for an uncompressed stream, got: %v", codec, err)
+		}
+	}
+	_, err := decompressStream(bytes.NewReader(compress("gzip")), "zlib")
+	if err == nil {
+		t.Error("a gzip stream should not be read as zlib")
+	}
+	_, err = decompressStream(bytes.NewReader(append(zstdMagic, 0, 0)), "auto")
+	if err != errZstdNotSupported {
+		t.Errorf("expected zstd to be rejected, got: %v", err)
+	}
+}
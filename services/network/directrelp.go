@@ -3,7 +3,6 @@ package network
 import (
 	"io"
 	"net"
-	"runtime"
 	"sync"
 	"time"
 
@@ -18,22 +17,31 @@ import (
 	"github.com/stephane-martin/skewer/model"
 	"github.com/stephane-martin/skewer/services/base"
 	"github.com/stephane-martin/skewer/sys/binder"
+	"github.com/stephane-martin/skewer/transform"
 	"github.com/stephane-martin/skewer/utils"
 	"github.com/stephane-martin/skewer/utils/eerrors"
+	"github.com/stephane-martin/skewer/utils/logging"
+	"github.com/stephane-martin/skewer/utils/ordering"
 	"github.com/stephane-martin/skewer/utils/queue/message"
 	"github.com/stephane-martin/skewer/utils/queue/tcp"
+	"github.com/stephane-martin/skewer/utils/recenterrors"
+	"go.uber.org/atomic"
 )
 
 var connCounter *prometheus.CounterVec
 var ackCounter *prometheus.CounterVec
-var messageFilterCounter *prometheus.CounterVec
+var messageFilterCounter *base.ExpiringCounterVec
+var expiredCounter *prometheus.CounterVec
+var jsLimitCounter *prometheus.CounterVec
+var discardedCounter *prometheus.CounterVec
+var parsedQueueFullCounter prometheus.Counter
 
 func initDirectRelpRegistry() {
 	base.Once.Do(func() {
 		base.InitRegistry()
 
 		// as a RELP service
-		relpAnswersCounter = prometheus.NewCounterVec(
+		relpAnswersCounter = base.NewExpiringCounterVec(
 			prometheus.CounterOpts{
 				Name: "skw_relp_answers_total",
 				Help: "number of RSP answers sent back to the RELP client",
@@ -41,7 +49,7 @@ func initDirectRelpRegistry() {
 			[]string{"status", "client"},
 		)
 
-		relpProtocolErrorsCounter = prometheus.NewCounterVec(
+		relpProtocolErrorsCounter = base.NewExpiringCounterVec(
 			prometheus.CounterOpts{
 				Name: "skw_relp_protocol_errors_total",
 				Help: "Number of RELP protocol errors",
@@ -66,7 +74,7 @@ func initDirectRelpRegistry() {
 			[]string{"dest", "status"},
 		)
 
-		messageFilterCounter = prometheus.NewCounterVec(
+		messageFilterCounter = base.NewExpiringCounterVec(
 			prometheus.CounterOpts{
 				Name: "skw_message_filtering_total",
 				Help: "number of filtered messages by status",
@@ -74,7 +82,44 @@ func initDirectRelpRegistry() {
 			[]string{"status", "client", "destination"},
 		)
 
-		base.Registry.MustRegister(relpAnswersCounter, relpProtocolErrorsCounter, ackCounter, connCounter, messageFilterCounter)
+		expiredCounter = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "skw_messages_expired_total",
+				Help: "number of messages dropped because they exceeded max_message_age",
+			},
+			[]string{"destination"},
+		)
+
+		jsLimitCounter = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "skw_js_limit_kills_total",
+				Help: "number of JS functions interrupted because they exceeded the resource limits",
+			},
+			[]string{"destination", "reason"},
+		)
+
+		discardedCounter = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "skw_dest_discarded_total",
+				Help: "number of messages that were ACKed but deliberately not sent",
+			},
+			[]string{"dest"},
+		)
+
+		parsedQueueFullCounter = prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "skw_parsed_queue_full_total",
+				Help: "number of messages NACKed because the queue of the parsed messages was full",
+			},
+		)
+
+		relpReplayBufferedCounter, relpReplayRecoveredCounter = newRelpReplayCounters()
+		relpEmptyFramesCounter, relpKeepalivesCounter = newRelpEmptyFramesCounters()
+		kafkaClusterAnswersCounter = newKafkaClusterAnswersCounter()
+		relpLostCounter = newRelpLostCounter()
+		relpBacklogPausesCounter = newRelpBacklogPausesCounter()
+
+		base.Registry.MustRegister(relpAnswersCounter, relpLostCounter, relpBacklogPausesCounter, relpProtocolErrorsCounter, relpReplayBufferedCounter, relpReplayRecoveredCounter, relpEmptyFramesCounter, relpKeepalivesCounter, ackCounter, connCounter, messageFilterCounter, expiredCounter, jsLimitCounter, discardedCounter, parsedQueueFullCounter, kafkaClusterAnswersCounter, utils.InvalidPartitionCounter, utils.KafkaPartitionsGauge, utils.KafkaPartitionRefreshCounter)
 	})
 }
 
@@ -82,13 +127,14 @@ type DirectRelpService struct {
 	impl           *DirectRelpServiceImpl
 	fatalErrorChan chan struct{}
 	fatalOnce      *sync.Once
-	QueueSize      uint64
 	logger         log15.Logger
 	reporter       *base.Reporter
 	b              binder.Client
 	sc             []conf.DirectRELPSourceConfig
 	pc             []conf.ParserConfig
 	kc             conf.KafkaDestConfig
+	mc             conf.MainConfig
+	tc             []conf.TransformConfig
 	wg             sync.WaitGroup
 	confined       bool
 }
@@ -123,6 +169,11 @@ func (s *DirectRelpService) Gather() ([]*dto.MetricFamily, error) {
 
 func (s *DirectRelpService) Start() (infos []model.ListenerInfo, err error) {
 	infos = []model.ListenerInfo{}
+	// an invalid configuration would not get better with the retries
+	_, err = transform.New(s.tc)
+	if err != nil {
+		return infos, eerrors.Wrap(err, "Invalid transforms configuration")
+	}
 	s.impl = NewDirectRelpServiceImpl(s.confined, s.reporter, s.b, s.logger)
 	s.fatalErrorChan = make(chan struct{})
 	s.fatalOnce = &sync.Once{}
@@ -138,8 +189,11 @@ func (s *DirectRelpService) Start() (infos []model.ListenerInfo, err error) {
 				return
 
 			case Stopped:
-				s.impl.SetConf(s.sc, s.pc, s.kc, s.QueueSize)
-				infos, err := s.impl.Start()
+				var infos []model.ListenerInfo
+				err := s.impl.SetConf(s.sc, s.pc, s.kc, s.mc, s.tc)
+				if err == nil {
+					infos, err = s.impl.Start()
+				}
 				if err == nil {
 					err = s.reporter.Report(infos)
 					if err != nil {
@@ -172,6 +226,18 @@ func (s *DirectRelpService) Start() (infos []model.ListenerInfo, err error) {
 	return
 }
 
+// Drain makes the RELP clients of the listener reconnect, after their
+// transactions in progress are answered.
+func (s *DirectRelpService) Drain(listener string) error {
+	return s.impl.Drain(listener)
+}
+
+// Transactions returns a snapshot of the transactions in progress of the
+// RELP sessions.
+func (s *DirectRelpService) Transactions() []base.RelpTransactions {
+	return s.impl.Transactions()
+}
+
 func (s *DirectRelpService) Shutdown() {
 	s.Stop()
 }
@@ -185,38 +251,66 @@ func (s *DirectRelpService) SetConf(c conf.BaseConfig) {
 	s.sc = c.DirectRELPSource
 	s.pc = c.Parsers
 	s.kc = *c.KafkaDest
-	s.QueueSize = c.Main.InputQueueSize
+	s.mc = c.Main
+	s.tc = c.Transforms
 }
 
 type DirectRelpServiceImpl struct {
 	StreamingService
+	sessions            relpSessions
 	RelpConfigs         []conf.DirectRELPSourceConfig
 	kafkaConf           conf.KafkaDestConfig
 	status              RelpServerStatus
 	StatusChan          chan RelpServerStatus
 	producer            sarama.AsyncProducer
+	clusters            []*kafkaCluster
 	reporter            *base.Reporter
 	rawQ                *tcp.Ring
+	orderedQs           orderedQueues
 	parsedMessagesQueue *message.Ring
 	parsewg             sync.WaitGroup
 	configs             map[utils.MyULID]conf.DirectRELPSourceConfig
 	forwarder           *ackForwarder
 	parserEnv           *decoders.ParsersEnv
 	collectors          []prometheus.Collector
+	stats               parseStats
+	maxMessageAge       time.Duration
+	jsLimits            javascript.Limits
+	transforms          *transform.Pipeline
+	parsedQueuePolicy   string
+	parsedQueueTimeout  time.Duration
+	// parsedRoom is signaled when push2kafka takes a message from the parsed
+	// queue, so that the parsers waiting for room wake up
+	parsedRoom chan struct{}
+	// ordering checks the order of the messages sent to Kafka, when
+	// ordering_check is enabled
+	ordering *ordering.Checker
+	// errLogger rate-limits the error logs of the parse/push/response loops
+	errLogger log15.Logger
+	// serializer encodes the messages for Kafka, in the push loop
+	serializer *model.JSONSerializer
+	// kafkaClient is the client of producer: the partition functions get
+	// the partition counts of its metadata
+	kafkaClient sarama.Client
+	partitions  *utils.PartitionCounts
 }
 
 func NewDirectRelpServiceImpl(confined bool, reporter *base.Reporter, b binder.Client, logger log15.Logger) *DirectRelpServiceImpl {
 	s := DirectRelpServiceImpl{
-		status:    Stopped,
-		reporter:  reporter,
-		configs:   map[utils.MyULID]conf.DirectRELPSourceConfig{},
-		forwarder: newAckForwarder(),
+		status:     Stopped,
+		reporter:   reporter,
+		configs:    map[utils.MyULID]conf.DirectRELPSourceConfig{},
+		forwarder:  newAckForwarder(),
+		serializer: model.NewJSONSerializer(0),
+		parsedRoom: make(chan struct{}, 1),
 	}
 	s.StreamingService.init()
 	s.StreamingService.BaseService.Logger = logger.New("class", "DirectRELPService")
+	s.errLogger = s.Logger
 	s.StreamingService.BaseService.Binder = b
 	s.StreamingService.handler = DirectRelpHandler{Server: &s}
 	s.StreamingService.confined = confined
+	s.StreamingService.typ = base.DirectRELP
 	s.StatusChan = make(chan RelpServerStatus, 10)
 	return &s
 }
@@ -238,14 +332,24 @@ func (s *DirectRelpServiceImpl) Start() ([]model.ListenerInfo, error) {
 	}
 
 	var err error
-	producer, registry, err := s.kafkaConf.GetAsyncProducer(s.confined)
+	producers, client, registries, err := s.kafkaConf.GetAsyncProducers(s.confined)
 	if err != nil {
 		connCounter.WithLabelValues("directkafka", "fail").Inc()
 		s.resetTCPListeners()
 		return nil, err
 	}
-	s.producer = producer
-	s.collectors = utils.KafkaProducerMetrics(registry, "skw_directrelp_kafka")
+	s.producer = producers[s.kafkaConf.ClusterID]
+	s.kafkaClient = client
+	s.partitions = utils.NewPartitionCounts(s.Logger, client)
+	s.clusters = newKafkaClusters(s.kafkaConf, producers)
+	s.collectors = nil
+	for id, registry := range registries {
+		var labels prometheus.Labels
+		if len(s.clusters) > 0 {
+			labels = prometheus.Labels{"cluster": id}
+		}
+		s.collectors = append(s.collectors, utils.KafkaProducerMetrics(registry, "skw_directrelp_kafka", labels)...)
+	}
 	base.Registry.MustRegister(s.collectors...)
 
 	connCounter.WithLabelValues("directkafka", "success").Inc()
@@ -254,6 +358,10 @@ func (s *DirectRelpServiceImpl) Start() ([]model.ListenerInfo, error) {
 
 	s.parsedMessagesQueue = message.NewRing(s.QueueSize)
 	s.rawQ = tcp.NewRing(s.QueueSize)
+	s.orderedQs = nil
+	if hasOrderedListener(s.SourceConfigs) {
+		s.orderedQs = newOrderedQueues(parseWorkers(s.ParseWorkers), s.QueueSize)
+	}
 	s.configs = map[utils.MyULID]conf.DirectRELPSourceConfig{}
 
 	for _, l := range s.UnixListeners {
@@ -263,25 +371,42 @@ func (s *DirectRelpServiceImpl) Start() ([]model.ListenerInfo, error) {
 		s.configs[l.Conf.ConfID] = conf.DirectRELPSourceConfig(l.Conf)
 	}
 
-	s.wgroup.Add(1)
+	stopRefresh := make(chan struct{})
+	s.wgroup.Add(2)
 	go func() {
 		defer s.wgroup.Done()
 		s.push2kafka()
+		close(stopRefresh)
 	}()
-	s.wgroup.Add(1)
 	go func() {
 		defer s.wgroup.Done()
-		s.handleKafkaResponses()
+		s.partitions.Run(s.kafkaConf.PartitionRefreshInterval, stopRefresh)
 	}()
+	for _, producer := range producers {
+		s.wgroup.Add(1)
+		go func(producer sarama.AsyncProducer) {
+			defer s.wgroup.Done()
+			s.handleKafkaResponses(producer)
+		}(producer)
+	}
 
-	cpus := runtime.NumCPU()
-	for i := 0; i < cpus; i++ {
+	workers := parseWorkers(s.ParseWorkers)
+	s.stats = newParseStats(base.DirectRELP, workers+len(s.orderedQs))
+	for i := 0; i < workers; i++ {
 		s.parsewg.Add(1)
 		go func() {
 			defer s.parsewg.Done()
-			s.parse()
+			s.parse(s.rawQ)
 		}()
 	}
+	// one parser per ordered queue
+	for _, q := range s.orderedQs {
+		s.parsewg.Add(1)
+		go func(q *tcp.Ring) {
+			defer s.parsewg.Done()
+			s.parse(q)
+		}(q)
+	}
 
 	s.status = Started
 	s.StatusChan <- Started
@@ -346,6 +471,7 @@ func (s *DirectRelpServiceImpl) doStop(final bool, wait bool) {
 	if s.rawQ != nil {
 		s.rawQ.Dispose()
 	}
+	s.orderedQs.dispose()
 	// the parsers consume the rest of rawMessagesQueue, then they stop
 	s.parsewg.Wait() // wait that the parsers have stopped
 	if s.parsedMessagesQueue != nil {
@@ -356,6 +482,11 @@ func (s *DirectRelpServiceImpl) doStop(final bool, wait bool) {
 	s.forwarder.RemoveAll()
 	// wait that all goroutines have ended
 	s.wgroup.Wait()
+	// the producers do not close the client they were built from
+	if s.kafkaClient != nil {
+		_ = s.kafkaClient.Close()
+		s.kafkaClient = nil
+	}
 	// unregister kafka metrics
 	for _, collector := range s.collectors {
 		base.Registry.Unregister(collector)
@@ -375,14 +506,33 @@ func (s *DirectRelpServiceImpl) doStop(final bool, wait bool) {
 	}
 }
 
-func (s *DirectRelpServiceImpl) SetConf(sc []conf.DirectRELPSourceConfig, pc []conf.ParserConfig, kc conf.KafkaDestConfig, queueSize uint64) {
+func (s *DirectRelpServiceImpl) SetConf(sc []conf.DirectRELPSourceConfig, pc []conf.ParserConfig, kc conf.KafkaDestConfig, mc conf.MainConfig, tc []conf.TransformConfig) error {
 	tcpConfigs := []conf.TCPSourceConfig{}
 	for _, c := range sc {
 		tcpConfigs = append(tcpConfigs, conf.TCPSourceConfig(c))
 	}
-	s.StreamingService.SetConf(tcpConfigs, pc, queueSize, 132000)
+	s.StreamingService.SetConf(tcpConfigs, pc, mc.InputQueueSize, 132000)
+	s.ParseWorkers = mc.ParseWorkers
+	s.OrderingCheck = mc.OrderingCheck
+	s.BatchSize = mc.RELPBatchSize
+	s.BindRetryPeriod = mc.BindRetryPeriod
+	throttle.configure(mc, s.Logger)
+	base.ConfigureFieldSizes(mc.FieldSizeMetrics, mc.FieldSizeWindow)
+	s.ordering = ordering.NewChecker(mc.OrderingCheck)
+	s.maxMessageAge = mc.MaxMessageAge
+	s.jsLimits = javascript.Limits{MaxStackDepth: mc.JSMaxStackDepth, MaxDuration: mc.JSMaxDuration, MaxMemory: mc.JSMaxMemory}
+	s.parsedQueuePolicy = mc.ParsedQueuePolicy
+	s.parsedQueueTimeout = mc.ParsedQueueTimeout
+	s.errLogger = logging.RateLimited(s.Logger, mc.LogRateLimitWindow, mc.LogRateLimitBurst)
 	s.kafkaConf = kc
+	s.serializer = model.NewJSONSerializer(kc.SerializationBufferMax)
 	s.parserEnv = decoders.NewParsersEnv(s.ParserConfigs, s.Logger)
+	var err error
+	s.transforms, err = transform.New(tc)
+	if err != nil {
+		return eerrors.Wrap(err, "Invalid transforms configuration")
+	}
+	return nil
 }
 
 func makeDRELPLogger(logger log15.Logger, raw *model.RawTCPMessage) log15.Logger {
@@ -397,15 +547,14 @@ func makeDRELPLogger(logger log15.Logger, raw *model.RawTCPMessage) log15.Logger
 }
 
 func (s *DirectRelpServiceImpl) parseOne(raw *model.RawTCPMessage) error {
+	start := time.Now()
+	checksum := base.Checksum(&raw.Decoder, raw.Message)
 	syslogMsgs, err := s.parserEnv.Parse(&raw.Decoder, raw.Message)
+	base.ObserveParseDuration(base.DirectRELP, raw.Decoder.Format, start)
 	if err != nil {
-		return err
-	}
-
-	if err != nil {
-		makeDRELPLogger(s.Logger, raw).Warn("Parsing error", "error", err)
-		s.forwarder.ForwardFail(raw.ConnID, raw.Txnr)
-		base.CountParsingError(base.DirectRELP, raw.Client, raw.Decoder.Format)
+		makeDRELPLogger(s.errLogger, raw).Warn("Parsing error", "error", err)
+		s.forwarder.ForwardFail(raw.ConnID, raw.Txnr, failParse)
+		base.CountParsingError(base.DirectRELP, raw.Client, raw.Decoder.Format, err)
 		// TODO
 		return nil
 	}
@@ -414,6 +563,18 @@ func (s *DirectRelpServiceImpl) parseOne(raw *model.RawTCPMessage) error {
 		if syslogMsg == nil {
 			continue
 		}
+		if !base.NormalizeTime(base.DirectRELP, syslogMsg, &raw.Decoder) {
+			model.Free(syslogMsg)
+			s.forwarder.ForwardSucc(raw.ConnID, raw.Txnr)
+			continue
+		}
+		if raw.Decoder.QuarantineAnswer == "nack" && decoders.Quarantined(syslogMsg) {
+			// the first answer wins: the ACK of the quarantined message
+			// by Kafka will be ignored
+			s.forwarder.ForwardFail(raw.ConnID, raw.Txnr, failParse)
+		}
+		base.NormalizeHostname(syslogMsg, &raw.Decoder)
+		base.ObserveFieldSizes(base.DirectRELP, &raw.RawMessage, syslogMsg)
 
 		full := model.FullFactoryFrom(syslogMsg)
 		full.SourceType = "directrelp"
@@ -423,31 +584,91 @@ func (s *DirectRelpServiceImpl) parseOne(raw *model.RawTCPMessage) error {
 		full.Txnr = raw.Txnr
 		full.ConfId = raw.ConfID
 		full.ConnId = raw.ConnID
-		err = s.parsedMessagesQueue.Put(full)
+		full.TimeReceivedNum = raw.Received.UnixNano()
+		base.SetChecksum(full, checksum)
+		if raw.Seq > 0 {
+			ordering.Stamp(full.Fields, raw.ConnID.String(), raw.Seq)
+		}
+		queued, err := s.putParsed(full)
 		if err != nil {
 			return err
 		}
+		if !queued {
+			// push2kafka lags behind: let the client send the message again
+			parsedQueueFullCounter.Inc()
+			s.forwarder.ForwardFail(raw.ConnID, raw.Txnr, failOverload)
+			model.FullFree(full)
+			return nil
+		}
 	}
 	return nil
 }
 
-func (s *DirectRelpServiceImpl) parse() {
+// putParsed pushes the message to the queue of the parsed messages. With the
+// "nack" policy, it returns false when the queue stays full for longer than
+// parsedQueueTimeout.
+func (s *DirectRelpServiceImpl) putParsed(full *model.FullMessage) (bool, error) {
+	if s.parsedQueuePolicy != "nack" {
+		return true, s.parsedMessagesQueue.Put(full)
+	}
+	timer := time.NewTimer(s.parsedQueueTimeout)
+	defer timer.Stop()
+	woken := false
 	for {
-		raw, err := s.rawQ.Get()
-		if raw == nil || err != nil {
-			return
+		queued, err := s.parsedMessagesQueue.Offer(full)
+		if queued || err != nil {
+			if queued && woken && s.parsedMessagesQueue.Len() < s.parsedMessagesQueue.Cap() {
+				// the signals of several takes may have been merged: pass
+				// it on to the next waiting parser
+				s.signalParsedRoom()
+			}
+			return queued, err
+		}
+		// a message taken after the Offer is not missed: the signal stays
+		// in the buffer of parsedRoom
+		select {
+		case <-s.parsedRoom:
+			woken = true
+		case <-timer.C:
+			return false, nil
 		}
-		err = s.parseOne(raw)
-		model.RawTCPFree(raw)
+	}
+}
+
+// signalParsedRoom wakes up a parser waiting for room in the parsed queue.
+func (s *DirectRelpServiceImpl) signalParsedRoom() {
+	select {
+	case s.parsedRoom <- struct{}{}:
+	default:
+	}
+}
+
+func (s *DirectRelpServiceImpl) parse(q *tcp.Ring) {
+	batch := make([]*model.RawTCPMessage, parseBatchSize(s.BatchSize))
+	for {
+		n, err := q.GetBatch(batch)
 		if err != nil {
 			return
 		}
+		for i, raw := range batch[:n] {
+			batch[i] = nil
+			if raw == nil {
+				return
+			}
+			s.stats.begin(s.rawQ.Len() + s.orderedQs.len())
+			err = s.parseOne(raw)
+			model.RawTCPFree(raw)
+			s.stats.end()
+			if err != nil {
+				return
+			}
+		}
 	}
 }
 
-func (s *DirectRelpServiceImpl) handleKafkaResponses() {
-	kafkaSuccChan := s.producer.Successes()
-	kafkaFailChan := s.producer.Errors()
+func (s *DirectRelpServiceImpl) handleKafkaResponses(producer sarama.AsyncProducer) {
+	kafkaSuccChan := producer.Successes()
+	kafkaFailChan := producer.Errors()
 	for {
 		if kafkaSuccChan == nil && kafkaFailChan == nil {
 			return
@@ -456,15 +677,22 @@ func (s *DirectRelpServiceImpl) handleKafkaResponses() {
 		case succ, more := <-kafkaSuccChan:
 			if more {
 				metad := succ.Metadata.(meta)
-				s.forwarder.ForwardSucc(metad.ConnID, metad.Txnr)
+				kafkaClusterAnswersCounter.WithLabelValues(metad.Cluster, "ack").Inc()
+				if metad.Fanout == nil || metad.Fanout.ack() {
+					s.forwarder.ForwardSucc(metad.ConnID, metad.Txnr)
+				}
 			} else {
 				kafkaSuccChan = nil
 			}
 		case fail, more := <-kafkaFailChan:
 			if more {
 				metad := fail.Msg.Metadata.(meta)
-				s.forwarder.ForwardFail(metad.ConnID, metad.Txnr)
-				s.Logger.Info("NACK from Kafka", "error", fail.Error(), "txnr", metad.Txnr, "topic", fail.Msg.Topic)
+				kafkaClusterAnswersCounter.WithLabelValues(metad.Cluster, "nack").Inc()
+				if metad.Fanout == nil || metad.Fanout.nack() {
+					s.forwarder.ForwardFail(metad.ConnID, metad.Txnr, failKafka)
+				}
+				s.errLogger.Info("NACK from Kafka", "error", fail.Error(), "txnr", metad.Txnr, "topic", fail.Msg.Topic, "cluster", metad.Cluster)
+				recenterrors.Add("directrelp", recenterrors.Nack, fail)
 				if model.IsFatalKafkaError(fail.Err) {
 					s.StopAndWait()
 				}
@@ -475,37 +703,24 @@ func (s *DirectRelpServiceImpl) handleKafkaResponses() {
 	}
 }
 
-func (s *DirectRelpServiceImpl) handleResponses(conn net.Conn, connID utils.MyULID, client string, logger log15.Logger) error {
-	successes := map[int32]bool{}
-	failures := map[int32]bool{}
+func (s *DirectRelpServiceImpl) handleResponses(conn net.Conn, connID utils.MyULID, client *atomic.String, logger log15.Logger) error {
+	answers := newRelpPendingAnswers()
+	responses := &relpResponses{conn: conn}
 	var err error
-	var ok1, ok2 bool
 	var next = int32(-1)
 
 	for {
-		txnrSuccess, txnrFailure := s.forwarder.GetSuccAndFail(connID)
+		txnrSuccess, failure := s.forwarder.GetSuccAndFail(connID)
 
-		if txnrSuccess == -1 && txnrFailure == -1 {
+		if txnrSuccess == -1 && failure.Txnr == -1 {
 			return io.EOF
 		}
 
-		if txnrSuccess != -1 {
-			//logger.Debug("New success to report to client", "txnr", currentTxnr)
-			_, ok1 = successes[txnrSuccess]
-			_, ok2 = failures[txnrSuccess]
-			if !ok1 && !ok2 {
-				successes[txnrSuccess] = true
-			}
-		}
-
-		if txnrFailure != -1 {
-			//logger.Debug("New failure to report to client", "txnr", currentTxnr)
-			_, ok1 = successes[txnrFailure]
-			_, ok2 = failures[txnrFailure]
-			if !ok1 && !ok2 {
-				failures[txnrFailure] = true
-			}
+		if failure.Reason == relpAbortMarker {
+			next = s.forwarder.aborted(connID, failure.Txnr, next, answers, &responses.buf)
+			failure.Txnr = -1
 		}
+		answers.add(txnrSuccess, failure)
 
 		// rsyslog expects the ACK/txnr correctly and monotonously ordered
 		// so we need a bit of cooking to ensure that
@@ -517,30 +732,32 @@ func (s *DirectRelpServiceImpl) handleResponses(conn net.Conn, connID utils.MyUL
 			if next == -1 {
 				break Cooking
 			}
-			if successes[next] {
-				err = writeSuccess(conn, next)
-				if err == nil {
-					successes[next] = false
-					countRelpAnswer(client, 200)
-					ackCounter.WithLabelValues("directrelp", "ack").Inc()
-				}
-			} else if failures[next] {
-				err = writeFailure(conn, next)
-				if err == nil {
-					failures[next] = false
-					countRelpAnswer(client, 500)
-					ackCounter.WithLabelValues("directrelp", "nack").Inc()
-				}
-			} else {
+			reason, success, ok := answers.take(next)
+			if !ok {
 				break Cooking
 			}
+			if success {
+				_ = writeSuccess(&responses.buf, next)
+				s.forwarder.Answered(connID, next)
+				countRelpAnswer(client.Load(), 200)
+				ackCounter.WithLabelValues("directrelp", "ack").Inc()
+			} else {
+				_ = writeFailure(&responses.buf, next, reason)
+				s.forwarder.Answered(connID, next)
+				countRelpAnswer(client.Load(), 500)
+				ackCounter.WithLabelValues("directrelp", "nack").Inc()
+			}
+			next = -1
+		}
 
+		for responses.ready(s.forwarder.Pending(connID)) {
+			err = responses.flush()
 			if err == nil {
-				next = -1
+				break
 			} else if err == io.EOF {
 				return io.EOF
 			} else if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
-				logger.Info("Timeout error writing RELP response to client", "error", err)
+				s.errLogger.Info("Timeout error writing RELP response to client", "client", client.Load(), "error", err)
 			} else {
 				return eerrors.Wrap(err, "Unexpected error writing Direct RELP response to client")
 			}
@@ -549,7 +766,12 @@ func (s *DirectRelpServiceImpl) handleResponses(conn net.Conn, connID utils.MyUL
 }
 
 func (s *DirectRelpServiceImpl) push2kafka() {
-	defer s.producer.AsyncClose()
+	defer func() {
+		s.producer.AsyncClose()
+		for _, cl := range s.clusters {
+			cl.producer.AsyncClose()
+		}
+	}()
 	envs := map[utils.MyULID]*javascript.Environment{}
 
 	for {
@@ -557,6 +779,7 @@ func (s *DirectRelpServiceImpl) push2kafka() {
 		if message == nil || err != nil {
 			return
 		}
+		s.signalParsedRoom()
 		s.pushOne(message, &envs)
 	}
 }
@@ -565,11 +788,18 @@ func (s *DirectRelpServiceImpl) pushOne(message *model.FullMessage, envs *map[ut
 	defer model.FullFree(message)
 	var err error
 
+	if message.Expired(s.maxMessageAge, time.Now()) {
+		s.forwarder.ForwardFail(message.ConnId, message.Txnr, failExpired)
+		expiredCounter.WithLabelValues("directkafka").Inc()
+		return
+	}
+	s.transforms.Apply(message.Fields)
+
 	e, haveEnv := (*envs)[message.ConfId]
 	if !haveEnv {
 		config, haveConfig := s.configs[message.ConfId]
 		if !haveConfig {
-			s.Logger.Warn("Could not find the configuration for a message", "confId", message.ConfId, "txnr", message.Txnr)
+			s.errLogger.Warn("Could not find the configuration for a message", "confId", message.ConfId, "txnr", message.Txnr)
 			return
 		}
 		(*envs)[message.ConfId] = javascript.NewFilterEnvironment(
@@ -581,69 +811,123 @@ func (s *DirectRelpServiceImpl) pushOne(message *model.FullMessage, envs *map[ut
 			config.PartitionNumberFunc,
 			s.Logger,
 		)
+		(*envs)[message.ConfId].SetLimits(s.jsLimits)
+		(*envs)[message.ConfId].SetQuarantineTopic(config.QuarantineTopic)
 		e = (*envs)[message.ConfId]
 	}
 
 	topic, joinedErr := e.Topic(message.Fields)
 	if joinedErr != nil {
-		s.Logger.Info("Error calculating topic", "error", joinedErr.Error(), "txnr", message.Txnr)
+		if javascript.IsResourceLimitError(joinedErr) {
+			s.rejectJSLimit(message, joinedErr)
+			return
+		}
+		s.errLogger.Info("Error calculating topic", "error", joinedErr.Error(), "txnr", message.Txnr)
 	}
 	if len(topic) == 0 {
-		s.Logger.Warn("Topic or PartitionKey could not be calculated", "txnr", message.Txnr)
-		s.forwarder.ForwardFail(message.ConnId, message.Txnr)
+		s.errLogger.Warn("Topic or PartitionKey could not be calculated", "txnr", message.Txnr)
+		s.forwarder.ForwardFail(message.ConnId, message.Txnr, failTopic)
 		return
 	}
 	partitionKey, joinedErr := e.PartitionKey(message.Fields)
 	if joinedErr != nil {
-		s.Logger.Info("Error calculating the partition key", "error", joinedErr.Error(), "txnr", message.Txnr)
+		if javascript.IsResourceLimitError(joinedErr) {
+			s.rejectJSLimit(message, joinedErr)
+			return
+		}
+		s.errLogger.Info("Error calculating the partition key", "error", joinedErr.Error(), "txnr", message.Txnr)
 	}
-	partitionNumber, joinedErr := e.PartitionNumber(message.Fields)
+	partitions := int32(0)
+	if e.HasPartitionNumber() && s.partitions != nil {
+		// the partition counts of the main cluster
+		partitions = s.partitions.Get(topic)
+	}
+	partitionNumber, joinedErr := e.PartitionNumber(message.Fields, partitions)
 	if joinedErr != nil {
-		s.Logger.Info("Error calculating the partition number", "error", joinedErr.Error(), "txnr", message.Txnr)
+		if javascript.IsResourceLimitError(joinedErr) {
+			s.rejectJSLimit(message, joinedErr)
+			return
+		}
+		s.errLogger.Info("Error calculating the partition number", "error", joinedErr.Error(), "txnr", message.Txnr)
 	}
 
 	filterResult, err := e.FilterMessage(message.Fields)
+	if javascript.IsResourceLimitError(err) {
+		s.rejectJSLimit(message, err)
+		return
+	}
 	if err != nil {
-		s.Logger.Warn("Error happened filtering message", "error", err)
+		s.errLogger.Warn("Error happened filtering message", "error", err)
 		return
 	}
 
 	switch filterResult {
 	case javascript.DROPPED:
-		s.forwarder.ForwardFail(message.ConnId, message.Txnr)
+		s.forwarder.ForwardFail(message.ConnId, message.Txnr, failDropped)
 		messageFilterCounter.WithLabelValues("dropped", message.Fields.GetProperty("skewer", "client"), "directkafka").Inc()
 		return
 	case javascript.REJECTED:
-		s.forwarder.ForwardFail(message.ConnId, message.Txnr)
+		s.forwarder.ForwardFail(message.ConnId, message.Txnr, failRejected)
 		messageFilterCounter.WithLabelValues("rejected", message.Fields.GetProperty("skewer", "client"), "directkafka").Inc()
 		return
 	case javascript.PASS:
 		messageFilterCounter.WithLabelValues("passing", message.Fields.GetProperty("skewer", "client"), "directkafka").Inc()
 	default:
-		s.forwarder.ForwardFail(message.ConnId, message.Txnr)
+		s.forwarder.ForwardFail(message.ConnId, message.Txnr, failFilter)
 		messageFilterCounter.WithLabelValues("unknown", message.Fields.GetProperty("skewer", "client"), "directkafka").Inc()
-		s.Logger.Warn("Error happened processing message", "txnr", message.Txnr, "error", err)
+		s.errLogger.Warn("Error happened processing message", "txnr", message.Txnr, "error", err)
 		return
 	}
 
-	serialized, err := message.Fields.RegularJSON()
+	if topic == javascript.NullTopic {
+		// routed to the null destination: the client gets a success
+		s.forwarder.ForwardSucc(message.ConnId, message.Txnr)
+		discardedCounter.WithLabelValues("directkafka").Inc()
+		return
+	}
+
+	s.ordering.Take(message)
+	serialized, err := s.serializer.Serialize(message.Fields)
 
 	if err != nil {
-		s.Logger.Warn("Error generating Kafka message", "error", err, "txnr", message.Txnr)
-		s.forwarder.ForwardFail(message.ConnId, message.Txnr)
+		s.errLogger.Warn("Error generating Kafka message", "error", err, "txnr", message.Txnr)
+		s.forwarder.ForwardFail(message.ConnId, message.Txnr, failEncoding)
 		return
 	}
 
+	if len(s.kafkaConf.KeySDID) > 0 {
+		if key := message.Fields.GetProperty(s.kafkaConf.KeySDID, s.kafkaConf.KeySDParam); len(key) > 0 {
+			partitionKey = key
+		}
+	}
+
+	headers := message.KafkaHeaders(s.kafkaConf.SDHeaders)
+	if len(s.kafkaConf.ChecksumHeader) > 0 && len(message.Checksum) > 0 {
+		headers = append(headers, sarama.RecordHeader{
+			Key:   []byte(s.kafkaConf.ChecksumHeader),
+			Value: []byte(message.Checksum),
+		})
+	}
+
 	kafkaMsg := &sarama.ProducerMessage{
 		Key:       sarama.StringEncoder(partitionKey),
 		Partition: partitionNumber,
 		Value:     sarama.ByteEncoder(serialized),
 		Topic:     topic,
-		Timestamp: message.Fields.GetTimeReported(),
-		Metadata:  meta{Txnr: message.Txnr, ConnID: message.ConnId},
+		Timestamp: message.Timestamp(s.kafkaConf.TimestampSource),
+		Headers:   headers,
 	}
 
-	s.producer.Input() <- kafkaMsg
+	s.ordering.Check(message)
+	s.produce(kafkaMsg, meta{Txnr: message.Txnr, ConnID: message.ConnId}, message.Fields)
+}
+
+// rejectJSLimit rejects a message for which a JS function was interrupted
+// because it exceeded the resource limits.
+func (s *DirectRelpServiceImpl) rejectJSLimit(message *model.FullMessage, err error) {
+	s.forwarder.ForwardFail(message.ConnId, message.Txnr, failFilter)
+	jsLimitCounter.WithLabelValues("directkafka", javascript.LimitReason(err)).Inc()
+	s.errLogger.Warn("A JS function exceeded the resource limits, the message is rejected", "txnr", message.Txnr)
 }
 
 type DirectRelpHandler struct {
@@ -655,32 +939,64 @@ func (h DirectRelpHandler) HandleConnection(conn net.Conn, c conf.TCPSourceConfi
 	s := h.Server
 	s.AddConnection(conn)
 	connID := s.forwarder.AddConn(s.QueueSize)
+	rawQ := s.rawQ
+	if config.OrderedParsing && len(s.orderedQs) > 0 {
+		rawQ = s.orderedQs.get(connID)
+	}
 	props := eprops(conn)
+	props.ClientID = atomic.NewString(props.Client)
+	props.ClientIDOffer = config.ClientIDOffer
+	props.OpenOffers = config.OpenOffers
+	props.EmptyFrames = config.EmptyFrames
+	props.OfferMismatch = config.OfferMismatch
+	props.Sequenced = s.OrderingCheck
+	props.BatchSize = s.BatchSize
+	props.MaxPendingAnswers = config.MaxPendingAnswers
+	props.ReplayGracePeriod = config.ReplayGracePeriod
 	l := makeLogger(s.Logger, props, "directrelp")
-	l.Info("New client")
-	defer l.Debug("Client gone away")
+	connLog := s.connLog(l, c)
+	connLog.opened()
+	defer connLog.closed()
 	clientCounter(base.DirectRELP, props)
+	session := newRelpSession(conn, config.ConfID, props)
+	s.sessions.add(connID, session)
+	defer s.sessions.remove(connID)
 
 	var wg sync.WaitGroup
+	responsesDone := make(chan struct{})
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		err := s.handleResponses(conn, connID, props.Client, l)
+		defer close(responsesDone)
+		err := s.handleResponses(conn, connID, props.ClientID, l)
 		if err != nil && !eerrors.HasFileClosed(err) {
 			s.Logger.Warn("Unexpected error in Direct RELP handleResponses", "error", err, "connID", connID.String())
 		}
+		// no more response can be sent: close the connection, so that
+		// scan returns and the forwarder forgets the connection. A
+		// draining session is closed after the serverclose.
+		if !session.isDraining() {
+			s.RemoveConnection(conn)
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		session.drain(s.forwarder, connID, responsesDone, func() { s.RemoveConnection(conn) })
 	}()
 
 	wg.Add(1)
 	go func() {
 		defer func() {
+			session.scanReturned()
 			s.forwarder.RemoveConn(connID) // this makes handleResponses return
 			s.RemoveConnection(conn)
 			wg.Done()
 		}()
-		err := scan(l, s.forwarder, s.rawQ, conn, config.Timeout, config.ConfID, connID, s.MaxMessageSize, config.DecoderBaseConfig, props)
-		if err != nil && !eerrors.HasFileClosed(err) {
+		err := scan(l, s.forwarder, rawQ, session, config.Timeout, config.ConfID, connID, s.MaxMessageSize, config.DecoderBaseConfig, props)
+		if err != nil && !eerrors.HasFileClosed(err) && !session.isDraining() {
 			rerr = eerrors.Wrapf(err, "Error scanning Direct RELP stream: %s", connID.String())
 		}
 	}()
@@ -0,0 +1,846 @@
+package network
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/decoders"
+	"github.com/stephane-martin/skewer/javascript"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/services/base"
+	"github.com/stephane-martin/skewer/utils"
+	"github.com/stephane-martin/skewer/utils/queue/message"
+	"github.com/stephane-martin/skewer/utils/queue/tcp"
+)
+
+type fakeProducer struct {
+	input     chan *sarama.ProducerMessage
+	successes chan *sarama.ProducerMessage
+	errors    chan *sarama.ProducerError
+}
+
+func newFakeProducer(size int) *fakeProducer {
+	return &fakeProducer{
+		input:     make(chan *sarama.ProducerMessage, size),
+		successes: make(chan *sarama.ProducerMessage),
+		errors:    make(chan *sarama.ProducerError),
+	}
+}
+
+func (p *fakeProducer) AsyncClose()                               {}
+func (p *fakeProducer) Close() error                              { return nil }
+func (p *fakeProducer) Input() chan<- *sarama.ProducerMessage     { return p.input }
+func (p *fakeProducer) Successes() <-chan *sarama.ProducerMessage { return p.successes }
+func (p *fakeProducer) Errors() <-chan *sarama.ProducerError      { return p.errors }
+
+func TestDirectRelpOrderedParsing(t *testing.T) {
+	const nbConns = 8
+	const nbMsgs = 200
+
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	gen := utils.NewGenerator()
+	confID := gen.Uid()
+
+	initDirectRelpRegistry()
+	s := NewDirectRelpServiceImpl(false, nil, nil, logger)
+	s.configs[confID] = conf.DirectRELPSourceConfig{
+		FilterSubConfig: conf.FilterSubConfig{TopicTmpl: "test"},
+		OrderedParsing:  true,
+	}
+	s.parserEnv = decoders.NewParsersEnv(nil, logger)
+	s.parsedMessagesQueue = message.NewRing(1024)
+	s.rawQ = tcp.NewRing(1024)
+	s.orderedQs = newOrderedQueues(4, 1024)
+	s.stats = newParseStats(base.DirectRELP, len(s.orderedQs))
+	producer := newFakeProducer(nbConns * nbMsgs)
+	s.producer = producer
+
+	var wg sync.WaitGroup
+	for _, q := range s.orderedQs {
+		wg.Add(1)
+		go func(q *tcp.Ring) {
+			defer wg.Done()
+			s.parse(q)
+		}(q)
+	}
+	pushed := make(chan struct{})
+	go func() {
+		s.push2kafka()
+		close(pushed)
+	}()
+
+	connIDs := make([]utils.MyULID, 0, nbConns)
+	for i := 0; i < nbConns; i++ {
+		connIDs = append(connIDs, gen.Uid())
+	}
+	// interleave the connections, as the listeners would
+	for txnr := 1; txnr <= nbMsgs; txnr++ {
+		for _, connID := range connIDs {
+			raw := model.RawTCPFactory([]byte(fmt.Sprintf("<13>1 2018-01-01T00:00:00Z host app - - - message %d", txnr)))
+			raw.Decoder = conf.DecoderBaseConfig{Format: "rfc5424", Charset: "utf8"}
+			raw.ConfID = confID
+			raw.ConnID = connID
+			raw.Txnr = int32(txnr)
+			err := s.orderedQs.get(connID).Put(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	last := make(map[utils.MyULID]int32, nbConns)
+	timeout := time.After(5 * time.Second)
+	for i := 0; i < nbConns*nbMsgs; i++ {
+		select {
+		case msg := <-producer.input:
+			metad := msg.Metadata.(meta)
+			if metad.Txnr != last[metad.ConnID]+1 {
+				t.Fatalf("connection %s: produced txnr %d after %d", metad.ConnID, metad.Txnr, last[metad.ConnID])
+			}
+			last[metad.ConnID] = metad.Txnr
+		case <-timeout:
+			t.Fatalf("only %d messages were produced", i)
+		}
+	}
+
+	s.orderedQs.dispose()
+	wg.Wait()
+	s.parsedMessagesQueue.Dispose()
+	<-pushed
+}
+
+func TestDirectRelpExpiredMessages(t *testing.T) {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	gen := utils.NewGenerator()
+	confID := gen.Uid()
+
+	initDirectRelpRegistry()
+	s := NewDirectRelpServiceImpl(false, nil, nil, logger)
+	s.configs[confID] = conf.DirectRELPSourceConfig{
+		FilterSubConfig: conf.FilterSubConfig{TopicTmpl: "test"},
+	}
+	s.maxMessageAge = 50 * time.Millisecond
+	s.parserEnv = decoders.NewParsersEnv(nil, logger)
+	s.parsedMessagesQueue = message.NewRing(16)
+	producer := newFakeProducer(16)
+	s.producer = producer
+	connID := s.forwarder.AddConn(16)
+	defer s.forwarder.RemoveAll()
+
+	decoder := conf.DecoderBaseConfig{Format: "rfc3164", Charset: "utf8"}
+	factory := makeRawTCPFactory(tcpProps{Client: "localhost"}, confID, decoder)
+	envs := map[utils.MyULID]*javascript.Environment{}
+
+	parseAndPush := func(raw *model.RawTCPMessage, delay time.Duration) {
+		raw.ConnID = connID
+		err := s.parseOne(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		full, err := s.parsedMessagesQueue.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// artificial queueing delay between the reception and the delivery
+		time.Sleep(delay)
+		s.pushOne(full, &envs)
+	}
+
+	stale := factory([]byte("<13>Jan  1 00:00:00 host app: stale message"))
+	stale.Txnr = 1
+	parseAndPush(stale, 100*time.Millisecond)
+	_, failure := s.forwarder.GetSuccAndFail(connID)
+	if failure.Txnr != 1 || failure.Reason != failExpired {
+		t.Fatalf("expected txnr 1 to fail as expired, got %+v", failure)
+	}
+	if len(producer.input) != 0 {
+		t.Fatal("an expired message was sent to kafka")
+	}
+
+	fresh := factory([]byte("<13>Jan  1 00:00:00 host app: fresh message"))
+	fresh.Txnr = 2
+	parseAndPush(fresh, 0)
+	select {
+	case msg := <-producer.input:
+		if msg.Metadata.(meta).Txnr != 2 {
+			t.Fatalf("unexpected txnr %d", msg.Metadata.(meta).Txnr)
+		}
+	default:
+		t.Fatal("the fresh message was not sent to kafka")
+	}
+}
+
+func TestDirectRelpKeyFromStructuredData(t *testing.T) {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	gen := utils.NewGenerator()
+	confID := gen.Uid()
+
+	initDirectRelpRegistry()
+	s := NewDirectRelpServiceImpl(false, nil, nil, logger)
+	s.configs[confID] = conf.DirectRELPSourceConfig{
+		FilterSubConfig: conf.FilterSubConfig{TopicTmpl: "test", PartitionTmpl: "{{.HostName}}"},
+	}
+	s.kafkaConf.KeySDID = "meta@32473"
+	s.kafkaConf.KeySDParam = "msgid"
+	s.parserEnv = decoders.NewParsersEnv(nil, logger)
+	s.parsedMessagesQueue = message.NewRing(16)
+	producer := newFakeProducer(16)
+	s.producer = producer
+	connID := s.forwarder.AddConn(16)
+	defer s.forwarder.RemoveAll()
+
+	decoder := conf.DecoderBaseConfig{Format: "rfc5424", Charset: "utf8"}
+	factory := makeRawTCPFactory(tcpProps{Client: "localhost"}, confID, decoder)
+	envs := map[utils.MyULID]*javascript.Environment{}
+
+	keyOf := func(txnr int32, msg string) string {
+		raw := factory([]byte(msg))
+		raw.ConnID = connID
+		raw.Txnr = txnr
+		err := s.parseOne(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		full, err := s.parsedMessagesQueue.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.pushOne(full, &envs)
+		select {
+		case produced := <-producer.input:
+			key, _ := produced.Key.Encode()
+			return string(key)
+		default:
+			t.Fatal("the message was not sent to kafka")
+		}
+		return ""
+	}
+
+	key := keyOf(1, `<13>1 2018-01-01T00:00:00Z host app - - [meta@32473 msgid="order-42"] with a message id`)
+	if key != "order-42" {
+		t.Fatalf("the key does not come from the structured data: %q", key)
+	}
+	// without the field, the partition key template applies
+	key = keyOf(2, `<13>1 2018-01-01T00:00:00Z host app - - - without a message id`)
+	if key != "host" {
+		t.Fatalf("the key does not come from the partition key template: %q", key)
+	}
+}
+
+func TestDirectRelpHeadersFromStructuredData(t *testing.T) {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	gen := utils.NewGenerator()
+	confID := gen.Uid()
+
+	initDirectRelpRegistry()
+	s := NewDirectRelpServiceImpl(false, nil, nil, logger)
+	s.configs[confID] = conf.DirectRELPSourceConfig{
+		FilterSubConfig: conf.FilterSubConfig{TopicTmpl: "test"},
+	}
+	s.kafkaConf.SDHeaders = []conf.KafkaSDHeaderConfig{
+		{SDID: "meta@32473", SDParam: "tenant", Header: "x-tenant"},
+		{SDID: "meta@32473", SDParam: "region", Header: "region"},
+	}
+	s.parserEnv = decoders.NewParsersEnv(nil, logger)
+	s.parsedMessagesQueue = message.NewRing(16)
+	producer := newFakeProducer(16)
+	s.producer = producer
+	connID := s.forwarder.AddConn(16)
+	defer s.forwarder.RemoveAll()
+
+	decoder := conf.DecoderBaseConfig{Format: "rfc5424", Charset: "utf8"}
+	factory := makeRawTCPFactory(tcpProps{Client: "localhost"}, confID, decoder)
+	envs := map[utils.MyULID]*javascript.Environment{}
+
+	headersOf := func(txnr int32, msg string) map[string]string {
+		raw := factory([]byte(msg))
+		raw.ConnID = connID
+		raw.Txnr = txnr
+		err := s.parseOne(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		full, err := s.parsedMessagesQueue.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.pushOne(full, &envs)
+		headers := map[string]string{}
+		select {
+		case produced := <-producer.input:
+			for _, h := range produced.Headers {
+				headers[string(h.Key)] = string(h.Value)
+			}
+		default:
+			t.Fatal("the message was not sent to kafka")
+		}
+		return headers
+	}
+
+	headers := headersOf(1, `<13>1 2018-01-01T00:00:00Z host app - - [meta@32473 tenant="acme"] with a tenant`)
+	if len(headers) != 1 || headers["x-tenant"] != "acme" {
+		t.Fatalf("the tenant was not promoted to a header: %v", headers)
+	}
+	// the absent fields are not promoted
+	headers = headersOf(2, `<13>1 2018-01-01T00:00:00Z host app - - - without structured data`)
+	if len(headers) != 0 {
+		t.Fatalf("unexpected headers: %v", headers)
+	}
+}
+
+func TestDirectRelpParsedQueueFull(t *testing.T) {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	gen := utils.NewGenerator()
+	confID := gen.Uid()
+
+	initDirectRelpRegistry()
+	s := NewDirectRelpServiceImpl(false, nil, nil, logger)
+	s.parserEnv = decoders.NewParsersEnv(nil, logger)
+	// push2kafka is stalled: nothing consumes the parsed messages
+	s.parsedMessagesQueue = message.NewRing(2)
+	s.parsedQueuePolicy = "nack"
+	s.parsedQueueTimeout = 10 * time.Millisecond
+	connID := s.forwarder.AddConn(16)
+	defer s.forwarder.RemoveAll()
+
+	decoder := conf.DecoderBaseConfig{Format: "rfc3164", Charset: "utf8"}
+	factory := makeRawTCPFactory(tcpProps{Client: "localhost"}, confID, decoder)
+
+	capacity := int32(s.parsedMessagesQueue.Cap())
+	for txnr := int32(1); txnr <= capacity+1; txnr++ {
+		raw := factory([]byte(fmt.Sprintf("<13>Jan  1 00:00:00 host app: message %d", txnr)))
+		raw.ConnID = connID
+		raw.Txnr = txnr
+		start := time.Now()
+		err := s.parseOne(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if time.Since(start) > time.Second {
+			t.Fatal("parseOne blocked on the full queue")
+		}
+	}
+	_, failure := s.forwarder.GetSuccAndFail(connID)
+	if failure.Txnr != capacity+1 || failure.Reason != failOverload {
+		t.Fatalf("expected txnr %d to fail with a full queue, got %+v", capacity+1, failure)
+	}
+	if int32(s.parsedMessagesQueue.Len()) != capacity {
+		t.Fatalf("unexpected parsed queue length: %d", s.parsedMessagesQueue.Len())
+	}
+}
+
+func TestDirectRelpParsedQueueRoom(t *testing.T) {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	gen := utils.NewGenerator()
+	confID := gen.Uid()
+
+	initDirectRelpRegistry()
+	s := NewDirectRelpServiceImpl(false, nil, nil, logger)
+	s.parserEnv = decoders.NewParsersEnv(nil, logger)
+	s.parsedMessagesQueue = message.NewRing(2)
+	s.parsedQueuePolicy = "nack"
+	s.parsedQueueTimeout = time.Minute
+	connID := s.forwarder.AddConn(16)
+	defer s.forwarder.RemoveAll()
+
+	decoder := conf.DecoderBaseConfig{Format: "rfc3164", Charset: "utf8"}
+	factory := makeRawTCPFactory(tcpProps{Client: "localhost"}, confID, decoder)
+	parse := func(txnr int32) {
+		raw := factory([]byte(fmt.Sprintf("<13>Jan  1 00:00:00 host app: message %d", txnr)))
+		raw.ConnID = connID
+		raw.Txnr = txnr
+		err := s.parseOne(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	capacity := int32(s.parsedMessagesQueue.Cap())
+	for txnr := int32(1); txnr <= capacity; txnr++ {
+		parse(txnr)
+	}
+
+	// push2kafka takes a message while the parser waits for room
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		full, err := s.parsedMessagesQueue.Get()
+		if err == nil {
+			s.signalParsedRoom()
+			model.FullFree(full)
+		}
+	}()
+	start := time.Now()
+	parse(capacity + 1)
+	// the message would be NACKed after parsedQueueTimeout
+	if time.Since(start) > 10*time.Second {
+		t.Fatal("the parser was not woken up when room was made in the queue")
+	}
+	if int32(s.parsedMessagesQueue.Len()) != capacity {
+		t.Fatalf("unexpected parsed queue length: %d", s.parsedMessagesQueue.Len())
+	}
+}
+
+func TestDirectRelpKafkaTimestamp(t *testing.T) {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	gen := utils.NewGenerator()
+	confID := gen.Uid()
+
+	initDirectRelpRegistry()
+	s := NewDirectRelpServiceImpl(false, nil, nil, logger)
+	s.configs[confID] = conf.DirectRELPSourceConfig{
+		FilterSubConfig: conf.FilterSubConfig{TopicTmpl: "test"},
+	}
+	s.parserEnv = decoders.NewParsersEnv(nil, logger)
+	s.parsedMessagesQueue = message.NewRing(16)
+	producer := newFakeProducer(16)
+	s.producer = producer
+	connID := s.forwarder.AddConn(16)
+	defer s.forwarder.RemoveAll()
+
+	decoder := conf.DecoderBaseConfig{Format: "rfc5424", Charset: "utf8"}
+	factory := makeRawTCPFactory(tcpProps{Client: "localhost"}, confID, decoder)
+	envs := map[utils.MyULID]*javascript.Environment{}
+	reported := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	received := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for txnr, source := range []string{"reported", "received", "generated"} {
+		s.kafkaConf.TimestampSource = source
+		raw := factory([]byte("<13>1 2018-01-01T00:00:00Z host app - - - message"))
+		raw.ConnID = connID
+		raw.Txnr = int32(txnr + 1)
+		raw.Received = received
+		err := s.parseOne(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		full, err := s.parsedMessagesQueue.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := map[string]time.Time{
+			"reported":  reported,
+			"received":  received,
+			"generated": full.Fields.GetTimeGenerated(),
+		}[source]
+		s.pushOne(full, &envs)
+		select {
+		case produced := <-producer.input:
+			if !produced.Timestamp.Equal(expected) {
+				t.Errorf("%s: unexpected record timestamp %s, expected %s", source, produced.Timestamp, expected)
+			}
+		default:
+			t.Fatal("the message was not sent to kafka")
+		}
+	}
+}
+
+// TestDirectRelpEndToEnd drives a RELP session over a loopback connection,
+// through the parse workers and a mock Kafka producer, back to the RELP
+// answers. Kafka acknowledges the messages in reverse order: the answers must
+// still be sent in txnr order.
+func TestDirectRelpEndToEnd(t *testing.T) {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	gen := utils.NewGenerator()
+	confID := gen.Uid()
+	const nbMessages = 10
+
+	initDirectRelpRegistry()
+	s := NewDirectRelpServiceImpl(false, nil, nil, logger)
+	s.QueueSize = 64
+	s.MaxMessageSize = 65536
+	s.configs[confID] = conf.DirectRELPSourceConfig{
+		FilterSubConfig: conf.FilterSubConfig{TopicTmpl: "test"},
+	}
+	s.parserEnv = decoders.NewParsersEnv(nil, logger)
+	s.parsedMessagesQueue = message.NewRing(s.QueueSize)
+	s.rawQ = tcp.NewRing(s.QueueSize)
+	s.stats = newParseStats(base.DirectRELP, 1)
+	producer := newFakeProducer(nbMessages)
+	s.producer = producer
+
+	var workers sync.WaitGroup
+	for _, f := range []func(){func() { s.parse(s.rawQ) }, s.push2kafka, func() { s.handleKafkaResponses(producer) }} {
+		workers.Add(1)
+		go func(f func()) {
+			defer workers.Done()
+			f()
+		}(f)
+	}
+
+	// the mock Kafka acknowledges the messages in reverse order
+	go func() {
+		var produced []*sarama.ProducerMessage
+		for len(produced) < nbMessages {
+			produced = append(produced, <-producer.input)
+		}
+		for i := len(produced) - 1; i >= 0; i-- {
+			producer.successes <- produced[i]
+		}
+	}()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+	handled := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			handled <- err
+			return
+		}
+		handled <- DirectRelpHandler{Server: s}.HandleConnection(conn, conf.TCPSourceConfig{
+			ConfID:            confID,
+			DecoderBaseConfig: conf.DecoderBaseConfig{Format: "rfc5424", Charset: "utf8"},
+		})
+		_ = conn.Close()
+	}()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+	_ = client.SetDeadline(time.Now().Add(10 * time.Second))
+	answers := bufio.NewScanner(client)
+	answers.Split(utils.RelpSplit)
+	expect := func(expected string) {
+		if !answers.Scan() {
+			t.Fatalf("no answer, expected %q: %v", expected, answers.Err())
+		}
+		if !strings.HasPrefix(answers.Text(), expected) {
+			t.Fatalf("unexpected answer %q, expected %q", answers.Text(), expected)
+		}
+	}
+
+	offer := "relp_version=0\nrelp_software=test\ncommands=syslog"
+	fmt.Fprintf(client, "1 open %d %s\n", len(offer), offer)
+	expect("1 rsp 200 OK")
+	for txnr := 2; txnr < nbMessages+2; txnr++ {
+		msg := fmt.Sprintf("<13>1 2018-01-01T00:00:00Z host app - - - message %d", txnr)
+		fmt.Fprintf(client, "%d syslog %d %s\n", txnr, len(msg), msg)
+	}
+	for txnr := 2; txnr < nbMessages+2; txnr++ {
+		expect(fmt.Sprintf("%d rsp 200 OK", txnr))
+	}
+	fmt.Fprintf(client, "%d close 0\n", nbMessages+2)
+	expect(fmt.Sprintf("%d rsp", nbMessages+2))
+	expect("0 serverclose")
+
+	if err := <-handled; err != nil {
+		t.Fatalf("unexpected connection error: %v", err)
+	}
+	s.rawQ.Dispose()
+	s.parsedMessagesQueue.Dispose()
+	close(producer.successes)
+	close(producer.errors)
+	workers.Wait()
+}
+
+func TestDirectRelpChecksumEndToEnd(t *testing.T) {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	gen := utils.NewGenerator()
+	confID := gen.Uid()
+
+	// the parsers normalize these messages: the checksums must still be the
+	// ones of the bytes that were sent
+	sent := []string{
+		"<13>1 2018-01-01T00:00:00Z host app - - - plain message",
+		"<13>1 2018-01-01T00:00:00.000+00:00 host app 42 ID1 [meta@32473 k=\"v\"] trailing spaces   ",
+		"<13>1 2018-01-01T00:00:00Z host app - - - \xef\xbb\xbfUTF-8 message é\nsecond line",
+	}
+
+	initDirectRelpRegistry()
+	s := NewDirectRelpServiceImpl(false, nil, nil, logger)
+	s.QueueSize = 64
+	s.MaxMessageSize = 65536
+	s.configs[confID] = conf.DirectRELPSourceConfig{
+		FilterSubConfig: conf.FilterSubConfig{TopicTmpl: "test"},
+	}
+	s.kafkaConf.ChecksumHeader = "x-checksum"
+	s.parserEnv = decoders.NewParsersEnv(nil, logger)
+	s.parsedMessagesQueue = message.NewRing(s.QueueSize)
+	s.rawQ = tcp.NewRing(s.QueueSize)
+	s.stats = newParseStats(base.DirectRELP, 1)
+	producer := newFakeProducer(len(sent))
+	s.producer = producer
+
+	var workers sync.WaitGroup
+	for _, f := range []func(){func() { s.parse(s.rawQ) }, s.push2kafka, func() { s.handleKafkaResponses(producer) }} {
+		workers.Add(1)
+		go func(f func()) {
+			defer workers.Done()
+			f()
+		}(f)
+	}
+
+	records := make(chan *sarama.ProducerMessage, len(sent))
+	go func() {
+		for range sent {
+			m := <-producer.input
+			records <- m
+			producer.successes <- m
+		}
+	}()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+	handled := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			handled <- err
+			return
+		}
+		handled <- DirectRelpHandler{Server: s}.HandleConnection(conn, conf.TCPSourceConfig{
+			ConfID:            confID,
+			DecoderBaseConfig: conf.DecoderBaseConfig{Format: "rfc5424", Charset: "utf8", Checksum: "sha256"},
+		})
+		_ = conn.Close()
+	}()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+	_ = client.SetDeadline(time.Now().Add(10 * time.Second))
+	answers := bufio.NewScanner(client)
+	answers.Split(utils.RelpSplit)
+	expect := func(expected string) {
+		if !answers.Scan() {
+			t.Fatalf("no answer, expected %q: %v", expected, answers.Err())
+		}
+		if !strings.HasPrefix(answers.Text(), expected) {
+			t.Fatalf("unexpected answer %q, expected %q", answers.Text(), expected)
+		}
+	}
+
+	offer := "relp_version=0\nrelp_software=test\ncommands=syslog"
+	fmt.Fprintf(client, "1 open %d %s\n", len(offer), offer)
+	expect("1 rsp 200 OK")
+	expected := make(map[string]string, len(sent))
+	for i, msg := range sent {
+		sum := sha256.Sum256([]byte(msg))
+		expected["sha256:"+hex.EncodeToString(sum[:])] = msg
+		fmt.Fprintf(client, "%d syslog %d %s\n", i+2, len(msg), msg)
+	}
+	for i := range sent {
+		expect(fmt.Sprintf("%d rsp 200 OK", i+2))
+	}
+
+	for range sent {
+		var record *sarama.ProducerMessage
+		select {
+		case record = <-records:
+		case <-time.After(10 * time.Second):
+			t.Fatal("a message was not sent to Kafka")
+		}
+		var header string
+		for _, h := range record.Headers {
+			if string(h.Key) == "x-checksum" {
+				header = string(h.Value)
+			}
+		}
+		raw, ok := expected[header]
+		if !ok {
+			t.Fatalf("the checksum header %q does not match any sent message", header)
+		}
+		delete(expected, header)
+		value, err := record.Value.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var delivered model.RegularSyslog
+		err = json.Unmarshal(value, &delivered)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if delivered.Properties["skewer"]["checksum"] != header {
+			t.Errorf("the checksum of %q is not in the delivered message: %s", raw, value)
+		}
+	}
+
+	fmt.Fprintf(client, "%d close 0\n", len(sent)+2)
+	expect(fmt.Sprintf("%d rsp", len(sent)+2))
+	expect("0 serverclose")
+	if err := <-handled; err != nil {
+		t.Fatalf("unexpected connection error: %v", err)
+	}
+	s.rawQ.Dispose()
+	s.parsedMessagesQueue.Dispose()
+	close(producer.successes)
+	close(producer.errors)
+	workers.Wait()
+}
+
+func TestDirectRelpStructuredDataOnly(t *testing.T) {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	gen := utils.NewGenerator()
+	confID := gen.Uid()
+
+	initDirectRelpRegistry()
+	s := NewDirectRelpServiceImpl(false, nil, nil, logger)
+	s.configs[confID] = conf.DirectRELPSourceConfig{
+		FilterSubConfig: conf.FilterSubConfig{TopicTmpl: "test"},
+	}
+	s.parserEnv = decoders.NewParsersEnv(nil, logger)
+	s.parsedMessagesQueue = message.NewRing(16)
+	producer := newFakeProducer(16)
+	s.producer = producer
+	connID := s.forwarder.AddConn(16)
+	defer s.forwarder.RemoveAll()
+
+	decoder := conf.DecoderBaseConfig{Format: "rfc5424", Charset: "utf8", RFC5424Strict: true}
+	factory := makeRawTCPFactory(tcpProps{Client: "localhost"}, confID, decoder)
+	envs := map[utils.MyULID]*javascript.Environment{}
+
+	// RFC5424 allows a message without MSG: the structured data is the payload
+	raw := factory([]byte(`<13>1 2018-01-01T00:00:00Z host app - - [order@32473 id="42" status="paid"]`))
+	raw.ConnID = connID
+	raw.Txnr = 1
+	err := s.parseOne(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.parsedMessagesQueue.Len() != 1 {
+		t.Fatal("the message without MSG was dropped")
+	}
+	full, err := s.parsedMessagesQueue.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.pushOne(full, &envs)
+	select {
+	case produced := <-producer.input:
+		value, _ := produced.Value.Encode()
+		if !strings.Contains(string(value), `"order@32473"`) || !strings.Contains(string(value), `"paid"`) {
+			t.Fatalf("the structured data did not reach kafka: %s", value)
+		}
+	default:
+		t.Fatal("the message without MSG was not sent to kafka")
+	}
+}
+
+// fakePartitionsClient knows a fixed number of partitions for every topic.
+type fakePartitionsClient struct {
+	partitions int32
+}
+
+func (c *fakePartitionsClient) RefreshMetadata(topics ...string) error {
+	return nil
+}
+
+func (c *fakePartitionsClient) Partitions(topic string) ([]int32, error) {
+	return make([]int32, c.partitions), nil
+}
+
+func TestDirectRelpPartitionCount(t *testing.T) {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	gen := utils.NewGenerator()
+	confID := gen.Uid()
+
+	initDirectRelpRegistry()
+	s := NewDirectRelpServiceImpl(false, nil, nil, logger)
+	s.configs[confID] = conf.DirectRELPSourceConfig{
+		FilterSubConfig: conf.FilterSubConfig{
+			TopicTmpl:           "test",
+			PartitionNumberFunc: "function PartitionNumber(m, partitions) { return partitions - 1; }",
+		},
+	}
+	s.parserEnv = decoders.NewParsersEnv(nil, logger)
+	s.parsedMessagesQueue = message.NewRing(16)
+	producer := newFakeProducer(16)
+	s.producer = producer
+	client := &fakePartitionsClient{partitions: 4}
+	s.partitions = utils.NewPartitionCounts(logger, client)
+	stop := make(chan struct{})
+	defer close(stop)
+	go s.partitions.Run(0, stop)
+	connID := s.forwarder.AddConn(16)
+	defer s.forwarder.RemoveAll()
+
+	decoder := conf.DecoderBaseConfig{Format: "rfc5424", Charset: "utf8"}
+	factory := makeRawTCPFactory(tcpProps{Client: "localhost"}, confID, decoder)
+	envs := map[utils.MyULID]*javascript.Environment{}
+	push := func(txnr int32) int32 {
+		raw := factory([]byte("<13>1 2018-01-01T00:00:00Z host app - - - hello"))
+		raw.ConnID = connID
+		raw.Txnr = txnr
+		if err := s.parseOne(raw); err != nil {
+			t.Fatal(err)
+		}
+		full, err := s.parsedMessagesQueue.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.pushOne(full, &envs)
+		select {
+		case produced := <-producer.input:
+			return produced.Partition
+		default:
+			t.Fatal("the message was not sent to kafka")
+		}
+		return 0
+	}
+
+	// the count of the topic is fetched in the background after its first use
+	push(1)
+	deadline := time.Now().Add(5 * time.Second)
+	for s.partitions.Get("test") != 4 {
+		if time.Now().After(deadline) {
+			t.Fatal("the partition count was not fetched")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if partition := push(2); partition != 3 {
+		t.Fatalf("the partition function should get the partition count: partition %d", partition)
+	}
+
+	client.partitions = 8
+	s.partitions.Refresh()
+	if partition := push(3); partition != 7 {
+		t.Fatalf("the partition function should get the refreshed count: partition %d", partition)
+	}
+}
+
+func TestDirectRelpInvalidTransforms(t *testing.T) {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	initDirectRelpRegistry()
+	tc := []conf.TransformConfig{{Op: conf.TransformRedact, Field: "message", Pattern: "(unclosed"}}
+
+	s := NewDirectRelpServiceImpl(false, nil, nil, logger)
+	if err := s.SetConf(nil, nil, conf.KafkaDestConfig{}, conf.MainConfig{}, tc); err == nil {
+		t.Fatal("the invalid transforms should be rejected")
+	}
+	svc := &DirectRelpService{logger: logger, tc: tc}
+	if _, err := svc.Start(); err == nil {
+		t.Fatal("the service should not start with invalid transforms")
+	}
+}
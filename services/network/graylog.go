@@ -77,6 +77,7 @@ func (s *GraylogSvcImpl) Type() base.Types {
 
 func (s *GraylogSvcImpl) SetConf(c conf.BaseConfig) {
 	s.Configs = c.GraylogSource
+	s.BindRetryPeriod = c.Main.BindRetryPeriod
 }
 
 func (s *GraylogSvcImpl) Gather() ([]*dto.MetricFamily, error) {
@@ -129,9 +130,14 @@ func (s *GraylogSvcImpl) Stop() {
 func (s *GraylogSvcImpl) ListenPacket() []model.ListenerInfo {
 	infos := []model.ListenerInfo{}
 	s.UnixSocketPaths = []string{}
+	retrier := newBindRetrier(base.Types2Names[base.Graylog], s.BindRetryPeriod, s.Logger)
 	for _, syslogConf := range s.Configs {
 		if len(syslogConf.UnixSocketPath) > 0 {
-			conn, err := s.Binder.ListenPacket("unixgram", syslogConf.UnixSocketPath, 65536)
+			var conn net.PacketConn
+			err := retrier.bind(syslogConf.UnixSocketPath, func() (err error) {
+				conn, err = s.Binder.ListenPacket("unixgram", syslogConf.UnixSocketPath, 65536)
+				return err
+			})
 			if err != nil {
 				s.Logger.Warn("Listen unixgram error", "error", err)
 			} else {
@@ -152,7 +158,11 @@ func (s *GraylogSvcImpl) ListenPacket() []model.ListenerInfo {
 		} else {
 			listenAddrs, _ := syslogConf.GetListenAddrs()
 			for port, listenAddr := range listenAddrs {
-				conn, err := s.Binder.ListenPacket("udp", listenAddr, 65536)
+				var conn net.PacketConn
+				err := retrier.bind(listenAddr, func() (err error) {
+					conn, err = s.Binder.ListenPacket("udp", listenAddr, 65536)
+					return err
+				})
 				if err != nil {
 					s.Logger.Warn("Listen UDP error", "error", err)
 				} else {
@@ -164,9 +174,10 @@ func (s *GraylogSvcImpl) ListenPacket() []model.ListenerInfo {
 						"format", syslogConf.Format,
 					)
 					infos = append(infos, model.ListenerInfo{
-						BindAddr: syslogConf.BindAddr,
-						Port:     port,
-						Protocol: "graylog",
+						BindAddr:  syslogConf.ResolvedBindAddr(),
+						Interface: syslogConf.BindInterface,
+						Port:      port,
+						Protocol:  "graylog",
 					})
 					s.wg.Add(1)
 					go s.handleConnection(conn, syslogConf)
@@ -273,10 +284,15 @@ func (s *GraylogSvcImpl) handleConnection(conn net.PacketConn, config conf.Grayl
 		}
 
 		if err != nil {
-			base.CountParsingError(base.Graylog, client, "graylog")
+			base.CountParsingError(base.Graylog, client, "graylog", err)
 			logger.Warn("Error decoding full GELF message", "error", err)
 			continue
 		}
+		if !base.NormalizeTime(base.Graylog, full.Fields, &config.DecoderBaseConfig) {
+			model.FullFree(full)
+			continue
+		}
+		base.NormalizeHostname(full.Fields, &config.DecoderBaseConfig)
 
 		full.Uid = gen.Uid()
 		full.ConfId = config.ConfID
@@ -430,7 +430,7 @@ func (s *HTTPServiceImpl) parse() error {
 		err = s.parseAndEnqueue(gen, raw)
 		if err != nil {
 			s.fail(raw.ConnID)
-			base.CountParsingError(base.HTTPServer, raw.Client, raw.Decoder.Format)
+			base.CountParsingError(base.HTTPServer, raw.Client, raw.Decoder.Format, err)
 			logg(s.logger, &raw.RawMessage).Warn(err.Error())
 		} else {
 			s.done(raw.ConnID)
@@ -469,6 +469,7 @@ func (s *HTTPServiceImpl) parseAndEnqueue(gen *utils.Generator, raw *model.RawTC
 }
 
 func (s *HTTPServiceImpl) parseOne(raw *model.RawTCPMessage) (fulls []*model.FullMessage, err error) {
+	checksum := base.Checksum(&raw.Decoder, raw.Message)
 	syslogMsgs, err := s.parserEnv.Parse(&raw.Decoder, raw.Message)
 	if err != nil {
 		return nil, err
@@ -482,12 +483,18 @@ func (s *HTTPServiceImpl) parseOne(raw *model.RawTCPMessage) (fulls []*model.Ful
 		if syslogMsg == nil {
 			continue
 		}
+		if !base.NormalizeTime(base.HTTPServer, syslogMsg, &raw.Decoder) {
+			model.Free(syslogMsg)
+			continue
+		}
+		base.NormalizeHostname(syslogMsg, &raw.Decoder)
 		full := model.FullFactoryFrom(syslogMsg)
 		full.SourceType = "httpserver"
 		full.SourcePort = int32(raw.LocalPort)
 		full.ClientAddr = raw.Client
 		full.ConfId = raw.ConfID
 		full.ConnId = raw.ConnID
+		base.SetChecksum(full, checksum)
 		fulls = append(fulls, full)
 	}
 	return fulls, nil
@@ -26,10 +26,19 @@ import (
 )
 
 var incomingByteRate *prometheus.GaugeVec
+var kafkaCommittedOffsetGauge *prometheus.GaugeVec
 
 func initKafkaRegistry() {
 	base.Once.Do(func() {
 		base.InitRegistry()
+		kafkaCommittedOffsetGauge = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "skw_kafka_source_committed_offset",
+				Help: "offset of the next message to consume, as stored by the consumer group",
+			},
+			[]string{"group", "topic", "partition"},
+		)
+		base.Registry.MustRegister(kafkaCommittedOffsetGauge)
 	})
 }
 
@@ -68,6 +77,7 @@ type KafkaServiceImpl struct {
 	fatalErrorChan   chan struct{}
 	fatalOnce        *sync.Once
 	confined         bool
+	consumers        sync.Map // ack queue ID -> *kafkaConsumer
 }
 
 func NewKafkaService(env *base.ProviderEnv) (base.Provider, error) {
@@ -213,7 +223,7 @@ func (s *KafkaServiceImpl) parse() (err error) {
 		}
 		err = s.parseOne(raw)
 		if err != nil {
-			base.CountParsingError(base.KafkaSource, raw.Client, raw.Decoder.Format)
+			base.CountParsingError(base.KafkaSource, raw.Client, raw.Decoder.Format, err)
 			logg(s.logger, &raw.RawMessage).Warn(err.Error())
 			if eerrors.IsFatal(err) {
 				freeRawKafka(raw)
@@ -231,6 +241,7 @@ func (s *KafkaServiceImpl) parse() (err error) {
 }
 
 func (s *KafkaServiceImpl) parseOne(raw *model.RawKafkaMessage) (err error) {
+	checksum := base.Checksum(&raw.Decoder, raw.Message)
 	syslogMsgs, err := s.parserEnv.Parse(&raw.Decoder, raw.Message)
 	if err != nil {
 		return err
@@ -240,11 +251,17 @@ func (s *KafkaServiceImpl) parseOne(raw *model.RawKafkaMessage) (err error) {
 		if syslogMsg == nil {
 			continue
 		}
+		if !base.NormalizeTime(base.KafkaSource, syslogMsg, &raw.Decoder) {
+			model.Free(syslogMsg)
+			continue
+		}
+		base.NormalizeHostname(syslogMsg, &raw.Decoder)
 		full := model.FullFactoryFrom(syslogMsg)
 		full.Uid = raw.UID
 		full.ConfId = raw.ConfID
 		full.SourceType = "kafka"
 		full.ClientAddr = raw.Client
+		base.SetChecksum(full, checksum)
 		err := s.reporter.Stash(full)
 		model.FullFree(full)
 
@@ -293,6 +310,10 @@ func (s *KafkaServiceImpl) handleConsumer(ctx context.Context, config conf.Kafka
 		consumer.Close()
 	}()
 
+	kc := &kafkaConsumer{config: config, consumer: consumer, cancel: lcancel}
+	s.consumers.Store(ackQueue.ID(), kc)
+	defer s.consumers.Delete(ackQueue.ID())
+
 	wg.Add(1)
 	// ack messages to kafka when needed
 	// the goroutine returns eventually after the consumer has been closed
@@ -318,12 +339,21 @@ func (s *KafkaServiceImpl) handleConsumer(ctx context.Context, config conf.Kafka
 			if !ok {
 				next = ack.Offset
 			}
+			kc.mu.Lock()
+			if kc.seeking {
+				// the consumer is being moved: the messages of the old
+				// position must not move the offsets anymore
+				kc.mu.Unlock()
+				continue
+			}
 			for processedMsgs[ack.TopicPartition][next] {
 				delete(processedMsgs[ack.TopicPartition], next)
 				consumer.MarkPartitionOffset(ack.Topic, ack.Partition, next, "")
 				next++
 				nextToACK[ack.TopicPartition] = next
 			}
+			kc.setCommittedGauge(ack.Topic, ack.Partition, next)
+			kc.mu.Unlock()
 		}
 	}()
 
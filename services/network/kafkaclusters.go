@@ -0,0 +1,136 @@
+package network
+
+import (
+	sarama "github.com/Shopify/sarama"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/transform"
+	"go.uber.org/atomic"
+)
+
+var kafkaClusterAnswersCounter *prometheus.CounterVec
+
+func newKafkaClusterAnswersCounter() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "skw_directrelp_kafka_answers_total",
+			Help: "number of acknowledgments from the Kafka clusters, by cluster and status",
+		},
+		[]string{"cluster", "status"},
+	)
+}
+
+// kafkaCluster is an additional Kafka cluster of the direct RELP service.
+type kafkaCluster struct {
+	id       string
+	producer sarama.AsyncProducer
+	topics   map[string]bool
+	values   map[string]bool
+}
+
+func newKafkaClusters(c conf.KafkaDestConfig, producers map[string]sarama.AsyncProducer) []*kafkaCluster {
+	clusters := make([]*kafkaCluster, 0, len(c.Clusters))
+	for _, cl := range c.Clusters {
+		kc := &kafkaCluster{
+			id:       cl.ID,
+			producer: producers[cl.ID],
+			topics:   make(map[string]bool, len(cl.Topics)),
+			values:   make(map[string]bool, len(cl.Values)),
+		}
+		for _, topic := range cl.Topics {
+			kc.topics[topic] = true
+		}
+		for _, value := range cl.Values {
+			kc.values[value] = true
+		}
+		clusters = append(clusters, kc)
+	}
+	return clusters
+}
+
+// kafkaFanout tracks the answers of the clusters for a message sent to
+// several clusters. The client gets a success when needed clusters have
+// acknowledged the message, or a failure as soon as that is not possible
+// anymore.
+type kafkaFanout struct {
+	needed int32
+	total  int32
+	acks   atomic.Int32
+	nacks  atomic.Int32
+	done   atomic.Bool
+}
+
+func newKafkaFanout(total, needed int) *kafkaFanout {
+	if needed <= 0 || needed > total {
+		needed = total
+	}
+	return &kafkaFanout{needed: int32(needed), total: int32(total)}
+}
+
+// ack records an acknowledgment. It returns true once, when the quorum is
+// reached.
+func (f *kafkaFanout) ack() bool {
+	return f.acks.Inc() == f.needed && f.done.CAS(false, true)
+}
+
+// nack records a failure. It returns true once, when the quorum can not be
+// reached anymore.
+func (f *kafkaFanout) nack() bool {
+	return f.nacks.Inc() == f.total-f.needed+1 && f.done.CAS(false, true)
+}
+
+// route returns the additional clusters of a message, and whether the
+// message goes to the primary cluster.
+func (s *DirectRelpServiceImpl) route(topic string, m *model.SyslogMessage) ([]*kafkaCluster, bool) {
+	if len(s.clusters) == 0 {
+		return nil, true
+	}
+	var clusters []*kafkaCluster
+	switch s.kafkaConf.Routing {
+	case conf.KafkaRouteTopic:
+		for _, cl := range s.clusters {
+			if cl.topics[topic] {
+				clusters = append(clusters, cl)
+			}
+		}
+	case conf.KafkaRouteField:
+		value, _ := transform.Get(m, s.kafkaConf.RouteField)
+		for _, cl := range s.clusters {
+			if cl.values[value] {
+				clusters = append(clusters, cl)
+			}
+		}
+	default:
+		return s.clusters, true
+	}
+	return clusters, len(clusters) == 0
+}
+
+// produce sends the message to its Kafka clusters.
+func (s *DirectRelpServiceImpl) produce(kafkaMsg *sarama.ProducerMessage, md meta, fields *model.SyslogMessage) {
+	clusters, primary := s.route(kafkaMsg.Topic, fields)
+	total := len(clusters)
+	if primary {
+		total++
+	}
+	if total > 1 {
+		needed := total
+		if s.kafkaConf.Routing == conf.KafkaRouteAll || s.kafkaConf.Routing == "" {
+			needed = s.kafkaConf.Quorum
+		}
+		md.Fanout = newKafkaFanout(total, needed)
+	}
+	for _, cl := range clusters {
+		clusterMsg := *kafkaMsg
+		clusterMeta := md
+		clusterMeta.Cluster = cl.id
+		clusterMsg.Metadata = clusterMeta
+		cl.producer.Input() <- &clusterMsg
+	}
+	if primary {
+		md.Cluster = s.kafkaConf.ClusterID
+		kafkaMsg.Metadata = md
+		s.producer.Input() <- kafkaMsg
+	}
+}
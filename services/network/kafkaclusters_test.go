@@ -0,0 +1,113 @@
+package network
+
+import (
+	"testing"
+
+	sarama "github.com/Shopify/sarama"
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+)
+
+func TestKafkaFanout(t *testing.T) {
+	// 2 acknowledgments out of 3 clusters
+	f := newKafkaFanout(3, 2)
+	if f.ack() || f.nack() {
+		t.Fatal("the quorum is not decided yet")
+	}
+	if !f.ack() {
+		t.Fatal("the quorum is reached")
+	}
+	if f.nack() {
+		t.Fatal("the message was already answered")
+	}
+
+	// all the clusters: the first failure fails the message
+	f = newKafkaFanout(2, 0)
+	if !f.nack() {
+		t.Fatal("the quorum can not be reached anymore")
+	}
+	if f.ack() || f.ack() {
+		t.Fatal("the message was already answered")
+	}
+}
+
+func TestDirectRelpKafkaClusters(t *testing.T) {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	initDirectRelpRegistry()
+	s := NewDirectRelpServiceImpl(false, nil, nil, logger)
+	primary := newFakeProducer(16)
+	dr := newFakeProducer(16)
+	s.producer = primary
+	s.kafkaConf.ClusterID = "primary"
+	s.kafkaConf.Clusters = []conf.KafkaClusterConfig{{ID: "dr", Topics: []string{"audit"}, Values: []string{"sshd"}}}
+	s.clusters = newKafkaClusters(s.kafkaConf, map[string]sarama.AsyncProducer{"dr": dr})
+	connID := s.forwarder.AddConn(16)
+	defer s.forwarder.RemoveAll()
+
+	fields := model.Factory()
+	fields.AppName = "sshd"
+	produce := func(topic string, txnr int32) {
+		s.produce(&sarama.ProducerMessage{Topic: topic}, meta{Txnr: txnr, ConnID: connID}, fields)
+	}
+	received := func(p *fakeProducer) *sarama.ProducerMessage {
+		select {
+		case msg := <-p.input:
+			return msg
+		default:
+			return nil
+		}
+	}
+
+	s.kafkaConf.Routing = conf.KafkaRouteTopic
+	produce("audit", 1)
+	if msg := received(dr); msg == nil || msg.Metadata.(meta).Cluster != "dr" || msg.Metadata.(meta).Fanout != nil {
+		t.Fatal("the audit topic should be routed to the dr cluster only")
+	}
+	if received(primary) != nil {
+		t.Fatal("the audit topic should not be sent to the primary cluster")
+	}
+	produce("app", 2)
+	if received(primary) == nil || received(dr) != nil {
+		t.Fatal("the other topics should be routed to the primary cluster")
+	}
+
+	s.kafkaConf.Routing = conf.KafkaRouteField
+	s.kafkaConf.RouteField = "appname"
+	produce("app", 3)
+	if received(dr) == nil || received(primary) != nil {
+		t.Fatal("the sshd messages should be routed to the dr cluster")
+	}
+
+	// fan-out to all the clusters, with a quorum of 1
+	s.kafkaConf.Routing = conf.KafkaRouteAll
+	s.kafkaConf.Quorum = 1
+	produce("app", 4)
+	msg1, msg2 := received(primary), received(dr)
+	if msg1 == nil || msg2 == nil {
+		t.Fatal("the message should be sent to all the clusters")
+	}
+	fanout := msg1.Metadata.(meta).Fanout
+	if fanout == nil || fanout != msg2.Metadata.(meta).Fanout || fanout.needed != 1 || fanout.total != 2 {
+		t.Fatal("the clusters should share the quorum of the message")
+	}
+
+	// the dr cluster fails, the primary one acknowledges: the client gets
+	// a success
+	done := make(chan struct{})
+	go func() {
+		s.handleKafkaResponses(dr)
+		close(done)
+	}()
+	dr.errors <- &sarama.ProducerError{Msg: msg2, Err: sarama.ErrNotLeaderForPartition}
+	go s.handleKafkaResponses(primary)
+	primary.successes <- msg1
+	success, failure := s.forwarder.GetSuccAndFail(connID)
+	if success != 4 || failure.Txnr != -1 {
+		t.Fatalf("expected a success for txnr 4, got %d and %+v", success, failure)
+	}
+	close(dr.successes)
+	close(dr.errors)
+	<-done
+}
@@ -0,0 +1,181 @@
+package network
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	cluster "github.com/bsm/sarama-cluster"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/services/base"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// kafkaConsumer is a running consumer of a Kafka source.
+type kafkaConsumer struct {
+	config   conf.KafkaSourceConfig
+	consumer *cluster.Consumer
+	cancel   func()
+	// mu serializes the marking of the processed offsets and the seeks
+	mu      sync.Mutex
+	seeking bool
+}
+
+func (kc *kafkaConsumer) setCommittedGauge(topic string, partition int32, next int64) {
+	kafkaCommittedOffsetGauge.WithLabelValues(
+		kc.config.GroupID, topic, strconv.FormatInt(int64(partition), 10),
+	).Set(float64(next))
+}
+
+func (kc *kafkaConsumer) consumes(req base.SeekRequest) bool {
+	if len(req.GroupID) > 0 && req.GroupID != kc.config.GroupID {
+		return false
+	}
+	for _, topic := range kc.config.Topics {
+		if topic == req.Topic {
+			return true
+		}
+	}
+	return false
+}
+
+// seekPartitions returns the partitions that the request targets, among
+// the partitions that are assigned to the consumer.
+func seekPartitions(req base.SeekRequest, assigned []int32) ([]int32, error) {
+	if len(req.Partitions) == 0 {
+		if len(assigned) == 0 {
+			return nil, eerrors.Errorf("No partition of topic '%s' is assigned to the consumer", req.Topic)
+		}
+		return assigned, nil
+	}
+	for _, p := range req.Partitions {
+		found := false
+		for _, a := range assigned {
+			if a == p {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, eerrors.Errorf("Partition %d of topic '%s' is not assigned to the consumer", p, req.Topic)
+		}
+	}
+	return req.Partitions, nil
+}
+
+// targetOffsets resolves the offsets of the next messages to consume.
+func (kc *kafkaConsumer) targetOffsets(req base.SeekRequest, partitions []int32, confined bool) (map[int32]int64, error) {
+	offsets := make(map[int32]int64, len(partitions))
+	if req.Position == base.SeekOffset {
+		for _, p := range partitions {
+			offsets[p] = req.Offset
+		}
+		return offsets, nil
+	}
+	cconf, err := kc.config.GetSaramaConsumerConfig(confined)
+	if err != nil {
+		return nil, err
+	}
+	client, err := sarama.NewClient(kc.config.Brokers, &cconf.Config)
+	if err != nil {
+		return nil, eerrors.Wrap(err, "Failed to connect to the Kafka cluster")
+	}
+	defer func() { _ = client.Close() }()
+
+	for _, p := range partitions {
+		var offset int64
+		switch req.Position {
+		case base.SeekBeginning:
+			offset, err = client.GetOffset(req.Topic, p, sarama.OffsetOldest)
+		case base.SeekEnd:
+			offset, err = client.GetOffset(req.Topic, p, sarama.OffsetNewest)
+		case base.SeekTimestamp:
+			offset, err = client.GetOffset(req.Topic, p, req.Timestamp.UnixNano()/int64(time.Millisecond))
+			if err == nil && offset < 0 {
+				// no message after the timestamp
+				offset, err = client.GetOffset(req.Topic, p, sarama.OffsetNewest)
+			}
+		}
+		if err != nil {
+			return nil, eerrors.Wrapf(err, "Failed to get the offset of partition %d of topic '%s'", p, req.Topic)
+		}
+		offsets[p] = offset
+	}
+	return offsets, nil
+}
+
+// seek commits the new offsets and restarts the consumer, so that it
+// resumes from them. The messages of the old position that are still being
+// processed are not acknowledged anymore: they are delivered (at least
+// once), but they don't move the offsets.
+func (kc *kafkaConsumer) seek(topic string, offsets map[int32]int64) error {
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+	if kc.seeking {
+		return eerrors.New("A seek is already in progress")
+	}
+	kc.seeking = true
+	for p, offset := range offsets {
+		// the consumer stores "offset + 1" as the next offset to consume.
+		// ResetPartitionOffset only moves backwards, MarkPartitionOffset only
+		// moves forwards.
+		kc.consumer.ResetPartitionOffset(topic, p, offset-1, "")
+		kc.consumer.MarkPartitionOffset(topic, p, offset-1, "")
+	}
+	err := kc.consumer.CommitOffsets()
+	// the consumer is restarted even if the commit failed, as the offsets
+	// are committed again when the consumer is closed
+	kc.cancel()
+	if err != nil {
+		return eerrors.Wrap(err, "Failed to commit the new offsets")
+	}
+	for p, offset := range offsets {
+		kc.setCommittedGauge(topic, p, offset)
+	}
+	return nil
+}
+
+func (kc *kafkaConsumer) seekRequest(req base.SeekRequest, confined bool) error {
+	partitions, err := seekPartitions(req, kc.consumer.Subscriptions()[req.Topic])
+	if err != nil {
+		return err
+	}
+	offsets, err := kc.targetOffsets(req, partitions, confined)
+	if err != nil {
+		return err
+	}
+	return kc.seek(req.Topic, offsets)
+}
+
+// Seek moves the consumers of the Kafka source to another position of a
+// topic, without restarting the plugin. Only the partitions that are
+// assigned to the local consumers can be moved: when the consumer group has
+// other members, the seek has to be requested on each of them.
+func (s *KafkaServiceImpl) Seek(req base.SeekRequest) error {
+	err := req.Validate()
+	if err != nil {
+		return err
+	}
+	var consumers []*kafkaConsumer
+	s.consumers.Range(func(_, v interface{}) bool {
+		kc := v.(*kafkaConsumer)
+		if kc.consumes(req) {
+			consumers = append(consumers, kc)
+		}
+		return true
+	})
+	if len(consumers) == 0 {
+		return eerrors.Errorf("No running Kafka consumer for topic '%s'", req.Topic)
+	}
+	var errs []error
+	for _, kc := range consumers {
+		err := kc.seekRequest(req, s.confined)
+		if err != nil {
+			errs = append(errs, eerrors.Wrapf(err, "Seek failed for group '%s'", kc.config.GroupID))
+			continue
+		}
+		s.logger.Info("Kafka consumer has been moved", "group", kc.config.GroupID, "topic", req.Topic, "position", req.Position)
+	}
+	return eerrors.Combine(errs...)
+}
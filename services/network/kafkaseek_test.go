@@ -0,0 +1,54 @@
+package network
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stephane-martin/skewer/services/base"
+)
+
+func TestSeekRequestValidate(t *testing.T) {
+	valid := []base.SeekRequest{
+		{Topic: "logs", Position: base.SeekBeginning},
+		{Topic: "logs", Position: base.SeekEnd},
+		{Topic: "logs", Position: base.SeekOffset, Offset: 42},
+		{Topic: "logs", Position: base.SeekTimestamp, Timestamp: time.Now()},
+	}
+	for _, req := range valid {
+		if err := req.Validate(); err != nil {
+			t.Errorf("%+v: unexpected error: %s", req, err)
+		}
+	}
+	invalid := []base.SeekRequest{
+		{Position: base.SeekBeginning},
+		{Topic: "logs", Position: "middle"},
+		{Topic: "logs", Position: base.SeekOffset, Offset: -1},
+		{Topic: "logs", Position: base.SeekTimestamp},
+	}
+	for _, req := range invalid {
+		if err := req.Validate(); err == nil {
+			t.Errorf("%+v: expected a validation error", req)
+		}
+	}
+}
+
+func TestSeekPartitions(t *testing.T) {
+	assigned := []int32{0, 2, 3}
+
+	partitions, err := seekPartitions(base.SeekRequest{Topic: "logs"}, assigned)
+	if err != nil || len(partitions) != 3 {
+		t.Fatalf("all the assigned partitions should be selected: %v %v", partitions, err)
+	}
+	partitions, err = seekPartitions(base.SeekRequest{Topic: "logs", Partitions: []int32{2}}, assigned)
+	if err != nil || len(partitions) != 1 || partitions[0] != 2 {
+		t.Fatalf("unexpected partitions: %v %v", partitions, err)
+	}
+	_, err = seekPartitions(base.SeekRequest{Topic: "logs", Partitions: []int32{1}}, assigned)
+	if err == nil {
+		t.Fatal("a partition that is not assigned should be rejected")
+	}
+	_, err = seekPartitions(base.SeekRequest{Topic: "logs"}, nil)
+	if err == nil {
+		t.Fatal("a topic without assigned partitions should be rejected")
+	}
+}
@@ -0,0 +1,59 @@
+package network
+
+import (
+	"hash/fnv"
+
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/utils"
+	"github.com/stephane-martin/skewer/utils/queue/tcp"
+)
+
+// orderedQueues shards the raw messages by connection. Each shard is
+// consumed by a single parser, so that the messages of a given connection
+// are parsed, and then forwarded, in the order they were received.
+type orderedQueues []*tcp.Ring
+
+func newOrderedQueues(n int, size uint64) orderedQueues {
+	if n <= 0 {
+		n = 1
+	}
+	q := make(orderedQueues, 0, n)
+	for i := 0; i < n; i++ {
+		q = append(q, tcp.NewRing(size))
+	}
+	return q
+}
+
+func (q orderedQueues) get(connID utils.MyULID) *tcp.Ring {
+	if len(q) == 0 {
+		return nil
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(connID))
+	return q[h.Sum32()%uint32(len(q))]
+}
+
+// len returns the number of messages waiting in the shards.
+func (q orderedQueues) len() (n uint64) {
+	for _, r := range q {
+		n += r.Len()
+	}
+	return n
+}
+
+func (q orderedQueues) dispose() {
+	for _, r := range q {
+		r.Dispose()
+	}
+}
+
+// hasOrderedListener tells whether at least one listener requires ordered
+// parsing.
+func hasOrderedListener(configs []conf.TCPSourceConfig) bool {
+	for _, c := range configs {
+		if c.OrderedParsing {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package network
+
+import (
+	"runtime"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stephane-martin/skewer/services/base"
+)
+
+// parseWorkers returns the number of parse workers to start.
+func parseWorkers(n int) int {
+	if n <= 0 {
+		return runtime.NumCPU()
+	}
+	return n
+}
+
+// parseStats reports the utilization of the parse workers of a network
+// service, and the depth of the queue they consume.
+type parseStats struct {
+	busy  prometheus.Gauge
+	depth prometheus.Gauge
+}
+
+func newParseStats(t base.Types, workers int) parseStats {
+	name := base.Types2Names[t]
+	base.ParseWorkersGauge.WithLabelValues(name).Set(float64(workers))
+	return parseStats{
+		busy:  base.ParseWorkersBusyGauge.WithLabelValues(name),
+		depth: base.ParseQueueDepthGauge.WithLabelValues(name),
+	}
+}
+
+// begin is called when a worker has dequeued a message. depth is the number
+// of messages still in the queue.
+func (p parseStats) begin(depth uint64) {
+	p.depth.Set(float64(depth))
+	p.busy.Inc()
+}
+
+// end is called when a worker has processed a message.
+func (p parseStats) end() {
+	p.busy.Dec()
+}
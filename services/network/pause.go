@@ -0,0 +1,166 @@
+package network
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stephane-martin/skewer/services/base"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// listenerPause blocks the accept loop and the connection reads of a
+// listener while it is paused. The sockets stay open, so the clients see
+// backpressure instead of a connection loss.
+type listenerPause struct {
+	mu      sync.Mutex
+	resumed chan struct{} // closed when the listener is not paused
+	gauge   prometheus.Gauge
+}
+
+func newListenerPause(gauge prometheus.Gauge) *listenerPause {
+	p := &listenerPause{resumed: make(chan struct{}), gauge: gauge}
+	close(p.resumed)
+	gauge.Set(0)
+	return p
+}
+
+func (p *listenerPause) pause() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-p.resumed:
+		p.resumed = make(chan struct{})
+		p.gauge.Set(1)
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *listenerPause) resume() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-p.resumed:
+		return false
+	default:
+		close(p.resumed)
+		p.gauge.Set(0)
+		return true
+	}
+}
+
+// wait blocks while the listener is paused. It returns true if it actually
+// had to wait, and returns early when done is closed.
+func (p *listenerPause) wait(done <-chan struct{}) bool {
+	p.mu.Lock()
+	resumed := p.resumed
+	p.mu.Unlock()
+	select {
+	case <-resumed:
+		return false
+	default:
+	}
+	select {
+	case <-resumed:
+	case <-done:
+	}
+	return true
+}
+
+// pausableConn is a connection whose reads wait while its listener is
+// paused. The data that was already read from the socket is still processed.
+type pausableConn struct {
+	net.Conn
+	pause     *listenerPause
+	timeout   time.Duration
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newPausableConn(conn net.Conn, pause *listenerPause, timeout time.Duration) *pausableConn {
+	return &pausableConn{
+		Conn:    conn,
+		pause:   pause,
+		timeout: timeout,
+		closed:  make(chan struct{}),
+	}
+}
+
+func (c *pausableConn) Read(b []byte) (int, error) {
+	if c.pause.wait(c.closed) && c.timeout > 0 {
+		// the read deadline was set before the pause
+		_ = c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *pausableConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return c.Conn.Close()
+}
+
+// getPause returns the pause control of the named listener. The controls are
+// kept across restarts, so that a paused listener stays paused after a
+// configuration reload.
+func (s *StreamingService) getPause(name string) *listenerPause {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+	p, ok := s.pauses[name]
+	if !ok {
+		p = newListenerPause(base.ListenerPausedGauge.WithLabelValues(base.Types2Names[s.typ], name))
+		s.pauses[name] = p
+	}
+	return p
+}
+
+func (s *StreamingService) listenerNames() (names []string) {
+	for _, l := range s.TCPListeners {
+		names = append(names, l.Name)
+	}
+	for _, l := range s.UnixListeners {
+		names = append(names, l.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *StreamingService) lookupPause(name string) (*listenerPause, error) {
+	names := s.listenerNames()
+	for _, n := range names {
+		if n == name {
+			return s.getPause(name), nil
+		}
+	}
+	return nil, eerrors.Errorf("Unknown listener '%s' (listeners: %s)", name, strings.Join(names, ", "))
+}
+
+// Pause stops reading new messages on the named listener. The listener is
+// named by its listen address (e.g. "127.0.0.1:2514") or its unix socket
+// path. The listening socket and the existing connections are kept open.
+func (s *StreamingService) Pause(name string) error {
+	p, err := s.lookupPause(name)
+	if err != nil {
+		return err
+	}
+	if p.pause() {
+		s.Logger.Info("Listener has been paused", "listener", name)
+	}
+	return nil
+}
+
+// Resume restarts reading messages on a paused listener.
+func (s *StreamingService) Resume(name string) error {
+	p, err := s.lookupPause(name)
+	if err != nil {
+		return err
+	}
+	if p.resume() {
+		s.Logger.Info("Listener has been resumed", "listener", name)
+	}
+	return nil
+}
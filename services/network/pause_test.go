@@ -0,0 +1,76 @@
+package network
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func gaugeValue(g prometheus.Gauge) float64 {
+	m := &dto.Metric{}
+	_ = g.Write(m)
+	return m.GetGauge().GetValue()
+}
+
+func TestPausableConn(t *testing.T) {
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "paused"})
+	pause := newListenerPause(gauge)
+	client, server := net.Pipe()
+	conn := newPausableConn(server, pause, 0)
+	defer func() { _ = client.Close() }()
+
+	if !pause.pause() || pause.pause() {
+		t.Fatal("pause() should only report a change of state")
+	}
+	if gaugeValue(gauge) != 1 {
+		t.Fatal("the gauge should report the paused state")
+	}
+
+	read := make(chan string)
+	go func() {
+		buf := make([]byte, 16)
+		n, _ := conn.Read(buf)
+		read <- string(buf[:n])
+	}()
+	go func() { _, _ = client.Write([]byte("hello")) }()
+
+	select {
+	case <-read:
+		t.Fatal("a paused connection should not read")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	pause.resume()
+	if gaugeValue(gauge) != 0 {
+		t.Fatal("the gauge should report the resumed state")
+	}
+	select {
+	case s := <-read:
+		if s != "hello" {
+			t.Fatalf("unexpected data: '%s'", s)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the resumed connection did not read")
+	}
+
+	// closing a paused connection unblocks the reader
+	pause.pause()
+	errs := make(chan error)
+	go func() {
+		_, err := conn.Read(make([]byte, 16))
+		errs <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	_ = conn.Close()
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Fatal("expected an error reading a closed connection")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("closing the connection did not unblock the paused reader")
+	}
+}
@@ -0,0 +1,105 @@
+package network
+
+import (
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/services/base"
+)
+
+// acceptThrottle pauses the accepts of all the stream listeners of the
+// process while it has too many goroutines or uses too much heap memory. It
+// is the last line of defense against a connection storm, before the per
+// listener caps. The readings are sampled periodically, so that the accepts
+// only check the state of the gate.
+type acceptThrottle struct {
+	mu            sync.Mutex
+	maxGoroutines int
+	maxMemory     uint64
+	interval      time.Duration
+	logger        log15.Logger
+	gate          *listenerPause
+}
+
+var throttle = &acceptThrottle{}
+
+// configure applies the thresholds of the configuration. The sampling
+// starts with the first threshold, and then runs for the process lifetime.
+func (t *acceptThrottle) configure(mc conf.MainConfig, logger log15.Logger) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.maxGoroutines = mc.AcceptMaxGoroutines
+	t.maxMemory = mc.AcceptMaxMemory
+	t.interval = mc.AcceptCheckInterval
+	if t.interval <= 0 {
+		t.interval = time.Second
+	}
+	t.logger = logger
+	if t.gate == nil && (t.maxGoroutines > 0 || t.maxMemory > 0) {
+		t.gate = newListenerPause(base.AcceptThrottledGauge)
+		go t.run()
+	}
+}
+
+func (t *acceptThrottle) run() {
+	for {
+		t.sample()
+		t.mu.Lock()
+		interval := t.interval
+		t.mu.Unlock()
+		time.Sleep(interval)
+	}
+}
+
+func (t *acceptThrottle) sample() {
+	t.mu.Lock()
+	measureMemory := t.maxMemory > 0
+	t.mu.Unlock()
+	var heap uint64
+	if measureMemory {
+		// ReadMemStats stops the world: it is only called when the memory
+		// threshold is set
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		heap = stats.HeapAlloc
+		base.HeapMemoryGauge.Set(float64(heap))
+	}
+	goroutines := runtime.NumGoroutine()
+	base.GoroutinesGauge.Set(float64(goroutines))
+	t.update(goroutines, heap)
+}
+
+// update pauses the accepts when a reading reaches its threshold, and
+// resumes them when both readings are below 90% of their threshold.
+func (t *acceptThrottle) update(goroutines int, heap uint64) {
+	t.mu.Lock()
+	maxG, maxM, logger, gate := t.maxGoroutines, t.maxMemory, t.logger, t.gate
+	t.mu.Unlock()
+	if gate == nil {
+		return
+	}
+	over := (maxG > 0 && goroutines >= maxG) || (maxM > 0 && heap >= maxM)
+	under := (maxG <= 0 || goroutines < maxG*9/10) && (maxM == 0 || heap < maxM/10*9)
+	if over {
+		if gate.pause() && logger != nil {
+			logger.Warn("Throttling the new connections", "goroutines", goroutines, "heap", heap)
+		}
+	} else if under {
+		if gate.resume() && logger != nil {
+			logger.Info("The new connections are accepted again", "goroutines", goroutines, "heap", heap)
+		}
+	}
+}
+
+// wait blocks while the accepts are throttled, or until done is closed.
+func (t *acceptThrottle) wait(done <-chan struct{}) {
+	t.mu.Lock()
+	gate := t.gate
+	t.mu.Unlock()
+	if gate != nil {
+		gate.wait(done)
+	}
+}
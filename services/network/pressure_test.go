@@ -0,0 +1,56 @@
+package network
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestAcceptThrottle(t *testing.T) {
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "throttled"})
+	th := &acceptThrottle{maxGoroutines: 100, maxMemory: 1000, gate: newListenerPause(gauge)}
+
+	accepted := func() bool {
+		done := make(chan struct{})
+		go func() {
+			th.wait(nil)
+			close(done)
+		}()
+		select {
+		case <-done:
+			return true
+		case <-time.After(50 * time.Millisecond):
+			return false
+		}
+	}
+
+	th.update(50, 500)
+	if !accepted() || gaugeValue(gauge) != 0 {
+		t.Fatal("the accepts should not be throttled under the thresholds")
+	}
+	th.update(100, 500)
+	if accepted() || gaugeValue(gauge) != 1 {
+		t.Fatal("the accepts should be throttled over the goroutines threshold")
+	}
+	// the accepts resume below 90% of both thresholds
+	th.update(95, 500)
+	if accepted() {
+		t.Fatal("the accepts should stay throttled above 90% of the threshold")
+	}
+	th.update(50, 1000)
+	if accepted() {
+		t.Fatal("the accepts should be throttled over the memory threshold")
+	}
+	th.update(50, 850)
+	if !accepted() || gaugeValue(gauge) != 0 {
+		t.Fatal("the accepts should resume when the pressure subsides")
+	}
+
+	// without a threshold, the accepts are never throttled
+	th = &acceptThrottle{}
+	th.update(1000000, 1<<40)
+	if !accepted() {
+		t.Fatal("the accepts should not be throttled without thresholds")
+	}
+}
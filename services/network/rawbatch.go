@@ -0,0 +1,92 @@
+package network
+
+import (
+	"io"
+
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+	"github.com/stephane-martin/skewer/utils/queue/tcp"
+)
+
+// rawBatch gathers the raw messages of a connection, so that they are pushed
+// to the raw messages queue together. The batch is flushed when it is full,
+// and before the connection waits for more data, so that the messages are
+// not delayed when the frame rate is low.
+type rawBatch struct {
+	q     *tcp.Ring
+	size  int
+	items []*model.RawTCPMessage
+}
+
+func newRawBatch(q *tcp.Ring, size int) *rawBatch {
+	if size < 1 {
+		size = 1
+	}
+	b := &rawBatch{q: q, size: size}
+	if size > 1 {
+		b.items = make([]*model.RawTCPMessage, 0, size)
+	}
+	return b
+}
+
+func (b *rawBatch) put(raw *model.RawTCPMessage) error {
+	if b.size == 1 {
+		err := b.q.Put(raw)
+		if err != nil {
+			return eerrors.Fatal(eerrors.Wrap(err, "Failed to enqueue new raw RELP message"))
+		}
+		return nil
+	}
+	b.items = append(b.items, raw)
+	if len(b.items) >= b.size {
+		return b.flush()
+	}
+	return nil
+}
+
+// flush pushes the pending raw messages to the queue.
+func (b *rawBatch) flush() error {
+	if len(b.items) == 0 {
+		return nil
+	}
+	_, err := b.q.PutBatch(b.items)
+	for i := range b.items {
+		b.items[i] = nil
+	}
+	b.items = b.items[:0]
+	if err != nil {
+		return eerrors.Fatal(eerrors.Wrap(err, "Failed to enqueue new raw RELP messages"))
+	}
+	return nil
+}
+
+// reader returns a reader that flushes the batch before reading from r. The
+// scanners only read when their buffered frames have been processed.
+func (b *rawBatch) reader(r io.Reader) io.Reader {
+	if b.size == 1 {
+		return r
+	}
+	return &flushReader{Reader: r, flush: b.flush}
+}
+
+type flushReader struct {
+	io.Reader
+	flush func() error
+}
+
+func (r *flushReader) Read(p []byte) (int, error) {
+	err := r.flush()
+	if err != nil {
+		return 0, err
+	}
+	return r.Reader.Read(p)
+}
+
+// parseBatchSize is the number of raw messages that a parser pulls from the
+// queue at once. The parser only takes the messages that are ready.
+func parseBatchSize(size int) int {
+	if size < 1 {
+		return 1
+	}
+	return size
+}
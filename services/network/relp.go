@@ -3,13 +3,15 @@ package network
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"io"
 	"net"
-	"runtime"
 	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/looplab/fsm"
@@ -23,19 +25,66 @@ import (
 	"github.com/stephane-martin/skewer/services/base"
 	"github.com/stephane-martin/skewer/utils"
 	"github.com/stephane-martin/skewer/utils/eerrors"
+	"github.com/stephane-martin/skewer/utils/logging"
+	"github.com/stephane-martin/skewer/utils/ordering"
+	"github.com/stephane-martin/skewer/utils/queue/failq"
 	"github.com/stephane-martin/skewer/utils/queue/intq"
 	"github.com/stephane-martin/skewer/utils/queue/tcp"
+	"github.com/stephane-martin/skewer/utils/recenterrors"
 	"github.com/stephane-martin/skewer/utils/waiter"
+	"go.uber.org/atomic"
 )
 
-var relpAnswersCounter *prometheus.CounterVec
-var relpProtocolErrorsCounter *prometheus.CounterVec
+var relpAnswersCounter *base.ExpiringCounterVec
+var relpProtocolErrorsCounter *base.ExpiringCounterVec
+var relpEmptyFramesCounter *base.ExpiringCounterVec
+var relpKeepalivesCounter *base.ExpiringCounterVec
+var relpLostCounter *base.ExpiringCounterVec
+var relpBacklogPausesCounter *base.ExpiringCounterVec
+
+func newRelpLostCounter() *base.ExpiringCounterVec {
+	return base.NewExpiringCounterVec(
+		prometheus.CounterOpts{
+			Name: "skw_relp_lost_transactions_total",
+			Help: "number of RELP transactions left unanswered because the connection was lost",
+		},
+		[]string{"cause", "client"},
+	)
+}
+
+func newRelpBacklogPausesCounter() *base.ExpiringCounterVec {
+	return base.NewExpiringCounterVec(
+		prometheus.CounterOpts{
+			Name: "skw_relp_backlog_pauses_total",
+			Help: "number of times a RELP connection stopped reading because it had max_pending_answers unanswered transactions",
+		},
+		[]string{"client"},
+	)
+}
+
+func newRelpEmptyFramesCounters() (empty, keepalives *base.ExpiringCounterVec) {
+	empty = base.NewExpiringCounterVec(
+		prometheus.CounterOpts{
+			Name: "skw_relp_empty_frames_total",
+			Help: "number of RELP syslog commands without data",
+		},
+		[]string{"client"},
+	)
+	keepalives = base.NewExpiringCounterVec(
+		prometheus.CounterOpts{
+			Name: "skw_relp_keepalives_total",
+			Help: "number of RELP syslog commands without data handled as keepalives",
+		},
+		[]string{"client"},
+	)
+	return empty, keepalives
+}
 
 func initRelpRegistry() {
 	base.Once.Do(func() {
 		base.InitRegistry()
 
-		relpAnswersCounter = prometheus.NewCounterVec(
+		relpAnswersCounter = base.NewExpiringCounterVec(
 			prometheus.CounterOpts{
 				Name: "skw_relp_answers_total",
 				Help: "number of RSP answers sent back to the RELP client",
@@ -43,7 +92,7 @@ func initRelpRegistry() {
 			[]string{"status", "client"},
 		)
 
-		relpProtocolErrorsCounter = prometheus.NewCounterVec(
+		relpProtocolErrorsCounter = base.NewExpiringCounterVec(
 			prometheus.CounterOpts{
 				Name: "skw_relp_protocol_errors_total",
 				Help: "Number of RELP protocol errors",
@@ -51,9 +100,20 @@ func initRelpRegistry() {
 			[]string{"client"},
 		)
 
+		relpReplayBufferedCounter, relpReplayRecoveredCounter = newRelpReplayCounters()
+		relpEmptyFramesCounter, relpKeepalivesCounter = newRelpEmptyFramesCounters()
+		relpLostCounter = newRelpLostCounter()
+		relpBacklogPausesCounter = newRelpBacklogPausesCounter()
+
 		base.Registry.MustRegister(
 			relpAnswersCounter,
+			relpLostCounter,
+			relpBacklogPausesCounter,
 			relpProtocolErrorsCounter,
+			relpReplayBufferedCounter,
+			relpReplayRecoveredCounter,
+			relpEmptyFramesCounter,
+			relpKeepalivesCounter,
 		)
 	})
 }
@@ -79,14 +139,93 @@ const (
 )
 
 type ackForwarder struct {
-	succ sync.Map
-	fail sync.Map
-	comm sync.Map
-	next uint32
+	succ   sync.Map
+	fail   sync.Map
+	comm   sync.Map
+	replay relpReplay
+	next   uint32
+	ctx    context.Context
+	cancel context.CancelFunc
+	// unanswered counts the received transactions of each connection whose
+	// answer has not been sent yet
+	unanswered sync.Map
+	// inflight tracks the transactions of each connection that have not
+	// been answered yet (see relpInflight)
+	inflight sync.Map
+}
+
+// relpInflight are the transactions of a connection that were received but
+// not answered yet: the next one to commit, and the answers that wait for
+// their turn. They are only tracked for Transactions, so that a snapshot
+// never has to read the queues.
+type relpInflight struct {
+	sync.Mutex
+	next     int32
+	received map[int32]struct{}
+	// answers maps a txnr to "" for a success, or to the failure reason
+	answers map[int32]string
+}
+
+func newRelpInflight() *relpInflight {
+	return &relpInflight{
+		next:     -1,
+		received: map[int32]struct{}{},
+		answers:  map[int32]string{},
+	}
+}
+
+func (h *relpInflight) receive(txnr int32) {
+	h.Lock()
+	h.received[txnr] = struct{}{}
+	h.Unlock()
+}
+
+func (h *relpInflight) commit(txnr int32) {
+	h.Lock()
+	h.next = txnr
+	h.Unlock()
+}
+
+// answer records the answer of the transaction txnr, when it is in flight.
+func (h *relpInflight) answer(txnr int32, reason string) {
+	h.Lock()
+	if _, ok := h.received[txnr]; ok {
+		if _, ok := h.answers[txnr]; !ok {
+			h.answers[txnr] = reason
+		}
+	}
+	h.Unlock()
+}
+
+func (h *relpInflight) remove(txnrs ...int32) {
+	h.Lock()
+	for _, txnr := range txnrs {
+		delete(h.received, txnr)
+		delete(h.answers, txnr)
+		if h.next == txnr {
+			h.next = -1
+		}
+	}
+	h.Unlock()
+}
+
+func (f *ackForwarder) inflightOf(connID utils.MyULID) *relpInflight {
+	if h, ok := f.inflight.Load(connID); ok {
+		return h.(*relpInflight)
+	}
+	return nil
 }
 
 func newAckForwarder() *ackForwarder {
-	return &ackForwarder{}
+	f := ackForwarder{}
+	f.ctx, f.cancel = context.WithCancel(context.Background())
+	return &f
+}
+
+// Stop signals the goroutines that wait in GetSuccAndFail that no more ACK
+// will be produced, so that they return promptly.
+func (f *ackForwarder) Stop() {
+	f.cancel()
 }
 
 func txnr2bytes(txnr int32) []byte {
@@ -110,55 +249,222 @@ func bytes2txnr(b []byte) int32 {
 
 func (f *ackForwarder) Received(connID utils.MyULID, txnr int32) {
 	if c, ok := f.comm.Load(connID); ok {
+		if n, ok := f.unanswered.Load(connID); ok {
+			n.(*atomic.Int32).Inc()
+		}
+		if h := f.inflightOf(connID); h != nil {
+			h.receive(txnr)
+		}
 		_ = c.(*intq.Ring).Put(txnr)
 	}
 }
 
+// Unanswered returns the number of received transactions of the connection
+// whose answer has not been sent yet.
+func (f *ackForwarder) Unanswered(connID utils.MyULID) int32 {
+	if n, ok := f.unanswered.Load(connID); ok {
+		return n.(*atomic.Int32).Load()
+	}
+	return 0
+}
+
+// WaitUnanswered blocks while the connection has at least max received
+// transactions whose answer has not been sent yet. It returns early when the
+// connection is removed or the forwarder is stopped.
+func (f *ackForwarder) WaitUnanswered(connID utils.MyULID, max int32) {
+	w := waiter.Waiter(10*time.Millisecond, 20)
+	for {
+		n, ok := f.unanswered.Load(connID)
+		if !ok || n.(*atomic.Int32).Load() < max || f.ctx.Err() != nil {
+			return
+		}
+		w.WaitCtx(f.ctx)
+	}
+}
+
 func (f *ackForwarder) NextToCommit(connID utils.MyULID) int32 {
 	if c, ok := f.comm.Load(connID); ok {
 		next, err := c.(*intq.Ring).Poll(time.Nanosecond)
 		if err != nil {
 			return -1
 		}
+		if h := f.inflightOf(connID); h != nil {
+			h.commit(next)
+		}
 		return next
 	}
 	return -1
 }
 
+// relpAbortMarker is the reason of the failure that Abort puts in the fail
+// queue, so that the responses goroutine answers the abort command in order.
+const relpAbortMarker = "\x00abort"
+
+// Abort discards the transactions of the connection that wait for an
+// answer, so that NextToCommit skips them, and queues the answer of the
+// abort command txnr. The answers that arrive later for the discarded
+// transactions are not sent to the client.
+func (f *ackForwarder) Abort(connID utils.MyULID, txnr int32) (n int) {
+	if c, ok := f.comm.Load(connID); ok {
+		q := c.(*intq.Ring)
+		var purged []int32
+		for q.Len() > 0 {
+			txnr, err := q.Poll(time.Nanosecond)
+			if err != nil {
+				break
+			}
+			purged = append(purged, txnr)
+		}
+		n = len(purged)
+		if u, ok := f.unanswered.Load(connID); ok {
+			u.(*atomic.Int32).Sub(int32(n))
+		}
+		if h := f.inflightOf(connID); h != nil {
+			h.remove(purged...)
+		}
+	}
+	if q, ok := f.fail.Load(connID); ok {
+		_ = q.(*failq.Ring).Put(failq.Failure{Txnr: txnr, Reason: relpAbortMarker})
+	}
+	return n
+}
+
+// aborted is called by the responses goroutine when it gets the marker of
+// the abort command txnr. next is the transaction that the goroutine waits
+// to commit: when it precedes the abort, it is discarded too. The answer of
+// the abort command is written to w, and the new next is returned.
+func (f *ackForwarder) aborted(connID utils.MyULID, txnr int32, next int32, answers *relpPendingAnswers, w io.Writer) int32 {
+	if next != -1 && next < txnr {
+		if u, ok := f.unanswered.Load(connID); ok {
+			u.(*atomic.Int32).Dec()
+		}
+		if h := f.inflightOf(connID); h != nil {
+			h.remove(next)
+		}
+		next = -1
+	}
+	answers.abort(txnr)
+	_ = writeSuccess(w, txnr)
+	return next
+}
+
 func (f *ackForwarder) ForwardSucc(connID utils.MyULID, txnr int32) {
+	if h := f.inflightOf(connID); h != nil {
+		h.answer(txnr, "")
+	}
 	if q, ok := f.succ.Load(connID); ok {
 		_ = q.(*intq.Ring).Put(txnr)
 	}
+	f.replay.stashed(connID, txnr)
+}
+
+// FailUncommitted reports the transactions of the connection that were
+// received but not answered as failed, when the connection has been lost.
+// Contrary to ForwardFail, the replay buffer keeps the stashed ones, as the
+// client will send them again when it reconnects.
+func (f *ackForwarder) FailUncommitted(connID utils.MyULID, reason string) (n int) {
+	c, ok := f.comm.Load(connID)
+	if !ok {
+		return 0
+	}
+	q := c.(*intq.Ring)
+	fq, _ := f.fail.Load(connID)
+	h := f.inflightOf(connID)
+	for q.Len() > 0 {
+		txnr, err := q.Poll(time.Nanosecond)
+		if err != nil {
+			break
+		}
+		if h != nil {
+			h.answer(txnr, reason)
+		}
+		if fq != nil {
+			_ = fq.(*failq.Ring).Put(failq.Failure{Txnr: txnr, Reason: reason})
+		}
+		n++
+	}
+	if u, ok := f.unanswered.Load(connID); ok {
+		u.(*atomic.Int32).Sub(int32(n))
+	}
+	return n
 }
 
-func (f *ackForwarder) ForwardFail(connID utils.MyULID, txnr int32) {
+// ForwardFail reports that the transaction txnr has failed. reason is sent
+// back to the client in the rsp answer.
+func (f *ackForwarder) ForwardFail(connID utils.MyULID, txnr int32, reason string) {
+	if h := f.inflightOf(connID); h != nil {
+		h.answer(txnr, reason)
+	}
 	if q, ok := f.fail.Load(connID); ok {
-		_ = q.(*intq.Ring).Put(txnr)
+		_ = q.(*failq.Ring).Put(failq.Failure{Txnr: txnr, Reason: reason})
+	}
+	// the client will send the message again
+	f.replay.answered(connID, txnr)
+}
+
+// EnableReplay makes the stashed messages of the connection that were not
+// answered be remembered after the connection is removed, so that the client
+// can send them again when it reconnects (see relpReplay). client is the
+// client id offered in the RELP open command.
+func (f *ackForwarder) EnableReplay(connID utils.MyULID, client string, grace time.Duration) {
+	f.replay.enable(connID, client, grace)
+}
+
+// Replayed tells if the received message was stashed during a previous
+// connection of the client, and has just been answered with success.
+func (f *ackForwarder) Replayed(connID utils.MyULID, txnr int32, data []byte) bool {
+	if !f.replay.track(connID, txnr, data) {
+		return false
+	}
+	f.ForwardSucc(connID, txnr)
+	return true
+}
+
+// Answered reports that the answer of the transaction txnr has been sent.
+func (f *ackForwarder) Answered(connID utils.MyULID, txnr int32) {
+	if n, ok := f.unanswered.Load(connID); ok {
+		n.(*atomic.Int32).Dec()
+	}
+	if h := f.inflightOf(connID); h != nil {
+		h.remove(txnr)
+	}
+	f.replay.answered(connID, txnr)
+}
+
+// Pending tells if ACKs are waiting to be returned by GetSuccAndFail.
+func (f *ackForwarder) Pending(connID utils.MyULID) bool {
+	if q, ok := f.succ.Load(connID); ok && q.(*intq.Ring).Len() > 0 {
+		return true
+	}
+	if q, ok := f.fail.Load(connID); ok && q.(*failq.Ring).Len() > 0 {
+		return true
 	}
+	return false
 }
 
-func (f *ackForwarder) GetSuccAndFail(connID utils.MyULID) (success int32, failure int32) {
+func (f *ackForwarder) GetSuccAndFail(connID utils.MyULID) (success int32, failure failq.Failure) {
 	w := waiter.Default()
 	var err error
+	none := failq.Failure{Txnr: -1}
 	success = -1
-	failure = -1
+	failure = none
 
 	if q1, ok := f.succ.Load(connID); ok {
 		if q2, ok := f.fail.Load(connID); ok {
 			qsucc := q1.(*intq.Ring)
-			qfail := q2.(*intq.Ring)
+			qfail := q2.(*failq.Ring)
 			for {
-				if qsucc.IsDisposed() || qfail.IsDisposed() {
-					return -1, -1
+				if f.ctx.Err() != nil || qsucc.IsDisposed() || qfail.IsDisposed() {
+					return -1, none
 				}
 				if qsucc.Len() == 0 && qfail.Len() == 0 {
-					w.Wait()
+					w.WaitCtx(f.ctx)
 					continue
 				}
 				if qsucc.Len() > 0 {
 					success, err = qsucc.Get()
 					if err == eerrors.ErrQDisposed {
-						return -1, -1
+						return -1, none
 					}
 					if err == eerrors.ErrQTimeout {
 						success = -1
@@ -167,28 +473,30 @@ func (f *ackForwarder) GetSuccAndFail(connID utils.MyULID) (success int32, failu
 				if qfail.Len() > 0 {
 					failure, err = qfail.Get()
 					if err == eerrors.ErrQDisposed {
-						return -1, -1
+						return -1, none
 					}
 					if err == eerrors.ErrQTimeout {
-						failure = -1
+						failure = none
 					}
 				}
-				if success == -1 && failure == -1 {
-					w.Wait()
+				if success == -1 && failure.Txnr == -1 {
+					w.WaitCtx(f.ctx)
 					continue
 				}
 				return success, failure
 			}
 		}
 	}
-	return -1, -1
+	return -1, none
 }
 
 func (f *ackForwarder) AddConn(qsize uint64) utils.MyULID {
 	connID := utils.NewUid()
 	f.succ.Store(connID, intq.NewRing(qsize))
-	f.fail.Store(connID, intq.NewRing(qsize))
+	f.fail.Store(connID, failq.NewRing(qsize))
 	f.comm.Store(connID, intq.NewRing(qsize))
+	f.unanswered.Store(connID, atomic.NewInt32(0))
+	f.inflight.Store(connID, newRelpInflight())
 	return connID
 }
 
@@ -198,25 +506,55 @@ func (f *ackForwarder) RemoveConn(connID utils.MyULID) {
 		f.succ.Delete(connID)
 	}
 	if q, ok := f.fail.Load(connID); ok {
-		q.(*intq.Ring).Dispose()
+		q.(*failq.Ring).Dispose()
 		f.fail.Delete(connID)
 	}
 	f.comm.Delete(connID)
+	f.unanswered.Delete(connID)
+	f.inflight.Delete(connID)
+	f.replay.closed(connID)
 }
 
 func (f *ackForwarder) RemoveAll() {
-	f.succ = sync.Map{}
-	f.fail = sync.Map{}
-	f.comm = sync.Map{}
+	// the maps are emptied in place, so that RemoveAll does not race with
+	// the concurrent readers
+	f.succ.Range(func(k, q interface{}) bool {
+		q.(*intq.Ring).Dispose()
+		f.succ.Delete(k)
+		return true
+	})
+	f.fail.Range(func(k, q interface{}) bool {
+		q.(*failq.Ring).Dispose()
+		f.fail.Delete(k)
+		return true
+	})
+	f.comm.Range(func(k, q interface{}) bool {
+		f.comm.Delete(k)
+		return true
+	})
+	f.unanswered.Range(func(k, n interface{}) bool {
+		f.unanswered.Delete(k)
+		return true
+	})
+	f.inflight.Range(func(k, h interface{}) bool {
+		f.inflight.Delete(k)
+		return true
+	})
 }
 
 type meta struct {
 	Txnr   int32
 	ConnID utils.MyULID
+	// Cluster is the Kafka cluster of the message, and Fanout tracks the
+	// answers of the clusters when the message is sent to several ones
+	// (direct RELP only).
+	Cluster string
+	Fanout  *kafkaFanout
 }
 
 type RelpService struct {
 	StreamingService
+	sessions       relpSessions
 	fatalErrorChan chan struct{}
 	fatalOnce      sync.Once
 	ACKQueueSize   uint64
@@ -224,10 +562,15 @@ type RelpService struct {
 	wg             sync.WaitGroup
 	confined       bool
 	rawQ           *tcp.Ring
+	orderedQs      orderedQueues
 	parsewg        sync.WaitGroup
 	configs        map[utils.MyULID]conf.RELPSourceConfig
 	forwarder      *ackForwarder
 	parserEnv      *decoders.ParsersEnv
+	stopping       atomic.Bool
+	stats          parseStats
+	// errLogger rate-limits the error logs of the parse and response loops
+	errLogger log15.Logger
 }
 
 func NewRelpService(env *base.ProviderEnv) (base.Provider, error) {
@@ -241,9 +584,11 @@ func NewRelpService(env *base.ProviderEnv) (base.Provider, error) {
 	}
 	s.StreamingService.init()
 	s.StreamingService.BaseService.Logger = env.Logger.New("class", "RelpServer")
+	s.errLogger = s.Logger
 	s.StreamingService.BaseService.Binder = env.Binder
 	s.StreamingService.handler = RelpHandler{Server: &s}
 	s.StreamingService.confined = env.Confined
+	s.StreamingService.typ = base.RELP
 	return &s, nil
 }
 
@@ -274,6 +619,8 @@ func (s *RelpService) Start() ([]model.ListenerInfo, error) {
 		return infos, nil
 	}
 	s.Logger.Info("Listening on RELP", "nb_services", len(infos))
+	s.forwarder = newAckForwarder()
+	s.stopping.Store(false)
 
 	s.configs = make(map[utils.MyULID]conf.RELPSourceConfig, len(s.UnixListeners)+len(s.TCPListeners))
 	for _, l := range s.UnixListeners {
@@ -283,8 +630,9 @@ func (s *RelpService) Start() ([]model.ListenerInfo, error) {
 		s.configs[l.Conf.ConfID] = conf.RELPSourceConfig(l.Conf)
 	}
 
-	cpus := runtime.NumCPU()
-	for i := 0; i < cpus; i++ {
+	workers := parseWorkers(s.ParseWorkers)
+	s.stats = newParseStats(base.RELP, workers+len(s.orderedQs))
+	for i := 0; i < workers; i++ {
 		s.parsewg.Add(1)
 		go func() {
 			// Parse() returns an error if something fatal happened
@@ -296,6 +644,18 @@ func (s *RelpService) Start() ([]model.ListenerInfo, error) {
 			}
 		}()
 	}
+	// one parser per ordered queue
+	for _, q := range s.orderedQs {
+		s.parsewg.Add(1)
+		go func(q *tcp.Ring) {
+			err := s.parseFrom(q)
+			s.parsewg.Done()
+			if err != nil {
+				s.Logger.Error(err.Error())
+				s.dofatal()
+			}
+		}(q)
+	}
 
 	s.wg.Add(1)
 	go func() {
@@ -305,19 +665,27 @@ func (s *RelpService) Start() ([]model.ListenerInfo, error) {
 	return infos, nil
 }
 
+// Stop shuts down the service in a strict order: stop accepting connections,
+// drain the parsers, stop producing ACKs, and only then remove the ACK queues.
 func (s *RelpService) Stop() {
+	// new connections are refused from now on
+	s.stopping.Store(true)
 	s.resetTCPListeners() // makes the listeners stop
 	s.CloseConnections()
 	// no more message will arrive in rawMessagesQueue
 	if s.rawQ != nil {
 		s.rawQ.Dispose()
 	}
+	s.orderedQs.dispose()
 	// the parsers consume the rest of rawMessagesQueue, then they stop
 	s.parsewg.Wait() // wait that the parsers have stopped
-	// after the parsers have stopped, we can close the queues
-	s.forwarder.RemoveAll()
-	// wait that all goroutines have ended
+	// no more ACK will be produced: make handleResponses return
+	s.forwarder.Stop()
+	// wait that all goroutines (listeners, connection handlers, response
+	// handlers) have ended
 	s.wg.Wait()
+	// nobody uses the queues anymore, we can close them
+	s.forwarder.RemoveAll()
 }
 
 func (s *RelpService) SetConf(c conf.BaseConfig) {
@@ -328,19 +696,43 @@ func (s *RelpService) SetConf(c conf.BaseConfig) {
 	s.StreamingService.SetConf(tcpConfigs, c.Parsers, c.Main.InputQueueSize, 132000)
 	s.parserEnv = decoders.NewParsersEnv(c.Parsers, s.Logger)
 	s.rawQ = tcp.NewRing(c.Main.InputQueueSize)
+	s.ParseWorkers = c.Main.ParseWorkers
+	s.OrderingCheck = c.Main.OrderingCheck
+	s.BatchSize = c.Main.RELPBatchSize
+	s.BindRetryPeriod = c.Main.BindRetryPeriod
+	throttle.configure(c.Main, s.Logger)
+	base.ConfigureFieldSizes(c.Main.FieldSizeMetrics, c.Main.FieldSizeWindow)
+	s.errLogger = logging.RateLimited(s.Logger, c.Main.LogRateLimitWindow, c.Main.LogRateLimitBurst)
+	s.orderedQs = nil
+	if hasOrderedListener(tcpConfigs) {
+		s.orderedQs = newOrderedQueues(parseWorkers(s.ParseWorkers), c.Main.InputQueueSize)
+	}
 	s.ACKQueueSize = c.Main.InputQueueSize
 }
 
-func (s *RelpService) parseOne(raw *model.RawTCPMessage, gen *utils.Generator) error {
+// parseOne parses and stashes the messages of a RELP transaction. When txn
+// is not nil, the messages are stashed with an end to end acknowledgment.
+func (s *RelpService) parseOne(raw *model.RawTCPMessage, gen *utils.Generator, txn *e2eTxn) error {
+	start := time.Now()
+	checksum := base.Checksum(&raw.Decoder, raw.Message)
 	syslogMsgs, err := s.parserEnv.Parse(&raw.Decoder, raw.Message)
+	base.ObserveParseDuration(base.RELP, raw.Decoder.Format, start)
 	if err != nil {
 		return err
 	}
 
+	quarantined := false
 	for _, syslogMsg := range syslogMsgs {
 		if syslogMsg == nil {
 			continue
 		}
+		quarantined = quarantined || decoders.Quarantined(syslogMsg)
+		if !base.NormalizeTime(base.RELP, syslogMsg, &raw.Decoder) {
+			model.Free(syslogMsg)
+			continue
+		}
+		base.NormalizeHostname(syslogMsg, &raw.Decoder)
+		base.ObserveFieldSizes(base.RELP, &raw.RawMessage, syslogMsg)
 
 		full := model.FullFactoryFrom(syslogMsg)
 		full.Txnr = raw.Txnr
@@ -348,92 +740,386 @@ func (s *RelpService) parseOne(raw *model.RawTCPMessage, gen *utils.Generator) e
 		full.Uid = gen.Uid()
 		full.SourceType = "relp"
 		full.ClientAddr = raw.Client
+		full.TimeReceivedNum = raw.Received.UnixNano()
 		full.SourcePort = int32(raw.LocalPort)
 		full.SourcePath = raw.UnixSocketPath
+		base.SetChecksum(full, checksum)
+		if raw.Seq > 0 {
+			ordering.Stamp(full.Fields, raw.ConnID.String(), raw.Seq)
+		}
 
-		err := s.reporter.Stash(full)
+		var err error
+		if txn != nil {
+			uid := full.Uid
+			txn.add(uid)
+			err = s.reporter.StashWithAck(full, txn.ack)
+			if err != nil {
+				// the message is lost
+				txn.ack(uid, false)
+			}
+		} else {
+			err = s.reporter.Stash(full)
+		}
 		model.FullFree(full)
+		if err != nil && eerrors.Is("StoreDown", err) {
+			// the transaction is NACKed, so that the client sends it again
+			return err
+		}
 		if err != nil {
 			// a non fatal error is typically an error marshalling the message to the communication pipe with the coordinator
 			// such an error is not supposed to happen. if it does, we just log and continue the processing of remaining syslogMsgs
-			logg(s.Logger, &raw.RawMessage).Warn("Error stashing RELP message", "error", err)
+			logg(s.errLogger, &raw.RawMessage).Warn("Error stashing RELP message", "error", err)
 			if eerrors.IsFatal(err) {
+				recenterrors.Add("relp", recenterrors.Fatal, err)
 				return eerrors.Wrap(err, "Fatal error pushing RELP message to the Store")
 			}
+			recenterrors.Add("relp", recenterrors.NonFatal, err)
 		}
 	}
+	if quarantined && raw.Decoder.QuarantineAnswer == "nack" {
+		// the raw message is in the quarantine, but the client is still
+		// told that it could not be parsed
+		return decoders.DecodingError(eerrors.New("The message has been quarantined"))
+	}
 	return nil
 }
 
 func (s *RelpService) Parse() error {
+	return s.parseFrom(s.rawQ)
+}
+
+func (s *RelpService) parseFrom(q *tcp.Ring) error {
 	gen := utils.NewGenerator()
+	batch := make([]*model.RawTCPMessage, parseBatchSize(s.BatchSize))
 
 	for {
-		raw, err := s.rawQ.Get()
-		if err != nil || raw == nil {
+		n, err := q.GetBatch(batch)
+		if err != nil {
 			return nil
 		}
+		for i, raw := range batch[:n] {
+			batch[i] = nil
+			if raw == nil {
+				return nil
+			}
+			err = s.parseRaw(raw, gen)
+			if err != nil {
+				// stop processing when fatal error happens
+				return err
+			}
+		}
+	}
+}
 
-		err = s.parseOne(raw, gen)
-		if err != nil {
-			s.forwarder.ForwardFail(raw.ConnID, raw.Txnr)
-			base.CountParsingError(base.RELP, raw.Client, raw.Decoder.Format)
-			logg(s.Logger, &raw.RawMessage).Warn(err.Error())
-		} else {
-			s.forwarder.ForwardSucc(raw.ConnID, raw.Txnr)
+func (s *RelpService) parseRaw(raw *model.RawTCPMessage, gen *utils.Generator) error {
+	s.stats.begin(s.rawQ.Len() + s.orderedQs.len())
+	defer s.stats.end()
+
+	var txn *e2eTxn
+	config := s.configs[raw.ConfID]
+	if config.EndToEndAck {
+		// the answer waits for the acknowledgments of the destinations
+		fwder, connID, txnr := s.forwarder, raw.ConnID, raw.Txnr
+		txn = newE2ETxn(func(reason string) {
+			if len(reason) == 0 {
+				fwder.ForwardSucc(connID, txnr)
+			} else {
+				fwder.ForwardFail(connID, txnr, reason)
+			}
+		}, s.reporter.Forget)
+	}
+
+	err := s.parseOne(raw, gen, txn)
+	if err != nil {
+		if txn != nil {
+			txn.abandon()
+		}
+		s.forwarder.ForwardFail(raw.ConnID, raw.Txnr, failReason(err))
+		base.CountParsingError(base.RELP, raw.Client, raw.Decoder.Format, err)
+		logg(s.errLogger, &raw.RawMessage).Warn("Error processing RELP message", "error", err)
+	} else if txn != nil {
+		txn.seal(config.EndToEndAckTimeout)
+	} else {
+		s.forwarder.ForwardSucc(raw.ConnID, raw.Txnr)
+	}
+	model.RawTCPFree(raw)
+
+	if err != nil && eerrors.IsFatal(err) {
+		return err
+	}
+	return nil
+}
+
+// relpOfferValue returns the value associated with key in a RELP open offer.
+func relpOfferValue(offer []byte, key string) string {
+	for _, line := range bytes.Split(offer, []byte("\n")) {
+		kv := bytes.SplitN(bytes.TrimSpace(line), []byte("="), 2)
+		if len(kv) == 2 && string(kv[0]) == key {
+			value := strings.TrimSpace(string(kv[1]))
+			if len(value) > 128 {
+				value = value[:128]
+			}
+			return value
+		}
+	}
+	return ""
+}
+
+// relpCommands lists the RELP commands that skewer supports, besides open and close.
+var relpCommands = []string{"syslog"}
+
+// relpVersion is the version of the RELP protocol that skewer speaks.
+const relpVersion = 0
+
+// relpOffer is the result of the negotiation of a RELP open offer.
+type relpOffer struct {
+	version  int
+	commands []string
+	// compression and tls are only answered when the client offered them
+	compression string
+	tls         string
+	// mismatch is the capability that the client requires but that skewer
+	// does not support, or empty when the negotiation succeeded
+	mismatch string
+}
+
+// negotiateRelpOffer intersects the capabilities that a client offered in a
+// RELP open command with the capabilities that skewer supports:
+//
+//   - relp_version: the lowest of the offered version and relpVersion. An
+//     offer that is not a version number can not be negotiated.
+//   - commands: the supported commands that the client offered. The syslog
+//     command is mandatory, as messages can not be sent without it.
+//   - compression: skewer only speaks "none". A client that does not offer
+//     it requires a compression.
+//   - tls: a client that offers "tls=required" can not use a plaintext
+//     connection.
+func negotiateRelpOffer(offer []byte, secure bool) (n relpOffer) {
+	n.version = relpVersion
+	n.commands = relpCommands
+	if v := relpOfferValue(offer, "relp_version"); len(v) > 0 {
+		version, err := strconv.Atoi(v)
+		if err != nil || version < 0 {
+			n.mismatch = "relp_version"
+		} else if version < relpVersion {
+			n.version = version
+		}
+	}
+	if clientCommands := relpOfferValue(offer, "commands"); len(clientCommands) > 0 {
+		n.commands = make([]string, 0, len(relpCommands))
+		syslog := false
+		for _, clientCommand := range strings.Split(clientCommands, ",") {
+			for _, command := range relpCommands {
+				if strings.TrimSpace(clientCommand) == command {
+					n.commands = append(n.commands, command)
+					syslog = syslog || command == "syslog"
+				}
+			}
+		}
+		if !syslog && len(n.mismatch) == 0 {
+			n.mismatch = "commands"
+		}
+	}
+	if codecs := relpOfferValue(offer, "compression"); len(codecs) > 0 {
+		n.compression = "none"
+		none := false
+		for _, codec := range strings.Split(codecs, ",") {
+			none = none || strings.ToLower(strings.TrimSpace(codec)) == "none"
 		}
+		if !none && len(n.mismatch) == 0 {
+			n.mismatch = "compression"
+		}
+	}
+	if t := strings.ToLower(relpOfferValue(offer, "tls")); len(t) > 0 {
+		n.tls = "off"
+		if secure {
+			n.tls = "on"
+		} else if t == "required" && len(n.mismatch) == 0 {
+			n.mismatch = "tls"
+		}
+	}
+	return n
+}
 
-		model.RawTCPFree(raw)
+// response builds the data of the response to a RELP open command. It
+// advertises the negotiated capabilities and the configured additional
+// offers. With reject, the response is an error offer.
+func (n relpOffer) response(extra []string, reject bool) []byte {
+	var buf bytes.Buffer
+	if reject {
+		buf.WriteString("500 unsupported ")
+		buf.WriteString(n.mismatch)
+		buf.WriteString("\n")
+	} else {
+		buf.WriteString("200 OK\n")
+	}
+	buf.WriteString("relp_version=")
+	buf.WriteString(strconv.Itoa(n.version))
+	buf.WriteString("\nrelp_software=skewer\n")
+	buf.WriteString("commands=")
+	buf.WriteString(strings.Join(n.commands, ","))
+	if len(n.compression) > 0 {
+		buf.WriteString("\ncompression=")
+		buf.WriteString(n.compression)
+	}
+	if len(n.tls) > 0 {
+		buf.WriteString("\ntls=")
+		buf.WriteString(n.tls)
+	}
+	for _, o := range extra {
+		switch strings.TrimSpace(strings.SplitN(o, "=", 2)[0]) {
+		case "compression":
+			if len(n.compression) > 0 {
+				continue
+			}
+		case "tls":
+			if len(n.tls) > 0 {
+				continue
+			}
+		}
+		buf.WriteString("\n")
+		buf.WriteString(o)
+	}
+	return buf.Bytes()
+}
 
-		if err != nil && eerrors.IsFatal(err) {
-			// stop processing when fatal error happens
+// writeFull writes all of p to w. It returns an error when a write fails, or
+// when it makes no progress, so that a partial RELP response is never
+// followed by another response.
+func writeFull(w io.Writer, p []byte) error {
+	for len(p) > 0 {
+		n, err := w.Write(p)
+		p = p[n:]
+		if err != nil {
 			return err
 		}
+		if n == 0 {
+			return io.ErrShortWrite
+		}
 	}
+	return nil
 }
 
-func writeSuccess(conn net.Conn, txnr int32) (err error) {
-	_, err = fmt.Fprintf(conn, "%d rsp 6 200 OK\n", txnr)
+func writeSuccess(w io.Writer, txnr int32) (err error) {
+	_, err = fmt.Fprintf(w, "%d rsp 6 200 OK\n", txnr)
 	return err
 }
 
-func writeFailure(conn net.Conn, txnr int32) (err error) {
-	_, err = fmt.Fprintf(conn, "%d rsp 6 500 KO\n", txnr)
+// Reasons of a RELP NACK, sent back to the client in the rsp answer.
+const (
+	failParse    = "parse_error"
+	failStore    = "store_error"
+	failTopic    = "no_topic"
+	failDropped  = "filter_dropped"
+	failRejected = "filter_rejected"
+	failFilter   = "filter_error"
+	failEncoding = "encoding_error"
+	failKafka    = "kafka_nack"
+	failExpired  = "expired"
+	failTooLarge = "too_large"
+	failUnknown  = "unknown_parser"
+	failOverload = "queue_full"
+	failEmpty    = "empty_frame"
+	failLost     = "connection_lost"
+	// the end to end acknowledgment failures
+	failDelivery   = "delivery_error"
+	failAckTimeout = "ack_timeout"
+	failStoreDown  = "store_down"
+)
+
+var failDetails = map[string]string{
+	failParse:      "the message could not be decoded",
+	failStore:      "the message could not be stored",
+	failTopic:      "the kafka topic could not be calculated",
+	failDropped:    "the message was dropped by the filter",
+	failRejected:   "the message was rejected by the filter",
+	failFilter:     "the message could not be filtered",
+	failEncoding:   "the message could not be encoded",
+	failKafka:      "the message was refused by kafka",
+	failExpired:    "the message exceeded the maximum message age",
+	failTooLarge:   "the message exceeds the maximum message size",
+	failUnknown:    "no parser matches the message format",
+	failOverload:   "the server is overloaded, try again later",
+	failEmpty:      "the syslog command has no data",
+	failLost:       "the connection was lost before the answer",
+	failDelivery:   "a destination refused the message",
+	failAckTimeout: "the destinations did not acknowledge the message in time",
+	failStoreDown:  "the store is restarting, try again later",
+}
+
+// failReason returns the NACK reason associated with a processing error.
+func failReason(err error) string {
+	if eerrors.Is("UnknownParser", err) {
+		return failUnknown
+	}
+	if eerrors.Is("Decoding", err) {
+		return failParse
+	}
+	if eerrors.Is("StoreDown", err) {
+		return failStoreDown
+	}
+	return failStore
+}
+
+// writeFailure NACKs the transaction txnr. The reason code and its detail
+// follow the status, so that the clients that ignore them still see a 500.
+func writeFailure(w io.Writer, txnr int32, reason string) (err error) {
+	rsp := fmt.Sprintf("500 KO reason=%s %s", reason, failDetails[reason])
+	_, err = fmt.Fprintf(w, "%d rsp %d %s\n", txnr, len(rsp), rsp)
 	return err
 }
 
-func (s *RelpService) handleResponses(conn net.Conn, connID utils.MyULID, client string, logger log15.Logger) error {
-	successes := map[int32]bool{}
-	failures := map[int32]bool{}
+// relpMaxBatchSize is the size of the buffered RELP responses above which
+// they are written even if more ACKs are ready.
+const relpMaxBatchSize = 16384
+
+// relpResponses coalesces the RELP responses that are ready together, so
+// that they are sent to the client in one write.
+type relpResponses struct {
+	conn net.Conn
+	buf  bytes.Buffer
+}
+
+// ready tells if the buffered responses should be written now.
+func (r *relpResponses) ready(morePending bool) bool {
+	return r.buf.Len() > 0 && (!morePending || r.buf.Len() >= relpMaxBatchSize)
+}
+
+// flush writes the buffered responses. After a timeout, the part that was
+// not written is kept for the next flush.
+func (r *relpResponses) flush() error {
+	for r.buf.Len() > 0 {
+		n, err := r.conn.Write(r.buf.Bytes())
+		r.buf.Next(n)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return io.ErrShortWrite
+		}
+	}
+	return nil
+}
+
+func (s *RelpService) handleResponses(conn net.Conn, connID utils.MyULID, client *atomic.String, logger log15.Logger) error {
+	answers := newRelpPendingAnswers()
+	responses := &relpResponses{conn: conn}
 	var err error
-	var ok1, ok2 bool
 
 	var next int32 = -1
 
 	for {
-		txnrSuccess, txnrFailure := s.forwarder.GetSuccAndFail(connID)
+		txnrSuccess, failure := s.forwarder.GetSuccAndFail(connID)
 
-		if txnrSuccess == -1 && txnrFailure == -1 {
+		if txnrSuccess == -1 && failure.Txnr == -1 {
 			return io.EOF
 		}
 
-		if txnrSuccess != -1 {
-			//logger.Debug("New success to report to client", "txnr", currentTxnr)
-			_, ok1 = successes[txnrSuccess]
-			_, ok2 = failures[txnrSuccess]
-			if !ok1 && !ok2 {
-				successes[txnrSuccess] = true
-			}
-		}
-
-		if txnrFailure != -1 {
-			//logger.Debug("New failure to report to client", "txnr", currentTxnr)
-			_, ok1 = successes[txnrFailure]
-			_, ok2 = failures[txnrFailure]
-			if !ok1 && !ok2 {
-				failures[txnrFailure] = true
-			}
+		if failure.Reason == relpAbortMarker {
+			next = s.forwarder.aborted(connID, failure.Txnr, next, answers, &responses.buf)
+			failure.Txnr = -1
 		}
+		answers.add(txnrSuccess, failure)
 
 		// rsyslog expects the ACK/txnr correctly and monotonicly ordered
 		// so we need a bit of cooking to ensure that
@@ -446,28 +1132,32 @@ func (s *RelpService) handleResponses(conn net.Conn, connID utils.MyULID, client
 				break Cooking
 			}
 			//logger.Debug("Next to commit", "connid", connID, "txnr", next)
-			if successes[next] {
-				err = writeSuccess(conn, next)
-				if err == nil {
-					successes[next] = false
-					countRelpAnswer(client, 200)
-				}
-			} else if failures[next] {
-				err = writeFailure(conn, next)
-				if err == nil {
-					failures[next] = false
-					countRelpAnswer(client, 500)
-				}
-			} else {
+			reason, success, ok := answers.take(next)
+			if !ok {
 				break Cooking
 			}
+			if success {
+				_ = writeSuccess(&responses.buf, next)
+				s.forwarder.Answered(connID, next)
+				countRelpAnswer(client.Load(), 200)
+			} else {
+				_ = writeFailure(&responses.buf, next, reason)
+				s.forwarder.Answered(connID, next)
+				countRelpAnswer(client.Load(), 500)
+			}
+			next = -1
+		}
 
+		// when more ACKs are already waiting, their responses are sent
+		// together with the current ones
+		for responses.ready(s.forwarder.Pending(connID)) {
+			err = responses.flush()
 			if err == nil {
-				next = -1
+				break
 			} else if eerrors.HasFileClosed(err) {
 				return io.EOF // client is gone
 			} else if eerrors.IsTimeout(err) {
-				logger.Warn("Timeout error writing RELP response to client", "error", err)
+				s.errLogger.Warn("Timeout error writing RELP response to client", "client", client.Load(), "error", err)
 			} else {
 				return eerrors.Wrap(err, "Unexpected error writing RELP response to client")
 			}
@@ -484,33 +1174,70 @@ func (h RelpHandler) HandleConnection(conn net.Conn, c conf.TCPSourceConfig) (er
 	config := conf.RELPSourceConfig(c)
 	s := h.Server
 	s.AddConnection(conn)
+	if s.stopping.Load() {
+		// the connection was accepted while the service was stopping
+		s.RemoveConnection(conn)
+		return nil
+	}
 	connID := s.forwarder.AddConn(s.ACKQueueSize)
+	rawQ := s.rawQ
+	if config.OrderedParsing && len(s.orderedQs) > 0 {
+		rawQ = s.orderedQs.get(connID)
+	}
 	props := eprops(conn)
+	props.ClientID = atomic.NewString(props.Client)
+	props.ClientIDOffer = config.ClientIDOffer
+	props.OpenOffers = config.OpenOffers
+	props.EmptyFrames = config.EmptyFrames
+	props.OfferMismatch = config.OfferMismatch
+	props.Sequenced = s.OrderingCheck
+	props.BatchSize = s.BatchSize
+	props.MaxPendingAnswers = config.MaxPendingAnswers
+	props.ReplayGracePeriod = config.ReplayGracePeriod
 	l := makeLogger(s.Logger, props, "relp")
-	l.Info("New client")
-	defer l.Debug("Client gone away")
+	connLog := s.connLog(l, c)
+	connLog.opened()
+	defer connLog.closed()
 	clientCounter(base.RELP, props)
+	session := newRelpSession(conn, config.ConfID, props)
+	s.sessions.add(connID, session)
+	defer s.sessions.remove(connID)
 
 	var wg sync.WaitGroup
+	responsesDone := make(chan struct{})
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		e := s.handleResponses(conn, connID, props.Client, l)
+		defer close(responsesDone)
+		e := s.handleResponses(conn, connID, props.ClientID, l)
 		if e != nil && !eerrors.HasFileClosed(e) {
 			s.Logger.Warn("Unexpected error in RELP handleResponses", "error", e, "connID", connID.String())
 		}
+		// no more response can be sent: close the connection, so that
+		// scan returns and the forwarder forgets the connection. A
+		// draining session is closed after the serverclose.
+		if !session.isDraining() {
+			s.RemoveConnection(conn)
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		session.drain(s.forwarder, connID, responsesDone, func() { s.RemoveConnection(conn) })
 	}()
 
 	wg.Add(1)
 	go func() {
 		defer func() {
+			session.scanReturned()
 			s.forwarder.RemoveConn(connID) // this makes handleResponses return
 			s.RemoveConnection(conn)
 			wg.Done()
 		}()
-		e := scan(l, s.forwarder, s.rawQ, conn, config.Timeout, config.ConfID, connID, s.MaxMessageSize, config.DecoderBaseConfig, props)
-		if e != nil && !eerrors.HasFileClosed(e) {
+		e := scan(l, s.forwarder, rawQ, session, config.Timeout, config.ConfID, connID, s.MaxMessageSize, config.DecoderBaseConfig, props)
+		if e != nil && !eerrors.HasFileClosed(e) && !session.isDraining() {
 			err = eerrors.Wrap(e, "RELP scanning error")
 		}
 	}()
@@ -519,6 +1246,10 @@ func (h RelpHandler) HandleConnection(conn net.Conn, c conf.TCPSourceConfig) (er
 	return err
 }
 
+// relpMaxHeaderSize is the room left in the scanner buffer for the
+// "TXNR COMMAND DATALEN " header of a RELP frame.
+const relpMaxHeaderSize = 64
+
 func scan(l log15.Logger, f *ackForwarder, rawq *tcp.Ring, c net.Conn, tout time.Duration, cfid, cnid utils.MyULID, msiz int, dc conf.DecoderBaseConfig, props tcpProps) (err error) {
 	var previous = int32(-1)
 	var command string
@@ -526,48 +1257,93 @@ func scan(l log15.Logger, f *ackForwarder, rawq *tcp.Ring, c net.Conn, tout time
 	var splits [][]byte
 	var data []byte
 
-	machine := newMachine(l, f, rawq, c, cfid, cnid, msiz, dc, props)
+	batch := newRawBatch(rawq, props.BatchSize)
+	machine := newMachine(l, f, batch, c, cfid, cnid, msiz, dc, props)
+	defer func() {
+		// the messages of the frames received before the end of the
+		// session are parsed, as without batching
+		_ = batch.flush()
+	}()
+	defer func() {
+		// the session did not end with a close command: the transactions
+		// in progress will never be answered
+		if machine.Current() == "closed" || err == errDraining {
+			return
+		}
+		if n := f.FailUncommitted(cnid, failLost); n > 0 {
+			cause := lostCause(err)
+			relpLostCounter.WithLabelValues(cause, props.id()).Add(float64(n))
+			l.Info("The RELP connection was lost with transactions in progress", "cause", cause, "transactions", n)
+		}
+	}()
 
 	if tout > 0 {
 		_ = c.SetReadDeadline(time.Now().Add(tout))
 	}
-	scanner := utils.WithRecover(bufio.NewScanner(c))
-	scanner.Split(utils.RelpSplit)
-	scanner.Buffer(make([]byte, 0, 132000), 132000)
+	if msiz <= 0 {
+		msiz = 132000
+	}
+	// the data of the frames larger than msiz is skipped by the splitter, so
+	// the buffer only needs room for the largest accepted frame
+	splitter := &utils.RelpSplitter{MaxSize: msiz}
+	scanner := utils.WithRecover(bufio.NewScanner(batch.reader(c)))
+	scanner.Split(splitter.Split)
+	scanner.Buffer(make([]byte, 0, 4096), msiz+relpMaxHeaderSize)
 
 	for scanner.Scan() {
 		splits = bytes.SplitN(scanner.Bytes(), sp, 3)
 		txnr, err = utils.Atoi32(string(splits[0]))
 		if err != nil {
-			countRelpProtocolError(props.Client)
+			countRelpProtocolError(props.id())
 			return eerrors.Wrap(err, "Badly formed TXNR")
 		}
 		if txnr <= previous {
-			countRelpProtocolError(props.Client)
+			countRelpProtocolError(props.id())
 			return eerrors.Errorf("TXNR has not increased (previous = %d, current = %d)", previous, txnr)
 		}
 		previous = txnr
 		command = string(splits[1])
 		data = data[:0]
 		if len(splits) == 3 {
-			data = bytes.TrimSpace(splits[2])
+			data = splits[2]
+		}
+		if splitter.Oversized > 0 && command != "syslog" {
+			countRelpProtocolError(props.id())
+			return eerrors.Errorf("RELP '%s' command too large: %d > %d", command, splitter.Oversized, msiz)
 		}
 
-		err = machine.Event(command, txnr, data)
+		if command == "syslog" && props.MaxPendingAnswers > 0 && f.Unanswered(cnid) >= int32(props.MaxPendingAnswers) {
+			// the answers wait for a slow transaction: stop reading until
+			// they are sent. The batched messages must be parsed for that.
+			err = batch.flush()
+			if err != nil {
+				return err
+			}
+			relpBacklogPausesCounter.WithLabelValues(props.id()).Inc()
+			f.WaitUnanswered(cnid, int32(props.MaxPendingAnswers))
+		}
+
+		err = machine.Event(command, txnr, data, splitter.Oversized)
 		if err != nil {
 			switch err.(type) {
 			case fsm.UnknownEventError:
-				countRelpProtocolError(props.Client)
+				countRelpProtocolError(props.id())
 				return eerrors.Wrapf(err, "Unknown RELP command: %s", command)
 			case fsm.InvalidEventError:
-				countRelpProtocolError(props.Client)
+				countRelpProtocolError(props.id())
 				return eerrors.Wrapf(err, "Invalid RELP command: %s", command)
 			case fsm.InternalError:
-				countRelpProtocolError(props.Client)
+				countRelpProtocolError(props.id())
 				return eerrors.Wrap(err, "Internal RELP state machine error")
 			case fsm.NoTransitionError:
-				// syslog does not change opened/closed state
-				// nothing to do
+				// syslog and abort do not change opened/closed state, but
+				// their callbacks may have failed
+				if e := err.(fsm.NoTransitionError).Err; e != nil {
+					if eerrors.HasFileClosed(e) {
+						return io.EOF
+					}
+					return e
+				}
 			default:
 				if eerrors.HasFileClosed(err) {
 					return io.EOF
@@ -586,7 +1362,23 @@ func scan(l log15.Logger, f *ackForwarder, rawq *tcp.Ring, c net.Conn, tout time
 	return err
 }
 
-func newMachine(l log15.Logger, fwder *ackForwarder, rawq *tcp.Ring, conn io.Writer, confID, connID utils.MyULID, msiz int, dc conf.DecoderBaseConfig, props tcpProps) *fsm.FSM {
+// lostCause tells why a RELP session ended without a close command.
+func lostCause(err error) string {
+	switch {
+	case err == nil || err == io.EOF:
+		// the client closed the connection, or the connection was closed
+		// because the answers could not be written
+		return "eof"
+	case eerrors.HasErrno(err, syscall.ECONNRESET):
+		return "reset"
+	case eerrors.IsTimeout(err):
+		return "timeout"
+	default:
+		return "error"
+	}
+}
+
+func newMachine(l log15.Logger, fwder *ackForwarder, batch *rawBatch, conn io.Writer, confID, connID utils.MyULID, msiz int, dc conf.DecoderBaseConfig, props tcpProps) *fsm.FSM {
 	factory := makeRawTCPFactory(props, confID, dc)
 	// TODO: PERF: fsm protects internal variables (states, events) with mutexes. We don't really need the mutexes here.
 	return fsm.NewFSM(
@@ -595,41 +1387,111 @@ func newMachine(l log15.Logger, fwder *ackForwarder, rawq *tcp.Ring, conn io.Wri
 			fsm.EventDesc{Name: "open", Src: []string{"closed"}, Dst: "opened"},
 			fsm.EventDesc{Name: "close", Src: []string{"opened"}, Dst: "closed"},
 			fsm.EventDesc{Name: "syslog", Src: []string{"opened"}, Dst: "opened"},
+			fsm.EventDesc{Name: "abort", Src: []string{"opened"}, Dst: "opened"},
 		},
 		fsm.Callbacks{
 			"after_syslog": func(e *fsm.Event) {
 				txnr := e.Args[0].(int32)
 				data := e.Args[1].([]byte)
+				oversized := e.Args[2].(int)
 				fwder.Received(connID, txnr)
+				if oversized > 0 {
+					// the data was skipped: NACK the message, but keep the session
+					countRelpProtocolError(props.id())
+					fwder.ForwardFail(connID, txnr, failTooLarge)
+					return
+				}
 				if len(data) == 0 {
-					fwder.ForwardSucc(connID, txnr)
+					relpEmptyFramesCounter.WithLabelValues(props.id()).Inc()
+					switch props.EmptyFrames {
+					case "reject":
+						countRelpProtocolError(props.id())
+						fwder.ForwardFail(connID, txnr, failEmpty)
+					case "keepalive":
+						relpKeepalivesCounter.WithLabelValues(props.id()).Inc()
+						fwder.ForwardSucc(connID, txnr)
+					default:
+						fwder.ForwardSucc(connID, txnr)
+					}
 					return
 				}
-				if msiz > 0 && len(data) > msiz {
-					countRelpProtocolError(props.Client)
-					e.Err = fmt.Errorf("Message too large: %d > %d", len(data), msiz)
+				if fwder.Replayed(connID, txnr, data) {
 					return
 				}
 				rawmsg := factory(data)
 				rawmsg.Txnr = txnr
 				rawmsg.ConnID = connID
-				err := rawq.Put(rawmsg)
+				err := batch.put(rawmsg)
+				if err != nil {
+					e.Err = err
+					return
+				}
+				incomingCounter(base.RELP, props, len(data))
+			},
+			"after_abort": func(e *fsm.Event) {
+				// the client cancels the transactions in progress, but keeps
+				// the session
+				txnr := e.Args[0].(int32)
+				err := batch.flush()
 				if err != nil {
-					e.Err = eerrors.Fatal(eerrors.Wrap(err, "Failed to enqueue new raw RELP message"))
+					e.Err = err
 					return
 				}
-				incomingCounter(base.RELP, props)
+				// the responses goroutine answers the abort command
+				n := fwder.Abort(connID, txnr)
+				l.Debug("Received 'abort' command", "discarded", n)
 			},
 			"enter_closed": func(e *fsm.Event) {
 				txnr := e.Args[0].(int32)
-				fmt.Fprintf(conn, "%d rsp 0\n0 serverclose 0\n", txnr)
+				err := batch.flush()
+				if err != nil {
+					e.Err = err
+					return
+				}
+				err = writeFull(conn, []byte(fmt.Sprintf("%d rsp 0\n0 serverclose 0\n", txnr)))
+				if err != nil {
+					e.Err = eerrors.Wrap(err, "Failed to answer the RELP close command")
+					return
+				}
 				l.Debug("Received 'close' command")
 				e.Err = io.EOF
 			},
 			"enter_opened": func(e *fsm.Event) {
 				txnr := e.Args[0].(int32)
 				data := e.Args[1].([]byte)
-				fmt.Fprintf(conn, "%d rsp %d 200 OK\n%s\n", txnr, len(data)+7, string(data))
+				if props.ClientID != nil && len(props.ClientIDOffer) > 0 {
+					if id := relpOfferValue(data, props.ClientIDOffer); len(id) > 0 {
+						props.ClientID.Store(id)
+						if props.ReplayGracePeriod > 0 {
+							fwder.EnableReplay(connID, id, props.ReplayGracePeriod)
+						}
+					}
+					l = l.New("client_id", props.id())
+				}
+				offer := negotiateRelpOffer(data, props.TLS)
+				reject := len(offer.mismatch) > 0 && props.OfferMismatch == "reject"
+				rsp := offer.response(props.OpenOffers, reject)
+				if reject {
+					// the client requires a capability that we do not
+					// support: answer with an error offer and close
+					countRelpProtocolError(props.id())
+					err := writeFull(conn, []byte(fmt.Sprintf("%d rsp %d %s\n0 serverclose 0\n", txnr, len(rsp), rsp)))
+					if err != nil {
+						e.Err = eerrors.Wrap(err, "Failed to answer the RELP open command")
+						return
+					}
+					l.Info("The RELP open offer requires an unsupported capability", "capability", offer.mismatch)
+					e.Err = io.EOF
+					return
+				}
+				err := writeFull(conn, []byte(fmt.Sprintf("%d rsp %d %s\n", txnr, len(rsp), rsp)))
+				if err != nil {
+					e.Err = eerrors.Wrap(err, "Failed to answer the RELP open command")
+					return
+				}
+				if len(offer.mismatch) > 0 {
+					l.Debug("The RELP open offer requires an unsupported capability", "capability", offer.mismatch)
+				}
 				l.Debug("Received 'open' command")
 			},
 		},
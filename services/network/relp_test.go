@@ -0,0 +1,1219 @@
+package network
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/inconshreveable/log15"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/decoders"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/services/base"
+	"github.com/stephane-martin/skewer/utils"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+	"github.com/stephane-martin/skewer/utils/queue/failq"
+	"github.com/stephane-martin/skewer/utils/queue/intq"
+	"github.com/stephane-martin/skewer/utils/queue/tcp"
+	"go.uber.org/atomic"
+)
+
+func TestAckForwarderStopUnderLoad(t *testing.T) {
+	f := newAckForwarder()
+	var producers sync.WaitGroup
+	var consumers sync.WaitGroup
+	stopProducing := make(chan struct{})
+
+	for i := 0; i < 16; i++ {
+		connID := f.AddConn(1024)
+		producers.Add(1)
+		go func(connID utils.MyULID) {
+			defer producers.Done()
+			var txnr int32
+			for {
+				select {
+				case <-stopProducing:
+					return
+				default:
+				}
+				txnr++
+				f.Received(connID, txnr)
+				if txnr%3 == 0 {
+					f.ForwardFail(connID, txnr, failStore)
+				} else {
+					f.ForwardSucc(connID, txnr)
+				}
+			}
+		}(connID)
+		consumers.Add(1)
+		go func(connID utils.MyULID) {
+			defer consumers.Done()
+			for {
+				succ, fail := f.GetSuccAndFail(connID)
+				if succ == -1 && fail.Txnr == -1 {
+					return
+				}
+				f.NextToCommit(connID)
+			}
+		}(connID)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	// same order as RelpService.Stop
+	close(stopProducing)
+	producers.Wait()
+	f.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		consumers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("GetSuccAndFail did not return after Stop()")
+	}
+	f.RemoveAll()
+
+	count := 0
+	f.succ.Range(func(k, v interface{}) bool {
+		count++
+		return true
+	})
+	if count != 0 {
+		t.Errorf("RemoveAll() left %d queues", count)
+	}
+}
+
+func TestAckForwarderTransactions(t *testing.T) {
+	f := newAckForwarder()
+	connID := f.AddConn(16)
+	defer f.RemoveAll()
+	for txnr := int32(1); txnr <= 5; txnr++ {
+		f.Received(connID, txnr)
+	}
+	if next := f.NextToCommit(connID); next != 1 {
+		t.Fatalf("unexpected next transaction to commit: %d", next)
+	}
+	// 2 and 3 are answered before 1: the responses goroutine holds them
+	f.ForwardSucc(connID, 3)
+	f.ForwardFail(connID, 2, "failed")
+	success, failure := f.GetSuccAndFail(connID)
+	if success != 3 || failure.Txnr != 2 {
+		t.Fatalf("unexpected answers: %d, %v", success, failure)
+	}
+	f.ForwardSucc(connID, 4)
+
+	var sessions relpSessions
+	sessions.add(connID, &relpSession{client: "10.0.0.1:41514"})
+	for i := 0; i < 2; i++ {
+		// taking a snapshot does not modify the state
+		txns := sessions.transactions(f)
+		if len(txns) != 1 {
+			t.Fatalf("unexpected transactions: %+v", txns)
+		}
+		txn := txns[0]
+		if txn.ConnID != connID.String() || txn.Client != "10.0.0.1:41514" {
+			t.Errorf("unexpected connection: %s, %s", txn.ConnID, txn.Client)
+		}
+		if txn.NextToCommit != 1 || txn.Unanswered != 5 {
+			t.Errorf("unexpected state: next %d, unanswered %d", txn.NextToCommit, txn.Unanswered)
+		}
+		if fmt.Sprint(txn.Received) != "[2 3 4 5]" || fmt.Sprint(txn.Succeeded) != "[3 4]" {
+			t.Errorf("unexpected transactions: received %v, succeeded %v", txn.Received, txn.Succeeded)
+		}
+		if len(txn.Failed) != 1 || txn.Failed[0].Txnr != 2 || txn.Failed[0].Reason != "failed" {
+			t.Errorf("unexpected failed transactions: %v", txn.Failed)
+		}
+	}
+
+	f.Answered(connID, 1)
+	txn, _ := f.Transactions(connID)
+	if txn.NextToCommit != -1 || txn.Unanswered != 4 {
+		t.Errorf("unexpected state after the answer: next %d, unanswered %d", txn.NextToCommit, txn.Unanswered)
+	}
+	if next := f.NextToCommit(connID); next != 2 {
+		t.Fatalf("unexpected next transaction to commit: %d", next)
+	}
+}
+
+func TestRelpOpenResponse(t *testing.T) {
+	offer := []byte("relp_version=0\nrelp_software=librelp,1.2.16\ncommands=syslog,starttls")
+	rsp := string(negotiateRelpOffer(offer, false).response([]string{"compression=none"}, false))
+	expected := "200 OK\nrelp_version=0\nrelp_software=skewer\ncommands=syslog\ncompression=none"
+	if rsp != expected {
+		t.Fatalf("unexpected open response: %q", rsp)
+	}
+
+	// the client did not offer any command we support
+	n := negotiateRelpOffer([]byte("relp_version=0\ncommands=starttls"), false)
+	if n.mismatch != "commands" {
+		t.Fatalf("unexpected mismatch: %q", n.mismatch)
+	}
+	rsp = string(n.response(nil, false))
+	expected = "200 OK\nrelp_version=0\nrelp_software=skewer\ncommands="
+	if rsp != expected {
+		t.Fatalf("unexpected open response: %q", rsp)
+	}
+	rsp = string(n.response(nil, true))
+	expected = "500 unsupported commands\nrelp_version=0\nrelp_software=skewer\ncommands="
+	if rsp != expected {
+		t.Fatalf("unexpected error offer: %q", rsp)
+	}
+
+	// without a commands offer, all supported commands are advertised
+	rsp = string(negotiateRelpOffer([]byte("relp_version=0"), false).response(nil, false))
+	expected = "200 OK\nrelp_version=0\nrelp_software=skewer\ncommands=syslog"
+	if rsp != expected {
+		t.Fatalf("unexpected open response: %q", rsp)
+	}
+}
+
+func TestRelpOfferIntersection(t *testing.T) {
+	offer := []byte("relp_version=2\ncommands=syslog,starttls,unknown\ncompression=zlib, none\ntls=optional")
+	n := negotiateRelpOffer(offer, false)
+	if len(n.mismatch) > 0 {
+		t.Fatalf("unexpected mismatch: %q", n.mismatch)
+	}
+	// the negotiated capabilities replace the configured offers
+	rsp := string(n.response([]string{"compression=none", "tls=on", "x-site=paris"}, false))
+	expected := "200 OK\nrelp_version=0\nrelp_software=skewer\ncommands=syslog\ncompression=none\ntls=off\nx-site=paris"
+	if rsp != expected {
+		t.Fatalf("unexpected open response: %q", rsp)
+	}
+
+	n = negotiateRelpOffer([]byte("commands=syslog\ntls=required"), true)
+	if len(n.mismatch) > 0 || n.tls != "on" {
+		t.Fatalf("TLS should be negotiated on a TLS connection: %+v", n)
+	}
+
+	mismatches := map[string]string{
+		"relp_version=abc\ncommands=syslog":   "relp_version",
+		"relp_version=-1\ncommands=syslog":    "relp_version",
+		"commands=starttls":                   "commands",
+		"commands=syslog\ncompression=zlib":   "compression",
+		"commands=syslog\ntls=required":       "tls",
+		"compression=zlib\ncommands=starttls": "commands",
+	}
+	for offer, expected := range mismatches {
+		if n := negotiateRelpOffer([]byte(offer), false); n.mismatch != expected {
+			t.Errorf("offer %q: expected mismatch %q, got %q", offer, expected, n.mismatch)
+		}
+	}
+}
+
+func TestRelpScanOfferMismatch(t *testing.T) {
+	initRelpRegistry()
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	offer := "relp_version=0\ncommands=syslog\ncompression=zlib"
+
+	for _, policy := range []string{"reject", "accept"} {
+		f := newAckForwarder()
+		connID := f.AddConn(16)
+		rawq := tcp.NewRing(16)
+		server, client := net.Pipe()
+		responses := make(chan string)
+		go func() {
+			content, _ := ioutil.ReadAll(client)
+			responses <- string(content)
+		}()
+		go func() {
+			fmt.Fprintf(client, "1 open %d %s\n", len(offer), offer)
+			fmt.Fprintf(client, "2 syslog 5 hello\n")
+			fmt.Fprintf(client, "3 close 0\n")
+		}()
+		err := scan(logger, f, rawq, server, 0, utils.NewUid(), connID, 100, conf.DecoderBaseConfig{}, tcpProps{OfferMismatch: policy})
+		_ = server.Close()
+		if err != io.EOF {
+			t.Fatalf("%s: unexpected scan result: %v", policy, err)
+		}
+		content := <-responses
+		if policy == "accept" {
+			if !strings.HasPrefix(content, "1 rsp 75 200 OK\n") || rawq.Len() != 1 {
+				t.Fatalf("accept: the session should go on: %q", content)
+			}
+			continue
+		}
+		expected := "1 rsp 96 500 unsupported compression\nrelp_version=0\nrelp_software=skewer\ncommands=syslog\ncompression=none\n0 serverclose 0\n"
+		if content != expected {
+			t.Fatalf("reject: unexpected responses: %q", content)
+		}
+		if rawq.Len() != 0 {
+			t.Fatal("reject: the messages after a rejected offer should be ignored")
+		}
+	}
+}
+
+func TestWriteFailureReason(t *testing.T) {
+	f := newAckForwarder()
+	connID := f.AddConn(16)
+	f.ForwardFail(connID, 3, failParse)
+	succ, fail := f.GetSuccAndFail(connID)
+	if succ != -1 || fail.Txnr != 3 || fail.Reason != failParse {
+		t.Fatalf("unexpected ACKs: success=%d failure=%v", succ, fail)
+	}
+
+	server, client := net.Pipe()
+	go func() {
+		_ = writeFailure(server, fail.Txnr, fail.Reason)
+		_ = server.Close()
+	}()
+	line, err := bufio.NewReader(client).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "3 rsp 58 500 KO reason=parse_error the message could not be decoded\n"
+	if line != expected {
+		t.Fatalf("unexpected rsp: %q", line)
+	}
+}
+
+func TestRelpScanPreservesData(t *testing.T) {
+	initRelpRegistry()
+	f := newAckForwarder()
+	connID := f.AddConn(16)
+	rawq := tcp.NewRing(16)
+
+	message := "  first line\n\tsecond line \r\nlast line  "
+	server, client := net.Pipe()
+	go func() {
+		// drain the open and close responses
+		_, _ = ioutil.ReadAll(client)
+	}()
+	go func() {
+		fmt.Fprintf(client, "1 open 0\n")
+		fmt.Fprintf(client, "2 syslog %d %s\n", len(message), message)
+		fmt.Fprintf(client, "3 syslog 200 %s\n", strings.Repeat("x", 200))
+		fmt.Fprintf(client, "4 syslog 5 hello\n")
+		fmt.Fprintf(client, "5 close 0\n")
+	}()
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	err := scan(logger, f, rawq, server, 0, utils.NewUid(), connID, 100, conf.DecoderBaseConfig{}, tcpProps{})
+	_ = server.Close()
+	if err != io.EOF {
+		t.Fatalf("unexpected scan result: %v", err)
+	}
+
+	if rawq.Len() != 2 {
+		t.Fatalf("expected 2 raw messages, got %d", rawq.Len())
+	}
+	raw, _ := rawq.Get()
+	if string(raw.Message) != message || raw.Txnr != 2 {
+		t.Fatalf("the message was modified: %q", string(raw.Message))
+	}
+	raw, _ = rawq.Get()
+	if string(raw.Message) != "hello" || raw.Txnr != 4 {
+		t.Fatalf("the message after the oversized one is wrong: %q", string(raw.Message))
+	}
+
+	// the oversized message is NACKed instead of being truncated
+	succ, fail := f.GetSuccAndFail(connID)
+	if succ != -1 || fail.Txnr != 3 || fail.Reason != failTooLarge {
+		t.Fatalf("unexpected ACKs: success=%d failure=%v", succ, fail)
+	}
+}
+
+func TestRelpAbort(t *testing.T) {
+	initRelpRegistry()
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	s := &RelpService{forwarder: newAckForwarder(), errLogger: logger}
+	f := s.forwarder
+	connID := f.AddConn(16)
+	defer f.RemoveConn(connID)
+	rawq := tcp.NewRing(16)
+
+	server, client := net.Pipe()
+	responses := make(chan string, 16)
+	go func() {
+		scanner := bufio.NewScanner(client)
+		for scanner.Scan() {
+			if fields := strings.Fields(scanner.Text()); len(fields) > 1 && fields[1] == "rsp" {
+				responses <- scanner.Text()
+			}
+		}
+		close(responses)
+	}()
+	go func() {
+		_ = s.handleResponses(server, connID, atomic.NewString("test"), logger)
+	}()
+	scanned := make(chan error)
+	go func() {
+		scanned <- scan(logger, f, rawq, server, 0, utils.NewUid(), connID, 100, conf.DecoderBaseConfig{}, tcpProps{Client: "test"})
+	}()
+	nextResponse := func() string {
+		select {
+		case rsp := <-responses:
+			return rsp
+		case <-time.After(time.Second):
+			return ""
+		}
+	}
+
+	fmt.Fprintf(client, "1 open 0\n")
+	if rsp := nextResponse(); !strings.HasPrefix(rsp, "1 rsp ") {
+		t.Fatalf("unexpected open response: %q", rsp)
+	}
+	fmt.Fprintf(client, "2 syslog 5 first\n")
+	fmt.Fprintf(client, "3 syslog 6 second\n")
+	for i := 0; i < 2; i++ {
+		if _, err := rawq.Poll(time.Second); err != nil {
+			t.Fatal("the messages were not received")
+		}
+	}
+	// the responses goroutine waits for the answer of 2 when abort arrives
+	f.ForwardSucc(connID, 3)
+	deadline := time.Now().Add(time.Second)
+	for txn, _ := f.Transactions(connID); txn.NextToCommit != 2; txn, _ = f.Transactions(connID) {
+		if time.Now().After(deadline) {
+			t.Fatal("the responses goroutine does not wait for 2")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	fmt.Fprintf(client, "4 abort 0\n")
+	if rsp := nextResponse(); rsp != "4 rsp 6 200 OK" {
+		t.Fatalf("unexpected abort response: %q", rsp)
+	}
+
+	// the late answer of an aborted transaction is not sent
+	f.ForwardSucc(connID, 2)
+	fmt.Fprintf(client, "5 syslog 5 third\n")
+	raw, err := rawq.Poll(time.Second)
+	if err != nil || raw.Txnr != 5 {
+		t.Fatal("the message after the abort was not received")
+	}
+	f.ForwardSucc(connID, 5)
+	if rsp := nextResponse(); rsp != "5 rsp 6 200 OK" {
+		t.Fatalf("unexpected response after the abort: %q", rsp)
+	}
+	if n := f.Unanswered(connID); n != 0 {
+		t.Errorf("unexpected unanswered transactions: %d", n)
+	}
+
+	fmt.Fprintf(client, "6 close 0\n")
+	if err := <-scanned; err != io.EOF {
+		t.Fatalf("the abort command should not end the session: %v", err)
+	}
+	_ = server.Close()
+}
+
+func TestRelpScanConnectionLost(t *testing.T) {
+	initRelpRegistry()
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	lost := func(cause, client string) float64 {
+		m := &dto.Metric{}
+		_ = relpLostCounter.WithLabelValues(cause, client).Write(m)
+		return m.GetCounter().GetValue()
+	}
+
+	for _, reset := range []bool{false, true} {
+		cause := "eof"
+		if reset {
+			cause = "reset"
+		}
+		client := "lost-" + cause
+		before := lost(cause, client)
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			conn, err := net.Dial("tcp", listener.Addr().String())
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(conn, "1 open 0\n")
+			fmt.Fprintf(conn, "2 syslog 5 first\n")
+			fmt.Fprintf(conn, "3 syslog 6 second\n")
+			// the client disappears in the middle of the transactions
+			time.Sleep(50 * time.Millisecond)
+			if reset {
+				_ = conn.(*net.TCPConn).SetLinger(0)
+				_ = conn.Close()
+				return
+			}
+			_ = conn.(*net.TCPConn).CloseWrite()
+			_, _ = ioutil.ReadAll(conn)
+			_ = conn.Close()
+		}()
+		server, err := listener.Accept()
+		_ = listener.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f := newAckForwarder()
+		connID := f.AddConn(16)
+		rawq := tcp.NewRing(16)
+		err = scan(logger, f, rawq, server, 0, utils.NewUid(), connID, 100, conf.DecoderBaseConfig{}, tcpProps{Client: client})
+		_ = server.Close()
+		if reset != eerrors.HasErrno(err, syscall.ECONNRESET) {
+			t.Fatalf("%s: unexpected scan result: %v", cause, err)
+		}
+		if rawq.Len() != 2 {
+			t.Fatalf("%s: expected 2 raw messages, got %d", cause, rawq.Len())
+		}
+
+		// the transactions in progress are NACKed and forgotten
+		for _, txnr := range []int32{2, 3} {
+			succ, fail := f.GetSuccAndFail(connID)
+			if succ != -1 || fail.Txnr != txnr || fail.Reason != failLost {
+				t.Fatalf("%s: unexpected ACKs: success=%d failure=%v", cause, succ, fail)
+			}
+		}
+		if next := f.NextToCommit(connID); next != -1 {
+			t.Fatalf("%s: the transaction %d still waits for an answer", cause, next)
+		}
+		if n := f.Unanswered(connID); n != 0 {
+			t.Fatalf("%s: %d transactions are still unanswered", cause, n)
+		}
+		if lost(cause, client)-before != 2 {
+			t.Errorf("%s: the lost transactions were not counted", cause)
+		}
+	}
+}
+
+func TestRelpScanBatching(t *testing.T) {
+	initRelpRegistry()
+	f := newAckForwarder()
+	connID := f.AddConn(16)
+	rawq := tcp.NewRing(16)
+
+	server, client := net.Pipe()
+	go func() {
+		_, _ = ioutil.ReadAll(client)
+	}()
+	closeSession := make(chan struct{})
+	go func() {
+		fmt.Fprintf(client, "1 open 0\n")
+		for i := 2; i <= 7; i++ {
+			fmt.Fprintf(client, "%d syslog 8 message%d\n", i, i)
+		}
+		<-closeSession
+		fmt.Fprintf(client, "8 close 0\n")
+	}()
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	scanned := make(chan error)
+	go func() {
+		scanned <- scan(logger, f, rawq, server, 0, utils.NewUid(), connID, 100, conf.DecoderBaseConfig{}, tcpProps{BatchSize: 4})
+	}()
+
+	// the incomplete batch is pushed when the client stops sending
+	deadline := time.Now().Add(time.Second)
+	for rawq.Len() < 6 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if rawq.Len() != 6 {
+		t.Fatalf("expected 6 raw messages, got %d", rawq.Len())
+	}
+	close(closeSession)
+	err := <-scanned
+	_ = server.Close()
+	if err != io.EOF {
+		t.Fatalf("unexpected scan result: %v", err)
+	}
+
+	batch := make([]*model.RawTCPMessage, 16)
+	n, _ := rawq.PollBatch(batch, -1)
+	if n != 6 {
+		t.Fatalf("expected 6 raw messages, got %d", n)
+	}
+	for i, raw := range batch[:n] {
+		if raw.Txnr != int32(i+2) || string(raw.Message) != fmt.Sprintf("message%d", i+2) {
+			t.Fatalf("unexpected message %d: txnr=%d %q", i, raw.Txnr, string(raw.Message))
+		}
+	}
+	// the transactions are waited for as without batching
+	if next := f.NextToCommit(connID); next != 2 {
+		t.Fatalf("unexpected next transaction to commit: %d", next)
+	}
+}
+
+func TestRelpPendingAnswers(t *testing.T) {
+	a := newRelpPendingAnswers()
+	none := failq.Failure{Txnr: -1}
+	a.add(3, none)
+	a.add(-1, failq.Failure{Txnr: 2, Reason: "failed"})
+	a.add(-1, failq.Failure{Txnr: 3, Reason: "late"})
+	if _, _, ok := a.take(1); ok || a.len() != 2 {
+		t.Fatalf("the answer of 1 has not arrived: %d", a.len())
+	}
+	a.add(1, none)
+	for txnr := int32(1); txnr <= 3; txnr++ {
+		reason, success, ok := a.take(txnr)
+		if !ok || success != (txnr != 2) || (txnr == 2 && reason != "failed") {
+			t.Fatalf("unexpected answer of %d: %v %v %q", txnr, ok, success, reason)
+		}
+	}
+	// the answered transactions are forgotten, and their duplicates ignored
+	a.add(2, none)
+	if a.len() != 0 {
+		t.Fatalf("the answered transactions should be forgotten: %d", a.len())
+	}
+	// the answers of the aborted transactions are dropped
+	a.add(5, none)
+	a.add(7, none)
+	if _, _, ok := a.take(7); !ok || a.len() != 0 {
+		t.Fatalf("the skipped transactions should be dropped: %d", a.len())
+	}
+}
+
+func TestRelpPendingAnswersConflict(t *testing.T) {
+	a := newRelpPendingAnswers()
+	none := failq.Failure{Txnr: -1}
+
+	// returned together, as a quarantined message NACKed to the client
+	// while its raw content is stored: the failure wins
+	a.add(1, failq.Failure{Txnr: 1, Reason: "quarantined"})
+	if reason, success, ok := a.take(1); !ok || success || reason != "quarantined" {
+		t.Fatalf("the failure should win: %v %v %q", ok, success, reason)
+	}
+
+	// returned separately: the first answer wins
+	a.add(2, none)
+	a.add(-1, failq.Failure{Txnr: 2, Reason: "late"})
+	if reason, success, ok := a.take(2); !ok || !success || reason != "" {
+		t.Fatalf("the first success should win: %v %v %q", ok, success, reason)
+	}
+	a.add(-1, failq.Failure{Txnr: 3, Reason: "failed"})
+	a.add(3, none)
+	if reason, success, ok := a.take(3); !ok || success || reason != "failed" {
+		t.Fatalf("the first failure should win: %v %v %q", ok, success, reason)
+	}
+	if a.len() != 0 {
+		t.Fatalf("the conflicting answers should be forgotten: %d", a.len())
+	}
+}
+
+func TestRelpMaxPendingAnswers(t *testing.T) {
+	initRelpRegistry()
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	const max = 8
+	const total = 200
+	s := &RelpService{forwarder: newAckForwarder(), errLogger: logger}
+	f := s.forwarder
+	connID := f.AddConn(1024)
+	rawq := tcp.NewRing(1024)
+
+	server, client := net.Pipe()
+	answers := make(chan []string)
+	go func() {
+		var txnrs []string
+		scanner := bufio.NewScanner(client)
+		for scanner.Scan() {
+			if fields := strings.Fields(scanner.Text()); len(fields) > 1 && fields[1] == "rsp" {
+				txnrs = append(txnrs, fields[0])
+			}
+		}
+		answers <- txnrs
+	}()
+	go func() {
+		fmt.Fprintf(client, "1 open 0\n")
+		for i := 2; i <= total+1; i++ {
+			fmt.Fprintf(client, "%d syslog 5 hello\n", i)
+		}
+		fmt.Fprintf(client, "%d close 0\n", total+2)
+	}()
+	go func() {
+		_ = s.handleResponses(server, connID, atomic.NewString("test"), logger)
+	}()
+	scanned := make(chan error)
+	go func() {
+		scanned <- scan(logger, f, rawq, server, 0, utils.NewUid(), connID, 100, conf.DecoderBaseConfig{}, tcpProps{Client: "test", MaxPendingAnswers: max})
+	}()
+
+	// the first transaction is slow: the answers of the next ones wait
+	received := 0
+	for {
+		raw, err := rawq.Poll(100 * time.Millisecond)
+		if err != nil {
+			break
+		}
+		received++
+		if raw.Txnr != 2 {
+			f.ForwardSucc(connID, raw.Txnr)
+		}
+		txn, _ := f.Transactions(connID)
+		if txn.Unanswered > max || len(txn.Succeeded) > max {
+			t.Fatalf("the backlog exceeds the cap: %d unanswered, %d answers", txn.Unanswered, len(txn.Succeeded))
+		}
+	}
+	if received != max {
+		t.Fatalf("the connection should stop reading at %d transactions, got %d", max, received)
+	}
+
+	// the backlog is answered, and the connection reads again
+	f.ForwardSucc(connID, 2)
+	for received < total {
+		raw, err := rawq.Poll(time.Second)
+		if err != nil {
+			t.Fatalf("only %d messages were received", received)
+		}
+		received++
+		f.ForwardSucc(connID, raw.Txnr)
+	}
+	err := <-scanned
+	if err != io.EOF {
+		t.Fatalf("unexpected scan result: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for f.Unanswered(connID) > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	f.RemoveConn(connID)
+	_ = server.Close()
+	// the close command is answered at once, the transactions in order
+	var txnrs []string
+	for _, txnr := range <-answers {
+		if txnr != strconv.Itoa(total+2) {
+			txnrs = append(txnrs, txnr)
+		}
+	}
+	if len(txnrs) != total+1 {
+		t.Fatalf("expected %d answers, got %d", total+1, len(txnrs))
+	}
+	for i, txnr := range txnrs {
+		if txnr != strconv.Itoa(i+1) {
+			t.Fatalf("the answers are not in order: %v", txnrs)
+		}
+	}
+}
+
+// countingConn counts the writes to the connection.
+type countingConn struct {
+	net.Conn
+	writes int
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	c.writes++
+	return c.Conn.Write(b)
+}
+
+func BenchmarkRelpResponsesBatching(b *testing.B) {
+	initRelpRegistry()
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	s := &RelpService{forwarder: newAckForwarder(), errLogger: logger}
+	connID := s.forwarder.AddConn(uint64(b.N + 1))
+	server, client := net.Pipe()
+	conn := &countingConn{Conn: server}
+
+	received := make(chan int)
+	go func() {
+		scanner := bufio.NewScanner(client)
+		count := 0
+		for scanner.Scan() {
+			count++
+			if count == b.N {
+				break
+			}
+		}
+		received <- count
+		_, _ = io.Copy(ioutil.Discard, client)
+	}()
+
+	b.ResetTimer()
+	// the sender is faster than the response goroutine
+	go func() {
+		for i := 1; i <= b.N; i++ {
+			s.forwarder.Received(connID, int32(i))
+			s.forwarder.ForwardSucc(connID, int32(i))
+		}
+	}()
+	done := make(chan struct{})
+	go func() {
+		_ = s.handleResponses(conn, connID, atomic.NewString("bench"), logger)
+		close(done)
+	}()
+	if n := <-received; n != b.N {
+		b.Fatalf("expected %d responses, got %d", b.N, n)
+	}
+	b.StopTimer()
+	s.forwarder.RemoveConn(connID)
+	<-done
+	_ = server.Close()
+	b.ReportMetric(float64(conn.writes)/float64(b.N), "writes/op")
+}
+
+// BenchmarkRelpAckLatency measures the round-trip of a synchronous RELP
+// client that waits for each answer before sending the next message, with
+// and without TCP_NODELAY on the server side of the connection.
+func BenchmarkRelpAckLatency(b *testing.B) {
+	for _, nodelay := range []string{"on", "off"} {
+		b.Run("nodelay="+nodelay, func(b *testing.B) {
+			benchmarkRelpAckLatency(b, nodelay)
+		})
+	}
+}
+
+func benchmarkRelpAckLatency(b *testing.B, nodelay string) {
+	initRelpRegistry()
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	s := &RelpService{forwarder: newAckForwarder(), errLogger: logger}
+	connID := s.forwarder.AddConn(uint64(b.N + 1))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = server.Close() }()
+		setNoDelay(server, nodelay)
+		go func() {
+			_ = s.handleResponses(server, connID, atomic.NewString("bench"), logger)
+		}()
+		// each line of the client is a transaction that succeeds at once
+		scanner := bufio.NewScanner(server)
+		var txnr int32
+		for scanner.Scan() {
+			txnr++
+			s.forwarder.Received(connID, txnr)
+			s.forwarder.ForwardSucc(connID, txnr)
+		}
+		s.forwarder.RemoveConn(connID)
+	}()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	answers := bufio.NewScanner(client)
+	answers.Split(utils.RelpSplit)
+	msg := []byte("<13>1 2018-01-01T00:00:00Z host app - - - message\n")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// the message is sent in two parts, like the clients that write
+		// the frame header before the payload
+		_, _ = client.Write(msg[:10])
+		_, _ = client.Write(msg[10:])
+		if !answers.Scan() {
+			b.Fatalf("no answer: %v", answers.Err())
+		}
+	}
+	b.StopTimer()
+	_ = client.Close()
+	<-done
+}
+
+func TestRelpUnknownParser(t *testing.T) {
+	initRelpRegistry()
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	s := &RelpService{
+		forwarder: newAckForwarder(),
+		errLogger: logger,
+		parserEnv: decoders.NewParsersEnv(nil, logger),
+		stats:     newParseStats(base.RELP, 1),
+	}
+	connID := s.forwarder.AddConn(16)
+
+	newRawQ := func(action string) *tcp.Ring {
+		q := tcp.NewRing(16)
+		for txnr := int32(1); txnr <= 2; txnr++ {
+			raw := model.RawTCPFactory([]byte("hello"))
+			raw.ConnID = connID
+			raw.Txnr = txnr
+			raw.Decoder.Format = "nosuchparser"
+			raw.Decoder.UnknownParserAction = action
+			_ = q.Put(raw)
+		}
+		q.Dispose()
+		return q
+	}
+
+	// a message with an unknown format does not stop the parse worker
+	s.rawQ = newRawQ("skip")
+	err := s.parseFrom(s.rawQ)
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	for txnr := int32(1); txnr <= 2; txnr++ {
+		succ, fail := s.forwarder.GetSuccAndFail(connID)
+		if succ != -1 || fail.Txnr != txnr || fail.Reason != failUnknown {
+			t.Fatalf("unexpected ACKs: success=%d failure=%v", succ, fail)
+		}
+	}
+
+	s.rawQ = newRawQ("fail")
+	err = s.parseFrom(s.rawQ)
+	if !eerrors.IsFatal(err) {
+		t.Fatalf("expected a fatal error, got: %v", err)
+	}
+	succ, fail := s.forwarder.GetSuccAndFail(connID)
+	if succ != -1 || fail.Txnr != 1 || fail.Reason != failUnknown {
+		t.Fatalf("unexpected ACKs: success=%d failure=%v", succ, fail)
+	}
+}
+
+func TestRelpQuarantine(t *testing.T) {
+	initRelpRegistry()
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+
+	// the reporter writes the stashed messages to the quarantine sink
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reporter := base.NewReporter("relp", logger, w)
+	reporter.SetSecret(nil)
+	reporter.Start()
+	defer reporter.Stop()
+	sink := make(chan *model.FullMessage, 4)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		scanner.Split(utils.MakeFrameSplit(nil, 1<<20))
+		for scanner.Scan() {
+			msg, err := model.FromBuf(proto.NewBuffer(scanner.Bytes()))
+			if err != nil {
+				return
+			}
+			sink <- msg
+		}
+	}()
+
+	s := &RelpService{
+		forwarder: newAckForwarder(),
+		errLogger: logger,
+		parserEnv: decoders.NewParsersEnv(nil, logger),
+		stats:     newParseStats(base.RELP, 1),
+		reporter:  reporter,
+	}
+	connID := s.forwarder.AddConn(16)
+	gen := utils.NewGenerator()
+
+	for txnr, answer := range []string{"ack", "nack"} {
+		raw := model.RawTCPFactory([]byte("{not json"))
+		raw.ConnID = connID
+		raw.Txnr = int32(txnr + 1)
+		raw.Client = "10.0.0.1"
+		raw.Decoder = conf.DecoderBaseConfig{Format: "json", Charset: "utf8", ParseErrorAction: "quarantine", QuarantineAnswer: answer}
+		s.rawQ = tcp.NewRing(16)
+		err = s.parseRaw(raw, gen)
+		if err != nil {
+			t.Fatalf("unexpected parse error: %v", err)
+		}
+
+		select {
+		case msg := <-sink:
+			if msg.Fields.Message != "{not json" || msg.Fields.GetProperty("skewer", "quarantine") != "decoding" {
+				t.Fatalf("unexpected quarantined message: %q %v", msg.Fields.Message, msg.Fields.GetAllProperties())
+			}
+			if msg.ClientAddr != "10.0.0.1" || msg.SourceType != "relp" {
+				t.Fatalf("the source metadata were not delivered: %s %s", msg.ClientAddr, msg.SourceType)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("the raw message did not reach the quarantine")
+		}
+
+		succ, fail := s.forwarder.GetSuccAndFail(connID)
+		if answer == "ack" && (succ != 1 || fail.Txnr != -1) {
+			t.Fatalf("the quarantined message should be ACKed: success=%d failure=%v", succ, fail)
+		}
+		if answer == "nack" && (succ != -1 || fail.Txnr != 2 || fail.Reason != failParse) {
+			t.Fatalf("the quarantined message should be NACKed: success=%d failure=%v", succ, fail)
+		}
+	}
+}
+
+func TestRelpEndToEndAck(t *testing.T) {
+	initRelpRegistry()
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+
+	// the stashed messages are read back, as the Store would
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reporter := base.NewReporter("relp", logger, w)
+	reporter.SetSecret(nil)
+	reporter.Start()
+	defer reporter.Stop()
+	stashed := make(chan utils.MyULID, 4)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		scanner.Split(utils.MakeFrameSplit(nil, 1<<20))
+		for scanner.Scan() {
+			msg, err := model.FromBuf(proto.NewBuffer(scanner.Bytes()))
+			if err != nil {
+				return
+			}
+			stashed <- msg.Uid
+		}
+	}()
+
+	confID := utils.NewUid()
+	s := &RelpService{
+		forwarder: newAckForwarder(),
+		errLogger: logger,
+		parserEnv: decoders.NewParsersEnv(nil, logger),
+		stats:     newParseStats(base.RELP, 1),
+		reporter:  reporter,
+		rawQ:      tcp.NewRing(16),
+		configs: map[utils.MyULID]conf.RELPSourceConfig{
+			confID: {EndToEndAck: true, EndToEndAckTimeout: time.Minute},
+		},
+	}
+	connID := s.forwarder.AddConn(16)
+	gen := utils.NewGenerator()
+	succQ, _ := s.forwarder.succ.Load(connID)
+	failQ, _ := s.forwarder.fail.Load(connID)
+	answered := func() bool {
+		return succQ.(*intq.Ring).Len() > 0 || failQ.(*failq.Ring).Len() > 0
+	}
+
+	parse := func(txnr int32) utils.MyULID {
+		raw := model.RawTCPFactory([]byte("<13>1 2018-01-01T00:00:00Z host app - - - hello"))
+		raw.ConnID = connID
+		raw.ConfID = confID
+		raw.Txnr = txnr
+		raw.Decoder = conf.DecoderBaseConfig{Format: "rfc5424", Charset: "utf8"}
+		err := s.parseRaw(raw, gen)
+		if err != nil {
+			t.Fatalf("unexpected parse error: %v", err)
+		}
+		select {
+		case uid := <-stashed:
+			if answered() {
+				t.Fatalf("transaction %d was answered before the acknowledgment", txnr)
+			}
+			return uid
+		case <-time.After(5 * time.Second):
+			t.Fatalf("the message of transaction %d was not stashed", txnr)
+		}
+		return ""
+	}
+
+	// the transaction succeeds when the Store reports the delivery
+	uid := parse(1)
+	reporter.Ack([]model.Ack{{Uid: uid, OK: true}})
+	succ, fail := s.forwarder.GetSuccAndFail(connID)
+	if succ != 1 || fail.Txnr != -1 {
+		t.Fatalf("the delivered message should be ACKed: success=%d failure=%v", succ, fail)
+	}
+
+	// and fails when a destination has rejected the message
+	uid = parse(2)
+	reporter.Ack([]model.Ack{{Uid: uid, OK: false}})
+	succ, fail = s.forwarder.GetSuccAndFail(connID)
+	if succ != -1 || fail.Txnr != 2 || fail.Reason != failDelivery {
+		t.Fatalf("the rejected message should be NACKed: success=%d failure=%v", succ, fail)
+	}
+
+	// or when the acknowledgment does not come in time
+	s.configs[confID] = conf.RELPSourceConfig{EndToEndAck: true, EndToEndAckTimeout: 50 * time.Millisecond}
+	uid = parse(3)
+	succ, fail = s.forwarder.GetSuccAndFail(connID)
+	if succ != -1 || fail.Txnr != 3 || fail.Reason != failAckTimeout {
+		t.Fatalf("the unacknowledged message should be NACKed: success=%d failure=%v", succ, fail)
+	}
+	// a late acknowledgment is ignored
+	reporter.Ack([]model.Ack{{Uid: uid, OK: true}})
+	time.Sleep(50 * time.Millisecond)
+	if answered() {
+		t.Fatal("the transaction was answered twice")
+	}
+}
+
+func TestRelpStoreDown(t *testing.T) {
+	initRelpRegistry()
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _, _ = io.Copy(ioutil.Discard, r) }()
+	reporter := base.NewReporter("relp", logger, w)
+	reporter.SetSecret(nil)
+	reporter.Start()
+	defer reporter.Stop()
+
+	confID := utils.NewUid()
+	s := &RelpService{
+		forwarder: newAckForwarder(),
+		errLogger: logger,
+		parserEnv: decoders.NewParsersEnv(nil, logger),
+		stats:     newParseStats(base.RELP, 1),
+		reporter:  reporter,
+		rawQ:      tcp.NewRing(16),
+		configs:   map[utils.MyULID]conf.RELPSourceConfig{confID: {}},
+	}
+	connID := s.forwarder.AddConn(16)
+	gen := utils.NewGenerator()
+	parse := func(txnr int32) {
+		raw := model.RawTCPFactory([]byte("<13>1 2018-01-01T00:00:00Z host app - - - hello"))
+		raw.ConnID = connID
+		raw.ConfID = confID
+		raw.Txnr = txnr
+		raw.Decoder = conf.DecoderBaseConfig{Format: "rfc5424", Charset: "utf8"}
+		if err := s.parseRaw(raw, gen); err != nil {
+			t.Fatalf("unexpected parse error: %v", err)
+		}
+	}
+
+	// the messages are NACKed while the Store is down
+	reporter.SetStoreDown(true)
+	parse(1)
+	succ, fail := s.forwarder.GetSuccAndFail(connID)
+	if succ != -1 || fail.Txnr != 1 || fail.Reason != failStoreDown {
+		t.Fatalf("the message should be NACKed while the Store is down: success=%d failure=%v", succ, fail)
+	}
+
+	// and ACKed again once it has been restarted
+	reporter.SetStoreDown(false)
+	parse(2)
+	succ, fail = s.forwarder.GetSuccAndFail(connID)
+	if succ != 2 || fail.Txnr != -1 {
+		t.Fatalf("the message should be ACKed after the restart: success=%d failure=%v", succ, fail)
+	}
+}
+
+func TestRelpEmptyFrames(t *testing.T) {
+	initRelpRegistry()
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+
+	counter := func(c *base.ExpiringCounterVec, client string) float64 {
+		m := &dto.Metric{}
+		_ = c.WithLabelValues(client).Write(m)
+		return m.GetCounter().GetValue()
+	}
+
+	for _, policy := range []string{"ack", "reject", "keepalive"} {
+		client := "empty-" + policy
+		emptyBefore := counter(relpEmptyFramesCounter, client)
+		keepalivesBefore := counter(relpKeepalivesCounter, client)
+		f := newAckForwarder()
+		connID := f.AddConn(16)
+		rawq := tcp.NewRing(16)
+		server, conn := net.Pipe()
+		go func() {
+			_, _ = ioutil.ReadAll(conn)
+		}()
+		go func() {
+			fmt.Fprintf(conn, "1 open 0\n")
+			fmt.Fprintf(conn, "2 syslog 0\n")
+			fmt.Fprintf(conn, "3 close 0\n")
+		}()
+		props := tcpProps{Client: client, EmptyFrames: policy}
+		err := scan(logger, f, rawq, server, 0, utils.NewUid(), connID, 100, conf.DecoderBaseConfig{}, props)
+		_ = server.Close()
+		if err != io.EOF {
+			t.Fatalf("%s: unexpected scan result: %v", policy, err)
+		}
+		if rawq.Len() != 0 {
+			t.Fatalf("%s: the empty frame should not be parsed", policy)
+		}
+
+		succ, fail := f.GetSuccAndFail(connID)
+		if policy == "reject" {
+			if succ != -1 || fail.Txnr != 2 || fail.Reason != failEmpty {
+				t.Fatalf("%s: unexpected ACKs: success=%d failure=%v", policy, succ, fail)
+			}
+		} else if succ != 2 || fail.Txnr != -1 {
+			t.Fatalf("%s: unexpected ACKs: success=%d failure=%v", policy, succ, fail)
+		}
+		if counter(relpEmptyFramesCounter, client)-emptyBefore != 1 {
+			t.Errorf("%s: the empty frame was not counted", policy)
+		}
+		keepalives := counter(relpKeepalivesCounter, client) - keepalivesBefore
+		if (policy == "keepalive") != (keepalives == 1) {
+			t.Errorf("%s: unexpected keepalives count: %v", policy, keepalives)
+		}
+	}
+}
+
+// throttledWriter writes at most max bytes per call, as a congested
+// connection. After limit bytes, the writes fail.
+type throttledWriter struct {
+	buf   strings.Builder
+	max   int
+	limit int
+}
+
+func (w *throttledWriter) Write(b []byte) (int, error) {
+	if w.limit >= 0 && w.buf.Len() >= w.limit {
+		return 0, io.ErrClosedPipe
+	}
+	if len(b) > w.max {
+		b = b[:w.max]
+	}
+	return w.buf.Write(b)
+}
+
+func TestRelpPartialWrites(t *testing.T) {
+	initRelpRegistry()
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+
+	w := &throttledWriter{max: 3, limit: -1}
+	f := newAckForwarder()
+	connID := f.AddConn(16)
+	machine := newMachine(logger, f, newRawBatch(tcp.NewRing(16), 1), w, utils.NewUid(), connID, 100, conf.DecoderBaseConfig{}, tcpProps{})
+	if err := machine.Event("open", int32(1), []byte("relp_version=0"), 0); err != nil {
+		t.Fatalf("unexpected open error: %v", err)
+	}
+	if err := machine.Event("close", int32(2), []byte{}, 0); err != io.EOF {
+		t.Fatalf("unexpected close result: %v", err)
+	}
+	rsp := negotiateRelpOffer([]byte("relp_version=0"), false).response(nil, false)
+	expected := fmt.Sprintf("1 rsp %d %s\n2 rsp 0\n0 serverclose 0\n", len(rsp), rsp)
+	if w.buf.String() != expected {
+		t.Fatalf("unexpected responses: %q", w.buf.String())
+	}
+
+	// the buffered ACKs are written completely too
+	w = &throttledWriter{max: 5, limit: -1}
+	responses := &relpResponses{}
+	_ = writeSuccess(&responses.buf, 4)
+	_ = writeFailure(&responses.buf, 5, failParse)
+	expected = responses.buf.String()
+	if err := writeFull(w, responses.buf.Bytes()); err != nil || w.buf.String() != expected {
+		t.Fatalf("unexpected ACKs: %q (%v)", w.buf.String(), err)
+	}
+
+	// a write error stops the session
+	w = &throttledWriter{max: 3, limit: 6}
+	machine = newMachine(logger, f, newRawBatch(tcp.NewRing(16), 1), w, utils.NewUid(), connID, 100, conf.DecoderBaseConfig{}, tcpProps{})
+	err := machine.Event("open", int32(1), []byte("relp_version=0"), 0)
+	if err == nil || err == io.EOF {
+		t.Fatalf("the failed open response should stop the session: %v", err)
+	}
+	if w.buf.Len() != 6 {
+		t.Fatalf("unexpected written size: %d", w.buf.Len())
+	}
+	if err := writeFull(&throttledWriter{max: 0, limit: -1}, []byte("x")); err != io.ErrShortWrite {
+		t.Fatalf("a write without progress should fail: %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package network
+
+import (
+	"github.com/stephane-martin/skewer/utils/queue/failq"
+)
+
+// relpPendingAnswers are the answers of the transactions of a connection
+// that wait for the answer of a previous transaction, since the RELP answers
+// are sent in the order of the transactions. The answered transactions are
+// forgotten, so that the maps don't grow with the lifetime of the
+// connection.
+type relpPendingAnswers struct {
+	successes map[int32]struct{}
+	failures  map[int32]string
+	// answered is the last answered transaction. The transactions are
+	// answered in increasing order, so the ACKs of the previous ones are
+	// duplicates.
+	answered int32
+}
+
+func newRelpPendingAnswers() *relpPendingAnswers {
+	return &relpPendingAnswers{
+		successes: map[int32]struct{}{},
+		failures:  map[int32]string{},
+		answered:  -1,
+	}
+}
+
+func (a *relpPendingAnswers) known(txnr int32) bool {
+	if txnr <= a.answered {
+		return true
+	}
+	_, ok1 := a.successes[txnr]
+	_, ok2 := a.failures[txnr]
+	return ok1 || ok2
+}
+
+// add records the ACKs returned by GetSuccAndFail. The first answer of a
+// transaction wins. When both answers of a transaction are returned
+// together, the failure wins: a quarantined message is NACKed to the client
+// even though its raw content was stored successfully.
+func (a *relpPendingAnswers) add(success int32, failure failq.Failure) {
+	if failure.Txnr != -1 && !a.known(failure.Txnr) {
+		a.failures[failure.Txnr] = failure.Reason
+	}
+	if success != -1 && !a.known(success) {
+		a.successes[success] = struct{}{}
+	}
+}
+
+// take removes the answer of txnr. ok is false when the answer has not
+// arrived yet.
+func (a *relpPendingAnswers) take(txnr int32) (reason string, success bool, ok bool) {
+	if _, ok = a.successes[txnr]; ok {
+		delete(a.successes, txnr)
+		success = true
+	} else if reason, ok = a.failures[txnr]; ok {
+		delete(a.failures, txnr)
+	} else {
+		return "", false, false
+	}
+	if txnr > a.answered+1 {
+		// transactions were skipped (abort): their answers will never be
+		// sent
+		a.prune(txnr)
+	}
+	a.answered = txnr
+	return reason, success, true
+}
+
+// abort forgets the answers of the transactions that precede the abort
+// command txnr: they will never be sent.
+func (a *relpPendingAnswers) abort(txnr int32) {
+	a.prune(txnr)
+	if txnr > a.answered {
+		a.answered = txnr
+	}
+}
+
+func (a *relpPendingAnswers) prune(txnr int32) {
+	for t := range a.successes {
+		if t < txnr {
+			delete(a.successes, t)
+		}
+	}
+	for t := range a.failures {
+		if t < txnr {
+			delete(a.failures, t)
+		}
+	}
+}
+
+func (a *relpPendingAnswers) len() int {
+	return len(a.successes) + len(a.failures)
+}
@@ -0,0 +1,200 @@
+package network
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/utils"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// relpDrainTimeout is the time given to the transactions of a draining RELP
+// session to be answered, before the serverclose is sent anyway.
+const relpDrainTimeout = 10 * time.Second
+
+var errDraining = eerrors.New("The RELP session is draining")
+
+// relpSession is the connection of a RELP session. When the session is
+// drained, it stops reading new commands. Then the transactions in progress
+// are answered, and the server sends a serverclose, so that the client
+// reconnects, possibly to another server.
+type relpSession struct {
+	net.Conn
+	confID   utils.MyULID
+	port     int
+	path     string
+	client   string
+	mu       sync.Mutex
+	draining chan struct{}
+	// drained is closed when the drain goroutine returns, and scanned when
+	// the session does not read commands anymore
+	drained chan struct{}
+	scanned chan struct{}
+}
+
+func newRelpSession(conn net.Conn, confID utils.MyULID, props tcpProps) *relpSession {
+	return &relpSession{
+		Conn:     conn,
+		confID:   confID,
+		port:     props.LocalPort,
+		path:     props.Path,
+		client:   sessionClient(conn, props),
+		draining: make(chan struct{}),
+		drained:  make(chan struct{}),
+		scanned:  make(chan struct{}),
+	}
+}
+
+// sessionClient returns the address of the client, with its port when it is
+// known, so that the sessions of a client can be told apart.
+func sessionClient(conn net.Conn, props tcpProps) string {
+	if addr := conn.RemoteAddr(); addr != nil && addr.Network() != "unix" && len(addr.String()) > 0 {
+		return addr.String()
+	}
+	return props.Client
+}
+
+func (c *relpSession) isDraining() bool {
+	select {
+	case <-c.draining:
+		return true
+	default:
+		return false
+	}
+}
+
+// startDrain interrupts the read in progress, and makes the next reads fail.
+func (c *relpSession) startDrain() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.isDraining() {
+		return
+	}
+	close(c.draining)
+	_ = c.Conn.SetReadDeadline(time.Now())
+}
+
+func (c *relpSession) Read(b []byte) (int, error) {
+	if c.isDraining() {
+		return 0, errDraining
+	}
+	n, err := c.Conn.Read(b)
+	if err != nil && c.isDraining() {
+		// the read was interrupted by startDrain
+		return n, errDraining
+	}
+	return n, err
+}
+
+// SetReadDeadline does not postpone the read deadline of a draining session.
+func (c *relpSession) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.isDraining() {
+		return nil
+	}
+	return c.Conn.SetReadDeadline(t)
+}
+
+// scanReturned is called when the session does not read commands anymore.
+// When the session is draining, it waits for the end of the drain, so that
+// the connection is not removed from the forwarder too early.
+func (c *relpSession) scanReturned() {
+	if c.isDraining() {
+		<-c.drained
+	}
+	close(c.scanned)
+}
+
+// drain waits for the session to be drained, or for the end of the session.
+// When the session is drained, it waits for the answers of the transactions
+// in progress. Then the connection is removed from the forwarder, which makes
+// the responses goroutine flush the last answers and return. Eventually, the
+// serverclose is sent and the connection is closed.
+func (c *relpSession) drain(f *ackForwarder, connID utils.MyULID, responsesDone <-chan struct{}, closeConn func()) {
+	defer close(c.drained)
+	select {
+	case <-c.draining:
+	case <-c.scanned:
+		return
+	}
+	deadline := time.Now().Add(relpDrainTimeout)
+	for f.Unanswered(connID) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	f.RemoveConn(connID)
+	<-responsesDone
+	_ = writeFull(c.Conn, []byte("0 serverclose 0\n"))
+	closeConn()
+}
+
+// relpSessions are the active RELP sessions of a service.
+type relpSessions struct {
+	mu       sync.Mutex
+	sessions map[utils.MyULID]*relpSession
+}
+
+func (s *relpSessions) add(connID utils.MyULID, session *relpSession) {
+	s.mu.Lock()
+	if s.sessions == nil {
+		s.sessions = make(map[utils.MyULID]*relpSession)
+	}
+	s.sessions[connID] = session
+	s.mu.Unlock()
+}
+
+func (s *relpSessions) remove(connID utils.MyULID) {
+	s.mu.Lock()
+	delete(s.sessions, connID)
+	s.mu.Unlock()
+}
+
+// lookupListener returns the configuration, the port and the unix socket
+// path of the named listener.
+func (s *StreamingService) lookupListener(name string) (c conf.TCPSourceConfig, port int, path string, err error) {
+	for _, l := range s.TCPListeners {
+		if l.Name == name {
+			return l.Conf, l.Port, "", nil
+		}
+	}
+	for _, l := range s.UnixListeners {
+		if l.Name == name {
+			return l.Conf, 0, l.Name, nil
+		}
+	}
+	return c, 0, "", eerrors.Errorf("Unknown listener '%s' (listeners: %s)", name, strings.Join(s.listenerNames(), ", "))
+}
+
+// drainSessions drains the RELP sessions of the named listener.
+func (s *StreamingService) drainSessions(sessions *relpSessions, name string) error {
+	c, port, path, err := s.lookupListener(name)
+	if err != nil {
+		return err
+	}
+	n := 0
+	sessions.mu.Lock()
+	for _, session := range sessions.sessions {
+		if session.confID == c.ConfID && session.port == port && session.path == path {
+			session.startDrain()
+			n++
+		}
+	}
+	sessions.mu.Unlock()
+	s.Logger.Info("Draining the RELP sessions of the listener", "listener", name, "sessions", n)
+	return nil
+}
+
+// Drain makes the RELP clients of the listener reconnect, after their
+// transactions in progress are answered.
+func (s *RelpService) Drain(listener string) error {
+	return s.drainSessions(&s.sessions, listener)
+}
+
+// Drain makes the RELP clients of the listener reconnect, after their
+// transactions in progress are answered.
+func (s *DirectRelpServiceImpl) Drain(listener string) error {
+	return s.drainSessions(&s.sessions, listener)
+}
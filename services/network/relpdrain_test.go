@@ -0,0 +1,140 @@
+package network
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/decoders"
+	"github.com/stephane-martin/skewer/services/base"
+	"github.com/stephane-martin/skewer/utils"
+	"github.com/stephane-martin/skewer/utils/queue/message"
+	"github.com/stephane-martin/skewer/utils/queue/tcp"
+)
+
+// TestRelpDrain drains a RELP session whose messages are not acknowledged by
+// Kafka yet: the answers must be sent before the serverclose.
+func TestRelpDrain(t *testing.T) {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	gen := utils.NewGenerator()
+	confID := gen.Uid()
+	const nbMessages = 5
+
+	initDirectRelpRegistry()
+	s := NewDirectRelpServiceImpl(false, nil, nil, logger)
+	s.QueueSize = 64
+	s.MaxMessageSize = 65536
+	s.configs[confID] = conf.DirectRELPSourceConfig{
+		FilterSubConfig: conf.FilterSubConfig{TopicTmpl: "test"},
+	}
+	s.parserEnv = decoders.NewParsersEnv(nil, logger)
+	s.parsedMessagesQueue = message.NewRing(s.QueueSize)
+	s.rawQ = tcp.NewRing(s.QueueSize)
+	s.stats = newParseStats(base.DirectRELP, 1)
+	producer := newFakeProducer(nbMessages)
+	s.producer = producer
+
+	var workers sync.WaitGroup
+	for _, f := range []func(){func() { s.parse(s.rawQ) }, s.push2kafka, func() { s.handleKafkaResponses(producer) }} {
+		workers.Add(1)
+		go func(f func()) {
+			defer workers.Done()
+			f()
+		}(f)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+	config := conf.TCPSourceConfig{
+		ConfID:            confID,
+		DecoderBaseConfig: conf.DecoderBaseConfig{Format: "rfc5424", Charset: "utf8"},
+	}
+	name := listener.Addr().String()
+	s.TCPListeners = []TCPListenerConf{{
+		Listener: listener,
+		Port:     listener.Addr().(*net.TCPAddr).Port,
+		Name:     name,
+		Conf:     config,
+	}}
+	handled := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			handled <- err
+			return
+		}
+		handled <- DirectRelpHandler{Server: s}.HandleConnection(conn, config)
+	}()
+
+	client, err := net.Dial("tcp", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+	_ = client.SetDeadline(time.Now().Add(10 * time.Second))
+	answers := bufio.NewScanner(client)
+	answers.Split(utils.RelpSplit)
+	expect := func(expected string) {
+		if !answers.Scan() {
+			t.Fatalf("no answer, expected %q: %v", expected, answers.Err())
+		}
+		if !strings.HasPrefix(answers.Text(), expected) {
+			t.Fatalf("unexpected answer %q, expected %q", answers.Text(), expected)
+		}
+	}
+
+	offer := "relp_version=0\nrelp_software=test\ncommands=syslog"
+	fmt.Fprintf(client, "1 open %d %s\n", len(offer), offer)
+	expect("1 rsp 200 OK")
+	for txnr := 2; txnr < nbMessages+2; txnr++ {
+		msg := fmt.Sprintf("<13>1 2018-01-01T00:00:00Z host app - - - message %d", txnr)
+		fmt.Fprintf(client, "%d syslog %d %s\n", txnr, len(msg), msg)
+	}
+	var produced []*sarama.ProducerMessage
+	for len(produced) < nbMessages {
+		produced = append(produced, <-producer.input)
+	}
+
+	// the session is drained while Kafka has not acknowledged the messages
+	if err := s.Drain("nosuchlistener"); err == nil {
+		t.Fatal("draining an unknown listener should fail")
+	}
+	if err := s.Drain(name); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	for _, m := range produced {
+		producer.successes <- m
+	}
+	for txnr := 2; txnr < nbMessages+2; txnr++ {
+		expect(fmt.Sprintf("%d rsp 200 OK", txnr))
+	}
+	expect("0 serverclose")
+	if answers.Scan() {
+		t.Fatalf("unexpected answer after the serverclose: %q", answers.Text())
+	}
+	if answers.Err() != nil && answers.Err() != io.EOF {
+		t.Fatalf("the connection should be closed: %v", answers.Err())
+	}
+
+	if err := <-handled; err != nil {
+		t.Fatalf("unexpected connection error: %v", err)
+	}
+	s.rawQ.Dispose()
+	s.parsedMessagesQueue.Dispose()
+	close(producer.successes)
+	close(producer.errors)
+	workers.Wait()
+}
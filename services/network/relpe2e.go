@@ -0,0 +1,117 @@
+package network
+
+import (
+	"sync"
+	"time"
+
+	"github.com/stephane-martin/skewer/utils"
+)
+
+// e2eTxn is a RELP transaction of a source with end to end acknowledgment:
+// its answer waits until the Store reports that all its messages have been
+// acknowledged by the destinations. answer is called once, with an empty
+// reason for a success.
+type e2eTxn struct {
+	mu      sync.Mutex
+	pending map[utils.MyULID]bool
+	sealed  bool
+	done    bool
+	timer   *time.Timer
+	answer  func(reason string)
+	forget  func(uids ...utils.MyULID)
+}
+
+func newE2ETxn(answer func(reason string), forget func(uids ...utils.MyULID)) *e2eTxn {
+	return &e2eTxn{
+		pending: make(map[utils.MyULID]bool),
+		answer:  answer,
+		forget:  forget,
+	}
+}
+
+// add registers a message of the transaction, before it is stashed.
+func (t *e2eTxn) add(uid utils.MyULID) {
+	t.mu.Lock()
+	t.pending[uid] = true
+	t.mu.Unlock()
+}
+
+// ack is the model.AckFunc of the messages of the transaction.
+func (t *e2eTxn) ack(uid utils.MyULID, ok bool) {
+	t.mu.Lock()
+	if t.done || !t.pending[uid] {
+		t.mu.Unlock()
+		return
+	}
+	delete(t.pending, uid)
+	if !ok {
+		t.finish(failDelivery)
+		return
+	}
+	if t.sealed && len(t.pending) == 0 {
+		t.finish("")
+		return
+	}
+	t.mu.Unlock()
+}
+
+// seal reports that all the messages of the transaction have been stashed.
+// The transaction fails when they are not all acknowledged within timeout.
+func (t *e2eTxn) seal(timeout time.Duration) {
+	t.mu.Lock()
+	if t.done {
+		t.mu.Unlock()
+		return
+	}
+	t.sealed = true
+	if len(t.pending) == 0 {
+		// every message was filtered out
+		t.finish("")
+		return
+	}
+	t.timer = time.AfterFunc(timeout, func() {
+		t.mu.Lock()
+		if t.done {
+			t.mu.Unlock()
+			return
+		}
+		t.finish(failAckTimeout)
+	})
+	t.mu.Unlock()
+}
+
+// abandon drops the transaction, when it has been answered otherwise.
+func (t *e2eTxn) abandon() {
+	t.mu.Lock()
+	if t.done {
+		t.mu.Unlock()
+		return
+	}
+	t.done = true
+	uids := t.remaining()
+	t.mu.Unlock()
+	t.forget(uids...)
+}
+
+// finish answers the transaction. It is called with t.mu held, and releases
+// it.
+func (t *e2eTxn) finish(reason string) {
+	t.done = true
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+	uids := t.remaining()
+	t.mu.Unlock()
+	// the outcome of the other messages does not matter anymore
+	t.forget(uids...)
+	t.answer(reason)
+}
+
+func (t *e2eTxn) remaining() []utils.MyULID {
+	uids := make([]utils.MyULID, 0, len(t.pending))
+	for uid := range t.pending {
+		uids = append(uids, uid)
+	}
+	t.pending = nil
+	return uids
+}
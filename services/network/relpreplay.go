@@ -0,0 +1,225 @@
+package network
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stephane-martin/skewer/utils"
+	"go.uber.org/atomic"
+)
+
+var relpReplayBufferedCounter prometheus.Counter
+var relpReplayRecoveredCounter prometheus.Counter
+
+func newRelpReplayCounters() (buffered, recovered prometheus.Counter) {
+	buffered = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "skw_relp_replay_buffered_total",
+			Help: "number of stashed RELP messages that were not answered before the client disconnected",
+		},
+	)
+	recovered = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "skw_relp_replay_recovered_total",
+			Help: "number of RELP messages sent again by a reconnected client, and answered from the replay buffer",
+		},
+	)
+	return buffered, recovered
+}
+
+// relpReplay lets a RELP client that reconnects get the answers that it has
+// missed, instead of having the messages that it sends again stashed twice.
+//
+// The replay is only enabled for the clients that offered a client id in the
+// RELP open command. The messages of a connection are tracked by their txnr
+// until they are answered. When the connection is removed, the messages that
+// were stashed but not answered are handed off to a buffer keyed by the
+// client id, for a grace period. The messages that are still processed go to
+// the buffer when they are stashed.
+//
+// The clients number the transactions of a new session from 1 again, so the
+// buffer is keyed by the hash of the content of the messages, with the
+// number of buffered copies. When the client sends a message whose content
+// is buffered, a copy is consumed, and the message is answered with success
+// right away.
+type relpReplay struct {
+	// active is set when the first connection enables the replay, so that the
+	// other connections don't pay for the lock
+	active  atomic.Bool
+	mu      sync.Mutex
+	conns   map[utils.MyULID]*replayConn
+	clients map[string]*replayBuffer
+}
+
+type replayConn struct {
+	client  string
+	grace   time.Duration
+	pending map[int32]replayEntry
+	closed  bool
+}
+
+type replayKey [16]byte
+
+type replayEntry struct {
+	key     replayKey
+	stashed bool
+}
+
+type replayBuffer struct {
+	// counts maps the hash of the content of the buffered messages to the
+	// number of copies
+	counts  map[replayKey]int
+	expires time.Time
+}
+
+func replayHash(data []byte) (key replayKey) {
+	h := fnv.New128a()
+	_, _ = h.Write(data)
+	h.Sum(key[:0])
+	return key
+}
+
+// enable tracks the messages of the connection. client is the client id
+// offered in the RELP open command: without it, the messages are not
+// tracked.
+func (r *relpReplay) enable(connID utils.MyULID, client string, grace time.Duration) {
+	if len(client) == 0 {
+		return
+	}
+	r.mu.Lock()
+	if r.conns == nil {
+		r.conns = make(map[utils.MyULID]*replayConn)
+		r.clients = make(map[string]*replayBuffer)
+	}
+	r.conns[connID] = &replayConn{
+		client:  client,
+		grace:   grace,
+		pending: make(map[int32]replayEntry),
+	}
+	r.mu.Unlock()
+	r.active.Store(true)
+}
+
+// track starts to track a received message. It returns true when the
+// message was stashed during a previous connection of the client: it should
+// then be answered with success without being processed.
+func (r *relpReplay) track(connID utils.MyULID, txnr int32, data []byte) bool {
+	if !r.active.Load() {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conn, ok := r.conns[connID]
+	if !ok {
+		return false
+	}
+	key := replayHash(data)
+	if buf, ok := r.clients[conn.client]; ok {
+		if time.Now().After(buf.expires) {
+			delete(r.clients, conn.client)
+		} else if n := buf.counts[key]; n > 0 {
+			if n == 1 {
+				delete(buf.counts, key)
+			} else {
+				buf.counts[key] = n - 1
+			}
+			relpReplayRecoveredCounter.Inc()
+			return true
+		}
+	}
+	conn.pending[txnr] = replayEntry{key: key}
+	return false
+}
+
+// stashed notes that the message has been stashed. When its connection is
+// already closed, it is handed off to the buffer of the client.
+func (r *relpReplay) stashed(connID utils.MyULID, txnr int32) {
+	if !r.active.Load() {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conn, ok := r.conns[connID]
+	if !ok {
+		return
+	}
+	entry, ok := conn.pending[txnr]
+	if !ok {
+		return
+	}
+	if conn.closed {
+		r.handoff(conn, entry.key)
+		r.forget(connID, conn, txnr)
+		return
+	}
+	entry.stashed = true
+	conn.pending[txnr] = entry
+}
+
+// forget stops tracking a message: it has been answered, or it has failed
+// and the client will send it again anyway.
+func (r *relpReplay) forget(connID utils.MyULID, conn *replayConn, txnr int32) {
+	delete(conn.pending, txnr)
+	if conn.closed && len(conn.pending) == 0 {
+		delete(r.conns, connID)
+	}
+}
+
+func (r *relpReplay) answered(connID utils.MyULID, txnr int32) {
+	if !r.active.Load() {
+		return
+	}
+	r.mu.Lock()
+	if conn, ok := r.conns[connID]; ok {
+		r.forget(connID, conn, txnr)
+	}
+	r.mu.Unlock()
+}
+
+// closed hands off the stashed messages of the connection that were not
+// answered to the buffer of the client.
+func (r *relpReplay) closed(connID utils.MyULID) {
+	if !r.active.Load() {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conn, ok := r.conns[connID]
+	if !ok {
+		return
+	}
+	r.purge()
+	conn.closed = true
+	for txnr, entry := range conn.pending {
+		if entry.stashed {
+			r.handoff(conn, entry.key)
+			delete(conn.pending, txnr)
+		}
+	}
+	if len(conn.pending) == 0 {
+		delete(r.conns, connID)
+	}
+}
+
+func (r *relpReplay) handoff(conn *replayConn, key replayKey) {
+	buf, ok := r.clients[conn.client]
+	if !ok {
+		buf = &replayBuffer{counts: make(map[replayKey]int)}
+		r.clients[conn.client] = buf
+	}
+	buf.counts[key]++
+	buf.expires = time.Now().Add(conn.grace)
+	relpReplayBufferedCounter.Inc()
+}
+
+// purge removes the expired buffers.
+func (r *relpReplay) purge() {
+	now := time.Now()
+	for client, buf := range r.clients {
+		if now.After(buf.expires) {
+			delete(r.clients, client)
+		}
+	}
+}
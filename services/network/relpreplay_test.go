@@ -0,0 +1,141 @@
+package network
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRelpReplayAfterReconnect(t *testing.T) {
+	initRelpRegistry()
+	f := newAckForwarder()
+	client := "client-1"
+
+	connID := f.AddConn(16)
+	f.EnableReplay(connID, client, time.Minute)
+	for txnr, data := range map[int32]string{1: "first", 2: "second", 3: "third"} {
+		f.Received(connID, txnr)
+		if f.Replayed(connID, txnr, []byte(data)) {
+			t.Fatalf("txnr %d should not be replayed", txnr)
+		}
+	}
+	f.ForwardSucc(connID, 1)
+	f.ForwardSucc(connID, 3)
+	f.Answered(connID, 3)
+	// the client disconnects while the second message is still processed
+	f.RemoveConn(connID)
+	f.ForwardSucc(connID, 2)
+
+	connID = f.AddConn(16)
+	f.EnableReplay(connID, client, time.Minute)
+	f.Received(connID, 1)
+	if !f.Replayed(connID, 1, []byte("first")) {
+		t.Fatal("the stashed message that was not answered should be replayed")
+	}
+	f.Received(connID, 2)
+	if !f.Replayed(connID, 2, []byte("second")) {
+		t.Fatal("the message stashed after the disconnection should be replayed")
+	}
+	f.Received(connID, 3)
+	if f.Replayed(connID, 3, []byte("third")) {
+		t.Fatal("the answered message should not be replayed")
+	}
+	f.Received(connID, 1)
+	if f.Replayed(connID, 1, []byte("first")) {
+		t.Fatal("a buffered message should be replayed only once")
+	}
+	for _, expected := range []int32{1, 2} {
+		succ, _ := f.GetSuccAndFail(connID)
+		if succ != expected {
+			t.Fatalf("expected a success for txnr %d, got %d", expected, succ)
+		}
+	}
+}
+
+func TestRelpReplayGracePeriod(t *testing.T) {
+	initRelpRegistry()
+	f := newAckForwarder()
+	client := "client-2"
+
+	connID := f.AddConn(16)
+	f.EnableReplay(connID, client, time.Millisecond)
+	f.Received(connID, 1)
+	f.Replayed(connID, 1, []byte("message"))
+	f.ForwardSucc(connID, 1)
+	f.RemoveConn(connID)
+	time.Sleep(10 * time.Millisecond)
+
+	connID = f.AddConn(16)
+	f.EnableReplay(connID, client, time.Millisecond)
+	f.Received(connID, 1)
+	if f.Replayed(connID, 1, []byte("message")) {
+		t.Fatal("the buffer should have expired")
+	}
+}
+
+func TestRelpReplayRenumbered(t *testing.T) {
+	initRelpRegistry()
+	f := newAckForwarder()
+	client := "client-4"
+
+	// two copies of the same message, and another one, are stashed but not
+	// answered
+	connID := f.AddConn(16)
+	f.EnableReplay(connID, client, time.Minute)
+	for txnr, data := range map[int32]string{7: "same", 8: "same", 9: "other"} {
+		f.Received(connID, txnr)
+		f.Replayed(connID, txnr, []byte(data))
+		f.ForwardSucc(connID, txnr)
+	}
+	f.RemoveConn(connID)
+
+	// the new session numbers the transactions from 1 again
+	connID = f.AddConn(16)
+	f.EnableReplay(connID, client, time.Minute)
+	for txnr, data := range []string{"other", "same", "same"} {
+		f.Received(connID, int32(txnr+1))
+		if !f.Replayed(connID, int32(txnr+1), []byte(data)) {
+			t.Fatalf("the buffered message %q should be replayed with txnr %d", data, txnr+1)
+		}
+	}
+	f.Received(connID, 4)
+	if f.Replayed(connID, 4, []byte("same")) {
+		t.Fatal("a buffered message should be replayed as many times as it was buffered")
+	}
+}
+
+func TestRelpReplaySessionIdentity(t *testing.T) {
+	initRelpRegistry()
+	f := newAckForwarder()
+
+	connID := f.AddConn(16)
+	f.EnableReplay(connID, "client-3", time.Minute)
+	for txnr, data := range map[int32]string{1: "first", 2: "second"} {
+		f.Received(connID, txnr)
+		f.Replayed(connID, txnr, []byte(data))
+		f.ForwardSucc(connID, txnr)
+	}
+	f.RemoveConn(connID)
+
+	connID = f.AddConn(16)
+	f.EnableReplay(connID, "client-3", time.Minute)
+	f.Received(connID, 2)
+	if f.Replayed(connID, 2, []byte("another")) {
+		t.Fatal("another content with the same txnr should not be replayed")
+	}
+	f.RemoveConn(connID)
+
+	// without a client id, the messages are not buffered
+	connID = f.AddConn(16)
+	f.EnableReplay(connID, "", time.Minute)
+	f.Received(connID, 1)
+	f.Replayed(connID, 1, []byte("first"))
+	f.ForwardSucc(connID, 1)
+	f.RemoveConn(connID)
+
+	connID = f.AddConn(16)
+	f.EnableReplay(connID, "", time.Minute)
+	f.Received(connID, 1)
+	if f.Replayed(connID, 1, []byte("first")) {
+		t.Fatal("the messages of a client without id should not be replayed")
+	}
+}
@@ -0,0 +1,72 @@
+package network
+
+import (
+	"sort"
+
+	"github.com/stephane-martin/skewer/services/base"
+	"github.com/stephane-martin/skewer/utils"
+	"go.uber.org/atomic"
+)
+
+// Transactions returns a snapshot of the transactions of the connection that
+// have not been answered yet. Only the in-flight set of the connection is
+// read, under its lock.
+func (f *ackForwarder) Transactions(connID utils.MyULID) (t base.RelpTransactions, ok bool) {
+	h := f.inflightOf(connID)
+	if h == nil {
+		return t, false
+	}
+	t.ConnID = connID.String()
+	if n, ok := f.unanswered.Load(connID); ok {
+		t.Unanswered = n.(*atomic.Int32).Load()
+	}
+	h.Lock()
+	t.NextToCommit = h.next
+	for txnr := range h.received {
+		if txnr != h.next {
+			t.Received = append(t.Received, txnr)
+		}
+	}
+	for txnr, reason := range h.answers {
+		if len(reason) == 0 {
+			t.Succeeded = append(t.Succeeded, txnr)
+		} else {
+			t.Failed = append(t.Failed, base.RelpFailure{Txnr: txnr, Reason: reason})
+		}
+	}
+	h.Unlock()
+	sort.Slice(t.Received, func(i, j int) bool { return t.Received[i] < t.Received[j] })
+	sort.Slice(t.Succeeded, func(i, j int) bool { return t.Succeeded[i] < t.Succeeded[j] })
+	sort.Slice(t.Failed, func(i, j int) bool { return t.Failed[i].Txnr < t.Failed[j].Txnr })
+	return t, true
+}
+
+// transactions returns a snapshot of the transactions in progress of the
+// sessions.
+func (s *relpSessions) transactions(f *ackForwarder) []base.RelpTransactions {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := make([]base.RelpTransactions, 0, len(s.sessions))
+	for connID, session := range s.sessions {
+		t, ok := f.Transactions(connID)
+		if !ok {
+			continue
+		}
+		t.Client = session.client
+		res = append(res, t)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ConnID < res[j].ConnID })
+	return res
+}
+
+// Transactions returns a snapshot of the transactions in progress of the
+// RELP sessions.
+func (s *RelpService) Transactions() []base.RelpTransactions {
+	return s.sessions.transactions(s.forwarder)
+}
+
+// Transactions returns a snapshot of the transactions in progress of the
+// RELP sessions.
+func (s *DirectRelpServiceImpl) Transactions() []base.RelpTransactions {
+	return s.sessions.transactions(s.forwarder)
+}
@@ -0,0 +1,69 @@
+package network
+
+import (
+	"crypto/x509"
+
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/services/base"
+	"github.com/stephane-martin/skewer/utils"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// revocationChecker builds the tls.Config.VerifyPeerCertificate callback
+// that checks the client certificates against the CRLs of a listener.
+func (s *StreamingService) revocationChecker(c *conf.TCPSourceConfig) (func([][]byte, [][]*x509.Certificate) error, error) {
+	checker, err := utils.NewCRLChecker(c.CRLFile, c.CertReloadInterval, s.confined)
+	if err != nil {
+		return nil, eerrors.Wrap(err, "Error loading the CRL file")
+	}
+	logger := s.Logger.New("crl_file", c.CRLFile)
+	checker.OnReload = func(n int, err error) {
+		if err != nil {
+			logger.Warn("Error reloading the CRL file", "error", err)
+			return
+		}
+		logger.Info("CRL file has been reloaded", "lists", n)
+	}
+	provider := base.Types2Names[s.typ]
+	hard := c.RevocationPolicy == "hard"
+
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		var chain []*x509.Certificate
+		if len(verifiedChains) > 0 {
+			chain = verifiedChains[0]
+		} else if len(rawCerts) > 0 {
+			// the client certificate was not verified (client_auth_type
+			// "request" or "requireany"): it is still checked against the
+			// CRL of the issuer it claims
+			leaf, err := x509.ParseCertificate(rawCerts[0])
+			if err != nil {
+				return err
+			}
+			chain = []*x509.Certificate{leaf}
+		} else {
+			return nil
+		}
+
+		err := checker.Check(chain)
+		switch e := err.(type) {
+		case nil:
+			base.TLSRevocationCheckCounter.WithLabelValues(provider, "good", "false").Inc()
+			return nil
+		case *utils.CertRevokedError:
+			base.TLSRevocationCheckCounter.WithLabelValues(provider, "revoked", "true").Inc()
+			logger.Warn("Rejected a revoked client certificate", "serial", e.Serial, "subject", e.Subject)
+			return err
+		case *utils.RevocationUnknownError:
+			if hard {
+				base.TLSRevocationCheckCounter.WithLabelValues(provider, "unknown", "true").Inc()
+				logger.Warn("Rejected a client certificate whose revocation status is unknown", "serial", e.Serial, "reason", e.Reason)
+				return err
+			}
+			base.TLSRevocationCheckCounter.WithLabelValues(provider, "unknown", "false").Inc()
+			logger.Debug("Unknown revocation status of a client certificate", "serial", e.Serial, "reason", e.Reason)
+			return nil
+		default:
+			return err
+		}
+	}, nil
+}
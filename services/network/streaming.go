@@ -2,8 +2,10 @@ package network
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"net"
 	"sync"
+	"time"
 
 	"github.com/stephane-martin/skewer/conf"
 	"github.com/stephane-martin/skewer/model"
@@ -19,11 +21,13 @@ type StreamHandler interface {
 type TCPListenerConf struct {
 	Listener net.Listener
 	Port     int
+	Name     string
 	Conf     conf.TCPSourceConfig
 }
 
 type UnixListenerConf struct {
 	Listener net.Listener
+	Name     string
 	Conf     conf.TCPSourceConfig
 }
 
@@ -37,6 +41,25 @@ type StreamingService struct {
 	wgroup         sync.WaitGroup
 	MaxMessageSize int
 	confined       bool
+	typ            base.Types
+	pauses         map[string]*listenerPause
+	pauseMu        sync.Mutex
+	// connLogs are the connection counters used to sample the connection
+	// logs, by source configuration
+	connLogs sync.Map
+	// listenersDone is closed when the listeners are closed, so that the
+	// accept loops of the paused listeners return
+	listenersDone chan struct{}
+	// OrderingCheck stamps the messages with a per connection sequence
+	// number
+	OrderingCheck bool
+	// BatchSize is the number of raw messages that the connections push
+	// to the raw messages queue at once, and that the parsers pull from it
+	BatchSize int
+	// queueDepth returns the number of the raw messages waiting to be
+	// parsed, for the services that support the backpressure
+	queueDepth    func() int
+	backpressures map[string]*backpressure
 }
 
 func (s *StreamingService) init() {
@@ -44,21 +67,31 @@ func (s *StreamingService) init() {
 	s.TCPListeners = []TCPListenerConf{}
 	s.UnixListeners = []UnixListenerConf{}
 	s.SourceConfigs = []conf.TCPSourceConfig{}
+	s.pauses = map[string]*listenerPause{}
 }
 
 func (s *StreamingService) initTCPListeners() []model.ListenerInfo {
 	s.ClearConnections()
 	s.TCPListeners = []TCPListenerConf{}
 	s.UnixListeners = []UnixListenerConf{}
+	s.pauseMu.Lock()
+	s.listenersDone = make(chan struct{})
+	s.pauseMu.Unlock()
+	retrier := newBindRetrier(base.Types2Names[s.typ], s.BindRetryPeriod, s.Logger)
 	for _, syslogConf := range s.SourceConfigs {
 		if len(syslogConf.UnixSocketPath) > 0 {
-			l, err := s.Binder.Listen("unix", syslogConf.UnixSocketPath)
+			var l net.Listener
+			err := retrier.bind(syslogConf.UnixSocketPath, func() (err error) {
+				l, err = s.Binder.Listen("unix", syslogConf.UnixSocketPath)
+				return err
+			})
 			if err != nil {
 				s.Logger.Warn("Error listening on stream unix socket", "path", syslogConf.UnixSocketPath, "error", err)
 			} else {
 				s.Logger.Debug("Listener", "protocol", "stream", "path", syslogConf.UnixSocketPath, "format", syslogConf.Format)
 				lc := UnixListenerConf{
 					Listener: l,
+					Name:     syslogConf.UnixSocketPath,
 					Conf:     syslogConf,
 				}
 				s.UnixListeners = append(s.UnixListeners, lc)
@@ -68,12 +101,14 @@ func (s *StreamingService) initTCPListeners() []model.ListenerInfo {
 			listenAddrs, _ := syslogConf.GetListenAddrs()
 			for port, listenAddr := range listenAddrs {
 				var l net.Listener
-				var err error
-				if syslogConf.KeepAlive {
-					l, err = s.Binder.ListenKeepAlive("tcp", listenAddr, syslogConf.KeepAlivePeriod)
-				} else {
-					l, err = s.Binder.Listen("tcp", listenAddr)
-				}
+				err := retrier.bind(listenAddr, func() (err error) {
+					if syslogConf.KeepAlive {
+						l, err = s.Binder.ListenKeepAlive("tcp", listenAddr, syslogConf.KeepAlivePeriod)
+					} else {
+						l, err = s.Binder.Listen("tcp", listenAddr)
+					}
+					return err
+				})
 				if err != nil {
 					s.Logger.Warn("Error listening on stream (TCP or RELP)", "listen_addr", listenAddr, "error", err)
 				} else {
@@ -81,6 +116,7 @@ func (s *StreamingService) initTCPListeners() []model.ListenerInfo {
 					lc := TCPListenerConf{
 						Listener: l,
 						Port:     port,
+						Name:     listenAddr,
 						Conf:     syslogConf,
 					}
 					s.TCPListeners = append(s.TCPListeners, lc)
@@ -89,6 +125,8 @@ func (s *StreamingService) initTCPListeners() []model.ListenerInfo {
 		}
 	}
 
+	s.initBackpressures()
+
 	infos := []model.ListenerInfo{}
 	for _, unixc := range s.UnixListeners {
 		infos = append(infos, model.ListenerInfo{
@@ -98,9 +136,11 @@ func (s *StreamingService) initTCPListeners() []model.ListenerInfo {
 	}
 	for _, tcpc := range s.TCPListeners {
 		infos = append(infos, model.ListenerInfo{
-			BindAddr: tcpc.Conf.BindAddr,
-			Port:     tcpc.Port,
-			Protocol: "tcp_or_relp",
+			BindAddr:  tcpc.Conf.ResolvedBindAddr(),
+			Interface: tcpc.Conf.BindInterface,
+			Port:      tcpc.Port,
+			Protocol:  "tcp_or_relp",
+			TLS:       tcpc.Conf.TLSEnabled,
 		})
 	}
 	return infos
@@ -113,6 +153,21 @@ func (s *StreamingService) resetTCPListeners() {
 	for _, l := range s.UnixListeners {
 		_ = l.Listener.Close()
 	}
+	s.pauseMu.Lock()
+	if s.listenersDone != nil {
+		close(s.listenersDone)
+		s.listenersDone = nil
+	}
+	for _, b := range s.backpressures {
+		b.gate.resume()
+	}
+	s.pauseMu.Unlock()
+}
+
+func (s *StreamingService) done() <-chan struct{} {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+	return s.listenersDone
 }
 
 func (s *StreamingService) handleConnection(conn net.Conn, config conf.TCPSourceConfig) error {
@@ -122,12 +177,24 @@ func (s *StreamingService) handleConnection(conn net.Conn, config conf.TCPSource
 func (s *StreamingService) AcceptUnix(lc UnixListenerConf) error {
 	var wg sync.WaitGroup
 	defer wg.Wait()
+	pause := s.getPause(lc.Name)
+	done := s.done()
+	limiter := s.connLimiter(lc.Name, &lc.Conf)
 
 	for {
-		conn, err := lc.Listener.Accept()
+		// while the listener is paused, the new connections wait in the
+		// listen backlog
+		pause.wait(done)
+		throttle.wait(done)
+		c, err := lc.Listener.Accept()
 		if err != nil {
 			return eerrors.Wrap(err, "Accept() error")
 		}
+		c = s.withBackpressure(newPausableConn(c, pause, lc.Conf.Timeout), lc.Name, lc.Conf.Timeout)
+		conn, ok := limiter.admit(c)
+		if !ok {
+			continue
+		}
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
@@ -140,28 +207,94 @@ func (s *StreamingService) AcceptUnix(lc UnixListenerConf) error {
 
 }
 
+// serverTLSConfig builds the TLS configuration of a listener. The listener
+// certificate is reloaded from disk when it changes.
+func (s *StreamingService) serverTLSConfig(c *conf.TCPSourceConfig) (*tls.Config, error) {
+	reloader, err := utils.NewCertReloader(c.CertFile, c.KeyFile, c.CertReloadInterval, s.confined)
+	if err != nil {
+		return nil, eerrors.Wrap(err, "Error loading the listener certificate")
+	}
+	provider := base.Types2Names[s.typ]
+	expiry := base.TLSCertExpiryGauge.WithLabelValues(provider, c.CertFile)
+	expiry.Set(float64(reloader.Leaf().NotAfter.Unix()))
+	logger := s.Logger.New("cert_file", c.CertFile)
+	reloader.OnReload = func(leaf *x509.Certificate, err error) {
+		if err != nil {
+			logger.Warn("Error reloading the listener certificate", "error", err)
+			base.TLSCertReloadCounter.WithLabelValues(provider, c.CertFile, "error").Inc()
+			return
+		}
+		logger.Info("Listener certificate has been reloaded", "not_after", leaf.NotAfter)
+		base.TLSCertReloadCounter.WithLabelValues(provider, c.CertFile, "success").Inc()
+		expiry.Set(float64(leaf.NotAfter.Unix()))
+	}
+	tlsConf, err := utils.NewServerTLSConfig(reloader, c.CAFile, c.CAPath, c.ClientCAFiles, s.confined)
+	if err != nil {
+		return nil, err
+	}
+	tlsConf.ClientAuth = c.GetClientAuthType()
+	if len(c.CRLFile) > 0 {
+		tlsConf.VerifyPeerCertificate, err = s.revocationChecker(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tlsConf, nil
+}
+
+// setNoDelay applies the nodelay setting to an accepted TCP connection. The
+// binder sets TCP_NODELAY on the connections it passes, so the setting is
+// applied in both directions.
+func setNoDelay(c net.Conn, nodelay string) {
+	if tcpConn, ok := c.(*net.TCPConn); ok {
+		_ = tcpConn.SetNoDelay(nodelay != "off")
+	}
+}
+
 func (s *StreamingService) AcceptTCP(lc TCPListenerConf) error {
 	var wg sync.WaitGroup
 	defer wg.Wait()
 
+	var tlsConf *tls.Config
+	if lc.Conf.TLSEnabled {
+		var err error
+		tlsConf, err = s.serverTLSConfig(&lc.Conf)
+		if err != nil {
+			s.Logger.Warn("Error creating TLS configuration", "port", lc.Port, "error", err)
+			_ = lc.Listener.Close()
+			return eerrors.Wrap(err, "Error creating TLS configuration")
+		}
+	}
+
+	pause := s.getPause(lc.Name)
+	done := s.done()
+	// the slots of the TLS handshakes in progress on the listener
+	handshakes := make(chan struct{}, lc.Conf.MaxTLSHandshakes)
+	limiter := s.connLimiter(lc.Name, &lc.Conf)
+
 	for {
+		pause.wait(done)
+		throttle.wait(done)
 		c, err := lc.Listener.Accept()
 		if err != nil {
 			return eerrors.Wrap(err, "Accept() error")
 		}
-		if lc.Conf.TLSEnabled {
+		setNoDelay(c, lc.Conf.NoDelay)
+		c = s.withBackpressure(newPausableConn(c, pause, lc.Conf.Timeout), lc.Name, lc.Conf.Timeout)
+		c, ok := limiter.admit(c)
+		if !ok {
+			continue
+		}
+		if tlsConf != nil {
 			// upgrade connection to TLS
-			tlsConf, err := utils.NewTLSConfig("", lc.Conf.CAFile, lc.Conf.CAPath, lc.Conf.CertFile, lc.Conf.KeyFile, false, s.confined)
-			if err != nil {
-				s.Logger.Warn("Error creating TLS configuration", "error", err)
-				continue
-			}
-			tlsConf.ClientAuth = lc.Conf.GetClientAuthType()
 			c = tls.Server(c, tlsConf)
 		}
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
+			if tlsConn, ok := c.(*tls.Conn); ok && !s.handshake(tlsConn, handshakes, &lc.Conf) {
+				return
+			}
 			err := s.handleConnection(c, lc.Conf)
 			if err != nil && !eerrors.HasFileClosed(err) {
 				s.Logger.Warn("TCP connection error", "error", err)
@@ -170,6 +303,35 @@ func (s *StreamingService) AcceptTCP(lc TCPListenerConf) error {
 	}
 }
 
+// handshake performs the TLS handshake of a new connection, when a handshake
+// slot of the listener becomes available soon enough. It closes the
+// connection and returns false when the handshake does not succeed in time.
+func (s *StreamingService) handshake(conn *tls.Conn, slots chan struct{}, c *conf.TCPSourceConfig) bool {
+	provider := base.Types2Names[s.typ]
+	select {
+	case slots <- struct{}{}:
+	case <-time.After(c.TLSHandshakeWait):
+		base.TLSHandshakeFailureCounter.WithLabelValues(provider, "busy").Inc()
+		_ = conn.Close()
+		return false
+	}
+	_ = conn.SetDeadline(time.Now().Add(c.TLSHandshakeTimeout))
+	err := conn.Handshake()
+	<-slots
+	if err != nil {
+		reason := "error"
+		if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+			reason = "timeout"
+		}
+		base.TLSHandshakeFailureCounter.WithLabelValues(provider, reason).Inc()
+		s.Logger.Debug("TLS handshake failed", "client", conn.RemoteAddr().String(), "error", err)
+		_ = conn.Close()
+		return false
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return true
+}
+
 func (s *StreamingService) Listen() (err error) {
 	c := eerrors.ChainErrors()
 	var wg sync.WaitGroup
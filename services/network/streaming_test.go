@@ -0,0 +1,76 @@
+package network
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/services/base"
+)
+
+func tlsCounterValue(c prometheus.Counter) float64 {
+	m := &dto.Metric{}
+	_ = c.Write(m)
+	return m.GetCounter().GetValue()
+}
+
+func TestTLSHandshakeLimits(t *testing.T) {
+	initRelpRegistry()
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	s := &StreamingService{typ: base.RELP}
+	s.Logger = logger
+	c := conf.TCPSourceConfig{
+		MaxTLSHandshakes:    1,
+		TLSHandshakeTimeout: 50 * time.Millisecond,
+		TLSHandshakeWait:    20 * time.Millisecond,
+	}
+	slots := make(chan struct{}, c.MaxTLSHandshakes)
+	busy := base.TLSHandshakeFailureCounter.WithLabelValues(base.Types2Names[base.RELP], "busy")
+	timeout := base.TLSHandshakeFailureCounter.WithLabelValues(base.Types2Names[base.RELP], "timeout")
+
+	// a client that never starts the handshake holds the only slot until
+	// the handshake timeout
+	client1, server1 := net.Pipe()
+	defer func() { _ = client1.Close() }()
+	before := tlsCounterValue(timeout)
+	result := make(chan bool)
+	go func() {
+		result <- s.handshake(tls.Server(server1, &tls.Config{}), slots, &c)
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	// meanwhile, the next connection can't get a slot and is closed
+	client2, server2 := net.Pipe()
+	defer func() { _ = client2.Close() }()
+	beforeBusy := tlsCounterValue(busy)
+	if s.handshake(tls.Server(server2, &tls.Config{}), slots, &c) {
+		t.Fatal("the handshake should have been refused")
+	}
+	if tlsCounterValue(busy) != beforeBusy+1 {
+		t.Fatal("the refused connection was not counted")
+	}
+	if _, err := client2.Read(make([]byte, 1)); err == nil {
+		t.Fatal("the refused connection should be closed")
+	}
+
+	select {
+	case ok := <-result:
+		if ok {
+			t.Fatal("the stalled handshake should have failed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the stalled handshake did not time out")
+	}
+	if tlsCounterValue(timeout) != before+1 {
+		t.Fatal("the handshake timeout was not counted")
+	}
+	if len(slots) != 0 {
+		t.Fatal("the handshake slot was not released")
+	}
+}
@@ -3,9 +3,9 @@ package network
 import (
 	"bufio"
 	"bytes"
+	"crypto/tls"
 	"io"
 	"net"
-	"runtime"
 	"strconv"
 	"strings"
 	"sync"
@@ -19,7 +19,9 @@ import (
 	"github.com/stephane-martin/skewer/services/base"
 	"github.com/stephane-martin/skewer/utils"
 	"github.com/stephane-martin/skewer/utils/eerrors"
+	"github.com/stephane-martin/skewer/utils/ordering"
 	"github.com/stephane-martin/skewer/utils/queue/tcp"
+	"go.uber.org/atomic"
 )
 
 func initTcpRegistry() {
@@ -35,6 +37,7 @@ type TcpServiceImpl struct {
 	fatalErrorChan   chan struct{}
 	fatalOnce        sync.Once
 	parserEnv        *decoders.ParsersEnv
+	stats            parseStats
 }
 
 func NewTcpService(env *base.ProviderEnv) (*TcpServiceImpl, error) {
@@ -48,6 +51,8 @@ func NewTcpService(env *base.ProviderEnv) (*TcpServiceImpl, error) {
 	s.StreamingService.BaseService.Binder = env.Binder
 	s.StreamingService.handler = tcpHandler{Server: &s}
 	s.StreamingService.confined = env.Confined
+	s.StreamingService.typ = base.TCP
+	s.StreamingService.queueDepth = func() int { return int(s.rawMessagesQueue.Len()) }
 	return &s, nil
 }
 
@@ -83,9 +88,15 @@ func (s *TcpServiceImpl) Start() ([]model.ListenerInfo, error) {
 		}
 	}()
 	s.Logger.Info("Listening on TCP", "nb_services", len(infos))
+	s.wgroup.Add(1)
+	go func() {
+		defer s.wgroup.Done()
+		s.watchBackpressure()
+	}()
 	// start the parsers
-	cpus := runtime.NumCPU()
-	for i := 0; i < cpus; i++ {
+	workers := parseWorkers(s.ParseWorkers)
+	s.stats = newParseStats(base.TCP, workers)
+	for i := 0; i < workers; i++ {
 		s.wgroup.Add(1)
 		go func() {
 			defer s.wgroup.Done()
@@ -127,6 +138,11 @@ func (s *TcpServiceImpl) Stop() {
 func (s *TcpServiceImpl) SetConf(c conf.BaseConfig) {
 	s.StreamingService.SetConf(c.TCPSource, c.Parsers, c.Main.InputQueueSize, c.Main.MaxInputMessageSize)
 	s.rawMessagesQueue = tcp.NewRing(c.Main.InputQueueSize)
+	s.ParseWorkers = c.Main.ParseWorkers
+	s.OrderingCheck = c.Main.OrderingCheck
+	s.BindRetryPeriod = c.Main.BindRetryPeriod
+	throttle.configure(c.Main, s.Logger)
+	base.ConfigureFieldSizes(c.Main.FieldSizeMetrics, c.Main.FieldSizeWindow)
 	s.parserEnv = decoders.NewParsersEnv(s.ParserConfigs, s.Logger)
 }
 
@@ -143,7 +159,10 @@ func logg(logger log15.Logger, raw *model.RawMessage) log15.Logger {
 }
 
 func (s *TcpServiceImpl) parseOne(raw *model.RawTCPMessage, gen *utils.Generator) error {
+	start := time.Now()
+	checksum := base.Checksum(&raw.Decoder, raw.Message)
 	syslogMsgs, err := s.parserEnv.Parse(&raw.Decoder, raw.Message)
+	base.ObserveParseDuration(base.TCP, raw.Decoder.Format, start)
 	if err != nil {
 		return err
 	}
@@ -152,14 +171,25 @@ func (s *TcpServiceImpl) parseOne(raw *model.RawTCPMessage, gen *utils.Generator
 		if syslogMsg == nil {
 			continue
 		}
+		if !base.NormalizeTime(base.TCP, syslogMsg, &raw.Decoder) {
+			model.Free(syslogMsg)
+			continue
+		}
+		base.NormalizeHostname(syslogMsg, &raw.Decoder)
+		base.ObserveFieldSizes(base.TCP, &raw.RawMessage, syslogMsg)
 
 		full := model.FullFactoryFrom(syslogMsg)
 		full.Uid = gen.Uid()
 		full.ConfId = raw.ConfID
 		full.SourceType = "tcp"
 		full.ClientAddr = raw.Client
+		full.TimeReceivedNum = raw.Received.UnixNano()
 		full.SourcePath = raw.UnixSocketPath
 		full.SourcePort = int32(raw.LocalPort)
+		base.SetChecksum(full, checksum)
+		if raw.Seq > 0 {
+			ordering.Stamp(full.Fields, raw.ConnID.String(), raw.Seq)
+		}
 
 		err := s.reporter.Stash(full)
 		model.FullFree(full)
@@ -182,12 +212,14 @@ func (s *TcpServiceImpl) parse() error {
 		if raw == nil || err != nil {
 			return nil
 		}
+		s.stats.begin(s.rawMessagesQueue.Len())
 		err = s.parseOne(raw, gen)
 		if err != nil {
-			base.CountParsingError(base.TCP, raw.Client, raw.Decoder.Format)
+			base.CountParsingError(base.TCP, raw.Client, raw.Decoder.Format, err)
 			logg(s.Logger, &raw.RawMessage).Warn(err.Error())
 		}
 		model.RawTCPFree(raw)
+		s.stats.end()
 		if err != nil && eerrors.IsFatal(err) {
 			// stop processing when fatal error happens
 			return err
@@ -196,13 +228,27 @@ func (s *TcpServiceImpl) parse() error {
 }
 
 func makeRawTCPFactory(props tcpProps, confID utils.MyULID, decoder conf.DecoderBaseConfig) func([]byte) *model.RawTCPMessage {
+	// the factory is called by the connection goroutine only
+	var seq uint64
+	var connID utils.MyULID
+	if props.Sequenced {
+		connID = utils.NewUid()
+	}
 	return func(data []byte) *model.RawTCPMessage {
 		raw := model.RawTCPFactory(data)
+		raw.Seq = 0
+		if props.Sequenced {
+			seq++
+			raw.Seq = seq
+			// RELP overrides the connection ID with its own
+			raw.ConnID = connID
+		}
 		raw.Client = props.Client
 		raw.LocalPort = props.LocalPort
 		raw.UnixSocketPath = props.Path
 		raw.ConfID = confID
 		raw.Decoder = decoder
+		raw.Received = time.Now()
 		return raw
 	}
 }
@@ -212,11 +258,12 @@ func makeLogger(logger log15.Logger, props tcpProps, protocol string) log15.Logg
 }
 
 func clientCounter(t base.Types, props tcpProps) {
-	base.CountClientConnection(t, props.Client, props.LocalPort, props.Path)
+	base.CountClientConnection(t, props.id(), props.LocalPort, props.Path)
 }
 
-func incomingCounter(t base.Types, props tcpProps) {
-	base.CountIncomingMessage(t, props.Client, props.LocalPort, props.Path)
+func incomingCounter(t base.Types, props tcpProps, size int) {
+	base.CountIncomingMessage(t, props.id(), props.LocalPort, props.Path)
+	base.ObserveMessageSize(t, props.id(), size)
 }
 
 type tcpHandler struct {
@@ -229,8 +276,11 @@ func (h tcpHandler) HandleConnection(conn net.Conn, config conf.TCPSourceConfig)
 	defer s.RemoveConnection(conn)
 
 	props := eprops(conn)
+	props.Sequenced = s.OrderingCheck
 	logger := makeLogger(s.Logger, props, "tcp")
-	logger.Info("New client")
+	connLog := s.connLog(logger, config)
+	connLog.opened()
+	defer connLog.closed()
 	factory := makeRawTCPFactory(props, config.ConfID, config.DecoderBaseConfig)
 	clientCounter(base.TCP, props)
 
@@ -238,12 +288,18 @@ func (h tcpHandler) HandleConnection(conn net.Conn, config conf.TCPSourceConfig)
 	if timeout > 0 {
 		_ = conn.SetReadDeadline(time.Now().Add(timeout))
 	}
-	scanner := utils.WithRecover(bufio.NewScanner(conn))
+	input, err := decompressStream(conn, config.Decompress)
+	if err != nil {
+		return eerrors.Wrap(err, "TCP decompression error")
+	}
+	scanner := utils.WithRecover(bufio.NewScanner(input))
 	scanner.Buffer(make([]byte, 0, s.MaxMessageSize), s.MaxMessageSize)
 	if config.LineFraming {
 		scanner.Split(makeLFTCPSplit(config.FrameDelimiter))
+	} else if config.OctetCounting {
+		scanner.Split(OctetCountingSplit)
 	} else {
-		scanner.Split(TcpSplit)
+		scanner.Split(makeTCPSplit(config.FrameDelimiter))
 	}
 
 	for scanner.Scan() {
@@ -261,7 +317,7 @@ func (h tcpHandler) HandleConnection(conn net.Conn, config conf.TCPSourceConfig)
 		if err != nil {
 			return eerrors.Fatal(eerrors.Wrap(err, "Failed to enqueue new raw TCP message"))
 		}
-		incomingCounter(base.TCP, props)
+		incomingCounter(base.TCP, props, len(buf))
 	}
 	err = scanner.Err()
 	if eerrors.HasFileClosed(err) {
@@ -270,8 +326,31 @@ func (h tcpHandler) HandleConnection(conn net.Conn, config conf.TCPSourceConfig)
 	return eerrors.Wrap(err, "TCP scanning error")
 }
 
+// delimiterIndex returns the position and the length of the first delimiter
+// in the data. The delimiter "\r\n" only matches CRLF, and "\r" matches CR,
+// LF or CRLF.
+func delimiterIndex(delimiter string) func(data []byte) (int, int) {
+	sep := []byte(delimiter)
+	switch delimiter {
+	case "\r\n":
+		return func(data []byte) (int, int) {
+			return bytes.Index(data, sep), 2
+		}
+	case "\r":
+		return func(data []byte) (int, int) {
+			return bytes.IndexAny(data, "\r\n"), 1
+		}
+	default:
+		return func(data []byte) (int, int) {
+			return bytes.IndexByte(data, sep[0]), 1
+		}
+	}
+}
+
+// makeLFTCPSplit returns the split function of the line framing. The empty
+// records are skipped.
 func makeLFTCPSplit(delimiter string) func(d []byte, a bool) (int, []byte, error) {
-	delim := []byte(delimiter)[0]
+	index := delimiterIndex(delimiter)
 	f := func(data []byte, atEOF bool) (advance int, token []byte, eoferr error) {
 		if atEOF {
 			eoferr = io.EOF
@@ -281,56 +360,126 @@ func makeLFTCPSplit(delimiter string) func(d []byte, a bool) (int, []byte, error
 			return 0, nil, eoferr
 		}
 		trimmed := len(data) - len(trimmedData)
-		lf := bytes.IndexByte(trimmedData, delim)
-		if lf < 1 {
+		lf, seplen := index(trimmedData)
+		if lf < 0 {
 			return 0, nil, eoferr
 		}
+		advance = trimmed + lf + seplen
 		token = bytes.Trim(trimmedData[0:lf], " \r\n")
-		advance = trimmed + lf + 1
+		if len(token) == 0 {
+			// empty record, such as consecutive NUL delimiters
+			return advance, nil, nil
+		}
 		return advance, token, nil
 	}
 	return f
 }
 
-func getline(data []byte, trimmed int, eoferr error) (int, []byte, error) {
-	lf := bytes.IndexByte(data, '\n')
-	if lf <= 0 {
-		return 0, nil, eoferr
+// makeTCPSplit returns the split function that detects the framing of each
+// message: the octet-counting framing when the message starts with its
+// length, or else the non-transparent framing of RFC6587, where the trailer
+// is the delimiter. The trailer can be LF (default) or, for the senders that
+// put newlines in their messages, NUL or any other character.
+func makeTCPSplit(delimiter string) func(d []byte, a bool) (int, []byte, error) {
+	if len(delimiter) == 0 {
+		delimiter = "\n"
+	}
+	index := delimiterIndex(delimiter)
+	// leading trailers are empty frames
+	cutset := " \r\n" + delimiter
+	// a frame without spaces ends at the first trailer
+	lengthEnd := " \n" + delimiter
+
+	getline := func(data []byte, trimmed int, eoferr error) (int, []byte, error) {
+		lf, seplen := index(data)
+		if lf <= 0 {
+			return 0, nil, eoferr
+		}
+		token := bytes.Trim(data[0:lf], " \r\n")
+		return lf + trimmed + seplen, token, nil
 	}
-	token := bytes.Trim(data[0:lf], " \r\n")
-	return lf + trimmed + 1, token, nil
+
+	f := func(data []byte, atEOF bool) (advance int, token []byte, eoferr error) {
+		if atEOF {
+			eoferr = io.EOF
+		}
+		trimmedData := bytes.TrimLeft(data, cutset)
+		if len(trimmedData) == 0 {
+			return 0, nil, eoferr
+		}
+		trimmed := len(data) - len(trimmedData)
+		if trimmedData[0] == byte('<') {
+			return getline(trimmedData, trimmed, eoferr)
+		}
+		// octet counting framing?
+		sp := bytes.IndexAny(trimmedData, lengthEnd)
+		if sp <= 0 {
+			return 0, nil, eoferr
+		}
+		datalenStr := bytes.Trim(trimmedData[0:sp], " \r\n")
+		datalen, err := strconv.Atoi(string(datalenStr))
+		if err != nil {
+			// the first part is not a number, so back to the trailer
+			return getline(trimmedData, trimmed, eoferr)
+		}
+		advance = trimmed + sp + 1 + datalen
+		if len(data) < advance {
+			return 0, nil, eoferr
+		}
+		token = bytes.Trim(trimmedData[sp+1:sp+1+datalen], " \r\n")
+		return advance, token, nil
+	}
+	return f
 }
 
+var lfTCPSplit = makeTCPSplit("\n")
+
+// TcpSplit splits the stream with the octet-counting framing detection and
+// LF as the trailer of the non-transparent framing.
 func TcpSplit(data []byte, atEOF bool) (advance int, token []byte, eoferr error) {
+	return lfTCPSplit(data, atEOF)
+}
+
+// maxMsgLenDigits is the maximum number of digits of the MSG-LEN field in
+// the octet-counting framing.
+const maxMsgLenDigits = 10
+
+// OctetCountingSplit splits the stream according to the RFC5425 framing
+// (MSG-LEN SP SYSLOG-MSG). Contrary to TcpSplit, the content of the message
+// is never inspected, so that messages that don't start with '<' are framed
+// correctly.
+func OctetCountingSplit(data []byte, atEOF bool) (advance int, token []byte, eoferr error) {
 	if atEOF {
 		eoferr = io.EOF
 	}
-	trimmedData := bytes.TrimLeft(data, " \r\n")
-	if len(trimmedData) == 0 {
+	if len(data) == 0 {
 		return 0, nil, eoferr
 	}
-	trimmed := len(data) - len(trimmedData)
-	if trimmedData[0] == byte('<') {
-		return getline(trimmedData, trimmed, eoferr)
-	}
-	// octet counting framing?
-	sp := bytes.IndexAny(trimmedData, " \n")
-	if sp <= 0 {
+	sp := bytes.IndexByte(data, ' ')
+	if sp < 0 {
+		if len(data) > maxMsgLenDigits {
+			return 0, nil, eerrors.Errorf("Invalid octet-counting frame: no MSG-LEN in '%s'", data[:maxMsgLenDigits])
+		}
 		return 0, nil, eoferr
 	}
-	datalenStr := bytes.Trim(trimmedData[0:sp], " \r\n")
-	datalen, err := strconv.Atoi(string(datalenStr))
-	if err != nil {
-		// the first part is not a number, so back to LF
-		return getline(trimmedData, trimmed, eoferr)
+	if sp == 0 || sp > maxMsgLenDigits || data[0] == '0' {
+		return 0, nil, eerrors.Errorf("Invalid octet-counting frame: bad MSG-LEN '%s'", data[:sp])
+	}
+	datalen := 0
+	for _, c := range data[:sp] {
+		if c < '0' || c > '9' {
+			return 0, nil, eerrors.Errorf("Invalid octet-counting frame: bad MSG-LEN '%s'", data[:sp])
+		}
+		datalen = datalen*10 + int(c-'0')
 	}
-	advance = trimmed + sp + 1 + datalen
+	advance = sp + 1 + datalen
 	if len(data) < advance {
-		return 0, nil, eoferr
+		if atEOF {
+			return 0, nil, io.ErrUnexpectedEOF
+		}
+		return 0, nil, nil
 	}
-	token = bytes.Trim(trimmedData[sp+1:sp+1+datalen], " \r\n")
-	return advance, token, nil
-
+	return advance, data[sp+1 : advance], nil
 }
 
 type tcpProps struct {
@@ -338,6 +487,38 @@ type tcpProps struct {
 	LocalPortStr string
 	Client       string
 	Path         string
+	// ClientID is the stable identifier of the client, when the protocol
+	// provides one (RELP open offer)
+	ClientID      *atomic.String
+	ClientIDOffer string
+	// OpenOffers are the additional offers advertised in the RELP open response
+	OpenOffers []string
+	// EmptyFrames is the handling of the RELP syslog commands without data
+	EmptyFrames string
+	// OfferMismatch is the handling of the RELP open offers that require an
+	// unsupported capability
+	OfferMismatch string
+	// TLS tells whether the connection is encrypted
+	TLS bool
+	// Sequenced stamps the raw messages with a per connection sequence
+	// number, for the ordering check
+	Sequenced bool
+	// BatchSize is the number of raw messages pushed to the queue at once
+	BatchSize int
+	// MaxPendingAnswers is the number of unanswered RELP transactions above
+	// which the connection stops reading
+	MaxPendingAnswers int
+	// ReplayGracePeriod enables the replay buffer when the client offers a
+	// client id (see relpReplay)
+	ReplayGracePeriod time.Duration
+}
+
+// id returns the client identifier to use in logs and metrics.
+func (p tcpProps) id() string {
+	if p.ClientID != nil {
+		return p.ClientID.Load()
+	}
+	return p.Client
 }
 
 func eprops(conn net.Conn) (props tcpProps) {
@@ -356,5 +537,6 @@ func eprops(conn net.Conn) (props tcpProps) {
 		}
 	}
 	props.LocalPortStr = strconv.FormatInt(int64(props.LocalPort), 10)
+	_, props.TLS = conn.(*tls.Conn)
 	return props
 }
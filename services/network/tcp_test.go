@@ -0,0 +1,128 @@
+package network
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestOctetCountingSplit(t *testing.T) {
+	messages := []string{
+		"<13>1 2018-01-01T00:00:00Z host app - - - hello world",
+		"12 messages with digits 345 and spaces",
+		"no PRI at all < but a lower-than sign",
+		"<not a PRI> 42 <",
+		" leading and trailing spaces ",
+	}
+	var stream strings.Builder
+	for _, m := range messages {
+		fmt.Fprintf(&stream, "%d %s", len(m), m)
+	}
+
+	// a small reader buffer makes the frames span several reads
+	scanner := bufio.NewScanner(bufio.NewReaderSize(strings.NewReader(stream.String()), 16))
+	scanner.Split(OctetCountingSplit)
+	var got []string
+	for scanner.Scan() {
+		got = append(got, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(messages) {
+		t.Fatalf("expected %d messages, got %d: %q", len(messages), len(got), got)
+	}
+	for i := range messages {
+		if got[i] != messages[i] {
+			t.Errorf("message %d: expected %q, got %q", i, messages[i], got[i])
+		}
+	}
+}
+
+func TestOctetCountingSplitErrors(t *testing.T) {
+	for _, stream := range []string{
+		"<13>1 not octet-counted",
+		"012 leading zero",
+		"12345678901 too many digits",
+		"10 truncated",
+	} {
+		scanner := bufio.NewScanner(strings.NewReader(stream))
+		scanner.Split(OctetCountingSplit)
+		for scanner.Scan() {
+			t.Errorf("%q: unexpected token %q", stream, scanner.Text())
+		}
+		if scanner.Err() == nil {
+			t.Errorf("%q: expected a framing error", stream)
+		}
+	}
+}
+
+func TestLineFramingSeparators(t *testing.T) {
+	tests := []struct {
+		delimiter string
+		stream    string
+		expected  []string
+	}{
+		{"\n", "first\nsecond\r\nthird\n", []string{"first", "second", "third"}},
+		{"\r\n", "first\r\nsecond\nstill second\r\nthird\r\n", []string{"first", "second\nstill second", "third"}},
+		{"\r", "first\rsecond\nthird\r\nfourth\r", []string{"first", "second", "third", "fourth"}},
+		{"\x00", "first\x00multi\nline\r\nrecord\x00\x00third\x00", []string{"first", "multi\nline\r\nrecord", "third"}},
+	}
+	for _, test := range tests {
+		// a small reader buffer makes the records span several reads
+		scanner := bufio.NewScanner(bufio.NewReaderSize(strings.NewReader(test.stream), 16))
+		scanner.Split(makeLFTCPSplit(test.delimiter))
+		var got []string
+		for scanner.Scan() {
+			got = append(got, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(test.expected) {
+			t.Fatalf("%q: expected %q, got %q", test.delimiter, test.expected, got)
+		}
+		for i := range got {
+			if got[i] != test.expected[i] {
+				t.Errorf("%q: record %d: expected %q, got %q", test.delimiter, i, test.expected[i], got[i])
+			}
+		}
+	}
+}
+
+func TestNonTransparentFramingTrailers(t *testing.T) {
+	multiline := "<13>1 2018-01-01T00:00:00Z host app - - - first line\nsecond line"
+	octets := "<13>1 2018-01-01T00:00:00Z host app - - - octet counted"
+	tests := []struct {
+		delimiter string
+		stream    string
+		expected  []string
+	}{
+		{"\n", "<13>first\n" + fmt.Sprintf("%d %s", len(octets), octets) + "<13>second\n", []string{"<13>first", octets, "<13>second"}},
+		{"\x00", "<13>first\x00" + multiline + "\x00\x00" + fmt.Sprintf("%d %s", len(octets), octets) + "nopri\x00", []string{"<13>first", multiline, octets, "nopri"}},
+		{"|", multiline + "|<13>second|" + fmt.Sprintf("%d %s", len(multiline), multiline) + "<13>third|", []string{multiline, "<13>second", multiline, "<13>third"}},
+	}
+	for _, test := range tests {
+		// a small reader buffer makes the frames span several reads
+		scanner := bufio.NewScanner(bufio.NewReaderSize(strings.NewReader(test.stream), 16))
+		scanner.Split(makeTCPSplit(test.delimiter))
+		var got []string
+		for scanner.Scan() {
+			if len(scanner.Bytes()) > 0 {
+				got = append(got, scanner.Text())
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(test.expected) {
+			t.Fatalf("%q: expected %q, got %q", test.delimiter, test.expected, got)
+		}
+		for i := range got {
+			if got[i] != test.expected[i] {
+				t.Errorf("%q: frame %d: expected %q, got %q", test.delimiter, i, test.expected[i], got[i])
+			}
+		}
+	}
+}
@@ -3,10 +3,10 @@ package network
 import (
 	"io"
 	"net"
-	"runtime"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	dto "github.com/prometheus/client_model/go"
 	"github.com/stephane-martin/skewer/conf"
@@ -33,6 +33,7 @@ type UdpServiceImpl struct {
 	fatalOnce        *sync.Once
 	parserEnv        *decoders.ParsersEnv
 	rawMessagesQueue *udp.Ring
+	stats            parseStats
 }
 
 func NewUdpService(env *base.ProviderEnv) (*UdpServiceImpl, error) {
@@ -56,7 +57,10 @@ func (s *UdpServiceImpl) SetConf(c conf.BaseConfig) {
 	s.BaseService.SetConf(c.Parsers, c.Main.InputQueueSize)
 	s.UdpConfigs = c.UDPSource
 	s.rawMessagesQueue = udp.NewRing(c.Main.InputQueueSize)
+	s.ParseWorkers = c.Main.ParseWorkers
+	s.BindRetryPeriod = c.Main.BindRetryPeriod
 	s.parserEnv = decoders.NewParsersEnv(s.ParserConfigs, s.Logger)
+	base.ConfigureFieldSizes(c.Main.FieldSizeMetrics, c.Main.FieldSizeWindow)
 }
 
 // Parse fetch messages from the raw queue, parse them, and push them to be sent.
@@ -68,12 +72,14 @@ func (s *UdpServiceImpl) Parse() error {
 		if raw == nil || err != nil {
 			return nil
 		}
+		s.stats.begin(s.rawMessagesQueue.Len())
 		err = s.ParseOne(raw, gen)
 		if err != nil {
-			base.CountParsingError(base.UDP, raw.Client, raw.Decoder.Format)
+			base.CountParsingError(base.UDP, raw.Client, raw.Decoder.Format, err)
 			logg(s.Logger, &raw.RawMessage).Warn(err.Error())
 		}
 		model.RawUDPFree(raw)
+		s.stats.end()
 
 		if err != nil && eerrors.IsFatal(err) {
 			// stop processing when fatal error happens
@@ -83,7 +89,10 @@ func (s *UdpServiceImpl) Parse() error {
 }
 
 func (s *UdpServiceImpl) ParseOne(raw *model.RawUDPMessage, gen *utils.Generator) error {
+	start := time.Now()
+	checksum := base.Checksum(&raw.Decoder, raw.Message[:raw.Size])
 	syslogMsgs, err := s.parserEnv.Parse(&raw.Decoder, raw.Message[:raw.Size])
+	base.ObserveParseDuration(base.UDP, raw.Decoder.Format, start)
 	if err != nil {
 		return err
 	}
@@ -92,6 +101,12 @@ func (s *UdpServiceImpl) ParseOne(raw *model.RawUDPMessage, gen *utils.Generator
 		if syslogMsg == nil {
 			continue
 		}
+		if !base.NormalizeTime(base.UDP, syslogMsg, &raw.Decoder) {
+			model.Free(syslogMsg)
+			continue
+		}
+		base.NormalizeHostname(syslogMsg, &raw.Decoder)
+		base.ObserveFieldSizes(base.UDP, &raw.RawMessage, syslogMsg)
 		full := model.FullFactoryFrom(syslogMsg)
 		full.Uid = gen.Uid()
 		full.ConfId = raw.ConfID
@@ -99,6 +114,13 @@ func (s *UdpServiceImpl) ParseOne(raw *model.RawUDPMessage, gen *utils.Generator
 		full.SourcePath = raw.UnixSocketPath
 		full.SourcePort = int32(raw.LocalPort)
 		full.ClientAddr = raw.Client
+		full.TimeReceivedNum = raw.Received.UnixNano()
+		base.SetChecksum(full, checksum)
+		if raw.HasCreds {
+			syslogMsg.SetProperty("skewer", "pid", strconv.FormatInt(int64(raw.Creds.Pid), 10))
+			syslogMsg.SetProperty("skewer", "uid", strconv.FormatUint(uint64(raw.Creds.Uid), 10))
+			syslogMsg.SetProperty("skewer", "gid", strconv.FormatUint(uint64(raw.Creds.Gid), 10))
+		}
 		err := s.stasher.Stash(full)
 		model.FullFree(full)
 
@@ -121,8 +143,9 @@ func (s *UdpServiceImpl) Start() ([]model.ListenerInfo, error) {
 	s.fatalOnce = &sync.Once{}
 
 	// start the parsers
-	cpus := runtime.NumCPU()
-	for i := 0; i < cpus; i++ {
+	workers := parseWorkers(s.ParseWorkers)
+	s.stats = newParseStats(base.UDP, workers)
+	for i := 0; i < workers; i++ {
 		s.wg.Add(1)
 		go func() {
 			defer s.wg.Done()
@@ -177,10 +200,15 @@ func (s *UdpServiceImpl) Stop() {
 func (s *UdpServiceImpl) ListenPacket(c chan model.ListenerInfo) {
 	var wg sync.WaitGroup
 	s.UnixSocketPaths = []string{}
+	retrier := newBindRetrier(base.Types2Names[base.UDP], s.BindRetryPeriod, s.Logger)
 
 	for _, syslogConf := range s.UdpConfigs {
 		if len(syslogConf.UnixSocketPath) > 0 {
-			conn, err := s.Binder.ListenPacket("unixgram", syslogConf.UnixSocketPath, 65536)
+			var conn net.PacketConn
+			err := retrier.bind(syslogConf.UnixSocketPath, func() (err error) {
+				conn, err = s.Binder.ListenPacket("unixgram", syslogConf.UnixSocketPath, 65536)
+				return err
+			})
 			if err != nil {
 				s.Logger.Warn("Listen unixgram error", "error", err)
 				continue
@@ -212,7 +240,11 @@ func (s *UdpServiceImpl) ListenPacket(c chan model.ListenerInfo) {
 			}
 		L:
 			for port, listenAddr := range listenAddrs {
-				conn, err := s.Binder.ListenPacket("udp", listenAddr, 65536)
+				var conn net.PacketConn
+				err := retrier.bind(listenAddr, func() (err error) {
+					conn, err = s.Binder.ListenPacket("udp", listenAddr, 65536)
+					return err
+				})
 				if err != nil {
 					s.Logger.Warn("Listen UDP error", "error", err)
 					continue L
@@ -225,9 +257,10 @@ func (s *UdpServiceImpl) ListenPacket(c chan model.ListenerInfo) {
 					"format", syslogConf.Format,
 				)
 				c <- model.ListenerInfo{
-					BindAddr: syslogConf.BindAddr,
-					Port:     port,
-					Protocol: "udp",
+					BindAddr:  syslogConf.ResolvedBindAddr(),
+					Interface: syslogConf.BindInterface,
+					Port:      port,
+					Protocol:  "udp",
 				}
 				wg.Add(1)
 				go func() {
@@ -262,9 +295,19 @@ func (s *UdpServiceImpl) handleConnection(conn net.PacketConn, config conf.UDPSo
 		}
 	}
 
+	// on unix sockets, identify the clients by their credentials
+	creds, err := newCredReader(conn)
+	if err != nil {
+		s.Logger.Warn("Clients of the unix socket will not be identified", "path", path, "error", err)
+	}
+	read := model.RawUDPFromConn
+	if creds != nil {
+		read = func(net.PacketConn) (*model.RawUDPMessage, net.Addr, error) { return creds.read() }
+	}
+
 	// Syslog UDP server
 	for {
-		rawmsg, remote, err := model.RawUDPFromConn(conn)
+		rawmsg, remote, err := read(conn)
 		if err != nil {
 			if eerrors.HasFileClosed(err) {
 				return io.EOF
@@ -278,16 +321,23 @@ func (s *UdpServiceImpl) handleConnection(conn net.PacketConn, config conf.UDPSo
 		rawmsg.UnixSocketPath = path
 		rawmsg.Decoder = config.DecoderBaseConfig
 		rawmsg.ConfID = config.ConfID
+		rawmsg.Received = time.Now()
 		rawmsg.Client = ""
-		if remote == nil {
-			rawmsg.Client = "localhost" // unix socket
-		} else {
-			rawmsg.Client = strings.Split(remote.String(), ":")[0]
+		if rawmsg.HasCreds {
+			rawmsg.Client = processName(rawmsg.Creds.Pid)
+		}
+		if rawmsg.Client == "" {
+			if remote == nil || path != "" {
+				rawmsg.Client = "localhost" // unix socket
+			} else {
+				rawmsg.Client = strings.Split(remote.String(), ":")[0]
+			}
 		}
 		err = s.rawMessagesQueue.Put(rawmsg)
 		if err != nil {
 			return eerrors.WithTypes(eerrors.Wrap(err, "Failed to enqueue new raw UDP message"))
 		}
 		base.CountIncomingMessage(base.UDP, rawmsg.Client, rawmsg.LocalPort, path)
+		base.ObserveMessageSize(base.UDP, rawmsg.Client, rawmsg.Size)
 	}
 }
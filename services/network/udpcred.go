@@ -0,0 +1,71 @@
+package network
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/stephane-martin/skewer/model"
+)
+
+// overflowUID is the uid that the kernel reports for a process whose uid has
+// no mapping in the user namespace of the receiver.
+const overflowUID = 65534
+
+// visibleCreds tells if the credentials of a datagram identify the sending
+// process. The kernel reports pid 0 for a process of a pid namespace that
+// the receiver can't see, and the overflow uid for an unmapped uid: stamping
+// them would attribute the message to a wrong process or user.
+func visibleCreds(c model.Credentials) bool {
+	return c.Pid > 0 && c.Uid != overflowUID
+}
+
+// unixConn returns the unix socket behind a packet connection, if any.
+func unixConn(conn net.PacketConn) *net.UnixConn {
+	switch c := conn.(type) {
+	case *net.UnixConn:
+		return c
+	case interface {
+		UnixConn() (*net.UnixConn, bool)
+	}:
+		uc, _ := c.UnixConn()
+		return uc
+	}
+	return nil
+}
+
+type commEntry struct {
+	name    string
+	expires time.Time
+}
+
+// commCache remembers the names of the processes by pid for a while, so that
+// /proc is not read for every datagram. Failed lookups are cached too.
+type commCache struct {
+	sync.Mutex
+	ttl     time.Duration
+	entries map[int32]commEntry
+}
+
+func newCommCache(ttl time.Duration) *commCache {
+	return &commCache{ttl: ttl, entries: make(map[int32]commEntry)}
+}
+
+func (c *commCache) get(pid int32, lookup func(int32) string) string {
+	now := time.Now()
+	c.Lock()
+	defer c.Unlock()
+	if e, ok := c.entries[pid]; ok && now.Before(e.expires) {
+		return e.name
+	}
+	if len(c.entries) >= 4096 {
+		for p, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, p)
+			}
+		}
+	}
+	name := lookup(pid)
+	c.entries[pid] = commEntry{name: name, expires: now.Add(c.ttl)}
+	return name
+}
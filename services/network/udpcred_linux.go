@@ -0,0 +1,96 @@
+// +build linux
+
+package network
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+	"golang.org/x/sys/unix"
+)
+
+var comms = newCommCache(10 * time.Second)
+
+func readComm(pid int32) string {
+	comm, err := ioutil.ReadFile("/proc/" + strconv.FormatInt(int64(pid), 10) + "/comm")
+	if err != nil {
+		return ""
+	}
+	return string(bytes.TrimSpace(comm))
+}
+
+// processName returns the command name of a local process, or an empty
+// string if it is unknown.
+func processName(pid int32) string {
+	if pid <= 0 {
+		return ""
+	}
+	return comms.get(pid, readComm)
+}
+
+// credReader reads the datagrams of a unix socket with the credentials of
+// the sending processes (SO_PASSCRED).
+type credReader struct {
+	conn *net.UnixConn
+	oob  []byte
+}
+
+func newCredReader(conn net.PacketConn) (*credReader, error) {
+	uc := unixConn(conn)
+	if uc == nil {
+		return nil, nil
+	}
+	rawConn, err := uc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var serr error
+	err = rawConn.Control(func(fd uintptr) {
+		serr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_PASSCRED, 1)
+	})
+	if err == nil {
+		err = serr
+	}
+	if err != nil {
+		return nil, eerrors.Wrap(err, "Failed to set SO_PASSCRED on the unix socket")
+	}
+	return &credReader{
+		conn: uc,
+		oob:  make([]byte, unix.CmsgSpace(unix.SizeofUcred)),
+	}, nil
+}
+
+func (r *credReader) read() (raw *model.RawUDPMessage, remote net.Addr, err error) {
+	raw = model.RawUDPFactory()
+	raw.HasCreds = false
+	n, oobn, _, addr, err := r.conn.ReadMsgUnix(raw.Message[:], r.oob)
+	raw.Size = n
+	if addr != nil {
+		remote = addr
+	}
+	if err != nil || oobn == 0 {
+		return raw, remote, err
+	}
+	msgs, perr := unix.ParseSocketControlMessage(r.oob[:oobn])
+	if perr != nil {
+		return raw, remote, nil
+	}
+	for i := range msgs {
+		creds, cerr := unix.ParseUnixCredentials(&msgs[i])
+		if cerr != nil {
+			continue
+		}
+		c := model.Credentials{Pid: creds.Pid, Uid: creds.Uid, Gid: creds.Gid}
+		if visibleCreds(c) {
+			raw.Creds = c
+			raw.HasCreds = true
+		}
+		break
+	}
+	return raw, remote, nil
+}
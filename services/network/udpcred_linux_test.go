@@ -0,0 +1,99 @@
+// +build linux
+
+package network
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stephane-martin/skewer/model"
+)
+
+func TestCredReader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "skewer-unixgram")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "log.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	reader, err := newCredReader(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reader == nil {
+		t.Fatal("no credentials reader for a unix socket")
+	}
+
+	client, err := net.Dial("unixgram", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+	_, err = client.Write([]byte("<13>hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, _, err := reader.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer model.RawUDPFree(raw)
+	if string(raw.GetMessage()) != "<13>hello" {
+		t.Errorf("unexpected message: %q", raw.GetMessage())
+	}
+	if !raw.HasCreds {
+		t.Fatal("the credentials of the client are missing")
+	}
+	if int(raw.Creds.Pid) != os.Getpid() || int(raw.Creds.Uid) != os.Getuid() || int(raw.Creds.Gid) != os.Getgid() {
+		t.Errorf("unexpected credentials: %+v", raw.Creds)
+	}
+	comm, err := ioutil.ReadFile("/proc/self/comm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := processName(raw.Creds.Pid); name != strings.TrimSpace(string(comm)) {
+		t.Errorf("unexpected process name: %q", name)
+	}
+
+	// UDP sockets are read as usual
+	udpConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = udpConn.Close() }()
+	if reader, err := newCredReader(udpConn); reader != nil || err != nil {
+		t.Errorf("unexpected credentials reader for a UDP socket: %v", err)
+	}
+}
+
+func TestVisibleCreds(t *testing.T) {
+	tests := []struct {
+		creds   model.Credentials
+		visible bool
+	}{
+		{model.Credentials{Pid: 1234, Uid: 1000, Gid: 1000}, true},
+		{model.Credentials{Pid: 1, Uid: 0, Gid: 0}, true},
+		// 65534 is also the gid of the nogroup group
+		{model.Credentials{Pid: 1234, Uid: 1000, Gid: overflowUID}, true},
+		// a process of another pid namespace
+		{model.Credentials{Pid: 0, Uid: 1000, Gid: 1000}, false},
+		// a uid without a mapping in our user namespace
+		{model.Credentials{Pid: 1234, Uid: overflowUID, Gid: overflowUID}, false},
+	}
+	for _, tt := range tests {
+		if visibleCreds(tt.creds) != tt.visible {
+			t.Errorf("%+v: expected visible=%t", tt.creds, tt.visible)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+// +build !linux
+
+package network
+
+import (
+	"net"
+
+	"github.com/stephane-martin/skewer/model"
+)
+
+// credReader is only available on Linux.
+type credReader struct{}
+
+func newCredReader(conn net.PacketConn) (*credReader, error) {
+	return nil, nil
+}
+
+func (r *credReader) read() (*model.RawUDPMessage, net.Addr, error) {
+	return nil, nil, nil
+}
+
+func processName(pid int32) string {
+	return ""
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/awnumar/memguard"
 	"github.com/gogo/protobuf/proto"
 	"github.com/inconshreveable/log15"
+	"github.com/prometheus/client_golang/prometheus"
 	dto "github.com/prometheus/client_model/go"
 	"github.com/stephane-martin/skewer/conf"
 	"github.com/stephane-martin/skewer/consul"
@@ -23,8 +24,10 @@ import (
 	"github.com/stephane-martin/skewer/sys/capabilities"
 	"github.com/stephane-martin/skewer/sys/kring"
 	"github.com/stephane-martin/skewer/sys/namespaces"
+	"github.com/stephane-martin/skewer/transform"
 	"github.com/stephane-martin/skewer/utils"
 	"github.com/stephane-martin/skewer/utils/eerrors"
+	"github.com/stephane-martin/skewer/utils/recenterrors"
 	"github.com/stephane-martin/skewer/utils/reservoir"
 	"github.com/stephane-martin/skewer/utils/waiter"
 )
@@ -40,8 +43,51 @@ var SHUTDOWN = []byte("shutdown")
 var STARTERROR = []byte("starterror")
 var GATHER = []byte("gathermetrics")
 var METRICS = []byte("metrics")
+var GETERRORS = []byte("geterrors")
+var ERRORS = []byte("errors")
+var PAUSE = []byte("pause")
+var RESUME = []byte("resume")
+var DRAIN = []byte("drain")
+var SEEK = []byte("seek")
+var PROFILE = []byte("profile")
+var GETTXNS = []byte("gettxns")
+var TXNS = []byte("txns")
+var ACKS = []byte("acks")
+var STOREDOWN = []byte("storedown")
+var STOREUP = []byte("storeup")
 var NOLISTENER = eerrors.New("no listener")
 
+// maxPluginMessageSize bounds the size of the messages that the plugins
+// write to their controller.
+const maxPluginMessageSize = 16 * 1024 * 1024
+
+// ControllerRegistry holds the metrics of the plugin controllers, which run
+// in the parent process.
+var ControllerRegistry = newControllerRegistry()
+
+var pluginStartDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "skw_plugin_start_duration_seconds",
+		Help:    "time taken by the plugins to report that they have started",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 11),
+	},
+	[]string{"plugin"},
+)
+
+var pluginStartTimeoutsCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "skw_plugin_start_timeouts_total",
+		Help: "number of plugins that failed to start before the timeout",
+	},
+	[]string{"plugin"},
+)
+
+func newControllerRegistry() *prometheus.Registry {
+	r := prometheus.NewRegistry()
+	r.MustRegister(pluginStartDuration, pluginStartTimeoutsCounter, storeRestartsCounter)
+	return r
+}
+
 // Controller launches and controls the various services by distinct processes.
 type Controller struct {
 	typ  base.Types
@@ -55,6 +101,10 @@ type Controller struct {
 	registry *consul.Registry
 
 	metricsChan chan []*dto.MetricFamily
+	errorsChan  chan recenterrors.Snapshot
+	profileMu   sync.Mutex
+	profileChan chan base.ProfileResponse
+	txnsChan    chan []base.RelpTransactions
 	stdinMu     sync.Mutex
 	stdinWriter *utils.SigWriter
 	signKey     *memguard.LockedBuffer
@@ -69,6 +119,10 @@ type Controller struct {
 	started   bool
 	created   bool
 	ring      kring.Ring
+	infosMu   sync.Mutex
+	infos     []model.ListenerInfo
+	// onAcks receives the outcomes of the messages that the Store reports
+	onAcks func(payload []byte)
 }
 
 type CFactory struct {
@@ -104,18 +158,32 @@ func (f *CFactory) New(typ base.Types) (*Controller, error) {
 		signKey:      f.signKey,
 		ring:         f.ring,
 		metricsChan:  make(chan []*dto.MetricFamily),
+		errorsChan:   make(chan recenterrors.Snapshot, 1),
+		profileChan:  make(chan base.ProfileResponse, 1),
+		txnsChan:     make(chan []base.RelpTransactions, 1),
 		ShutdownChan: make(chan struct{}),
 	}
+	if f.stasher != nil {
+		f.stasher.addPlugin(&s)
+	}
+	if typ == base.RELP && f.stasher != nil {
+		// only the RELP sources wait for the end to end acknowledgments
+		f.stasher.setAcksRecipient(&s)
+	}
 	return &s, nil
 }
 
 func (f *CFactory) NewStore(loggerHandle uintptr) *StoreController {
 	st, _ := f.New(base.Store)
-	return &StoreController{
+	sc := &StoreController{
 		Controller: st,
 		gen:        utils.NewGenerator(),
 		reserv:     reservoir.NewReservoir(5000),
+		geoip:      NewGeoIPEnricher(st.logger),
+		gate:       newStoreGate(),
 	}
+	st.onAcks = sc.forwardAcks
+	return sc
 }
 
 // W encodes an writes a message to the controlled plugin via its stdin
@@ -150,7 +218,7 @@ func (s *Controller) Gather() (m []*dto.MetricFamily, err error) {
 		select {
 		case <-s.ShutdownChan:
 			return nil, nil
-		case <-time.After(2 * time.Second):
+		case <-time.After(s.conf.Main.PluginGatherTimeout):
 			s.logger.Debug("Child did not respond to metrics request after timeout", "type", s.typ)
 			return nil, nil
 		case metrics, more := <-s.metricsChan:
@@ -162,6 +230,159 @@ func (s *Controller) Gather() (m []*dto.MetricFamily, err error) {
 	}
 }
 
+// RecentErrors asks the controlled plugin to report its recent errors.
+func (s *Controller) RecentErrors() (snapshot recenterrors.Snapshot) {
+	select {
+	case <-s.ShutdownChan:
+		return snapshot
+	default:
+	}
+	s.startedMu.Lock()
+	started := s.started
+	s.startedMu.Unlock()
+	if !started {
+		return snapshot
+	}
+	// drop a late answer to a previous request
+	select {
+	case <-s.errorsChan:
+	default:
+	}
+	if s.W(GETERRORS, utils.NOW) != nil {
+		return snapshot
+	}
+	select {
+	case <-s.ShutdownChan:
+	case <-time.After(s.conf.Main.PluginGatherTimeout):
+		s.logger.Debug("Child did not respond to recent errors request after timeout", "type", s.typ)
+	case snapshot = <-s.errorsChan:
+	}
+	return snapshot
+}
+
+// Transactions asks the controlled RELP plugin for a snapshot of the
+// transactions in progress of its connections.
+func (s *Controller) Transactions() (txns []base.RelpTransactions) {
+	select {
+	case <-s.ShutdownChan:
+		return nil
+	default:
+	}
+	s.startedMu.Lock()
+	started := s.started
+	s.startedMu.Unlock()
+	if !started {
+		return nil
+	}
+	// drop a late answer to a previous request
+	select {
+	case <-s.txnsChan:
+	default:
+	}
+	if s.W(GETTXNS, utils.NOW) != nil {
+		return nil
+	}
+	select {
+	case <-s.ShutdownChan:
+	case <-time.After(s.conf.Main.PluginGatherTimeout):
+		s.logger.Debug("Child did not respond to transactions request after timeout", "type", s.typ)
+	case txns = <-s.txnsChan:
+	}
+	return txns
+}
+
+// Profile asks the controlled plugin for a profile of its process. The
+// plugin answers only when profiling is enabled in the configuration.
+func (s *Controller) Profile(req base.ProfileRequest) ([]byte, error) {
+	err := req.Validate()
+	if err != nil {
+		return nil, err
+	}
+	s.startedMu.Lock()
+	started := s.started
+	s.startedMu.Unlock()
+	if !started {
+		return nil, eerrors.Errorf("Plugin '%s' is not started", s.name)
+	}
+	// one profile at a time, so that the answers are not mixed up
+	s.profileMu.Lock()
+	defer s.profileMu.Unlock()
+	// drop a late answer to a previous request
+	select {
+	case <-s.profileChan:
+	default:
+	}
+	b, _ := json.Marshal(req)
+	err = s.W(PROFILE, b)
+	if err != nil {
+		return nil, err
+	}
+	timeout := s.conf.Main.PluginGatherTimeout
+	if req.Kind == base.ProfileCPU {
+		timeout += time.Duration(req.Seconds) * time.Second
+	}
+	select {
+	case <-s.ShutdownChan:
+		return nil, eerrors.Errorf("Plugin '%s' has shut down", s.name)
+	case <-time.After(timeout):
+		return nil, eerrors.Errorf("Plugin '%s' did not answer the profile request", s.name)
+	case resp := <-s.profileChan:
+		if len(resp.Error) > 0 {
+			return nil, eerrors.New(resp.Error)
+		}
+		return resp.Profile, nil
+	}
+}
+
+// Pause asks the controlled plugin to stop reading new messages on the given
+// listener (a listen address or a unix socket path). The sockets are kept
+// open, so the clients experience backpressure.
+func (s *Controller) Pause(listener string) error {
+	return s.W(PAUSE, []byte(listener))
+}
+
+// Resume asks the controlled plugin to restart reading on a paused listener.
+func (s *Controller) Resume(listener string) error {
+	return s.W(RESUME, []byte(listener))
+}
+
+// Drain asks the controlled RELP plugin to send a serverclose to the clients
+// of the given listener, once their transactions in progress are answered,
+// so that they reconnect elsewhere.
+func (s *Controller) Drain(listener string) error {
+	return s.W(DRAIN, []byte(listener))
+}
+
+// Seek asks the controlled Kafka source plugin to move its consumers to
+// another position of a topic.
+func (s *Controller) Seek(req base.SeekRequest) error {
+	err := req.Validate()
+	if err != nil {
+		return err
+	}
+	reqb, err := json.Marshal(req)
+	if err != nil {
+		return eerrors.Wrap(err, "Failed to marshal the seek request")
+	}
+	return s.W(SEEK, reqb)
+}
+
+// Infos returns the listeners that the controlled plugin has reported as
+// currently active.
+func (s *Controller) Infos() []model.ListenerInfo {
+	s.infosMu.Lock()
+	defer s.infosMu.Unlock()
+	infos := make([]model.ListenerInfo, len(s.infos))
+	copy(infos, s.infos)
+	return infos
+}
+
+func (s *Controller) setInfos(infos []model.ListenerInfo) {
+	s.infosMu.Lock()
+	s.infos = infos
+	s.infosMu.Unlock()
+}
+
 // Stop kindly asks the controlled plugin to stop activity
 func (s *Controller) Stop() error {
 	// in case the plugin was in fact never created...
@@ -248,6 +469,63 @@ func (s *Controller) kill(misbevave bool) (err error) {
 	return err
 }
 
+// stash sends a message of the plugin to the Store controller. The plugin
+// has already acknowledged the message, so that it waits while the Store is
+// restarting.
+func (s *Controller) stash(m *model.FullMessage) error {
+	return s.stasher.Stash(m)
+}
+
+// registrationKey is what the Consul registration of a listener is made of.
+type registrationKey struct {
+	BindAddr string
+	Protocol string
+	Port     int
+}
+
+// listenersDelta returns the listeners of infos that are not in newinfos,
+// and the listeners of newinfos that were not in infos.
+func listenersDelta(infos, newinfos []model.ListenerInfo) (gone, added []model.ListenerInfo) {
+	keys := func(l []model.ListenerInfo) map[registrationKey]bool {
+		m := make(map[registrationKey]bool, len(l))
+		for _, i := range l {
+			m[registrationKey{BindAddr: i.BindAddr, Protocol: i.Protocol, Port: i.Port}] = true
+		}
+		return m
+	}
+	oldKeys := keys(infos)
+	newKeys := keys(newinfos)
+	for _, i := range infos {
+		k := registrationKey{BindAddr: i.BindAddr, Protocol: i.Protocol, Port: i.Port}
+		if !newKeys[k] {
+			gone = append(gone, i)
+			// a listener reported twice is unregistered once
+			newKeys[k] = true
+		}
+	}
+	for _, i := range newinfos {
+		k := registrationKey{BindAddr: i.BindAddr, Protocol: i.Protocol, Port: i.Port}
+		if !oldKeys[k] {
+			added = append(added, i)
+			oldKeys[k] = true
+		}
+	}
+	return gone, added
+}
+
+// updateRegistrations only unregisters from Consul the listeners that are
+// gone, and registers the new ones, so that the unchanged listeners stay
+// discoverable while the plugin reports its listeners again.
+func updateRegistrations(registry *consul.Registry, infos, newinfos []model.ListenerInfo) {
+	gone, added := listenersDelta(infos, newinfos)
+	for _, i := range gone {
+		registry.UnregisterTcpListener(i.BindAddr, i.Protocol, i.Port)
+	}
+	for _, i := range added {
+		registry.RegisterTcpListener(i.BindAddr, i.Protocol, i.Port)
+	}
+}
+
 type infosAndError struct {
 	infos []model.ListenerInfo
 	err   error
@@ -258,9 +536,10 @@ func (s *Controller) listenpipe(secret *memguard.LockedBuffer) (err error) {
 	if s.pipe == nil || s.typ == base.Store || s.typ == base.Configuration {
 		return nil
 	}
+	maxSize := s.conf.Main.MaxPipeMessageSize
 	scanner := utils.WithRecover(bufio.NewScanner(s.pipe))
-	scanner.Split(utils.MakeDecryptSplit(secret))
-	scanner.Buffer(make([]byte, 0, 132000), 132000)
+	scanner.Split(utils.MakeFrameSplit(secret, maxSize))
+	scanner.Buffer(make([]byte, 0, 132000), maxSize+utils.FrameOverhead)
 
 	var message *model.FullMessage
 	protobuff := proto.NewBuffer(make([]byte, 0, 4096))
@@ -271,7 +550,7 @@ func (s *Controller) listenpipe(secret *memguard.LockedBuffer) (err error) {
 		if err != nil {
 			return eerrors.Wrapf(err, "Unexpected error decrypting message from the plugin '%s' pipe", s.name)
 		}
-		err = s.stasher.Stash(message) // send message to the Store controller
+		err = s.stash(message) // send message to the Store controller
 		model.FullFree(message)
 		if err != nil {
 			return eerrors.Wrap(err, "Error stashing message")
@@ -307,11 +586,19 @@ func (s *Controller) listen(secret *memguard.LockedBuffer) chan infosAndError {
 		initialized := false
 		kill := false
 		normalStop := false
+		infos := make([]model.ListenerInfo, 0)
 
 		defer func() {
 			s.logger.Debug("Plugin controller is stopping", "type", s.name)
 			startError(eerrors.New("unexpected end of plugin before it was initialized"), nil)
+			if s.registry != nil && !normalStop {
+				// the listeners are gone, but they are still registered in consul
+				for _, i := range infos {
+					s.registry.SetListenerHealth(i.BindAddr, i.Port, false, fmt.Sprintf("%s plugin has stopped", s.name))
+				}
+			}
 
+			s.setInfos(nil)
 			s.createdMu.Lock()
 			s.startedMu.Lock()
 			s.started = false
@@ -346,9 +633,9 @@ func (s *Controller) listen(secret *memguard.LockedBuffer) chan infosAndError {
 		// read the encoded messages that the plugin may write on stdout
 		scanner := utils.WithRecover(bufio.NewScanner(s.cmd.Stdout))
 		scanner.Split(utils.PluginSplit)
-		scanner.Buffer(make([]byte, 0, 132000), 132000)
+		// the profiles are the largest messages
+		scanner.Buffer(make([]byte, 0, 132000), maxPluginMessageSize)
 		command := ""
-		infos := make([]model.ListenerInfo, 0)
 
 		for scanner.Scan() {
 			parts := bytes.SplitN(scanner.Bytes(), space, 2)
@@ -368,7 +655,7 @@ func (s *Controller) listen(secret *memguard.LockedBuffer) chan infosAndError {
 					m := model.FullFactory()
 					err := m.Decrypt(secret, parts[1])
 					if err == nil {
-						err = s.stasher.Stash(m)
+						err = s.stash(m)
 						model.FullFree(m)
 						if err != nil {
 							s.logger.Error("Error stashing message", "error", err)
@@ -388,6 +675,7 @@ func (s *Controller) listen(secret *memguard.LockedBuffer) chan infosAndError {
 					err := json.Unmarshal([]byte(parts[1]), &inf)
 					if err == nil {
 						initialized = true
+						s.setInfos(inf)
 						startError(nil, inf)
 					} else {
 						err = eerrors.Wrap(err, "Plugin sent a badly encoded JSON listener info")
@@ -406,14 +694,10 @@ func (s *Controller) listen(secret *memguard.LockedBuffer) chan infosAndError {
 						s.logger.Warn(err.Error())
 					} else {
 						s.logger.Info("reported infos", "infos", newinfos, "type", s.name)
+						s.setInfos(newinfos)
 						if s.registry != nil {
 							// register the listeners in consul
-							for _, i := range infos {
-								s.registry.UnregisterTcpListener(i.BindAddr, i.Protocol, i.Port)
-							}
-							for _, i := range newinfos {
-								s.registry.RegisterTcpListener(i.BindAddr, i.Protocol, i.Port)
-							}
+							updateRegistrations(s.registry, infos, newinfos)
 							infos = newinfos
 						}
 					}
@@ -443,6 +727,53 @@ func (s *Controller) listen(secret *memguard.LockedBuffer) chan infosAndError {
 				}
 			case "nolistenererror":
 				startError(NOLISTENER, nil)
+			case "errors":
+				if len(parts) == 2 {
+					var snapshot recenterrors.Snapshot
+					err := json.Unmarshal(parts[1], &snapshot)
+					if err != nil {
+						s.logger.Warn("Plugin returned invalid recent errors", "error", err)
+						break
+					}
+					select {
+					case s.errorsChan <- snapshot:
+					default:
+						// nobody is waiting for the answer anymore
+					}
+				}
+			case "txns":
+				if len(parts) == 2 {
+					var txns []base.RelpTransactions
+					err := json.Unmarshal(parts[1], &txns)
+					if err != nil {
+						s.logger.Warn("Plugin returned invalid transactions", "error", err)
+						break
+					}
+					select {
+					case s.txnsChan <- txns:
+					default:
+						// nobody is waiting for the answer anymore
+					}
+				}
+			case "profile":
+				if len(parts) == 2 {
+					var resp base.ProfileResponse
+					err := json.Unmarshal(parts[1], &resp)
+					if err != nil {
+						s.logger.Warn("Plugin returned an invalid profile", "error", err)
+						break
+					}
+					select {
+					case s.profileChan <- resp:
+					default:
+						// nobody is waiting for the answer anymore
+					}
+				}
+			case "acks":
+				// the Store reports the outcome of the watched messages
+				if len(parts) == 2 && s.onAcks != nil {
+					s.onAcks(parts[1])
+				}
 			case "metrics":
 				if len(parts) == 2 {
 					families := make([]*dto.MetricFamily, 0)
@@ -531,19 +862,29 @@ func (s *Controller) Start() (infos []model.ListenerInfo, err error) {
 	// are transmitted to the provider
 	cb, _ := json.Marshal(Configure(s.typ, s.conf))
 
-	rerr := s.W(CONF, cb)
+	var rerr error
+	if s.stasher != nil && s.stasher.refusing() {
+		// the plugin was restarted while the Store is down
+		rerr = s.W(STOREDOWN, utils.NOW)
+	}
+	if rerr == nil {
+		rerr = s.W(CONF, cb)
+	}
 	if rerr == nil {
 		rerr = s.W(START, utils.NOW)
 	}
 	infos = []model.ListenerInfo{}
 	if rerr == nil {
+		start := time.Now()
 		select {
 		case infoserr := <-s.listen(secret):
 			rerr = infoserr.err
 			infos = infoserr.infos
-		case <-time.After(60 * time.Second):
+			pluginStartDuration.WithLabelValues(s.name).Observe(time.Since(start).Seconds())
+		case <-time.After(s.conf.Main.PluginStartTimeout):
 			close(s.StopChan)
-			rerr = eerrors.Errorf("plugin '%s' failed to start before timeout", s.name)
+			pluginStartTimeoutsCounter.WithLabelValues(s.name).Inc()
+			rerr = eerrors.Errorf("plugin '%s' failed to start before timeout (%s)", s.name, s.conf.Main.PluginStartTimeout)
 		}
 	}
 
@@ -565,6 +906,7 @@ func (s *Controller) Start() (infos []model.ListenerInfo, err error) {
 
 type PluginCreateOpts struct {
 	dumpable        bool
+	dumpablePlugins []string
 	profile         bool
 	storePath       string
 	confDir         string
@@ -573,6 +915,8 @@ type PluginCreateOpts struct {
 	certFiles       []string
 	certPaths       []string
 	polldirectories []string
+	statedirs       []string
+	journalSocket   string
 }
 
 func ProfileOpt(profile bool) func(*PluginCreateOpts) {
@@ -587,6 +931,15 @@ func DumpableOpt(dumpable bool) func(*PluginCreateOpts) {
 	}
 }
 
+// DumpablePluginsOpt lists the plugins whose process may write core dumps
+// (see conf.MainConfig.DumpablePlugins). DumpableOpt only concerns the
+// controlling process.
+func DumpablePluginsOpt(plugins []string) func(*PluginCreateOpts) {
+	return func(opts *PluginCreateOpts) {
+		opts.dumpablePlugins = plugins
+	}
+}
+
 func StorePathOpt(path string) func(*PluginCreateOpts) {
 	return func(opts *PluginCreateOpts) {
 		opts.storePath = path
@@ -611,6 +964,14 @@ func FileDestTmplOpt(path string) func(*PluginCreateOpts) {
 	}
 }
 
+// JournalSocketOpt is the journald socket of the journal destination. In
+// confined mode, it is bind mounted in the plugin filesystem.
+func JournalSocketOpt(path string) func(*PluginCreateOpts) {
+	return func(opts *PluginCreateOpts) {
+		opts.journalSocket = path
+	}
+}
+
 func CertFilesOpt(list []string) func(*PluginCreateOpts) {
 	return func(opts *PluginCreateOpts) {
 		opts.certFiles = list
@@ -629,6 +990,14 @@ func PollDirectories(dirs []string) func(*PluginCreateOpts) {
 	}
 }
 
+// StateDirectories lists the directories where the plugin may write its
+// state. In confined mode, they are bind mounted read-write.
+func StateDirectories(dirs []string) func(*PluginCreateOpts) {
+	return func(opts *PluginCreateOpts) {
+		opts.statedirs = dirs
+	}
+}
+
 func (s *Controller) Create(optsfuncs ...func(*PluginCreateOpts)) error {
 	// if the provider process already lives, Create() just returns
 	s.createdMu.Lock()
@@ -648,13 +1017,19 @@ func (s *Controller) Create(optsfuncs ...func(*PluginCreateOpts)) error {
 	s.ShutdownChan = make(chan struct{})
 	s.ExitCode = 0
 	var err error
+	mainConf := conf.MainConfig{DumpablePlugins: opts.dumpablePlugins}
+	dumpable := mainConf.PluginIsDumpable(s.name)
+	if dumpable {
+		s.logger.Warn("Plugin process is dumpable: its memory may be written to core dumps", "type", s.name)
+	}
 
 	switch s.typ {
 	case base.RELP, base.TCP, base.UDP,
 		base.DirectRELP,
 		base.Graylog, base.KafkaSource, base.HTTPServer,
 		base.Accounting, base.MacOS, base.Journal,
-		base.Filesystem:
+		base.Filesystem, base.Synthetic, base.FIFO,
+		base.Heartbeat, base.Ingest:
 
 		cname, _ := base.Name(s.typ, true)
 		// the plugin will use this pipe to report syslog messages
@@ -677,6 +1052,7 @@ func (s *Controller) Create(optsfuncs ...func(*PluginCreateOpts)) error {
 				namespaces.BinderHandle(base.BinderHdl(s.typ)),
 				namespaces.LoggerHandle(base.LoggerHdl(s.typ)),
 				namespaces.Pipe(pipew),
+				namespaces.Dumpable(dumpable),
 			)
 			if err != nil {
 				_ = piper.Close()
@@ -691,6 +1067,7 @@ func (s *Controller) Create(optsfuncs ...func(*PluginCreateOpts)) error {
 				CertFiles(opts.certFiles).
 				CertPaths(opts.certPaths).
 				PollDirectories(opts.polldirectories).
+				StateDirectories(opts.statedirs).
 				Start()
 		}
 
@@ -705,6 +1082,7 @@ func (s *Controller) Create(optsfuncs ...func(*PluginCreateOpts)) error {
 				namespaces.BinderHandle(base.BinderHdl(s.typ)),
 				namespaces.LoggerHandle(base.LoggerHdl(s.typ)),
 				namespaces.Pipe(pipew),
+				namespaces.Dumpable(dumpable),
 			)
 			if err != nil {
 				_ = piper.Close()
@@ -738,6 +1116,7 @@ func (s *Controller) Create(optsfuncs ...func(*PluginCreateOpts)) error {
 				namespaces.LoggerHandle(base.LoggerHdl(s.typ)),
 				namespaces.Pipe(piper),
 				namespaces.Profile(opts.profile),
+				namespaces.Dumpable(dumpable),
 			)
 			if err != nil {
 				_ = piper.Close()
@@ -750,6 +1129,7 @@ func (s *Controller) Create(optsfuncs ...func(*PluginCreateOpts)) error {
 				Dumpable(opts.dumpable).
 				StorePath(opts.storePath).
 				FileDestTemplate(opts.fileDestTmpl).
+				JournalSocket(opts.journalSocket).
 				CertFiles(opts.certFiles).
 				CertPaths(opts.certPaths).
 				Start()
@@ -767,6 +1147,7 @@ func (s *Controller) Create(optsfuncs ...func(*PluginCreateOpts)) error {
 				namespaces.LoggerHandle(base.LoggerHdl(s.typ)),
 				namespaces.Pipe(piper),
 				namespaces.Profile(opts.profile),
+				namespaces.Dumpable(dumpable),
 			)
 			if err != nil {
 				_ = piper.Close()
@@ -788,6 +1169,7 @@ func (s *Controller) Create(optsfuncs ...func(*PluginCreateOpts)) error {
 			s.ring,
 			namespaces.BinderHandle(base.BinderHdl(s.typ)),
 			namespaces.LoggerHandle(base.LoggerHdl(s.typ)),
+			namespaces.Dumpable(dumpable),
 		)
 		if err != nil {
 			close(s.ShutdownChan)
@@ -833,19 +1215,79 @@ func (s *Controller) Create(optsfuncs ...func(*PluginCreateOpts)) error {
 // StoreController is the specialized controller that takes care of the Store.
 type StoreController struct {
 	*Controller
-	reserv    *reservoir.Reservoir
-	msgsBatch []string
-	gen       *utils.Generator
-	pushwg    sync.WaitGroup
+	reserv     *reservoir.Reservoir
+	msgsBatch  []string
+	gen        *utils.Generator
+	pushwg     sync.WaitGroup
+	pushStop   chan struct{}
+	geoip      *GeoIPEnricher
+	gate       *storeGate
+	createOpts []func(*PluginCreateOpts)
+	// transforms is replaced when the configuration is reloaded
+	transformsMu sync.RWMutex
+	transforms   *transform.Pipeline
+	// replay holds the messages to send first to a restarted Store
+	replay []utils.UIDString
+	// acksTo is the controller of the plugin that waits for the outcome of
+	// its messages
+	acksMu sync.Mutex
+	acksTo *Controller
+	// plugins are the controllers of the plugins that stash messages. They
+	// are told when the Store process is down, if they should refuse the
+	// messages meanwhile.
+	pluginsMu sync.Mutex
+	plugins   []*Controller
 }
 
-func (s *StoreController) push(secret *memguard.LockedBuffer) {
+func (s *StoreController) addPlugin(c *Controller) {
+	s.pluginsMu.Lock()
+	s.plugins = append(s.plugins, c)
+	s.pluginsMu.Unlock()
+}
+
+func (s *StoreController) setAcksRecipient(c *Controller) {
+	s.acksMu.Lock()
+	s.acksTo = c
+	s.acksMu.Unlock()
+}
+
+// forwardAcks forwards the outcomes reported by the Store to the plugin that
+// stashed the messages. When the plugin is gone, they are dropped: the
+// plugin fails its transactions when it does not get them in time.
+func (s *StoreController) forwardAcks(payload []byte) {
+	s.acksMu.Lock()
+	c := s.acksTo
+	s.acksMu.Unlock()
+	if c == nil {
+		return
+	}
+	err := c.W(ACKS, payload)
+	if err != nil {
+		s.logger.Debug("Can't forward the acknowledgments", "type", c.name, "error", err)
+	}
+}
+
+func (s *StoreController) push(secret *memguard.LockedBuffer, stop chan struct{}) {
 	bufpipe := bufio.NewWriter(s.pipe)
-	writeToStore := utils.NewEncryptWriter(bufpipe, secret)
+	writeToStore := utils.NewFrameWriter(bufpipe, secret)
 	m := make(map[utils.MyULID]string, 5000)
 	w := waiter.Default()
+	restart := s.conf.Store.OnChildExit != conf.StoreExitShutdown
+	var sent replayWindow
+
+	for _, msg := range s.replay {
+		m[msg.UID] = msg.S
+	}
+	s.replay = nil
 
 	for {
+		select {
+		case <-stop:
+			s.replay = sent.with(m)
+			return
+		default:
+		}
+
 		err := s.reserv.DeliverTo(m)
 		if err == eerrors.ErrQDisposed {
 			return
@@ -861,10 +1303,23 @@ func (s *StoreController) push(secret *memguard.LockedBuffer) {
 			_, err := io.WriteString(writeToStore, v)
 			if err != nil {
 				s.logger.Error("Unexpected error when writing messages to the Store pipe", "error", err)
+				if restart {
+					// the messages will be sent to the restarted Store
+					s.replay = sent.with(m)
+					return
+				}
 				return
 			}
 		}
-		bufpipe.Flush()
+		err = bufpipe.Flush()
+		if err != nil && restart {
+			s.logger.Error("Unexpected error when flushing the Store pipe", "error", err)
+			s.replay = sent.with(m)
+			return
+		}
+		if restart {
+			sent.add(m)
+		}
 
 		for k := range m {
 			delete(m, k)
@@ -872,12 +1327,37 @@ func (s *StoreController) push(secret *memguard.LockedBuffer) {
 	}
 }
 
+// startPush starts push(), unless it is already running: the Store is also
+// started again when the configuration is reloaded.
+func (s *StoreController) startPush(secret *memguard.LockedBuffer) {
+	if s.pushStop != nil {
+		return
+	}
+	s.pushStop = make(chan struct{})
+	s.pushwg.Add(1)
+	go func(stop chan struct{}) {
+		defer s.pushwg.Done()
+		s.push(secret, stop)
+	}(s.pushStop)
+}
+
+// stopPush makes push() return, and waits that it has returned.
+func (s *StoreController) stopPush() {
+	if s.pushStop != nil {
+		close(s.pushStop)
+		s.pushStop = nil
+	}
+	s.pushwg.Wait()
+}
+
 // Shutdown stops definetely the Store.
 func (s *StoreController) Shutdown(killTimeOut time.Duration) {
+	s.gate.close()                     // release the stashes that wait for a restart
 	s.reserv.Dispose()                 // will make push() return
 	s.pushwg.Wait()                    // wait that push() returns
 	_ = s.pipe.Close()                 // signal the store that we are done sending messages
 	s.Controller.Shutdown(killTimeOut) // shutdown the child
+	s.geoip.Close()
 }
 
 // Stash sends the given message to the Store
@@ -885,6 +1365,11 @@ func (s *StoreController) Stash(m *model.FullMessage) error {
 	if s.conf.Store.AddMissingMsgID && len(m.Fields.MsgId) == 0 {
 		m.Fields.MsgId = m.Uid.String()
 	}
+	s.gate.enter()
+	s.geoip.Enrich(m)
+	s.transformsMu.RLock()
+	s.transforms.Apply(m.Fields)
+	s.transformsMu.RUnlock()
 	err := s.reserv.AddMessage(m)
 	if err != nil {
 		return eerrors.Wrap(err, "Failed to protobuf-marshal message to be sent to the Store")
@@ -901,14 +1386,38 @@ func (s *StoreController) Start() (infos []model.ListenerInfo, err error) {
 		}
 	}
 
+	// the GeoIP databases are reloaded when the configuration is reloaded
+	s.geoip.SetConf(s.conf.GeoIP)
+	transforms, err := transform.New(s.conf.Transforms)
+	if err != nil {
+		return nil, err
+	}
+	s.transformsMu.Lock()
+	s.transforms = transforms
+	s.transformsMu.Unlock()
+
 	infos, err = s.Controller.Start()
 	if err != nil {
 		return nil, err
 	}
-	s.pushwg.Add(1)
-	go func() {
-		defer s.pushwg.Done()
-		s.push(secret)
-	}()
+	s.startPush(secret)
 	return infos, nil
 }
+
+// ReloadGeoIP reopens the GeoIP databases files.
+func (s *StoreController) ReloadGeoIP() {
+	s.geoip.Reload()
+}
+
+// Gather returns the metrics of the Store and of the GeoIP enrichment.
+func (s *StoreController) Gather() ([]*dto.MetricFamily, error) {
+	m, err := s.Controller.Gather()
+	if err != nil {
+		return m, err
+	}
+	geo, err := s.geoip.Gather()
+	if err != nil {
+		return m, nil
+	}
+	return append(m, geo...), nil
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stephane-martin/skewer/consul"
+	"github.com/stephane-martin/skewer/model"
+)
+
+func TestUpdateRegistrations(t *testing.T) {
+	registry := &consul.Registry{RegisterChan: make(chan consul.ServiceAction, 16)}
+	actions := func() (registered, unregistered []string) {
+		for {
+			select {
+			case a := <-registry.RegisterChan:
+				name := a.Service.Tags[0] + "/" + a.Service.Check
+				if a.Action == consul.REGISTER {
+					registered = append(registered, name)
+				} else {
+					unregistered = append(unregistered, name)
+				}
+			default:
+				return registered, unregistered
+			}
+		}
+	}
+
+	infos := []model.ListenerInfo{
+		{BindAddr: "127.0.0.1", Port: 2514, Protocol: "relp"},
+		{BindAddr: "127.0.0.1", Port: 1514, Protocol: "tcp", TLS: true},
+	}
+	// the same listeners, in another order
+	same := []model.ListenerInfo{infos[1], infos[0]}
+	updateRegistrations(registry, infos, same)
+	if registered, unregistered := actions(); len(registered) != 0 || len(unregistered) != 0 {
+		t.Fatalf("unexpected Consul calls: registered %v, unregistered %v", registered, unregistered)
+	}
+
+	changed := []model.ListenerInfo{
+		{BindAddr: "127.0.0.1", Port: 2514, Protocol: "relp"},
+		{BindAddr: "127.0.0.1", Port: 1514, Protocol: "relp"},
+		{BindAddr: "127.0.0.1", Port: 3514, Protocol: "tcp"},
+	}
+	updateRegistrations(registry, infos, changed)
+	registered, unregistered := actions()
+	if len(unregistered) != 1 || unregistered[0] != "tcp/127.0.0.1:1514" {
+		t.Errorf("unexpected unregistrations: %v", unregistered)
+	}
+	if len(registered) != 2 || registered[0] != "relp/127.0.0.1:1514" || registered[1] != "tcp/127.0.0.1:3514" {
+		t.Errorf("unexpected registrations: %v", registered)
+	}
+}
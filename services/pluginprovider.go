@@ -11,9 +11,11 @@ import (
 
 	dto "github.com/prometheus/client_model/go"
 	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
 	"github.com/stephane-martin/skewer/services/base"
 	"github.com/stephane-martin/skewer/utils"
 	"github.com/stephane-martin/skewer/utils/eerrors"
+	"github.com/stephane-martin/skewer/utils/recenterrors"
 )
 
 var stdoutMu sync.Mutex
@@ -153,6 +155,9 @@ func Launch(ctx context.Context, typ base.Types, opts ...ProviderOpt) (err error
 			if err == nil {
 				globalConf = c
 				hasConf = true
+				if c.Metrics.Pprof {
+					startPprof(env.Logger, name)
+				}
 			} else {
 				_ = Wout(CONFERROR, []byte(err.Error()))
 				return err
@@ -174,6 +179,132 @@ func Launch(ctx context.Context, typ base.Types, opts ...ProviderOpt) (err error
 			if err != nil {
 				return eerrors.Wrapf(err, "Provider '%s' can not write metrics to the controller", name)
 			}
+		case "geterrors":
+			b, err := json.Marshal(recenterrors.Default.Snapshot())
+			if err != nil {
+				env.Logger.Warn("Error marshaling recent errors", "type", name, "error", err)
+				break
+			}
+			err = Wout(ERRORS, b)
+			if err != nil {
+				return eerrors.Wrapf(err, "Provider '%s' can not write recent errors to the controller", name)
+			}
+		case "gettxns":
+			var txns []base.RelpTransactions
+			if t, ok := svc.(base.TxnInspectable); ok {
+				txns = t.Transactions()
+			} else {
+				env.Logger.Warn("Provider can not report its transactions", "type", name)
+			}
+			b, err := json.Marshal(txns)
+			if err != nil {
+				env.Logger.Warn("Error marshaling transactions", "type", name, "error", err)
+				break
+			}
+			err = Wout(TXNS, b)
+			if err != nil {
+				return eerrors.Wrapf(err, "Provider '%s' can not write transactions to the controller", name)
+			}
+		case "pause", "resume":
+			p, ok := svc.(base.Pausable)
+			if !ok {
+				env.Logger.Warn("Provider can not pause its listeners", "type", name)
+				break
+			}
+			listener := ""
+			if len(parts) == 2 {
+				listener = string(parts[1])
+			}
+			if command == "pause" {
+				err = p.Pause(listener)
+			} else {
+				err = p.Resume(listener)
+			}
+			if err != nil {
+				// not fatal: the provider keeps running
+				env.Logger.Warn("Error pausing or resuming listener", "type", name, "command", command, "error", err)
+			}
+		case "drain":
+			d, ok := svc.(base.Drainable)
+			if !ok {
+				env.Logger.Warn("Provider can not drain its listeners", "type", name)
+				break
+			}
+			listener := ""
+			if len(parts) == 2 {
+				listener = string(parts[1])
+			}
+			err = d.Drain(listener)
+			if err != nil {
+				// not fatal: the provider keeps running
+				env.Logger.Warn("Error draining listener", "type", name, "error", err)
+			}
+		case "seek":
+			sk, ok := svc.(base.Seekable)
+			if !ok {
+				env.Logger.Warn("Provider can not seek", "type", name)
+				break
+			}
+			var req base.SeekRequest
+			if len(parts) == 2 {
+				err = json.Unmarshal(parts[1], &req)
+			} else {
+				err = eerrors.New("Seek command without a request")
+			}
+			if err == nil {
+				err = sk.Seek(req)
+			}
+			if err != nil {
+				// not fatal: the provider keeps running
+				env.Logger.Warn("Error seeking", "type", name, "error", err)
+			}
+		case "acks":
+			// the outcome of the messages that wait for the end to end acknowledgment
+			if env.Reporter == nil || len(parts) != 2 {
+				break
+			}
+			var acks []model.Ack
+			err = json.Unmarshal(parts[1], &acks)
+			if err != nil {
+				env.Logger.Warn("Invalid acknowledgments", "type", name, "error", err)
+				break
+			}
+			env.Reporter.Ack(acks)
+		case "storedown", "storeup":
+			// the Store process is down, and the messages should be refused
+			// until it is restarted
+			if env.Reporter != nil {
+				env.Reporter.SetStoreDown(command == "storedown")
+			}
+		case "profile":
+			var req base.ProfileRequest
+			if len(parts) == 2 {
+				err = json.Unmarshal(parts[1], &req)
+			} else {
+				err = eerrors.New("Profile command without a request")
+			}
+			if err == nil && !globalConf.Metrics.Pprof {
+				err = eerrors.New("Profiling is disabled")
+			}
+			// a CPU profile takes a while: the other commands are not delayed
+			go func(err error) {
+				var resp base.ProfileResponse
+				if err == nil {
+					resp.Profile, err = collectProfile(req)
+				}
+				if err != nil {
+					env.Logger.Warn("Error collecting a profile", "type", name, "error", err)
+					resp.Error = err.Error()
+				}
+				b, _ := json.Marshal(resp)
+				if len(b) > maxProfileMessageSize {
+					// the controller would not read a larger message
+					err = eerrors.Errorf("The profile of %d bytes is too large to be sent to the controller", len(resp.Profile))
+					env.Logger.Warn("Error collecting a profile", "type", name, "error", err)
+					b, _ = json.Marshal(base.ProfileResponse{Error: err.Error()})
+				}
+				_ = Wout(PROFILE, b)
+			}(err)
 		default:
 			env.Logger.Crit("Unknown command", "type", name, "command", command)
 			return eerrors.Errorf("Unknown command '%s' received by plugin '%s'", command, name)
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	rpprof "runtime/pprof"
+	"sync"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/services/base"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+var pprofOnce sync.Once
+
+// maxProfileMessageSize bounds the size of the JSON encoded profile
+// responses, so that the message fits in maxPluginMessageSize with its
+// length prefix and its header.
+const maxProfileMessageSize = maxPluginMessageSize - 12 - len("profile")
+
+// startPprof serves the net/http/pprof endpoints of the plugin process on an
+// ephemeral localhost port. The server runs for the process lifetime.
+func startPprof(logger log15.Logger, name string) {
+	pprofOnce.Do(func() {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			logger.Warn("Can't listen for the pprof endpoints", "type", name, "error", err)
+			return
+		}
+		logger.Info("Serving the pprof endpoints", "type", name, "addr", l.Addr().String())
+		go func() {
+			_ = http.Serve(l, mux)
+		}()
+	})
+}
+
+// collectProfile returns a profile of the plugin process, in the format of
+// runtime/pprof.
+func collectProfile(req base.ProfileRequest) ([]byte, error) {
+	err := req.Validate()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if req.Kind == base.ProfileCPU {
+		err = rpprof.StartCPUProfile(&buf)
+		if err != nil {
+			return nil, eerrors.Wrap(err, "Can't start the CPU profile")
+		}
+		time.Sleep(time.Duration(req.Seconds) * time.Second)
+		rpprof.StopCPUProfile()
+		return buf.Bytes(), nil
+	}
+	p := rpprof.Lookup(req.Kind)
+	if p == nil {
+		return nil, eerrors.Errorf("Unknown profile: '%s'", req.Kind)
+	}
+	err = p.WriteTo(&buf, 0)
+	if err != nil {
+		return nil, eerrors.Wrapf(err, "Can't write the '%s' profile", req.Kind)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stephane-martin/skewer/services/base"
+)
+
+func TestCollectProfile(t *testing.T) {
+	for _, kind := range []string{"heap", "goroutine"} {
+		b, err := collectProfile(base.ProfileRequest{Kind: kind})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(b) == 0 {
+			t.Errorf("empty '%s' profile", kind)
+		}
+	}
+	b, err := collectProfile(base.ProfileRequest{Kind: base.ProfileCPU, Seconds: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) == 0 {
+		t.Error("empty CPU profile")
+	}
+
+	for _, req := range []base.ProfileRequest{
+		{},
+		{Kind: "nosuchprofile"},
+		{Kind: base.ProfileCPU},
+		{Kind: base.ProfileCPU, Seconds: base.MaxProfileSeconds + 1},
+	} {
+		if _, err := collectProfile(req); err == nil {
+			t.Errorf("the request %+v should fail", req)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"sync"
@@ -125,6 +126,23 @@ func (s *storeServiceImpl) create() error {
 	if err != nil {
 		return eerrors.Wrap(err, "Error storing configurations in store")
 	}
+	// the outcome of the messages of the sources with end to end
+	// acknowledgment is reported to the controller
+	watchedConfs := make(map[utils.MyULID]bool)
+	for _, c := range s.config.RELPSource {
+		if c.EndToEndAck {
+			watchedConfs[c.ConfID] = true
+		}
+	}
+	s.store.OnAcks(func(acks []model.Ack) {
+		b, err := json.Marshal(acks)
+		if err == nil {
+			err = Wout(ACKS, b)
+		}
+		if err != nil {
+			s.logger.Warn("Error reporting the acknowledgments", "error", err)
+		}
+	})
 
 	reserv := reservoir.NewReservoir(uint64(s.store.BatchSize))
 
@@ -165,9 +183,10 @@ func (s *storeServiceImpl) create() error {
 			s.ingestwg.Done()
 		}()
 
+		maxSize := s.config.Main.MaxPipeMessageSize
 		scanner := utils.WithRecover(utils.WithContext(s.pipeCtx, bufio.NewScanner(s.pipe)))
-		scanner.Split(utils.MakeDecryptSplit(s.secret))
-		scanner.Buffer(make([]byte, 0, 65536), 65536)
+		scanner.Split(utils.MakeFrameSplit(s.secret, maxSize))
+		scanner.Buffer(make([]byte, 0, 65536), maxSize+utils.FrameOverhead)
 
 		protobuff := proto.NewBuffer(make([]byte, 0, 4096))
 
@@ -182,6 +201,9 @@ func (s *storeServiceImpl) create() error {
 				return
 			}
 			uid := message.Uid
+			if watchedConfs[message.ConfId] {
+				s.store.Watch(uid)
+			}
 			model.FullFree(message)
 			reserv.Add(uid, string(msgBytes))
 		}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils"
+)
+
+// storeReplayWindow is the size of the last messages written to the Store
+// pipe that are sent again to a restarted Store. The Store process may have
+// died before it could read them from the pipe, or before it could persist
+// them. The Store indexes the messages by their UID, so that the messages it
+// already had are not duplicated.
+const storeReplayWindow = 4 << 20
+
+var storeRestartsCounter = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "skw_store_restarts_total",
+		Help: "number of times the Store process was restarted after it exited unexpectedly",
+	},
+)
+
+// storeGate holds the stashed messages while the Store process is down.
+type storeGate struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	down   bool
+	closed bool
+}
+
+func newStoreGate() *storeGate {
+	g := &storeGate{}
+	g.cond = sync.NewCond(&g.mu)
+	return g
+}
+
+func (g *storeGate) setDown(down bool) {
+	g.mu.Lock()
+	g.down = down
+	g.mu.Unlock()
+	g.cond.Broadcast()
+}
+
+// close releases the waiting messages for good.
+func (g *storeGate) close() {
+	g.mu.Lock()
+	g.closed = true
+	g.mu.Unlock()
+	g.cond.Broadcast()
+}
+
+// enter waits for the Store to be up again. The messages that reach the
+// controller have been acknowledged by the plugins already: they are never
+// refused here.
+func (g *storeGate) enter() {
+	g.mu.Lock()
+	for g.down && !g.closed {
+		g.cond.Wait()
+	}
+	g.mu.Unlock()
+}
+
+func (g *storeGate) isDown() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.down && !g.closed
+}
+
+// replayWindow keeps the last messages written to the Store pipe, up to
+// storeReplayWindow bytes.
+type replayWindow struct {
+	msgs []utils.UIDString
+	size int
+}
+
+func (w *replayWindow) add(m map[utils.MyULID]string) {
+	for uid, msg := range m {
+		w.msgs = append(w.msgs, utils.UIDString{UID: uid, S: msg})
+		w.size += len(msg)
+	}
+	for w.size > storeReplayWindow && len(w.msgs) > 0 {
+		w.size -= len(w.msgs[0].S)
+		w.msgs = w.msgs[1:]
+	}
+}
+
+// with returns the window followed by the messages of m.
+func (w *replayWindow) with(m map[utils.MyULID]string) []utils.UIDString {
+	msgs := make([]utils.UIDString, 0, len(w.msgs)+len(m))
+	msgs = append(msgs, w.msgs...)
+	for uid, msg := range m {
+		msgs = append(msgs, utils.UIDString{UID: uid, S: msg})
+	}
+	return msgs
+}
+
+// Create creates the Store process. The options are kept to create the
+// process again when it is restarted.
+func (s *StoreController) Create(optsfuncs ...func(*PluginCreateOpts)) error {
+	s.createOpts = optsfuncs
+	return s.Controller.Create(optsfuncs...)
+}
+
+// refusing tells if the plugins should refuse the messages, as the Store
+// process is down and the Store is configured to fail the messages
+// meanwhile.
+func (s *StoreController) refusing() bool {
+	return s.conf.Store.OnChildExit == conf.StoreExitFail && s.gate.isDown()
+}
+
+// setStoreDown records whether the Store process is down. With
+// conf.StoreExitFail, the plugins are told to refuse the messages while the
+// Store is down, so that the RELP sources NACK them instead of acknowledging
+// messages that could be lost.
+func (s *StoreController) setStoreDown(down bool) {
+	// the gate changes first, so that a plugin that starts meanwhile learns
+	// the new state in Start
+	s.gate.setDown(down)
+	if s.conf.Store.OnChildExit == conf.StoreExitFail {
+		header := STOREUP
+		if down {
+			header = STOREDOWN
+		}
+		s.pluginsMu.Lock()
+		plugins := s.plugins
+		s.pluginsMu.Unlock()
+		for _, c := range plugins {
+			err := c.W(header, utils.NOW)
+			if err != nil {
+				s.logger.Debug("Can't tell the plugin about the Store", "type", c.name, "error", err)
+			}
+		}
+	}
+}
+
+// childExited stops sending messages to the Store process, after it has
+// exited unexpectedly.
+func (s *StoreController) childExited() {
+	s.setStoreDown(true)
+	s.stopPush()
+	_ = s.pipe.Close()
+}
+
+// Restart starts a new Store process after the previous one has exited
+// unexpectedly. The messages that were not written to the previous process,
+// and the last ones that were, are sent to the new process. Restart retries
+// until it succeeds or ctx is canceled.
+func (s *StoreController) Restart(ctx context.Context) error {
+	s.childExited()
+	// wait for the controller to notice that the process is gone
+	<-s.StopChan
+	delay := time.Second
+	for {
+		storeRestartsCounter.Inc()
+		_, err := s.createAndStart()
+		if err == nil {
+			s.setStoreDown(false)
+			return nil
+		}
+		s.logger.Error("Failed to restart the Store", "error", err, "retry", delay)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		if delay < 30*time.Second {
+			delay *= 2
+		}
+	}
+}
+
+func (s *StoreController) createAndStart() ([]model.ListenerInfo, error) {
+	err := s.Controller.Create(s.createOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return s.Start()
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"bufio"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils"
+	"github.com/stephane-martin/skewer/utils/reservoir"
+)
+
+// fakeStore reads the messages from the Store pipe. After persist messages,
+// it keeps reading the messages but loses them, as a Store that dies before
+// it could persist them.
+func fakeStore(r *os.File, received *sync.Map, persist int) chan struct{} {
+	persisted := make(chan struct{})
+	go func() {
+		scanner := bufio.NewScanner(r)
+		scanner.Split(utils.MakeFrameSplit(nil, 1<<20))
+		scanner.Buffer(make([]byte, 0, 132000), 1<<20+4)
+		n := 0
+		for scanner.Scan() {
+			msg, err := model.FromBuf(proto.NewBuffer(scanner.Bytes()))
+			if err != nil {
+				return
+			}
+			if persist > 0 && n >= persist {
+				continue
+			}
+			received.Store(msg.Uid, true)
+			n++
+			if n == persist {
+				close(persisted)
+			}
+		}
+	}()
+	return persisted
+}
+
+func testStoreChildExit(t *testing.T, onExit string) {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	s := &StoreController{
+		Controller: &Controller{name: "skewer-store", logger: logger},
+		reserv:     reservoir.NewReservoir(5000),
+		geoip:      NewGeoIPEnricher(logger),
+		gate:       newStoreGate(),
+	}
+	s.conf.Store.OnChildExit = onExit
+
+	var received sync.Map
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.pipe = w
+	persisted := fakeStore(r, &received, 1000)
+	s.startPush(nil)
+
+	// stash messages under load, while the Store dies and restarts
+	var mu sync.Mutex
+	stashed := map[utils.MyULID]bool{}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gen := utils.NewGenerator()
+			for j := 0; j < 5000; j++ {
+				m := model.FullFactory()
+				m.Uid = gen.Uid()
+				m.Fields.Message = "message under load"
+				err := s.Stash(m)
+				mu.Lock()
+				if err == nil {
+					stashed[m.Uid] = true
+				} else {
+					t.Errorf("unexpected stash error: %v", err)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	// the Store dies while it is receiving messages
+	<-persisted
+	time.Sleep(50 * time.Millisecond)
+	_ = r.Close()
+	s.childExited()
+
+	// only the plugins refuse the messages while the Store is down
+	if s.refusing() != (onExit == conf.StoreExitFail) {
+		t.Fatalf("the plugins should refuse the messages: %t", onExit == conf.StoreExitFail)
+	}
+
+	// the messages that reach the controller were acknowledged by the
+	// plugins: they wait for the Store
+	m := model.FullFactory()
+	m.Uid = utils.NewGenerator().Uid()
+	errChan := make(chan error, 1)
+	go func() { errChan <- s.Stash(m) }()
+	select {
+	case err := <-errChan:
+		t.Fatalf("the stash should wait for the Store: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	r, w, err = os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.pipe = w
+	fakeStore(r, &received, 0)
+	s.startPush(nil)
+	s.setStoreDown(false)
+	wg.Wait()
+
+	if err := <-errChan; err != nil {
+		t.Fatalf("the waiting stash failed: %v", err)
+	}
+	stashed[m.Uid] = true
+	if s.refusing() {
+		t.Fatal("the plugins should accept the messages after the restart")
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		missing := 0
+		for uid := range stashed {
+			if _, ok := received.Load(uid); !ok {
+				missing++
+			}
+		}
+		if missing == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d stashed messages were lost", missing)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	s.gate.close()
+	s.reserv.Dispose()
+	s.pushwg.Wait()
+	_ = s.pipe.Close()
+}
+
+func TestStoreChildExitBlock(t *testing.T) {
+	testStoreChildExit(t, conf.StoreExitBlock)
+}
+
+func TestStoreChildExitFail(t *testing.T) {
+	testStoreChildExit(t, conf.StoreExitFail)
+}
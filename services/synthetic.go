@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/decoders"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/services/base"
+	"github.com/stephane-martin/skewer/utils"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// syntheticTick is the period at which the synthetic source emits batches
+// of messages.
+const syntheticTick = 10 * time.Millisecond
+
+const syntheticAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 "
+
+var syntheticGeneratedCounter prometheus.Counter
+
+func initSyntheticRegistry() {
+	base.Once.Do(func() {
+		base.InitRegistry()
+		syntheticGeneratedCounter = prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "skw_synthetic_generated_total",
+				Help: "total number of messages generated by the synthetic source",
+			},
+		)
+		base.Registry.MustRegister(syntheticGeneratedCounter)
+	})
+}
+
+// SyntheticService generates syslog messages at a configurable rate. It is
+// only meant for load testing.
+type SyntheticService struct {
+	stasher        *base.Reporter
+	logger         log15.Logger
+	wgroup         sync.WaitGroup
+	Conf           conf.SyntheticSourceConfig
+	parserEnv      *decoders.ParsersEnv
+	stop           context.CancelFunc
+	fatalErrorChan chan struct{}
+	fatalOnce      *sync.Once
+}
+
+func NewSyntheticService(env *base.ProviderEnv) (base.Provider, error) {
+	initSyntheticRegistry()
+	s := SyntheticService{
+		stasher: env.Reporter,
+		logger:  env.Logger.New("class", "synthetic"),
+	}
+	return &s, nil
+}
+
+func (s *SyntheticService) Type() base.Types {
+	return base.Synthetic
+}
+
+func (s *SyntheticService) Gather() ([]*dto.MetricFamily, error) {
+	return base.Registry.Gather()
+}
+
+func (s *SyntheticService) FatalError() chan struct{} {
+	return s.fatalErrorChan
+}
+
+func (s *SyntheticService) dofatal() {
+	s.fatalOnce.Do(func() { close(s.fatalErrorChan) })
+}
+
+func (s *SyntheticService) SetConf(c conf.BaseConfig) {
+	s.Conf = c.Synthetic
+	s.parserEnv = decoders.NewParsersEnv(c.Parsers, s.logger)
+}
+
+func (s *SyntheticService) Start() (infos []model.ListenerInfo, err error) {
+	var ctx context.Context
+	infos = []model.ListenerInfo{}
+	ctx, s.stop = context.WithCancel(context.Background())
+	s.fatalErrorChan = make(chan struct{})
+	s.fatalOnce = &sync.Once{}
+
+	s.logger.Warn(
+		"Starting the synthetic source",
+		"rate", s.Conf.Rate,
+		"format", s.Conf.Format,
+		"clients", s.Conf.Clients,
+	)
+
+	s.wgroup.Add(1)
+	go func() {
+		defer s.wgroup.Done()
+		err := s.generate(ctx)
+		if err != nil {
+			s.logger.Error("Synthetic source has stopped", "error", err)
+			s.dofatal()
+		}
+	}()
+	return infos, nil
+}
+
+func (s *SyntheticService) Stop() {
+	if s.stop != nil {
+		s.stop()
+	}
+	s.wgroup.Wait()
+}
+
+func (s *SyntheticService) Shutdown() {
+	s.Stop()
+}
+
+func (s *SyntheticService) generate(ctx context.Context) error {
+	gen := utils.NewGenerator()
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	clients := make([]string, 0, s.Conf.Clients)
+	for i := 0; i < s.Conf.Clients; i++ {
+		clients = append(clients, fmt.Sprintf("10.%d.%d.%d", (i>>16)&255, (i>>8)&255, i&255))
+	}
+	payload := make([]byte, s.Conf.MaxSize)
+	for i := range payload {
+		payload[i] = syntheticAlphabet[rnd.Intn(len(syntheticAlphabet))]
+	}
+
+	ticker := time.NewTicker(syntheticTick)
+	defer ticker.Stop()
+	perTick := float64(s.Conf.Rate) * syntheticTick.Seconds()
+	var budget float64
+	var seq int
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		for budget += perTick; budget >= 1; budget-- {
+			seq++
+			client := clients[rnd.Intn(len(clients))]
+			size := s.Conf.MinSize + rnd.Intn(s.Conf.MaxSize-s.Conf.MinSize+1)
+			raw := s.makeRaw(client, seq, payload[:size])
+			err := s.parseAndStash(raw, client, gen)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *SyntheticService) makeRaw(client string, seq int, payload []byte) []byte {
+	now := time.Now()
+	switch s.Conf.Format {
+	case "rfc3164":
+		return []byte(fmt.Sprintf("<%d>%s %s synthetic[%d]: %s", 14, now.Format(time.Stamp), client, seq, payload))
+	default:
+		return []byte(fmt.Sprintf("<%d>1 %s %s synthetic %d - - %s", 14, now.Format(time.RFC3339Nano), client, seq, payload))
+	}
+}
+
+func (s *SyntheticService) parseAndStash(raw []byte, client string, gen *utils.Generator) error {
+	syslogMsgs, err := s.parserEnv.Parse(&s.Conf.DecoderBaseConfig, raw)
+	if err != nil {
+		base.CountParsingError(base.Synthetic, client, s.Conf.Format, err)
+		s.logger.Debug("Error parsing synthetic message", "error", err)
+		return nil
+	}
+	for _, syslogMsg := range syslogMsgs {
+		if syslogMsg == nil {
+			continue
+		}
+		if !base.NormalizeTime(base.Synthetic, syslogMsg, &s.Conf.DecoderBaseConfig) {
+			model.Free(syslogMsg)
+			continue
+		}
+		base.NormalizeHostname(syslogMsg, &s.Conf.DecoderBaseConfig)
+		full := model.FullFactoryFrom(syslogMsg)
+		full.Uid = gen.Uid()
+		full.ConfId = s.Conf.ConfID
+		full.SourceType = "synthetic"
+		full.ClientAddr = client
+		err = s.stasher.Stash(full)
+		model.FullFree(full)
+		if err != nil {
+			if eerrors.IsFatal(err) {
+				return eerrors.Wrap(err, "Fatal error stashing synthetic message")
+			}
+			s.logger.Warn("Error stashing synthetic message", "error", err)
+			continue
+		}
+		syntheticGeneratedCounter.Inc()
+		base.CountIncomingMessage(base.Synthetic, client, 0, "")
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/dgraph-io/badger"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils"
+	"github.com/stephane-martin/skewer/utils/queue"
+)
+
+func TestWatchedAcks(t *testing.T) {
+	InitRegistry()
+	dir, err := ioutil.TempDir("", "skewer-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	opts := badger.DefaultOptions
+	opts.Dir = dir
+	opts.ValueDir = dir
+	badg, err := badger.Open(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = badg.Close() }()
+	bend, err := NewBackend(badg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &MessageStore{badger: badg, backend: bend, count: utils.NewRefCount()}
+	var reported []model.Ack
+	s.OnAcks(func(acks []model.Ack) { reported = append(reported, acks...) })
+
+	delivered, rejected, unwatched := utils.NewUid(), utils.NewUid(), utils.NewUid()
+	for _, uid := range []utils.MyULID{delivered, rejected, unwatched} {
+		// two destinations
+		s.count.New(uid, 2)
+	}
+	s.Watch(delivered)
+	s.Watch(rejected)
+
+	ack := func(uid utils.MyULID, dest conf.DestinationType) {
+		if err := s.doACK([]queue.UidDest{{Uid: uid, Dest: dest}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ack(delivered, conf.Kafka)
+	ack(unwatched, conf.Kafka)
+	if len(reported) != 0 {
+		t.Fatalf("a message was reported before all the destinations acknowledged it: %v", reported)
+	}
+	ack(delivered, conf.File)
+	ack(unwatched, conf.File)
+	if len(reported) != 1 || reported[0] != (model.Ack{Uid: delivered, OK: true}) {
+		t.Fatalf("the delivered message was not reported: %v", reported)
+	}
+
+	err = s.doPermanentError([]queue.UidDest{{Uid: rejected, Dest: conf.Kafka}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reported) != 2 || reported[1] != (model.Ack{Uid: rejected, OK: false}) {
+		t.Fatalf("the rejected message was not reported: %v", reported)
+	}
+	// the outcome of a message is reported once
+	ack(rejected, conf.File)
+	if len(reported) != 2 {
+		t.Fatalf("the rejected message was reported twice: %v", reported)
+	}
+}
@@ -3,6 +3,7 @@ package dests
 import (
 	"context"
 	"fmt"
+	"io"
 	"sync"
 
 	"github.com/inconshreveable/log15"
@@ -14,6 +15,8 @@ import (
 	"github.com/stephane-martin/skewer/sys/binder"
 	"github.com/stephane-martin/skewer/utils"
 	"github.com/stephane-martin/skewer/utils/eerrors"
+	"github.com/stephane-martin/skewer/utils/logging"
+	"github.com/stephane-martin/skewer/utils/ordering"
 	"github.com/stephane-martin/skewer/utils/queue/message"
 )
 
@@ -25,6 +28,19 @@ var fatalCounter *prometheus.CounterVec
 var httpStatusCounter *prometheus.CounterVec
 var kafkaInputsCounter prometheus.Counter
 var openedFilesGauge prometheus.Gauge
+var workerQueueGauge *prometheus.GaugeVec
+var bytesSentCounter *prometheus.CounterVec
+var messageSizeHistogram *prometheus.HistogramVec
+var discardedCounter *prometheus.CounterVec
+
+// defaultMaxTopics is the default number of distinct topics of
+// bytesSentCounter.
+const defaultMaxTopics = 1000
+
+// sentTopics are the topics of bytesSentCounter: the topics beyond the
+// limit of topicLimiter are counted as utils.OtherLabel
+var sentTopics sync.Map
+var topicLimiter = utils.NewLabelLimiter(defaultMaxTopics)
 
 var once sync.Once
 
@@ -76,14 +92,55 @@ func InitRegistry() {
 			},
 		)
 
+		workerQueueGauge = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "skw_dest_worker_queue_depth",
+				Help: "number of messages waiting in a destination worker queue",
+			},
+			[]string{"dest", "worker"},
+		)
+
+		bytesSentCounter = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "skw_dest_bytes_sent_total",
+				Help: "size of the encoded messages sent by the destinations",
+			},
+			[]string{"dest", "topic"},
+		)
+
+		messageSizeHistogram = prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "skw_dest_message_size_bytes",
+				Help:    "size of the encoded messages sent by the destinations",
+				Buckets: prometheus.ExponentialBuckets(64, 4, 8),
+			},
+			[]string{"dest"},
+		)
+
+		discardedCounter = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "skw_dest_discarded_total",
+				Help: "number of messages that were ACKed but deliberately not sent",
+			},
+			[]string{"dest"},
+		)
+
 		Registry = prometheus.NewRegistry()
 		Registry.MustRegister(
 			ackCounter,
 			connCounter,
 			fatalCounter,
 			kafkaInputsCounter,
+			utils.KafkaPartitionsGauge,
+			utils.KafkaPartitionRefreshCounter,
 			httpStatusCounter,
 			openedFilesGauge,
+			workerQueueGauge,
+			bytesSentCounter,
+			messageSizeHistogram,
+			discardedCounter,
+			utils.InvalidPartitionCounter,
+			ordering.ReorderedCounter,
 		)
 	})
 }
@@ -142,6 +199,12 @@ type baseDestination struct {
 	encoder  encoders.Encoder
 	codename string
 	typ      conf.DestinationType
+	workers  *keyedWorkers
+	// errLogger rate-limits the logs of the NACK handlers
+	errLogger log15.Logger
+	// ordering checks the order of the sent messages, when ordering_check
+	// is enabled
+	ordering *ordering.Checker
 }
 
 func newBaseDestination(typ conf.DestinationType, codename string, e *Env) *baseDestination {
@@ -157,6 +220,13 @@ func newBaseDestination(typ conf.DestinationType, codename string, e *Env) *base
 		snack:    e.nack,
 		spermerr: e.permerr,
 	}
+	base.errLogger = logging.RateLimited(e.logger, e.config.Main.LogRateLimitWindow, e.config.Main.LogRateLimitBurst)
+	base.ordering = ordering.NewChecker(e.config.Main.OrderingCheck)
+	maxTopics := e.config.Main.MetricsMaxTopics
+	if maxTopics == 0 {
+		maxTopics = defaultMaxTopics
+	}
+	topicLimiter.SetMax(maxTopics)
 	return &base
 }
 
@@ -175,6 +245,55 @@ func (base *baseDestination) PermError(uid utils.MyULID) {
 	ackCounter.WithLabelValues(base.codename, "permerr").Inc()
 }
 
+// countSent accounts for an encoded message of the given size, including the
+// framing, that was handed to the remote service. topic is empty for the
+// destinations that don't have topics.
+func (base *baseDestination) countSent(topic string, size int) {
+	bytesSentCounter.WithLabelValues(base.codename, topicLabel(topic)).Add(float64(size))
+	messageSizeHistogram.WithLabelValues(base.codename).Observe(float64(size))
+}
+
+// topicLabel returns the label of topic in bytesSentCounter.
+func topicLabel(topic string) string {
+	if topic == "" {
+		return topic
+	}
+	if _, ok := sentTopics.Load(topic); ok {
+		return topic
+	}
+	label := topicLimiter.Acquire(topic)
+	if label != utils.OtherLabel {
+		sentTopics.Store(topic, true)
+	}
+	return label
+}
+
+// CountDiscarded accounts for a message that was routed to the null
+// destination instead of dest: it was ACKed, but not sent.
+func CountDiscarded(dest conf.DestinationType) {
+	discardedCounter.WithLabelValues(conf.DestinationNames[dest]).Inc()
+}
+
+// countSentFunc returns the OnSent hook of the clients.
+func (base *baseDestination) countSentFunc() func(size int) {
+	return func(size int) {
+		base.countSent("", size)
+	}
+}
+
+// countingWriter counts the bytes written by the encoders that write
+// directly to a connection.
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (c *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = c.w.Write(p)
+	c.n += n
+	return n, err
+}
+
 func (base *baseDestination) NACKAll(msgQ *message.Ring) {
 	msgQ.Dispose()
 	var msg *model.FullMessage
@@ -204,6 +323,12 @@ func (base *baseDestination) NACKRemaining(msgs []model.OutputMsg) {
 	}
 }
 
+// TakeStamps removes the ordering stamps of a message, so that they are not
+// encoded, and keeps them for the check of its delivery.
+func (base *baseDestination) TakeStamps(msg *model.FullMessage) {
+	base.ordering.Take(msg)
+}
+
 func (base *baseDestination) ForEach(ctx context.Context, f func(context.Context, *model.FullMessage) error, ackf, free bool, msgs []model.OutputMsg) (err eerrors.ErrorSlice) {
 	var msg *model.FullMessage
 	var curErr error
@@ -213,6 +338,9 @@ func (base *baseDestination) ForEach(ctx context.Context, f func(context.Context
 		msg = msgs[0].Message
 		uid = msg.Uid
 		curErr = f(ctx, msg)
+		if curErr == nil {
+			base.ordering.Check(msg)
+		}
 		msgs = msgs[1:]
 		if free {
 			model.FullFree(msg)
@@ -243,6 +371,9 @@ func (base *baseDestination) ForEachWithTopic(ctx context.Context, f func(contex
 		msg = msgs[0].Message
 		uid = msg.Uid
 		curErr = f(ctx, msg, msgs[0].Topic, msgs[0].PartitionKey, msgs[0].PartitionNumber)
+		if curErr == nil {
+			base.ordering.Check(msg)
+		}
 		msgs = msgs[1:]
 		if free {
 			model.FullFree(msg)
@@ -276,11 +407,15 @@ func (base *baseDestination) getEncoder(format string) (frmt baseenc.Format, enc
 	return frmt, encoder, nil
 }
 
-func (base *baseDestination) setFormat(format string) error {
+func (base *baseDestination) setFormat(format string, jsonConf conf.JSONOutputConfig) error {
 	frmt, encoder, err := base.getEncoder(format)
 	if err != nil {
 		return err
 	}
+	encoder, err = encoders.GetJSONEncoder(frmt, baseenc.ParseSDLayout(jsonConf.SD), jsonConf.SDPrefix)
+	if err != nil {
+		return err
+	}
 	base.format = frmt
 	base.encoder = encoder
 	return nil
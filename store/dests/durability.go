@@ -0,0 +1,66 @@
+package dests
+
+import (
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/utils"
+)
+
+// syncer is the output of a destination that is flushed and synced at the end
+// of the batches, according to the durability level.
+type syncer interface {
+	Flush() error
+	Sync() error
+}
+
+// durableBatch holds the messages of a batch that were written, but that
+// must not be ACKed before their outputs have been flushed or synced.
+type durableBatch struct {
+	durability string
+	uids       []utils.MyULID
+	outputs    []syncer
+}
+
+func newDurableBatch(durability string) *durableBatch {
+	return &durableBatch{durability: durability}
+}
+
+// add notes that the message uid has been written to output.
+func (b *durableBatch) add(uid utils.MyULID, output syncer) {
+	b.uids = append(b.uids, uid)
+	for _, o := range b.outputs {
+		if o == output {
+			return
+		}
+	}
+	b.outputs = append(b.outputs, output)
+}
+
+// commit flushes the outputs of the batch, syncs them with the "sync"
+// durability, and then ACKs the messages. When an output fails, all the
+// messages of the batch are NACKed.
+func (base *baseDestination) commit(b *durableBatch) (err error) {
+	for _, o := range b.outputs {
+		err = o.Flush()
+		if err == nil && b.durability == conf.DurabilitySync {
+			err = o.Sync()
+		}
+		if err != nil {
+			break
+		}
+	}
+	for _, uid := range b.uids {
+		if err == nil {
+			base.ACK(uid)
+		} else {
+			base.NACK(uid)
+		}
+	}
+	return err
+}
+
+// abort NACKs the messages of the batch.
+func (base *baseDestination) abort(b *durableBatch) {
+	for _, uid := range b.uids {
+		base.NACK(uid)
+	}
+}
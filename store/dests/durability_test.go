@@ -0,0 +1,76 @@
+package dests
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/utils"
+)
+
+// fakeFile records the flushes and the fsyncs in the events of the test.
+type fakeFile struct {
+	events  *[]string
+	syncErr error
+}
+
+func (f *fakeFile) Flush() error {
+	*f.events = append(*f.events, "flush")
+	return nil
+}
+
+func (f *fakeFile) Sync() error {
+	*f.events = append(*f.events, "fsync")
+	return f.syncErr
+}
+
+func newTestDestination(events *[]string) *baseDestination {
+	InitRegistry()
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	cb := func(status string) storeCallback {
+		return func(uid utils.MyULID, dest conf.DestinationType) {
+			*events = append(*events, status)
+		}
+	}
+	e := BuildEnv().Logger(logger).Callbacks(cb("ack"), cb("nack"), cb("permerr"))
+	return newBaseDestination(conf.File, "file", e)
+}
+
+func TestDurableBatchAckTiming(t *testing.T) {
+	tests := []struct {
+		durability string
+		syncErr    error
+		expected   []string
+	}{
+		{conf.DurabilityFlush, nil, []string{"flush", "flush", "ack", "ack", "ack"}},
+		{conf.DurabilitySync, nil, []string{"flush", "fsync", "flush", "fsync", "ack", "ack", "ack"}},
+		{conf.DurabilitySync, errors.New("fsync failed"), []string{"flush", "fsync", "nack", "nack", "nack"}},
+	}
+	for _, test := range tests {
+		var events []string
+		d := newTestDestination(&events)
+		f1 := &fakeFile{events: &events, syncErr: test.syncErr}
+		f2 := &fakeFile{events: &events}
+		batch := newDurableBatch(test.durability)
+		batch.add(utils.NewUid(), f1)
+		batch.add(utils.NewUid(), f2)
+		batch.add(utils.NewUid(), f1)
+		if len(events) != 0 {
+			t.Fatalf("%s: the messages were acknowledged before the end of the batch: %v", test.durability, events)
+		}
+		err := d.commit(batch)
+		if (err != nil) != (test.syncErr != nil) {
+			t.Fatalf("%s: unexpected commit error: %v", test.durability, err)
+		}
+		if len(events) != len(test.expected) {
+			t.Fatalf("%s: expected %v, got %v", test.durability, test.expected, events)
+		}
+		for i := range events {
+			if events[i] != test.expected[i] {
+				t.Fatalf("%s: expected %v, got %v", test.durability, test.expected, events)
+			}
+		}
+	}
+}
@@ -53,7 +53,7 @@ func NewElasticDestination(ctx context.Context, e *Env) (Destination, error) {
 	if err != nil {
 		return nil, err
 	}
-	err = d.setFormat(config.Format)
+	err = d.setFormat(config.Format, config.JSONOutputConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -159,6 +159,10 @@ func NewElasticDestination(ctx context.Context, e *Env) (Destination, error) {
 		}()
 	}
 
+	// messages that have the same partition key (or the same hostname) are
+	// handed to the bulk processor by the same worker, in order
+	d.startWorkers(ctx, config.Workers, config.WorkerQueueSize, d.send, false)
+
 	return d, nil
 }
 
@@ -196,13 +200,15 @@ func (d *ElasticDestination) after(execID int64, requests []elastic.BulkableRequ
 		d.sentMessagesUids.Delete(uid)
 		d.NACK(uid)
 		if item.Error != nil {
-			d.logger.Warn("Elasticsearch index error", "type", item.Error.Type, "reason", item.Error.Reason, "index", item.Error.Index)
+			d.errLogger.Warn("Elasticsearch index error", "type", item.Error.Type, "reason", item.Error.Reason, "index", item.Error.Index)
 		}
 	}
 	d.dofatal(eerrors.New("Elasticsearch bulk delivery error"))
 }
 
 func (d *ElasticDestination) Close() error {
+	// the workers must not add requests to the closed processor
+	d.stopWorkers()
 	d.sentMessagesUids.Each(func(k gotomic.Hashable, v gotomic.Thing) bool {
 		if uid, ok := k.(utils.MyULID); ok {
 			d.NACK(uid)
@@ -261,13 +267,24 @@ func (d *ElasticDestination) sendOne(ctx context.Context, msg *model.FullMessage
 
 	// add message to the bulk processor work list
 	d.sentMessagesUids.Put(msg.Uid, true)
-	d.processor.Add(
-		elastic.NewBulkIndexRequest().Index(indexName).Type(d.messagesType).Id(msg.Uid.String()).Doc(json.RawMessage(buf)),
-	)
+	d.countSent("", len(buf))
+	d.processor.Add(d.bulkRequest(indexName, msg.Uid, buf))
 
 	return nil
 }
 
+// bulkRequest returns the index request of a message. The document _id is
+// the message UID, so that a message sent again after a failure replaces
+// the same document instead of creating a duplicate.
+func (d *ElasticDestination) bulkRequest(indexName string, uid utils.MyULID, buf string) *elastic.BulkIndexRequest {
+	return elastic.NewBulkIndexRequest().Index(indexName).Type(d.messagesType).Id(uid.String()).Doc(json.RawMessage(buf))
+}
+
+// send is the worker function: the messages are ACKed by the bulk processor.
+func (d *ElasticDestination) send(ctx context.Context, msg *model.OutputMsg) error {
+	return d.sendOne(ctx, msg.Message)
+}
+
 func (d *ElasticDestination) Send(ctx context.Context, msgs []model.OutputMsg) (err eerrors.ErrorSlice) {
-	return d.ForEach(ctx, d.sendOne, false, true, msgs)
+	return d.dispatch(msgs)
 }
@@ -0,0 +1,112 @@
+package dests
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils"
+)
+
+// TestDestinationsKeepTheirFormat sends the same messages to two destinations
+// built from the same configuration: an archive branch that writes gzipped
+// protobuf records, and a hot branch that writes JSON. Each destination uses
+// its own encoder and flush policy.
+func TestDestinationsKeepTheirFormat(t *testing.T) {
+	InitRegistry()
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	dir, err := ioutil.TempDir("", "skewer-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	c, err := conf.Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.FileDest.Filename = filepath.Join(dir, "archive.pb.gz")
+	c.FileDest.Format = "protobuf"
+	c.FileDest.Gzip = true
+	c.FileDest.GzipLevel = 9
+	c.FileDest.BufferSize = 1 << 20
+	c.FileDest.Durability = conf.DurabilityFlush
+	c.StderrDest.Format = "json"
+	noop := func(uid utils.MyULID, dest conf.DestinationType) {}
+	e := BuildEnv().Logger(logger).Callbacks(noop, noop, noop).Config(c)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	archive, err := NewFileDestination(ctx, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hot, err := NewStderrDestination(ctx, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := func() []model.OutputMsg {
+		m := model.FullFactory()
+		m.Uid = utils.NewUid()
+		m.Fields.AppName = "app"
+		m.Fields.Message = "archived and forwarded"
+		return []model.OutputMsg{{Message: m}}
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	errs := hot.Send(ctx, msg())
+	os.Stderr = stderr
+	_ = w.Close()
+	if !errs.Empty() {
+		t.Fatal(errs)
+	}
+	if errs := archive.Send(ctx, msg()); !errs.Empty() {
+		t.Fatal(errs)
+	}
+	_ = archive.Close()
+
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hotMsg map[string]interface{}
+	if err := json.Unmarshal(bytes.TrimSpace(out), &hotMsg); err != nil {
+		t.Fatalf("the hot branch should write JSON: %v (%q)", err, out)
+	}
+
+	f, err := os.Open(c.FileDest.Filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("the archive branch should write gzip: %v", err)
+	}
+	record, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var archived model.FullMessage
+	if err := proto.Unmarshal(bytes.TrimSuffix(record, []byte("\n")), &archived); err != nil {
+		t.Fatalf("the archive branch should write protobuf: %v", err)
+	}
+	if archived.Fields.Message != "archived and forwarded" {
+		t.Fatalf("unexpected archived message: %q", archived.Fields.Message)
+	}
+}
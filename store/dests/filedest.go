@@ -178,9 +178,16 @@ func (o *openedFiles) open(filename string) (fi *utils.OFile, err error) {
 		return nil, err
 	}
 
-	o.logger.Debug("Opening file", "filename", filename)
 	o.filesMu.Lock()
 	defer o.filesMu.Unlock()
+	// another worker may have opened the file in the meantime: the writes to
+	// a file must all go through the same handle, so that they are serialized
+	fi = o.files.Get(filename)
+	if fi != nil {
+		fi.Postpone(o.timeout)
+		return fi, nil
+	}
+	o.logger.Debug("Opening file", "filename", filename)
 	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		return nil, err
@@ -200,14 +207,16 @@ type FileDestination struct {
 	*baseDestination
 	filenameTmpl *template.Template
 	files        *openedFiles
+	durability   string
 }
 
 func NewFileDestination(ctx context.Context, e *Env) (Destination, error) {
 	dest := &FileDestination{
 		baseDestination: newBaseDestination(conf.File, "file", e),
 		files:           newOpenedFiles(ctx, e.config.FileDest, e.logger),
+		durability:      e.config.FileDest.Durability,
 	}
-	err := dest.setFormat(e.config.FileDest.Format)
+	err := dest.setFormat(e.config.FileDest.Format, e.config.FileDest.JSONOutputConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -219,10 +228,25 @@ func NewFileDestination(ctx context.Context, e *Env) (Destination, error) {
 	if err != nil {
 		return nil, err
 	}
+	if dest.durability == conf.DurabilityNone {
+		// the durable modes ACK a batch after its files are flushed, so they
+		// write the batch in order themselves
+		dest.startWorkers(ctx, e.config.FileDest.Workers, e.config.FileDest.WorkerQueueSize, dest.send, true)
+	}
 	return dest, nil
 }
 
 func (d *FileDestination) sendOne(ctx context.Context, message *model.FullMessage) (err error) {
+	f, err := d.write(message)
+	if f != nil && f.Release() {
+		openedFilesGauge.Dec()
+	}
+	return err
+}
+
+// write writes the message to its file. The returned file must be released
+// by the caller.
+func (d *FileDestination) write(message *model.FullMessage) (f *utils.OFile, err error) {
 	if len(message.Fields.AppName) == 0 {
 		message.Fields.AppName = "unknown"
 	}
@@ -230,7 +254,7 @@ func (d *FileDestination) sendOne(ctx context.Context, message *model.FullMessag
 	err = d.filenameTmpl.Execute(buf, message.Fields)
 	if err != nil {
 		d.logger.Warn("Error calculating filename", "error", err)
-		return encoders.EncodingError(err)
+		return nil, encoders.EncodingError(err)
 	}
 	filename := strings.TrimSpace(buf.String())
 	bytebufferpool.Put(buf)
@@ -238,26 +262,75 @@ func (d *FileDestination) sendOne(ctx context.Context, message *model.FullMessag
 	encoded, err := encoders.ChainEncode(d.encoder, message, "\n")
 	if err != nil {
 		d.logger.Warn("Error encoding message", "error", err)
-		return encoders.EncodingError(err)
+		return nil, encoders.EncodingError(err)
 	}
 
-	f, err := d.files.open(filename)
+	f, err = d.files.open(filename)
 	if err != nil {
 		d.logger.Warn("Error opening file", "filename", filename, "error", err)
-		return err
+		return nil, err
 	}
+	// one write per record, so that the records are not torn
 	_, err = io.WriteString(f, encoded)
-	if f.Release() {
-		openedFilesGauge.Dec()
+	if err == nil {
+		d.countSent("", len(encoded))
 	}
-	return err
+	return f, err
+}
+
+// durableFile is a file of a durable batch: its flush also flushes the gzip
+// stream, so that the ACKed messages can be read from the compressed files.
+type durableFile struct {
+	*utils.OFile
+}
+
+func (f durableFile) Flush() error {
+	return f.FlushAll()
+}
+
+// send is the worker function, with Durability "none".
+func (d *FileDestination) send(ctx context.Context, msg *model.OutputMsg) error {
+	return d.sendOne(ctx, msg.Message)
 }
 
 func (d *FileDestination) Close() error {
+	d.stopWorkers()
 	d.files.closeall()
 	return nil
 }
 
 func (d *FileDestination) Send(ctx context.Context, msgs []model.OutputMsg) (err eerrors.ErrorSlice) {
-	return d.ForEach(ctx, d.sendOne, true, true, msgs)
+	if d.durability == conf.DurabilityNone {
+		return d.dispatch(msgs)
+	}
+	// the messages are ACKed after the files have been flushed or synced
+	batch := newDurableBatch(d.durability)
+	files := make([]*utils.OFile, 0)
+	failed := false
+	err = d.ForEach(ctx, func(ctx context.Context, message *model.FullMessage) error {
+		f, werr := d.write(message)
+		if f != nil {
+			files = append(files, f)
+		}
+		if werr == nil {
+			batch.add(message.Uid, durableFile{f})
+		} else if !IsEncodingError(werr) {
+			failed = true
+		}
+		return werr
+	}, false, true, msgs)
+	if failed {
+		// the failed and the remaining messages have been NACKed by ForEach
+		d.abort(batch)
+	} else if cerr := d.commit(batch); cerr != nil {
+		d.logger.Warn("Error flushing the files", "durability", d.durability, "error", cerr)
+		d.dofatal(cerr)
+		err = append(err, cerr)
+	}
+	for _, f := range files {
+		if f.Release() {
+			openedFilesGauge.Dec()
+		}
+	}
+	return err
 }
@@ -0,0 +1,192 @@
+package dests
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Graylog2/go-gelf/gelf"
+	"go.uber.org/atomic"
+)
+
+// countingConn counts the bytes written to the connection.
+type countingConn struct {
+	net.Conn
+	n *atomic.Int64
+}
+
+func (c countingConn) Write(p []byte) (n int, err error) {
+	n, err = c.Conn.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// gelfSender sends GELF messages like the gelf writers do, but over a
+// connection that counts the written bytes: the gelf writers don't expose
+// their connection.
+type gelfSender struct {
+	mu               sync.Mutex
+	network          string
+	addr             string
+	conn             net.Conn
+	written          *atomic.Int64
+	compressionType  gelf.CompressType
+	compressionLevel int
+	maxReconnect     int
+	reconnectDelay   time.Duration
+}
+
+func newGelfSender(network, addr string) (*gelfSender, error) {
+	s := &gelfSender{
+		network:          network,
+		addr:             addr,
+		written:          atomic.NewInt64(0),
+		compressionType:  gelf.CompressNone,
+		compressionLevel: gzip.BestSpeed,
+		maxReconnect:     gelf.DefaultMaxReconnect,
+		reconnectDelay:   gelf.DefaultReconnectDelay,
+	}
+	err := s.dial()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *gelfSender) dial() error {
+	conn, err := net.Dial(s.network, s.addr)
+	if err != nil {
+		return err
+	}
+	s.conn = countingConn{Conn: conn, n: s.written}
+	return nil
+}
+
+// Written returns the number of bytes written to the connection so far.
+func (s *gelfSender) Written() int64 {
+	return s.written.Load()
+}
+
+func (s *gelfSender) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+// WriteMessage sends the message: null delimited in TCP, compressed and
+// chunked in UDP.
+func (s *gelfSender) WriteMessage(m *gelf.Message) error {
+	var buf bytes.Buffer
+	err := m.MarshalJSONBuf(&buf)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.network == "udp" {
+		return s.writeUDP(buf.Bytes())
+	}
+	buf.WriteByte(0)
+	return s.writeTCP(buf.Bytes())
+}
+
+func (s *gelfSender) writeTCP(b []byte) (err error) {
+	for i := 0; i <= s.maxReconnect; i++ {
+		if s.conn != nil {
+			_, err = s.conn.Write(b)
+			if err == nil {
+				return nil
+			}
+			_ = s.conn.Close()
+			s.conn = nil
+		}
+		time.Sleep(s.reconnectDelay * time.Second)
+		err = s.dial()
+	}
+	if err == nil {
+		err = fmt.Errorf("Maximum reconnection attempts was reached; giving up")
+	}
+	return err
+}
+
+func (s *gelfSender) compress(b []byte) ([]byte, error) {
+	var zbuf bytes.Buffer
+	var zw io.WriteCloser
+	var err error
+	switch s.compressionType {
+	case gelf.CompressGzip:
+		zw, err = gzip.NewWriterLevel(&zbuf, s.compressionLevel)
+	case gelf.CompressZlib:
+		zw, err = zlib.NewWriterLevel(&zbuf, s.compressionLevel)
+	default:
+		return b, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, err = zw.Write(b)
+	if err != nil {
+		_ = zw.Close()
+		return nil, err
+	}
+	err = zw.Close()
+	if err != nil {
+		return nil, err
+	}
+	return zbuf.Bytes(), nil
+}
+
+const (
+	gelfChunkSize    = gelf.ChunkSize
+	gelfChunkDataLen = gelf.ChunkSize - 12
+)
+
+var gelfMagicChunked = []byte{0x1e, 0x0f}
+
+func (s *gelfSender) writeUDP(b []byte) error {
+	z, err := s.compress(b)
+	if err != nil {
+		return err
+	}
+	if len(z) <= gelfChunkSize {
+		_, err = s.conn.Write(z)
+		return err
+	}
+	// 2-byte magic, 8-byte message id, 1-byte sequence number, 1-byte
+	// count, chunk data
+	nChunks := (len(z) + gelfChunkDataLen - 1) / gelfChunkDataLen
+	if nChunks > 128 {
+		return fmt.Errorf("msg too large, would need %d chunks", nChunks)
+	}
+	msgID := make([]byte, 8)
+	_, err = io.ReadFull(rand.Reader, msgID)
+	if err != nil {
+		return err
+	}
+	chunk := make([]byte, 0, gelfChunkSize)
+	for i := 0; len(z) > 0; i++ {
+		l := gelfChunkDataLen
+		if l > len(z) {
+			l = len(z)
+		}
+		chunk = append(chunk[:0], gelfMagicChunked...)
+		chunk = append(chunk, msgID...)
+		chunk = append(chunk, byte(i), byte(nChunks))
+		chunk = append(chunk, z[:l]...)
+		_, err = s.conn.Write(chunk)
+		if err != nil {
+			return fmt.Errorf("Write (chunk %d/%d): %s", i, nChunks, err)
+		}
+		z = z[l:]
+	}
+	return nil
+}
@@ -15,46 +15,42 @@ import (
 
 type GraylogDestination struct {
 	*baseDestination
-	writer gelf.Writer
+	writer *gelfSender
 }
 
 func NewGraylogDestination(ctx context.Context, e *Env) (Destination, error) {
 	hostport := net.JoinHostPort(e.config.GraylogDest.Host, strconv.FormatInt(int64(e.config.GraylogDest.Port), 10))
-	var w gelf.Writer
-	if strings.ToLower(strings.TrimSpace(e.config.GraylogDest.Mode)) == "udp" {
-		writer, err := gelf.NewUDPWriter(hostport)
-		if err != nil {
-			connCounter.WithLabelValues("graylog", "fail").Inc()
-			return nil, err
-		}
-		connCounter.WithLabelValues("graylog", "success").Inc()
-		writer.CompressionLevel = e.config.GraylogDest.CompressionLevel
+	udp := strings.ToLower(strings.TrimSpace(e.config.GraylogDest.Mode)) == "udp"
+	network := "tcp"
+	if udp {
+		network = "udp"
+	}
+	writer, err := newGelfSender(network, hostport)
+	if err != nil {
+		connCounter.WithLabelValues("graylog", "fail").Inc()
+		return nil, err
+	}
+	connCounter.WithLabelValues("graylog", "success").Inc()
+	if udp {
+		writer.compressionLevel = e.config.GraylogDest.CompressionLevel
 		switch strings.TrimSpace(strings.ToLower(e.config.GraylogDest.CompressionType)) {
 		case "gzip":
-			writer.CompressionType = gelf.CompressGzip
+			writer.compressionType = gelf.CompressGzip
 		case "zlib":
-			writer.CompressionType = gelf.CompressZlib
+			writer.compressionType = gelf.CompressZlib
 		case "none", "":
-			writer.CompressionType = gelf.CompressNone
+			writer.compressionType = gelf.CompressNone
 		default:
-			writer.CompressionType = gelf.CompressGzip
+			writer.compressionType = gelf.CompressGzip
 		}
-		w = writer
 	} else {
-		writer, err := gelf.NewTCPWriter(hostport)
-		if err != nil {
-			connCounter.WithLabelValues("graylog", "fail").Inc()
-			return nil, err
-		}
-		connCounter.WithLabelValues("graylog", "success").Inc()
-		writer.MaxReconnect = e.config.GraylogDest.MaxReconnect
-		writer.ReconnectDelay = e.config.GraylogDest.ReconnectDelay
-		w = writer
+		writer.maxReconnect = e.config.GraylogDest.MaxReconnect
+		writer.reconnectDelay = e.config.GraylogDest.ReconnectDelay
 	}
 
 	d := &GraylogDestination{
 		baseDestination: newBaseDestination(conf.Graylog, "graylog", e),
-		writer:          w,
+		writer:          writer,
 	}
 	return d, nil
 }
@@ -64,7 +60,13 @@ func (d *GraylogDestination) Close() error {
 }
 
 func (d *GraylogDestination) sendOne(ctx context.Context, m *model.FullMessage) error {
-	return d.writer.WriteMessage(encoders.FullToGelfMessage(m))
+	before := d.writer.Written()
+	err := d.writer.WriteMessage(encoders.FullToGelfMessage(m))
+	if err != nil {
+		return err
+	}
+	d.countSent("", int(d.writer.Written()-before))
+	return nil
 }
 
 func (d *GraylogDestination) Send(ctx context.Context, msgs []model.OutputMsg) (err eerrors.ErrorSlice) {
@@ -0,0 +1,118 @@
+package dests
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/encoders"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils"
+)
+
+func TestGraylogBytesSent(t *testing.T) {
+	InitRegistry()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan []byte)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			close(received)
+			return
+		}
+		content, _ := ioutil.ReadAll(conn)
+		received <- content
+	}()
+
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	c := conf.BaseConfig{}
+	addr := listener.Addr().(*net.TCPAddr)
+	c.GraylogDest.Host = addr.IP.String()
+	c.GraylogDest.Port = addr.Port
+	c.GraylogDest.Mode = "tcp"
+	nop := func(uid utils.MyULID, dest conf.DestinationType) {}
+	e := BuildEnv().Logger(logger).Config(c).Callbacks(nop, nop, nop)
+	d, err := NewGraylogDestination(context.Background(), e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := func() float64 {
+		m := &dto.Metric{}
+		_ = bytesSentCounter.WithLabelValues("graylog", "").Write(m)
+		return m.GetCounter().GetValue()
+	}
+	before := sent()
+
+	msg := model.FullFactory()
+	msg.Uid = utils.NewUid()
+	msg.Fields = model.Factory()
+	msg.Fields.Message = "hello graylog"
+	err = d.(*GraylogDestination).sendOne(context.Background(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = d.Close()
+	content := <-received
+	if len(content) == 0 || !bytes.Contains(content, []byte("hello graylog")) {
+		t.Fatalf("unexpected GELF payload: %q", content)
+	}
+	if n := sent() - before; n != float64(len(content)) {
+		t.Fatalf("expected %d bytes to be counted, got %v", len(content), n)
+	}
+}
+
+func TestGelfSenderChunks(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = pc.Close() }()
+	s, err := newGelfSender("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = s.Close() }()
+
+	msg := model.FullFactory()
+	msg.Fields = model.Factory()
+	msg.Fields.Message = strings.Repeat("x", 3*gelfChunkSize)
+	err = s.WriteMessage(encoders.FullToGelfMessage(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload []byte
+	var total int64
+	buf := make([]byte, 2*gelfChunkSize)
+	for i := 0; ; i++ {
+		_ = pc.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += int64(n)
+		if !bytes.HasPrefix(buf, gelfMagicChunked) || int(buf[10]) != i {
+			t.Fatalf("unexpected chunk header: %v", buf[:12])
+		}
+		payload = append(payload, buf[12:n]...)
+		if i+1 == int(buf[11]) {
+			break
+		}
+	}
+	if !bytes.Contains(payload, []byte(msg.Fields.Message)) {
+		t.Fatal("the chunks do not contain the message")
+	}
+	if s.Written() != total {
+		t.Fatalf("expected %d bytes to be counted, got %d", total, s.Written())
+	}
+}
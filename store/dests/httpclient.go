@@ -10,7 +10,6 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
-	"sync"
 	"text/template"
 	"time"
 
@@ -20,7 +19,6 @@ import (
 	"github.com/stephane-martin/skewer/model"
 	"github.com/stephane-martin/skewer/utils"
 	"github.com/stephane-martin/skewer/utils/eerrors"
-	"github.com/stephane-martin/skewer/utils/queue/defered"
 	"github.com/valyala/bytebufferpool"
 )
 
@@ -35,8 +33,9 @@ type HTTPDestination struct {
 	method      string
 	contentType string
 	reqtimeout  time.Duration
-	queue       *defered.Ring
-	wg          sync.WaitGroup
+	// idempotencyHeader carries the message UID, so that the messages sent
+	// again after a failure can be deduplicated by the server
+	idempotencyHeader string
 }
 
 func NewHTTPDestination(ctx context.Context, e *Env) (Destination, error) {
@@ -47,7 +46,8 @@ func NewHTTPDestination(ctx context.Context, e *Env) (Destination, error) {
 		method:          config.Method,
 		reqtimeout:      config.RequestTimeout,
 	}
-	err := d.setFormat(config.Format)
+	d.idempotencyHeader = strings.TrimSpace(config.IdempotencyHeader)
+	err := d.setFormat(config.Format, config.JSONOutputConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -142,7 +142,6 @@ func NewHTTPDestination(ctx context.Context, e *Env) (Destination, error) {
 		}
 	}
 
-	d.queue = defered.NewRing(4 * uint64(config.MaxIdleConnsPerHost))
 	// TODO: why 5 ?
 	d.breaker = circuit.NewConsecutiveBreaker(5)
 
@@ -157,31 +156,16 @@ func NewHTTPDestination(ctx context.Context, e *Env) (Destination, error) {
 		}()
 	}
 
-	for i := 0; i < config.MaxIdleConnsPerHost; i++ {
-		d.wg.Add(1)
-		go func() {
-			defer d.wg.Done()
-			err := d.dequeue(ctx)
-			if err != nil {
-				d.dofatal(eerrors.Wrap(err, "Error performing HTTP request"))
-			}
-		}()
-	}
+	// messages that have the same partition key (or the same hostname) are
+	// sent by the same worker, in order
+	d.startWorkers(ctx, config.Workers, config.WorkerQueueSize, d.send, true)
 
 	return d, nil
 }
 
 func (d *HTTPDestination) Close() error {
-	d.queue.Dispose()
-	d.wg.Wait()
-	// nack remaining enqueued requests
-	for {
-		req, err := d.queue.Get()
-		if err != nil || req == nil {
-			break
-		}
-		d.NACK(req.UID)
-	}
+	// nack remaining enqueued messages
+	d.stopWorkers()
 	return nil
 }
 
@@ -194,11 +178,21 @@ func (d *HTTPDestination) doHTTP(ctx context.Context, uid utils.MyULID, req *htt
 	if len(d.username) > 0 && len(d.password) > 0 {
 		req.SetBasicAuth(d.username, d.password)
 	}
+	if len(d.idempotencyHeader) > 0 {
+		req.Header.Set(d.idempotencyHeader, uid.String())
+	}
 	req = req.WithContext(ctx)
 
 	// perform the HTTP request, retry every second, use a circuit breaker to limit the tries
 	var resp *http.Response
-	for {
+	for first := true; ; first = false {
+		if !first && req.GetBody != nil {
+			// the body was consumed by the failed try
+			req.Body, err = req.GetBody()
+			if err != nil {
+				return err
+			}
+		}
 		err = d.breaker.CallContext(
 			ctx, func() (e error) {
 				resp, e = d.clt.Do(req.WithContext(ctx))
@@ -243,24 +237,10 @@ func (d *HTTPDestination) doHTTP(ctx context.Context, uid utils.MyULID, req *htt
 	return eerrors.Errorf("HTTP error when sending message to server: code '%d', status '%s'", resp.StatusCode, resp.Status)
 }
 
-func (d *HTTPDestination) dequeue(ctx context.Context) error {
-	for {
-		defered, err := d.queue.Get()
-		if err != nil || defered == nil {
-			return nil
-		}
-		err = d.doHTTP(ctx, defered.UID, defered.Request)
-		if err != nil {
-			d.NACK(defered.UID)
-			return err
-		}
-		d.ACK(defered.UID)
-	}
-}
-
 var ErrCalculateURL = eerrors.New("Error calculating target URL from template")
 
-func (d *HTTPDestination) enqueue(ctx context.Context, msg *model.FullMessage) (err error) {
+func (d *HTTPDestination) send(ctx context.Context, omsg *model.OutputMsg) (err error) {
+	msg := omsg.Message
 	urlbuf := bytebufferpool.Get()
 	body := bytebufferpool.Get()
 	defer func() {
@@ -282,10 +262,16 @@ func (d *HTTPDestination) enqueue(ctx context.Context, msg *model.FullMessage) (
 		return encoders.EncodingError(eerrors.Wrap(err, "Error preparing HTTP request"))
 	}
 
-	dreq := &model.DeferedRequest{Request: req, UID: msg.Uid}
-	return d.queue.Put(dreq)
+	err = d.doHTTP(ctx, msg.Uid, req)
+	if err == nil {
+		d.countSent("", body.Len())
+	}
+	if err != nil && !IsEncodingError(err) {
+		return eerrors.Wrap(err, "Error performing HTTP request")
+	}
+	return err
 }
 
 func (d *HTTPDestination) Send(ctx context.Context, msgs []model.OutputMsg) (err eerrors.ErrorSlice) {
-	return d.ForEach(ctx, d.enqueue, false, true, msgs)
+	return d.dispatch(msgs)
 }
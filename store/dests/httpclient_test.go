@@ -0,0 +1,95 @@
+package dests
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+
+	circuit "github.com/rubyist/circuitbreaker"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils"
+)
+
+func TestHTTPIdempotencyKey(t *testing.T) {
+	var mu sync.Mutex
+	var keys, bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		keys = append(keys, r.Header.Get("X-Message-Id"))
+		bodies = append(bodies, string(body))
+		if len(keys) == 1 {
+			// the first try fails, so the message is sent again
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	var events []string
+	d := &HTTPDestination{
+		baseDestination:   newTestDestination(&events),
+		clt:               srv.Client(),
+		breaker:           circuit.NewConsecutiveBreaker(5),
+		method:            "POST",
+		reqtimeout:        time.Second,
+		idempotencyHeader: "X-Message-Id",
+	}
+	d.url = template.Must(template.New("url").Parse(srv.URL))
+	err := d.setFormat("json", conf.JSONOutputConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := model.FullFactoryFrom(model.Factory())
+	msg.Uid = utils.NewUid()
+	msg.Fields.Message = "hello"
+	omsg := &model.OutputMsg{Message: msg}
+	if d.send(context.Background(), omsg) == nil {
+		t.Fatal("the first try should fail")
+	}
+	err = d.send(context.Background(), omsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(keys) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(keys))
+	}
+	for i, key := range keys {
+		if key != msg.Uid.String() {
+			t.Errorf("request %d: the idempotency key '%s' is not the message UID '%s'", i, key, msg.Uid.String())
+		}
+	}
+	if bodies[0] != bodies[1] || len(bodies[0]) == 0 {
+		t.Errorf("the retry should send the same message: %q", bodies)
+	}
+}
+
+func TestElasticDocumentID(t *testing.T) {
+	d := &ElasticDestination{messagesType: "syslog"}
+	uid := utils.NewUid()
+	for i := 0; i < 2; i++ {
+		lines, err := d.bulkRequest("logs", uid, `{"message":"hello"}`).Source()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var action map[string]map[string]string
+		err = json.Unmarshal([]byte(lines[0]), &action)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if action["index"]["_id"] != uid.String() {
+			t.Fatalf("the document _id should be the message UID: %s", lines[0])
+		}
+	}
+}
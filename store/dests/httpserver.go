@@ -31,6 +31,9 @@ type HTTPServerDestination struct {
 	nMessages   int
 	lineFraming bool
 	delimiter   uint8
+	// jsonEncoder encodes the JSON messages with the configured SD layout,
+	// when the format is negotiated with the clients
+	jsonEncoder encoders.Encoder
 }
 
 func NewHTTPServerDestination(ctx context.Context, e *Env) (Destination, error) {
@@ -49,9 +52,14 @@ func NewHTTPServerDestination(ctx context.Context, e *Env) (Destination, error)
 		d.nMessages = 8 * 1024
 	}
 
-	if len(config.Format) > 0 {
+	if len(config.Format) == 0 {
+		d.jsonEncoder, err = encoders.GetJSONEncoder(baseenc.JSON, baseenc.ParseSDLayout(config.SD), config.SDPrefix)
+		if err != nil {
+			return nil, err
+		}
+	} else {
 		// determine content-type from the fixed output format
-		err = d.setFormat(config.Format)
+		err = d.setFormat(config.Format, config.JSONOutputConfig)
 		if err != nil {
 			return nil, err
 		}
@@ -148,6 +156,9 @@ func (d *HTTPServerDestination) getEncoder(ctype string) encoders.Encoder {
 	if d.encoder != nil {
 		return d.encoder
 	}
+	if d.jsonEncoder != nil && (ctype == encoders.JsonMimetype || ctype == encoders.NDJsonMimetype) {
+		return d.jsonEncoder
+	}
 	return encoders.RMimeTypes[ctype]
 }
 
@@ -266,6 +277,7 @@ Loop:
 				ok = false
 				break
 			}
+			d.countSent("", len(buf))
 		}
 	}
 
@@ -0,0 +1,49 @@
+package dests
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stephane-martin/skewer/encoders"
+	"github.com/stephane-martin/skewer/encoders/baseenc"
+	"github.com/stephane-martin/skewer/model"
+)
+
+func TestHTTPServerNegotiatedSDLayout(t *testing.T) {
+	jsonEncoder, err := encoders.GetJSONEncoder(baseenc.JSON, baseenc.SDFlat, "sd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &HTTPServerDestination{baseDestination: &baseDestination{}, jsonEncoder: jsonEncoder}
+	msg := model.FullFactory()
+	defer model.FullFree(msg)
+	msg.Fields.Message = "hello"
+	msg.Fields.SetProperty("origin", "ip", "10.0.0.1")
+
+	for _, ctype := range []string{encoders.JsonMimetype, encoders.NDJsonMimetype} {
+		var buf bytes.Buffer
+		err = d.getEncoder(ctype)(msg, &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var obj map[string]interface{}
+		err = json.Unmarshal(buf.Bytes(), &obj)
+		if err != nil {
+			t.Fatalf("invalid JSON '%s': %v", buf.String(), err)
+		}
+		if obj["sd.origin.ip"] != "10.0.0.1" || obj["message"] != "hello" {
+			t.Errorf("%s: the structured data should be flattened: %s", ctype, buf.String())
+		}
+	}
+
+	// the other content types keep their encoders
+	var buf bytes.Buffer
+	err = d.getEncoder(encoders.PlainMimetype)(msg, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("sd.origin.ip")) {
+		t.Errorf("the RFC5424 encoding should not be flattened: %s", buf.String())
+	}
+}
@@ -19,6 +19,8 @@ type Destination interface {
 	NACK(utils.MyULID)
 	PermError(utils.MyULID)
 	NACKAllSlice([]*model.FullMessage)
+	// TakeStamps removes the ordering stamps of a message before it is sent.
+	TakeStamps(*model.FullMessage)
 }
 
 type constructor func(ctx context.Context, e *Env) (Destination, error)
@@ -37,6 +39,8 @@ var destinations = map[conf.DestinationType]constructor{
 	conf.WebsocketServer: NewWebsocketServerDestination,
 	conf.Elasticsearch:   NewElasticDestination,
 	conf.Redis:           NewRedisDestination,
+	conf.Null:            NewNullDestination,
+	conf.Journal:         NewJournalDestination,
 }
 
 func NewDestination(ctx context.Context, typ conf.DestinationType, e *Env) (Destination, error) {
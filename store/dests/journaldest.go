@@ -0,0 +1,186 @@
+// +build linux,!nonsystemd
+
+package dests
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// JournalDestination writes the messages to the local systemd journal,
+// with the journald native protocol.
+type JournalDestination struct {
+	*baseDestination
+	conn *net.UnixConn
+	addr *net.UnixAddr
+	buf  bytes.Buffer
+}
+
+func NewJournalDestination(ctx context.Context, e *Env) (Destination, error) {
+	d := &JournalDestination{
+		baseDestination: newBaseDestination(conf.Journal, "journal", e),
+	}
+	path := e.config.JournalDest.SocketPath
+	if e.confined {
+		path = filepath.Join("/tmp", "journal", path)
+	}
+	d.addr = &net.UnixAddr{Name: path, Net: "unixgram"}
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		connCounter.WithLabelValues("journal", "fail").Inc()
+		return nil, eerrors.Wrap(err, "Failed to create the journald socket")
+	}
+	connCounter.WithLabelValues("journal", "success").Inc()
+	d.conn = conn
+	return d, nil
+}
+
+func (d *JournalDestination) Close() error {
+	return d.conn.Close()
+}
+
+// journalFieldName converts a structured data name to a valid journal field
+// name: uppercase letters, digits and underscores, not starting with an
+// underscore (those are reserved to journald).
+func journalFieldName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		default:
+			return '_'
+		}
+	}, name)
+	name = strings.TrimLeft(name, "_")
+	if len(name) > 0 && name[0] >= '0' && name[0] <= '9' {
+		name = "F" + name
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// writeJournalField appends a field in the native protocol format. The
+// values that contain a newline are written with their length.
+func writeJournalField(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	if strings.IndexByte(value, '\n') == -1 {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	_ = binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// encodeJournalEntry writes the journal entry of a message. The structured
+// data parameters become DOMAIN_PARAM fields.
+func encodeJournalEntry(buf *bytes.Buffer, m *model.SyslogMessage) {
+	writeJournalField(buf, "MESSAGE", m.Message)
+	writeJournalField(buf, "PRIORITY", strconv.Itoa(int(m.Severity)))
+	writeJournalField(buf, "SYSLOG_FACILITY", strconv.Itoa(int(m.Facility)))
+	if len(m.AppName) > 0 {
+		writeJournalField(buf, "SYSLOG_IDENTIFIER", m.AppName)
+	}
+	if len(m.ProcId) > 0 {
+		writeJournalField(buf, "SYSLOG_PID", m.ProcId)
+	}
+	if len(m.HostName) > 0 {
+		writeJournalField(buf, "SYSLOG_HOSTNAME", m.HostName)
+	}
+	if len(m.MsgId) > 0 {
+		writeJournalField(buf, "SYSLOG_MSGID", m.MsgId)
+	}
+	props := m.GetAllProperties()
+	domains := make([]string, 0, len(props))
+	for domain := range props {
+		if domain != "skewer" {
+			domains = append(domains, domain)
+		}
+	}
+	sort.Strings(domains)
+	for _, domain := range domains {
+		for param, value := range props[domain] {
+			name := journalFieldName(domain + "_" + param)
+			if len(name) > 0 {
+				writeJournalField(buf, name, value)
+			}
+		}
+	}
+}
+
+func (d *JournalDestination) sendOne(ctx context.Context, message *model.FullMessage) error {
+	if message.Fields == nil {
+		return nil
+	}
+	d.buf.Reset()
+	encodeJournalEntry(&d.buf, message.Fields)
+	_, err := d.conn.WriteToUnix(d.buf.Bytes(), d.addr)
+	if err == nil {
+		d.countSent("", d.buf.Len())
+		return nil
+	}
+	if !isMsgSize(err) {
+		return eerrors.Wrap(err, "Failed to write to the journal")
+	}
+	// the entry is too large for a datagram: it is passed as a file descriptor
+	err = d.sendLarge(d.buf.Bytes())
+	if err != nil {
+		return eerrors.Wrap(err, "Failed to write a large entry to the journal")
+	}
+	d.countSent("", d.buf.Len())
+	return nil
+}
+
+func isMsgSize(err error) bool {
+	if opErr, ok := err.(*net.OpError); ok {
+		if sysErr, ok := opErr.Err.(*os.SyscallError); ok {
+			return sysErr.Err == syscall.EMSGSIZE || sysErr.Err == syscall.ENOBUFS
+		}
+	}
+	return false
+}
+
+// sendLarge writes the entry in an unlinked temporary file, and sends the
+// file descriptor to journald.
+func (d *JournalDestination) sendLarge(entry []byte) error {
+	f, err := ioutil.TempFile("/dev/shm", "skewer-journal-")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	err = os.Remove(f.Name())
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(entry)
+	if err != nil {
+		return err
+	}
+	rights := syscall.UnixRights(int(f.Fd()))
+	_, _, err = d.conn.WriteMsgUnix([]byte{}, rights, d.addr)
+	return err
+}
+
+func (d *JournalDestination) Send(ctx context.Context, msgs []model.OutputMsg) (err eerrors.ErrorSlice) {
+	return d.ForEach(ctx, d.sendOne, true, true, msgs)
+}
@@ -0,0 +1,13 @@
+// +build !linux nonsystemd
+
+package dests
+
+import (
+	"context"
+
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+func NewJournalDestination(ctx context.Context, e *Env) (Destination, error) {
+	return nil, eerrors.New("The journal destination is only available on Linux with systemd")
+}
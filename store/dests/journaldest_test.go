@@ -0,0 +1,181 @@
+// +build linux,!nonsystemd
+
+package dests
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils"
+)
+
+// decodeJournalEntry reads an entry of the journald native protocol, like
+// journald does.
+func decodeJournalEntry(t *testing.T, entry []byte) (names []string, fields map[string]string) {
+	fields = make(map[string]string)
+	for len(entry) > 0 {
+		eol := bytes.IndexByte(entry, '\n')
+		if eol == -1 {
+			t.Fatalf("unterminated field: %q", entry)
+		}
+		line := entry[:eol]
+		entry = entry[eol+1:]
+		var name, value string
+		if eq := bytes.IndexByte(line, '='); eq != -1 {
+			name, value = string(line[:eq]), string(line[eq+1:])
+		} else {
+			name = string(line)
+			if len(entry) < 8 {
+				t.Fatalf("%s: missing the value size", name)
+			}
+			size := binary.LittleEndian.Uint64(entry[:8])
+			entry = entry[8:]
+			if uint64(len(entry)) < size+1 || entry[size] != '\n' {
+				t.Fatalf("%s: invalid binary value", name)
+			}
+			value = string(entry[:size])
+			entry = entry[size+1:]
+		}
+		if _, ok := fields[name]; ok {
+			t.Fatalf("duplicate field %s", name)
+		}
+		names = append(names, name)
+		fields[name] = value
+	}
+	return names, fields
+}
+
+func TestJournalFieldName(t *testing.T) {
+	tests := map[string]string{
+		"origin_ip":              "ORIGIN_IP",
+		"meta@32473_sequenceId":  "META_32473_SEQUENCEID",
+		"_private":               "PRIVATE",
+		"__x":                    "X",
+		"123_abc":                "F123_ABC",
+		"été":                    "T_",
+		"___":                    "",
+		strings.Repeat("a", 100): strings.Repeat("A", 64),
+	}
+	for name, expected := range tests {
+		if n := journalFieldName(name); n != expected {
+			t.Errorf("'%s': expected '%s', got '%s'", name, expected, n)
+		}
+	}
+}
+
+func TestEncodeJournalEntry(t *testing.T) {
+	m := model.Factory()
+	defer model.Free(m)
+	m.Message = "first line\nsecond line"
+	m.Severity = model.Severity(3)
+	m.Facility = model.Facility(4)
+	m.AppName = "app"
+	m.ProcId = "42"
+	m.HostName = "host"
+	m.MsgId = "ID7"
+	m.SetProperty("origin", "ip", "10.0.0.1")
+	m.SetProperty("meta", "multi", "a\nb")
+	// the skewer domain is internal
+	m.SetProperty("skewer", "client", "127.0.0.1")
+
+	var buf bytes.Buffer
+	encodeJournalEntry(&buf, m)
+	names, fields := decodeJournalEntry(t, buf.Bytes())
+
+	expected := map[string]string{
+		"MESSAGE":           "first line\nsecond line",
+		"PRIORITY":          "3",
+		"SYSLOG_FACILITY":   "4",
+		"SYSLOG_IDENTIFIER": "app",
+		"SYSLOG_PID":        "42",
+		"SYSLOG_HOSTNAME":   "host",
+		"SYSLOG_MSGID":      "ID7",
+		"ORIGIN_IP":         "10.0.0.1",
+		"META_MULTI":        "a\nb",
+	}
+	if len(fields) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, fields)
+	}
+	for name, value := range expected {
+		if fields[name] != value {
+			t.Errorf("%s: expected %q, got %q", name, value, fields[name])
+		}
+	}
+	if names[0] != "MESSAGE" {
+		t.Errorf("MESSAGE should come first: %v", names)
+	}
+
+	// the empty fields are not written
+	m = model.Factory()
+	defer model.Free(m)
+	m.Message = "hello"
+	buf.Reset()
+	encodeJournalEntry(&buf, m)
+	if buf.String() != "MESSAGE=hello\nPRIORITY=0\nSYSLOG_FACILITY=0\n" {
+		t.Errorf("unexpected entry: %q", buf.String())
+	}
+}
+
+func TestJournalDestinationSend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "skewer-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "socket")
+	journald, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = journald.Close() }()
+
+	InitRegistry()
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	var acks []utils.MyULID
+	ack := func(uid utils.MyULID, dest conf.DestinationType) { acks = append(acks, uid) }
+	nack := func(uid utils.MyULID, dest conf.DestinationType) { t.Errorf("unexpected NACK") }
+	c := conf.BaseConfig{}
+	c.JournalDest.SocketPath = path
+	e := BuildEnv().Logger(logger).Callbacks(ack, nack, nack).Config(c)
+	d, err := NewJournalDestination(context.Background(), e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = d.Close() }()
+
+	msg := model.FullFactory()
+	msg.Uid = utils.NewUid()
+	uid := msg.Uid
+	msg.Fields.Message = "hello journal"
+	msg.Fields.AppName = "app"
+	errs := d.Send(context.Background(), []model.OutputMsg{{Message: msg}})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if len(acks) != 1 || acks[0] != uid {
+		t.Fatalf("the message was not ACKed: %v", acks)
+	}
+
+	_ = journald.SetReadDeadline(time.Now().Add(5 * time.Second))
+	datagram := make([]byte, 65536)
+	n, _, err := journald.ReadFromUnix(datagram)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, fields := decodeJournalEntry(t, datagram[:n])
+	if fields["MESSAGE"] != "hello journal" || fields["SYSLOG_IDENTIFIER"] != "app" {
+		t.Fatalf("unexpected entry: %v", fields)
+	}
+}
@@ -2,6 +2,8 @@ package dests
 
 import (
 	"context"
+	"hash/fnv"
+	"strconv"
 	"sync"
 
 	sarama "github.com/Shopify/sarama"
@@ -10,42 +12,117 @@ import (
 	"github.com/stephane-martin/skewer/model"
 	"github.com/stephane-martin/skewer/utils"
 	"github.com/stephane-martin/skewer/utils/eerrors"
+	"github.com/stephane-martin/skewer/utils/recenterrors"
 	"github.com/valyala/bytebufferpool"
+	"go.uber.org/atomic"
 )
 
 type KafkaDestination struct {
 	*baseDestination
-	producer   sarama.AsyncProducer
-	collectors []prometheus.Collector
-	wg         sync.WaitGroup
+	// producers are the Kafka producers, each with its own connections. The
+	// messages of a partition key are always sent by the same producer.
+	producers      []sarama.AsyncProducer
+	clients        []sarama.Client
+	partitions     *utils.PartitionCounts
+	stopRefresh    chan struct{}
+	manual         bool
+	next           atomic.Uint32
+	collectors     []prometheus.Collector
+	unregistered   chan struct{}
+	wg             sync.WaitGroup
+	keySDID        string
+	keySDParam     string
+	sdHeaders      []conf.KafkaSDHeaderConfig
+	timestamp      string
+	retriesHeader  string
+	checksumHeader string
 }
 
 func NewKafkaDestination(ctx context.Context, e *Env) (Destination, error) {
 	d := &KafkaDestination{
 		baseDestination: newBaseDestination(conf.Kafka, "kafka", e),
+		manual:          e.config.KafkaDest.Partitioner == "manual",
+		keySDID:         e.config.KafkaDest.KeySDID,
+		keySDParam:      e.config.KafkaDest.KeySDParam,
+		sdHeaders:       e.config.KafkaDest.SDHeaders,
+		timestamp:       e.config.KafkaDest.TimestampSource,
+		retriesHeader:   e.config.KafkaDest.RetriesHeader,
+		checksumHeader:  e.config.KafkaDest.ChecksumHeader,
+		unregistered:    make(chan struct{}),
+		stopRefresh:     make(chan struct{}),
 	}
-	err := d.setFormat(e.config.KafkaDest.Format)
+	err := d.setFormat(e.config.KafkaDest.Format, e.config.KafkaDest.JSONOutputConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	producer, registry, err := e.config.KafkaDest.GetAsyncProducer(e.confined)
-	if err != nil {
-		connCounter.WithLabelValues("kafka", "fail").Inc()
-		return nil, err
+	n := e.config.KafkaDest.Producers
+	if n <= 0 {
+		n = 1
+	}
+	for i := 0; i < n; i++ {
+		producer, client, registry, err := e.config.KafkaDest.GetAsyncProducerClient(e.confined)
+		if err != nil {
+			connCounter.WithLabelValues("kafka", "fail").Inc()
+			for i, p := range d.producers {
+				_ = p.Close()
+				_ = d.clients[i].Close()
+			}
+			return nil, err
+		}
+		// we've got a kafka client
+		d.producers = append(d.producers, producer)
+		d.clients = append(d.clients, client)
+		// record the success
+		connCounter.WithLabelValues("kafka", "success").Inc()
+		// register the kafka client metrics
+		labels := prometheus.Labels{"producer": strconv.Itoa(i)}
+		d.collectors = append(d.collectors, utils.KafkaProducerMetrics(registry, "skw_dest_kafka", labels)...)
+		d.collectors = append(d.collectors, prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Help:        "number of messages waiting in the input channel of the Kafka producer",
+				ConstLabels: labels,
+				Name:        "skw_dest_kafka_producer_input_depth",
+			},
+			func() float64 {
+				return float64(len(producer.Input()))
+			},
+		))
+		d.handle(producer)
 	}
-	// we've got a kafka client
-	d.producer = producer
-	// record the success
-	connCounter.WithLabelValues("kafka", "success").Inc()
-	// register the kafka client metrics
-	d.collectors = utils.KafkaProducerMetrics(registry, "skw_dest_kafka")
 	Registry.MustRegister(d.collectors...)
 
+	clients := make([]utils.PartitionsClient, 0, len(d.clients))
+	for _, client := range d.clients {
+		clients = append(clients, client)
+	}
+	d.partitions = utils.NewPartitionCounts(d.logger, clients...)
+	d.wg.Add(1)
+	go func() {
+		d.partitions.Run(e.config.KafkaDest.PartitionRefreshInterval, d.stopRefresh)
+		d.wg.Done()
+	}()
+
+	// unregister metrics when the clients have finished all operations
+	go func() {
+		d.wg.Wait()
+		for _, collector := range d.collectors {
+			Registry.Unregister(collector)
+		}
+		d.collectors = nil
+		close(d.unregistered)
+	}()
+
+	return d, nil
+}
+
+// handle processes the acks and the errors of a producer. The message UID is
+// carried by the Kafka message metadata.
+func (d *KafkaDestination) handle(producer sarama.AsyncProducer) {
 	// process the kafka acks
 	d.wg.Add(1)
 	go func() {
-		for m := range d.producer.Successes() {
+		for m := range producer.Successes() {
 			d.ACK(m.Metadata.(utils.MyULID))
 		}
 		d.wg.Done()
@@ -54,55 +131,139 @@ func NewKafkaDestination(ctx context.Context, e *Env) (Destination, error) {
 	// process the kafka errors
 	d.wg.Add(1)
 	go func() {
-		for m := range d.producer.Errors() {
+		for m := range producer.Errors() {
 			d.NACK(m.Msg.Metadata.(utils.MyULID))
+			d.errLogger.Info("NACK from Kafka", "error", m.Error(), "topic", m.Msg.Topic)
+			recenterrors.Add("kafka", recenterrors.Nack, m)
 			if model.IsFatalKafkaError(m.Err) {
 				d.dofatal(eerrors.Wrap(m.Err, "Kafka fatal error"))
 			}
 		}
 		d.wg.Done()
 	}()
+}
 
-	// unregister metrics when the client has finished all operations
-	go func() {
-		d.wg.Wait()
-		for _, collector := range d.collectors {
-			Registry.Unregister(collector)
+func (d *KafkaDestination) key(message *model.FullMessage, pKey string) string {
+	if len(d.keySDID) > 0 {
+		if key := message.Fields.GetProperty(d.keySDID, d.keySDParam); len(key) > 0 {
+			return key
 		}
-		d.collectors = nil
-	}()
+	}
+	return pKey
+}
 
-	return d, nil
+// shard returns the index of the producer for the given partition key. With
+// the manual partitioner, the partition number is used instead. The messages
+// without a key are spread among the producers.
+func (d *KafkaDestination) shard(pKey string, pNumber int32) int {
+	n := len(d.producers)
+	if n == 1 {
+		return 0
+	}
+	if d.manual {
+		return int(uint32(pNumber) % uint32(n))
+	}
+	if len(pKey) == 0 {
+		return int(d.next.Inc() % uint32(n))
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(pKey))
+	return int(h.Sum32() % uint32(n))
+}
+
+// PartitionCount returns the last known number of partitions of topic, or 0
+// when it is not known.
+func (d *KafkaDestination) PartitionCount(topic string) int32 {
+	return d.partitions.Get(topic)
 }
 
 func (d *KafkaDestination) sendOne(ctx context.Context, message *model.FullMessage, topic, pKey string, pNumber int32) (err error) {
+	pKey = d.key(message, pKey)
+	return d.sendTo(d.producers[d.shard(pKey, pNumber)], message, topic, pKey, pNumber)
+}
+
+func (d *KafkaDestination) sendTo(producer sarama.AsyncProducer, message *model.FullMessage, topic, pKey string, pNumber int32) (err error) {
 	buf := bytebufferpool.Get()
 	err = d.encoder(message, buf)
 	if err != nil {
 		bytebufferpool.Put(buf)
 		return err
 	}
+	headers := message.KafkaHeaders(d.sdHeaders)
+	if len(d.retriesHeader) > 0 && message.Retries > 0 {
+		headers = append(headers, sarama.RecordHeader{
+			Key:   []byte(d.retriesHeader),
+			Value: []byte(strconv.FormatInt(int64(message.Retries), 10)),
+		})
+	}
+	if len(d.checksumHeader) > 0 && len(message.Checksum) > 0 {
+		headers = append(headers, sarama.RecordHeader{
+			Key:   []byte(d.checksumHeader),
+			Value: []byte(message.Checksum),
+		})
+	}
 	// we use buf.String() to get a copy of the buffer, so that we can push back the buffer to the pool
 	kafkaMsg := &sarama.ProducerMessage{
 		Key:       sarama.StringEncoder(pKey),
 		Partition: pNumber,
 		Value:     sarama.StringEncoder(buf.String()),
 		Topic:     topic,
-		Timestamp: message.Fields.GetTimeReported(),
+		Timestamp: message.Timestamp(d.timestamp),
 		Metadata:  message.Uid,
+		Headers:   headers,
 	}
+	size := buf.Len()
 	bytebufferpool.Put(buf)
-	d.producer.Input() <- kafkaMsg
+	producer.Input() <- kafkaMsg
 	kafkaInputsCounter.Inc()
+	d.countSent(topic, size)
 	return nil
 }
 
 func (d *KafkaDestination) Close() error {
-	d.producer.AsyncClose()
+	close(d.stopRefresh)
+	for _, producer := range d.producers {
+		producer.AsyncClose()
+	}
 	d.wg.Wait()
+	// the producers do not close the clients they were built from
+	for _, client := range d.clients {
+		_ = client.Close()
+	}
+	<-d.unregistered
 	return nil
 }
 
 func (d *KafkaDestination) Send(ctx context.Context, msgs []model.OutputMsg) (err eerrors.ErrorSlice) {
-	return d.ForEachWithTopic(ctx, d.sendOne, false, true, msgs)
+	if len(d.producers) == 1 {
+		return d.ForEachWithTopic(ctx, d.sendOne, false, true, msgs)
+	}
+	// one worker per producer: the messages are encoded and sent in
+	// parallel, while the order of the messages of a key is kept
+	shards := make([][]model.OutputMsg, len(d.producers))
+	for _, msg := range msgs {
+		msg.PartitionKey = d.key(msg.Message, msg.PartitionKey)
+		i := d.shard(msg.PartitionKey, msg.PartitionNumber)
+		shards[i] = append(shards[i], msg)
+	}
+	c := eerrors.ChainErrors()
+	var wg sync.WaitGroup
+	for i := range shards {
+		if len(shards[i]) == 0 {
+			continue
+		}
+		producer := d.producers[i]
+		send := func(ctx context.Context, message *model.FullMessage, topic, pKey string, pNumber int32) error {
+			return d.sendTo(producer, message, topic, pKey, pNumber)
+		}
+		wg.Add(1)
+		go func(shard []model.OutputMsg) {
+			if errs := d.ForEachWithTopic(ctx, send, false, true, shard); !errs.Empty() {
+				c.Append(errs)
+			}
+			wg.Done()
+		}(shards[i])
+	}
+	wg.Wait()
+	return c.Sum()
 }
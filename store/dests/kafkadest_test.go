@@ -0,0 +1,227 @@
+package dests
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	sarama "github.com/Shopify/sarama"
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils"
+	"go.uber.org/atomic"
+)
+
+// kafkaAcks records the messages acknowledged by a Kafka destination.
+type kafkaAcks struct {
+	mu    sync.Mutex
+	acks  map[utils.MyULID]int
+	count atomic.Int64
+	nacks atomic.Int64
+}
+
+func newMockKafka(t sarama.TestReporter, topic string) *sarama.MockBroker {
+	broker := sarama.NewMockBroker(t, 1)
+	setMockKafkaPartitions(t, broker, topic, 4)
+	return broker
+}
+
+// setMockKafkaPartitions sets the number of partitions of topic in the
+// metadata returned by the mock broker.
+func setMockKafkaPartitions(t sarama.TestReporter, broker *sarama.MockBroker, topic string, partitions int32) {
+	metadata := sarama.NewMockMetadataResponse(t).SetBroker(broker.Addr(), broker.BrokerID())
+	for p := int32(0); p < partitions; p++ {
+		metadata.SetLeader(topic, p, broker.BrokerID())
+	}
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": metadata,
+		// the default Kafka version 0.10.1 uses the version 2 of the protocol
+		"ProduceRequest": sarama.NewMockProduceResponse(t).SetVersion(2),
+	})
+}
+
+func newTestKafkaDestination(t sarama.TestReporter, broker *sarama.MockBroker, producers int, acks *kafkaAcks, configure ...func(*conf.KafkaDestConfig)) *KafkaDestination {
+	InitRegistry()
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	c, err := conf.Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.KafkaDest.Brokers = []string{broker.Addr()}
+	c.KafkaDest.Producers = producers
+	c.KafkaDest.FlushFrequency = 10 * time.Millisecond
+	for _, f := range configure {
+		f(c.KafkaDest)
+	}
+	ack := func(uid utils.MyULID, dest conf.DestinationType) {
+		if acks.acks != nil {
+			acks.mu.Lock()
+			acks.acks[uid]++
+			acks.mu.Unlock()
+		}
+		acks.count.Inc()
+	}
+	nack := func(uid utils.MyULID, dest conf.DestinationType) {
+		acks.nacks.Inc()
+	}
+	e := BuildEnv().Logger(logger).Callbacks(ack, nack, nack).Config(c)
+	d, err := NewKafkaDestination(context.Background(), e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d.(*KafkaDestination)
+}
+
+func kafkaBatch(gen *utils.Generator, topic string, n int) []model.OutputMsg {
+	msgs := make([]model.OutputMsg, 0, n)
+	for i := 0; i < n; i++ {
+		m := model.FullFactory()
+		m.Uid = gen.Uid()
+		m.Fields.AppName = "bench"
+		m.Fields.Message = "a message sent to kafka"
+		msgs = append(msgs, model.OutputMsg{Message: m, Topic: topic, PartitionKey: m.Uid.String()})
+	}
+	return msgs
+}
+
+func waitAcks(t sarama.TestReporter, acks *kafkaAcks, n int64) {
+	deadline := time.Now().Add(30 * time.Second)
+	for acks.count.Load()+acks.nacks.Load() < n {
+		if time.Now().After(deadline) {
+			t.Errorf("timeout: %d acks and %d nacks for %d messages", acks.count.Load(), acks.nacks.Load(), n)
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestKafkaShardedAcks(t *testing.T) {
+	broker := newMockKafka(t, "skewer")
+	defer broker.Close()
+	acks := &kafkaAcks{acks: map[utils.MyULID]int{}}
+	d := newTestKafkaDestination(t, broker, 4, acks)
+	gen := utils.NewGenerator()
+	var uids []utils.MyULID
+	for i := 0; i < 10; i++ {
+		msgs := kafkaBatch(gen, "skewer", 100)
+		for _, msg := range msgs {
+			uids = append(uids, msg.Message.Uid)
+		}
+		if err := d.Send(context.Background(), msgs); !err.Empty() {
+			t.Fatal(err)
+		}
+	}
+	waitAcks(t, acks, int64(len(uids)))
+	_ = d.Close()
+	if acks.nacks.Load() != 0 {
+		t.Errorf("%d messages were not acknowledged", acks.nacks.Load())
+	}
+	if len(acks.acks) != len(uids) {
+		t.Errorf("expected %d acknowledged messages, got %d", len(uids), len(acks.acks))
+	}
+	for _, uid := range uids {
+		if acks.acks[uid] != 1 {
+			t.Errorf("message %s was acknowledged %d times", uid, acks.acks[uid])
+		}
+	}
+}
+
+func TestKafkaShard(t *testing.T) {
+	d := &KafkaDestination{producers: make([]sarama.AsyncProducer, 4)}
+	if d.shard("key", 0) != d.shard("key", 3) {
+		t.Error("the messages of a key should be sent by the same producer")
+	}
+	seen := map[int]bool{}
+	for i := 0; i < 8; i++ {
+		seen[d.shard("", 0)] = true
+	}
+	if len(seen) != 4 {
+		t.Errorf("the messages without a key should be spread among the producers: %v", seen)
+	}
+	d.manual = true
+	if d.shard("key", 1) == d.shard("key", 2) {
+		t.Error("with the manual partitioner, the partition number selects the producer")
+	}
+}
+
+func TestKafkaPartitionRefresh(t *testing.T) {
+	broker := newMockKafka(t, "skewer")
+	defer broker.Close()
+	acks := &kafkaAcks{}
+	d := newTestKafkaDestination(t, broker, 1, acks, func(c *conf.KafkaDestConfig) {
+		c.Partitioner = "manual"
+		c.PartitionOverflow = "error"
+		c.PartitionRefreshInterval = 20 * time.Millisecond
+	})
+	defer func() { _ = d.Close() }()
+	gen := utils.NewGenerator()
+	send := func() {
+		msgs := kafkaBatch(gen, "skewer", 1)
+		msgs[0].PartitionNumber = 6
+		if err := d.Send(context.Background(), msgs); !err.Empty() {
+			t.Fatal(err)
+		}
+	}
+
+	// the partition 6 does not exist yet
+	send()
+	waitAcks(t, acks, 1)
+	if acks.nacks.Load() != 1 {
+		t.Fatal("the message to a missing partition should fail")
+	}
+	// the partition functions ask for the count of the topic
+	deadline := time.Now().Add(10 * time.Second)
+	for d.PartitionCount("skewer") != 4 {
+		if time.Now().After(deadline) {
+			t.Fatalf("the partition count was not fetched: %d", d.PartitionCount("skewer"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	setMockKafkaPartitions(t, broker, "skewer", 8)
+	deadline = time.Now().Add(10 * time.Second)
+	for d.PartitionCount("skewer") != 8 {
+		if time.Now().After(deadline) {
+			t.Fatalf("the partition count was not refreshed: %d", d.PartitionCount("skewer"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	send()
+	waitAcks(t, acks, 2)
+	if acks.count.Load() != 1 {
+		t.Fatal("the message should be sent to the new partition")
+	}
+}
+
+func benchmarkKafkaProducers(b *testing.B, producers int) {
+	broker := newMockKafka(b, "skewer")
+	defer broker.Close()
+	acks := &kafkaAcks{}
+	d := newTestKafkaDestination(b, broker, producers, acks)
+	gen := utils.NewGenerator()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for sent := 0; sent < b.N; sent += 1000 {
+		n := b.N - sent
+		if n > 1000 {
+			n = 1000
+		}
+		if err := d.Send(context.Background(), kafkaBatch(gen, "skewer", n)); !err.Empty() {
+			b.Fatal(err)
+		}
+	}
+	waitAcks(b, acks, int64(b.N))
+	b.StopTimer()
+	_ = d.Close()
+}
+
+func BenchmarkKafkaSingleProducer(b *testing.B) {
+	benchmarkKafkaProducers(b, 1)
+}
+
+func BenchmarkKafkaShardedProducers(b *testing.B) {
+	benchmarkKafkaProducers(b, 4)
+}
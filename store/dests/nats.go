@@ -22,7 +22,7 @@ func NewNATSDestination(ctx context.Context, e *Env) (Destination, error) {
 	d := &NATSDestination{
 		baseDestination: newBaseDestination(conf.NATS, "nats", e),
 	}
-	err := d.setFormat(config.Format)
+	err := d.setFormat(config.Format, config.JSONOutputConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -91,7 +91,11 @@ func (d *NATSDestination) sendOne(ctx context.Context, msg *model.FullMessage, t
 		return err
 	}
 	// we use buf.String() to get a copy of buf, so that we can release buf afterwards
-	return d.conn.Publish(topic, []byte(buf.String()))
+	err = d.conn.Publish(topic, []byte(buf.String()))
+	if err == nil {
+		d.countSent(topic, buf.Len())
+	}
+	return err
 }
 
 func (d *NATSDestination) Send(ctx context.Context, msgs []model.OutputMsg) (err eerrors.ErrorSlice) {
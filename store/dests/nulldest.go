@@ -0,0 +1,34 @@
+package dests
+
+import (
+	"context"
+
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// NullDestination ACKs the messages but never sends them.
+type NullDestination struct {
+	*baseDestination
+}
+
+func NewNullDestination(ctx context.Context, e *Env) (Destination, error) {
+	d := &NullDestination{
+		baseDestination: newBaseDestination(conf.Null, "null", e),
+	}
+	return d, nil
+}
+
+func (d *NullDestination) sendOne(ctx context.Context, message *model.FullMessage) error {
+	CountDiscarded(conf.Null)
+	return nil
+}
+
+func (d *NullDestination) Close() error {
+	return nil
+}
+
+func (d *NullDestination) Send(ctx context.Context, msgs []model.OutputMsg) (err eerrors.ErrorSlice) {
+	return d.ForEach(ctx, d.sendOne, true, true, msgs)
+}
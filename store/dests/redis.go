@@ -23,7 +23,7 @@ func NewRedisDestination(ctx context.Context, e *Env) (Destination, error) {
 	d := &RedisDestination{
 		baseDestination: newBaseDestination(conf.Elasticsearch, "elasticsearch", e),
 	}
-	err := d.setFormat(config.Format)
+	err := d.setFormat(config.Format, config.JSONOutputConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -78,6 +78,9 @@ func (d *RedisDestination) sendOne(ctx context.Context, msg *model.FullMessage,
 		return err
 	}
 	_, err = d.client.RPush(topic, []byte(buf)).Result()
+	if err == nil {
+		d.countSent(topic, len(buf))
+	}
 	return err
 }
 
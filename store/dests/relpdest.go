@@ -21,7 +21,7 @@ func NewRELPDestination(ctx context.Context, e *Env) (Destination, error) {
 	d := &RELPDestination{
 		baseDestination: newBaseDestination(conf.RELP, "relp", e),
 	}
-	err := d.setFormat(e.config.RELPDest.Format)
+	err := d.setFormat(e.config.RELPDest.Format, e.config.RELPDest.JSONOutputConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -35,7 +35,8 @@ func NewRELPDestination(ctx context.Context, e *Env) (Destination, error) {
 		ConnTimeout(e.config.RELPDest.ConnTimeout).
 		RelpTimeout(e.config.RELPDest.RelpTimeout).
 		WindowSize(e.config.RELPDest.WindowSize).
-		FlushPeriod(e.config.RELPDest.FlushPeriod)
+		FlushPeriod(e.config.RELPDest.FlushPeriod).
+		OnSent(d.countSentFunc())
 
 	if e.config.RELPDest.TLSEnabled {
 		config, err := utils.NewTLSConfig(
@@ -20,7 +20,7 @@ func NewStderrDestination(ctx context.Context, e *Env) (Destination, error) {
 	d := &StderrDestination{
 		baseDestination: newBaseDestination(conf.Stderr, "stderr", e),
 	}
-	err := d.setFormat(e.config.StderrDest.Format)
+	err := d.setFormat(e.config.StderrDest.Format, e.config.StderrDest.JSONOutputConfig)
 	if err != nil {
 		return nil, fmt.Errorf("Error getting encoder: %s", err)
 	}
@@ -35,6 +35,9 @@ func (d *StderrDestination) sendOne(ctx context.Context, message *model.FullMess
 		return err
 	}
 	_, err = io.WriteString(os.Stderr, buf)
+	if err == nil {
+		d.countSent("", len(buf))
+	}
 	return err
 }
 
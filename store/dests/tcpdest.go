@@ -17,13 +17,38 @@ type TCPDestination struct {
 	*baseDestination
 	previousUid utils.MyULID
 	clt         *clients.SyslogTCPClient
+	durability  string
+	syncTimeout time.Duration
+}
+
+// tcpSyncer flushes and syncs the TCP client at the end of a durable batch.
+type tcpSyncer struct {
+	ctx     context.Context
+	clt     *clients.SyslogTCPClient
+	timeout time.Duration
+}
+
+func (s tcpSyncer) Flush() error {
+	return s.clt.Flush()
+}
+
+func (s tcpSyncer) Sync() error {
+	ctx := s.ctx
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	return s.clt.WaitSent(ctx)
 }
 
 func NewTCPDestination(ctx context.Context, e *Env) (Destination, error) {
 	d := &TCPDestination{
 		baseDestination: newBaseDestination(conf.TCP, "tcp", e),
+		durability:      e.config.TCPDest.Durability,
+		syncTimeout:     e.config.TCPDest.ConnTimeout,
 	}
-	err := d.setFormat(e.config.TCPDest.Format)
+	err := d.setFormat(e.config.TCPDest.Format, e.config.TCPDest.JSONOutputConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -37,7 +62,8 @@ func NewTCPDestination(ctx context.Context, e *Env) (Destination, error) {
 		LineFraming(e.config.TCPDest.LineFraming).
 		FrameDelimiter(e.config.TCPDest.FrameDelimiter).
 		ConnTimeout(e.config.TCPDest.ConnTimeout).
-		FlushPeriod(e.config.TCPDest.FlushPeriod)
+		FlushPeriod(e.config.TCPDest.FlushPeriod).
+		OnSent(d.countSentFunc())
 
 	if e.config.TCPDest.TLSEnabled {
 		config, err := utils.NewTLSConfig(
@@ -108,6 +134,9 @@ func (d *TCPDestination) Close() error {
 }
 
 func (d *TCPDestination) Send(ctx context.Context, msgs []model.OutputMsg) (err eerrors.ErrorSlice) {
+	if d.durability != conf.DurabilityNone {
+		return d.sendDurable(ctx, msgs)
+	}
 	var msg *model.FullMessage
 	var curErr error
 	c := eerrors.ChainErrors()
@@ -128,3 +157,32 @@ func (d *TCPDestination) Send(ctx context.Context, msgs []model.OutputMsg) (err
 	}
 	return c.Sum()
 }
+
+// sendDurable sends the messages, and ACKs them after the client has been
+// flushed, or after the peer has acknowledged them with the "sync"
+// durability.
+func (d *TCPDestination) sendDurable(ctx context.Context, msgs []model.OutputMsg) (err eerrors.ErrorSlice) {
+	batch := newDurableBatch(d.durability)
+	output := tcpSyncer{ctx: ctx, clt: d.clt, timeout: d.syncTimeout}
+	failed := false
+	err = d.ForEach(ctx, func(ctx context.Context, message *model.FullMessage) error {
+		serr := d.clt.Send(ctx, message)
+		if serr == nil {
+			batch.add(message.Uid, output)
+		} else if !IsEncodingError(serr) {
+			failed = true
+		}
+		return serr
+	}, false, true, msgs)
+	if failed {
+		// the failed and the remaining messages have been NACKed by ForEach
+		d.abort(batch)
+		return err
+	}
+	cerr := d.commit(batch)
+	if cerr != nil {
+		d.dofatal(cerr)
+		err = append(err, cerr)
+	}
+	return err
+}
@@ -19,7 +19,7 @@ func NewUDPDestination(ctx context.Context, e *Env) (Destination, error) {
 	d := &UDPDestination{
 		baseDestination: newBaseDestination(conf.UDP, "udp", e),
 	}
-	err := d.setFormat(e.config.UDPDest.Format)
+	err := d.setFormat(e.config.UDPDest.Format, e.config.UDPDest.JSONOutputConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -27,7 +27,8 @@ func NewUDPDestination(ctx context.Context, e *Env) (Destination, error) {
 		Host(e.config.UDPDest.Host).
 		Port(e.config.UDPDest.Port).
 		Path(e.config.UDPDest.UnixSocketPath).
-		Format(d.format)
+		Format(d.format).
+		OnSent(d.countSentFunc())
 
 	err = client.Connect()
 	if err != nil {
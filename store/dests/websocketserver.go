@@ -46,7 +46,7 @@ func NewWebsocketServerDestination(ctx context.Context, e *Env) (Destination, er
 		connections:     make(map[*websocket.Conn]bool),
 		stopchan:        ctx.Done(),
 	}
-	err := d.setFormat(config.Format)
+	err := d.setFormat(config.Format, config.JSONOutputConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -186,13 +186,15 @@ func (d *WebsocketServerDestination) writeLogs(wsconn *websocket.Conn) (err erro
 			}
 
 			wsconn.SetWriteDeadline(time.Now().Add(writeWait))
-			err = d.encoder(message, writer)
+			counter := &countingWriter{w: writer}
+			err = d.encoder(message, counter)
 			model.FullFree(message)
 			if err == nil {
 				// flush the ws buffer
 				err = writer.Close()
 				writer = nil
 				if err == nil {
+					d.countSent("", counter.n)
 					d.ACK(uid)
 				} else {
 					// error when flushing
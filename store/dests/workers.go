@@ -0,0 +1,126 @@
+package dests
+
+import (
+	"context"
+	"hash/fnv"
+	"strconv"
+	"sync"
+
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+	"github.com/stephane-martin/skewer/utils/queue/output"
+)
+
+type workerFunc func(ctx context.Context, msg *model.OutputMsg) error
+
+// keyedWorkers dispatches the messages to a fixed number of workers. Messages
+// that share the same key are always handled by the same worker, so they are
+// delivered in order, while messages with different keys are processed in
+// parallel.
+type keyedWorkers struct {
+	queues []*output.Ring
+	wg     sync.WaitGroup
+}
+
+func workerKey(msg *model.OutputMsg) string {
+	if len(msg.PartitionKey) > 0 {
+		return msg.PartitionKey
+	}
+	// by default, preserve the ordering per sending host
+	return msg.Message.Fields.HostName
+}
+
+func (w *keyedWorkers) queueFor(msg *model.OutputMsg) *output.Ring {
+	if len(w.queues) == 1 {
+		return w.queues[0]
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(workerKey(msg)))
+	return w.queues[h.Sum32()%uint32(len(w.queues))]
+}
+
+// startWorkers starts n workers that call f for each dispatched message.
+// The workers NACK or PermError the messages when f fails, ACK them when f
+// succeeds and ackf is true, and free them afterwards.
+func (base *baseDestination) startWorkers(ctx context.Context, n int, qsize uint64, f workerFunc, ackf bool) {
+	if n <= 0 {
+		n = 1
+	}
+	if qsize == 0 {
+		qsize = 1024
+	}
+	w := &keyedWorkers{queues: make([]*output.Ring, 0, n)}
+	for i := 0; i < n; i++ {
+		w.queues = append(w.queues, output.NewRing(qsize))
+	}
+	base.workers = w
+	for i, q := range w.queues {
+		w.wg.Add(1)
+		go func(name string, q *output.Ring) {
+			defer w.wg.Done()
+			gauge := workerQueueGauge.WithLabelValues(base.codename, name)
+			for !q.IsDisposed() {
+				msg, err := q.Get()
+				if err != nil || msg == nil {
+					return
+				}
+				gauge.Set(float64(q.Len()))
+				uid := msg.Message.Uid
+				err = f(ctx, msg)
+				if err == nil {
+					base.ordering.Check(msg.Message)
+				}
+				model.FullFree(msg.Message)
+				if err == nil {
+					if ackf {
+						base.ACK(uid)
+					}
+				} else if IsEncodingError(err) {
+					base.PermError(uid)
+				} else {
+					base.NACK(uid)
+					base.dofatal(err)
+				}
+			}
+		}(strconv.FormatInt(int64(i), 10), q)
+	}
+}
+
+// dispatch sends the messages to the workers queues.
+func (base *baseDestination) dispatch(msgs []model.OutputMsg) eerrors.ErrorSlice {
+	c := eerrors.ChainErrors()
+	for i := range msgs {
+		msg := msgs[i]
+		err := base.workers.queueFor(&msg).Put(&msg)
+		if err != nil {
+			c.Append(err)
+			base.NACK(msg.Message.Uid)
+			model.FullFree(msg.Message)
+		}
+	}
+	return c.Sum()
+}
+
+// stopWorkers waits for the workers to finish their current message, and
+// NACKs the messages that are still waiting in the queues.
+func (base *baseDestination) stopWorkers() {
+	w := base.workers
+	if w == nil {
+		return
+	}
+	for _, q := range w.queues {
+		q.Dispose()
+	}
+	w.wg.Wait()
+	for i, q := range w.queues {
+		for {
+			msg, err := q.Get()
+			if err != nil || msg == nil {
+				break
+			}
+			base.NACK(msg.Message.Uid)
+			model.FullFree(msg.Message)
+		}
+		workerQueueGauge.WithLabelValues(base.codename, strconv.FormatInt(int64(i), 10)).Set(0)
+	}
+}
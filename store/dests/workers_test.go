@@ -0,0 +1,74 @@
+package dests
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils"
+)
+
+func TestKeyedWorkersOrdering(t *testing.T) {
+	const nbKeys = 16
+	const nbMsgs = 100
+
+	var events []string
+	d := newTestDestination(&events)
+	var mu sync.Mutex
+	delivered := make(map[string][]int)
+	total := 0
+	// the messages are not ACKed by the workers, so that the events are not
+	// appended concurrently
+	d.startWorkers(context.Background(), 4, 8, func(ctx context.Context, msg *model.OutputMsg) error {
+		// the workers progress at different paces
+		time.Sleep(time.Duration(rand.Intn(100)) * time.Microsecond)
+		n, _ := strconv.Atoi(msg.Message.Fields.Message)
+		mu.Lock()
+		delivered[msg.PartitionKey] = append(delivered[msg.PartitionKey], n)
+		total++
+		mu.Unlock()
+		return nil
+	}, false)
+	defer d.stopWorkers()
+
+	for n := 0; n < nbMsgs; n++ {
+		msgs := make([]model.OutputMsg, 0, nbKeys)
+		for k := 0; k < nbKeys; k++ {
+			msg := model.FullFactoryFrom(model.Factory())
+			msg.Uid = utils.NewUid()
+			msg.Fields.Message = strconv.Itoa(n)
+			msgs = append(msgs, model.OutputMsg{Message: msg, PartitionKey: fmt.Sprintf("key-%d", k)})
+		}
+		if err := d.dispatch(msgs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		mu.Lock()
+		n := total
+		mu.Unlock()
+		if n == nbKeys*nbMsgs {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("only %d messages were delivered", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for key, ns := range delivered {
+		for i, n := range ns {
+			if n != i {
+				t.Fatalf("%s: the messages were delivered out of order: %v", key, ns)
+			}
+		}
+	}
+}
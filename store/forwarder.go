@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/inconshreveable/log15"
 	"github.com/stephane-martin/skewer/conf"
@@ -13,11 +14,13 @@ import (
 	"github.com/stephane-martin/skewer/sys/binder"
 	"github.com/stephane-martin/skewer/utils"
 	"github.com/stephane-martin/skewer/utils/eerrors"
+	"github.com/stephane-martin/skewer/utils/logging"
 	"go.uber.org/atomic"
 )
 
 type Forwarder struct {
 	logger     log15.Logger
+	errLogger  log15.Logger
 	binder     binder.Client
 	once       sync.Once
 	store      *MessageStore
@@ -36,6 +39,7 @@ func NewForwarder(desttype conf.DestinationType, st *MessageStore, bc conf.BaseC
 		desttype: desttype,
 	}
 
+	f.errLogger = logging.RateLimited(f.logger, bc.Main.LogRateLimitWindow, bc.Main.LogRateLimitBurst)
 	return &f
 }
 
@@ -115,7 +119,7 @@ func (fwder *Forwarder) Forward(ctx context.Context) (err error) {
 			}
 			errs := fwder.fwdMsgs(ctx, messages, jsenvs, fwder.dest)
 			if errs != nil {
-				fwder.logger.Warn("Errors forwarding messages", "errors", errs)
+				fwder.errLogger.Warn("Errors forwarding messages", "errors", errs)
 			}
 		}
 	}
@@ -124,12 +128,19 @@ func (fwder *Forwarder) Forward(ctx context.Context) (err error) {
 func (fwder *Forwarder) fwdMsgs(ctx context.Context, msgs []*model.FullMessage, envs map[utils.MyULID]*javascript.Environment, dest dests.Destination) (err eerrors.ErrorSlice) {
 
 	i := int(0)
+	now := time.Now()
 
 Loop:
 	for _, m := range msgs {
 		if m == nil || m.Fields == nil {
 			continue Loop
 		}
+		if m.Expired(fwder.conf.Main.MaxMessageAge, now) {
+			// stale messages are neither delivered nor retried
+			fwder.store.ACK(m.Uid, fwder.desttype)
+			countExpired(fwder.desttype)
+			continue Loop
+		}
 		env, ok := envs[m.ConfId]
 		if !ok {
 			// create the environment for the javascript virtual machine
@@ -152,6 +163,12 @@ Loop:
 				config.PartitionNumberFunc,
 				fwder.logger,
 			)
+			envs[m.ConfId].SetLimits(javascript.Limits{
+				MaxStackDepth: fwder.conf.Main.JSMaxStackDepth,
+				MaxDuration:   fwder.conf.Main.JSMaxDuration,
+				MaxMemory:     fwder.conf.Main.JSMaxMemory,
+			})
+			envs[m.ConfId].SetQuarantineTopic(config.QuarantineTopic)
 			env = envs[m.ConfId]
 		}
 
@@ -159,8 +176,9 @@ Loop:
 		partitionKey := ""
 		partitionNumber := int32(0)
 		var joinedErr error
+		var killErr error
 
-		_, ok1 := dest.(*dests.KafkaDestination)
+		kafkaDest, ok1 := dest.(*dests.KafkaDestination)
 		_, ok2 := dest.(*dests.NATSDestination)
 		_, ok3 := dest.(*dests.RedisDestination)
 
@@ -168,6 +186,9 @@ Loop:
 			// only calculate proper Topic, PartitionKey and PartitionNumber if we are sending to Kafka or NATS
 			topic, joinedErr = env.Topic(m.Fields)
 			if joinedErr != nil {
+				if killErr == nil && javascript.IsResourceLimitError(joinedErr) {
+					killErr = joinedErr
+				}
 				fwder.logger.Info("Error calculating topic", "error", joinedErr.Error(), "uid", m.Uid)
 			}
 			if len(topic) == 0 {
@@ -175,15 +196,46 @@ Loop:
 			}
 			partitionKey, joinedErr = env.PartitionKey(m.Fields)
 			if joinedErr != nil {
+				if killErr == nil && javascript.IsResourceLimitError(joinedErr) {
+					killErr = joinedErr
+				}
 				fwder.logger.Info("Error calculating the partition key", "error", err, "uid", m.Uid)
 			}
-			partitionNumber, joinedErr = env.PartitionNumber(m.Fields)
+			partitions := int32(0)
+			if ok1 && topic != javascript.NullTopic && env.HasPartitionNumber() {
+				// the partition counts are only fetched for the partition
+				// functions
+				partitions = kafkaDest.PartitionCount(topic)
+			}
+			partitionNumber, joinedErr = env.PartitionNumber(m.Fields, partitions)
 			if joinedErr != nil {
+				if killErr == nil && javascript.IsResourceLimitError(joinedErr) {
+					killErr = joinedErr
+				}
 				fwder.logger.Info("Error calculating the partition number", "error", err, "uid", m.Uid)
 			}
+		} else if env.RoutesToNull() {
+			// the other destinations only need the topic to know if the
+			// message is routed to the null destination
+			topic, joinedErr = env.Topic(m.Fields)
+			if joinedErr != nil {
+				if killErr == nil && javascript.IsResourceLimitError(joinedErr) {
+					killErr = joinedErr
+				}
+				fwder.logger.Info("Error calculating topic", "error", joinedErr.Error(), "uid", m.Uid)
+			}
+		}
+
+		if killErr != nil {
+			fwder.rejectJSLimit(m, killErr)
+			continue Loop
 		}
 
 		filterResult, e := env.FilterMessage(m.Fields)
+		if javascript.IsResourceLimitError(e) {
+			fwder.rejectJSLimit(m, e)
+			continue Loop
+		}
 		if e != nil {
 			fwder.logger.Warn("Error happened filtering message", "error", e)
 			continue Loop
@@ -206,6 +258,13 @@ Loop:
 			fwder.logger.Warn("Error happened processing message", "uid", m.Uid, "error", err)
 			continue Loop
 		}
+		if topic == javascript.NullTopic {
+			// routed to the null destination
+			fwder.store.ACK(m.Uid, fwder.desttype)
+			dests.CountDiscarded(fwder.desttype)
+			continue Loop
+		}
+		dest.TakeStamps(m)
 		fwder.outputMsgs[i].PartitionKey = partitionKey
 		fwder.outputMsgs[i].PartitionNumber = partitionNumber
 		fwder.outputMsgs[i].Topic = topic
@@ -217,3 +276,11 @@ Loop:
 	}
 	return dest.Send(ctx, fwder.outputMsgs[:i])
 }
+
+// rejectJSLimit rejects a message for which a JS function was interrupted
+// because it exceeded the resource limits.
+func (fwder *Forwarder) rejectJSLimit(m *model.FullMessage, err error) {
+	fwder.store.PermError(m.Uid, fwder.desttype)
+	countJSLimit(fwder.desttype, javascript.LimitReason(err))
+	fwder.errLogger.Warn("A JS function exceeded the resource limits, the message is rejected", "uid", m.Uid)
+}
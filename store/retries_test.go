@@ -0,0 +1,110 @@
+package store
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/dgraph-io/badger"
+	"github.com/golang/snappy"
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils"
+	"github.com/stephane-martin/skewer/utils/db"
+	"github.com/stephane-martin/skewer/utils/queue"
+)
+
+func TestRetriesCount(t *testing.T) {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	dir, err := ioutil.TempDir("", "skewer-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	opts := badger.DefaultOptions
+	opts.Dir = dir
+	opts.ValueDir = dir
+	badg, err := badger.Open(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = badg.Close() }()
+	bend, err := NewBackend(badg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := conf.Kafka
+	readyDB := bend.GetPartition(Ready, dest)
+	sentDB := bend.GetPartition(Sent, dest)
+	failedDB := bend.GetPartition(Failed, dest)
+	retriesDB := bend.GetPartition(Retries, dest)
+
+	// stash a message for the destination
+	msg := model.FullFactory()
+	msg.Uid = utils.NewUid()
+	msg.Fields.Message = "hello"
+	b, err := msg.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var compressed bytes.Buffer
+	w := snappy.NewBufferedWriter(&compressed)
+	_, _ = w.Write(b)
+	_ = w.Close()
+	queued := map[utils.MyULID]string{msg.Uid: compressed.String()}
+	if err := ingestMsgsHelper(badg, bend.Messages, queued); err != nil {
+		t.Fatal(err)
+	}
+	if err := ingestReadyHelper(badg, readyDB, queued); err != nil {
+		t.Fatal(err)
+	}
+
+	// NACK and send the message again a few times
+	nack := []queue.UidDest{{Uid: msg.Uid, Dest: dest}}
+	for cycle := int32(0); cycle < 3; cycle++ {
+		uids, messages, _, _, err := tryRetrieveHelper(bend.Messages, readyDB, sentDB, retriesDB, badg, 10, logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(uids) != 1 || messages[0].Uid != msg.Uid {
+			t.Fatalf("cycle %d: the message was not retrieved", cycle)
+		}
+		if messages[0].Retries != cycle {
+			t.Fatalf("cycle %d: unexpected retry count %d", cycle, messages[0].Retries)
+		}
+		if _, err := doNACKHelper(badg, bend, nack); err != nil {
+			t.Fatal(err)
+		}
+		// the failed message is ready again, as after the failures reset
+		txn := db.NewNTransaction(badg, true)
+		_ = failedDB.Delete(msg.Uid, txn)
+		_ = readyDB.Set(msg.Uid, "true", txn)
+		if err := txn.Commit(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the retry count is forgotten when the message is finally delivered
+	_, messages, _, _, err := tryRetrieveHelper(bend.Messages, readyDB, sentDB, retriesDB, badg, 10, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].Retries != 3 {
+		t.Fatalf("unexpected retrieved messages: %v", messages)
+	}
+	if _, err := doACKHelper(badg, bend, nack); err != nil {
+		t.Fatal(err)
+	}
+	txn := db.NewNTransaction(badg, false)
+	defer txn.Discard()
+	retries, err := getRetries(retriesDB, msg.Uid, txn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retries != 0 {
+		t.Fatalf("the retry count was not forgotten: %d", retries)
+	}
+}
@@ -35,7 +35,9 @@ var Registry *prometheus.Registry
 var badgerGauge *prometheus.GaugeVec
 var ackCounter *prometheus.CounterVec
 var messageFilterCounter *prometheus.CounterVec
+var expiredCounter *prometheus.CounterVec
 var retrieveTimeSummary prometheus.Summary
+var jsLimitCounter *prometheus.CounterVec
 var lsmSize prometheus.GaugeFunc
 var vlogSize prometheus.GaugeFunc
 
@@ -82,6 +84,22 @@ func InitRegistry() {
 			[]string{"status", "client", "destination"},
 		)
 
+		expiredCounter = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "skw_messages_expired_total",
+				Help: "number of messages dropped because they exceeded max_message_age",
+			},
+			[]string{"destination"},
+		)
+
+		jsLimitCounter = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "skw_js_limit_kills_total",
+				Help: "number of JS functions interrupted because they exceeded the resource limits",
+			},
+			[]string{"destination", "reason"},
+		)
+
 		retrieveTimeSummary = prometheus.NewSummary(
 			prometheus.SummaryOpts{
 				Help:       "histogram for the response time to retrieve messages from the Store",
@@ -110,7 +128,7 @@ func InitRegistry() {
 		)
 
 		Registry = prometheus.NewRegistry()
-		Registry.MustRegister(badgerGauge, ackCounter, messageFilterCounter, retrieveTimeSummary, lsmSize, vlogSize)
+		Registry.MustRegister(badgerGauge, ackCounter, messageFilterCounter, expiredCounter, jsLimitCounter, retrieveTimeSummary, lsmSize, vlogSize)
 	})
 }
 
@@ -118,6 +136,14 @@ func countACK(dest conf.DestinationType, status string) {
 	ackCounter.WithLabelValues(status, conf.DestinationNames[dest]).Inc()
 }
 
+func countExpired(dest conf.DestinationType) {
+	expiredCounter.WithLabelValues(conf.DestinationNames[dest]).Inc()
+}
+
+func countJSLimit(dest conf.DestinationType, reason string) {
+	jsLimitCounter.WithLabelValues(conf.DestinationNames[dest], reason).Inc()
+}
+
 func countFiltered(dest conf.DestinationType, status string, client string) {
 	messageFilterCounter.WithLabelValues(status, client, conf.DestinationNames[dest]).Inc()
 }
@@ -146,6 +172,8 @@ const (
 	Sent
 	Failed
 	PermErrors
+	// Retries counts how many times each message was NACKed by a destination
+	Retries
 )
 
 var Queues = map[QueueType]string{
@@ -153,6 +181,7 @@ var Queues = map[QueueType]string{
 	Sent:       "s",
 	Failed:     "f",
 	PermErrors: "p",
+	Retries:    "t",
 }
 
 func getPartitionPrefix(qtype QueueType, dtype conf.DestinationType) string {
@@ -217,6 +246,10 @@ type MessageStore struct {
 	addMissingMsgID bool
 	generator       *utils.Generator
 	uidsTmpBuf      []utils.MyULID
+
+	// watched are the messages whose outcome is reported to onAcks
+	watched sync.Map
+	onAcks  func([]model.Ack)
 }
 
 func (s *MessageStore) Confined() bool {
@@ -690,6 +723,20 @@ func (s *MessageStore) StoreAllSyslogConfigs(c conf.BaseConfig) (err error) {
 		})
 	}
 
+	for _, c := range c.FIFOSource {
+		fifoConf := c
+		funcs = append(funcs, func() error {
+			return s.StoreSyslogConfig(fifoConf.ConfID, fifoConf.FilterSubConfig)
+		})
+	}
+
+	for _, c := range c.IngestSource {
+		ingestConf := c
+		funcs = append(funcs, func() error {
+			return s.StoreSyslogConfig(ingestConf.ConfID, ingestConf.FilterSubConfig)
+		})
+	}
+
 	funcs = append(funcs, func() error {
 		return s.StoreSyslogConfig(c.Journald.ConfID, c.Journald.FilterSubConfig)
 	})
@@ -702,6 +749,14 @@ func (s *MessageStore) StoreAllSyslogConfigs(c conf.BaseConfig) (err error) {
 		return s.StoreSyslogConfig(c.MacOS.ConfID, c.MacOS.FilterSubConfig)
 	})
 
+	funcs = append(funcs, func() error {
+		return s.StoreSyslogConfig(c.Synthetic.ConfID, c.Synthetic.FilterSubConfig)
+	})
+
+	funcs = append(funcs, func() error {
+		return s.StoreSyslogConfig(c.Heartbeat.ConfID, c.Heartbeat.FilterSubConfig)
+	})
+
 	return utils.Chain(funcs...)
 }
 
@@ -755,7 +810,6 @@ func (s *MessageStore) initGauge() {
 	keysByPrefix := make(map[string][]utils.MyULID)
 	var (
 		wholekey, key, prefix string
-		err                   error
 		uid, k                utils.MyULID
 	)
 	for _, k = range allkeys {
@@ -874,6 +928,12 @@ L:
 		if err != nil {
 			return 0, err
 		}
+		for _, dest := range conf.Destinations {
+			err = bend.GetPartition(Retries, dest).Delete(uid, txn)
+			if err != nil {
+				return 0, err
+			}
+		}
 	}
 
 	err = txn.Commit(nil)
@@ -1155,6 +1215,7 @@ func (s *MessageStore) Ingest(m map[utils.MyULID]string) (int, error) {
 	// first store the messages content in the messages db
 	err := s.ingestMessages(m)
 	if err != nil {
+		s.reportFailed(m)
 		return 0, err
 	}
 	badgerGauge.WithLabelValues("messages", "").Add(float64(length))
@@ -1174,9 +1235,22 @@ func (s *MessageStore) Ingest(m map[utils.MyULID]string) (int, error) {
 	for msg := range m {
 		s.count.New(msg, nbDone)
 	}
+	if err != nil {
+		s.reportFailed(m)
+	}
 	return length, err
 }
 
+// reportFailed reports the failure of the watched messages among the
+// messages that could not be stored.
+func (s *MessageStore) reportFailed(m map[utils.MyULID]string) {
+	failed := make([]utils.MyULID, 0, len(m))
+	for uid := range m {
+		failed = append(failed, uid)
+	}
+	s.reportAcks(failed, false)
+}
+
 func retrieveIterHelper(msgsDB, readyDB db.Partition, batchsize uint32, txn *db.NTransaction, l log15.Logger) (fUIDs []utils.MyULID, messages []*model.FullMessage, invalid []utils.MyULID, keysNotFound int) {
 	messages = msgsSlicePool.Get().([]*model.FullMessage)[:0]
 	allUIDs := uidsPool.Get().([]utils.MyULID)[:0]
@@ -1240,7 +1314,7 @@ func retrieveIterHelper(msgsDB, readyDB db.Partition, batchsize uint32, txn *db.
 	return fUIDs, messages, invalid, keysNotFound
 }
 
-func tryRetrieveHelper(msgsDB, readyDB, sentDB db.Partition, badg *badger.DB, batchSize uint32, l log15.Logger) ([]utils.MyULID, []*model.FullMessage, int, int, error) {
+func tryRetrieveHelper(msgsDB, readyDB, sentDB, retriesDB db.Partition, badg *badger.DB, batchSize uint32, l log15.Logger) ([]utils.MyULID, []*model.FullMessage, int, int, error) {
 
 	txn := db.NewNTransaction(badg, true)
 	defer txn.Discard()
@@ -1249,6 +1323,13 @@ func tryRetrieveHelper(msgsDB, readyDB, sentDB db.Partition, badg *badger.DB, ba
 	// fetch messages from badger
 	uids, messages, invalidEntries, keysNotFound := retrieveIterHelper(msgsDB, readyDB, batchSize, txn, l)
 
+	for i, uid := range uids {
+		messages[i].Retries, err = getRetries(retriesDB, uid, txn)
+		if err != nil {
+			return nil, nil, 0, 0, eerrors.Wrap(err, "Error reading the retries of messages")
+		}
+	}
+
 	if len(invalidEntries) > 0 {
 		l.Info("Found invalid entries", "number", len(invalidEntries))
 		err = readyDB.DeleteMany(invalidEntries, txn)
@@ -1286,6 +1367,7 @@ func (s *MessageStore) retrieve(dest conf.DestinationType) ([]*model.FullMessage
 	messagesDB := s.backend.Messages
 	readyDB := s.backend.GetPartition(Ready, dest)
 	sentDB := s.backend.GetPartition(Sent, dest)
+	retriesDB := s.backend.GetPartition(Retries, dest)
 
 	var messages []*model.FullMessage
 	var uids []utils.MyULID
@@ -1294,7 +1376,7 @@ func (s *MessageStore) retrieve(dest conf.DestinationType) ([]*model.FullMessage
 	var err error
 
 	for {
-		uids, messages, nbInvalids, nbNotFound, err = tryRetrieveHelper(messagesDB, readyDB, sentDB, s.badger, s.BatchSize, s.logger)
+		uids, messages, nbInvalids, nbNotFound, err = tryRetrieveHelper(messagesDB, readyDB, sentDB, retriesDB, s.badger, s.BatchSize, s.logger)
 
 		if err == nil {
 			break
@@ -1339,6 +1421,10 @@ func doACKHelper(badg *badger.DB, bend *Backend, acks []queue.UidDest) (count ma
 		if err != nil {
 			return nil, eerrors.Wrap(err, "Error removing messages from the Sent DB")
 		}
+		err = bend.GetPartition(Retries, ack.Dest).Delete(ack.Uid, txn)
+		if err != nil {
+			return nil, eerrors.Wrap(err, "Error removing messages from the Retries DB")
+		}
 		count[ack.Dest]++
 	}
 	return count, txn.Commit(nil)
@@ -1364,9 +1450,14 @@ func (s *MessageStore) doACK(acks []queue.UidDest) (err error) {
 	for dtype, nb := range count {
 		badgerGauge.WithLabelValues("sent", conf.DestinationNames[dtype]).Sub(float64(nb))
 	}
+	var delivered []utils.MyULID
 	for _, ack := range acks {
-		s.count.Dec(ack.Uid)
+		if s.count.Dec(ack.Uid) {
+			// all the destinations have acknowledged the message
+			delivered = append(delivered, ack.Uid)
+		}
 	}
+	s.reportAcks(delivered, true)
 	return nil
 }
 
@@ -1391,11 +1482,42 @@ func doNACKHelper(badg *badger.DB, bend *Backend, nacks []queue.UidDest) (count
 		if err != nil {
 			return nil, eerrors.Wrap(err, "Error moving message to the Failed DB")
 		}
+		err = incrRetries(bend.GetPartition(Retries, nack.Dest), nack.Uid, txn)
+		if err != nil {
+			return nil, eerrors.Wrap(err, "Error counting the retries of messages")
+		}
 		count[nack.Dest]++
 	}
 	return count, txn.Commit(nil)
 }
 
+// getRetries returns the number of times the message was NACKed by the
+// destination, and so sent again.
+func getRetries(retriesDB db.Partition, uid utils.MyULID, txn *db.NTransaction) (int32, error) {
+	b, err := retriesDB.Get(uid, nil, txn)
+	if err == badger.ErrKeyNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	retries, n := binary.Varint(b)
+	if n <= 0 {
+		return 0, nil
+	}
+	return int32(retries), nil
+}
+
+func incrRetries(retriesDB db.Partition, uid utils.MyULID, txn *db.NTransaction) error {
+	retries, err := getRetries(retriesDB, uid, txn)
+	if err != nil {
+		return err
+	}
+	b := make([]byte, binary.MaxVarintLen32)
+	n := binary.PutVarint(b, int64(retries)+1)
+	return retriesDB.Set(uid, string(b[:n]), txn)
+}
+
 func (s *MessageStore) doNACK(nacks []queue.UidDest) (err error) {
 	if len(nacks) == 0 {
 		return
@@ -1442,6 +1564,10 @@ func doPermErrorHelper(badg *badger.DB, bend *Backend, nacks []queue.UidDest) (c
 		if err != nil {
 			return nil, eerrors.Wrap(err, "Error moving message to the PermErrors DB")
 		}
+		err = bend.GetPartition(Retries, nack.Dest).Delete(nack.Uid, txn)
+		if err != nil {
+			return nil, eerrors.Wrap(err, "Error removing messages from the Retries DB")
+		}
 		count[nack.Dest]++
 	}
 	return count, txn.Commit(nil)
@@ -1467,5 +1593,37 @@ func (s *MessageStore) doPermanentError(pes []queue.UidDest) (err error) {
 		badgerGauge.WithLabelValues("permerrors", conf.DestinationNames[dtype]).Add(float64(nb))
 		badgerGauge.WithLabelValues("sent", conf.DestinationNames[dtype]).Sub(float64(nb))
 	}
+	rejected := make([]utils.MyULID, 0, len(pes))
+	for _, pe := range pes {
+		rejected = append(rejected, pe.Uid)
+	}
+	s.reportAcks(rejected, false)
 	return nil
 }
+
+// OnAcks sets the function that receives the outcome of the watched
+// messages. It must be called before any message is watched.
+func (s *MessageStore) OnAcks(f func([]model.Ack)) {
+	s.onAcks = f
+}
+
+// Watch makes the store report the outcome of the message uid: success
+// when all the destinations have acknowledged it, failure when a destination
+// has rejected it or when it could not be stored.
+func (s *MessageStore) Watch(uid utils.MyULID) {
+	s.watched.Store(uid, true)
+}
+
+// reportAcks reports the outcome of the watched messages among uids.
+func (s *MessageStore) reportAcks(uids []utils.MyULID, ok bool) {
+	var acks []model.Ack
+	for _, uid := range uids {
+		if _, watched := s.watched.Load(uid); watched {
+			s.watched.Delete(uid)
+			acks = append(acks, model.Ack{Uid: uid, OK: ok})
+		}
+	}
+	if len(acks) > 0 && s.onAcks != nil {
+		s.onAcks(acks)
+	}
+}
@@ -0,0 +1,29 @@
+// +build linux
+
+package binder
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenConfig binds the sockets to the network interface device with
+// SO_BINDTODEVICE, so that they keep listening when the addresses of the
+// interface change.
+func listenConfig(device string) *net.ListenConfig {
+	if len(device) == 0 {
+		return &net.ListenConfig{}
+	}
+	return &net.ListenConfig{
+		Control: func(network, address string, c syscall.RawConn) error {
+			var serr error
+			err := c.Control(func(fd uintptr) {
+				serr = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, device)
+			})
+			if err != nil {
+				return err
+			}
+			return serr
+		},
+	}
+}
@@ -63,6 +63,12 @@ type filePConn struct {
 	err error
 }
 
+// UnixConn returns the underlying unix socket, if any.
+func (c *filePConn) UnixConn() (*net.UnixConn, bool) {
+	uc, ok := c.PacketConn.(*net.UnixConn)
+	return uc, ok
+}
+
 func (c *filePConn) SetWriteBuffer(bytes int) error {
 	if uc, ok := c.PacketConn.(*net.UnixConn); ok {
 		return uc.SetWriteBuffer(bytes)
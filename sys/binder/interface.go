@@ -2,9 +2,36 @@ package binder
 
 import (
 	"net"
+	"strings"
+	"syscall"
 	"time"
+
+	"github.com/stephane-martin/skewer/utils/eerrors"
 )
 
+// DeviceSep separates a listen address from the name of the network
+// interface that the socket must be bound to, as in ":514@eth1".
+const DeviceSep = "@"
+
+// WithDevice returns the listen address that binds laddr to device.
+func WithDevice(laddr, device string) string {
+	return laddr + DeviceSep + device
+}
+
+// splitDevice separates the listen address of lnet from the name of the
+// network interface. Only the tcp and udp addresses carry an interface: a
+// unix socket path may contain DeviceSep.
+func splitDevice(lnet, laddr string) (string, string) {
+	if !strings.HasPrefix(lnet, "tcp") && !strings.HasPrefix(lnet, "udp") {
+		return laddr, ""
+	}
+	i := strings.LastIndex(laddr, DeviceSep)
+	if i == -1 {
+		return laddr, ""
+	}
+	return laddr[:i], laddr[i+1:]
+}
+
 type Client interface {
 	Listen(lnet string, laddr string) (net.Listener, error)
 	ListenKeepAlive(lnet string, laddr string, period time.Duration) (net.Listener, error)
@@ -12,3 +39,18 @@ type Client interface {
 	StopListen(addr string) error
 	Quit() error
 }
+
+// IsTransient tells whether a listen error may go away by itself, because
+// the address is still in use (e.g. by the sockets of the previous process
+// after a fast restart) or not assigned yet. The errors of the listens made
+// by the parent process only carry the error message.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if eerrors.HasErrno(err, syscall.EADDRINUSE) || eerrors.HasErrno(err, syscall.EADDRNOTAVAIL) {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, syscall.EADDRINUSE.Error()) || strings.Contains(msg, syscall.EADDRNOTAVAIL.Error())
+}
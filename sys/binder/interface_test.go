@@ -0,0 +1,25 @@
+package binder
+
+import "testing"
+
+func TestSplitDevice(t *testing.T) {
+	tests := []struct {
+		lnet, addr, laddr, device string
+	}{
+		{"tcp", ":514", ":514", ""},
+		{"tcp", WithDevice(":514", "eth1"), ":514", "eth1"},
+		{"tcp4", WithDevice("0.0.0.0:514", "eth1"), "0.0.0.0:514", "eth1"},
+		{"tcp6", WithDevice("[::]:514", "eth1"), "[::]:514", "eth1"},
+		{"udp", WithDevice(":514", "bond0"), ":514", "bond0"},
+		{"udp6", "[fe80::1]:514", "[fe80::1]:514", ""},
+		{"unix", "/run/skewer/log@host.sock", "/run/skewer/log@host.sock", ""},
+		{"unixgram", "/dev/log", "/dev/log", ""},
+		{"unixpacket", "/tmp/a@b@c", "/tmp/a@b@c", ""},
+	}
+	for _, tt := range tests {
+		laddr, device := splitDevice(tt.lnet, tt.addr)
+		if laddr != tt.laddr || device != tt.device {
+			t.Errorf("splitDevice(%q, %q) = %q, %q, expected %q, %q", tt.lnet, tt.addr, laddr, device, tt.laddr, tt.device)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+// +build !linux
+
+package binder
+
+import (
+	"net"
+	"syscall"
+
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// listenConfig can't bind the sockets to a network interface outside of
+// Linux: the configuration resolves the address of the interface instead.
+func listenConfig(device string) *net.ListenConfig {
+	if len(device) == 0 {
+		return &net.ListenConfig{}
+	}
+	return &net.ListenConfig{
+		Control: func(network, address string, c syscall.RawConn) error {
+			return eerrors.Errorf("Binding to the network interface '%s' is only supported on Linux", device)
+		},
+	}
+}
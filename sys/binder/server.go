@@ -31,15 +31,16 @@ type ExternalPacketConn struct {
 func listen(ctx context.Context, wg *sync.WaitGroup, logger log15.Logger, schan chan *ExternalConn, addr string) (net.Listener, error) {
 	parts := strings.SplitN(addr, ":", 2)
 	lnet := parts[0]
-	laddr := parts[1]
+	laddr, device := splitDevice(lnet, parts[1])
 
-	l, err := net.Listen(lnet, laddr)
+	l, err := listenConfig(device).Listen(ctx, lnet, laddr)
 
 	if err != nil {
 		return nil, err
 	}
 
 	if lnet == "unix" || lnet == "unixpacket" {
+		// the socket is a syslog source: any local process may log to it
 		_ = os.Chmod(laddr, 0777)
 		l.(*net.UnixListener).SetUnlinkOnClose(true)
 	}
@@ -80,9 +81,9 @@ func listen(ctx context.Context, wg *sync.WaitGroup, logger log15.Logger, schan
 func listenPacket(addr string) (conn net.PacketConn, err error) {
 	parts := strings.SplitN(addr, ":", 2)
 	lnet := parts[0]
-	laddr := parts[1]
+	laddr, device := splitDevice(lnet, parts[1])
 
-	conn, err = net.ListenPacket(lnet, laddr)
+	conn, err = listenConfig(device).ListenPacket(context.Background(), lnet, laddr)
 
 	if err != nil {
 		return nil, err
@@ -100,7 +101,14 @@ func listenPacket(addr string) (conn net.PacketConn, err error) {
 	return conn, nil
 }
 
+// Server serves the binder requests of the children. The requests arrive on
+// the socketpairs inherited by the children, and they must be encrypted with
+// the kring box secret: a request that can't be decrypted closes the channel.
 func Server(ctx context.Context, parentsHandles []uintptr, secret *memguard.LockedBuffer, logger log15.Logger) (wg *sync.WaitGroup, err error) {
+	if secret == nil {
+		// without a secret, the requests would not be authenticated
+		return nil, eerrors.New("The binder requires a secret")
+	}
 	wg = &sync.WaitGroup{}
 	for _, handle := range parentsHandles {
 		err = serveOne(ctx, wg, handle, secret, logger)
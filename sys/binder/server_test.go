@@ -0,0 +1,55 @@
+package binder
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/inconshreveable/log15"
+)
+
+func TestListenUnixWithSep(t *testing.T) {
+	dir, err := ioutil.TempDir("", "skewer-binder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+
+	path := filepath.Join(dir, "log@host.sock")
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	schan := make(chan *ExternalConn, 1)
+	l, err := listen(ctx, &wg, logger, schan, "unix:"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = c.Close()
+	ext := <-schan
+	_ = ext.Conn.Close()
+	if ext.Addr != "unix:"+path {
+		t.Fatalf("unexpected address: %s", ext.Addr)
+	}
+	_ = l.Close()
+	cancel()
+	wg.Wait()
+
+	gram := filepath.Join(dir, "gram@host.sock")
+	conn, err := listenPacket("unixgram:" + gram)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	if _, err := os.Stat(gram); err != nil {
+		t.Fatalf("the socket was not created at the full path: %v", err)
+	}
+}
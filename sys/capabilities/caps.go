@@ -374,3 +374,32 @@ func (c *CapabilitiesQuery) CanModifySecurebits() bool {
 func (c *CapabilitiesQuery) CanChangeUid() bool {
 	return c.caps.Get(capability.EFFECTIVE, capability.CAP_SETUID) && c.caps.Get(capability.EFFECTIVE, capability.CAP_SETGID)
 }
+
+// VerifyDropped checks that the privilege drop really happened: the process
+// must not run as root (unless it is confined in a user namespace, where
+// root is mapped to an unprivileged host user), and no capability other than
+// CAP_IPC_LOCK may remain. Privileged ports are obtained through the binder,
+// so CAP_NET_BIND_SERVICE must be gone too.
+func VerifyDropped(confined bool) error {
+	if !confined {
+		if os.Geteuid() == 0 || os.Getuid() == 0 {
+			return fmt.Errorf("Process still runs as root (uid=%d, euid=%d)", os.Getuid(), os.Geteuid())
+		}
+		if os.Getegid() == 0 || os.Getgid() == 0 {
+			return fmt.Errorf("Process still runs with root group (gid=%d, egid=%d)", os.Getgid(), os.Getegid())
+		}
+	}
+	c, err := NewCapabilitiesQuery()
+	if err != nil {
+		return err
+	}
+	for i := 0; i <= int(capability.CAP_LAST_CAP); i++ {
+		if capability.Cap(i) == capability.CAP_IPC_LOCK {
+			continue
+		}
+		if c.caps.Get(capability.EFFECTIVE, capability.Cap(i)) || c.caps.Get(capability.PERMITTED, capability.Cap(i)) {
+			return fmt.Errorf("Process still has capability '%s'", capability.Cap(i))
+		}
+	}
+	return nil
+}
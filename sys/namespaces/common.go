@@ -6,12 +6,14 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"syscall"
 
 	"github.com/kardianos/osext"
 	"github.com/stephane-martin/skewer/sys/kring"
 	"github.com/stephane-martin/skewer/utils/eerrors"
+	"github.com/stephane-martin/skewer/utils/logging"
 )
 
 type NamespacedCmd struct {
@@ -24,6 +26,8 @@ type NamespacedCmd struct {
 	certFiles    []string
 	certPaths    []string
 	polldirs     []string
+	statedirs    []string
+	journalSock  string
 }
 
 func NewNamespacedCmd(cmd *PluginCmd) *NamespacedCmd {
@@ -70,6 +74,18 @@ func (c *NamespacedCmd) PollDirectories(dirs []string) *NamespacedCmd {
 	return c
 }
 
+// StateDirectories are directories where the plugin can write its state.
+func (c *NamespacedCmd) StateDirectories(dirs []string) *NamespacedCmd {
+	c.statedirs = dirs
+	return c
+}
+
+// JournalSocket is the journald socket that the plugin writes to.
+func (c *NamespacedCmd) JournalSocket(path string) *NamespacedCmd {
+	c.journalSock = strings.TrimSpace(path)
+	return c
+}
+
 type PluginCmd struct {
 	Cmd    *exec.Cmd
 	Stdin  io.WriteCloser
@@ -107,6 +123,7 @@ type CmdOpts struct {
 	binderHdl   uintptr
 	messagePipe *os.File
 	profile     bool
+	dumpable    bool
 }
 
 func BinderHandle(hdl uintptr) func(*CmdOpts) {
@@ -133,6 +150,13 @@ func Profile(profile bool) func(*CmdOpts) {
 	}
 }
 
+// Dumpable lets the plugin process write core dumps and be traced.
+func Dumpable(dumpable bool) func(*CmdOpts) {
+	return func(opts *CmdOpts) {
+		opts.dumpable = dumpable
+	}
+}
+
 func SetupCmd(name string, ring kring.Ring, funcopts ...func(*CmdOpts)) (cmd *PluginCmd, err error) {
 	opts := &CmdOpts{
 		name: name,
@@ -163,6 +187,18 @@ func SetupCmd(name string, ring kring.Ring, funcopts ...func(*CmdOpts)) (cmd *Pl
 	if opts.profile {
 		envs = append(envs, "SKEWER_PROFILE=TRUE")
 	}
+	if opts.dumpable {
+		envs = append(envs, "SKEWER_DUMPABLE=TRUE")
+	}
+	if os.Getenv("SKEWER_VERIFY_PRIVDROP") == "TRUE" {
+		envs = append(envs, "SKEWER_VERIFY_PRIVDROP=TRUE")
+	}
+	if os.Getenv("SKEWER_TESTING") == "TRUE" {
+		envs = append(envs, "SKEWER_TESTING=TRUE")
+	}
+	if format := os.Getenv(logging.FormatEnv); len(format) > 0 {
+		envs = append(envs, fmt.Sprintf("%s=%s", logging.FormatEnv, format))
+	}
 	rPipe, wPipe, err := os.Pipe()
 	if err != nil {
 		return nil, eerrors.WithTags(eerrors.Wrap(err, "error creating a pipe to communicate with child"), "name", name)
@@ -200,6 +236,8 @@ type envPaths struct {
 	certFiles         []string
 	certPaths         []string
 	polldirs          []string
+	statedirs         []string
+	journalSock       string
 }
 
 func setupEnv(paths envPaths, ttyName string) (env []string) {
@@ -236,6 +274,14 @@ func setupEnv(paths envPaths, ttyName string) (env []string) {
 		env = append(env, fmt.Sprintf("SKEWER_POLLDIRS=%s", strings.Join(paths.polldirs, string(filepath.ListSeparator))))
 	}
 
+	if len(paths.statedirs) > 0 {
+		env = append(env, fmt.Sprintf("SKEWER_STATEDIRS=%s", strings.Join(paths.statedirs, string(filepath.ListSeparator))))
+	}
+
+	if len(paths.journalSock) > 0 {
+		env = append(env, fmt.Sprintf("SKEWER_JOURNAL_SOCKET=%s", paths.journalSock))
+	}
+
 	_, err := exec.LookPath("systemctl")
 	if err == nil {
 		env = append(env, "SKEWER_HAVE_SYSTEMCTL=TRUE")
@@ -262,3 +308,41 @@ type mountPoint struct {
 	Fs    string
 	Data  string
 }
+
+// ConfinedEnviron returns the environment of a plugin re-executed in its
+// namespaces. SKEWER_CONFINED tells the plugin that it runs as root inside a
+// user namespace, which the privilege drop verification accepts.
+func ConfinedEnviron(environ []string) []string {
+	env := make([]string, 0, len(environ)+1)
+	for _, e := range environ {
+		if !strings.HasPrefix(e, "SKEWER_CONFINED=") {
+			env = append(env, e)
+		}
+	}
+	return append(env, "SKEWER_CONFINED=TRUE")
+}
+
+// certDirs returns the parent directories of the certificate files, without
+// duplicates, and without the directories that are inside another one of the
+// list. The directories are bind-mounted instead of the files, so that a
+// certificate renewed by rename or by a symlink swap is seen by the plugin.
+func certDirs(certFiles []string) []string {
+	dirs := make([]string, 0, len(certFiles))
+	for _, certFile := range certFiles {
+		if len(certFile) > 0 {
+			dirs = append(dirs, filepath.Dir(filepath.Clean(certFile)))
+		}
+	}
+	sort.Strings(dirs)
+	res := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		if len(res) > 0 {
+			last := res[len(res)-1]
+			if dir == last || strings.HasPrefix(dir, strings.TrimSuffix(last, "/")+"/") {
+				continue
+			}
+		}
+		res = append(res, dir)
+	}
+	return res
+}
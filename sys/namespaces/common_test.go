@@ -0,0 +1,43 @@
+package namespaces
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestConfinedEnviron(t *testing.T) {
+	// the journal plugin re-executes itself with the environment of its
+	// parent, where SKEWER_CONFINED is not set
+	parent := []string{"PATH=/usr/bin", "SKEWER_VERIFY_PRIVDROP=TRUE", "SKEWER_CONFINED=FALSE"}
+	env := ConfinedEnviron(parent)
+	confined := 0
+	for _, e := range env {
+		switch e {
+		case "SKEWER_CONFINED=TRUE":
+			confined++
+		case "SKEWER_CONFINED=FALSE":
+			t.Fatal("the parent SKEWER_CONFINED should be replaced")
+		}
+	}
+	if confined != 1 {
+		t.Fatalf("SKEWER_CONFINED=TRUE should be set once: %v", env)
+	}
+	if len(env) != 3 || env[0] != "PATH=/usr/bin" || env[1] != "SKEWER_VERIFY_PRIVDROP=TRUE" {
+		t.Fatalf("the rest of the environment should be kept: %v", env)
+	}
+}
+
+func TestCertDirs(t *testing.T) {
+	files := []string{
+		"/etc/letsencrypt/live/example.org/fullchain.pem",
+		"/etc/letsencrypt/live/example.org/privkey.pem",
+		"/etc/ssl/ca.pem",
+		"",
+		"/etc/ssl/private/server.key",
+		"/etc/ssl2/ca.pem",
+	}
+	dirs := fmt.Sprint(certDirs(files))
+	if dirs != "[/etc/letsencrypt/live/example.org /etc/ssl /etc/ssl2]" {
+		t.Fatalf("unexpected directories: %s", dirs)
+	}
+}
@@ -21,6 +21,7 @@ func (c *NamespacedCmd) Start() (err error) {
 		certFiles: make([]string, 0),
 		certPaths: make([]string, 0),
 		polldirs:  make([]string, 0),
+		statedirs: make([]string, 0),
 	}
 
 	for _, d := range c.polldirs {
@@ -34,6 +35,17 @@ func (c *NamespacedCmd) Start() (err error) {
 		paths.polldirs = append(paths.polldirs, abs)
 	}
 
+	for _, d := range c.statedirs {
+		if !utils.IsDir(d) {
+			return fmt.Errorf("The state directory '%s' does not exist or is not a directory", d)
+		}
+		abs, err := filepath.Abs(d)
+		if err != nil {
+			return err
+		}
+		paths.statedirs = append(paths.statedirs, abs)
+	}
+
 	for _, f := range c.certFiles {
 		if !utils.FileExists(f) {
 			return fmt.Errorf("Certificate file '%s' does not exist", f)
@@ -48,6 +60,13 @@ func (c *NamespacedCmd) Start() (err error) {
 		paths.certPaths = append(paths.certPaths, f)
 	}
 
+	if len(c.journalSock) > 0 {
+		if !utils.FileExists(c.journalSock) {
+			return fmt.Errorf("Journal socket '%s' does not exist", c.journalSock)
+		}
+		paths.journalSock = c.journalSock
+	}
+
 	if len(c.acctPath) > 0 {
 		acctPath, err := filepath.Abs(c.acctPath)
 		if err != nil {
@@ -555,23 +574,32 @@ func MakeChroot(targetExec string) (string, error) {
 		})
 	}
 
-	// mount SKEWER_CERT_FILES
-	certFiles := filepath.SplitList(os.Getenv("SKEWER_CERT_FILES"))
-	if len(certFiles) > 0 {
-		for _, certFile := range certFiles {
-			if len(certFile) == 0 {
-				continue
-			}
-			bindMounts = append(bindMounts, bindMountPoint{
-				baseMountPoint: baseMountPoint{
-					Source: certFile,
-					Target: filepath.Join(root, "newroot", "tmp", "certfiles", certFile),
-				},
-				ReadOnly: true,
-				IsDir:    false,
-				Flags:    syscall.MS_NOSUID | syscall.MS_NOEXEC | syscall.MS_NODEV,
-			})
-		}
+	// bind-mount the journald socket if needed
+	journalSock := strings.TrimSpace(os.Getenv("SKEWER_JOURNAL_SOCKET"))
+	if len(journalSock) > 0 {
+		bindMounts = append(bindMounts, bindMountPoint{
+			baseMountPoint: baseMountPoint{
+				Source: journalSock,
+				Target: filepath.Join(root, "newroot", "tmp", "journal", journalSock),
+			},
+			ReadOnly: false,
+			IsDir:    false,
+			Flags:    syscall.MS_NOEXEC | syscall.MS_NODEV | syscall.MS_NOSUID,
+		})
+	}
+
+	// mount the directories of SKEWER_CERT_FILES: the files themselves
+	// would pin the inodes of the certificates at the time of the mount
+	for _, certDir := range certDirs(filepath.SplitList(os.Getenv("SKEWER_CERT_FILES"))) {
+		bindMounts = append(bindMounts, bindMountPoint{
+			baseMountPoint: baseMountPoint{
+				Source: certDir,
+				Target: filepath.Join(root, "newroot", "tmp", "certfiles", certDir),
+			},
+			ReadOnly: true,
+			IsDir:    true,
+			Flags:    syscall.MS_NOSUID | syscall.MS_NOEXEC | syscall.MS_NODEV,
+		})
 	}
 
 	// mount SKEWER_CERT_PATHS directories
@@ -612,6 +640,25 @@ func MakeChroot(targetExec string) (string, error) {
 		}
 	}
 
+	// RW bind-mount the directories where the plugins write their state
+	statedirs := filepath.SplitList(os.Getenv("SKEWER_STATEDIRS"))
+	if len(statedirs) > 0 {
+		for _, sdir := range statedirs {
+			if len(sdir) == 0 {
+				continue
+			}
+			bindMounts = append(bindMounts, bindMountPoint{
+				baseMountPoint: baseMountPoint{
+					Source: sdir,
+					Target: filepath.Join(root, "newroot", "tmp", "statedirs", sdir),
+				},
+				ReadOnly: false,
+				IsDir:    true,
+				Flags:    syscall.MS_NOSUID | syscall.MS_NOEXEC | syscall.MS_NODEV,
+			})
+		}
+	}
+
 	for _, mountPoint := range bindMounts {
 		if mounted.Has(mountPoint.Source) {
 			continue
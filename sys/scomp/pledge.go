@@ -22,10 +22,21 @@ func SetupPledge(t base.Types) (err error) {
 		base.Accounting,
 		base.KafkaSource,
 		base.Filesystem,
-		base.HTTPServer:
+		base.HTTPServer,
+		base.Synthetic,
+		base.Heartbeat:
 
 		err = unix.Pledge("stdio rpath flock dns sendfd recvfd ps inet unix getpw", nil)
 
+	case base.FIFO:
+		// the FIFO source opens its named pipes for writing to release a
+		// pending open when it stops
+		err = unix.Pledge("stdio rpath wpath flock dns sendfd recvfd ps inet unix getpw", nil)
+
+	case base.Ingest:
+		// the ingest source writes its checkpoints
+		err = unix.Pledge("stdio rpath wpath cpath flock dns sendfd recvfd ps inet unix getpw", nil)
+
 	case base.Store:
 		err = unix.Pledge("stdio rpath flock dns sendfd recvfd ps inet unix getpw wpath cpath tmppath fattr chown", nil)
 
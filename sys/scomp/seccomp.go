@@ -501,7 +501,7 @@ func SetupSeccomp(t base.Types) (err error) {
 	// MacOS source does not run under Linux
 	switch t {
 
-	case base.TCP, base.UDP, base.RELP, base.Graylog, base.Journal, base.Filesystem, base.HTTPServer, base.Accounting:
+	case base.TCP, base.UDP, base.RELP, base.Graylog, base.Journal, base.Filesystem, base.HTTPServer, base.Accounting, base.Synthetic, base.FIFO, base.Heartbeat, base.Ingest:
 		_, err = deriveComposeA(buildSimpleFilter, applyFilter)(baseAllowed, nil)
 
 	case base.DirectRELP, base.Store, base.KafkaSource, base.Configuration:
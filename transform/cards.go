@@ -0,0 +1,51 @@
+package transform
+
+import (
+	"regexp"
+)
+
+// cardCandidate matches 13 to 19 digits, that may be grouped by spaces or
+// dashes.
+var cardCandidate = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+
+// maskCards masks the digits of the card numbers found in s, except the last
+// four. Only the digit sequences that pass the Luhn check are masked.
+func maskCards(s string) string {
+	return cardCandidate.ReplaceAllStringFunc(s, func(candidate string) string {
+		digits := make([]byte, 0, len(candidate))
+		for i := 0; i < len(candidate); i++ {
+			if candidate[i] >= '0' && candidate[i] <= '9' {
+				digits = append(digits, candidate[i])
+			}
+		}
+		if !luhn(digits) {
+			return candidate
+		}
+		masked := []byte(candidate)
+		toMask := len(digits) - 4
+		for i := 0; i < len(masked) && toMask > 0; i++ {
+			if masked[i] >= '0' && masked[i] <= '9' {
+				masked[i] = '*'
+				toMask--
+			}
+		}
+		return string(masked)
+	})
+}
+
+func luhn(digits []byte) bool {
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
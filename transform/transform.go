@@ -0,0 +1,164 @@
+// Package transform applies declarative transformations to the messages:
+// rename or drop fields, redact text that matches a pattern, mask the card
+// numbers.
+package transform
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// AllFields is the field name that makes redact and mask_cards apply to all
+// the fields and properties of the message.
+const AllFields = "*"
+
+// Pipeline is an ordered list of transformations. A nil Pipeline does
+// nothing.
+type Pipeline struct {
+	ops []op
+}
+
+type op struct {
+	kind        string
+	field       string
+	to          string
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// New builds the pipeline of the given configuration, as checked by
+// conf.BaseConfig.CheckTransforms. It returns nil when there is no
+// transformation.
+func New(transforms []conf.TransformConfig) (*Pipeline, error) {
+	if len(transforms) == 0 {
+		return nil, nil
+	}
+	p := &Pipeline{ops: make([]op, 0, len(transforms))}
+	for _, t := range transforms {
+		o := op{kind: t.Op, field: t.Field, to: t.To, replacement: t.Replacement}
+		if t.Op == conf.TransformRedact {
+			var err error
+			o.pattern, err = regexp.Compile(t.Pattern)
+			if err != nil {
+				return nil, eerrors.Wrapf(err, "Invalid redact pattern: '%s'", t.Pattern)
+			}
+		}
+		p.ops = append(p.ops, o)
+	}
+	return p, nil
+}
+
+// Apply transforms m in place.
+func (p *Pipeline) Apply(m *model.SyslogMessage) {
+	if p == nil || m == nil {
+		return
+	}
+	for _, o := range p.ops {
+		switch o.kind {
+		case conf.TransformRename:
+			if v, ok := Get(m, o.field); ok {
+				del(m, o.field)
+				set(m, o.to, v)
+			}
+		case conf.TransformDrop:
+			del(m, o.field)
+		case conf.TransformRedact:
+			edit(m, o.field, func(v string) string {
+				return o.pattern.ReplaceAllLiteralString(v, o.replacement)
+			})
+		case conf.TransformMaskCards:
+			edit(m, o.field, maskCards)
+		}
+	}
+}
+
+// edit replaces the value of the field by f(value).
+func edit(m *model.SyslogMessage, field string, f func(string) string) {
+	if field != AllFields {
+		if v, ok := Get(m, field); ok && v != "" {
+			set(m, field, f(v))
+		}
+		return
+	}
+	for _, ptr := range []*string{&m.HostName, &m.AppName, &m.ProcId, &m.MsgId, &m.Structured, &m.Message} {
+		if *ptr != "" {
+			*ptr = f(*ptr)
+		}
+	}
+	for _, kv := range m.Properties.Map {
+		if kv == nil {
+			continue
+		}
+		for k, v := range kv.Map {
+			kv.Map[k] = f(v)
+		}
+	}
+}
+
+// field returns a pointer to the named syslog field, or nil for a property.
+func field(m *model.SyslogMessage, name string) *string {
+	switch name {
+	case "message":
+		return &m.Message
+	case "appname":
+		return &m.AppName
+	case "hostname":
+		return &m.HostName
+	case "procid":
+		return &m.ProcId
+	case "msgid":
+		return &m.MsgId
+	case "structured":
+		return &m.Structured
+	default:
+		return nil
+	}
+}
+
+// property splits a "domain.key" property name.
+func property(name string) (domain, key string) {
+	i := strings.IndexByte(name, '.')
+	if i < 0 {
+		return "", name
+	}
+	return name[:i], name[i+1:]
+}
+
+// Get returns the value of a syslog field (message, appname, hostname,
+// procid, msgid, structured) or of a "domain.key" property of m.
+func Get(m *model.SyslogMessage, name string) (string, bool) {
+	if f := field(m, name); f != nil {
+		return *f, *f != ""
+	}
+	domain, key := property(name)
+	kv := m.Properties.Map[domain]
+	if kv == nil {
+		return "", false
+	}
+	v, ok := kv.Map[key]
+	return v, ok
+}
+
+func set(m *model.SyslogMessage, name, value string) {
+	if f := field(m, name); f != nil {
+		*f = value
+		return
+	}
+	domain, key := property(name)
+	m.SetProperty(domain, key, value)
+}
+
+func del(m *model.SyslogMessage, name string) {
+	if f := field(m, name); f != nil {
+		*f = ""
+		return
+	}
+	domain, key := property(name)
+	if kv := m.Properties.Map[domain]; kv != nil {
+		delete(kv.Map, key)
+	}
+}
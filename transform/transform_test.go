@@ -0,0 +1,174 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+)
+
+func pipeline(t *testing.T, transforms ...conf.TransformConfig) *Pipeline {
+	c := conf.BaseConfig{Transforms: transforms}
+	if err := c.CheckTransforms(); err != nil {
+		t.Fatal(err)
+	}
+	p, err := New(c.Transforms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestRename(t *testing.T) {
+	p := pipeline(t,
+		conf.TransformConfig{Op: "rename", Field: "kubernetes.pod", To: "k8s.pod"},
+		conf.TransformConfig{Op: "rename", Field: "appname", To: "app.name"},
+		conf.TransformConfig{Op: "rename", Field: "nosuch.property", To: "msgid"},
+	)
+	m := model.Factory()
+	m.AppName = "nginx"
+	m.MsgId = "id"
+	m.SetProperty("kubernetes", "pod", "web-1")
+	p.Apply(m)
+	if m.GetProperty("k8s", "pod") != "web-1" || m.GetProperty("kubernetes", "pod") != "" {
+		t.Errorf("property was not renamed: %v", m.GetAllProperties())
+	}
+	if m.AppName != "" || m.GetProperty("app", "name") != "nginx" {
+		t.Errorf("appname was not renamed: %q", m.AppName)
+	}
+	if m.MsgId != "id" {
+		t.Errorf("a missing field should not be renamed: %q", m.MsgId)
+	}
+}
+
+func TestDrop(t *testing.T) {
+	p := pipeline(t,
+		conf.TransformConfig{Op: "drop", Field: "skewer.client"},
+		conf.TransformConfig{Op: "drop", Field: "structured"},
+	)
+	m := model.Factory()
+	m.Structured = "[sd@1 a=\"b\"]"
+	m.SetProperty("skewer", "client", "10.0.0.1")
+	m.SetProperty("skewer", "filename", "/var/log/x")
+	p.Apply(m)
+	if m.Structured != "" || m.GetProperty("skewer", "client") != "" {
+		t.Errorf("fields were not dropped")
+	}
+	if m.GetProperty("skewer", "filename") != "/var/log/x" {
+		t.Errorf("other properties should be kept")
+	}
+}
+
+func TestRedact(t *testing.T) {
+	p := pipeline(t, conf.TransformConfig{Op: "redact", Pattern: `password=\S+`})
+	m := model.Factory()
+	m.Message = "login user=bob password=hunter2 ok"
+	p.Apply(m)
+	if m.Message != "login user=bob [REDACTED] ok" {
+		t.Errorf("unexpected redacted message: %q", m.Message)
+	}
+
+	// the replacement is literal
+	p = pipeline(t, conf.TransformConfig{Op: "redact", Field: "skewer.client", Pattern: `\d+$`, Replacement: "$1x"})
+	m = model.Factory()
+	m.SetProperty("skewer", "client", "10.0.0.1")
+	p.Apply(m)
+	if m.GetProperty("skewer", "client") != "10.0.0.$1x" {
+		t.Errorf("unexpected redacted property: %q", m.GetProperty("skewer", "client"))
+	}
+}
+
+func TestRedactOverlapping(t *testing.T) {
+	// the patterns are applied in order: the second one sees the output of
+	// the first one
+	p := pipeline(t,
+		conf.TransformConfig{Op: "redact", Pattern: `secret\w*`},
+		conf.TransformConfig{Op: "redact", Pattern: `token=\S+`, Replacement: "token=***"},
+		conf.TransformConfig{Op: "redact", Pattern: `\[REDACTED\]\d+`},
+	)
+	m := model.Factory()
+	m.Message = "token=secret42abc key=secretkey9 id=secret7"
+	p.Apply(m)
+	if m.Message != "token=*** key=[REDACTED] id=[REDACTED]" {
+		t.Errorf("unexpected redacted message: %q", m.Message)
+	}
+
+	// the matches of a pattern that overlap are replaced once
+	p = pipeline(t, conf.TransformConfig{Op: "redact", Pattern: `aba`})
+	m = model.Factory()
+	m.Message = "ababa"
+	p.Apply(m)
+	if m.Message != "[REDACTED]ba" {
+		t.Errorf("unexpected redacted message: %q", m.Message)
+	}
+}
+
+func TestRedactAllFields(t *testing.T) {
+	p := pipeline(t, conf.TransformConfig{Op: "redact", Field: AllFields, Pattern: `s3cr3t`})
+	m := model.Factory()
+	m.Message = "the s3cr3t"
+	m.AppName = "s3cr3t-app"
+	m.SetProperty("http", "header", "Bearer s3cr3t")
+	p.Apply(m)
+	if m.Message != "the [REDACTED]" || m.AppName != "[REDACTED]-app" || m.GetProperty("http", "header") != "Bearer [REDACTED]" {
+		t.Errorf("all the fields should be redacted: %q %q %v", m.Message, m.AppName, m.GetAllProperties())
+	}
+}
+
+func TestMaskCards(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"paid with 4111111111111111.", "paid with ************1111."},
+		{"card 4111-1111-1111-1111 ok", "card ****-****-****-1111 ok"},
+		{"amex 3782 822463 10005", "amex **** ****** *0005"},
+		// not a valid card number
+		{"order 4111111111111112", "order 4111111111111112"},
+		// too short, or too long
+		{"phone 0123456789", "phone 0123456789"},
+		{"id 41111111111111110000000", "id 41111111111111110000000"},
+		{"two 4111111111111111 and 5500000000000004", "two ************1111 and ************0004"},
+	}
+	p := pipeline(t, conf.TransformConfig{Op: "mask_cards"})
+	for _, test := range tests {
+		m := model.Factory()
+		m.Message = test.in
+		p.Apply(m)
+		if m.Message != test.out {
+			t.Errorf("expected %q, got %q", test.out, m.Message)
+		}
+	}
+}
+
+func TestMaskCardsAfterRedact(t *testing.T) {
+	// a redaction that overlaps a card number leaves nothing to mask
+	p := pipeline(t,
+		conf.TransformConfig{Op: "redact", Pattern: `cc=\d{4}`},
+		conf.TransformConfig{Op: "mask_cards"},
+	)
+	m := model.Factory()
+	m.Message = "cc=4111111111111111 backup=4111111111111111"
+	p.Apply(m)
+	if m.Message != "[REDACTED]111111111111 backup=************1111" {
+		t.Errorf("unexpected message: %q", m.Message)
+	}
+}
+
+func TestCheckTransforms(t *testing.T) {
+	invalid := []conf.TransformConfig{
+		{Op: "uppercase"},
+		{Op: "rename", Field: "message"},
+		{Op: "drop"},
+		{Op: "redact"},
+		{Op: "redact", Pattern: "("},
+	}
+	for _, tr := range invalid {
+		c := conf.BaseConfig{Transforms: []conf.TransformConfig{tr}}
+		if c.CheckTransforms() == nil {
+			t.Errorf("%v should be invalid", tr)
+		}
+	}
+	var p *Pipeline
+	p.Apply(model.Factory())
+}
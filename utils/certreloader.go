@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// CertReloader serves the certificate of a TLS server, and reloads it from
+// disk when the certificate or key file has changed, so that renewed
+// certificates are used without a restart. The files are checked at most
+// once per interval, when a client connects. A file is changed when its
+// modification time or its inode differ, so that the renewals by rename or
+// by a symlink swap are seen too.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+	// OnReload is called after each (re)load attempt, with the new leaf
+	// certificate or the error. On error the previous certificate is kept.
+	OnReload func(leaf *x509.Certificate, err error)
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	certInfo  os.FileInfo
+	keyInfo   os.FileInfo
+	lastCheck time.Time
+}
+
+// NewCertReloader loads the certificate and key files. A non-positive
+// interval disables the reloading.
+func NewCertReloader(certFile, keyFile string, interval time.Duration, confined bool) (*CertReloader, error) {
+	if confined {
+		certFile = confinedCertFile(certFile)
+		keyFile = confinedCertFile(keyFile)
+	}
+	r := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		interval: interval,
+	}
+	_, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *CertReloader) load() (*x509.Certificate, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return nil, err
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, eerrors.Wrap(err, "Error parsing the certificate")
+	}
+	cert.Leaf = leaf
+	r.cert = &cert
+	r.certInfo = certInfo
+	r.keyInfo = keyInfo
+	r.lastCheck = time.Now()
+	return leaf, nil
+}
+
+// Leaf returns the certificate that is currently served.
+func (r *CertReloader) Leaf() *x509.Certificate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cert.Leaf
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.interval <= 0 || time.Since(r.lastCheck) < r.interval {
+		return r.cert, nil
+	}
+	r.lastCheck = time.Now()
+	if !r.changed() {
+		return r.cert, nil
+	}
+	// on error, the files may be in the middle of being replaced: keep
+	// serving the previous certificate, and retry at the next interval
+	leaf, err := r.load()
+	if r.OnReload != nil {
+		r.OnReload(leaf, err)
+	}
+	return r.cert, nil
+}
+
+func (r *CertReloader) changed() bool {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return false
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return false
+	}
+	return fileChanged(r.certInfo, certInfo) || fileChanged(r.keyInfo, keyInfo)
+}
+
+func fileChanged(old, cur os.FileInfo) bool {
+	return !os.SameFile(old, cur) || !old.ModTime().Equal(cur.ModTime())
+}
+
+// NewServerTLSConfig builds the TLS config of a server whose certificate is
+// served by reloader. The client certificates are verified against the CAs
+// found in caFile, caPath and the additional clientCAFiles bundles.
+func NewServerTLSConfig(reloader *CertReloader, caFile, caPath string, clientCAFiles []string, confined bool) (*tls.Config, error) {
+	tlsConfig, err := NewTLSConfig("", caFile, caPath, "", "", false, confined)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.GetCertificate = reloader.GetCertificate
+	if len(caFile) == 0 && len(caPath) == 0 && len(clientCAFiles) == 0 {
+		return tlsConfig, nil
+	}
+	pool := tlsConfig.RootCAs
+	if pool == nil {
+		pool = x509.NewCertPool()
+	}
+	for _, bundle := range clientCAFiles {
+		if confined {
+			bundle = confinedCertFile(bundle)
+		}
+		pem, err := ioutil.ReadFile(bundle)
+		if err != nil {
+			return nil, eerrors.Wrapf(err, "Error reading CA bundle '%s'", bundle)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, eerrors.Errorf("No certificate found in CA bundle '%s'", bundle)
+		}
+	}
+	tlsConfig.ClientCAs = pool
+	return tlsConfig, nil
+}
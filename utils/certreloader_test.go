@@ -0,0 +1,192 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeSelfSigned(t *testing.T, dir, name string, notAfter time.Time) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestCertReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "skewer-certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	firstExpiry := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	certFile, keyFile := writeSelfSigned(t, dir, "server", firstExpiry)
+	r, err := NewCertReloader(certFile, keyFile, time.Millisecond, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloads := 0
+	r.OnReload = func(leaf *x509.Certificate, err error) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		reloads++
+	}
+	if !r.Leaf().NotAfter.Equal(firstExpiry) {
+		t.Fatalf("unexpected expiry: %s", r.Leaf().NotAfter)
+	}
+
+	// unchanged files are not reloaded
+	time.Sleep(5 * time.Millisecond)
+	_, err = r.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloads != 0 {
+		t.Fatal("the certificate was reloaded while the files did not change")
+	}
+
+	// renew the certificate
+	secondExpiry := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	writeSelfSigned(t, dir, "server", secondExpiry)
+	future := time.Now().Add(time.Minute)
+	_ = os.Chtimes(certFile, future, future)
+	_ = os.Chtimes(keyFile, future, future)
+	time.Sleep(5 * time.Millisecond)
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloads != 1 {
+		t.Fatalf("expected 1 reload, got %d", reloads)
+	}
+	if !cert.Leaf.NotAfter.Equal(secondExpiry) {
+		t.Fatalf("the renewed certificate is not served: %s", cert.Leaf.NotAfter)
+	}
+
+	// a broken key file keeps the previous certificate
+	r.OnReload = func(leaf *x509.Certificate, err error) {
+		if err == nil {
+			t.Fatal("expected an error loading a broken key")
+		}
+		reloads++
+	}
+	_ = ioutil.WriteFile(keyFile, []byte("broken"), 0600)
+	future = future.Add(time.Minute)
+	_ = os.Chtimes(keyFile, future, future)
+	time.Sleep(5 * time.Millisecond)
+	cert, err = r.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloads != 2 || !cert.Leaf.NotAfter.Equal(secondExpiry) {
+		t.Fatal("the previous certificate should be kept when the reload fails")
+	}
+}
+
+func TestCertReloaderRenewByRename(t *testing.T) {
+	dir, err := ioutil.TempDir("", "skewer-certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	firstExpiry := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	certFile, keyFile := writeSelfSigned(t, dir, "server", firstExpiry)
+	r, err := NewCertReloader(certFile, keyFile, time.Millisecond, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// certbot writes the renewed files aside, then renames them over the
+	// previous ones. They keep the modification time of the previous ones, so
+	// that only the inode tells the change.
+	secondExpiry := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	newCert, newKey := writeSelfSigned(t, dir, "renewed", secondExpiry)
+	for _, f := range [][2]string{{newCert, certFile}, {newKey, keyFile}} {
+		info, err := os.Stat(f[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = os.Chtimes(f[0], info.ModTime(), info.ModTime())
+		err = os.Rename(f[0], f[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cert.Leaf.NotAfter.Equal(secondExpiry) {
+		t.Fatalf("the certificate renewed by rename is not served: %s", cert.Leaf.NotAfter)
+	}
+}
+
+func TestServerTLSConfigClientCAs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "skewer-certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	certFile, keyFile := writeSelfSigned(t, dir, "server", time.Now().Add(time.Hour))
+	oldCA, _ := writeSelfSigned(t, dir, "old-ca", time.Now().Add(time.Hour))
+	newCA, _ := writeSelfSigned(t, dir, "new-ca", time.Now().Add(time.Hour))
+
+	r, err := NewCertReloader(certFile, keyFile, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsConf, err := NewServerTLSConfig(r, oldCA, "", []string{newCA}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsConf.ClientCAs == nil || len(tlsConf.ClientCAs.Subjects()) != 2 {
+		t.Fatal("both CA bundles should be trusted for the client certificates")
+	}
+
+	_, err = NewServerTLSConfig(r, "", "", []string{keyFile}, false)
+	if err == nil {
+		t.Fatal("a bundle without certificates should be refused")
+	}
+}
@@ -0,0 +1,201 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// CertRevokedError is returned for a client certificate that is listed in
+// the CRL of its issuer.
+type CertRevokedError struct {
+	Serial  string
+	Subject string
+}
+
+func (e *CertRevokedError) Error() string {
+	return fmt.Sprintf("the certificate '%s' (serial %s) has been revoked", e.Subject, e.Serial)
+}
+
+// RevocationUnknownError is returned when the revocation status of a client
+// certificate can't be determined.
+type RevocationUnknownError struct {
+	Serial string
+	Reason string
+}
+
+func (e *RevocationUnknownError) Error() string {
+	return fmt.Sprintf("unknown revocation status of the certificate with serial %s: %s", e.Serial, e.Reason)
+}
+
+type crlEntry struct {
+	list    *x509.RevocationList
+	revoked map[string]struct{}
+	// verifiedBy is the raw issuer certificate that the signature of the
+	// list was verified with
+	verifiedBy []byte
+}
+
+// CRLChecker checks the client certificates against the certificate
+// revocation lists of a file, and reloads the file from disk when it has
+// changed, so that new revocations apply without a restart. The file is
+// checked at most once per interval, when a client connects.
+type CRLChecker struct {
+	file     string
+	interval time.Duration
+	// OnReload is called after each reload attempt, with the number of
+	// lists or the error. On error the previous lists are kept.
+	OnReload func(n int, err error)
+
+	mu        sync.Mutex
+	entries   []*crlEntry
+	mod       time.Time
+	lastCheck time.Time
+}
+
+// NewCRLChecker loads the revocation lists of file. A non-positive interval
+// disables the reloading.
+func NewCRLChecker(file string, interval time.Duration, confined bool) (*CRLChecker, error) {
+	if confined {
+		file = confinedCertFile(file)
+	}
+	c := &CRLChecker{file: file, interval: interval}
+	err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *CRLChecker) load() error {
+	info, err := os.Stat(c.file)
+	if err != nil {
+		return err
+	}
+	content, err := ioutil.ReadFile(c.file)
+	if err != nil {
+		return err
+	}
+	entries, err := parseCRLs(content)
+	if err != nil {
+		return eerrors.Wrapf(err, "Error parsing the CRL file '%s'", c.file)
+	}
+	c.entries = entries
+	c.mod = info.ModTime()
+	c.lastCheck = time.Now()
+	return nil
+}
+
+func parseCRLs(content []byte) ([]*crlEntry, error) {
+	var ders [][]byte
+	if bytes.Contains(content, []byte("-----BEGIN")) {
+		rest := content
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			if block.Type == "X509 CRL" {
+				ders = append(ders, block.Bytes)
+			}
+		}
+		if len(ders) == 0 {
+			return nil, eerrors.New("No CRL found in the PEM file")
+		}
+	} else {
+		ders = append(ders, content)
+	}
+	entries := make([]*crlEntry, 0, len(ders))
+	for _, der := range ders {
+		list, err := x509.ParseRevocationList(der)
+		if err != nil {
+			return nil, err
+		}
+		entry := &crlEntry{list: list, revoked: make(map[string]struct{}, len(list.RevokedCertificateEntries))}
+		for _, revoked := range list.RevokedCertificateEntries {
+			entry.revoked[revoked.SerialNumber.String()] = struct{}{}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Len returns the number of the loaded revocation lists.
+func (c *CRLChecker) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Check returns a *CertRevokedError when the first certificate of chain has
+// been revoked, or a *RevocationUnknownError when no valid CRL of its issuer
+// is loaded. The second certificate of the chain, when present, is the
+// issuer: it must have signed the CRL.
+func (c *CRLChecker) Check(chain []*x509.Certificate) error {
+	if len(chain) == 0 {
+		return nil
+	}
+	cert := chain[0]
+	var issuer *x509.Certificate
+	if len(chain) > 1 {
+		issuer = chain[1]
+	}
+	serial := cert.SerialNumber.String()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reload()
+
+	entry := c.find(cert.RawIssuer)
+	if entry == nil {
+		return &RevocationUnknownError{Serial: serial, Reason: "no CRL from the issuer"}
+	}
+	if issuer != nil && !bytes.Equal(entry.verifiedBy, issuer.Raw) {
+		err := entry.list.CheckSignatureFrom(issuer)
+		if err != nil {
+			return &RevocationUnknownError{Serial: serial, Reason: "invalid CRL signature: " + err.Error()}
+		}
+		entry.verifiedBy = issuer.Raw
+	}
+	if !entry.list.NextUpdate.IsZero() && time.Now().After(entry.list.NextUpdate) {
+		return &RevocationUnknownError{Serial: serial, Reason: "the CRL has expired"}
+	}
+	if _, ok := entry.revoked[serial]; ok {
+		return &CertRevokedError{Serial: serial, Subject: cert.Subject.String()}
+	}
+	return nil
+}
+
+func (c *CRLChecker) find(rawIssuer []byte) *crlEntry {
+	for _, entry := range c.entries {
+		if bytes.Equal(entry.list.RawIssuer, rawIssuer) {
+			return entry
+		}
+	}
+	return nil
+}
+
+func (c *CRLChecker) reload() {
+	if c.interval <= 0 || time.Since(c.lastCheck) < c.interval {
+		return
+	}
+	c.lastCheck = time.Now()
+	info, err := os.Stat(c.file)
+	if err != nil || info.ModTime().Equal(c.mod) {
+		return
+	}
+	// on error, the file may be in the middle of being replaced: keep the
+	// previous lists, and retry at the next interval
+	err = c.load()
+	if c.OnReload != nil {
+		c.OnReload(len(c.entries), err)
+	}
+}
@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) client(t *testing.T, serial int64) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func (ca *testCA) writeCRL(t *testing.T, file string, number int64, nextUpdate time.Time, revoked ...int64) {
+	tmpl := &x509.RevocationList{
+		Number:     big.NewInt(number),
+		ThisUpdate: time.Now().Add(-time.Hour),
+		NextUpdate: nextUpdate,
+	}
+	for _, serial := range revoked {
+		tmpl.RevokedCertificateEntries = append(tmpl.RevokedCertificateEntries, x509.RevocationListEntry{
+			SerialNumber:   big.NewInt(serial),
+			RevocationTime: time.Now().Add(-time.Minute),
+		})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, tmpl, ca.cert, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCRLChecker(t *testing.T) {
+	dir, err := ioutil.TempDir("", "skewer-crl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	ca := newTestCA(t, "ca")
+	good := ca.client(t, 10)
+	revoked := ca.client(t, 11)
+	crlFile := filepath.Join(dir, "ca.crl")
+	ca.writeCRL(t, crlFile, 1, time.Now().Add(time.Hour), 11)
+
+	checker, err := NewCRLChecker(crlFile, time.Millisecond, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reloads []int
+	checker.OnReload = func(n int, err error) {
+		if err != nil {
+			t.Errorf("unexpected reload error: %v", err)
+		}
+		reloads = append(reloads, n)
+	}
+	err = checker.Check([]*x509.Certificate{good, ca.cert})
+	if err != nil {
+		t.Fatalf("the good certificate should be accepted: %v", err)
+	}
+	err = checker.Check([]*x509.Certificate{revoked, ca.cert})
+	if e, ok := err.(*CertRevokedError); !ok || e.Serial != "11" {
+		t.Fatalf("the certificate should be revoked: %v", err)
+	}
+	// without the issuer, the CRL is found by the issuer name
+	if _, ok := checker.Check([]*x509.Certificate{revoked}).(*CertRevokedError); !ok {
+		t.Fatal("the unverified certificate should be revoked")
+	}
+
+	// no CRL for the certificates of another CA
+	other := newTestCA(t, "other")
+	err = checker.Check([]*x509.Certificate{other.client(t, 11), other.cert})
+	if _, ok := err.(*RevocationUnknownError); !ok {
+		t.Fatalf("the status should be unknown without a CRL: %v", err)
+	}
+
+	// the new revocations apply without a restart
+	ca.writeCRL(t, crlFile, 2, time.Now().Add(time.Hour), 10, 11)
+	future := time.Now().Add(time.Minute)
+	err = os.Chtimes(crlFile, future, future)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if _, ok := checker.Check([]*x509.Certificate{good, ca.cert}).(*CertRevokedError); !ok {
+		t.Fatal("the CRL should have been reloaded")
+	}
+	if len(reloads) != 1 || reloads[0] != 1 {
+		t.Fatalf("unexpected reloads: %v", reloads)
+	}
+
+	// an expired CRL does not tell the status
+	ca.writeCRL(t, crlFile, 3, time.Now().Add(-time.Minute), 11)
+	checker, err = NewCRLChecker(crlFile, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := checker.Check([]*x509.Certificate{good, ca.cert}).(*RevocationUnknownError); !ok {
+		t.Fatal("the status should be unknown with an expired CRL")
+	}
+
+	// a CRL signed by another key is not trusted
+	forged := &testCA{cert: ca.cert, key: other.key}
+	forged.writeCRL(t, crlFile, 4, time.Now().Add(time.Hour))
+	checker, err = NewCRLChecker(crlFile, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := checker.Check([]*x509.Certificate{revoked, ca.cert}).(*RevocationUnknownError); !ok {
+		t.Fatal("the status should be unknown with a forged CRL")
+	}
+}
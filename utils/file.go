@@ -19,6 +19,7 @@ type OFile struct {
 	writer     *concurrent.Writer
 	gzipwriter *cGzipWriter
 	syncmu     sync.Mutex
+	writemu    sync.Mutex
 	refs       atomic.Int32
 	logger     log15.Logger
 }
@@ -61,8 +62,12 @@ func (o *OFile) Expired() bool {
 	return time.Now().After(time.Unix(0, o.closeAt.Load()))
 }
 
+// Write writes a complete record to the file. It may be called concurrently:
+// the records are serialized, so that a record is never interleaved with
+// another one, even when it does not fit in the buffer.
 func (o *OFile) Write(p []byte) (int, error) {
-	// may be called concurrently
+	o.writemu.Lock()
+	defer o.writemu.Unlock()
 	return o.writer.Write(p)
 }
 
@@ -70,6 +75,18 @@ func (o *OFile) Flush() (err error) {
 	return o.writer.Flush()
 }
 
+// FlushAll flushes the buffer and then the gzip stream, so that the records
+// written so far are complete in the file, even when it is compressed.
+func (o *OFile) FlushAll() (err error) {
+	err = o.writer.Flush()
+	if err != nil || o.gzipwriter == nil {
+		return err
+	}
+	o.syncmu.Lock()
+	defer o.syncmu.Unlock()
+	return o.gzipwriter.Flush()
+}
+
 func (o *OFile) Sync() (err error) {
 	// may be called concurrently
 	o.syncmu.Lock()
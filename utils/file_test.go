@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+func TestOFileConcurrentWrites(t *testing.T) {
+	dir, err := ioutil.TempDir("", "skewer-ofile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	filename := filepath.Join(dir, "out.log")
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	// a small buffer, so that some records do not fit in it
+	o := NewOFile(f, filename, time.Now().Add(time.Minute), 64, false, 0, logger)
+	o.Acquire()
+
+	workers := 8
+	records := 200
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < records; i++ {
+				record := fmt.Sprintf("%d %d %s\n", w, i, strings.Repeat("x", (i%5)*40))
+				_, err := o.Write([]byte(record))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	o.Release()
+
+	out, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = out.Close() }()
+	scanner := bufio.NewScanner(out)
+	lines := 0
+	for scanner.Scan() {
+		var w, i int
+		var padding string
+		line := scanner.Text()
+		_, _ = fmt.Sscanf(line, "%d %d %s", &w, &i, &padding)
+		if line != fmt.Sprintf("%d %d %s", w, i, strings.Repeat("x", (i%5)*40)) {
+			t.Fatalf("torn line: %q", line)
+		}
+		lines++
+	}
+	if lines != workers*records {
+		t.Fatalf("expected %d lines, got %d", workers*records, lines)
+	}
+}
+
+func TestOFileFlushAllGzip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "skewer-ofile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	filename := filepath.Join(dir, "out.log.gz")
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	o := NewOFile(f, filename, time.Now().Add(time.Minute), 4096, true, gzip.DefaultCompression, logger)
+	o.Acquire()
+	defer o.Release()
+
+	record := "hello world\n"
+	_, err = o.Write([]byte(record))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = o.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the record is still in the gzip stream
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(content) > 0 {
+		if r, err := gzip.NewReader(bytes.NewReader(content)); err == nil {
+			if b, _ := ioutil.ReadAll(r); len(b) != 0 {
+				t.Fatalf("the record should not be readable before FlushAll: %q", b)
+			}
+		}
+	}
+
+	err = o.FlushAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err = ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the stream is not closed: the reader stops with an unexpected EOF after
+	// the flushed records
+	b := make([]byte, len(record))
+	_, err = io.ReadFull(r, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != record {
+		t.Fatalf("expected %q, got %q", record, b)
+	}
+}
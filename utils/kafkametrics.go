@@ -7,13 +7,16 @@ import (
 	metrics "github.com/rcrowley/go-metrics"
 )
 
-func KafkaProducerMetrics(mregistry metrics.Registry, basename string) (collectors []prometheus.Collector) {
+// KafkaProducerMetrics exposes the metrics of a Kafka producer. The labels
+// distinguish the producers that share the same basename.
+func KafkaProducerMetrics(mregistry metrics.Registry, basename string, labels prometheus.Labels) (collectors []prometheus.Collector) {
 	collectors = make([]prometheus.Collector, 0)
 
 	collectors = append(collectors, prometheus.NewGaugeFunc(
 		prometheus.GaugeOpts{
-			Help: "Kafka mean outgoing bytes/s rate",
-			Name: fmt.Sprintf(basename + "_outgoing_byte_rate"),
+			Help:        "Kafka mean outgoing bytes/s rate",
+			ConstLabels: labels,
+			Name:        fmt.Sprintf(basename + "_outgoing_byte_rate"),
 		},
 		func() float64 {
 			meter := mregistry.Get("outgoing-byte-rate")
@@ -26,8 +29,9 @@ func KafkaProducerMetrics(mregistry metrics.Registry, basename string) (collecto
 
 	collectors = append(collectors, prometheus.NewGaugeFunc(
 		prometheus.GaugeOpts{
-			Help: "Kafka mean outgoing requests/s rate",
-			Name: fmt.Sprintf(basename + "_request_rate"),
+			Help:        "Kafka mean outgoing requests/s rate",
+			ConstLabels: labels,
+			Name:        fmt.Sprintf(basename + "_request_rate"),
 		},
 		func() float64 {
 			meter := mregistry.Get("request-rate")
@@ -40,8 +44,9 @@ func KafkaProducerMetrics(mregistry metrics.Registry, basename string) (collecto
 
 	collectors = append(collectors, prometheus.NewGaugeFunc(
 		prometheus.GaugeOpts{
-			Help: "Kafka mean request size",
-			Name: fmt.Sprintf(basename + "_request_size"),
+			Help:        "Kafka mean request size",
+			ConstLabels: labels,
+			Name:        fmt.Sprintf(basename + "_request_size"),
 		},
 		func() float64 {
 			meter := mregistry.Get("request-size")
@@ -54,8 +59,9 @@ func KafkaProducerMetrics(mregistry metrics.Registry, basename string) (collecto
 
 	collectors = append(collectors, prometheus.NewGaugeFunc(
 		prometheus.GaugeOpts{
-			Help: "Kafka mean outgoing records/s rate",
-			Name: fmt.Sprintf(basename + "_record_rate"),
+			Help:        "Kafka mean outgoing records/s rate",
+			ConstLabels: labels,
+			Name:        fmt.Sprintf(basename + "_record_rate"),
 		},
 		func() float64 {
 			meter := mregistry.Get("record-send-rate")
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"hash/fnv"
+
+	"github.com/Shopify/sarama"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// InvalidPartitionCounter counts the messages whose manually computed
+// partition number was out of the range of the topic partitions.
+var InvalidPartitionCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "skw_kafka_invalid_partition_total",
+		Help: "number of messages with a partition number out of the topic partitions range",
+	},
+	[]string{"topic", "policy"},
+)
+
+// NewValidatingPartitioner returns a partitioner constructor that behaves
+// like the sarama manual partitioner, but checks the computed partition
+// number against the actual number of partitions of the topic. When the
+// partition number is out of range, policy says what to do:
+//   - "clamp": use the nearest valid partition
+//   - "mod": use the partition number modulo the number of partitions
+//   - "hash": use the hash of the message key
+//   - "error": let the producer fail the message
+func NewValidatingPartitioner(policy string) sarama.PartitionerConstructor {
+	return func(topic string) sarama.Partitioner {
+		return &validatingPartitioner{
+			topic:  topic,
+			policy: policy,
+			hash:   sarama.NewHashPartitioner(topic),
+		}
+	}
+}
+
+type validatingPartitioner struct {
+	topic  string
+	policy string
+	hash   sarama.Partitioner
+}
+
+func (p *validatingPartitioner) Partition(message *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	partition := message.Partition
+	if numPartitions <= 0 || (partition >= 0 && partition < numPartitions) {
+		return partition, nil
+	}
+	InvalidPartitionCounter.WithLabelValues(p.topic, p.policy).Inc()
+	switch p.policy {
+	case "clamp":
+		if partition < 0 {
+			return 0, nil
+		}
+		return numPartitions - 1, nil
+	case "mod":
+		partition = partition % numPartitions
+		if partition < 0 {
+			partition += numPartitions
+		}
+		return partition, nil
+	case "hash":
+		return p.hash.Partition(message, numPartitions)
+	default:
+		return partition, nil
+	}
+}
+
+func (p *validatingPartitioner) RequiresConsistency() bool {
+	return true
+}
+
+// NewUniformHashPartitioner returns a partitioner constructor that assigns
+// the messages to the partitions by a well mixed hash of the salted message
+// key. Like the sarama hash partitioner, the messages with the same key go to
+// the same partition. But the sarama FNV-1a hash, taken modulo a power of two,
+// only depends on the low bits of each byte of the key, so that similar keys
+// tend to share a few partitions.
+func NewUniformHashPartitioner(salt string) sarama.PartitionerConstructor {
+	return func(topic string) sarama.Partitioner {
+		return &uniformHashPartitioner{
+			salt:   []byte(salt),
+			random: sarama.NewRandomPartitioner(topic),
+		}
+	}
+}
+
+type uniformHashPartitioner struct {
+	salt   []byte
+	random sarama.Partitioner
+}
+
+func (p *uniformHashPartitioner) Partition(message *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	if message.Key == nil || numPartitions <= 0 {
+		return p.random.Partition(message, numPartitions)
+	}
+	key, err := message.Key.Encode()
+	if err != nil {
+		return -1, err
+	}
+	return int32(uniformHash(p.salt, key) % uint64(numPartitions)), nil
+}
+
+func (p *uniformHashPartitioner) RequiresConsistency() bool {
+	return true
+}
+
+// uniformHash returns the FNV-1a hash of salt and key, passed through the
+// murmur3 finalizer so that every bit of the input affects the low bits.
+func uniformHash(salt, key []byte) uint64 {
+	hasher := fnv.New64a()
+	_, _ = hasher.Write(salt)
+	_, _ = hasher.Write(key)
+	h := hasher.Sum64()
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func partitionCounts(t *testing.T, p sarama.Partitioner, keys []string, numPartitions int32) []int {
+	counts := make([]int, numPartitions)
+	for _, key := range keys {
+		partition, err := p.Partition(&sarama.ProducerMessage{Key: sarama.StringEncoder(key)}, numPartitions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[partition]++
+	}
+	return counts
+}
+
+func maxCount(counts []int) (max int) {
+	for _, c := range counts {
+		if c > max {
+			max = c
+		}
+	}
+	return max
+}
+
+func TestUniformHashPartitionerBalance(t *testing.T) {
+	// the bytes of the keys only differ by their high bits
+	suffixes := []byte("!1AQaq")
+	var keys []string
+	for _, c1 := range suffixes {
+		for _, c2 := range suffixes {
+			keys = append(keys, "host-"+string([]byte{c1, c2}))
+		}
+	}
+	var numPartitions int32 = 16
+
+	raw := partitionCounts(t, sarama.NewHashPartitioner("topic"), keys, numPartitions)
+	uniform := partitionCounts(t, NewUniformHashPartitioner("")("topic"), keys, numPartitions)
+	if maxCount(uniform) >= maxCount(raw) {
+		t.Fatalf("the uniform hash does not improve the balance: raw=%v uniform=%v", raw, uniform)
+	}
+	if maxCount(uniform) > len(keys)/4 {
+		t.Fatalf("the uniform hash is unbalanced: %v", uniform)
+	}
+}
+
+func TestUniformHashPartitionerColocation(t *testing.T) {
+	p := NewUniformHashPartitioner("salt")("topic")
+	salted := partitionCounts(t, p, []string{"key", "key", "key"}, 16)
+	if maxCount(salted) != 3 {
+		t.Fatalf("the messages with the same key are not co-located: %v", salted)
+	}
+	if uniformHash([]byte("salt"), []byte("key")) == uniformHash(nil, []byte("key")) {
+		t.Fatal("the salt does not change the hash")
+	}
+}
+
+func invalidPartitions(t *testing.T, topic, policy string) float64 {
+	var m dto.Metric
+	if err := InvalidPartitionCounter.WithLabelValues(topic, policy).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestValidatingPartitioner(t *testing.T) {
+	key := sarama.StringEncoder("host1")
+	hashed, err := sarama.NewHashPartitioner("logs").Partition(&sarama.ProducerMessage{Key: key}, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		policy    string
+		partition int32
+		// numPartitions is 0 when the count of the topic is not known
+		numPartitions int32
+		expected      int32
+		invalid       bool
+	}{
+		{"clamp", 2, 4, 2, false},
+		{"clamp", 0, 4, 0, false},
+		{"clamp", 4, 4, 3, true},
+		{"clamp", 17, 4, 3, true},
+		{"clamp", -1, 4, 0, true},
+		{"clamp", 17, 0, 17, false},
+		{"mod", 3, 4, 3, false},
+		{"mod", 4, 4, 0, true},
+		{"mod", 17, 4, 1, true},
+		{"mod", -1, 4, 3, true},
+		{"mod", -6, 4, 2, true},
+		{"hash", 1, 4, 1, false},
+		{"hash", 9, 4, hashed, true},
+		{"hash", -3, 4, hashed, true},
+		{"error", 1, 4, 1, false},
+		// the producer fails the message
+		{"error", 9, 4, 9, true},
+	}
+	for _, tt := range tests {
+		topic := "logs"
+		before := invalidPartitions(t, topic, tt.policy)
+		p := NewValidatingPartitioner(tt.policy)(topic)
+		partition, err := p.Partition(&sarama.ProducerMessage{Key: key, Partition: tt.partition}, tt.numPartitions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if partition != tt.expected {
+			t.Errorf("%s: partition %d of %d: expected %d, got %d", tt.policy, tt.partition, tt.numPartitions, tt.expected, partition)
+		}
+		invalid := invalidPartitions(t, topic, tt.policy) - before
+		if (invalid == 1) != tt.invalid || invalid > 1 {
+			t.Errorf("%s: partition %d of %d: unexpected count of invalid partitions: %v", tt.policy, tt.partition, tt.numPartitions, invalid)
+		}
+		if !p.RequiresConsistency() {
+			t.Errorf("%s: the partitioner should require consistency", tt.policy)
+		}
+	}
+}
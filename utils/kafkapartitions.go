@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"sync"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// KafkaPartitionsGauge reports the last known number of partitions of the
+// Kafka topics that the partition functions are given.
+var KafkaPartitionsGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "skw_kafka_partitions",
+		Help: "last known number of partitions of the Kafka topics",
+	},
+	[]string{"topic"},
+)
+
+// KafkaPartitionRefreshCounter counts the fetches of the partition counts
+// from the cluster metadata.
+var KafkaPartitionRefreshCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "skw_kafka_partition_refresh_total",
+		Help: "number of refreshes of the partition counts of the Kafka topics",
+	},
+	[]string{"status"},
+)
+
+// PartitionsClient is the part of the sarama client that knows the
+// partitions of the topics.
+type PartitionsClient interface {
+	RefreshMetadata(topics ...string) error
+	Partitions(topic string) ([]int32, error)
+}
+
+// PartitionCounts caches the partition counts of Kafka topics. Get never
+// waits for the cluster: the counts are fetched by Run, when a topic is
+// first asked for, and then periodically. When the metadata can not be
+// fetched, the last known counts are kept.
+type PartitionCounts struct {
+	// clients are the clients of the producers: the producers partition the
+	// messages with the metadata of their own client, so that they are all
+	// refreshed.
+	clients []PartitionsClient
+	logger  log15.Logger
+	mu      sync.Mutex
+	// counts is 0 for the topics whose count is not known: they are not
+	// fetched again before the next refresh
+	counts map[string]int32
+	added  chan struct{}
+}
+
+// NewPartitionCounts returns a cache of the partition counts, fetched with
+// the metadata of clients.
+func NewPartitionCounts(logger log15.Logger, clients ...PartitionsClient) *PartitionCounts {
+	return &PartitionCounts{
+		clients: clients,
+		logger:  logger,
+		counts:  make(map[string]int32),
+		added:   make(chan struct{}, 1),
+	}
+}
+
+// Get returns the last known partition count of topic, or 0 when it is not
+// known. The count of a new topic is fetched by Run.
+func (p *PartitionCounts) Get(topic string) int32 {
+	p.mu.Lock()
+	n, ok := p.counts[topic]
+	if !ok {
+		p.counts[topic] = 0
+	}
+	p.mu.Unlock()
+	if !ok {
+		select {
+		case p.added <- struct{}{}:
+		default:
+		}
+	}
+	return n
+}
+
+// topics returns the known topics, or only the ones whose count is unknown.
+func (p *PartitionCounts) topics(unknown bool) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	topics := make([]string, 0, len(p.counts))
+	for topic, n := range p.counts {
+		if !unknown || n == 0 {
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
+
+func (p *PartitionCounts) fetch(topic string) (int32, error) {
+	for _, client := range p.clients {
+		err := client.RefreshMetadata(topic)
+		if err != nil {
+			return 0, err
+		}
+	}
+	partitions, err := p.clients[0].Partitions(topic)
+	if err != nil {
+		return 0, err
+	}
+	return int32(len(partitions)), nil
+}
+
+// Refresh fetches the partition counts of the known topics.
+func (p *PartitionCounts) Refresh() {
+	p.refresh(p.topics(false))
+}
+
+func (p *PartitionCounts) refresh(topics []string) {
+	if len(topics) == 0 || len(p.clients) == 0 {
+		return
+	}
+	for _, topic := range topics {
+		n, err := p.fetch(topic)
+		if err != nil || n == 0 {
+			KafkaPartitionRefreshCounter.WithLabelValues("fail").Inc()
+			p.logger.Info("Failed to fetch the Kafka partition count", "topic", topic, "error", err)
+			continue
+		}
+		KafkaPartitionRefreshCounter.WithLabelValues("success").Inc()
+		p.mu.Lock()
+		previous := p.counts[topic]
+		p.counts[topic] = n
+		p.mu.Unlock()
+		if previous != 0 && n != previous {
+			p.logger.Info("The partition count of a Kafka topic has changed", "topic", topic, "previous", previous, "partitions", n)
+		}
+		KafkaPartitionsGauge.WithLabelValues(topic).Set(float64(n))
+	}
+}
+
+// Run fetches the counts of the new topics, and refreshes all the counts
+// every interval, until stop is closed. An interval of 0 disables the
+// periodic refresh.
+func (p *PartitionCounts) Run(interval time.Duration, stop <-chan struct{}) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-stop:
+			return
+		case <-p.added:
+			p.refresh(p.topics(true))
+		case <-tick:
+			p.Refresh()
+		}
+	}
+}
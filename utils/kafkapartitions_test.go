@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/inconshreveable/log15"
+)
+
+// fakePartitionsClient is a PartitionsClient whose metadata fetches fail
+// when fail is set. The topics of missing have no partitions.
+type fakePartitionsClient struct {
+	partitions int32
+	fail       bool
+	missing    map[string]bool
+	fetches    int
+}
+
+func (c *fakePartitionsClient) RefreshMetadata(topics ...string) error {
+	c.fetches++
+	if c.fail {
+		return sarama.ErrOutOfBrokers
+	}
+	return nil
+}
+
+func (c *fakePartitionsClient) Partitions(topic string) ([]int32, error) {
+	if c.fail {
+		return nil, sarama.ErrOutOfBrokers
+	}
+	if c.missing[topic] {
+		return nil, sarama.ErrUnknownTopicOrPartition
+	}
+	return make([]int32, c.partitions), nil
+}
+
+func TestPartitionCounts(t *testing.T) {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	client := &fakePartitionsClient{partitions: 4, missing: map[string]bool{"missing": true}}
+	counts := NewPartitionCounts(logger, client)
+
+	// Get does not fetch the metadata
+	if n := counts.Get("skewer"); n != 0 {
+		t.Fatalf("the count should not be known before the refresh, got %d", n)
+	}
+	if n := counts.Get("missing"); n != 0 {
+		t.Fatalf("the count of an unknown topic should be 0, got %d", n)
+	}
+	if client.fetches != 0 {
+		t.Fatal("Get should not fetch the metadata")
+	}
+	counts.Refresh()
+	if n := counts.Get("skewer"); n != 4 {
+		t.Fatalf("expected 4 partitions, got %d", n)
+	}
+
+	// the unknown topics are not fetched again before the next refresh
+	fetches := client.fetches
+	for i := 0; i < 10; i++ {
+		counts.Get("missing")
+	}
+	if client.fetches != fetches {
+		t.Fatal("the unknown topic should not be fetched again")
+	}
+
+	client.partitions = 8
+	if n := counts.Get("skewer"); n != 4 {
+		t.Fatalf("the partition count should be cached until the refresh, got %d", n)
+	}
+	counts.Refresh()
+	if n := counts.Get("skewer"); n != 8 {
+		t.Fatalf("expected 8 partitions after the refresh, got %d", n)
+	}
+
+	// a failed refresh keeps the last known count
+	client.fail = true
+	counts.Refresh()
+	if n := counts.Get("skewer"); n != 8 {
+		t.Fatalf("the last known count should be kept, got %d", n)
+	}
+}
+
+func TestPartitionCountsRun(t *testing.T) {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	client := &fakePartitionsClient{partitions: 4}
+	counts := NewPartitionCounts(logger, client)
+	stop := make(chan struct{})
+	defer close(stop)
+	// without the periodic refresh, the new topics are fetched anyway
+	go counts.Run(0, stop)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for counts.Get("skewer") != 4 {
+		if time.Now().After(deadline) {
+			t.Fatal("the count of the new topic was not fetched")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"sync"
+
+	"go.uber.org/atomic"
+)
+
+// OtherLabel replaces the label values beyond the limit of a LabelLimiter.
+const OtherLabel = "_other"
+
+// LabelLimiter bounds the number of distinct values of a metric label, so
+// that the values chosen by the clients (client identifiers, topics) can't
+// create an unbounded number of series. The values beyond the limit are
+// replaced with OtherLabel.
+type LabelLimiter struct {
+	max    atomic.Int64
+	mu     sync.Mutex
+	values map[string]int
+}
+
+// NewLabelLimiter returns a LabelLimiter that accepts max distinct values.
+// A non-positive max disables the limit.
+func NewLabelLimiter(max int) *LabelLimiter {
+	l := &LabelLimiter{values: make(map[string]int)}
+	l.SetMax(max)
+	return l
+}
+
+// SetMax changes the limit. The values that were already accepted are kept.
+func (l *LabelLimiter) SetMax(max int) {
+	l.max.Store(int64(max))
+}
+
+// Acquire returns value when it is already used or when the limit is not
+// reached, and OtherLabel otherwise. The accepted values are counted until
+// they are released.
+func (l *LabelLimiter) Acquire(value string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n, ok := l.values[value]
+	if !ok {
+		max := l.max.Load()
+		if max > 0 && int64(len(l.values)) >= max {
+			return OtherLabel
+		}
+	}
+	l.values[value] = n + 1
+	return value
+}
+
+// Release releases an accepted value. The value is forgotten when it has
+// been released as many times as it was acquired.
+func (l *LabelLimiter) Release(value string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n, ok := l.values[value]
+	if !ok {
+		return
+	}
+	if n <= 1 {
+		delete(l.values, value)
+		return
+	}
+	l.values[value] = n - 1
+}
+
+// Reset forgets all the values.
+func (l *LabelLimiter) Reset() {
+	l.mu.Lock()
+	l.values = make(map[string]int)
+	l.mu.Unlock()
+}
@@ -0,0 +1,36 @@
+package utils
+
+import "testing"
+
+func TestLabelLimiter(t *testing.T) {
+	l := NewLabelLimiter(2)
+	for _, value := range []string{"a", "b", "a"} {
+		if v := l.Acquire(value); v != value {
+			t.Fatalf("%s should be accepted, got %s", value, v)
+		}
+	}
+	if v := l.Acquire("c"); v != OtherLabel {
+		t.Fatalf("c is beyond the limit, got %s", v)
+	}
+	// a is still used once
+	l.Release("a")
+	if v := l.Acquire("c"); v != OtherLabel {
+		t.Fatalf("c is beyond the limit, got %s", v)
+	}
+	l.Release("a")
+	if v := l.Acquire("c"); v != "c" {
+		t.Fatalf("c should be accepted after a was released, got %s", v)
+	}
+	l.SetMax(-1)
+	if v := l.Acquire("d"); v != "d" {
+		t.Fatalf("the limit is disabled, got %s", v)
+	}
+	l.SetMax(1)
+	l.Reset()
+	if v := l.Acquire("e"); v != "e" {
+		t.Fatalf("e should be accepted after a reset, got %s", v)
+	}
+	if v := l.Acquire("f"); v != OtherLabel {
+		t.Fatalf("f is beyond the limit, got %s", v)
+	}
+}
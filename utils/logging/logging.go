@@ -1,7 +1,9 @@
 package logging
 
 import (
+	"fmt"
 	"log/syslog"
+	"os"
 	"strings"
 
 	"github.com/inconshreveable/log15"
@@ -12,17 +14,35 @@ const timeKey = "t"
 const lvlKey = "lvl"
 const msgKey = "msg"
 
-func SetupLogging(logger log15.Logger, level string, logJson bool, logSyslog bool, filename string) (log15.Logger, error) {
+// FormatEnv is the environment variable that propagates the log format from
+// the parent process to its children, so that everything they write to stderr
+// matches the format of the parent logs.
+const FormatEnv = "SKEWER_LOG_FORMAT"
+
+// Formats lists the supported formats for the internal logs.
+var Formats = []string{"logfmt", "json"}
+
+// GetFormat returns the log15 formatter for the given format name.
+func GetFormat(format string) (log15.Format, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", "logfmt":
+		return log15.LogfmtFormat(), nil
+	case "json":
+		return log15.JsonFormat(), nil
+	default:
+		return nil, eerrors.Errorf("Unknown log format '%s' (should be one of: %s)", format, strings.Join(Formats, ", "))
+	}
+}
+
+func SetupLogging(logger log15.Logger, level string, format string, logSyslog bool, filename string) (log15.Logger, error) {
 	if logger == nil {
 		logger = log15.New()
 	}
-	handlers := []log15.Handler{}
-	var formatter log15.Format
-	if logJson {
-		formatter = log15.JsonFormat()
-	} else {
-		formatter = log15.LogfmtFormat()
+	formatter, err := GetFormat(format)
+	if err != nil {
+		return nil, err
 	}
+	handlers := []log15.Handler{}
 	if logSyslog {
 		h, err := log15.SyslogHandler(syslog.LOG_LOCAL0|syslog.LOG_DEBUG, "skewer", formatter)
 		if err != nil {
@@ -39,7 +59,7 @@ func SetupLogging(logger log15.Logger, level string, logJson bool, logSyslog boo
 		handlers = append(handlers, h)
 	}
 	if len(handlers) == 0 {
-		handlers = []log15.Handler{log15.StderrHandler}
+		handlers = []log15.Handler{log15.StreamHandler(os.Stderr, formatter)}
 	}
 	handler := log15.MultiHandler(handlers...)
 
@@ -52,3 +72,26 @@ func SetupLogging(logger log15.Logger, level string, logJson bool, logSyslog boo
 	logger.SetHandler(handler)
 	return logger, nil
 }
+
+// StderrLogger returns a logger that writes to stderr, in the format that was
+// propagated by the parent process. It is used by the child processes when
+// they don't have a remote logger.
+func StderrLogger() log15.Logger {
+	logger := log15.New()
+	formatter, err := GetFormat(os.Getenv(FormatEnv))
+	if err != nil {
+		formatter = log15.LogfmtFormat()
+	}
+	logger.SetHandler(log15.StreamHandler(os.Stderr, formatter))
+	return logger
+}
+
+// PrintFatal writes a fatal error to stderr, in the format that was
+// propagated by the parent process.
+func PrintFatal(err error) {
+	if strings.ToLower(os.Getenv(FormatEnv)) == "json" {
+		StderrLogger().Crit(err.Error())
+		return
+	}
+	fmt.Fprintln(os.Stderr, err.Error())
+}
@@ -0,0 +1,91 @@
+package logging
+
+import (
+	"sync"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+type rateLimitKey struct {
+	lvl log15.Lvl
+	msg string
+}
+
+type rateLimitEntry struct {
+	count      int
+	suppressed int
+}
+
+// RateLimitHandler lets through at most burst records with the same level and
+// message during window. The next ones are dropped, and a summary with the
+// number of suppressed records is logged when the window ends. The handler
+// does nothing if window or burst is not positive.
+func RateLimitHandler(window time.Duration, burst int, h log15.Handler) log15.Handler {
+	if window <= 0 || burst <= 0 {
+		return h
+	}
+	return &rateLimitHandler{
+		h:       h,
+		window:  window,
+		burst:   burst,
+		entries: make(map[rateLimitKey]*rateLimitEntry),
+	}
+}
+
+// RateLimited returns a child of logger whose records are rate-limited by a
+// RateLimitHandler. It is meant for the error logs of the hot paths, that
+// would otherwise emit one line per message when a downstream breaks.
+func RateLimited(logger log15.Logger, window time.Duration, burst int) log15.Logger {
+	l := logger.New()
+	l.SetHandler(RateLimitHandler(window, burst, logger.GetHandler()))
+	return l
+}
+
+type rateLimitHandler struct {
+	h       log15.Handler
+	window  time.Duration
+	burst   int
+	mu      sync.Mutex
+	entries map[rateLimitKey]*rateLimitEntry
+}
+
+func (h *rateLimitHandler) Log(r *log15.Record) error {
+	key := rateLimitKey{lvl: r.Lvl, msg: r.Msg}
+	h.mu.Lock()
+	e, ok := h.entries[key]
+	if !ok {
+		e = &rateLimitEntry{}
+		h.entries[key] = e
+		time.AfterFunc(h.window, func() { h.endWindow(key) })
+	}
+	e.count++
+	if e.count > h.burst {
+		e.suppressed++
+		h.mu.Unlock()
+		return nil
+	}
+	h.mu.Unlock()
+	return h.h.Log(r)
+}
+
+func (h *rateLimitHandler) endWindow(key rateLimitKey) {
+	h.mu.Lock()
+	e := h.entries[key]
+	delete(h.entries, key)
+	h.mu.Unlock()
+	if e == nil || e.suppressed == 0 {
+		return
+	}
+	_ = h.h.Log(&log15.Record{
+		Time: time.Now(),
+		Lvl:  key.lvl,
+		Msg:  "Suppressed repeated log messages",
+		Ctx:  []interface{}{"message", key.msg, "suppressed", e.suppressed, "window", h.window.String()},
+		KeyNames: log15.RecordKeyNames{
+			Time: timeKey,
+			Msg:  msgKey,
+			Lvl:  lvlKey,
+		},
+	})
+}
@@ -0,0 +1,79 @@
+package logging
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+type recordingHandler struct {
+	mu      sync.Mutex
+	records []*log15.Record
+}
+
+func (h *recordingHandler) Log(r *log15.Record) error {
+	h.mu.Lock()
+	h.records = append(h.records, r)
+	h.mu.Unlock()
+	return nil
+}
+
+func (h *recordingHandler) msgs() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	msgs := make([]string, 0, len(h.records))
+	for _, r := range h.records {
+		msgs = append(msgs, r.Msg)
+	}
+	return msgs
+}
+
+func TestRateLimitHandler(t *testing.T) {
+	rec := &recordingHandler{}
+	logger := log15.New()
+	logger.SetHandler(rec)
+	limited := RateLimited(logger, 100*time.Millisecond, 3)
+
+	for i := 0; i < 20; i++ {
+		limited.Warn("downstream is broken", "i", i)
+	}
+	limited.Warn("another error")
+
+	msgs := rec.msgs()
+	if len(msgs) != 4 {
+		t.Fatalf("expected 3 repeated messages and 1 other message, got %v", msgs)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	rec.mu.Lock()
+	if len(rec.records) != 5 {
+		rec.mu.Unlock()
+		t.Fatalf("expected a summary at the end of the window, got %v", rec.msgs())
+	}
+	summary := rec.records[4]
+	rec.mu.Unlock()
+	if summary.Msg != "Suppressed repeated log messages" {
+		t.Fatalf("unexpected summary: %s", summary.Msg)
+	}
+	if summary.Ctx[1] != "downstream is broken" || summary.Ctx[3] != 17 {
+		t.Fatalf("unexpected summary context: %v", summary.Ctx)
+	}
+
+	// a new window lets the messages through again
+	limited.Warn("downstream is broken")
+	if len(rec.msgs()) != 6 {
+		t.Fatalf("expected the message to be logged in a new window, got %v", rec.msgs())
+	}
+}
+
+func TestRateLimitHandlerDisabled(t *testing.T) {
+	rec := &recordingHandler{}
+	if RateLimitHandler(0, 3, rec) != log15.Handler(rec) {
+		t.Fatal("a zero window should disable the rate limiting")
+	}
+	if RateLimitHandler(time.Second, 0, rec) != log15.Handler(rec) {
+		t.Fatal("a zero burst should disable the rate limiting")
+	}
+}
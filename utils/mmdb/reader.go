@@ -0,0 +1,450 @@
+// Package mmdb reads the MaxMind DB files (GeoLite2, GeoIP2...).
+//
+// The database file is memory mapped, and the lookups only decode the
+// requested fields.
+//
+// see https://maxmind.github.io/MaxMind-DB/
+package mmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net"
+	"os"
+
+	"github.com/stephane-martin/skewer/utils/eerrors"
+	"golang.org/x/sys/unix"
+)
+
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// maxDepth protects the decoder against the malformed databases that would
+// contain pointer loops.
+const maxDepth = 32
+
+// Reader looks up IP addresses in a MaxMind DB file.
+type Reader struct {
+	buf        []byte
+	mapped     bool
+	tree       []byte
+	data       decoder
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint
+}
+
+// Open memory maps the given MaxMind DB file.
+func Open(filename string) (*Reader, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, eerrors.Wrap(err, "Failed to open the MaxMind database")
+	}
+	defer func() { _ = f.Close() }()
+	stats, err := f.Stat()
+	if err != nil {
+		return nil, eerrors.Wrap(err, "Failed to stat the MaxMind database")
+	}
+	if stats.Size() == 0 || int64(int(stats.Size())) != stats.Size() {
+		return nil, eerrors.Errorf("Invalid MaxMind database size: %d", stats.Size())
+	}
+	buf, err := unix.Mmap(int(f.Fd()), 0, int(stats.Size()), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return nil, eerrors.Wrap(err, "Failed to mmap the MaxMind database")
+	}
+	r, err := FromBytes(buf)
+	if err != nil {
+		_ = unix.Munmap(buf)
+		return nil, err
+	}
+	r.mapped = true
+	return r, nil
+}
+
+// FromBytes returns a Reader for a MaxMind DB that is already in memory.
+func FromBytes(buf []byte) (*Reader, error) {
+	idx := bytes.LastIndex(buf, metadataMarker)
+	if idx == -1 {
+		return nil, eerrors.New("Invalid MaxMind database: metadata not found")
+	}
+	meta := decoder{buf: buf[idx+len(metadataMarker):]}
+	r := &Reader{buf: buf}
+	for key, dst := range map[string]*uint{"node_count": &r.nodeCount, "record_size": &r.recordSize, "ip_version": &r.ipVersion} {
+		v, err := meta.lookup(0, key)
+		if err != nil {
+			return nil, eerrors.Wrap(err, "Invalid MaxMind database metadata")
+		}
+		n, ok := v.(uint64)
+		if !ok {
+			return nil, eerrors.Errorf("Invalid MaxMind database metadata: '%s' is missing", key)
+		}
+		*dst = uint(n)
+	}
+	switch r.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, eerrors.Errorf("Unsupported MaxMind database record size: %d", r.recordSize)
+	}
+	if r.ipVersion != 4 && r.ipVersion != 6 {
+		return nil, eerrors.Errorf("Unsupported MaxMind database IP version: %d", r.ipVersion)
+	}
+	// the node count is bounded first, so that the tree size can't overflow
+	if r.nodeCount > uint(idx) {
+		return nil, eerrors.New("Invalid MaxMind database: the search tree is truncated")
+	}
+	treeSize := r.nodeCount * r.recordSize / 4
+	if treeSize+16 > uint(idx) {
+		return nil, eerrors.New("Invalid MaxMind database: the search tree is truncated")
+	}
+	r.tree = buf[:treeSize]
+	r.data = decoder{buf: buf[treeSize+16 : idx]}
+
+	if r.ipVersion == 6 {
+		// IPv4 addresses are stored in the ::/96 subtree
+		node := uint(0)
+		for i := 0; i < 96 && node < r.nodeCount; i++ {
+			node = r.record(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+// Close releases the memory mapped database. The Reader must not be used
+// afterwards.
+func (r *Reader) Close() error {
+	if r.mapped && r.buf != nil {
+		buf := r.buf
+		r.buf = nil
+		return unix.Munmap(buf)
+	}
+	return nil
+}
+
+func (r *Reader) record(node uint, bit uint) uint {
+	switch r.recordSize {
+	case 24:
+		b := r.tree[node*6+bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := r.tree[node*7:]
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		b := r.tree[node*8+bit*4:]
+		return uint(binary.BigEndian.Uint32(b))
+	}
+}
+
+// Lookup returns the value found at path in the record associated with ip.
+// It returns nil when the database has no record for ip, or when the record
+// has no such path.
+func (r *Reader) Lookup(ip net.IP, path ...string) (interface{}, error) {
+	if r.buf == nil {
+		return nil, eerrors.New("The MaxMind database is closed")
+	}
+	node := uint(0)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		node = r.ipv4Start
+	} else if r.ipVersion == 4 {
+		return nil, eerrors.New("IPv6 lookup in an IPv4-only MaxMind database")
+	}
+	nbits := uint(len(ip) * 8)
+	for i := uint(0); i < nbits && node < r.nodeCount; i++ {
+		bit := uint(ip[i>>3]>>(7-(i&7))) & 1
+		node = r.record(node, bit)
+	}
+	if node == r.nodeCount {
+		// not found
+		return nil, nil
+	}
+	if node < r.nodeCount {
+		return nil, eerrors.New("Invalid MaxMind database: the search tree is too deep")
+	}
+	offset := node - r.nodeCount - 16
+	if offset >= uint(len(r.data.buf)) {
+		return nil, eerrors.New("Invalid MaxMind database: data pointer out of range")
+	}
+	return r.data.lookup(offset, path...)
+}
+
+type decoder struct {
+	buf []byte
+}
+
+func (d *decoder) errTruncated() error {
+	return eerrors.New("Invalid MaxMind database: truncated data")
+}
+
+// control decodes the control byte(s) of the field at offset. It returns the
+// type of the field, its size and the offset of its payload.
+func (d *decoder) control(offset uint) (typ int, size uint, newOffset uint, err error) {
+	if offset >= uint(len(d.buf)) {
+		return 0, 0, 0, d.errTruncated()
+	}
+	ctrl := d.buf[offset]
+	offset++
+	typ = int(ctrl >> 5)
+	if typ == typePointer {
+		return typ, uint(ctrl), offset, nil
+	}
+	if typ == typeExtended {
+		if offset >= uint(len(d.buf)) {
+			return 0, 0, 0, d.errTruncated()
+		}
+		typ = 7 + int(d.buf[offset])
+		offset++
+	}
+	size = uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint(len(d.buf)) {
+			return 0, 0, 0, d.errTruncated()
+		}
+		var v uint
+		for _, b := range d.buf[offset : offset+n] {
+			v = v<<8 | uint(b)
+		}
+		offset += n
+		switch n {
+		case 1:
+			size = 29 + v
+		case 2:
+			size = 285 + v
+		default:
+			size = 65821 + v
+		}
+	}
+	return typ, size, offset, nil
+}
+
+// pointer decodes a pointer whose control byte is ctrl.
+func (d *decoder) pointer(ctrl uint, offset uint) (target uint, newOffset uint, err error) {
+	n := ((ctrl >> 3) & 0x3) + 1
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, d.errTruncated()
+	}
+	var v uint
+	if n < 4 {
+		v = ctrl & 0x7
+	}
+	for _, b := range d.buf[offset : offset+n] {
+		v = v<<8 | uint(b)
+	}
+	switch n {
+	case 2:
+		v += 2048
+	case 3:
+		v += 526336
+	}
+	return v, offset + n, nil
+}
+
+// resolve follows the pointers starting at offset, and returns the type,
+// size and payload offset of the pointed field.
+func (d *decoder) resolve(offset uint) (typ int, size uint, payload uint, err error) {
+	for depth := 0; depth < maxDepth; depth++ {
+		typ, size, payload, err = d.control(offset)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		if typ != typePointer {
+			return typ, size, payload, nil
+		}
+		offset, _, err = d.pointer(size, payload)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	return 0, 0, 0, eerrors.New("Invalid MaxMind database: too many pointer indirections")
+}
+
+// lookup decodes the value found at path in the field at offset.
+func (d *decoder) lookup(offset uint, path ...string) (interface{}, error) {
+	for _, key := range path {
+		typ, size, payload, err := d.resolve(offset)
+		if err != nil {
+			return nil, err
+		}
+		if typ != typeMap {
+			return nil, nil
+		}
+		found := false
+		offset = payload
+		for i := uint(0); i < size; i++ {
+			k, err := d.decode(offset, 0)
+			if err != nil {
+				return nil, err
+			}
+			offset, err = d.skip(offset, 0)
+			if err != nil {
+				return nil, err
+			}
+			if s, ok := k.(string); ok && s == key {
+				found = true
+				break
+			}
+			offset, err = d.skip(offset, 0)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if !found {
+			return nil, nil
+		}
+	}
+	return d.decode(offset, 0)
+}
+
+// skip returns the offset that follows the field at offset.
+func (d *decoder) skip(offset uint, depth int) (uint, error) {
+	if depth > maxDepth {
+		return 0, eerrors.New("Invalid MaxMind database: data is too deeply nested")
+	}
+	typ, size, payload, err := d.control(offset)
+	if err != nil {
+		return 0, err
+	}
+	switch typ {
+	case typePointer:
+		_, next, err := d.pointer(size, payload)
+		return next, err
+	case typeMap:
+		size *= 2
+		fallthrough
+	case typeArray:
+		for i := uint(0); i < size; i++ {
+			payload, err = d.skip(payload, depth+1)
+			if err != nil {
+				return 0, err
+			}
+		}
+		return payload, nil
+	case typeBool:
+		return payload, nil
+	default:
+		if payload+size > uint(len(d.buf)) {
+			return 0, d.errTruncated()
+		}
+		return payload + size, nil
+	}
+}
+
+// decode decodes the field at offset. Maps are decoded as
+// map[string]interface{}, arrays as []interface{}, unsigned integers as
+// uint64, signed integers as int64 and floats as float64.
+func (d *decoder) decode(offset uint, depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, eerrors.New("Invalid MaxMind database: data is too deeply nested")
+	}
+	typ, size, payload, err := d.resolve(offset)
+	if err != nil {
+		return nil, err
+	}
+	if (typ == typeMap || typ == typeArray) && size > uint(len(d.buf))-payload {
+		// each element takes at least one byte: a malformed size must not
+		// make a huge allocation
+		return nil, d.errTruncated()
+	}
+	switch typ {
+	case typeMap:
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			k, err := d.decode(payload, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			payload, err = d.skip(payload, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.decode(payload, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			payload, err = d.skip(payload, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			if s, ok := k.(string); ok {
+				m[s] = v
+			}
+		}
+		return m, nil
+	case typeArray:
+		a := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			v, err := d.decode(payload, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			payload, err = d.skip(payload, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		return a, nil
+	case typeBool:
+		return size != 0, nil
+	}
+	if payload+size > uint(len(d.buf)) {
+		return nil, d.errTruncated()
+	}
+	b := d.buf[payload : payload+size]
+	switch typ {
+	case typeString:
+		return string(b), nil
+	case typeBytes:
+		return append([]byte(nil), b...), nil
+	case typeDouble:
+		if size != 8 {
+			return nil, eerrors.New("Invalid MaxMind database: bad double size")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case typeFloat:
+		if size != 4 {
+			return nil, eerrors.New("Invalid MaxMind database: bad float size")
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+	case typeUint16, typeUint32, typeUint64:
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, nil
+	case typeInt32:
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		return int64(int32(v)), nil
+	case typeUint128:
+		return append([]byte(nil), b...), nil
+	default:
+		return nil, eerrors.Errorf("Invalid MaxMind database: unknown data type %d", typ)
+	}
+}
@@ -0,0 +1,230 @@
+package mmdb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func encString(s string) []byte {
+	return append([]byte{byte(typeString<<5 | len(s))}, s...)
+}
+
+func encUint32(v uint32) []byte {
+	return []byte{byte(typeUint32<<5 | 4), byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+}
+
+func encUint16(v uint16) []byte {
+	return []byte{byte(typeUint16<<5 | 2), byte(v >> 8), byte(v)}
+}
+
+func encMap(kvs ...[]byte) []byte {
+	b := []byte{byte(typeMap<<5 | len(kvs)/2)}
+	for _, kv := range kvs {
+		b = append(b, kv...)
+	}
+	return b
+}
+
+// buildDB builds an IPv4 database with a single node: the addresses in
+// 0.0.0.0/1 point to the data record, the others are not found.
+func buildDB() []byte {
+	const nodeCount = 1
+	data := encMap(
+		encString("country"), encMap(encString("iso_code"), encString("FR")),
+		encString("autonomous_system_number"), encUint32(64512),
+	)
+	left := nodeCount + 16 // data pointer to offset 0
+	right := nodeCount     // not found
+	buf := []byte{
+		byte(left >> 16), byte(left >> 8), byte(left),
+		byte(right >> 16), byte(right >> 8), byte(right),
+	}
+	buf = append(buf, make([]byte, 16)...)
+	buf = append(buf, data...)
+	buf = append(buf, metadataMarker...)
+	buf = append(buf, encMap(
+		encString("node_count"), encUint32(nodeCount),
+		encString("record_size"), encUint16(24),
+		encString("ip_version"), encUint16(4),
+	)...)
+	return buf
+}
+
+func TestLookup(t *testing.T) {
+	r, err := FromBytes(buildDB())
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := r.Lookup(net.ParseIP("10.1.2.3"), "country", "iso_code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "FR" {
+		t.Fatalf("unexpected country: %v", v)
+	}
+	v, err = r.Lookup(net.ParseIP("10.1.2.3"), "autonomous_system_number")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != uint64(64512) {
+		t.Fatalf("unexpected ASN: %v", v)
+	}
+	v, err = r.Lookup(net.ParseIP("10.1.2.3"), "city", "names")
+	if err != nil || v != nil {
+		t.Fatalf("unexpected result for a missing path: %v, %v", v, err)
+	}
+	v, err = r.Lookup(net.ParseIP("192.168.1.1"), "country", "iso_code")
+	if err != nil || v != nil {
+		t.Fatalf("unexpected result for a missing address: %v, %v", v, err)
+	}
+	record, err := r.Lookup(net.ParseIP("10.1.2.3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, ok := record.(map[string]interface{})
+	if !ok || len(m) != 2 {
+		t.Fatalf("unexpected record: %v", record)
+	}
+}
+
+func TestInvalidDB(t *testing.T) {
+	_, err := FromBytes([]byte("not a database"))
+	if err == nil {
+		t.Fatal("an invalid database was accepted")
+	}
+	db := buildDB()
+	_, err = FromBytes(db[:10])
+	if err == nil {
+		t.Fatal("a truncated database was accepted")
+	}
+}
+
+// The fixtures are made by testdata/generate.go.
+
+func TestCountryFixture(t *testing.T) {
+	r, err := Open(filepath.Join("testdata", "country-ipv6-28.mmdb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = r.Close() }()
+
+	tests := []struct {
+		ip   string
+		path []string
+		// expected is nil when the address or the path is not found
+		expected interface{}
+	}{
+		{"81.2.69.142", []string{"country", "iso_code"}, "FR"},
+		{"81.2.69.142", []string{"country", "names", "fr"}, "France"},
+		{"81.2.69.142", []string{"country", "is_in_european_union"}, true},
+		{"81.2.69.142", []string{"location", "latitude"}, 46.0},
+		{"81.2.69.142", []string{"location", "accuracy_radius"}, uint64(500)},
+		{"81.2.70.1", []string{"country", "iso_code"}, "DE"},
+		{"81.2.71.255", []string{"country", "names", "fr"}, "Allemagne"},
+		{"81.2.72.1", []string{"country", "iso_code"}, nil},
+		{"1.0.20.1", []string{"continent", "code"}, "AS"},
+		{"1.0.20.1", []string{"country", "is_in_european_union"}, nil},
+		{"2a02:8428::1", []string{"country", "iso_code"}, "FR"},
+		{"2001:218:ffff::1", []string{"country", "geoname_id"}, uint64(1861060)},
+		{"2001:4860::8888", []string{"country", "iso_code"}, nil},
+		{"8.8.8.8", nil, nil},
+		{"81.2.69.142", []string{"city", "names", "en"}, nil},
+	}
+	for _, tt := range tests {
+		v, err := r.Lookup(net.ParseIP(tt.ip), tt.path...)
+		if err != nil {
+			t.Errorf("%s %v: %v", tt.ip, tt.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, tt.expected) {
+			t.Errorf("%s %v: expected %#v, got %#v", tt.ip, tt.path, tt.expected, v)
+		}
+	}
+}
+
+func TestASNFixture(t *testing.T) {
+	r, err := Open(filepath.Join("testdata", "asn-ipv4-32.mmdb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = r.Close() }()
+
+	v, err := r.Lookup(net.ParseIP("1.130.4.5"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"autonomous_system_number":       uint64(1221),
+		"autonomous_system_organization": "Telstra Pty Ltd",
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("unexpected record: %#v", v)
+	}
+	v, err = r.Lookup(net.ParseIP("12.81.95.1"), "autonomous_system_organization")
+	if err != nil || v != "A Very Long Autonomous System Organization Name, that needs more than 29 bytes" {
+		t.Fatalf("unexpected organization: %#v, %v", v, err)
+	}
+	v, err = r.Lookup(net.ParseIP("89.160.20.127"), "prefixes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, []interface{}{uint64(1 << 40), int64(-7), float64(1.5), []byte{1, 2}}) {
+		t.Fatalf("unexpected array: %#v", v)
+	}
+	v, err = r.Lookup(net.ParseIP("89.160.20.128"), "autonomous_system_number")
+	if err != nil || v != nil {
+		t.Fatalf("unexpected result for a missing address: %#v, %v", v, err)
+	}
+	_, err = r.Lookup(net.ParseIP("2001:218::1"), "autonomous_system_number")
+	if err == nil {
+		t.Fatal("an IPv6 lookup in an IPv4 database should fail")
+	}
+}
+
+// lookupAll makes the lookups of the fixtures in a possibly malformed
+// database. It must not panic.
+func lookupAll(t *testing.T, db []byte, what string) {
+	defer func() {
+		if e := recover(); e != nil {
+			t.Fatalf("%s: panic: %v", what, e)
+		}
+	}()
+	r, err := FromBytes(db)
+	if err != nil {
+		return
+	}
+	for _, ip := range []string{"81.2.69.142", "1.0.20.1", "2001:218::1", "1.130.4.5", "89.160.20.127", "8.8.8.8"} {
+		_, _ = r.Lookup(net.ParseIP(ip))
+		_, _ = r.Lookup(net.ParseIP(ip), "country", "names", "en")
+		_, _ = r.Lookup(net.ParseIP(ip), "prefixes")
+	}
+}
+
+func TestMalformedDB(t *testing.T) {
+	for _, name := range []string{"country-ipv6-28.mmdb", "asn-ipv4-32.mmdb"} {
+		db, err := ioutil.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < len(db); i++ {
+			lookupAll(t, db[:i], name+" truncated")
+		}
+		rnd := rand.New(rand.NewSource(42))
+		for i := 0; i < 20000; i++ {
+			mutated := append([]byte(nil), db...)
+			for j := rnd.Intn(4); j >= 0; j-- {
+				mutated[rnd.Intn(len(mutated))] = byte(rnd.Intn(256))
+			}
+			lookupAll(t, mutated, name+" mutated")
+		}
+		// the metadata marker is found, but nothing else is valid
+		garbage := bytes.Repeat([]byte{0xFF}, 64)
+		lookupAll(t, append(garbage, metadataMarker...), "garbage")
+		lookupAll(t, append(append(garbage, metadataMarker...), garbage...), "garbage metadata")
+	}
+}
@@ -0,0 +1,327 @@
+// +build ignore
+
+// generate writes the MaxMind DB fixtures of the mmdb tests, following the
+// MaxMind DB format specification (https://maxmind.github.io/MaxMind-DB/):
+//
+//	go run generate.go
+//
+// country-ipv6-28.mmdb is an IPv6 database with 28 bits records, where the
+// IPv4 addresses are in the ::/96 subtree, like the GeoLite2 Country
+// database. asn-ipv4-32.mmdb is an IPv4 database with 32 bits records, like
+// the GeoLite2 ASN database.
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"log"
+	"math"
+	"net"
+	"sort"
+)
+
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// values of the data section
+type (
+	uint16v uint16
+	uint32v uint32
+	uint64v uint64
+	int32v  int32
+	float   float32
+	kv      struct {
+		k string
+		v interface{}
+	}
+	// dict is an ordered map
+	dict []kv
+)
+
+type writer struct {
+	buf bytes.Buffer
+	// strings are written once, the next occurrences are pointers
+	strings map[string]int
+}
+
+func (w *writer) control(typ int, size int) {
+	var ext []byte
+	if typ > 7 {
+		ext = []byte{byte(typ - 7)}
+		typ = typeExtended
+	}
+	var extra []byte
+	switch {
+	case size < 29:
+	case size < 285:
+		extra = []byte{byte(size - 29)}
+		size = 29
+	case size < 65821:
+		v := size - 285
+		extra = []byte{byte(v >> 8), byte(v)}
+		size = 30
+	default:
+		v := size - 65821
+		extra = []byte{byte(v >> 16), byte(v >> 8), byte(v)}
+		size = 31
+	}
+	w.buf.WriteByte(byte(typ<<5 | size))
+	w.buf.Write(ext)
+	w.buf.Write(extra)
+}
+
+func (w *writer) pointer(target int) {
+	switch {
+	case target < 2048:
+		w.buf.WriteByte(byte(typePointer<<5 | target>>8))
+		w.buf.WriteByte(byte(target))
+	case target < 526336:
+		v := target - 2048
+		w.buf.WriteByte(byte(typePointer<<5 | 1<<3 | v>>16))
+		w.buf.Write([]byte{byte(v >> 8), byte(v)})
+	default:
+		v := target - 526336
+		w.buf.WriteByte(byte(typePointer<<5 | 2<<3 | v>>24))
+		w.buf.Write([]byte{byte(v >> 16), byte(v >> 8), byte(v)})
+	}
+}
+
+func minimal(v uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	i := 0
+	for i < 8 && b[i] == 0 {
+		i++
+	}
+	return b[i:]
+}
+
+func (w *writer) write(v interface{}) {
+	switch val := v.(type) {
+	case string:
+		if w.strings != nil {
+			if target, ok := w.strings[val]; ok {
+				w.pointer(target)
+				return
+			}
+			w.strings[val] = w.buf.Len()
+		}
+		w.control(typeString, len(val))
+		w.buf.WriteString(val)
+	case float64:
+		w.control(typeDouble, 8)
+		_ = binary.Write(&w.buf, binary.BigEndian, math.Float64bits(val))
+	case float:
+		w.control(typeFloat, 4)
+		_ = binary.Write(&w.buf, binary.BigEndian, math.Float32bits(float32(val)))
+	case []byte:
+		w.control(typeBytes, len(val))
+		w.buf.Write(val)
+	case uint16v:
+		b := minimal(uint64(val))
+		w.control(typeUint16, len(b))
+		w.buf.Write(b)
+	case uint32v:
+		b := minimal(uint64(val))
+		w.control(typeUint32, len(b))
+		w.buf.Write(b)
+	case uint64v:
+		b := minimal(uint64(val))
+		w.control(typeUint64, len(b))
+		w.buf.Write(b)
+	case int32v:
+		b := minimal(uint64(uint32(val)))
+		w.control(typeInt32, len(b))
+		w.buf.Write(b)
+	case bool:
+		size := 0
+		if val {
+			size = 1
+		}
+		w.control(typeBool, size)
+	case []interface{}:
+		w.control(typeArray, len(val))
+		for _, e := range val {
+			w.write(e)
+		}
+	case dict:
+		w.control(typeMap, len(val))
+		for _, e := range val {
+			w.write(e.k)
+			w.write(e.v)
+		}
+	default:
+		log.Fatalf("unsupported value: %T", v)
+	}
+}
+
+type node struct {
+	children [2]*node
+	// data is the offset of the record in the data section, or -1
+	data int
+}
+
+type network struct {
+	cidr   string
+	record dict
+}
+
+func build(filename string, ipVersion, recordSize int, dbType string, networks []network) {
+	data := &writer{strings: make(map[string]int)}
+	root := &node{data: -1}
+	bits := 128
+	if ipVersion == 4 {
+		bits = 32
+	}
+	for _, n := range networks {
+		_, ipnet, err := net.ParseCIDR(n.cidr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ones, _ := ipnet.Mask.Size()
+		ip := ipnet.IP.To16()
+		if ipVersion == 4 {
+			ip = ipnet.IP.To4()
+		} else if ipnet.IP.To4() != nil {
+			// the IPv4 networks are in ::/96
+			ip = make(net.IP, 16)
+			copy(ip[12:], ipnet.IP.To4())
+			ones += 96
+		}
+		if len(ip)*8 != bits {
+			log.Fatalf("%s does not fit an IPv%d database", n.cidr, ipVersion)
+		}
+		offset := data.buf.Len()
+		data.write(n.record)
+		cur := root
+		for i := 0; i < ones; i++ {
+			bit := ip[i>>3] >> uint(7-i&7) & 1
+			if cur.children[bit] == nil {
+				cur.children[bit] = &node{data: -1}
+			}
+			cur = cur.children[bit]
+		}
+		cur.data = offset
+	}
+
+	// number the inner nodes, breadth first
+	var nodes []*node
+	index := make(map[*node]int)
+	queue := []*node{root}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if n.data >= 0 {
+			continue
+		}
+		index[n] = len(nodes)
+		nodes = append(nodes, n)
+		for _, c := range n.children {
+			if c != nil {
+				queue = append(queue, c)
+			}
+		}
+	}
+	nodeCount := len(nodes)
+	record := func(c *node) int {
+		switch {
+		case c == nil:
+			return nodeCount
+		case c.data >= 0:
+			return nodeCount + 16 + c.data
+		default:
+			return index[c]
+		}
+	}
+
+	var out bytes.Buffer
+	for _, n := range nodes {
+		left, right := record(n.children[0]), record(n.children[1])
+		switch recordSize {
+		case 24:
+			out.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left), byte(right >> 16), byte(right >> 8), byte(right)})
+		case 28:
+			out.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left), byte(left>>24&0x0F<<4 | right>>24&0x0F), byte(right >> 16), byte(right >> 8), byte(right)})
+		case 32:
+			_ = binary.Write(&out, binary.BigEndian, uint32(left))
+			_ = binary.Write(&out, binary.BigEndian, uint32(right))
+		}
+	}
+	out.Write(make([]byte, 16))
+	out.Write(data.buf.Bytes())
+	out.WriteString("\xAB\xCD\xEFMaxMind.com")
+	meta := &writer{}
+	meta.write(dict{
+		{"binary_format_major_version", uint16v(2)},
+		{"binary_format_minor_version", uint16v(0)},
+		{"build_epoch", uint64v(1790000000)},
+		{"database_type", dbType},
+		{"description", dict{{"en", "skewer test database"}}},
+		{"ip_version", uint16v(ipVersion)},
+		{"languages", []interface{}{"en", "fr"}},
+		{"node_count", uint32v(nodeCount)},
+		{"record_size", uint16v(recordSize)},
+	})
+	out.Write(meta.buf.Bytes())
+	err := ioutil.WriteFile(filename, out.Bytes(), 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func country(continent, iso, en, fr string, geonameID uint32, eu bool) dict {
+	c := dict{
+		{"geoname_id", uint32v(geonameID)},
+		{"iso_code", iso},
+		{"names", dict{{"en", en}, {"fr", fr}}},
+	}
+	if eu {
+		c = append(c, kv{"is_in_european_union", true})
+	}
+	sort.Slice(c, func(i, j int) bool { return c[i].k < c[j].k })
+	return dict{
+		{"continent", dict{{"code", continent}}},
+		{"country", c},
+		{"location", dict{{"accuracy_radius", uint16v(500)}, {"latitude", 46.0}, {"longitude", 2.0}}},
+	}
+}
+
+func main() {
+	france := country("EU", "FR", "France", "France", 3017382, true)
+	germany := country("EU", "DE", "Germany", "Allemagne", 2921044, true)
+	japan := country("AS", "JP", "Japan", "Japon", 1861060, false)
+	build("country-ipv6-28.mmdb", 6, 28, "GeoLite2-Country", []network{
+		{"81.2.69.0/24", france},
+		{"81.2.70.0/23", germany},
+		{"2a02:8428::/32", france},
+		{"2001:218::/32", japan},
+		{"1.0.16.0/20", japan},
+	})
+	longName := "A Very Long Autonomous System Organization Name, that needs more than 29 bytes"
+	build("asn-ipv4-32.mmdb", 4, 32, "GeoLite2-ASN", []network{
+		{"1.128.0.0/11", dict{{"autonomous_system_number", uint32v(1221)}, {"autonomous_system_organization", "Telstra Pty Ltd"}}},
+		{"12.81.92.0/22", dict{{"autonomous_system_number", uint32v(7018)}, {"autonomous_system_organization", longName}}},
+		{"89.160.20.112/28", dict{
+			{"autonomous_system_number", uint32v(29518)},
+			{"autonomous_system_organization", "Bredband2 AB"},
+			{"prefixes", []interface{}{uint64v(1 << 40), int32v(-7), float(1.5), []byte{1, 2}}},
+		}},
+	})
+}
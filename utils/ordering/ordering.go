@@ -0,0 +1,161 @@
+// Package ordering verifies, in debug mode, that the messages of a
+// connection are delivered in the order they were received.
+//
+// The stream sources stamp each message with the identifier of its
+// connection and a per-connection sequence number. The destinations check
+// that the sequence numbers of a connection never go backwards, and count
+// the messages that do in skw_reordered_messages_total. The stamps are taken
+// off the messages before they are encoded, so they never reach the
+// destinations.
+package ordering
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils"
+)
+
+const (
+	// Domain is the properties domain of the ordering stamps.
+	Domain  = "ordering"
+	connKey = "conn"
+	seqKey  = "seq"
+)
+
+// ReorderedCounter counts the messages that were delivered after a message
+// of the same connection that was received later.
+var ReorderedCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "skw_reordered_messages_total",
+		Help: "number of messages delivered out of their connection order",
+	},
+	[]string{"protocol"},
+)
+
+// Stamp records the connection and the sequence number of m.
+func Stamp(m *model.SyslogMessage, conn string, seq uint64) {
+	m.SetProperty(Domain, connKey, conn)
+	m.SetProperty(Domain, seqKey, strconv.FormatUint(seq, 10))
+}
+
+// Stamps returns the connection and the sequence number of m, or false when
+// m was not stamped.
+func Stamps(m *model.SyslogMessage) (conn string, seq uint64, ok bool) {
+	kv := m.Properties.Map[Domain]
+	if kv == nil {
+		return "", 0, false
+	}
+	conn = kv.Map[connKey]
+	seq, err := strconv.ParseUint(kv.Map[seqKey], 10, 64)
+	if conn == "" || err != nil {
+		return "", 0, false
+	}
+	return conn, seq, true
+}
+
+// staleAfter is the time after which the last sequence number of a
+// connection that delivered nothing, or the stamps of a message that was not
+// delivered, are forgotten.
+const staleAfter = 10 * time.Minute
+
+type last struct {
+	seq  uint64
+	seen time.Time
+}
+
+type stamp struct {
+	conn string
+	seq  uint64
+	seen time.Time
+}
+
+// Checker tracks the last delivered sequence number of each connection. A nil
+// Checker checks nothing.
+type Checker struct {
+	mu    sync.Mutex
+	conns map[string]last
+	// taken are the stamps of the messages being delivered, by uid
+	taken  map[utils.MyULID]stamp
+	pruned time.Time
+}
+
+// NewChecker returns a Checker when enabled is true, nil otherwise.
+func NewChecker(enabled bool) *Checker {
+	if !enabled {
+		return nil
+	}
+	return &Checker{
+		conns:  make(map[string]last),
+		taken:  make(map[utils.MyULID]stamp),
+		pruned: time.Now(),
+	}
+}
+
+// Take removes the stamps of m before it is encoded, and keeps them for the
+// Check of its delivery. A nil Checker removes the stamps too.
+func (c *Checker) Take(m *model.FullMessage) {
+	if m == nil || m.Fields == nil {
+		return
+	}
+	conn, seq, ok := Stamps(m.Fields)
+	delete(m.Fields.Properties.Map, Domain)
+	if c == nil || !ok {
+		return
+	}
+	c.mu.Lock()
+	c.taken[m.Uid] = stamp{conn: conn, seq: seq, seen: time.Now()}
+	c.mu.Unlock()
+}
+
+// Check accounts for the delivery of m, with the stamps that were taken off
+// m, or else with its stamps. It returns false when m was delivered out of
+// order.
+func (c *Checker) Check(m *model.FullMessage) bool {
+	if c == nil || m == nil {
+		return true
+	}
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.taken[m.Uid]
+	if ok {
+		delete(c.taken, m.Uid)
+	} else if m.Fields != nil {
+		s.conn, s.seq, ok = Stamps(m.Fields)
+	}
+	if !ok {
+		return true
+	}
+	prev, known := c.conns[s.conn]
+	inOrder := !known || s.seq > prev.seq
+	if inOrder {
+		c.conns[s.conn] = last{seq: s.seq, seen: now}
+	}
+	if now.Sub(c.pruned) > staleAfter {
+		c.prune(now)
+	}
+	if !inOrder {
+		ReorderedCounter.WithLabelValues(m.SourceType).Inc()
+	}
+	return inOrder
+}
+
+// prune forgets the stale connections and stamps. It is called with c.mu
+// held.
+func (c *Checker) prune(now time.Time) {
+	for k, v := range c.conns {
+		if now.Sub(v.seen) > staleAfter {
+			delete(c.conns, k)
+		}
+	}
+	for k, v := range c.taken {
+		if now.Sub(v.seen) > staleAfter {
+			delete(c.taken, k)
+		}
+	}
+	c.pruned = now
+}
@@ -0,0 +1,103 @@
+package ordering
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils"
+)
+
+func counterValue(c prometheus.Counter) float64 {
+	m := &dto.Metric{}
+	_ = c.Write(m)
+	return m.GetCounter().GetValue()
+}
+
+func stamped(conn string, seq uint64) *model.FullMessage {
+	m := model.FullFactory()
+	m.SourceType = "relp"
+	Stamp(m.Fields, conn, seq)
+	return m
+}
+
+func TestChecker(t *testing.T) {
+	c := NewChecker(true)
+	before := counterValue(ReorderedCounter.WithLabelValues("relp"))
+
+	for _, seq := range []uint64{1, 2, 4} {
+		if !c.Check(stamped("a", seq)) {
+			t.Errorf("message %d should be in order", seq)
+		}
+	}
+	// another connection has its own sequence
+	if !c.Check(stamped("b", 1)) {
+		t.Error("the first message of a connection should be in order")
+	}
+	if c.Check(stamped("a", 3)) {
+		t.Error("message 3 was delivered after message 4")
+	}
+	// a redelivery is out of order too
+	if c.Check(stamped("a", 4)) {
+		t.Error("message 4 was delivered twice")
+	}
+	if !c.Check(stamped("a", 5)) {
+		t.Error("message 5 should be in order")
+	}
+	if !c.Check(model.FullFactory()) {
+		t.Error("the messages without stamps should not be checked")
+	}
+
+	if n := counterValue(ReorderedCounter.WithLabelValues("relp")) - before; n != 2 {
+		t.Errorf("expected 2 reordered messages, got %v", n)
+	}
+}
+
+func TestDisabledChecker(t *testing.T) {
+	c := NewChecker(false)
+	if c != nil {
+		t.Fatal("a disabled checker should be nil")
+	}
+	c.Check(stamped("a", 2))
+	if !c.Check(stamped("a", 1)) {
+		t.Error("a disabled checker should not check")
+	}
+}
+
+func TestTake(t *testing.T) {
+	c := NewChecker(true)
+	before := counterValue(ReorderedCounter.WithLabelValues("relp"))
+
+	take := func(conn string, seq uint64) *model.FullMessage {
+		m := stamped(conn, seq)
+		m.Uid = utils.NewUid()
+		c.Take(m)
+		if _, ok := m.Fields.Properties.Map[Domain]; ok {
+			t.Fatalf("the stamps of message %d should be removed", seq)
+		}
+		return m
+	}
+	first, second := take("a", 1), take("a", 2)
+	// the delivery is checked with the stamps that were taken
+	if !c.Check(second) {
+		t.Error("message 2 should be in order")
+	}
+	if c.Check(first) {
+		t.Error("message 1 was delivered after message 2")
+	}
+	if n := counterValue(ReorderedCounter.WithLabelValues("relp")) - before; n != 1 {
+		t.Errorf("expected 1 reordered message, got %v", n)
+	}
+	if len(c.taken) != 0 {
+		t.Errorf("the stamps of the delivered messages should be forgotten: %v", c.taken)
+	}
+
+	// a disabled checker removes the stamps too
+	var disabled *Checker
+	m := stamped("a", 3)
+	disabled.Take(m)
+	if _, _, ok := Stamps(m.Fields); ok {
+		t.Error("the stamps should be removed by a disabled checker")
+	}
+}
@@ -0,0 +1,7 @@
+package failq
+
+// Failure associates a RELP transaction number with the reason of its failure.
+type Failure struct {
+	Txnr   int32
+	Reason string
+}
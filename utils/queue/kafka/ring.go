@@ -94,6 +94,46 @@ func (rb *Ring) put(item *model.RawKafkaMessage, offer bool) (bool, error) {
 	return true, nil
 }
 
+// PutBatch adds the provided items to the queue, in order. The consecutive
+// free slots are claimed at once, so that a batch costs fewer
+// synchronizations than the same number of Put calls. If the queue is full,
+// this call will block until there is room for the remaining items or
+// Dispose is called on the queue. It returns the number of items that were
+// added, and an error if the queue is disposed.
+func (rb *Ring) PutBatch(items []*model.RawKafkaMessage) (int, error) {
+	var done int
+	w := waiter.Default()
+	pos := rb.queue.Load()
+
+	for done < len(items) {
+		if rb.disposed.Load() {
+			return done, eerrors.ErrQDisposed
+		}
+
+		free := uint64(0)
+		want := uint64(len(items) - done)
+		for free < want && rb.nodes[(pos+free)&rb.mask].position.Load() == pos+free {
+			free++
+		}
+		if free == 0 || !rb.queue.CAS(pos, pos+free) {
+			pos = rb.queue.Load()
+			w.Wait()
+			continue
+		}
+
+		for i := uint64(0); i < free; i++ {
+			n := rb.nodes[(pos+i)&rb.mask]
+			n.data = items[done]
+			n.position.Store(pos + i + 1)
+			done++
+		}
+		pos += free
+		// the queue moves: the wait for the next slots starts over
+		w.Reset()
+	}
+	return done, nil
+}
+
 // Get will return the next item in the queue.  This call will block
 // if the queue is empty.  This call will unblock when an item is added
 // to the queue or Dispose is called on the queue.  An error will be returned
@@ -148,6 +188,61 @@ func (rb *Ring) Poll(timeout time.Duration) (*model.RawKafkaMessage, error) {
 	return data, nil
 }
 
+// GetBatch removes the next items of the queue, at most len(items), and
+// stores them in items, in order. This call will block if the queue is
+// empty. It returns the number of items that were removed.
+func (rb *Ring) GetBatch(items []*model.RawKafkaMessage) (int, error) {
+	return rb.PollBatch(items, 0)
+}
+
+// PollBatch removes the next items of the queue, at most len(items), and
+// stores them in items, in order. The ready items are claimed at once, so
+// that a batch costs fewer synchronizations than the same number of Poll
+// calls. This call will block until at least one item is available, Dispose
+// is called on the queue, or the timeout is reached. It returns the number
+// of items that were removed. A non-positive timeout will block
+// indefinitely.
+func (rb *Ring) PollBatch(items []*model.RawKafkaMessage, timeout time.Duration) (int, error) {
+	var (
+		pos   = rb.dequeue.Load()
+		start time.Time
+		zero  *model.RawKafkaMessage
+	)
+	if len(items) == 0 {
+		return 0, nil
+	}
+	w := waiter.Default()
+	if timeout > 0 {
+		start = time.Now()
+	}
+
+	for {
+		ready := uint64(0)
+		want := uint64(len(items))
+		for ready < want && rb.nodes[(pos+ready)&rb.mask].position.Load() == pos+ready+1 {
+			ready++
+		}
+		if ready > 0 && rb.dequeue.CAS(pos, pos+ready) {
+			for i := uint64(0); i < ready; i++ {
+				n := rb.nodes[(pos+i)&rb.mask]
+				items[i] = n.data
+				n.data = zero
+				n.position.Store(pos + i + rb.mask + 1)
+			}
+			return int(ready), nil
+		}
+		pos = rb.dequeue.Load()
+
+		if rb.disposed.Load() {
+			return 0, eerrors.ErrQDisposed
+		}
+		if timeout < 0 || (timeout > 0 && time.Since(start) >= timeout) {
+			return 0, eerrors.ErrQTimeout
+		}
+		w.Wait()
+	}
+}
+
 // Len returns the number of items in the queue.
 func (rb *Ring) Len() uint64 {
 	if rb == nil {
@@ -0,0 +1,298 @@
+// This file was automatically generated by genny.
+// Any changes will be lost if this file is regenerated.
+// see https://github.com/cheekybits/genny
+
+package output
+
+import (
+	"time"
+
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+	"github.com/stephane-martin/skewer/utils/waiter"
+	"go.uber.org/atomic"
+)
+
+type node struct {
+	position atomic.Uint64
+	data     *model.OutputMsg
+}
+
+func newNode(pos uint64) *node {
+	var n node
+	n.position.Store(pos)
+	return &n
+}
+
+type nodes []*node
+
+// Ring is a thread-safe bounded queue that stores *model.OutputMsg messages.
+type Ring struct {
+	mask      uint64
+	_padding0 [8]uint64
+	queue     atomic.Uint64
+	_padding1 [8]uint64
+	dequeue   atomic.Uint64
+	_padding2 [8]uint64
+	disposed  atomic.Bool
+	_padding3 [8]uint64
+	nodes     nodes
+}
+
+func (rb *Ring) init(size uint64) {
+	size = roundUp(size)
+	rb.nodes = make(nodes, size)
+	for i := uint64(0); i < size; i++ {
+		rb.nodes[i] = newNode(i)
+	}
+	rb.mask = size - 1 // so we don't have to do this with every put/get operation
+}
+
+// Put adds the provided item to the queue.  If the queue is full, this
+// call will block until an item is added to the queue or Dispose is called
+// on the queue.  An error will be returned if the queue is disposed.
+func (rb *Ring) Put(item *model.OutputMsg) error {
+	_, err := rb.put(item, false)
+	return err
+}
+
+// Offer adds the provided item to the queue if there is space.  If the queue
+// is full, this call will return false.  An error will be returned if the
+// queue is disposed.
+func (rb *Ring) Offer(item *model.OutputMsg) (bool, error) {
+	return rb.put(item, true)
+}
+
+func (rb *Ring) put(item *model.OutputMsg, offer bool) (bool, error) {
+	var n *node
+	w := waiter.Default()
+	pos := rb.queue.Load()
+
+	for {
+		if rb.disposed.Load() {
+			return false, eerrors.ErrQDisposed
+		}
+
+		n = rb.nodes[pos&rb.mask]
+		seq := n.position.Load()
+		if seq == pos {
+			if rb.queue.CAS(pos, pos+1) {
+				break
+			}
+		} else {
+			pos = rb.queue.Load()
+		}
+
+		if offer {
+			return false, nil
+		}
+		w.Wait()
+	}
+
+	n.data = item
+	n.position.Store(pos + 1)
+	return true, nil
+}
+
+// PutBatch adds the provided items to the queue, in order. The consecutive
+// free slots are claimed at once, so that a batch costs fewer
+// synchronizations than the same number of Put calls. If the queue is full,
+// this call will block until there is room for the remaining items or
+// Dispose is called on the queue. It returns the number of items that were
+// added, and an error if the queue is disposed.
+func (rb *Ring) PutBatch(items []*model.OutputMsg) (int, error) {
+	var done int
+	w := waiter.Default()
+	pos := rb.queue.Load()
+
+	for done < len(items) {
+		if rb.disposed.Load() {
+			return done, eerrors.ErrQDisposed
+		}
+
+		free := uint64(0)
+		want := uint64(len(items) - done)
+		for free < want && rb.nodes[(pos+free)&rb.mask].position.Load() == pos+free {
+			free++
+		}
+		if free == 0 || !rb.queue.CAS(pos, pos+free) {
+			pos = rb.queue.Load()
+			w.Wait()
+			continue
+		}
+
+		for i := uint64(0); i < free; i++ {
+			n := rb.nodes[(pos+i)&rb.mask]
+			n.data = items[done]
+			n.position.Store(pos + i + 1)
+			done++
+		}
+		pos += free
+		// the queue moves: the wait for the next slots starts over
+		w.Reset()
+	}
+	return done, nil
+}
+
+// Get will return the next item in the queue.  This call will block
+// if the queue is empty.  This call will unblock when an item is added
+// to the queue or Dispose is called on the queue.  An error will be returned
+// if the queue is disposed.
+func (rb *Ring) Get() (*model.OutputMsg, error) {
+	return rb.Poll(0)
+}
+
+func (rb *Ring) PollDeadline(deadline time.Time) (*model.OutputMsg, error) {
+	return rb.Poll(time.Until(deadline))
+}
+
+// Poll will return the next item in the queue.  This call will block
+// if the queue is empty.  This call will unblock when an item is added
+// to the queue, Dispose is called on the queue, or the timeout is reached. An
+// error will be returned if the queue is disposed or a timeout occurs. A
+// non-positive timeout will block indefinitely.
+func (rb *Ring) Poll(timeout time.Duration) (*model.OutputMsg, error) {
+	var (
+		n     *node
+		pos   = rb.dequeue.Load()
+		start time.Time
+		zero  *model.OutputMsg
+	)
+	w := waiter.Default()
+	if timeout > 0 {
+		start = time.Now()
+	}
+
+	for {
+		n = rb.nodes[pos&rb.mask]
+		seq := n.position.Load()
+		if seq == (pos + 1) {
+			if rb.dequeue.CAS(pos, pos+1) {
+				break
+			}
+		} else {
+			pos = rb.dequeue.Load()
+		}
+
+		if rb.disposed.Load() {
+			return zero, eerrors.ErrQDisposed
+		}
+		if timeout < 0 || (timeout > 0 && time.Since(start) >= timeout) {
+			return zero, eerrors.ErrQTimeout
+		}
+		w.Wait()
+	}
+	data := n.data
+	n.data = zero
+	n.position.Store(pos + rb.mask + 1)
+	return data, nil
+}
+
+// GetBatch removes the next items of the queue, at most len(items), and
+// stores them in items, in order. This call will block if the queue is
+// empty. It returns the number of items that were removed.
+func (rb *Ring) GetBatch(items []*model.OutputMsg) (int, error) {
+	return rb.PollBatch(items, 0)
+}
+
+// PollBatch removes the next items of the queue, at most len(items), and
+// stores them in items, in order. The ready items are claimed at once, so
+// that a batch costs fewer synchronizations than the same number of Poll
+// calls. This call will block until at least one item is available, Dispose
+// is called on the queue, or the timeout is reached. It returns the number
+// of items that were removed. A non-positive timeout will block
+// indefinitely.
+func (rb *Ring) PollBatch(items []*model.OutputMsg, timeout time.Duration) (int, error) {
+	var (
+		pos   = rb.dequeue.Load()
+		start time.Time
+		zero  *model.OutputMsg
+	)
+	if len(items) == 0 {
+		return 0, nil
+	}
+	w := waiter.Default()
+	if timeout > 0 {
+		start = time.Now()
+	}
+
+	for {
+		ready := uint64(0)
+		want := uint64(len(items))
+		for ready < want && rb.nodes[(pos+ready)&rb.mask].position.Load() == pos+ready+1 {
+			ready++
+		}
+		if ready > 0 && rb.dequeue.CAS(pos, pos+ready) {
+			for i := uint64(0); i < ready; i++ {
+				n := rb.nodes[(pos+i)&rb.mask]
+				items[i] = n.data
+				n.data = zero
+				n.position.Store(pos + i + rb.mask + 1)
+			}
+			return int(ready), nil
+		}
+		pos = rb.dequeue.Load()
+
+		if rb.disposed.Load() {
+			return 0, eerrors.ErrQDisposed
+		}
+		if timeout < 0 || (timeout > 0 && time.Since(start) >= timeout) {
+			return 0, eerrors.ErrQTimeout
+		}
+		w.Wait()
+	}
+}
+
+// Len returns the number of items in the queue.
+func (rb *Ring) Len() uint64 {
+	if rb == nil {
+		return 0
+	}
+	return rb.queue.Load() - rb.dequeue.Load()
+}
+
+// Cap returns the capacity of this ring buffer.
+func (rb *Ring) Cap() uint64 {
+	if rb == nil {
+		return 0
+	}
+	return uint64(len(rb.nodes))
+}
+
+// Dispose will dispose of this queue and free any blocked threads
+// in the Put and/or Get methods.  Calling those methods on a disposed
+// queue will return an error.
+func (rb *Ring) Dispose() {
+	if rb != nil {
+		rb.disposed.Store(true)
+	}
+}
+
+// IsDisposed will return a bool indicating if this queue has been
+// disposed.
+func (rb *Ring) IsDisposed() bool {
+	if rb == nil {
+		return true
+	}
+	return rb.disposed.Load()
+}
+
+// NewRing will allocate, initialize, and return a ring buffer
+// with the specified size.
+func NewRing(size uint64) *Ring {
+	rb := &Ring{}
+	rb.init(size)
+	return rb
+}
+
+func roundUp(v uint64) uint64 {
+	v--
+	v |= v >> 1
+	v |= v >> 2
+	v |= v >> 4
+	v |= v >> 8
+	v |= v >> 16
+	v |= v >> 32
+	v++
+	return v
+}
@@ -0,0 +1,154 @@
+package tcp
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+func TestRingBatchOrder(t *testing.T) {
+	const producers = 4
+	const perProducer = 300
+	// the batches wrap around the ring, and often wait for room
+	rb := NewRing(32)
+
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			batch := make([]*model.RawTCPMessage, 0, 13)
+			for i := 1; i <= perProducer; i++ {
+				batch = append(batch, &model.RawTCPMessage{Txnr: int32(i), LocalPort: p})
+				if len(batch) == cap(batch) || i == perProducer {
+					n, err := rb.PutBatch(batch)
+					if err != nil || n != len(batch) {
+						t.Errorf("PutBatch: n=%d, err=%v", n, err)
+						return
+					}
+					batch = batch[:0]
+				}
+			}
+			// the single message Put still works along the batches
+			_ = rb.Put(&model.RawTCPMessage{Txnr: perProducer + 1, LocalPort: p})
+		}(p)
+	}
+
+	last := make([]int32, producers)
+	items := make([]*model.RawTCPMessage, 5)
+	for received := 0; received < producers*(perProducer+1); {
+		n, err := rb.GetBatch(items)
+		if err != nil || n == 0 {
+			t.Fatalf("GetBatch: n=%d, err=%v", n, err)
+		}
+		for _, raw := range items[:n] {
+			if raw.Txnr != last[raw.LocalPort]+1 {
+				t.Fatalf("producer %d: message %d after %d", raw.LocalPort, raw.Txnr, last[raw.LocalPort])
+			}
+			last[raw.LocalPort] = raw.Txnr
+		}
+		received += n
+	}
+	wg.Wait()
+	if rb.Len() != 0 {
+		t.Fatalf("the ring should be empty: %d", rb.Len())
+	}
+
+	// an empty ring times out, and a disposed ring unblocks the writers
+	_, err := rb.PollBatch(items, -1)
+	if err != eerrors.ErrQTimeout {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+	full := make([]*model.RawTCPMessage, 40)
+	for i := range full {
+		full[i] = &model.RawTCPMessage{}
+	}
+	done := make(chan int)
+	go func() {
+		n, _ := rb.PutBatch(full)
+		done <- n
+	}()
+	for rb.Len() < rb.Cap() {
+		runtime.Gosched()
+	}
+	rb.Dispose()
+	if n := <-done; n != int(rb.Cap()) {
+		t.Fatalf("expected %d added messages, got %d", rb.Cap(), n)
+	}
+}
+
+// BenchmarkRawQueue compares the single message and the batched operations
+// on the raw messages queue, with many producers (the RELP connections) and
+// a few consumers (the parsers).
+func BenchmarkRawQueue(b *testing.B) {
+	for _, size := range []int{1, 8, 32} {
+		name := "single"
+		if size > 1 {
+			name = fmt.Sprintf("batch=%d", size)
+		}
+		b.Run(name, func(b *testing.B) {
+			benchmarkRawQueue(b, size)
+		})
+	}
+}
+
+func benchmarkRawQueue(b *testing.B, size int) {
+	const producers = 16
+	const consumers = 4
+	rb := NewRing(65536)
+	raw := &model.RawTCPMessage{}
+	perProducer := b.N/producers + 1
+
+	var consumed sync.WaitGroup
+	for c := 0; c < consumers; c++ {
+		consumed.Add(1)
+		go func() {
+			defer consumed.Done()
+			items := make([]*model.RawTCPMessage, size)
+			for {
+				var err error
+				if size == 1 {
+					_, err = rb.Get()
+				} else {
+					_, err = rb.GetBatch(items)
+				}
+				if err != nil {
+					return
+				}
+			}
+		}()
+	}
+
+	b.ResetTimer()
+	var produced sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		produced.Add(1)
+		go func() {
+			defer produced.Done()
+			batch := make([]*model.RawTCPMessage, 0, size)
+			for i := 0; i < perProducer; i++ {
+				if size == 1 {
+					_ = rb.Put(raw)
+					continue
+				}
+				batch = append(batch, raw)
+				if len(batch) == size {
+					_, _ = rb.PutBatch(batch)
+					batch = batch[:0]
+				}
+			}
+			_, _ = rb.PutBatch(batch)
+		}()
+	}
+	produced.Wait()
+	for rb.Len() > 0 {
+		runtime.Gosched()
+	}
+	b.StopTimer()
+	rb.Dispose()
+	consumed.Wait()
+}
@@ -0,0 +1,121 @@
+// Package recenterrors keeps the last significant errors of a process, so that
+// operators can see the recent failures without grepping the logs.
+package recenterrors
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultSize is the number of errors kept by the default buffer.
+const DefaultSize = 100
+
+// Error classes.
+const (
+	Fatal    = "fatal"
+	NonFatal = "non_fatal"
+	Nack     = "nack"
+	Parse    = "parse"
+)
+
+// Entry is a recorded error.
+type Entry struct {
+	Time      time.Time `json:"time"`
+	Component string    `json:"component"`
+	Class     string    `json:"class"`
+	Error     string    `json:"error"`
+}
+
+// Snapshot is the content of a buffer. Suppressed counts the errors that were
+// dropped because the buffer was full.
+type Snapshot struct {
+	Entries    []Entry `json:"entries"`
+	Suppressed uint64  `json:"suppressed"`
+}
+
+// Buffer is a bounded buffer of errors. When it is full, the oldest error is
+// dropped.
+type Buffer struct {
+	mu         sync.Mutex
+	entries    []Entry
+	next       int
+	full       bool
+	suppressed uint64
+}
+
+// New creates a buffer that keeps the last size errors.
+func New(size int) *Buffer {
+	if size <= 0 {
+		size = DefaultSize
+	}
+	return &Buffer{entries: make([]Entry, size)}
+}
+
+// Add records an error.
+func (b *Buffer) Add(component, class string, err error) {
+	if err == nil {
+		return
+	}
+	e := Entry{
+		Time:      time.Now(),
+		Component: component,
+		Class:     class,
+		Error:     err.Error(),
+	}
+	b.mu.Lock()
+	if b.full {
+		b.suppressed++
+	}
+	b.entries[b.next] = e
+	b.next++
+	if b.next == len(b.entries) {
+		b.next = 0
+		b.full = true
+	}
+	b.mu.Unlock()
+}
+
+// Snapshot returns the recorded errors, the oldest first.
+func (b *Buffer) Snapshot() Snapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := Snapshot{Suppressed: b.suppressed}
+	if b.full {
+		s.Entries = make([]Entry, 0, len(b.entries))
+		s.Entries = append(s.Entries, b.entries[b.next:]...)
+	} else {
+		s.Entries = make([]Entry, 0, b.next)
+	}
+	s.Entries = append(s.Entries, b.entries[:b.next]...)
+	return s
+}
+
+// Default is the buffer of the process.
+var Default = New(DefaultSize)
+
+// Add records an error in the default buffer.
+func Add(component, class string, err error) {
+	Default.Add(component, class, err)
+}
+
+// Merge merges the snapshots of several processes, and keeps the last size
+// errors. The errors that don't fit are counted as suppressed.
+func Merge(size int, snapshots ...Snapshot) Snapshot {
+	var res Snapshot
+	for _, s := range snapshots {
+		res.Entries = append(res.Entries, s.Entries...)
+		res.Suppressed += s.Suppressed
+	}
+	sort.SliceStable(res.Entries, func(i, j int) bool {
+		return res.Entries[i].Time.Before(res.Entries[j].Time)
+	})
+	if size > 0 && len(res.Entries) > size {
+		res.Suppressed += uint64(len(res.Entries) - size)
+		res.Entries = res.Entries[len(res.Entries)-size:]
+	}
+	if res.Entries == nil {
+		res.Entries = []Entry{}
+	}
+	return res
+}
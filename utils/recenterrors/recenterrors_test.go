@@ -0,0 +1,54 @@
+package recenterrors
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBufferDropsOldest(t *testing.T) {
+	b := New(3)
+	if s := b.Snapshot(); len(s.Entries) != 0 || s.Suppressed != 0 {
+		t.Fatalf("unexpected snapshot of an empty buffer: %+v", s)
+	}
+	for i := 0; i < 5; i++ {
+		b.Add("relp", NonFatal, fmt.Errorf("error %d", i))
+	}
+	b.Add("relp", NonFatal, nil)
+	s := b.Snapshot()
+	if s.Suppressed != 2 {
+		t.Fatalf("expected 2 suppressed errors, got %d", s.Suppressed)
+	}
+	if len(s.Entries) != 3 {
+		t.Fatalf("expected 3 errors, got %d", len(s.Entries))
+	}
+	for i, e := range s.Entries {
+		if e.Error != fmt.Sprintf("error %d", i+2) {
+			t.Fatalf("unexpected error at position %d: %s", i, e.Error)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	now := time.Now()
+	a := Snapshot{
+		Entries:    []Entry{{Time: now, Error: "a1"}, {Time: now.Add(2 * time.Second), Error: "a2"}},
+		Suppressed: 1,
+	}
+	b := Snapshot{
+		Entries: []Entry{{Time: now.Add(time.Second), Error: "b1"}, {Time: now.Add(3 * time.Second), Error: "b2"}},
+	}
+	s := Merge(3, a, b)
+	if s.Suppressed != 2 {
+		t.Fatalf("expected 2 suppressed errors, got %d", s.Suppressed)
+	}
+	expected := []string{"b1", "a2", "b2"}
+	if len(s.Entries) != len(expected) {
+		t.Fatalf("unexpected merged errors: %+v", s.Entries)
+	}
+	for i, e := range s.Entries {
+		if e.Error != expected[i] {
+			t.Fatalf("unexpected error at position %d: %s", i, e.Error)
+		}
+	}
+}
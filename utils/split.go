@@ -3,6 +3,7 @@ package utils
 import (
 	"bufio"
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"net"
@@ -213,6 +214,107 @@ func MakeDecryptSplit(secret *memguard.LockedBuffer) bufio.SplitFunc {
 	return spl
 }
 
+// FrameWriter writes length-prefixed frames (4-byte big-endian length, then
+// the payload), optionally encrypted. It is used on the message pipes between
+// the plugins, the controller and the Store, where the payloads are binary.
+type FrameWriter struct {
+	dest io.Writer
+	key  *memguard.LockedBuffer
+}
+
+func NewFrameWriter(dest io.Writer, encryptkey *memguard.LockedBuffer) *FrameWriter {
+	return &FrameWriter{
+		dest: dest,
+		key:  encryptkey,
+	}
+}
+
+func (s *FrameWriter) Write(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	buf := getBuf()
+	if s.key == nil {
+		if cap(buf) < 4+len(p) {
+			buf = make([]byte, 0, 4+len(p))
+		}
+		buf = buf[:4]
+		binary.BigEndian.PutUint32(buf, uint32(len(p)))
+		buf = append(buf, p...)
+	} else {
+		encLength := len(p) + 24 + secretbox.Overhead
+		if cap(buf) < 4+encLength {
+			buf = make([]byte, 4+encLength)
+		}
+		buf = buf[:4+encLength]
+		_, err = sbox.EncryptTo(p, s.key, buf[:4])
+		if err != nil {
+			return 0, err
+		}
+		binary.BigEndian.PutUint32(buf[:4], uint32(encLength))
+	}
+	// as in EncryptWriter, s.dest gets a copy of buf
+	_, err = io.WriteString(s.dest, string(buf))
+	spool.Put(buf)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// FrameOverhead is the maximum number of bytes that a FrameWriter adds to a
+// message: the length prefix and the encryption box.
+const FrameOverhead = 4 + 24 + secretbox.Overhead
+
+// MakeFrameSplit returns a split function that extracts and decrypts the
+// frames written by a FrameWriter. Messages larger than maxSize, once
+// decrypted, are rejected. The scanner buffer must be able to hold
+// maxSize+FrameOverhead bytes.
+func MakeFrameSplit(secret *memguard.LockedBuffer, maxSize int) bufio.SplitFunc {
+	buf := make([]byte, 0, 4096)
+	if secret != nil && maxSize > 0 {
+		// the limit applies to the plaintext, not to the encrypted frame
+		maxSize += 24 + secretbox.Overhead
+	}
+	// same assumptions as MakeDecryptSplit
+	spl := func(data []byte, atEOF bool) (adv int, dec []byte, err error) {
+		var tok []byte
+		adv, tok, err = FrameSplit(data, atEOF, maxSize)
+		if err != nil || tok == nil || secret == nil {
+			return adv, tok, err
+		}
+		if sbox.LenDecrypted(tok) <= 4096 {
+			dec, err = sbox.DecryptTo(tok, secret, buf[:0])
+		} else {
+			dec, err = sbox.Decrypt(tok, secret)
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		return adv, dec, nil
+	}
+	return spl
+}
+
+// FrameSplit extracts one length-prefixed frame.
+func FrameSplit(data []byte, atEOF bool, maxSize int) (advance int, token []byte, eoferr error) {
+	if atEOF {
+		eoferr = io.EOF
+	}
+	if len(data) < 4 {
+		return 0, nil, eoferr
+	}
+	datalen := int(binary.BigEndian.Uint32(data[:4]))
+	if maxSize > 0 && datalen > maxSize {
+		return 0, nil, fmt.Errorf("Frame too large: %d > %d", datalen, maxSize)
+	}
+	advance = 4 + datalen
+	if len(data) < advance {
+		return 0, nil, eoferr
+	}
+	return advance, data[4:advance], nil
+}
+
 var sp = byte(' ')
 var zero = byte('0')
 var nine = byte('9')
@@ -245,46 +347,108 @@ func PluginSplit(data []byte, atEOF bool) (advance int, token []byte, eoferr err
 	return advance, data[11:advance], nil
 }
 
-// RelpSplit is used to extract RELP lines from the incoming TCP stream
+// RelpSplit is used to extract RELP lines from the incoming TCP stream. The
+// token is "TXNR COMMAND[ DATA]": DATA is made of exactly DATALEN bytes and is
+// not trimmed, as the payload may legitimately contain spaces and newlines.
 func RelpSplit(data []byte, atEOF bool) (advance int, token []byte, eoferr error) {
 	if atEOF {
 		eoferr = io.EOF
 	}
-	// TXNR COMMAND DATALEN[ DATA]\n
-	fields, adv := NFields(data, 3)
-	if len(fields) < 3 || adv == len(data) {
+	txnrB, command, datalen, adv, err := relpHeader(data)
+	if err != nil {
+		return 0, nil, err
+	}
+	if adv == 0 {
 		return 0, nil, eoferr
 	}
+	return relpToken(data, txnrB, command, datalen, adv, eoferr)
+}
 
-	txnrB := fields[0]
-	command := fields[1]
-	datalenB := fields[2]
+// RelpSplitter extracts RELP lines like RelpSplit, but the frames whose data
+// is larger than MaxSize are not buffered: their data is skipped, and the
+// token only holds "TXNR COMMAND". Oversized then gives the DATALEN of the
+// frame, until the next token.
+type RelpSplitter struct {
+	MaxSize   int
+	Oversized int
+	skip      int
+}
 
-	_, err := strconv.Atoi(string(txnrB))
+func (s *RelpSplitter) Split(data []byte, atEOF bool) (advance int, token []byte, eoferr error) {
+	if atEOF {
+		eoferr = io.EOF
+	}
+	if s.skip > 0 {
+		// discard the data of an oversized frame
+		advance = s.skip
+		if len(data) < advance {
+			advance = len(data)
+		}
+		s.skip -= advance
+		if advance == 0 {
+			return 0, nil, eoferr
+		}
+		return advance, nil, nil
+	}
+	txnrB, command, datalen, adv, err := relpHeader(data)
 	if err != nil {
 		return 0, nil, err
 	}
+	if adv == 0 {
+		return 0, nil, eoferr
+	}
+	if s.MaxSize > 0 && datalen > s.MaxSize {
+		s.Oversized = datalen
+		s.skip = datalen + 1 // DATA LF
+		return adv + 1, relpTokenPrefix(txnrB, command, 0), nil
+	}
+	s.Oversized = 0
+	return relpToken(data, txnrB, command, datalen, adv, eoferr)
+}
 
-	datalen, err := strconv.Atoi(string(datalenB))
+// relpHeader parses "TXNR COMMAND DATALEN". adv is 0 if the header is not
+// complete yet.
+func relpHeader(data []byte) (txnrB, command []byte, datalen int, adv int, err error) {
+	fields, adv := NFields(data, 3)
+	if len(fields) < 3 || adv == len(data) {
+		return nil, nil, 0, 0, nil
+	}
+	txnrB = fields[0]
+	command = fields[1]
+	_, err = strconv.Atoi(string(txnrB))
 	if err != nil {
-		return 0, nil, err
+		return nil, nil, 0, 0, err
+	}
+	datalen, err = strconv.Atoi(string(fields[2]))
+	if err != nil {
+		return nil, nil, 0, 0, err
+	}
+	if datalen < 0 {
+		return nil, nil, 0, 0, fmt.Errorf("Negative RELP DATALEN: %d", datalen)
 	}
+	return txnrB, command, datalen, adv, nil
+}
 
-	token = make([]byte, 0, adv+datalen+2)
+func relpTokenPrefix(txnrB, command []byte, datalen int) []byte {
+	token := make([]byte, 0, len(txnrB)+len(command)+datalen+2)
 	token = append(token, txnrB...)
 	token = append(token, ' ')
-	token = append(token, command...)
+	return append(token, command...)
+}
+
+func relpToken(data, txnrB, command []byte, datalen int, adv int, eoferr error) (int, []byte, error) {
+	token := relpTokenPrefix(txnrB, command, datalen)
 	if datalen == 0 {
 		return adv, token, nil
 	}
-
-	advance = adv + (datalen + 1) + 1 // SP DATA LF
-	if len(data) >= advance {
-		token = append(token, ' ')
-		token = append(token, bytes.TrimSpace(data[adv+1:advance])...)
-		return advance, token, nil
+	// only the framing is removed: the SP before DATA, and the LF after
+	advance := adv + (datalen + 1) + 1 // SP DATA LF
+	if len(data) < advance {
+		return 0, nil, eoferr
 	}
-	return 0, nil, eoferr
+	token = append(token, ' ')
+	token = append(token, data[adv+1:advance-1]...)
+	return advance, token, nil
 }
 
 func NFields(s []byte, n int) (fields [][]byte, advance int) {
@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"testing"
+
+	"github.com/awnumar/memguard"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrameSplit(t *testing.T) {
+	large := bytes.Repeat([]byte("0000000012 \n"), 20000)
+	secret, err := memguard.NewImmutableRandom(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer secret.Destroy()
+
+	tests := []struct {
+		name   string
+		secret *memguard.LockedBuffer
+	}{
+		{"clear", nil},
+		{"encrypted", secret},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := [][]byte{
+				// would be mistaken for the previous "%010d " header
+				[]byte("0000000003 abc"),
+				// binary payload with spaces, newlines and NUL bytes
+				{0, ' ', '\n', 0, 0, 0, 4, ' ', '9'},
+				large,
+			}
+			buf := bytes.NewBuffer(nil)
+			w := NewFrameWriter(buf, tt.secret)
+			for _, m := range messages {
+				n, err := w.Write(m)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, len(m), n)
+			}
+
+			scanner := bufio.NewScanner(buf)
+			scanner.Split(MakeFrameSplit(tt.secret, 1<<20))
+			scanner.Buffer(make([]byte, 0, 4096), 1<<20+FrameOverhead)
+			for _, m := range messages {
+				if !scanner.Scan() {
+					t.Fatalf("scan failed: %v", scanner.Err())
+				}
+				assert.Equal(t, m, scanner.Bytes())
+			}
+			assert.False(t, scanner.Scan())
+			assert.NoError(t, scanner.Err())
+		})
+	}
+}
+
+func TestFrameSplitTooLarge(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	_, err := NewFrameWriter(buf, nil).Write(make([]byte, 1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = FrameSplit(buf.Bytes(), false, 512)
+	assert.Error(t, err)
+
+	// the limit applies to the decrypted message
+	secret, err := memguard.NewImmutableRandom(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer secret.Destroy()
+	for _, size := range []int{512, 513} {
+		buf.Reset()
+		_, err = NewFrameWriter(buf, secret).Write(make([]byte, size))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, token, err := MakeFrameSplit(secret, 512)(buf.Bytes(), false)
+		if size > 512 {
+			assert.Error(t, err)
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, size, len(token))
+		}
+	}
+}
+
+func TestRelpSplit(t *testing.T) {
+	message := " multi\nline \r\n message "
+	stream := "1 open 0\n2 syslog " + strconv.Itoa(len(message)) + " " + message + "\n3 close 0\n"
+	scanner := bufio.NewScanner(bytes.NewBufferString(stream))
+	scanner.Split(RelpSplit)
+	expected := []string{"1 open", "2 syslog " + message, "3 close"}
+	for _, e := range expected {
+		if !scanner.Scan() {
+			t.Fatalf("scan failed: %v", scanner.Err())
+		}
+		assert.Equal(t, e, scanner.Text())
+	}
+	assert.False(t, scanner.Scan())
+	assert.NoError(t, scanner.Err())
+}
+
+func TestRelpSplitterOversized(t *testing.T) {
+	large := bytes.Repeat([]byte("x\n"), 5000)
+	stream := "1 syslog " + strconv.Itoa(len(large)) + " " + string(large) + "\n2 syslog 2 ok\n"
+	splitter := &RelpSplitter{MaxSize: 100}
+	scanner := bufio.NewScanner(bytes.NewBufferString(stream))
+	scanner.Split(splitter.Split)
+	scanner.Buffer(make([]byte, 0, 128), 256)
+
+	assert.True(t, scanner.Scan())
+	assert.Equal(t, "1 syslog", scanner.Text())
+	assert.Equal(t, len(large), splitter.Oversized)
+	assert.True(t, scanner.Scan())
+	assert.Equal(t, "2 syslog ok", scanner.Text())
+	assert.Equal(t, 0, splitter.Oversized)
+	assert.False(t, scanner.Scan())
+	assert.NoError(t, scanner.Err())
+}
@@ -31,8 +31,8 @@ func NewTLSConfig(address, caFile, caPath, certFile, keyFile string, insecure bo
 
 	if len(certFile) > 0 && len(keyFile) > 0 {
 		if confined {
-			certFile = filepath.Join("/tmp", "certfiles", certFile)
-			keyFile = filepath.Join("/tmp", "certfiles", keyFile)
+			certFile = confinedCertFile(certFile)
+			keyFile = confinedCertFile(keyFile)
 		}
 		tlsCert, err := tls.LoadX509KeyPair(certFile, keyFile)
 		if err != nil {
@@ -42,7 +42,7 @@ func NewTLSConfig(address, caFile, caPath, certFile, keyFile string, insecure bo
 	}
 
 	if len(caFile) > 0 && confined {
-		caFile = filepath.Join("/tmp", "certfiles", caFile)
+		caFile = confinedCertFile(caFile)
 	}
 
 	if len(caPath) > 0 && confined {
@@ -59,3 +59,9 @@ func NewTLSConfig(address, caFile, caPath, certFile, keyFile string, insecure bo
 
 	return tlsClientConfig, nil
 }
+
+// confinedCertFile returns the path where a certificate file is mounted in
+// the namespace of a confined plugin.
+func confinedCertFile(f string) string {
+	return filepath.Join("/tmp", "certfiles", f)
+}
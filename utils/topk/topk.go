@@ -0,0 +1,126 @@
+// Package topk estimates the most frequent items of a stream in bounded
+// memory.
+package topk
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// Item is an item tracked by a SpaceSaving sketch. The true count of the
+// item is between Count-Err and Count.
+type Item struct {
+	Key   string
+	Count uint64
+	Err   uint64
+	pos   int
+}
+
+// SpaceSaving implements the space-saving algorithm (Metwally, Agrawal and
+// El Abbadi, "Efficient Computation of Frequent and Top-k Elements in Data
+// Streams"). It tracks at most capacity items: when a new item arrives and
+// the sketch is full, the item with the smallest count is replaced, and the
+// new item inherits its count as the error. It is not safe for concurrent
+// use.
+type SpaceSaving struct {
+	capacity int
+	items    itemsHeap
+	index    map[string]*Item
+}
+
+// New returns a sketch that tracks at most capacity items.
+func New(capacity int) *SpaceSaving {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &SpaceSaving{
+		capacity: capacity,
+		items:    make(itemsHeap, 0, capacity),
+		index:    make(map[string]*Item, capacity),
+	}
+}
+
+// Add counts n more occurrences of key, and returns its estimated count and
+// the maximum error of the estimation.
+func (s *SpaceSaving) Add(key string, n uint64) (count, err uint64) {
+	if item, ok := s.index[key]; ok {
+		item.Count += n
+		heap.Fix(&s.items, item.pos)
+		return item.Count, item.Err
+	}
+	if len(s.items) < s.capacity {
+		item := &Item{Key: key, Count: n}
+		heap.Push(&s.items, item)
+		s.index[key] = item
+		return item.Count, item.Err
+	}
+	// replace the item with the smallest count
+	item := s.items[0]
+	delete(s.index, item.Key)
+	item.Key = key
+	item.Err = item.Count
+	item.Count += n
+	s.index[key] = item
+	heap.Fix(&s.items, 0)
+	return item.Count, item.Err
+}
+
+// Get returns the estimated count of key and the maximum error. ok is false
+// when the key is not tracked: its count is then at most Min().
+func (s *SpaceSaving) Get(key string) (count, err uint64, ok bool) {
+	item, ok := s.index[key]
+	if !ok {
+		return 0, 0, false
+	}
+	return item.Count, item.Err, true
+}
+
+// Min returns the smallest estimated count among the tracked items, or 0
+// when the sketch is not full.
+func (s *SpaceSaving) Min() uint64 {
+	if len(s.items) < s.capacity {
+		return 0
+	}
+	return s.items[0].Count
+}
+
+// Top returns the k items with the highest estimated counts, by decreasing
+// count.
+func (s *SpaceSaving) Top(k int) []Item {
+	top := make([]Item, 0, len(s.items))
+	for _, item := range s.items {
+		top = append(top, *item)
+	}
+	sort.Slice(top, func(i, j int) bool {
+		return top[i].Count > top[j].Count
+	})
+	if k >= 0 && k < len(top) {
+		top = top[:k]
+	}
+	return top
+}
+
+// itemsHeap is a min-heap of the items by count.
+type itemsHeap []*Item
+
+func (h itemsHeap) Len() int           { return len(h) }
+func (h itemsHeap) Less(i, j int) bool { return h[i].Count < h[j].Count }
+
+func (h itemsHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].pos = i
+	h[j].pos = j
+}
+
+func (h *itemsHeap) Push(x interface{}) {
+	item := x.(*Item)
+	item.pos = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *itemsHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,54 @@
+package topk
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSpaceSavingHeavyHitters(t *testing.T) {
+	// the items more frequent than 1/20 of the stream are always tracked
+	s := New(20)
+	// two heavy hitters in a stream of unique items
+	for i := 0; i < 10000; i++ {
+		s.Add(fmt.Sprintf("unique-%d", i), 1)
+		if i%4 == 0 {
+			s.Add("heavy-1", 1)
+		}
+		if i%10 == 0 {
+			s.Add("heavy-2", 1)
+		}
+	}
+	top := s.Top(2)
+	if len(top) != 2 || top[0].Key != "heavy-1" || top[1].Key != "heavy-2" {
+		t.Fatalf("the heavy hitters were not found: %+v", top)
+	}
+	// the true counts are within the error bounds
+	if count, err, _ := s.Get("heavy-1"); count < 2500 || count-err > 2500 {
+		t.Fatalf("wrong estimation for heavy-1: count=%d err=%d", count, err)
+	}
+	if count, err, _ := s.Get("heavy-2"); count < 1000 || count-err > 1000 {
+		t.Fatalf("wrong estimation for heavy-2: count=%d err=%d", count, err)
+	}
+	if len(s.Top(-1)) != 20 {
+		t.Fatal("the sketch should track exactly its capacity")
+	}
+}
+
+func TestSpaceSavingMin(t *testing.T) {
+	s := New(2)
+	s.Add("a", 5)
+	if s.Min() != 0 {
+		t.Fatal("the minimum of a sketch that is not full should be 0")
+	}
+	s.Add("b", 3)
+	if s.Min() != 3 {
+		t.Fatalf("unexpected minimum: %d", s.Min())
+	}
+	count, err := s.Add("c", 1)
+	if count != 4 || err != 3 {
+		t.Fatalf("unexpected estimation for the replacing item: count=%d err=%d", count, err)
+	}
+	if _, _, ok := s.Get("b"); ok {
+		t.Fatal("the smallest item should have been replaced")
+	}
+}